@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"mime/multipart"
@@ -17,6 +18,7 @@ import (
 
 	"auralis_back/authorization"
 	knowledge "auralis_back/knowledge"
+	"auralis_back/ratelimit"
 	filestore "auralis_back/storage"
 	"auralis_back/tts"
 	jwt "github.com/appleboy/gin-jwt/v2"
@@ -108,14 +110,22 @@ func (m *Module) reviewRequired() bool {
 	return value
 }
 
+// knowledgeUploadRateLimit 限制知识库文档的上传与更新频率，上传会触发切分与向量化。
+var knowledgeUploadRateLimit = ratelimit.Policy{
+	Name:  "knowledge-upload",
+	Key:   ratelimit.KeyUser,
+	Limit: ratelimit.PerWindow(30, time.Hour),
+	Roles: map[string]ratelimit.Limit{authorization.RoleAdmin: ratelimit.Unlimited},
+}
+
 // RegisterRoutes 初始化智能体模块并注册所有相关路由。
-func RegisterRoutes(router *gin.Engine, guard *authorization.Guard) (*Module, error) {
+func RegisterRoutes(router *gin.Engine, guard *authorization.Guard, limiter *ratelimit.Limiter) (*Module, error) {
 	db, err := openDatabaseFromEnv()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.AutoMigrate(&Agent{}, &AgentChatConfig{}, &AgentRating{}); err != nil {
+	if err := db.AutoMigrate(&Agent{}, &AgentChatConfig{}, &AgentRating{}, &AgentProactiveConfig{}, &AgentLocale{}); err != nil {
 		return nil, err
 	}
 
@@ -126,6 +136,9 @@ func RegisterRoutes(router *gin.Engine, guard *authorization.Guard) (*Module, er
 	if err := knowledgeService.AutoMigrate(); err != nil {
 		return nil, err
 	}
+	knowledgeService.SetChunkOptionsResolver(chunkOptionsResolver(db))
+	knowledgeService.StartCrawlScheduler()
+	knowledgeService.StartIngestWorkers()
 
 	avatarStore, err := filestore.NewAvatarStorageFromEnv()
 	if err != nil {
@@ -142,8 +155,6 @@ func RegisterRoutes(router *gin.Engine, guard *authorization.Guard) (*Module, er
 	group := router.Group("/agents")
 	group.GET("", module.handleListAgents)
 	group.GET("/:id", module.handleGetAgent)
-	group.POST("/:id/conversations", module.handleCreateConversation)
-	group.DELETE("/:id/conversations", module.handleClearConversation)
 	group.GET("/:id/ratings", module.handleGetRatings)
 	group.PUT("/:id/ratings", module.handleUpsertRating)
 
@@ -156,12 +167,29 @@ func RegisterRoutes(router *gin.Engine, guard *authorization.Guard) (*Module, er
 		})
 	}
 	authGroup.POST("", module.handleCreateAgent)
+	authGroup.POST("/:id/conversations", module.handleCreateConversation)
+	authGroup.DELETE("/:id/conversations", module.handleClearConversation)
+	authGroup.POST("/prompt/validate", module.handleValidatePrompt)
 	authGroup.GET("/mine", module.handleListMyAgents)
 	authGroup.GET("/:id/knowledge", module.handleListKnowledgeDocuments)
-	authGroup.POST("/:id/knowledge", module.handleCreateKnowledgeDocument)
+	authGroup.POST("/:id/knowledge", limiter.Handler(knowledgeUploadRateLimit), module.handleCreateKnowledgeDocument)
+	authGroup.GET("/:id/knowledge/crawls", module.handleListKnowledgeCrawls)
+	authGroup.POST("/:id/knowledge/crawls", limiter.Handler(knowledgeCrawlRateLimit), module.handleCreateKnowledgeCrawl)
+	authGroup.POST("/:id/knowledge/crawls/:crawlID/run", limiter.Handler(knowledgeCrawlRateLimit), module.handleRunKnowledgeCrawl)
+	authGroup.DELETE("/:id/knowledge/crawls/:crawlID", module.handleDeleteKnowledgeCrawl)
+	authGroup.GET("/:id/knowledge/index", module.handleGetKnowledgeIndex)
+	authGroup.POST("/:id/knowledge/reindex", module.handleReindexKnowledge)
+	authGroup.POST("/:id/knowledge/search", limiter.Handler(knowledgeSearchRateLimit), module.handleSearchKnowledge)
 	authGroup.GET("/:id/knowledge/:docID", module.handleGetKnowledgeDocument)
-	authGroup.PUT("/:id/knowledge/:docID", module.handleUpdateKnowledgeDocument)
+	authGroup.PUT("/:id/knowledge/:docID", limiter.Handler(knowledgeUploadRateLimit), module.handleUpdateKnowledgeDocument)
 	authGroup.DELETE("/:id/knowledge/:docID", module.handleDeleteKnowledgeDocument)
+	authGroup.GET("/:id/knowledge/:docID/ingest", module.handleGetKnowledgeIngest)
+	authGroup.POST("/:id/knowledge/:docID/ingest/retry", limiter.Handler(knowledgeUploadRateLimit), module.handleRetryKnowledgeIngest)
+	authGroup.GET("/:id/proactive", module.handleGetProactiveConfig)
+	authGroup.PUT("/:id/proactive", module.handleUpdateProactiveConfig)
+	authGroup.GET("/:id/locales", module.handleListAgentLocales)
+	authGroup.PUT("/:id/locales/:lang", module.handleUpsertAgentLocale)
+	authGroup.DELETE("/:id/locales/:lang", module.handleDeleteAgentLocale)
 	authGroup.PUT("/:id", module.handleUpdateAgent)
 
 	adminGroup := router.Group("/admin/agents")
@@ -178,49 +206,53 @@ func RegisterRoutes(router *gin.Engine, guard *authorization.Guard) (*Module, er
 }
 
 type createAgentRequest struct {
-	Name             string   `json:"name" binding:"required"`
-	Gender           string   `json:"gender"`
-	TitleAddress     *string  `json:"title_address"`
-	OneSentenceIntro *string  `json:"one_sentence_intro"`
-	PersonaDesc      *string  `json:"persona_desc"`
-	OpeningLine      *string  `json:"opening_line"`
-	FirstTurnHint    *string  `json:"first_turn_hint"`
-	Live2DModelID    *string  `json:"live2d_model_id"`
-	VoiceID          string   `json:"voice_id"`
-	VoiceProvider    string   `json:"voice_provider"`
-	LangDefault      string   `json:"lang_default"`
-	Tags             []string `json:"tags"`
-	Notes            *string  `json:"notes"`
-	ModelProvider    string   `json:"model_provider" binding:"required"`
-	ModelName        string   `json:"model_name" binding:"required"`
-	ResponseFormat   string   `json:"response_format"`
-	Temperature      *float64 `json:"temperature"`
-	MaxTokens        *int     `json:"max_tokens"`
-	SystemPrompt     *string  `json:"system_prompt"`
+	Name             string      `json:"name" binding:"required"`
+	Gender           string      `json:"gender"`
+	TitleAddress     *string     `json:"title_address"`
+	OneSentenceIntro *string     `json:"one_sentence_intro"`
+	PersonaDesc      *string     `json:"persona_desc"`
+	OpeningLine      *string     `json:"opening_line"`
+	FirstTurnHint    *string     `json:"first_turn_hint"`
+	Live2DModelID    *string     `json:"live2d_model_id"`
+	VoiceID          string      `json:"voice_id"`
+	VoiceProvider    string      `json:"voice_provider"`
+	LangDefault      string      `json:"lang_default"`
+	Tags             []string    `json:"tags"`
+	Notes            *string     `json:"notes"`
+	ModelProvider    string      `json:"model_provider" binding:"required"`
+	ModelName        string      `json:"model_name" binding:"required"`
+	ResponseFormat   string      `json:"response_format"`
+	Temperature      *float64    `json:"temperature"`
+	MaxTokens        *int        `json:"max_tokens"`
+	SystemPrompt     *string     `json:"system_prompt"`
+	StyleGuide       *StyleGuide `json:"style_guide"`
+	RagParams        *RagParams  `json:"rag_params"`
 }
 
 type updateAgentRequest struct {
-	Name             *string   `json:"name"`
-	Gender           *string   `json:"gender"`
-	TitleAddress     *string   `json:"title_address"`
-	OneSentenceIntro *string   `json:"one_sentence_intro"`
-	PersonaDesc      *string   `json:"persona_desc"`
-	OpeningLine      *string   `json:"opening_line"`
-	FirstTurnHint    *string   `json:"first_turn_hint"`
-	Live2DModelID    *string   `json:"live2d_model_id"`
-	VoiceID          *string   `json:"voice_id"`
-	VoiceProvider    *string   `json:"voice_provider"`
-	LangDefault      *string   `json:"lang_default"`
-	Tags             *[]string `json:"tags"`
-	Notes            *string   `json:"notes"`
-	ModelProvider    *string   `json:"model_provider"`
-	ModelName        *string   `json:"model_name"`
-	ResponseFormat   *string   `json:"response_format"`
-	Temperature      *float64  `json:"temperature"`
-	MaxTokens        *int      `json:"max_tokens"`
-	SystemPrompt     *string   `json:"system_prompt"`
-	Status           *string   `json:"status"`
-	RemoveAvatar     *bool     `json:"remove_avatar"`
+	Name             *string     `json:"name"`
+	Gender           *string     `json:"gender"`
+	TitleAddress     *string     `json:"title_address"`
+	OneSentenceIntro *string     `json:"one_sentence_intro"`
+	PersonaDesc      *string     `json:"persona_desc"`
+	OpeningLine      *string     `json:"opening_line"`
+	FirstTurnHint    *string     `json:"first_turn_hint"`
+	Live2DModelID    *string     `json:"live2d_model_id"`
+	VoiceID          *string     `json:"voice_id"`
+	VoiceProvider    *string     `json:"voice_provider"`
+	LangDefault      *string     `json:"lang_default"`
+	Tags             *[]string   `json:"tags"`
+	Notes            *string     `json:"notes"`
+	ModelProvider    *string     `json:"model_provider"`
+	ModelName        *string     `json:"model_name"`
+	ResponseFormat   *string     `json:"response_format"`
+	Temperature      *float64    `json:"temperature"`
+	MaxTokens        *int        `json:"max_tokens"`
+	SystemPrompt     *string     `json:"system_prompt"`
+	StyleGuide       *StyleGuide `json:"style_guide"`
+	RagParams        *RagParams  `json:"rag_params"`
+	Status           *string     `json:"status"`
+	RemoveAvatar     *bool       `json:"remove_avatar"`
 }
 
 type knowledgeDocumentRequest struct {
@@ -243,7 +275,7 @@ type knowledgeDocumentUpdateRequest struct {
 
 // handleCreateAgent godoc
 // @Summary 创建智能体
-// @Description 创建新的智能体配置并可选上传头像
+// @Description 创建新的智能体配置并可选上传头像；模板语法错误返回 400，未知变量以 warnings 返回
 // @Tags Agents
 // @Accept json
 // @Accept multipart/form-data
@@ -253,6 +285,7 @@ type knowledgeDocumentUpdateRequest struct {
 // @Success 201 {object} map[string]interface{} "创建成功的智能体"
 // @Failure 400 {object} map[string]string "请求参数错误"
 // @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "超出套餐智能体数量上限"
 // @Failure 500 {object} map[string]string "服务器错误"
 // @Author bizer
 // handleCreateAgent 处理创建智能体的请求并落库。
@@ -262,7 +295,7 @@ func (m *Module) handleCreateAgent(c *gin.Context) {
 		return
 	}
 
-	userID, _ := currentUserContext(c)
+	userID, roles := currentUserContext(c)
 	if userID == 0 {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
 		return
@@ -280,6 +313,26 @@ func (m *Module) handleCreateAgent(c *gin.Context) {
 		return
 	}
 
+	issues := validatePromptFields(map[string]*string{
+		"system_prompt":   req.SystemPrompt,
+		"persona_desc":    req.PersonaDesc,
+		"opening_line":    req.OpeningLine,
+		"first_turn_hint": req.FirstTurnHint,
+	})
+	promptIssues, promptWarnings := splitPromptIssues(issues)
+	if len(promptIssues) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid prompt template", "issues": promptIssues})
+		return
+	}
+	if err := req.StyleGuide.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.RagParams.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	gender := strings.ToLower(strings.TrimSpace(req.Gender))
 	if gender == "" {
 		gender = "neutral"
@@ -347,6 +400,12 @@ func (m *Module) handleCreateAgent(c *gin.Context) {
 	}
 
 	cfg.SystemPrompt = normalizeStringPointer(req.SystemPrompt)
+	if guide, err := encodeStyleGuide(req.StyleGuide); err == nil {
+		cfg.StyleGuide = guide
+	}
+	if rag, err := encodeRagParams(req.RagParams); err == nil {
+		cfg.RagParams = rag
+	}
 
 	params := map[string]any{}
 	if req.Temperature != nil {
@@ -361,6 +420,10 @@ func (m *Module) handleCreateAgent(c *gin.Context) {
 		}
 	}
 
+	if !m.ensureAgentQuota(c, userID, roles) {
+		return
+	}
+
 	ctx := c.Request.Context()
 
 	if err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
@@ -410,13 +473,16 @@ func (m *Module) handleCreateAgent(c *gin.Context) {
 	if cfg.AgentID != 0 {
 		response["chat_config"] = cfg
 	}
+	if len(promptWarnings) > 0 {
+		response["warnings"] = promptWarnings
+	}
 
 	c.JSON(http.StatusCreated, response)
 }
 
 // handleUpdateAgent godoc
 // @Summary 更新智能体
-// @Description 更新指定智能体的基础信息与模型配置
+// @Description 更新指定智能体的基础信息与模型配置；模板语法错误返回 400，未知变量以 warnings 返回
 // @Tags Agents
 // @Accept json
 // @Accept multipart/form-data
@@ -457,6 +523,26 @@ func (m *Module) handleUpdateAgent(c *gin.Context) {
 		return
 	}
 
+	issues := validatePromptFields(map[string]*string{
+		"system_prompt":   req.SystemPrompt,
+		"persona_desc":    req.PersonaDesc,
+		"opening_line":    req.OpeningLine,
+		"first_turn_hint": req.FirstTurnHint,
+	})
+	promptIssues, promptWarnings := splitPromptIssues(issues)
+	if len(promptIssues) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid prompt template", "issues": promptIssues})
+		return
+	}
+	if err := req.StyleGuide.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.RagParams.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx := c.Request.Context()
 
 	var agent Agent
@@ -661,6 +747,32 @@ func (m *Module) handleUpdateAgent(c *gin.Context) {
 		cfg.SystemPrompt = normalizeStringPointer(req.SystemPrompt)
 		cfgChanged = true
 	}
+	if req.StyleGuide != nil {
+		guide, encodeErr := encodeStyleGuide(req.StyleGuide)
+		if encodeErr != nil {
+			if newAvatarURL != "" {
+				_ = m.avatars.Remove(ctx, newAvatarURL)
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to encode style guide"})
+			return
+		}
+		cfg.StyleGuide = guide
+		cfgChanged = true
+	}
+	rechunk := false
+	if req.RagParams != nil {
+		rechunk = chunkOptionsChanged(cfg.RagParams, req.RagParams)
+		rag, encodeErr := encodeRagParams(req.RagParams)
+		if encodeErr != nil {
+			if newAvatarURL != "" {
+				_ = m.avatars.Remove(ctx, newAvatarURL)
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to encode rag params"})
+			return
+		}
+		cfg.RagParams = rag
+		cfgChanged = true
+	}
 
 	params := map[string]interface{}{}
 	if len(cfg.ModelParams) > 0 {
@@ -737,6 +849,12 @@ func (m *Module) handleUpdateAgent(c *gin.Context) {
 		_ = m.avatars.Remove(ctx, oldAvatar)
 	}
 
+	if rechunk && m.knowledge != nil {
+		if _, err := m.knowledge.RechunkDocuments(ctx, agentID, userID); err != nil {
+			log.Printf("agents: rechunk knowledge for agent %d failed: %v", agentID, err)
+		}
+	}
+
 	if err := m.db.WithContext(ctx).First(&agent, "id = ?", agentID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load agent", "details": err.Error()})
 		return
@@ -754,6 +872,9 @@ func (m *Module) handleUpdateAgent(c *gin.Context) {
 	if updatedCfg.AgentID != 0 {
 		response["chat_config"] = updatedCfg
 	}
+	if len(promptWarnings) > 0 {
+		response["warnings"] = promptWarnings
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -767,6 +888,7 @@ func (m *Module) handleUpdateAgent(c *gin.Context) {
 // @Param direction query string false "排序方向，默认 desc"
 // @Param limit query int false "返回数量上限"
 // @Param status query string false "状态筛选，默认 active"
+// @Param lang query string false "本地化语言，优先于 Accept-Language"
 // @Success 200 {object} map[string]interface{} "智能体列表"
 // @Failure 400 {object} map[string]string "请求参数错误"
 // @Failure 500 {object} map[string]string "服务器错误"
@@ -842,6 +964,10 @@ func (m *Module) handleListAgents(c *gin.Context) {
 		agents = agents[:limit]
 	}
 
+	if err := m.localizeAgents(ctx, agents, requestLanguages(c, "")); err != nil {
+		log.Printf("agents: failed to localize agent list: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"agents": agents})
 }
 
@@ -1114,6 +1240,10 @@ func (m *Module) handleListKnowledgeDocuments(c *gin.Context) {
 		return
 	}
 
+	for i := range documents {
+		m.signKnowledgeFile(ctx, &documents[i])
+	}
+
 	c.JSON(http.StatusOK, gin.H{"documents": documents})
 }
 
@@ -1177,18 +1307,29 @@ func (m *Module) handleGetKnowledgeDocument(c *gin.Context) {
 		return
 	}
 
+	m.signKnowledgeFile(ctx, document)
 	c.JSON(http.StatusOK, gin.H{"document": document})
 }
 
 // handleCreateKnowledgeDocument godoc
 // @Summary 创建知识库文档
+// @Description 支持 JSON 正文或 multipart 上传 PDF、DOCX、Markdown、HTML、TXT 文件，文件解析后按标题与页码切片，原文件存入对象存储
+// @Description 切片与向量化在后台任务中进行，返回的文档 ingest_status 为 processing，进度见 /knowledge/{docID}/ingest
 // @Tags Agents
 // @Accept json
+// @Accept multipart/form-data
 // @Produce json
 // @Param id path int true "智能体 ID"
-// @Param request body knowledgeDocumentRequest true "文档内容"
+// @Param request body knowledgeDocumentRequest false "文档内容（JSON）"
+// @Param file formData file false "文档文件（multipart）"
+// @Param title formData string false "标题，缺省时使用文件标题或文件名"
+// @Param summary formData string false "摘要"
+// @Param tags formData string false "标签，JSON 数组或逗号分隔"
+// @Param status formData string false "状态"
 // @Success 201 {object} map[string]any
 // @Failure 400 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -1211,9 +1352,13 @@ func (m *Module) handleCreateKnowledgeDocument(c *gin.Context) {
 		return
 	}
 
-	var req knowledgeDocumentRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+	req, upload, err := bindKnowledgeDocumentRequest(c)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errKnowledgeUploadTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": "invalid request payload", "details": err.Error()})
 		return
 	}
 
@@ -1240,9 +1385,37 @@ func (m *Module) handleCreateKnowledgeDocument(c *gin.Context) {
 		Tags:    req.Tags,
 		Status:  req.Status,
 	}
+	if upload != nil {
+		input, err = knowledge.FileDocumentInput(upload.filename, upload.contentType, upload.data, input)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, knowledge.ErrUnsupportedFormat) {
+				status = http.StatusUnsupportedMediaType
+			}
+			c.JSON(status, gin.H{"error": "failed to extract document file", "details": err.Error()})
+			return
+		}
+	}
+
+	if !m.ensureKnowledgeQuota(c, agentID, userID, roles, 0, len(input.Content)) {
+		return
+	}
+
+	if upload != nil && m.avatars != nil {
+		fileURL, uploadErr := m.avatars.UploadDocument(ctx, upload.data, upload.filename, upload.contentType, "agents", fmt.Sprintf("%d", agentID))
+		if uploadErr != nil {
+			log.Printf("agents: upload knowledge file failed: %v", uploadErr)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store document file"})
+			return
+		}
+		input.FileURL = &fileURL
+	}
 
 	record, err := m.knowledge.CreateDocument(ctx, agentID, userID, input)
 	if err != nil {
+		if input.FileURL != nil {
+			_ = m.avatars.Remove(ctx, *input.FileURL)
+		}
 		msg := strings.TrimSpace(err.Error())
 		if strings.HasPrefix(msg, "knowledge:") {
 			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
@@ -1252,11 +1425,13 @@ func (m *Module) handleCreateKnowledgeDocument(c *gin.Context) {
 		return
 	}
 
+	m.signKnowledgeFile(ctx, record)
 	c.JSON(http.StatusCreated, gin.H{"document": record})
 }
 
 // handleUpdateKnowledgeDocument godoc
 // @Summary 更新知识库文档
+// @Description 内容或元信息变化时在后台重新索引，完成前继续使用旧切片检索
 // @Tags Agents
 // @Accept json
 // @Produce json
@@ -1332,6 +1507,9 @@ func (m *Module) handleUpdateKnowledgeDocument(c *gin.Context) {
 		update.Source = &source
 	}
 	if req.Content != nil {
+		if !m.ensureKnowledgeQuota(c, agentID, userID, roles, docID, len(*req.Content)) {
+			return
+		}
 		content := *req.Content
 		update.Content = &content
 	}
@@ -1358,6 +1536,7 @@ func (m *Module) handleUpdateKnowledgeDocument(c *gin.Context) {
 		return
 	}
 
+	m.signKnowledgeFile(ctx, record)
 	c.JSON(http.StatusOK, gin.H{"document": record})
 }
 
@@ -1410,6 +1589,13 @@ func (m *Module) handleDeleteKnowledgeDocument(c *gin.Context) {
 		return
 	}
 
+	var fileURL *string
+	if m.avatars != nil {
+		if existing, getErr := m.knowledge.GetDocument(ctx, agentID, docID); getErr == nil {
+			fileURL = existing.FileURL
+		}
+	}
+
 	if err := m.knowledge.DeleteDocument(ctx, agentID, docID); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
@@ -1419,6 +1605,12 @@ func (m *Module) handleDeleteKnowledgeDocument(c *gin.Context) {
 		return
 	}
 
+	if fileURL != nil {
+		if err := m.avatars.Remove(ctx, *fileURL); err != nil {
+			log.Printf("agents: remove knowledge file failed: %v", err)
+		}
+	}
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -1520,10 +1712,11 @@ func (m *Module) handleAdminListAgents(c *gin.Context) {
 
 // handleGetAgent godoc
 // @Summary 获取智能体详情
-// @Description 获取单个智能体的完整信息和对话配置
+// @Description 获取单个智能体的完整信息和对话配置，按 lang 或 Accept-Language 返回本地化文案
 // @Tags Agents
 // @Produce json
 // @Param id path int true "智能体ID"
+// @Param lang query string false "本地化语言，优先于 Accept-Language"
 // @Success 200 {object} map[string]interface{} "智能体详情"
 // @Failure 400 {object} map[string]string "请求参数错误"
 // @Failure 404 {object} map[string]string "未找到"
@@ -1574,6 +1767,10 @@ func (m *Module) handleGetAgent(c *gin.Context) {
 
 	m.applyAvatarURL(ctx, &agent)
 
+	if _, err := LocalizeAgent(ctx, m.db, &agent, requestLanguages(c, "")); err != nil {
+		log.Printf("agents: failed to localize agent %d: %v", id, err)
+	}
+
 	var cfg AgentChatConfig
 	if err := m.db.WithContext(ctx).First(&cfg, "agent_id = ?", id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -1871,23 +2068,26 @@ func roundRating(value float64) float64 {
 }
 
 type conversationInitRequest struct {
-	UserID uint64 `json:"user_id" binding:"required"`
+	UserID uint64 `json:"user_id"`
+	Lang   string `json:"lang"`
 }
 
 type conversationClearRequest struct {
-	UserID uint64 `json:"user_id" binding:"required"`
+	UserID uint64 `json:"user_id"`
 }
 
 // handleClearConversation godoc
 // @Summary 清除会话记录
-// @Description 删除用户与智能体的历史会话及消息
+// @Description 删除当前登录用户与智能体的历史会话及消息，管理员可通过 user_id 指定其他用户
 // @Tags Agents
 // @Accept json
 // @Produce json
 // @Param id path int true "智能体ID"
-// @Param request body conversationClearRequest true "清理请求"
+// @Param request body conversationClearRequest false "清理请求"
 // @Success 200 {object} map[string]interface{} "是否清理成功"
 // @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "无权访问"
 // @Failure 500 {object} map[string]string "服务器错误"
 // @Author bizer
 // handleClearConversation 清空智能体会话的聊天记录。
@@ -1904,15 +2104,19 @@ func (m *Module) handleClearConversation(c *gin.Context) {
 	}
 
 	var req conversationClearRequest
-	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	userID, ok := resolveConversationUser(c, req.UserID)
+	if !ok {
 		return
 	}
 
 	ctx := c.Request.Context()
 
 	var conv conversation
-	if err := m.db.WithContext(ctx).Where("agent_id = ? AND user_id = ?", agentID, req.UserID).Take(&conv).Error; err != nil {
+	if err := m.db.WithContext(ctx).Where("agent_id = ? AND user_id = ?", agentID, userID).Take(&conv).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusOK, gin.H{"cleared": false})
 			return
@@ -1939,14 +2143,16 @@ func (m *Module) handleClearConversation(c *gin.Context) {
 
 // handleCreateConversation godoc
 // @Summary 初始化会话
-// @Description 为用户与智能体建立新的对话会话
+// @Description 为用户与智能体建立新的对话会话，lang 或 Accept-Language 决定会话语言与本地化开场白
 // @Tags Agents
 // @Accept json
 // @Produce json
 // @Param id path int true "智能体ID"
-// @Param request body conversationInitRequest true "会话初始化参数"
+// @Param request body conversationInitRequest false "会话初始化参数，user_id 仅管理员可指定"
 // @Success 200 {object} map[string]interface{} "会话信息"
 // @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "无权访问"
 // @Failure 404 {object} map[string]string "未找到"
 // @Failure 409 {object} map[string]string "状态冲突"
 // @Failure 500 {object} map[string]string "服务器错误"
@@ -1965,8 +2171,12 @@ func (m *Module) handleCreateConversation(c *gin.Context) {
 	}
 
 	var req conversationInitRequest
-	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	userID, ok := resolveConversationUser(c, req.UserID)
+	if !ok {
 		return
 	}
 
@@ -1987,11 +2197,32 @@ func (m *Module) handleCreateConversation(c *gin.Context) {
 		return
 	}
 
+	explicitLang := ""
+	if strings.TrimSpace(req.Lang) != "" {
+		code, ok := NormalizeLangCode(req.Lang)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid language code"})
+			return
+		}
+		explicitLang = code
+	}
+	locale, err := LocalizeAgent(ctx, m.db, &agent, requestLanguages(c, explicitLang))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load agent locale", "details": err.Error()})
+		return
+	}
+	var convLang *string
+	if explicitLang != "" {
+		convLang = &explicitLang
+	} else if locale != nil {
+		convLang = &locale.LangCode
+	}
+
 	var convID uint64
 
 	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var existing conversation
-		if err := tx.Where("agent_id = ? AND user_id = ?", agentID, req.UserID).Take(&existing).Error; err != nil {
+		if err := tx.Where("agent_id = ? AND user_id = ?", agentID, userID).Take(&existing).Error; err != nil {
 			if !errors.Is(err, gorm.ErrRecordNotFound) {
 				return err
 			}
@@ -1999,8 +2230,9 @@ func (m *Module) handleCreateConversation(c *gin.Context) {
 			now := time.Now().UTC()
 			conv := conversation{
 				AgentID:   agentID,
-				UserID:    req.UserID,
+				UserID:    userID,
 				Status:    "active",
+				Lang:      convLang,
 				StartedAt: now,
 				LastMsgAt: now,
 			}
@@ -2010,12 +2242,17 @@ func (m *Module) handleCreateConversation(c *gin.Context) {
 			convID = conv.ID
 
 			if opening := normalizeStringPointer(agent.OpeningLine); opening != nil {
+				content := *opening
+				if HasPromptTemplate(content) {
+					vars := BuildPromptVars(&agent, LoadPromptUser(ctx, tx, agentID, userID), time.Now())
+					content = strings.TrimSpace(RenderPromptTemplate(content, vars))
+				}
 				msg := message{
 					ConversationID: conv.ID,
 					Seq:            1,
 					Role:           "assistant",
 					Format:         "text",
-					Content:        *opening,
+					Content:        content,
 				}
 				if err := tx.Create(&msg).Error; err != nil {
 					return err
@@ -2026,6 +2263,11 @@ func (m *Module) handleCreateConversation(c *gin.Context) {
 			}
 		} else {
 			convID = existing.ID
+			if explicitLang != "" && (existing.Lang == nil || *existing.Lang != explicitLang) {
+				if err := tx.Model(&conversation{}).Where("id = ?", existing.ID).Update("lang", explicitLang).Error; err != nil {
+					return err
+				}
+			}
 		}
 		return nil
 	})
@@ -2060,6 +2302,7 @@ func (m *Module) handleCreateConversation(c *gin.Context) {
 			"agent_id":    conv.AgentID,
 			"user_id":     conv.UserID,
 			"status":      conv.Status,
+			"lang":        conv.Lang,
 			"started_at":  conv.StartedAt,
 			"last_msg_at": conv.LastMsgAt,
 			"created_at":  conv.CreatedAt,
@@ -2074,6 +2317,7 @@ type conversation struct {
 	AgentID   uint64    `gorm:"column:agent_id"`
 	UserID    uint64    `gorm:"column:user_id"`
 	Status    string    `gorm:"column:status"`
+	Lang      *string   `gorm:"column:lang"`
 	LastMsgAt time.Time `gorm:"column:last_msg_at"`
 	StartedAt time.Time `gorm:"column:started_at"`
 	CreatedAt time.Time `gorm:"column:created_at"`
@@ -2152,6 +2396,22 @@ func bindCreateAgentRequest(c *gin.Context) (createAgentRequest, *multipart.File
 		req.Notes = optionalStringPointer(form.Value["notes"])
 		req.SystemPrompt = optionalStringPointer(form.Value["system_prompt"])
 
+		if values, ok := form.Value["style_guide"]; ok {
+			guide, err := parseStyleGuideField(values)
+			if err != nil {
+				return req, nil, err
+			}
+			req.StyleGuide = guide
+		}
+
+		if values, ok := form.Value["rag_params"]; ok {
+			params, err := parseRagParamsField(values)
+			if err != nil {
+				return req, nil, err
+			}
+			req.RagParams = params
+		}
+
 		if values, ok := form.Value["tags"]; ok {
 			tags, err := parseTagsField(values)
 			if err != nil {
@@ -2222,6 +2482,22 @@ func bindUpdateAgentRequest(c *gin.Context) (updateAgentRequest, *multipart.File
 		req.SystemPrompt = formStringPointer(form.Value["system_prompt"])
 		req.Status = formStringPointer(form.Value["status"])
 
+		if values, ok := form.Value["style_guide"]; ok {
+			guide, err := parseStyleGuideField(values)
+			if err != nil {
+				return req, nil, err
+			}
+			req.StyleGuide = guide
+		}
+
+		if values, ok := form.Value["rag_params"]; ok {
+			params, err := parseRagParamsField(values)
+			if err != nil {
+				return req, nil, err
+			}
+			req.RagParams = params
+		}
+
 		if values, ok := form.Value["tags"]; ok {
 			tags, err := parseTagsField(values)
 			if err != nil {
@@ -2356,6 +2632,11 @@ func parseUintID(raw string) (uint64, error) {
 
 // ensureKnowledgeAccess 校验用户对智能体知识库的访问权限。
 func (m *Module) ensureKnowledgeAccess(ctx context.Context, agentID, userID uint64, roles []string) (*Agent, bool, error) {
+	return m.ensureAgentManageAccess(ctx, agentID, userID, roles)
+}
+
+// ensureAgentManageAccess 校验用户是否为智能体创建者或管理员。
+func (m *Module) ensureAgentManageAccess(ctx context.Context, agentID, userID uint64, roles []string) (*Agent, bool, error) {
 	if m == nil || m.db == nil {
 		return nil, false, errors.New("database not initialized")
 	}
@@ -2394,6 +2675,23 @@ func currentUserContext(c *gin.Context) (uint64, []string) {
 	return userID, roles
 }
 
+// resolveConversationUser 返回会话所属用户：默认取当前登录用户，指定其他用户时需要管理员角色。
+func resolveConversationUser(c *gin.Context, requested uint64) (uint64, bool) {
+	userID, roles := currentUserContext(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return 0, false
+	}
+	if requested == 0 || requested == userID {
+		return userID, true
+	}
+	if !hasRole(roles, "admin") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot access another user's conversation"})
+		return 0, false
+	}
+	return requested, true
+}
+
 // parseUserIDClaim 从 JWT 声明中解析用户 ID。
 func parseUserIDClaim(raw interface{}) uint64 {
 	switch v := raw.(type) {
@@ -2510,6 +2808,7 @@ func normalizeTags(tags []string) []string {
 	}
 	return result
 }
+
 // normalizeStringPointer 去除字符串指针中的多余空白。
 func normalizeStringPointer(value *string) *string {
 	if value == nil {
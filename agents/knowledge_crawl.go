@@ -0,0 +1,266 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"auralis_back/authorization"
+	knowledge "auralis_back/knowledge"
+	"auralis_back/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// knowledgeCrawlRateLimit 限制网页抓取任务的创建与手动运行频率。
+var knowledgeCrawlRateLimit = ratelimit.Policy{
+	Name:  "knowledge-crawl",
+	Key:   ratelimit.KeyUser,
+	Limit: ratelimit.PerWindow(10, time.Hour),
+	Roles: map[string]ratelimit.Limit{authorization.RoleAdmin: ratelimit.Unlimited},
+}
+
+// knowledgeCrawlRequest 描述创建抓取任务的请求体。
+type knowledgeCrawlRequest struct {
+	URL             string   `json:"url" binding:"required"`
+	Mode            string   `json:"mode"`
+	MaxDepth        *int     `json:"max_depth"`
+	MaxPages        int      `json:"max_pages"`
+	AllowedDomains  []string `json:"allowed_domains"`
+	IntervalMinutes int      `json:"interval_minutes"`
+	Run             *bool    `json:"run"`
+}
+
+// authorizeKnowledgeRequest 解析智能体 ID 并校验知识库管理权限，失败时写入响应。
+func (m *Module) authorizeKnowledgeRequest(c *gin.Context) (uint64, uint64, []string, bool) {
+	if m == nil || m.knowledge == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "knowledge service not available"})
+		return 0, 0, nil, false
+	}
+
+	agentID, err := parseUintID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid agent id"})
+		return 0, 0, nil, false
+	}
+
+	userID, roles := currentUserContext(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return 0, 0, nil, false
+	}
+
+	_, allowed, err := m.ensureKnowledgeAccess(c.Request.Context(), agentID, userID, roles)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify access"})
+		}
+		return 0, 0, nil, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return 0, 0, nil, false
+	}
+	return agentID, userID, roles, true
+}
+
+// knowledgeByteLimit 返回用户套餐允许的知识库正文上限，管理员不受限。
+func (m *Module) knowledgeByteLimit(ctx context.Context, userID uint64, roles []string) (int64, error) {
+	if hasRole(roles, authorization.RoleAdmin) {
+		return 0, nil
+	}
+	plan, err := m.userPlan(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return plan.KnowledgeMaxBytes, nil
+}
+
+// handleListKnowledgeCrawls godoc
+// @Summary 查询知识库抓取任务
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体 ID"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// handleListKnowledgeCrawls 列出智能体的网页抓取任务及最近运行结果。
+func (m *Module) handleListKnowledgeCrawls(c *gin.Context) {
+	agentID, _, _, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+
+	sources, err := m.knowledge.ListCrawlSources(c.Request.Context(), agentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load crawl sources", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"crawls": sources})
+}
+
+// handleCreateKnowledgeCrawl godoc
+// @Summary 创建知识库抓取任务
+// @Description 抓取指定网址或站点地图写入知识库，遵守 robots.txt 并限制深度、域名与页数；interval_minutes 大于 0 时定期重新抓取，仅内容变化的页面会重新向量化
+// @Tags Agents
+// @Accept json
+// @Produce json
+// @Param id path int true "智能体 ID"
+// @Param request body knowledgeCrawlRequest true "抓取配置"
+// @Success 202 {object} map[string]any
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// handleCreateKnowledgeCrawl 创建抓取任务并默认立即在后台运行。
+func (m *Module) handleCreateKnowledgeCrawl(c *gin.Context) {
+	agentID, userID, roles, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+
+	var req knowledgeCrawlRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	maxBytes, err := m.knowledgeByteLimit(ctx, userID, roles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load plan", "details": err.Error()})
+		return
+	}
+
+	source, err := m.knowledge.CreateCrawlSource(ctx, agentID, userID, knowledge.CrawlSourceInput{
+		URL:             req.URL,
+		Mode:            req.Mode,
+		MaxDepth:        req.MaxDepth,
+		MaxPages:        req.MaxPages,
+		AllowedDomains:  req.AllowedDomains,
+		IntervalMinutes: req.IntervalMinutes,
+		MaxBytes:        maxBytes,
+	})
+	if err != nil {
+		msg := strings.TrimSpace(err.Error())
+		if strings.HasPrefix(msg, "knowledge:") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create crawl source"})
+		}
+		return
+	}
+
+	if req.Run != nil && !*req.Run {
+		c.JSON(http.StatusCreated, gin.H{"crawl": source})
+		return
+	}
+
+	started, err := m.knowledge.StartCrawl(ctx, agentID, source.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start crawl", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"crawl": started})
+}
+
+// handleRunKnowledgeCrawl godoc
+// @Summary 手动运行知识库抓取任务
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体 ID"
+// @Param crawlID path int true "抓取任务 ID"
+// @Success 202 {object} map[string]any
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// handleRunKnowledgeCrawl 立即在后台重新抓取，仅重新向量化内容哈希变化的页面。
+func (m *Module) handleRunKnowledgeCrawl(c *gin.Context) {
+	agentID, userID, roles, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+	crawlID, err := parseUintID(c.Param("crawlID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid crawl id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := m.knowledge.GetCrawlSource(ctx, agentID, crawlID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "crawl source not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load crawl source"})
+		}
+		return
+	}
+
+	maxBytes, err := m.knowledgeByteLimit(ctx, userID, roles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load plan", "details": err.Error()})
+		return
+	}
+	if err := m.knowledge.SetCrawlByteLimit(ctx, crawlID, maxBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update crawl source", "details": err.Error()})
+		return
+	}
+
+	started, err := m.knowledge.StartCrawl(ctx, agentID, crawlID)
+	if err != nil {
+		if errors.Is(err, knowledge.ErrCrawlRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "crawl is already running"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start crawl", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"crawl": started})
+}
+
+// handleDeleteKnowledgeCrawl godoc
+// @Summary 删除知识库抓取任务
+// @Description 删除抓取任务并停止定时重抓，已抓取的文档保留
+// @Tags Agents
+// @Param id path int true "智能体 ID"
+// @Param crawlID path int true "抓取任务 ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// handleDeleteKnowledgeCrawl 删除抓取任务。
+func (m *Module) handleDeleteKnowledgeCrawl(c *gin.Context) {
+	agentID, _, _, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+	crawlID, err := parseUintID(c.Param("crawlID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid crawl id"})
+		return
+	}
+
+	if err := m.knowledge.DeleteCrawlSource(c.Request.Context(), agentID, crawlID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "crawl source not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete crawl source"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	knowledge "auralis_back/knowledge"
+	"github.com/gin-gonic/gin"
+)
+
+// errKnowledgeUploadTooLarge 表示上传的请求体或文件超出大小限制。
+var errKnowledgeUploadTooLarge = fmt.Errorf("file size exceeds %d bytes", knowledge.MaxUploadBytes)
+
+// knowledgeUpload 保存通过 multipart 上传的知识库原始文件。
+type knowledgeUpload struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// bindKnowledgeDocumentRequest 支持 JSON 或 multipart 创建知识文档，multipart 时可附带 file 字段。
+func bindKnowledgeDocumentRequest(c *gin.Context) (knowledgeDocumentRequest, *knowledgeUpload, error) {
+	var req knowledgeDocumentRequest
+	contentType := strings.ToLower(c.GetHeader("Content-Type"))
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return req, nil, fmt.Errorf("invalid request payload: %w", err)
+		}
+		return req, nil, nil
+	}
+
+	// 限制整个请求体的大小，避免超大 multipart 请求在解析时写满临时目录。
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, knowledge.MaxUploadBytes+(1<<20))
+	if err := c.Request.ParseMultipartForm(knowledge.MaxUploadBytes + (1 << 20)); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return req, nil, errKnowledgeUploadTooLarge
+		}
+		return req, nil, fmt.Errorf("invalid multipart payload: %w", err)
+	}
+	form := c.Request.MultipartForm
+	req.Title = firstFormValue(form.Value["title"])
+	req.Summary = optionalStringPointer(form.Value["summary"])
+	req.Source = optionalStringPointer(form.Value["source"])
+	req.Content = firstFormValue(form.Value["content"])
+	req.Status = firstFormValue(form.Value["status"])
+	if values, ok := form.Value["tags"]; ok {
+		tags, err := parseTagsField(values)
+		if err != nil {
+			return req, nil, err
+		}
+		req.Tags = tags
+	}
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		return req, nil, nil
+	}
+	header := files[0]
+	if header.Size > knowledge.MaxUploadBytes {
+		return req, nil, errKnowledgeUploadTooLarge
+	}
+	src, err := header.Open()
+	if err != nil {
+		return req, nil, fmt.Errorf("open file: %w", err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, knowledge.MaxUploadBytes+1))
+	if err != nil {
+		return req, nil, fmt.Errorf("read file: %w", err)
+	}
+	if len(data) > knowledge.MaxUploadBytes {
+		return req, nil, errKnowledgeUploadTooLarge
+	}
+
+	return req, &knowledgeUpload{
+		filename:    header.Filename,
+		contentType: header.Header.Get("Content-Type"),
+		data:        data,
+	}, nil
+}
+
+// signKnowledgeFile 为文档原始文件生成临时访问地址。
+func (m *Module) signKnowledgeFile(ctx context.Context, record *knowledge.DocumentRecord) {
+	if m == nil || m.avatars == nil || record == nil || record.FileURL == nil {
+		return
+	}
+	signed, err := m.avatars.PresignedURL(ctx, *record.FileURL, avatarURLExpiry)
+	if err != nil {
+		log.Printf("agents: presign knowledge file url failed: %v", err)
+		return
+	}
+	record.FileURL = &signed
+}
@@ -0,0 +1,49 @@
+package agents
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	knowledge "auralis_back/knowledge"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newMultipartContext 构造携带 title 与 file 字段的 multipart 请求上下文。
+func newMultipartContext(t *testing.T, fileSize int) *gin.Context {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("title", "Guide")
+	part, err := writer.CreateFormFile("file", "guide.md")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	part.Write(bytes.Repeat([]byte("a"), fileSize))
+	writer.Close()
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return c
+}
+
+func TestBindKnowledgeDocumentRequestLimitsBody(t *testing.T) {
+	req, upload, err := bindKnowledgeDocumentRequest(newMultipartContext(t, 16))
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if req.Title != "Guide" || upload == nil || upload.filename != "guide.md" || len(upload.data) != 16 {
+		t.Errorf("request = %+v, upload = %+v", req, upload)
+	}
+
+	_, _, err = bindKnowledgeDocumentRequest(newMultipartContext(t, knowledge.MaxUploadBytes+(2<<20)))
+	if !errors.Is(err, errKnowledgeUploadTooLarge) {
+		t.Errorf("oversized body err = %v, want errKnowledgeUploadTooLarge", err)
+	}
+}
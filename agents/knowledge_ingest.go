@@ -0,0 +1,157 @@
+package agents
+
+import (
+	"errors"
+	"net/http"
+
+	"auralis_back/authorization"
+	knowledge "auralis_back/knowledge"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// handleGetKnowledgeIngest godoc
+// @Summary 查询知识库文档的入库进度
+// @Description 返回文档最近一次切片与向量化任务的状态、已处理切片数、重试次数与错误信息
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体 ID"
+// @Param docID path int true "文档 ID"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// handleGetKnowledgeIngest 返回文档的入库任务。
+func (m *Module) handleGetKnowledgeIngest(c *gin.Context) {
+	agentID, _, _, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+	docID, err := parseUintID(c.Param("docID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
+		return
+	}
+
+	job, err := m.knowledge.GetIngestJob(c.Request.Context(), agentID, docID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ingest job not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load ingest job"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// handleRetryKnowledgeIngest godoc
+// @Summary 重试失败的知识库入库任务
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体 ID"
+// @Param docID path int true "文档 ID"
+// @Success 202 {object} map[string]any
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// handleRetryKnowledgeIngest 重置失败任务的重试次数并重新排队。
+func (m *Module) handleRetryKnowledgeIngest(c *gin.Context) {
+	agentID, _, _, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+	docID, err := parseUintID(c.Param("docID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid document id"})
+		return
+	}
+
+	job, err := m.knowledge.RetryIngest(c.Request.Context(), agentID, docID)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "ingest job not found"})
+		case errors.Is(err, knowledge.ErrIngestNotRetryable):
+			c.JSON(http.StatusConflict, gin.H{"error": "ingest job has not failed"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retry ingest job", "details": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
+
+// handleGetKnowledgeIndex godoc
+// @Summary 查询知识库向量索引状态
+// @Description 返回当前检索使用的集合与向量版本、配置的向量版本、待重建切片数及进行中的重建进度
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体 ID"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// handleGetKnowledgeIndex 返回智能体的向量索引状态。
+func (m *Module) handleGetKnowledgeIndex(c *gin.Context) {
+	agentID, _, _, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+
+	status, err := m.knowledge.GetIndexStatus(c.Request.Context(), agentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load index status", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"index": status})
+}
+
+// handleReindexKnowledge godoc
+// @Summary 重建知识库向量索引（管理员）
+// @Description 更换向量模型或维度后，在后台用当前模型为旧切片重新生成向量写入新集合，完成后切换检索并删除旧集合
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体 ID"
+// @Success 200 {object} map[string]any
+// @Success 202 {object} map[string]any
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// handleReindexKnowledge 启动向量索引重建，索引已是最新时返回 200。
+func (m *Module) handleReindexKnowledge(c *gin.Context) {
+	agentID, _, roles, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+	if !hasRole(roles, authorization.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+		return
+	}
+
+	status, started, err := m.knowledge.StartReindex(c.Request.Context(), agentID)
+	if err != nil {
+		if errors.Is(err, knowledge.ErrReindexRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "reindex is already running"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start reindex", "details": err.Error()})
+		}
+		return
+	}
+
+	if !started {
+		c.JSON(http.StatusOK, gin.H{"index": status, "started": false})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"index": status, "started": true})
+}
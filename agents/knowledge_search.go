@@ -0,0 +1,116 @@
+package agents
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"auralis_back/authorization"
+	knowledge "auralis_back/knowledge"
+	"auralis_back/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// knowledgeSearchRateLimit 限制检索调试接口的调用频率，每次检索都会请求向量模型与重排器。
+var knowledgeSearchRateLimit = ratelimit.Policy{
+	Name:  "knowledge-search",
+	Key:   ratelimit.KeyUser,
+	Limit: ratelimit.PerWindow(120, time.Hour),
+	Roles: map[string]ratelimit.Limit{authorization.RoleAdmin: ratelimit.Unlimited},
+}
+
+// knowledgeSearchRequest 描述检索调试请求，除 query 外的字段用于临时覆盖智能体保存的检索参数。
+type knowledgeSearchRequest struct {
+	Query          string   `json:"query" binding:"required"`
+	TopK           int      `json:"top_k"`
+	VectorWeight   *float64 `json:"vector_weight"`
+	KeywordWeight  *float64 `json:"keyword_weight"`
+	RRFK           int      `json:"rrf_k"`
+	Rerank         *bool    `json:"rerank"`
+	RerankMinScore *float64 `json:"rerank_min_score"`
+}
+
+// ragParams 将请求中的覆盖字段转换为检索参数。
+func (r knowledgeSearchRequest) ragParams() *RagParams {
+	return &RagParams{
+		TopK:           r.TopK,
+		VectorWeight:   r.VectorWeight,
+		KeywordWeight:  r.KeywordWeight,
+		RRFK:           r.RRFK,
+		Rerank:         r.Rerank,
+		RerankMinScore: r.RerankMinScore,
+	}
+}
+
+// handleSearchKnowledge godoc
+// @Summary 调试知识库检索
+// @Description 按对话注入知识时相同的检索流程执行查询，返回排序后的片段及各项分数、过滤条件与检索过程统计，以及最终注入模型的知识提示词；可临时覆盖 top_k、融合权重与重排阈值
+// @Tags Agents
+// @Accept json
+// @Produce json
+// @Param id path int true "智能体 ID"
+// @Param request body knowledgeSearchRequest true "检索请求"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// handleSearchKnowledge 在智能体知识库上执行一次检索并返回检索明细。
+func (m *Module) handleSearchKnowledge(c *gin.Context) {
+	agentID, _, _, ok := m.authorizeKnowledgeRequest(c)
+	if !ok {
+		return
+	}
+
+	var req knowledgeSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return
+	}
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+		return
+	}
+	overrides := req.ragParams()
+	if err := overrides.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var configs []AgentChatConfig
+	if err := m.db.WithContext(ctx).Where("agent_id = ?", agentID).Limit(1).Find(&configs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load agent config", "details": err.Error()})
+		return
+	}
+	var cfg *AgentChatConfig
+	if len(configs) > 0 {
+		cfg = &configs[0]
+	}
+
+	opts := KnowledgeSearchOptions(cfg, overrides)
+	snippets, trace, err := m.knowledge.SearchWithTrace(ctx, agentID, query, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "knowledge search failed", "details": err.Error()})
+		return
+	}
+	if snippets == nil {
+		snippets = []knowledge.ContextSnippet{}
+	}
+
+	prompt := ""
+	if len(snippets) > 0 {
+		prompt = knowledge.BuildContextPrompt(snippets)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"results": snippets,
+		"trace":   trace,
+		"prompt":  prompt,
+	})
+}
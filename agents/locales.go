@@ -0,0 +1,380 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxAcceptLanguages = 8
+
+var langCodePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+type agentLocaleRequest struct {
+	Name          *string         `json:"name"`
+	TitleAddress  *string         `json:"title_address"`
+	PersonaDesc   *string         `json:"persona_desc"`
+	OpeningLine   *string         `json:"opening_line"`
+	FirstTurnHint *string         `json:"first_turn_hint"`
+	Extras        json.RawMessage `json:"extras"`
+}
+
+// NormalizeLangCode 校验并规范化 IETF 语言代码，如 en-us 规范为 en-US。
+func NormalizeLangCode(raw string) (string, bool) {
+	value := strings.ReplaceAll(strings.TrimSpace(raw), "_", "-")
+	if value == "" || len(value) > 10 || !langCodePattern.MatchString(value) {
+		return "", false
+	}
+	parts := strings.Split(value, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-"), true
+}
+
+// ParseAcceptLanguage 解析 Accept-Language 头，按权重从高到低返回语言代码。
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		code string
+		q    float64
+	}
+	items := make([]weighted, 0, 4)
+	seen := make(map[string]struct{})
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		code, ok := NormalizeLangCode(fields[0])
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if _, ok := seen[code]; ok {
+			continue
+		}
+		seen[code] = struct{}{}
+		items = append(items, weighted{code: code, q: q})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].q > items[j].q })
+	if len(items) > maxAcceptLanguages {
+		items = items[:maxAcceptLanguages]
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.code)
+	}
+	return result
+}
+
+// requestLanguages 返回请求偏好的语言列表，lang 参数优先于 Accept-Language。
+func requestLanguages(c *gin.Context, explicit string) []string {
+	prefs := make([]string, 0, 4)
+	for _, raw := range []string{explicit, c.Query("lang")} {
+		if code, ok := NormalizeLangCode(raw); ok {
+			prefs = append(prefs, code)
+			break
+		}
+	}
+	return append(prefs, ParseAcceptLanguage(c.GetHeader("Accept-Language"))...)
+}
+
+// MatchLocale 按偏好顺序挑选最合适的本地化记录，先精确匹配再按主语言匹配。
+func MatchLocale(locales []AgentLocale, prefs []string) *AgentLocale {
+	if len(locales) == 0 {
+		return nil
+	}
+	for _, pref := range prefs {
+		for i := range locales {
+			if strings.EqualFold(locales[i].LangCode, pref) {
+				return &locales[i]
+			}
+		}
+		primary := primaryLanguage(pref)
+		for i := range locales {
+			if primaryLanguage(locales[i].LangCode) == primary {
+				return &locales[i]
+			}
+		}
+	}
+	return nil
+}
+
+// matchAgentLocale 将智能体默认语言视为候选项参与匹配，命中默认语言时返回 nil。
+func matchAgentLocale(agent *Agent, locales []AgentLocale, prefs []string) *AgentLocale {
+	if len(locales) == 0 {
+		return nil
+	}
+	candidates := locales
+	if code, ok := NormalizeLangCode(agent.LangDefault); ok {
+		candidates = append(append(make([]AgentLocale, 0, len(locales)+1), locales...), AgentLocale{LangCode: code})
+	}
+	matched := MatchLocale(candidates, prefs)
+	if matched == nil || matched.AgentID == 0 {
+		return nil
+	}
+	for i := range locales {
+		if locales[i].LangCode == matched.LangCode {
+			return &locales[i]
+		}
+	}
+	return nil
+}
+
+// primaryLanguage 提取语言代码的主语言部分。
+func primaryLanguage(code string) string {
+	if idx := strings.Index(code, "-"); idx >= 0 {
+		code = code[:idx]
+	}
+	return strings.ToLower(code)
+}
+
+// ApplyLocale 用本地化文案覆盖智能体的对应字段。
+func ApplyLocale(agent *Agent, locale *AgentLocale) {
+	if agent == nil || locale == nil {
+		return
+	}
+	if locale.Name != nil {
+		agent.Name = *locale.Name
+	}
+	if locale.TitleAddress != nil {
+		agent.TitleAddress = locale.TitleAddress
+	}
+	if locale.PersonaDesc != nil {
+		agent.PersonaDesc = locale.PersonaDesc
+	}
+	if locale.OpeningLine != nil {
+		agent.OpeningLine = locale.OpeningLine
+	}
+	if locale.FirstTurnHint != nil {
+		agent.FirstTurnHint = locale.FirstTurnHint
+	}
+	agent.Locale = locale.LangCode
+}
+
+// LocalizeAgent 按语言偏好加载并应用智能体的本地化文案，返回命中的记录。
+func LocalizeAgent(ctx context.Context, db *gorm.DB, agent *Agent, prefs []string) (*AgentLocale, error) {
+	if db == nil || agent == nil || len(prefs) == 0 {
+		return nil, nil
+	}
+	var locales []AgentLocale
+	if err := db.WithContext(ctx).Where("agent_id = ?", agent.ID).Find(&locales).Error; err != nil {
+		return nil, err
+	}
+	locale := matchAgentLocale(agent, locales, prefs)
+	ApplyLocale(agent, locale)
+	return locale, nil
+}
+
+// localizeAgents 批量为智能体列表应用本地化文案。
+func (m *Module) localizeAgents(ctx context.Context, list []Agent, prefs []string) error {
+	if len(list) == 0 || len(prefs) == 0 {
+		return nil
+	}
+	ids := make([]uint64, 0, len(list))
+	for _, agent := range list {
+		ids = append(ids, agent.ID)
+	}
+	var locales []AgentLocale
+	if err := m.db.WithContext(ctx).Where("agent_id IN ?", ids).Find(&locales).Error; err != nil {
+		return err
+	}
+	grouped := make(map[uint64][]AgentLocale, len(ids))
+	for _, locale := range locales {
+		grouped[locale.AgentID] = append(grouped[locale.AgentID], locale)
+	}
+	for i := range list {
+		ApplyLocale(&list[i], matchAgentLocale(&list[i], grouped[list[i].ID], prefs))
+	}
+	return nil
+}
+
+// handleListAgentLocales godoc
+// @Summary 列出智能体本地化文案
+// @Description 返回智能体在各语言下的文案覆盖，仅创建者或管理员可见
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体ID"
+// @Success 200 {object} map[string]interface{} "本地化列表"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleListAgentLocales 返回智能体的全部本地化文案。
+func (m *Module) handleListAgentLocales(c *gin.Context) {
+	agentID, ok := m.authorizeAgentManagement(c)
+	if !ok {
+		return
+	}
+
+	var locales []AgentLocale
+	if err := m.db.WithContext(c.Request.Context()).
+		Where("agent_id = ?", agentID).
+		Order("lang_code ASC").
+		Find(&locales).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list locales", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"locales": locales})
+}
+
+// handleUpsertAgentLocale godoc
+// @Summary 保存智能体本地化文案
+// @Description 创建或整体替换指定语言下的名称、称谓、人设、开场白与首轮提示
+// @Tags Agents
+// @Accept json
+// @Produce json
+// @Param id path int true "智能体ID"
+// @Param lang path string true "IETF 语言代码"
+// @Param request body agentLocaleRequest true "本地化文案"
+// @Success 200 {object} map[string]interface{} "保存后的本地化文案"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleUpsertAgentLocale 创建或替换智能体的单语言文案覆盖。
+func (m *Module) handleUpsertAgentLocale(c *gin.Context) {
+	agentID, ok := m.authorizeAgentManagement(c)
+	if !ok {
+		return
+	}
+
+	langCode, valid := NormalizeLangCode(c.Param("lang"))
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid language code"})
+		return
+	}
+
+	var req agentLocaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	locale := AgentLocale{
+		AgentID:       agentID,
+		LangCode:      langCode,
+		Name:          normalizeStringPointer(req.Name),
+		TitleAddress:  normalizeStringPointer(req.TitleAddress),
+		PersonaDesc:   normalizeStringPointer(req.PersonaDesc),
+		OpeningLine:   normalizeStringPointer(req.OpeningLine),
+		FirstTurnHint: normalizeStringPointer(req.FirstTurnHint),
+	}
+	if locale.Name != nil && utf8.RuneCountInString(*locale.Name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is too long"})
+		return
+	}
+	if locale.TitleAddress != nil && utf8.RuneCountInString(*locale.TitleAddress) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title_address is too long"})
+		return
+	}
+	promptIssues, promptWarnings := splitPromptIssues(validatePromptFields(map[string]*string{
+		"persona_desc":    locale.PersonaDesc,
+		"opening_line":    locale.OpeningLine,
+		"first_turn_hint": locale.FirstTurnHint,
+	}))
+	if len(promptIssues) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid prompt template", "issues": promptIssues})
+		return
+	}
+	if extras := strings.TrimSpace(string(req.Extras)); extras != "" && extras != "null" {
+		var probe map[string]any
+		if err := json.Unmarshal(req.Extras, &probe); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "extras must be a JSON object"})
+			return
+		}
+		locale.Extras = datatypes.JSON(req.Extras)
+	}
+	if locale.Name == nil && locale.TitleAddress == nil && locale.PersonaDesc == nil &&
+		locale.OpeningLine == nil && locale.FirstTurnHint == nil && len(locale.Extras) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one localized field is required"})
+		return
+	}
+
+	if err := m.db.WithContext(c.Request.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "agent_id"}, {Name: "lang_code"}},
+		UpdateAll: true,
+	}).Create(&locale).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save locale", "details": err.Error()})
+		return
+	}
+
+	response := gin.H{"locale": locale}
+	if len(promptWarnings) > 0 {
+		response["warnings"] = promptWarnings
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleDeleteAgentLocale godoc
+// @Summary 删除智能体本地化文案
+// @Description 删除指定语言下的文案覆盖，删除后回退到默认文案
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体ID"
+// @Param lang path string true "IETF 语言代码"
+// @Success 200 {object} map[string]interface{} "删除结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleDeleteAgentLocale 删除智能体的单语言文案覆盖。
+func (m *Module) handleDeleteAgentLocale(c *gin.Context) {
+	agentID, ok := m.authorizeAgentManagement(c)
+	if !ok {
+		return
+	}
+
+	langCode, valid := NormalizeLangCode(c.Param("lang"))
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid language code"})
+		return
+	}
+
+	result := m.db.WithContext(c.Request.Context()).
+		Where("agent_id = ? AND lang_code = ?", agentID, langCode).
+		Delete(&AgentLocale{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete locale", "details": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "locale not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": true, "lang_code": langCode})
+}
@@ -29,6 +29,7 @@ type Agent struct {
 	RatingCount      int64          `gorm:"-" json:"rating_count"`
 	ViewCount        uint64         `gorm:"not null;default:0" json:"view_count"`
 	HotScore         float64        `gorm:"-" json:"-"`
+	Locale           string         `gorm:"-" json:"locale,omitempty"`
 	CreatedBy        uint64         `gorm:"not null;index" json:"created_by"`
 	CreatedAt        time.Time      `json:"created_at"`
 	UpdatedAt        time.Time      `json:"updated_at"`
@@ -39,6 +40,24 @@ func (Agent) TableName() string {
 	return "agents"
 }
 
+// AgentLocale 保存智能体文案在指定语言下的本地化覆盖。
+type AgentLocale struct {
+	AgentID       uint64         `gorm:"primaryKey;autoIncrement:false" json:"agent_id"`
+	LangCode      string         `gorm:"primaryKey;size:10" json:"lang_code"`
+	Name          *string        `gorm:"size:100" json:"name,omitempty"`
+	TitleAddress  *string        `gorm:"size:50" json:"title_address,omitempty"`
+	PersonaDesc   *string        `gorm:"type:text" json:"persona_desc,omitempty"`
+	OpeningLine   *string        `gorm:"type:text" json:"opening_line,omitempty"`
+	FirstTurnHint *string        `gorm:"type:text" json:"first_turn_hint,omitempty"`
+	Extras        datatypes.JSON `gorm:"type:json" json:"extras,omitempty"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+// TableName 指定 AgentLocale 模型对应的数据库表名。
+func (AgentLocale) TableName() string {
+	return "agent_locales"
+}
+
 // AgentRating 记录用户针对智能体的评分与可选评价内容。
 type AgentRating struct {
 	ID        uint64    `gorm:"primaryKey" json:"id"`
@@ -75,3 +94,22 @@ type AgentChatConfig struct {
 func (AgentChatConfig) TableName() string {
 	return "agent_chat_config"
 }
+
+// AgentProactiveConfig 保存创作者配置的主动消息策略（每日问候与召回）。
+type AgentProactiveConfig struct {
+	AgentID            uint64    `gorm:"primaryKey" json:"agent_id"`
+	CheckinEnabled     bool      `gorm:"not null;default:false" json:"checkin_enabled"`
+	CheckinTime        string    `gorm:"size:5;not null;default:'09:00'" json:"checkin_time"`
+	CheckinPrompt      *string   `gorm:"type:text" json:"checkin_prompt,omitempty"`
+	ReengageEnabled    bool      `gorm:"not null;default:false" json:"reengage_enabled"`
+	ReengageAfterHours int       `gorm:"not null;default:48" json:"reengage_after_hours"`
+	ReengagePrompt     *string   `gorm:"type:text" json:"reengage_prompt,omitempty"`
+	Timezone           string    `gorm:"size:64;not null;default:'Asia/Shanghai'" json:"timezone"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// TableName 指定 AgentProactiveConfig 的数据库表名。
+func (AgentProactiveConfig) TableName() string {
+	return "agent_proactive_config"
+}
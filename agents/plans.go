@@ -0,0 +1,86 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"auralis_back/authorization"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// userPlan 查询用户所属套餐，用户记录不存在时按免费套餐处理。
+func (m *Module) userPlan(ctx context.Context, userID uint64) (authorization.Plan, error) {
+	plan, err := authorization.UserPlan(ctx, m.db, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return authorization.LookupPlan(authorization.PlanFree), nil
+	}
+	return plan, err
+}
+
+// ensureAgentQuota 校验用户创建的智能体数量未超出套餐上限，超限时写入响应并返回 false。
+func (m *Module) ensureAgentQuota(c *gin.Context, userID uint64, roles []string) bool {
+	if hasRole(roles, authorization.RoleAdmin) {
+		return true
+	}
+	ctx := c.Request.Context()
+	plan, err := m.userPlan(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load plan", "details": err.Error()})
+		return false
+	}
+	if plan.MaxAgents <= 0 {
+		return true
+	}
+
+	var count int64
+	if err := m.db.WithContext(ctx).Model(&Agent{}).
+		Where("created_by = ? AND status <> ?", userID, statusArchived).
+		Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count agents", "details": err.Error()})
+		return false
+	}
+	if count >= int64(plan.MaxAgents) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "agent limit reached for current plan",
+			"plan":  plan.Code,
+			"limit": plan.MaxAgents,
+		})
+		return false
+	}
+	return true
+}
+
+// ensureKnowledgeQuota 校验写入后的知识库正文大小未超出套餐上限，超限时写入响应并返回 false。
+func (m *Module) ensureKnowledgeQuota(c *gin.Context, agentID, userID uint64, roles []string, excludeDocID uint64, contentBytes int) bool {
+	if hasRole(roles, authorization.RoleAdmin) {
+		return true
+	}
+	ctx := c.Request.Context()
+	plan, err := m.userPlan(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load plan", "details": err.Error()})
+		return false
+	}
+	if plan.KnowledgeMaxBytes <= 0 {
+		return true
+	}
+
+	used, err := m.knowledge.ContentBytes(ctx, agentID, excludeDocID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to measure knowledge base", "details": err.Error()})
+		return false
+	}
+	if used+int64(contentBytes) > plan.KnowledgeMaxBytes {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "knowledge base size limit reached for current plan",
+			"plan":  plan.Code,
+			"limit": plan.KnowledgeMaxBytes,
+			"used":  used,
+		})
+		return false
+	}
+	return true
+}
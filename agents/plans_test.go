@@ -0,0 +1,148 @@
+package agents
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auralis_back/authorization"
+	"auralis_back/knowledge"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newPlanTestModule 创建使用内存 SQLite 的模块，用户 1 为免费套餐、用户 2 为团队套餐。
+func newPlanTestModule(t *testing.T) *Module {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&Agent{}, &knowledge.Document{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, plan TEXT NOT NULL)").Error; err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+	if err := db.Exec("INSERT INTO users (id, plan) VALUES (1, ?), (2, ?)", authorization.PlanFree, authorization.PlanTeam).Error; err != nil {
+		t.Fatalf("seed users: %v", err)
+	}
+
+	t.Setenv("EMBEDDING_API_KEY", "test")
+	t.Setenv("EMBEDDING_BASE_URL", "http://127.0.0.1:1")
+	t.Setenv("KNOWLEDGE_VECTOR_STORE", "local")
+	t.Setenv("KNOWLEDGE_VECTOR_DIR", t.TempDir())
+	t.Setenv("KNOWLEDGE_RERANKER", "off")
+	service, err := knowledge.NewServiceFromEnv(db)
+	if err != nil {
+		t.Fatalf("knowledge service: %v", err)
+	}
+	return &Module{db: db, knowledge: service}
+}
+
+func newPlanTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	return c, rec
+}
+
+func TestEnsureAgentQuota(t *testing.T) {
+	m := newPlanTestModule(t)
+	limit := authorization.LookupPlan(authorization.PlanFree).MaxAgents
+	for i := 0; i < limit; i++ {
+		status := statusActive
+		if i == 0 {
+			status = statusArchived
+		}
+		if err := m.db.Create(&Agent{Name: "a", Status: status, CreatedBy: 1}).Error; err != nil {
+			t.Fatalf("create agent: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		userID  uint64
+		roles   []string
+		prepare func()
+		want    bool
+	}{
+		// 已归档的智能体不计入数量。
+		{"below limit", 1, nil, nil, true},
+		{"at limit", 1, nil, func() { m.db.Create(&Agent{Name: "b", Status: statusPending, CreatedBy: 1}) }, false},
+		{"admin bypass", 1, []string{"Admin"}, nil, true},
+		{"unlimited plan", 2, nil, func() {
+			for i := 0; i < limit+1; i++ {
+				m.db.Create(&Agent{Name: "c", Status: statusActive, CreatedBy: 2})
+			}
+		}, true},
+		{"missing user uses free plan", 3, nil, func() {
+			for i := 0; i < limit; i++ {
+				m.db.Create(&Agent{Name: "d", Status: statusActive, CreatedBy: 3})
+			}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			c, rec := newPlanTestContext()
+			if got := m.ensureAgentQuota(c, tt.userID, tt.roles); got != tt.want {
+				t.Fatalf("ensureAgentQuota = %v, want %v (%s)", got, tt.want, rec.Body.String())
+			}
+			if !tt.want && (rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"limit":3`)) {
+				t.Errorf("response = %d %s, want 403 with the plan limit", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestEnsureKnowledgeQuota(t *testing.T) {
+	m := newPlanTestModule(t)
+	limit := authorization.LookupPlan(authorization.PlanFree).KnowledgeMaxBytes
+	existing := knowledge.Document{AgentID: 7, Title: "a", Content: strings.Repeat("x", int(limit-100)), Status: "active", CreatedBy: 1, UpdatedBy: 1}
+	if err := m.db.Create(&existing).Error; err != nil {
+		t.Fatalf("create document: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		agentID      uint64
+		userID       uint64
+		roles        []string
+		excludeDocID uint64
+		contentBytes int
+		want         bool
+	}{
+		{"fits", 7, 1, nil, 0, 100, true},
+		{"exceeds", 7, 1, nil, 0, 101, false},
+		// 更新文档时不计入该文档的旧正文。
+		{"replacing document", 7, 1, nil, existing.ID, int(limit), true},
+		{"other agent", 8, 1, nil, 0, int(limit), true},
+		{"admin bypass", 7, 1, []string{authorization.RoleAdmin}, 0, int(limit), true},
+		{"larger plan", 7, 2, nil, 0, int(limit), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newPlanTestContext()
+			if got := m.ensureKnowledgeQuota(c, tt.agentID, tt.userID, tt.roles, tt.excludeDocID, tt.contentBytes); got != tt.want {
+				t.Fatalf("ensureKnowledgeQuota = %v, want %v (%s)", got, tt.want, rec.Body.String())
+			}
+			if !tt.want && (rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"used":`)) {
+				t.Errorf("response = %d %s, want 403 with usage", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package agents
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultProactiveTimezone     = "Asia/Shanghai"
+	defaultCheckinTime           = "09:00"
+	defaultReengageAfterHours    = 48
+	minReengageAfterHours        = 6
+	maxProactivePromptCharacters = 2000
+)
+
+type proactiveConfigRequest struct {
+	CheckinEnabled     *bool   `json:"checkin_enabled"`
+	CheckinTime        *string `json:"checkin_time"`
+	CheckinPrompt      *string `json:"checkin_prompt"`
+	ReengageEnabled    *bool   `json:"reengage_enabled"`
+	ReengageAfterHours *int    `json:"reengage_after_hours"`
+	ReengagePrompt     *string `json:"reengage_prompt"`
+	Timezone           *string `json:"timezone"`
+}
+
+// defaultProactiveConfig 返回未配置时的默认主动消息策略。
+func defaultProactiveConfig(agentID uint64) AgentProactiveConfig {
+	return AgentProactiveConfig{
+		AgentID:            agentID,
+		CheckinTime:        defaultCheckinTime,
+		ReengageAfterHours: defaultReengageAfterHours,
+		Timezone:           defaultProactiveTimezone,
+	}
+}
+
+// handleGetProactiveConfig godoc
+// @Summary 获取主动消息配置
+// @Description 返回智能体的每日问候与召回消息配置，仅创建者或管理员可见
+// @Tags Agents
+// @Produce json
+// @Param id path int true "智能体ID"
+// @Success 200 {object} map[string]interface{} "主动消息配置"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 404 {object} map[string]string "未找到"
+// @Author bizer
+// handleGetProactiveConfig 返回智能体的主动消息配置。
+func (m *Module) handleGetProactiveConfig(c *gin.Context) {
+	agentID, ok := m.authorizeAgentManagement(c)
+	if !ok {
+		return
+	}
+
+	var cfg AgentProactiveConfig
+	err := m.db.WithContext(c.Request.Context()).Where("agent_id = ?", agentID).Take(&cfg).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load proactive config", "details": err.Error()})
+			return
+		}
+		cfg = defaultProactiveConfig(agentID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"proactive": cfg})
+}
+
+// handleUpdateProactiveConfig godoc
+// @Summary 更新主动消息配置
+// @Description 配置智能体的每日问候时间、召回阈值与提示语，仅创建者或管理员可操作
+// @Tags Agents
+// @Accept json
+// @Produce json
+// @Param id path int true "智能体ID"
+// @Param request body proactiveConfigRequest true "主动消息配置"
+// @Success 200 {object} map[string]interface{} "更新后的配置"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleUpdateProactiveConfig 更新智能体的主动消息配置。
+func (m *Module) handleUpdateProactiveConfig(c *gin.Context) {
+	agentID, ok := m.authorizeAgentManagement(c)
+	if !ok {
+		return
+	}
+
+	var req proactiveConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cfg := defaultProactiveConfig(agentID)
+	if err := m.db.WithContext(ctx).Where("agent_id = ?", agentID).Take(&cfg).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load proactive config", "details": err.Error()})
+		return
+	}
+
+	if req.CheckinEnabled != nil {
+		cfg.CheckinEnabled = *req.CheckinEnabled
+	}
+	if req.CheckinTime != nil {
+		value := strings.TrimSpace(*req.CheckinTime)
+		if _, err := time.Parse("15:04", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "checkin_time must be in HH:MM format"})
+			return
+		}
+		cfg.CheckinTime = value
+	}
+	if req.CheckinPrompt != nil {
+		cfg.CheckinPrompt = normalizeStringPointer(req.CheckinPrompt)
+	}
+	if req.ReengageEnabled != nil {
+		cfg.ReengageEnabled = *req.ReengageEnabled
+	}
+	if req.ReengageAfterHours != nil {
+		if *req.ReengageAfterHours < minReengageAfterHours {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reengage_after_hours must be at least 6"})
+			return
+		}
+		cfg.ReengageAfterHours = *req.ReengageAfterHours
+	}
+	if req.ReengagePrompt != nil {
+		cfg.ReengagePrompt = normalizeStringPointer(req.ReengagePrompt)
+	}
+	if req.Timezone != nil {
+		value := strings.TrimSpace(*req.Timezone)
+		if _, err := time.LoadLocation(value); err != nil || value == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timezone"})
+			return
+		}
+		cfg.Timezone = value
+	}
+	for _, prompt := range []*string{cfg.CheckinPrompt, cfg.ReengagePrompt} {
+		if prompt != nil && len([]rune(*prompt)) > maxProactivePromptCharacters {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "prompt is too long"})
+			return
+		}
+	}
+
+	if err := m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "agent_id"}},
+		UpdateAll: true,
+	}).Create(&cfg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save proactive config", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"proactive": cfg})
+}
+
+// authorizeAgentManagement 解析路径中的智能体并校验管理权限。
+func (m *Module) authorizeAgentManagement(c *gin.Context) (uint64, bool) {
+	agentID, err := parseUintID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid agent id"})
+		return 0, false
+	}
+
+	userID, roles := currentUserContext(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return 0, false
+	}
+
+	_, allowed, err := m.ensureAgentManageAccess(c.Request.Context(), agentID, userID, roles)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify access"})
+		}
+		return 0, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return 0, false
+	}
+
+	return agentID, true
+}
@@ -0,0 +1,458 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const maxPromptVariableRunes = 64
+
+// PromptVariables 列出提示词模板中可用的变量及其说明。
+var PromptVariables = map[string]string{
+	"user.nickname":       "用户昵称",
+	"user.display_name":   "用户显示名称",
+	"user.title_address":  "智能体对用户的称呼，未设置时回退为昵称",
+	"user.timezone":       "用户时区",
+	"user.language":       "用户偏好语言",
+	"agent.name":          "智能体名称",
+	"agent.title_address": "智能体的称号",
+	"agent.intro":         "智能体一句话简介",
+	"now":                 "当前时间（用户时区，YYYY-MM-DD HH:MM）",
+	"now.date":            "当前日期",
+	"now.time":            "当前时刻",
+	"now.weekday":         "星期",
+	"now.hour":            "当前小时（0-23）",
+	"now.part_of_day":     "时段：morning/afternoon/evening/night",
+}
+
+// PromptVars 保存渲染模板时的变量取值。
+type PromptVars map[string]string
+
+// PromptUser 描述渲染提示词所需的用户信息。
+type PromptUser struct {
+	Nickname     string
+	DisplayName  string
+	TitleAddress string
+	Timezone     string
+	Language     string
+}
+
+// PromptTemplateIssue 描述模板校验发现的问题。
+type PromptTemplateIssue struct {
+	Field    string `json:"field,omitempty"`
+	Variable string `json:"variable,omitempty"`
+	Offset   int    `json:"offset"`
+	Message  string `json:"message"`
+}
+
+// promptIssueUnknownVariable 标记未登记变量，渲染时按空串处理，仅作为警告返回。
+const promptIssueUnknownVariable = "unknown variable"
+
+// HasPromptTemplate 判断文本是否包含模板标记。
+func HasPromptTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// BuildPromptVars 根据智能体、用户与当前时间构建模板变量。
+func BuildPromptVars(agent *Agent, user PromptUser, now time.Time) PromptVars {
+	vars := PromptVars{}
+
+	if tz := strings.TrimSpace(user.Timezone); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			now = now.In(loc)
+			vars["user.timezone"] = tz
+		}
+	}
+
+	nickname := sanitizePromptValue(user.Nickname)
+	display := sanitizePromptValue(user.DisplayName)
+	if display == "" {
+		display = nickname
+	}
+	title := sanitizePromptValue(user.TitleAddress)
+	if title == "" {
+		title = display
+	}
+	vars["user.nickname"] = nickname
+	vars["user.display_name"] = display
+	vars["user.title_address"] = title
+	vars["user.language"] = sanitizePromptValue(user.Language)
+
+	if agent != nil {
+		vars["agent.name"] = sanitizePromptValue(agent.Name)
+		if agent.TitleAddress != nil {
+			vars["agent.title_address"] = sanitizePromptValue(*agent.TitleAddress)
+		}
+		if agent.OneSentenceIntro != nil {
+			vars["agent.intro"] = sanitizePromptValue(*agent.OneSentenceIntro)
+		}
+	}
+
+	vars["now"] = now.Format("2006-01-02 15:04")
+	vars["now.date"] = now.Format("2006-01-02")
+	vars["now.time"] = now.Format("15:04")
+	vars["now.weekday"] = now.Weekday().String()
+	vars["now.hour"] = strconv.Itoa(now.Hour())
+	switch hour := now.Hour(); {
+	case hour >= 5 && hour < 12:
+		vars["now.part_of_day"] = "morning"
+	case hour >= 12 && hour < 18:
+		vars["now.part_of_day"] = "afternoon"
+	case hour >= 18 && hour < 23:
+		vars["now.part_of_day"] = "evening"
+	default:
+		vars["now.part_of_day"] = "night"
+	}
+
+	return vars
+}
+
+// sanitizePromptValue 压缩空白并截断用户可控的变量值，避免注入多行指令。
+func sanitizePromptValue(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	// 连续的花括号替换一次后仍可能拼出新的 "{{"，需反复替换。
+	for strings.Contains(value, "{{") {
+		value = strings.ReplaceAll(value, "{{", "{ {")
+	}
+	if utf8.RuneCountInString(value) > maxPromptVariableRunes {
+		value = string([]rune(value)[:maxPromptVariableRunes])
+	}
+	return value
+}
+
+type templateNodeKind int
+
+const (
+	templateText templateNodeKind = iota
+	templateVar
+	templateIf
+)
+
+// templateNode 表示解析后的模板节点。
+type templateNode struct {
+	kind     templateNodeKind
+	text     string
+	name     string
+	fallback string
+	negate   bool
+	then     []*templateNode
+	orElse   []*templateNode
+}
+
+// templateFrame 记录解析条件块时的栈帧。
+type templateFrame struct {
+	node   *templateNode
+	inElse bool
+	offset int
+}
+
+// parsePromptTemplate 将模板解析为节点树，只支持变量、default 与 if/unless 条件块。
+func parsePromptTemplate(tpl string) ([]*templateNode, []PromptTemplateIssue) {
+	var issues []PromptTemplateIssue
+	root := []*templateNode{}
+	stack := []*templateFrame{}
+
+	appendNode := func(node *templateNode) {
+		if len(stack) == 0 {
+			root = append(root, node)
+			return
+		}
+		frame := stack[len(stack)-1]
+		if frame.inElse {
+			frame.node.orElse = append(frame.node.orElse, node)
+		} else {
+			frame.node.then = append(frame.node.then, node)
+		}
+	}
+
+	pos := 0
+	for pos < len(tpl) {
+		start := strings.Index(tpl[pos:], "{{")
+		if start < 0 {
+			appendNode(&templateNode{kind: templateText, text: tpl[pos:]})
+			break
+		}
+		start += pos
+		if start > pos {
+			appendNode(&templateNode{kind: templateText, text: tpl[pos:start]})
+		}
+		end := strings.Index(tpl[start+2:], "}}")
+		if end < 0 {
+			issues = append(issues, PromptTemplateIssue{Offset: start, Message: "unclosed tag"})
+			appendNode(&templateNode{kind: templateText, text: tpl[start:]})
+			break
+		}
+		end += start + 2
+		tag := strings.TrimSpace(tpl[start+2 : end])
+		pos = end + 2
+
+		switch {
+		case strings.HasPrefix(tag, "#if ") || strings.HasPrefix(tag, "#unless "):
+			negate := strings.HasPrefix(tag, "#unless ")
+			name := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(tag, "#if "), "#unless "))
+			node := &templateNode{kind: templateIf, name: name, negate: negate}
+			if name == "" {
+				issues = append(issues, PromptTemplateIssue{Offset: start, Message: "condition requires a variable"})
+			}
+			appendNode(node)
+			stack = append(stack, &templateFrame{node: node, offset: start})
+		case tag == "else":
+			if len(stack) == 0 || stack[len(stack)-1].inElse {
+				issues = append(issues, PromptTemplateIssue{Offset: start, Message: "unexpected {{else}}"})
+				appendNode(&templateNode{kind: templateText, text: tpl[start:pos]})
+				continue
+			}
+			stack[len(stack)-1].inElse = true
+		case tag == "/if" || tag == "/unless":
+			if len(stack) == 0 {
+				issues = append(issues, PromptTemplateIssue{Offset: start, Message: fmt.Sprintf("unexpected {{%s}}", tag)})
+				appendNode(&templateNode{kind: templateText, text: tpl[start:pos]})
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(tag, "#") || strings.HasPrefix(tag, "/"):
+			issues = append(issues, PromptTemplateIssue{Offset: start, Message: fmt.Sprintf("unsupported block {{%s}}", tag)})
+			appendNode(&templateNode{kind: templateText, text: tpl[start:pos]})
+		default:
+			name, fallback, ok := parseVariableTag(tag)
+			if !ok {
+				issues = append(issues, PromptTemplateIssue{Offset: start, Message: fmt.Sprintf("invalid tag {{%s}}", tag)})
+				appendNode(&templateNode{kind: templateText, text: tpl[start:pos]})
+				continue
+			}
+			appendNode(&templateNode{kind: templateVar, name: name, fallback: fallback})
+		}
+	}
+
+	for _, frame := range stack {
+		issues = append(issues, PromptTemplateIssue{Offset: frame.offset, Variable: frame.node.name, Message: "unclosed condition block"})
+	}
+
+	return root, issues
+}
+
+// parseVariableTag 解析形如 `user.nickname | default "朋友"` 的变量标签。
+func parseVariableTag(tag string) (string, string, bool) {
+	name := tag
+	fallback := ""
+	if idx := strings.Index(tag, "|"); idx >= 0 {
+		name = strings.TrimSpace(tag[:idx])
+		filter := strings.TrimSpace(tag[idx+1:])
+		if !strings.HasPrefix(filter, "default") {
+			return "", "", false
+		}
+		arg := strings.TrimSpace(strings.TrimPrefix(filter, "default"))
+		unquoted, err := strconv.Unquote(arg)
+		if err != nil {
+			return "", "", false
+		}
+		fallback = unquoted
+	}
+	if name == "" || strings.ContainsAny(name, " \t\n{}") {
+		return "", "", false
+	}
+	return name, fallback, true
+}
+
+// RenderPromptTemplate 使用给定变量渲染模板，未知变量输出为空，语法错误处保留原文。
+func RenderPromptTemplate(tpl string, vars PromptVars) string {
+	if !HasPromptTemplate(tpl) {
+		return tpl
+	}
+	nodes, _ := parsePromptTemplate(tpl)
+	var builder strings.Builder
+	renderTemplateNodes(&builder, nodes, vars)
+	return builder.String()
+}
+
+// renderTemplateNodes 递归输出节点内容。
+func renderTemplateNodes(builder *strings.Builder, nodes []*templateNode, vars PromptVars) {
+	for _, node := range nodes {
+		switch node.kind {
+		case templateText:
+			builder.WriteString(node.text)
+		case templateVar:
+			value := vars[node.name]
+			if value == "" {
+				value = node.fallback
+			}
+			builder.WriteString(value)
+		case templateIf:
+			truthy := strings.TrimSpace(vars[node.name]) != ""
+			if node.negate {
+				truthy = !truthy
+			}
+			if truthy {
+				renderTemplateNodes(builder, node.then, vars)
+			} else {
+				renderTemplateNodes(builder, node.orElse, vars)
+			}
+		}
+	}
+}
+
+// ValidatePromptTemplate 检查模板语法与未知变量。
+func ValidatePromptTemplate(tpl string) []PromptTemplateIssue {
+	if !HasPromptTemplate(tpl) {
+		return nil
+	}
+	nodes, issues := parsePromptTemplate(tpl)
+	unknown := map[string]struct{}{}
+	collectUnknownVariables(nodes, unknown)
+
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		issues = append(issues, PromptTemplateIssue{Variable: name, Offset: -1, Message: promptIssueUnknownVariable})
+	}
+	return issues
+}
+
+// collectUnknownVariables 收集模板中未登记的变量名。
+func collectUnknownVariables(nodes []*templateNode, unknown map[string]struct{}) {
+	for _, node := range nodes {
+		if node.kind == templateVar || node.kind == templateIf {
+			if _, ok := PromptVariables[node.name]; !ok && node.name != "" {
+				unknown[node.name] = struct{}{}
+			}
+		}
+		if node.kind == templateIf {
+			collectUnknownVariables(node.then, unknown)
+			collectUnknownVariables(node.orElse, unknown)
+		}
+	}
+}
+
+// validatePromptFields 校验多个字段的模板，并在问题中标注字段名。
+func validatePromptFields(fields map[string]*string) []PromptTemplateIssue {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var issues []PromptTemplateIssue
+	for _, key := range keys {
+		value := fields[key]
+		if value == nil {
+			continue
+		}
+		for _, issue := range ValidatePromptTemplate(*value) {
+			issue.Field = key
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// splitPromptIssues 将校验结果拆分为阻止保存的语法错误与仅提示的未知变量警告。
+func splitPromptIssues(issues []PromptTemplateIssue) ([]PromptTemplateIssue, []PromptTemplateIssue) {
+	var syntax, warnings []PromptTemplateIssue
+	for _, issue := range issues {
+		if issue.Message == promptIssueUnknownVariable {
+			warnings = append(warnings, issue)
+			continue
+		}
+		syntax = append(syntax, issue)
+	}
+	return syntax, warnings
+}
+
+// LoadPromptUser 从用户表与用户记忆中读取渲染模板所需的用户信息。
+func LoadPromptUser(ctx context.Context, db *gorm.DB, agentID, userID uint64) PromptUser {
+	var user PromptUser
+	if db == nil || userID == 0 {
+		return user
+	}
+
+	var row struct {
+		Nickname    string
+		DisplayName string
+	}
+	if err := db.WithContext(ctx).Table("users").Select("nickname, display_name").Where("id = ?", userID).Take(&row).Error; err == nil {
+		user.Nickname = row.Nickname
+		user.DisplayName = row.DisplayName
+	}
+
+	var memory struct {
+		Preferences datatypes.JSON
+	}
+	if err := db.WithContext(ctx).Table("user_agent_memory").Select("preferences").Where("agent_id = ? AND user_id = ?", agentID, userID).Take(&memory).Error; err == nil && len(memory.Preferences) > 0 {
+		var prefs map[string]any
+		if json.Unmarshal(memory.Preferences, &prefs) == nil {
+			if v, ok := prefs["title_address"].(string); ok {
+				user.TitleAddress = v
+			}
+			if v, ok := prefs["timezone"].(string); ok {
+				user.Timezone = v
+			}
+			if v, ok := prefs["language"].(string); ok {
+				user.Language = v
+			}
+		}
+	}
+
+	return user
+}
+
+type promptValidationRequest struct {
+	SystemPrompt  *string `json:"system_prompt"`
+	PersonaDesc   *string `json:"persona_desc"`
+	OpeningLine   *string `json:"opening_line"`
+	FirstTurnHint *string `json:"first_turn_hint"`
+}
+
+// handleValidatePrompt godoc
+// @Summary 校验提示词模板
+// @Description 检查系统提示词、人设描述、开场白中的模板语法与未知变量，并返回可用变量列表；valid 仅反映语法错误，未知变量列入 warnings
+// @Tags Agents
+// @Accept json
+// @Produce json
+// @Param request body promptValidationRequest true "待校验的模板"
+// @Success 200 {object} map[string]interface{} "校验结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Author bizer
+// handleValidatePrompt 校验提示词模板并报告问题。
+func (m *Module) handleValidatePrompt(c *gin.Context) {
+	var req promptValidationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	issues := validatePromptFields(map[string]*string{
+		"system_prompt":   req.SystemPrompt,
+		"persona_desc":    req.PersonaDesc,
+		"opening_line":    req.OpeningLine,
+		"first_turn_hint": req.FirstTurnHint,
+	})
+	if issues == nil {
+		issues = []PromptTemplateIssue{}
+	}
+	syntax, warnings := splitPromptIssues(issues)
+	if warnings == nil {
+		warnings = []PromptTemplateIssue{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":     len(syntax) == 0,
+		"issues":    issues,
+		"warnings":  warnings,
+		"variables": PromptVariables,
+	})
+}
@@ -0,0 +1,248 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	knowledge "auralis_back/knowledge"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	maxRagTopK          = 20
+	maxRagWeight        = 10
+	maxRagRRFK          = 1000
+	minRagChunkMaxChars = 200
+	maxRagChunkMaxChars = 4000
+)
+
+// RagParams 描述知识库检索参数，存储于 AgentChatConfig.RagParams。
+// 向量与关键词两路召回按 weight/(rrf_k+rank) 融合，权重为 0 表示关闭该路召回。
+// rerank 为 false 时跳过重排，rerank_min_score 为 0~1 的重排分数阈值。
+// chunk_strategy 可选 fixed、sentence、markdown，与 chunk_max_chars、chunk_overlap 一起决定文档切分方式，修改后全部文档重新切分。
+type RagParams struct {
+	TopK           int      `json:"top_k,omitempty"`
+	VectorWeight   *float64 `json:"vector_weight,omitempty"`
+	KeywordWeight  *float64 `json:"keyword_weight,omitempty"`
+	RRFK           int      `json:"rrf_k,omitempty"`
+	Rerank         *bool    `json:"rerank,omitempty"`
+	RerankMinScore *float64 `json:"rerank_min_score,omitempty"`
+	ChunkStrategy  string   `json:"chunk_strategy,omitempty"`
+	ChunkMaxChars  int      `json:"chunk_max_chars,omitempty"`
+	ChunkOverlap   *int     `json:"chunk_overlap,omitempty"`
+}
+
+// ParseRagParams 解析存储的检索参数，为空时返回 nil。
+func ParseRagParams(raw datatypes.JSON) (*RagParams, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" || trimmed == "{}" {
+		return nil, nil
+	}
+	var params RagParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	if params.IsEmpty() {
+		return nil, nil
+	}
+	return &params, nil
+}
+
+// IsEmpty 判断检索参数是否未设置任何字段。
+func (p *RagParams) IsEmpty() bool {
+	if p == nil {
+		return true
+	}
+	return p.TopK <= 0 && p.VectorWeight == nil && p.KeywordWeight == nil && p.RRFK <= 0 &&
+		p.Rerank == nil && p.RerankMinScore == nil && p.ChunkStrategy == "" && p.ChunkMaxChars <= 0 && p.ChunkOverlap == nil
+}
+
+// Validate 校验检索参数的取值范围。
+func (p *RagParams) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.TopK < 0 || p.TopK > maxRagTopK {
+		return fmt.Errorf("rag_params.top_k must be between 1 and %d", maxRagTopK)
+	}
+	for field, weight := range map[string]*float64{"vector_weight": p.VectorWeight, "keyword_weight": p.KeywordWeight} {
+		if weight != nil && (*weight < 0 || *weight > maxRagWeight) {
+			return fmt.Errorf("rag_params.%s must be between 0 and %d", field, maxRagWeight)
+		}
+	}
+	if p.VectorWeight != nil && p.KeywordWeight != nil && *p.VectorWeight == 0 && *p.KeywordWeight == 0 {
+		return errors.New("rag_params.vector_weight and rag_params.keyword_weight cannot both be 0")
+	}
+	if p.RRFK < 0 || p.RRFK > maxRagRRFK {
+		return fmt.Errorf("rag_params.rrf_k must be between 1 and %d", maxRagRRFK)
+	}
+	if p.RerankMinScore != nil && (*p.RerankMinScore < 0 || *p.RerankMinScore > 1) {
+		return errors.New("rag_params.rerank_min_score must be between 0 and 1")
+	}
+	if p.ChunkStrategy != "" && !knowledge.ValidChunkStrategy(p.ChunkStrategy) {
+		return errors.New("rag_params.chunk_strategy must be one of fixed, sentence, markdown")
+	}
+	if p.ChunkMaxChars != 0 && (p.ChunkMaxChars < minRagChunkMaxChars || p.ChunkMaxChars > maxRagChunkMaxChars) {
+		return fmt.Errorf("rag_params.chunk_max_chars must be between %d and %d", minRagChunkMaxChars, maxRagChunkMaxChars)
+	}
+	if p.ChunkOverlap != nil {
+		limit := maxRagChunkMaxChars / 2
+		if p.ChunkMaxChars > 0 {
+			limit = p.ChunkMaxChars / 2
+		}
+		if *p.ChunkOverlap < 0 || *p.ChunkOverlap > limit {
+			return fmt.Errorf("rag_params.chunk_overlap must be between 0 and %d", limit)
+		}
+	}
+	return nil
+}
+
+// SearchOptions 将检索参数转换为知识库检索选项，未设置的字段使用默认值。
+func (p *RagParams) SearchOptions(defaultLimit int) knowledge.SearchOptions {
+	opts := knowledge.DefaultSearchOptions()
+	if defaultLimit > 0 {
+		opts.Limit = defaultLimit
+	}
+	if p == nil {
+		return opts
+	}
+	if p.TopK > 0 {
+		opts.Limit = p.TopK
+	}
+	if p.VectorWeight != nil {
+		opts.VectorWeight = *p.VectorWeight
+	}
+	if p.KeywordWeight != nil {
+		opts.KeywordWeight = *p.KeywordWeight
+	}
+	if p.RRFK > 0 {
+		opts.RRFK = p.RRFK
+	}
+	if p.Rerank != nil {
+		opts.Rerank = *p.Rerank
+	}
+	if p.RerankMinScore != nil {
+		opts.MinRerankScore = *p.RerankMinScore
+	}
+	return opts
+}
+
+// KnowledgeSearchOptions 读取智能体配置中的检索参数并转换为对话注入知识时使用的检索选项，
+// overrides 中已设置的字段覆盖已保存的参数，解析失败时使用默认值。
+func KnowledgeSearchOptions(cfg *AgentChatConfig, overrides *RagParams) knowledge.SearchOptions {
+	var params *RagParams
+	if cfg != nil {
+		parsed, err := ParseRagParams(cfg.RagParams)
+		if err != nil {
+			log.Printf("agents: parse rag params for agent %d failed: %v", cfg.AgentID, err)
+		}
+		params = parsed
+	}
+	return params.withOverrides(overrides).SearchOptions(knowledge.ContextSnippetLimit)
+}
+
+// withOverrides 返回以 overrides 中已设置的检索字段覆盖后的参数副本。
+func (p *RagParams) withOverrides(overrides *RagParams) *RagParams {
+	if overrides.IsEmpty() {
+		return p
+	}
+	merged := RagParams{}
+	if p != nil {
+		merged = *p
+	}
+	if overrides.TopK > 0 {
+		merged.TopK = overrides.TopK
+	}
+	if overrides.VectorWeight != nil {
+		merged.VectorWeight = overrides.VectorWeight
+	}
+	if overrides.KeywordWeight != nil {
+		merged.KeywordWeight = overrides.KeywordWeight
+	}
+	if overrides.RRFK > 0 {
+		merged.RRFK = overrides.RRFK
+	}
+	if overrides.Rerank != nil {
+		merged.Rerank = overrides.Rerank
+	}
+	if overrides.RerankMinScore != nil {
+		merged.RerankMinScore = overrides.RerankMinScore
+	}
+	return &merged
+}
+
+// ChunkOptions 返回文档切分配置，未设置切分字段时返回 nil。
+func (p *RagParams) ChunkOptions() *knowledge.ChunkOptions {
+	if p == nil || (p.ChunkStrategy == "" && p.ChunkMaxChars <= 0 && p.ChunkOverlap == nil) {
+		return nil
+	}
+	return &knowledge.ChunkOptions{
+		Strategy: p.ChunkStrategy,
+		MaxChars: p.ChunkMaxChars,
+		Overlap:  p.ChunkOverlap,
+	}
+}
+
+// chunkOptionsChanged 判断新的检索参数是否修改了已存储的切分配置。
+func chunkOptionsChanged(stored datatypes.JSON, next *RagParams) bool {
+	previous, err := ParseRagParams(stored)
+	if err != nil {
+		return true
+	}
+	before, after := previous.ChunkOptions(), next.ChunkOptions()
+	if before == nil || after == nil {
+		return before != after
+	}
+	sameOverlap := (before.Overlap == nil) == (after.Overlap == nil) &&
+		(before.Overlap == nil || *before.Overlap == *after.Overlap)
+	return before.Strategy != after.Strategy || before.MaxChars != after.MaxChars || !sameOverlap
+}
+
+// chunkOptionsResolver 从智能体对话配置的检索参数读取切分配置。
+func chunkOptionsResolver(db *gorm.DB) knowledge.ChunkOptionsResolver {
+	return func(ctx context.Context, agentID uint64) (*knowledge.ChunkOptions, error) {
+		var configs []AgentChatConfig
+		if err := db.WithContext(ctx).Select("agent_id", "rag_params").
+			Where("agent_id = ?", agentID).Limit(1).Find(&configs).Error; err != nil {
+			return nil, err
+		}
+		if len(configs) == 0 {
+			return nil, nil
+		}
+		params, err := ParseRagParams(configs[0].RagParams)
+		if err != nil {
+			return nil, nil
+		}
+		return params.ChunkOptions(), nil
+	}
+}
+
+// encodeRagParams 将检索参数序列化为存储格式，空配置返回 nil。
+func encodeRagParams(p *RagParams) (datatypes.JSON, error) {
+	if p.IsEmpty() {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
+
+// parseRagParamsField 解析表单中以 JSON 字符串提交的检索参数，空值表示清空。
+func parseRagParamsField(values []string) (*RagParams, error) {
+	raw := strings.TrimSpace(firstFormValue(values))
+	if raw == "" || raw == "null" {
+		return &RagParams{}, nil
+	}
+	var params RagParams
+	if err := json.Unmarshal([]byte(raw), &params); err != nil {
+		return nil, fmt.Errorf("invalid rag_params value: %w", err)
+	}
+	return &params, nil
+}
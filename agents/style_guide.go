@@ -0,0 +1,374 @@
+package agents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	maxStyleGuideListItems   = 50
+	maxStyleGuidePhraseRunes = 100
+	maxStyleGuideToneRunes   = 100
+)
+
+// StyleGuide 描述智能体的回复风格约束，存储于 AgentChatConfig.StyleGuide。
+type StyleGuide struct {
+	Tone              string   `json:"tone,omitempty"`
+	Verbosity         string   `json:"verbosity,omitempty"`
+	BannedPhrases     []string `json:"banned_phrases,omitempty"`
+	EmojiPolicy       string   `json:"emoji_policy,omitempty"`
+	Catchphrases      []string `json:"catchphrases,omitempty"`
+	MaxSentenceLength int      `json:"max_sentence_length,omitempty"`
+	MaxReplyLength    int      `json:"max_reply_length,omitempty"`
+}
+
+var (
+	styleVerbosityValues = map[string]string{
+		"concise":  "Keep replies short and to the point, usually one to three sentences.",
+		"balanced": "Keep replies moderately detailed, expanding only when it helps the user.",
+		"detailed": "Give thorough, well-structured replies when the topic calls for it.",
+	}
+	styleEmojiValues = map[string]string{
+		"none":    "Do not use emoji.",
+		"sparing": "Use emoji sparingly, at most one per reply.",
+		"free":    "Feel free to use emoji where they fit your persona.",
+	}
+	styleSentenceSplitter = regexp.MustCompile(`[^。！？!?.\n]+[。！？!?.]*`)
+	styleClauseBreaks     = "，,；;：:、"
+)
+
+// ParseStyleGuide 解析存储的风格配置，为空时返回 nil。
+func ParseStyleGuide(raw datatypes.JSON) (*StyleGuide, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" || trimmed == "{}" {
+		return nil, nil
+	}
+	var guide StyleGuide
+	if err := json.Unmarshal(raw, &guide); err != nil {
+		return nil, err
+	}
+	guide.normalize()
+	if guide.IsEmpty() {
+		return nil, nil
+	}
+	return &guide, nil
+}
+
+// IsEmpty 判断风格配置是否未设置任何规则。
+func (g *StyleGuide) IsEmpty() bool {
+	if g == nil {
+		return true
+	}
+	return g.Tone == "" && g.Verbosity == "" && len(g.BannedPhrases) == 0 && g.EmojiPolicy == "" &&
+		len(g.Catchphrases) == 0 && g.MaxSentenceLength <= 0 && g.MaxReplyLength <= 0
+}
+
+// normalize 去除空白并去重列表项。
+func (g *StyleGuide) normalize() {
+	g.Tone = strings.TrimSpace(g.Tone)
+	g.Verbosity = strings.ToLower(strings.TrimSpace(g.Verbosity))
+	g.EmojiPolicy = strings.ToLower(strings.TrimSpace(g.EmojiPolicy))
+	g.BannedPhrases = normalizeStyleList(g.BannedPhrases)
+	g.Catchphrases = normalizeStyleList(g.Catchphrases)
+}
+
+// normalizeStyleList 清理并去重字符串列表。
+func normalizeStyleList(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		trimmed := strings.TrimSpace(value)
+		if trimmed == "" {
+			continue
+		}
+		key := strings.ToLower(trimmed)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		result = append(result, trimmed)
+	}
+	return result
+}
+
+// Validate 校验风格配置的取值范围。
+func (g *StyleGuide) Validate() error {
+	if g == nil {
+		return nil
+	}
+	g.normalize()
+	if utf8.RuneCountInString(g.Tone) > maxStyleGuideToneRunes {
+		return errors.New("style_guide.tone is too long")
+	}
+	if g.Verbosity != "" {
+		if _, ok := styleVerbosityValues[g.Verbosity]; !ok {
+			return errors.New("style_guide.verbosity must be concise, balanced or detailed")
+		}
+	}
+	if g.EmojiPolicy != "" {
+		if _, ok := styleEmojiValues[g.EmojiPolicy]; !ok {
+			return errors.New("style_guide.emoji_policy must be none, sparing or free")
+		}
+	}
+	for field, list := range map[string][]string{"banned_phrases": g.BannedPhrases, "catchphrases": g.Catchphrases} {
+		if len(list) > maxStyleGuideListItems {
+			return fmt.Errorf("style_guide.%s allows at most %d items", field, maxStyleGuideListItems)
+		}
+		for _, item := range list {
+			if utf8.RuneCountInString(item) > maxStyleGuidePhraseRunes {
+				return fmt.Errorf("style_guide.%s item is too long", field)
+			}
+		}
+	}
+	if g.MaxSentenceLength < 0 || g.MaxSentenceLength > 500 {
+		return errors.New("style_guide.max_sentence_length must be between 0 and 500")
+	}
+	if g.MaxReplyLength < 0 || g.MaxReplyLength > 10000 {
+		return errors.New("style_guide.max_reply_length must be between 0 and 10000")
+	}
+	if g.MaxReplyLength > 0 && g.MaxReplyLength < 20 {
+		return errors.New("style_guide.max_reply_length must be at least 20")
+	}
+	return nil
+}
+
+// HasHardRules 判断风格配置是否包含需要在生成后强制执行的规则。
+func (g *StyleGuide) HasHardRules() bool {
+	if g == nil {
+		return false
+	}
+	return len(g.BannedPhrases) > 0 || g.EmojiPolicy == "none" || g.MaxSentenceLength > 0 || g.MaxReplyLength > 0
+}
+
+// PromptSection 将风格配置渲染为系统提示片段。
+func (g *StyleGuide) PromptSection() string {
+	if g.IsEmpty() {
+		return ""
+	}
+	lines := make([]string, 0, 7)
+	if g.Tone != "" {
+		lines = append(lines, "Tone: "+g.Tone+".")
+	}
+	if hint, ok := styleVerbosityValues[g.Verbosity]; ok {
+		lines = append(lines, hint)
+	}
+	if hint, ok := styleEmojiValues[g.EmojiPolicy]; ok {
+		lines = append(lines, hint)
+	}
+	if len(g.Catchphrases) > 0 {
+		lines = append(lines, "Signature catchphrases you may weave in naturally (do not overuse): "+strings.Join(g.Catchphrases, "; ")+".")
+	}
+	if len(g.BannedPhrases) > 0 {
+		lines = append(lines, "Never use these phrases: "+strings.Join(g.BannedPhrases, "; ")+".")
+	}
+	if g.MaxSentenceLength > 0 {
+		lines = append(lines, fmt.Sprintf("Keep each sentence under %d characters.", g.MaxSentenceLength))
+	}
+	if g.MaxReplyLength > 0 {
+		lines = append(lines, fmt.Sprintf("Keep the whole reply under %d characters.", g.MaxReplyLength))
+	}
+	return "Style guide:\n- " + strings.Join(lines, "\n- ")
+}
+
+// Enforce 对生成结果执行硬性规则（禁用语、表情策略、句长与回复长度上限），返回处理后的文本与触发的规则。
+func (g *StyleGuide) Enforce(text string) (string, []string) {
+	if g.IsEmpty() || text == "" {
+		return text, nil
+	}
+	applied := make([]string, 0, 3)
+
+	if len(g.BannedPhrases) > 0 {
+		replaced := text
+		for _, phrase := range g.BannedPhrases {
+			pattern := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(phrase))
+			replaced = pattern.ReplaceAllString(replaced, "")
+		}
+		if replaced != text {
+			text = tidyEnforcedText(replaced)
+			applied = append(applied, "banned_phrases")
+		}
+	}
+
+	if g.EmojiPolicy == "none" {
+		stripped := strings.Map(func(r rune) rune {
+			if isEmojiRune(r) {
+				return -1
+			}
+			return r
+		}, text)
+		if stripped != text {
+			text = tidyEnforcedText(stripped)
+			applied = append(applied, "emoji_policy")
+		}
+	}
+
+	if g.MaxSentenceLength > 0 {
+		if split, changed := splitLongSentences(text, g.MaxSentenceLength); changed {
+			text = split
+			applied = append(applied, "max_sentence_length")
+		}
+	}
+
+	if g.MaxReplyLength > 0 && utf8.RuneCountInString(text) > g.MaxReplyLength {
+		text = truncateAtSentence(text, g.MaxReplyLength)
+		applied = append(applied, "max_reply_length")
+	}
+
+	if len(applied) == 0 {
+		return text, nil
+	}
+	return text, applied
+}
+
+// tidyEnforcedText 清理删除内容后残留的多余空白与标点。
+func tidyEnforcedText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		line = strings.ReplaceAll(line, " ,", ",")
+		line = strings.ReplaceAll(line, " .", ".")
+		line = strings.ReplaceAll(line, "，，", "，")
+		lines[i] = strings.TrimLeft(line, "，,、 ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// truncateAtSentence 在不超过上限的最后一个完整句子处截断。
+func truncateAtSentence(text string, limit int) string {
+	cut := 0
+	for _, loc := range styleSentenceSplitter.FindAllStringIndex(text, -1) {
+		if utf8.RuneCountInString(text[:loc[1]]) > limit {
+			break
+		}
+		cut = loc[1]
+	}
+	if cut == 0 {
+		runes := []rune(text)
+		if len(runes) > limit {
+			runes = runes[:limit]
+		}
+		return strings.TrimSpace(string(runes))
+	}
+	return strings.TrimSpace(text[:cut])
+}
+
+// splitLongSentences 将超过上限的句子拆成多句，返回处理后的文本与是否有改动。
+func splitLongSentences(text string, limit int) (string, bool) {
+	var b strings.Builder
+	changed := false
+	last := 0
+	for _, loc := range styleSentenceSplitter.FindAllStringIndex(text, -1) {
+		b.WriteString(text[last:loc[0]])
+		sentence := text[loc[0]:loc[1]]
+		if utf8.RuneCountInString(strings.TrimSpace(sentence)) > limit {
+			sentence = breakSentence(sentence, limit)
+			changed = true
+		}
+		b.WriteString(sentence)
+		last = loc[1]
+	}
+	b.WriteString(text[last:])
+	return b.String(), changed
+}
+
+// breakSentence 优先在分句标点处、其次在空白处断开过长的句子，找不到断点时按字数硬切；
+// 断开处补上与文字相符的句号，保证每段连同句号不超过上限。
+func breakSentence(sentence string, limit int) string {
+	trimmed := strings.TrimLeft(sentence, " \t")
+	lead := sentence[:len(sentence)-len(trimmed)]
+	runes := []rune(strings.TrimRight(trimmed, " \t"))
+
+	var b strings.Builder
+	b.WriteString(lead)
+	for len(runes) > limit {
+		cut := sentenceBreakPoint(runes, limit)
+		piece := strings.TrimRight(string(runes[:cut]), styleClauseBreaks+" ")
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+		if piece == "" {
+			continue
+		}
+		terminator := "."
+		if last, _ := utf8.DecodeLastRuneInString(piece); isCJKRune(last) {
+			terminator = "。"
+		}
+		b.WriteString(piece)
+		b.WriteString(terminator)
+		if terminator == "." {
+			b.WriteString(" ")
+		}
+	}
+	b.WriteString(string(runes))
+	return b.String()
+}
+
+// sentenceBreakPoint 返回不超过上限的断句位置（断点之前的字符数）。
+func sentenceBreakPoint(runes []rune, limit int) int {
+	maxCut := max(limit-1, 1)
+	for i := maxCut; i > 0; i-- {
+		if strings.ContainsRune(styleClauseBreaks, runes[i-1]) {
+			return i
+		}
+	}
+	for i := maxCut; i > 0; i-- {
+		if unicode.IsSpace(runes[i]) {
+			return i
+		}
+	}
+	return maxCut
+}
+
+// isCJKRune 判断字符是否为中日韩文字或全角标点。
+func isCJKRune(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) || (r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// isEmojiRune 粗略判断字符是否为表情符号。
+func isEmojiRune(r rune) bool {
+	switch {
+	case r >= 0x1F300 && r <= 0x1FAFF:
+		return true
+	case r >= 0x2600 && r <= 0x27BF:
+		return true
+	case r == 0xFE0F || r == 0x200D:
+		return true
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return true
+	}
+	return false
+}
+
+// encodeStyleGuide 将风格配置序列化为存储格式，空配置返回 nil。
+func encodeStyleGuide(g *StyleGuide) (datatypes.JSON, error) {
+	if g.IsEmpty() {
+		return nil, nil
+	}
+	data, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
+
+// parseStyleGuideField 解析表单中以 JSON 字符串提交的风格配置，空值表示清空。
+func parseStyleGuideField(values []string) (*StyleGuide, error) {
+	raw := strings.TrimSpace(firstFormValue(values))
+	if raw == "" || raw == "null" {
+		return &StyleGuide{}, nil
+	}
+	var guide StyleGuide
+	if err := json.Unmarshal([]byte(raw), &guide); err != nil {
+		return nil, fmt.Errorf("invalid style_guide value: %w", err)
+	}
+	return &guide, nil
+}
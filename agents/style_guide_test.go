@@ -0,0 +1,91 @@
+package agents
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestStyleGuideEnforce(t *testing.T) {
+	tests := []struct {
+		name        string
+		guide       StyleGuide
+		text        string
+		want        string
+		wantApplied []string
+	}{
+		{
+			name:        "banned phrase",
+			guide:       StyleGuide{BannedPhrases: []string{"as an AI"}},
+			text:        "Well, as an AI I think so.",
+			want:        "Well, I think so.",
+			wantApplied: []string{"banned_phrases"},
+		},
+		{
+			name:        "emoji stripped",
+			guide:       StyleGuide{EmojiPolicy: "none"},
+			text:        "Great job 🎉",
+			want:        "Great job",
+			wantApplied: []string{"emoji_policy"},
+		},
+		{
+			name:        "long latin sentence split at clause",
+			guide:       StyleGuide{MaxSentenceLength: 30},
+			text:        "Short one. This sentence runs long, so it must be split.",
+			want:        "Short one. This sentence runs long. so it must be split.",
+			wantApplied: []string{"max_sentence_length"},
+		},
+		{
+			name:        "long cjk sentence split at comma",
+			guide:       StyleGuide{MaxSentenceLength: 15},
+			text:        "这是一个非常非常长的句子，里面的内容需要被拆分开来。短句。",
+			want:        "这是一个非常非常长的句子。里面的内容需要被拆分开来。短句。",
+			wantApplied: []string{"max_sentence_length"},
+		},
+		{
+			name:        "sentences within limit untouched",
+			guide:       StyleGuide{MaxSentenceLength: 30},
+			text:        "One. Two.",
+			want:        "One. Two.",
+			wantApplied: nil,
+		},
+		{
+			name:        "reply truncated at sentence",
+			guide:       StyleGuide{MaxReplyLength: 20},
+			text:        "First sentence. Second sentence is here.",
+			want:        "First sentence.",
+			wantApplied: []string{"max_reply_length"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, applied := tt.guide.Enforce(tt.text)
+			if got != tt.want {
+				t.Errorf("Enforce() = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(applied, tt.wantApplied) {
+				t.Errorf("applied = %v, want %v", applied, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestBreakSentenceRespectsLimit(t *testing.T) {
+	inputs := []string{
+		"Supercalifragilisticexpialidocious is a very long word indeed",
+		"没有任何标点的超长中文句子会被按字数硬切成多段",
+	}
+	for _, input := range inputs {
+		out, changed := splitLongSentences(input, 10)
+		if !changed {
+			t.Fatalf("splitLongSentences(%q) reported no change", input)
+		}
+		for _, loc := range styleSentenceSplitter.FindAllStringIndex(out, -1) {
+			sentence := out[loc[0]:loc[1]]
+			if n := utf8.RuneCountInString(strings.TrimSpace(sentence)); n > 10 {
+				t.Errorf("sentence %q has %d runes, want at most 10", sentence, n)
+			}
+		}
+	}
+}
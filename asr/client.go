@@ -0,0 +1,257 @@
+package asr
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewProviderFromEnv 根据 ASR_PROVIDER 环境变量创建识别供应商，默认使用 Whisper 兼容接口。
+func NewProviderFromEnv() (Provider, error) {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("ASR_PROVIDER"))) {
+	case "fake", "local":
+		return NewFakeProvider(strings.TrimSpace(os.Getenv("ASR_FAKE_TEXT"))), nil
+	case "", "whisper", "openai":
+		return newWhisperProviderFromEnv(), nil
+	default:
+		return nil, fmt.Errorf("asr: unsupported provider %q", os.Getenv("ASR_PROVIDER"))
+	}
+}
+
+// whisperProvider 对接 OpenAI Whisper 兼容的 /audio/transcriptions 接口。
+type whisperProvider struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	model      string
+}
+
+// newWhisperProviderFromEnv 基于环境变量创建 Whisper 兼容供应商。
+func newWhisperProviderFromEnv() *whisperProvider {
+	baseURL := strings.TrimSpace(firstNonEmpty(os.Getenv("ASR_API_BASE_URL"), os.Getenv("LLM_BASE_URL")))
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	model := strings.TrimSpace(os.Getenv("ASR_MODEL_ID"))
+	if model == "" {
+		model = "whisper-1"
+	}
+	timeout := 60 * time.Second
+	if raw := strings.TrimSpace(os.Getenv("ASR_TIMEOUT_SECONDS")); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil && seconds > 0 {
+			timeout = time.Duration(seconds) * time.Second
+		}
+	}
+	return &whisperProvider{
+		httpClient: &http.Client{Timeout: timeout},
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     strings.TrimSpace(firstNonEmpty(os.Getenv("ASR_API_KEY"), os.Getenv("LLM_API_KEY"))),
+		model:      model,
+	}
+}
+
+// ID 返回供应商标识。
+func (p *whisperProvider) ID() string {
+	return "whisper"
+}
+
+// Enabled 表示是否配置了 API Key。
+func (p *whisperProvider) Enabled() bool {
+	return p != nil && p.apiKey != ""
+}
+
+// Transcribe 上传音频并返回识别文本。
+func (p *whisperProvider) Transcribe(ctx context.Context, req TranscribeRequest) (*Transcript, error) {
+	if !p.Enabled() {
+		return nil, ErrDisabled
+	}
+	if len(req.Audio) == 0 {
+		return nil, ErrEmptyAudio
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	filename := strings.TrimSpace(req.Filename)
+	if filename == "" {
+		filename = "audio" + extensionForMime(req.MimeType)
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(req.Audio); err != nil {
+		return nil, err
+	}
+	fields := map[string]string{
+		"model":           p.model,
+		"response_format": "verbose_json",
+		"language":        primaryLanguage(req.Language),
+		"prompt":          strings.TrimSpace(req.Prompt),
+	}
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("asr: whisper request failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(payload)))
+	}
+
+	var parsed struct {
+		Text     string    `json:"text"`
+		Language string    `json:"language"`
+		Duration float64   `json:"duration"`
+		Segments []Segment `json:"segments"`
+	}
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return nil, fmt.Errorf("asr: decode whisper response: %w", err)
+	}
+
+	duration := parsed.Duration
+	if duration <= 0 {
+		duration = EstimateDuration(req.Audio, req.MimeType)
+	}
+	return &Transcript{
+		Text:            strings.TrimSpace(parsed.Text),
+		Language:        parsed.Language,
+		DurationSeconds: duration,
+		Provider:        p.ID(),
+		Segments:        parsed.Segments,
+	}, nil
+}
+
+// fakeProvider 本地假识别器，返回固定文本，用于开发与测试环境。
+type fakeProvider struct {
+	text string
+}
+
+// NewFakeProvider 创建返回固定文本的本地识别器，text 为空时返回音频时长描述。
+func NewFakeProvider(text string) Provider {
+	return &fakeProvider{text: text}
+}
+
+// ID 返回供应商标识。
+func (p *fakeProvider) ID() string {
+	return "fake"
+}
+
+// Enabled 本地假识别器始终可用。
+func (p *fakeProvider) Enabled() bool {
+	return p != nil
+}
+
+// Transcribe 返回固定文本与估算的音频时长。
+func (p *fakeProvider) Transcribe(ctx context.Context, req TranscribeRequest) (*Transcript, error) {
+	if len(req.Audio) == 0 {
+		return nil, ErrEmptyAudio
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	duration := EstimateDuration(req.Audio, req.MimeType)
+	text := p.text
+	if text == "" {
+		text = fmt.Sprintf("[%.1fs audio]", duration)
+	}
+	return &Transcript{
+		Text:            text,
+		Language:        primaryLanguage(req.Language),
+		DurationSeconds: duration,
+		Provider:        p.ID(),
+	}, nil
+}
+
+// EncodeWAV 将 16bit 单声道 PCM 数据封装为 WAV 文件。
+func EncodeWAV(pcm []byte, sampleRate int) []byte {
+	if sampleRate <= 0 {
+		sampleRate = 16000
+	}
+	const channels, bitsPerSample = 1, 16
+	byteRate := sampleRate * channels * bitsPerSample / 8
+	buf := bytes.NewBuffer(make([]byte, 0, 44+len(pcm)))
+	buf.WriteString("RIFF")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(1))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(channels))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(sampleRate))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(byteRate))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(channels*bitsPerSample/8))
+	_ = binary.Write(buf, binary.LittleEndian, uint16(bitsPerSample))
+	buf.WriteString("data")
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+// extensionForMime 根据 MIME 类型推断文件扩展名。
+func extensionForMime(mimeType string) string {
+	mime := strings.ToLower(mimeType)
+	switch {
+	case strings.Contains(mime, "wav"):
+		return ".wav"
+	case strings.Contains(mime, "mpeg"), strings.Contains(mime, "mp3"):
+		return ".mp3"
+	case strings.Contains(mime, "webm"):
+		return ".webm"
+	case strings.Contains(mime, "ogg"), strings.Contains(mime, "opus"):
+		return ".ogg"
+	case strings.Contains(mime, "mp4"), strings.Contains(mime, "m4a"), strings.Contains(mime, "aac"):
+		return ".m4a"
+	default:
+		return ".wav"
+	}
+}
+
+// primaryLanguage 提取语言代码的主语言部分，Whisper 只接受 ISO-639-1。
+func primaryLanguage(code string) string {
+	code = strings.TrimSpace(strings.ReplaceAll(code, "_", "-"))
+	if idx := strings.Index(code, "-"); idx >= 0 {
+		code = code[:idx]
+	}
+	return strings.ToLower(code)
+}
+
+// firstNonEmpty 返回第一个非空字符串。
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package asr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxUploadBytes = 25 << 20
+
+// Module 对接语音识别供应商并暴露 HTTP 处理器。
+type Module struct {
+	provider Provider
+}
+
+// RegisterRoutes 注册语音识别路由并初始化模块。
+func RegisterRoutes(router *gin.Engine) (*Module, error) {
+	provider, err := NewProviderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	module := &Module{provider: provider}
+
+	group := router.Group("/asr")
+	group.GET("/providers", module.handleProviders)
+
+	return module, nil
+}
+
+// ID 返回当前供应商标识。
+func (m *Module) ID() string {
+	if m == nil || m.provider == nil {
+		return ""
+	}
+	return m.provider.ID()
+}
+
+// Enabled 表示语音识别是否可用。
+func (m *Module) Enabled() bool {
+	return m != nil && m.provider != nil && m.provider.Enabled()
+}
+
+// Transcribe 调用当前供应商执行识别。
+func (m *Module) Transcribe(ctx context.Context, req TranscribeRequest) (*Transcript, error) {
+	if !m.Enabled() {
+		return nil, ErrDisabled
+	}
+	return m.provider.Transcribe(ctx, req)
+}
+
+// ReadUpload 读取表单中的音频文件，返回内容、文件名与 MIME 类型。
+func ReadUpload(c *gin.Context, field string) ([]byte, string, string, error) {
+	file, err := c.FormFile(field)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if file.Size > maxUploadBytes {
+		return nil, "", "", ErrAudioTooLarge
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxUploadBytes+1))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if len(data) > maxUploadBytes {
+		return nil, "", "", ErrAudioTooLarge
+	}
+	if len(data) == 0 {
+		return nil, "", "", ErrEmptyAudio
+	}
+	mimeType := strings.TrimSpace(file.Header.Get("Content-Type"))
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	return data, file.Filename, mimeType, nil
+}
+
+// handleProviders godoc
+// @Summary 获取语音识别供应商
+// @Description 返回当前启用的语音识别供应商及状态
+// @Tags ASR
+// @Produce json
+// @Success 200 {object} map[string]interface{} "供应商状态"
+// @Author bizer
+// handleProviders 返回语音识别供应商状态。
+func (m *Module) handleProviders(c *gin.Context) {
+	status := ProviderStatus{ID: m.ID(), Label: m.ID(), Enabled: m.Enabled()}
+	c.JSON(http.StatusOK, gin.H{"providers": []ProviderStatus{status}})
+}
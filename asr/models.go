@@ -0,0 +1,104 @@
+package asr
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// ErrDisabled 表示语音识别服务未启用或配置缺失。
+var ErrDisabled = errors.New("asr: service disabled")
+
+// ErrEmptyAudio 表示上传的音频为空。
+var ErrEmptyAudio = errors.New("asr: empty audio")
+
+// TranscribeRequest 描述一次语音识别请求。
+type TranscribeRequest struct {
+	Audio    []byte
+	Filename string
+	MimeType string
+	Language string
+	Prompt   string
+}
+
+// Segment 表示识别结果中的一个时间片段。
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Transcript 表示语音识别的结果。
+type Transcript struct {
+	Text            string    `json:"text"`
+	Language        string    `json:"language,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Provider        string    `json:"provider"`
+	Segments        []Segment `json:"segments,omitempty"`
+}
+
+// ProviderStatus 描述识别供应商的可用状态。
+type ProviderStatus struct {
+	ID      string `json:"id"`
+	Label   string `json:"label"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Provider 定义语音识别供应商的通用接口。
+type Provider interface {
+	ID() string
+	Enabled() bool
+	Transcribe(ctx context.Context, req TranscribeRequest) (*Transcript, error)
+}
+
+// EstimateDuration 估算音频时长（秒），WAV 按文件头计算，其余格式按 16kHz 16bit 单声道近似。
+func EstimateDuration(audio []byte, mimeType string) float64 {
+	if len(audio) == 0 {
+		return 0
+	}
+	if seconds, ok := wavDuration(audio); ok {
+		return seconds
+	}
+	mime := strings.ToLower(mimeType)
+	switch {
+	case strings.Contains(mime, "mpeg"), strings.Contains(mime, "mp3"):
+		return float64(len(audio)) / 16000
+	case strings.Contains(mime, "webm"), strings.Contains(mime, "ogg"), strings.Contains(mime, "opus"):
+		return float64(len(audio)) / 4000
+	default:
+		return float64(len(audio)) / 32000
+	}
+}
+
+// wavDuration 解析 WAV 文件头计算时长。
+func wavDuration(audio []byte) (float64, bool) {
+	if len(audio) < 44 || string(audio[0:4]) != "RIFF" || string(audio[8:12]) != "WAVE" {
+		return 0, false
+	}
+	var byteRate uint32
+	offset := 12
+	for offset+8 <= len(audio) {
+		chunkID := string(audio[offset : offset+4])
+		size := binary.LittleEndian.Uint32(audio[offset+4 : offset+8])
+		body := offset + 8
+		switch chunkID {
+		case "fmt ":
+			if body+12 > len(audio) {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(audio[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, false
+			}
+			dataSize := int(size)
+			if remaining := len(audio) - body; dataSize > remaining {
+				dataSize = remaining
+			}
+			return float64(dataSize) / float64(byteRate), true
+		}
+		offset = body + int(size) + int(size%2)
+	}
+	return 0, false
+}
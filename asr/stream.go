@@ -0,0 +1,174 @@
+package asr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultPartialEverySeconds  = 1.5
+	defaultPartialWindowSeconds = 10
+	defaultMaxPartials          = 40
+	defaultStreamMaxBytes       = 20 << 20
+)
+
+// ErrAudioTooLarge 表示流式音频超过允许的大小。
+var ErrAudioTooLarge = errors.New("asr: audio too large")
+
+// StreamOptions 配置流式识别会话。
+type StreamOptions struct {
+	// Format 为 pcm16 时按 16bit 单声道 PCM 处理并在识别前封装为 WAV，否则视为可直接拼接的容器格式（如 audio/webm）。
+	Format       string
+	SampleRate   int
+	Language     string
+	Prompt       string
+	PartialEvery float64
+	// PartialWindow 限制每次中间识别提交的音频时长（秒）：PCM 只识别最近的窗口，容器格式超过窗口后不再产出中间结果。
+	PartialWindow float64
+	// MaxPartials 限制单个会话的中间识别次数。
+	MaxPartials int
+	MaxBytes    int
+}
+
+// StreamSession 累积音频分片，定期对最近的音频做识别以产出中间结果。
+type StreamSession struct {
+	provider      Provider
+	opts          StreamOptions
+	mu            sync.Mutex
+	buf           bytes.Buffer
+	lastPartialAt float64
+	partials      int
+	partial       string
+	transcribed   float64
+}
+
+// NewStreamSession 创建流式识别会话，适配仅支持整段识别的供应商。
+func NewStreamSession(provider Provider, opts StreamOptions) *StreamSession {
+	if opts.PartialEvery <= 0 {
+		opts.PartialEvery = defaultPartialEverySeconds
+	}
+	if opts.PartialWindow <= 0 {
+		opts.PartialWindow = defaultPartialWindowSeconds
+	}
+	if opts.MaxPartials <= 0 {
+		opts.MaxPartials = defaultMaxPartials
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultStreamMaxBytes
+	}
+	if opts.SampleRate <= 0 {
+		opts.SampleRate = 16000
+	}
+	return &StreamSession{provider: provider, opts: opts}
+}
+
+// Append 写入音频分片，累计新音频达到阈值时返回中间识别结果，否则返回 nil。
+func (s *StreamSession) Append(ctx context.Context, chunk []byte) (*Transcript, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(chunk) == 0 {
+		return nil, nil
+	}
+	if s.buf.Len()+len(chunk) > s.opts.MaxBytes {
+		return nil, ErrAudioTooLarge
+	}
+	s.buf.Write(chunk)
+	duration := s.durationLocked()
+	if duration-s.lastPartialAt < s.opts.PartialEvery || s.partials >= s.opts.MaxPartials {
+		return nil, nil
+	}
+	if !s.isPCM() && duration > s.opts.PartialWindow {
+		return nil, nil
+	}
+	s.partials++
+	s.lastPartialAt = duration
+	transcript, err := s.transcribeLocked(ctx, s.partialAudioLocked())
+	if err != nil {
+		return nil, err
+	}
+	s.transcribed = max(s.transcribed, duration)
+	if transcript.Text == s.partial {
+		return nil, nil
+	}
+	s.partial = transcript.Text
+	return transcript, nil
+}
+
+// Finish 对全部音频做最终识别。
+func (s *StreamSession) Finish(ctx context.Context) (*Transcript, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buf.Len() == 0 {
+		return nil, ErrEmptyAudio
+	}
+	transcript, err := s.transcribeLocked(ctx, s.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	s.transcribed = max(s.transcribed, s.durationLocked())
+	return transcript, nil
+}
+
+// TranscribedSeconds 返回已提交识别并成功返回的音频时长（秒），用于会话中途结束时计费。
+func (s *StreamSession) TranscribedSeconds() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transcribed
+}
+
+// Duration 返回已接收音频的估算时长（秒）。
+func (s *StreamSession) Duration() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.durationLocked()
+}
+
+// isPCM 判断会话是否为裸 PCM 输入。
+func (s *StreamSession) isPCM() bool {
+	format := strings.ToLower(strings.TrimSpace(s.opts.Format))
+	return format == "" || format == "pcm" || format == "pcm16"
+}
+
+// durationLocked 估算已接收音频时长，调用方需持有锁。
+func (s *StreamSession) durationLocked() float64 {
+	if s.isPCM() {
+		return float64(s.buf.Len()) / float64(s.opts.SampleRate*2)
+	}
+	return EstimateDuration(s.buf.Bytes(), s.opts.Format)
+}
+
+// partialAudioLocked 返回中间识别使用的音频，PCM 输入只取最近 PartialWindow 秒，调用方需持有锁。
+func (s *StreamSession) partialAudioLocked() []byte {
+	data := s.buf.Bytes()
+	if !s.isPCM() {
+		return data
+	}
+	window := int(s.opts.PartialWindow*float64(s.opts.SampleRate)) * 2
+	if window > 0 && len(data) > window {
+		start := len(data) - window
+		data = data[start-start%2:]
+	}
+	return data
+}
+
+// transcribeLocked 识别给定的音频，调用方需持有锁。
+func (s *StreamSession) transcribeLocked(ctx context.Context, audio []byte) (*Transcript, error) {
+	if s.provider == nil || !s.provider.Enabled() {
+		return nil, ErrDisabled
+	}
+	req := TranscribeRequest{
+		Language: s.opts.Language,
+		Prompt:   s.opts.Prompt,
+		MimeType: s.opts.Format,
+	}
+	if s.isPCM() {
+		req.Audio = EncodeWAV(audio, s.opts.SampleRate)
+		req.MimeType = "audio/wav"
+	} else {
+		req.Audio = append([]byte(nil), audio...)
+	}
+	return s.provider.Transcribe(ctx, req)
+}
@@ -0,0 +1,143 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// recordingProvider 包装本地假识别器，记录每次提交的音频时长。
+type recordingProvider struct {
+	Provider
+	durations []float64
+}
+
+func (p *recordingProvider) Transcribe(ctx context.Context, req TranscribeRequest) (*Transcript, error) {
+	p.durations = append(p.durations, EstimateDuration(req.Audio, req.MimeType))
+	return p.Provider.Transcribe(ctx, req)
+}
+
+func TestStreamSession(t *testing.T) {
+	pcmSecond := make([]byte, 16000*2)
+	webmSecond := make([]byte, 4000)
+
+	tests := []struct {
+		name            string
+		opts            StreamOptions
+		chunk           []byte
+		chunks          int
+		wantPartials    []string
+		wantSubmitted   []float64
+		wantTranscribed float64
+		wantFinal       string
+	}{
+		{
+			name:            "pcm partial per second",
+			opts:            StreamOptions{PartialEvery: 1},
+			chunk:           pcmSecond,
+			chunks:          3,
+			wantPartials:    []string{"[1.0s audio]", "[2.0s audio]", "[3.0s audio]"},
+			wantSubmitted:   []float64{1, 2, 3},
+			wantTranscribed: 3,
+			wantFinal:       "[3.0s audio]",
+		},
+		{
+			name:            "pcm partials use tail window",
+			opts:            StreamOptions{PartialEvery: 1, PartialWindow: 2},
+			chunk:           pcmSecond,
+			chunks:          4,
+			wantPartials:    []string{"[1.0s audio]", "[2.0s audio]"},
+			wantSubmitted:   []float64{1, 2, 2, 2},
+			wantTranscribed: 4,
+			wantFinal:       "[4.0s audio]",
+		},
+		{
+			name:            "max partials",
+			opts:            StreamOptions{PartialEvery: 1, MaxPartials: 2},
+			chunk:           pcmSecond,
+			chunks:          4,
+			wantPartials:    []string{"[1.0s audio]", "[2.0s audio]"},
+			wantSubmitted:   []float64{1, 2},
+			wantTranscribed: 2,
+			wantFinal:       "[4.0s audio]",
+		},
+		{
+			name:            "container stops partials beyond window",
+			opts:            StreamOptions{Format: "audio/webm", PartialEvery: 1, PartialWindow: 2},
+			chunk:           webmSecond,
+			chunks:          4,
+			wantPartials:    []string{"[1.0s audio]", "[2.0s audio]"},
+			wantSubmitted:   []float64{1, 2},
+			wantTranscribed: 2,
+			wantFinal:       "[4.0s audio]",
+		},
+		{
+			name:            "below partial interval",
+			opts:            StreamOptions{PartialEvery: 5},
+			chunk:           pcmSecond,
+			chunks:          2,
+			wantTranscribed: 0,
+			wantFinal:       "[2.0s audio]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &recordingProvider{Provider: NewFakeProvider("")}
+			session := NewStreamSession(provider, tt.opts)
+			ctx := context.Background()
+
+			var partials []string
+			for i := 0; i < tt.chunks; i++ {
+				partial, err := session.Append(ctx, tt.chunk)
+				if err != nil {
+					t.Fatalf("Append: %v", err)
+				}
+				if partial != nil {
+					partials = append(partials, partial.Text)
+				}
+			}
+			if !slices.Equal(partials, tt.wantPartials) {
+				t.Errorf("partials = %v, want %v", partials, tt.wantPartials)
+			}
+			if !slices.Equal(provider.durations, tt.wantSubmitted) {
+				t.Errorf("submitted = %v, want %v", provider.durations, tt.wantSubmitted)
+			}
+			if got := session.TranscribedSeconds(); got != tt.wantTranscribed {
+				t.Errorf("transcribed before finish = %v, want %v", got, tt.wantTranscribed)
+			}
+
+			final, err := session.Finish(ctx)
+			if err != nil {
+				t.Fatalf("Finish: %v", err)
+			}
+			if final.Text != tt.wantFinal {
+				t.Errorf("final = %q, want %q", final.Text, tt.wantFinal)
+			}
+			if got, want := session.TranscribedSeconds(), session.Duration(); got != want {
+				t.Errorf("transcribed after finish = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestStreamSessionErrors(t *testing.T) {
+	ctx := context.Background()
+
+	session := NewStreamSession(NewFakeProvider("hi"), StreamOptions{MaxBytes: 10})
+	if _, err := session.Finish(ctx); !errors.Is(err, ErrEmptyAudio) {
+		t.Errorf("Finish on empty session = %v, want ErrEmptyAudio", err)
+	}
+	if _, err := session.Append(ctx, make([]byte, 11)); !errors.Is(err, ErrAudioTooLarge) {
+		t.Errorf("Append over limit = %v, want ErrAudioTooLarge", err)
+	}
+
+	disabled := NewStreamSession(nil, StreamOptions{PartialEvery: 0.5})
+	if _, err := disabled.Append(ctx, make([]byte, 32000)); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Append without provider = %v, want ErrDisabled", err)
+	}
+	if got := disabled.TranscribedSeconds(); got != 0 {
+		t.Errorf("failed partial counted %v transcribed seconds", got)
+	}
+}
@@ -0,0 +1,152 @@
+package asr
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const vadWindowMs = 20
+
+// VADConfig 配置基于能量的语音活动检测。
+type VADConfig struct {
+	SampleRate     int
+	Threshold      float64
+	MinSpeechMs    int
+	SilenceMs      int
+	PreRollMs      int
+	MaxUtteranceMs int
+}
+
+// VAD 对 16bit 单声道 PCM 做基于短时能量的语音活动检测，并切分出完整语句。
+type VAD struct {
+	cfg          VADConfig
+	windowBytes  int
+	pending      []byte
+	preRoll      [][]byte
+	candidate    [][]byte
+	utterance    []byte
+	speaking     bool
+	silentWindow int
+}
+
+// NewVAD 创建语音活动检测器，未设置的参数使用默认值。
+func NewVAD(cfg VADConfig) *VAD {
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = 16000
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 500
+	}
+	if cfg.MinSpeechMs <= 0 {
+		cfg.MinSpeechMs = 200
+	}
+	if cfg.SilenceMs <= 0 {
+		cfg.SilenceMs = 700
+	}
+	if cfg.PreRollMs < 0 {
+		cfg.PreRollMs = 0
+	} else if cfg.PreRollMs == 0 {
+		cfg.PreRollMs = 300
+	}
+	if cfg.MaxUtteranceMs <= 0 {
+		cfg.MaxUtteranceMs = 30000
+	}
+	return &VAD{
+		cfg:         cfg,
+		windowBytes: cfg.SampleRate * 2 * vadWindowMs / 1000,
+	}
+}
+
+// Speaking 表示当前是否处于语音段内。
+func (v *VAD) Speaking() bool {
+	return v.speaking
+}
+
+// Process 写入一段 PCM 音频，started 表示本段内检测到语音开始，utterance 非空时表示一句话结束。
+func (v *VAD) Process(frame []byte) (started bool, utterance []byte) {
+	v.pending = append(v.pending, frame...)
+	for len(v.pending) >= v.windowBytes {
+		window := append([]byte(nil), v.pending[:v.windowBytes]...)
+		v.pending = v.pending[v.windowBytes:]
+		s, u := v.processWindow(window)
+		started = started || s
+		if u != nil {
+			utterance = u
+		}
+	}
+	return started, utterance
+}
+
+// Flush 结束检测，返回尚未结束的语句。
+func (v *VAD) Flush() []byte {
+	if !v.speaking {
+		return nil
+	}
+	return v.finish()
+}
+
+// processWindow 处理单个 20ms 窗口并更新状态。
+func (v *VAD) processWindow(window []byte) (bool, []byte) {
+	voiced := rms(window) >= v.cfg.Threshold
+
+	if !v.speaking {
+		if !voiced {
+			v.candidate = nil
+			v.preRoll = append(v.preRoll, window)
+			if maxWindows := v.cfg.PreRollMs / vadWindowMs; len(v.preRoll) > maxWindows {
+				v.preRoll = v.preRoll[len(v.preRoll)-maxWindows:]
+			}
+			return false, nil
+		}
+		v.candidate = append(v.candidate, window)
+		if len(v.candidate)*vadWindowMs < v.cfg.MinSpeechMs {
+			return false, nil
+		}
+		v.speaking = true
+		v.silentWindow = 0
+		v.utterance = v.utterance[:0]
+		for _, w := range v.preRoll {
+			v.utterance = append(v.utterance, w...)
+		}
+		for _, w := range v.candidate {
+			v.utterance = append(v.utterance, w...)
+		}
+		v.preRoll = nil
+		v.candidate = nil
+		return true, nil
+	}
+
+	v.utterance = append(v.utterance, window...)
+	if voiced {
+		v.silentWindow = 0
+	} else {
+		v.silentWindow++
+	}
+	if v.silentWindow*vadWindowMs >= v.cfg.SilenceMs || len(v.utterance)/v.windowBytes*vadWindowMs >= v.cfg.MaxUtteranceMs {
+		return false, v.finish()
+	}
+	return false, nil
+}
+
+// finish 输出当前语句并重置状态。
+func (v *VAD) finish() []byte {
+	out := append([]byte(nil), v.utterance...)
+	v.utterance = v.utterance[:0]
+	v.speaking = false
+	v.silentWindow = 0
+	return out
+}
+
+// rms 计算 16bit PCM 窗口的均方根能量。
+func rms(window []byte) float64 {
+	samples := len(window) / 2
+	if samples == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i+1 < len(window); i += 2 {
+		sample := float64(int16(binary.LittleEndian.Uint16(window[i : i+2])))
+		sum += sample * sample
+	}
+	return math.Sqrt(sum / float64(samples))
+}
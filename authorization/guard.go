@@ -9,6 +9,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// RoleAdmin 为管理员角色编码。
+	RoleAdmin = "admin"
+	// RoleGuest 为匿名访客角色编码。
+	RoleGuest = "guest"
+)
+
 // Guard 封装 JWT 中间件以提供授权辅助方法。
 type Guard struct {
 	jwt *jwt.GinJWTMiddleware
@@ -97,3 +104,45 @@ func (g *Guard) RequireAnyRole(roles ...string) gin.HandlerFunc {
 func (g *Guard) RequireRole(role string) gin.HandlerFunc {
 	return g.RequireAnyRole(role)
 }
+
+// RequireMember 拒绝匿名访客，仅允许注册用户访问。
+func (g *Guard) RequireMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, roles := CurrentUser(c)
+		if userID == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		if HasRole(roles, RoleGuest) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available for guest accounts"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser 从请求的 JWT 声明中解析当前用户 ID 与角色。
+func CurrentUser(c *gin.Context) (uint64, []string) {
+	if c == nil {
+		return 0, nil
+	}
+	claims := jwt.ExtractClaims(c)
+	if len(claims) == 0 {
+		return 0, nil
+	}
+	return uint64(extractUserID(claims)), extractRoles(claims)
+}
+
+// HasRole 判断角色列表中是否包含目标角色。
+func HasRole(roles []string, role string) bool {
+	target := strings.ToLower(strings.TrimSpace(role))
+	if target == "" {
+		return false
+	}
+	for _, candidate := range roles {
+		if strings.ToLower(strings.TrimSpace(candidate)) == target {
+			return true
+		}
+	}
+	return false
+}
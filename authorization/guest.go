@@ -0,0 +1,127 @@
+package authorization
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	guestStatus            = "guest"
+	defaultGuestTokenQuota = 2000
+)
+
+// StatusChannel 标记由外部消息渠道自动创建的账号，其对话消耗计入渠道绑定者，不参与套餐额度补充。
+const StatusChannel = "channel"
+
+// quotaExemptStatuses 为不按套餐补充额度的账号状态。
+var quotaExemptStatuses = []string{guestStatus, StatusChannel}
+
+// guestLoginRequest 描述访客登录所需的验证码信息。
+type guestLoginRequest struct {
+	CaptchaID     string `json:"captcha_id" binding:"required"`
+	CaptchaAnswer string `json:"captcha_answer" binding:"required"`
+}
+
+// guestModeEnabled 判断是否开放匿名访客模式。
+func guestModeEnabled() bool {
+	enabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("AUTH_GUEST_ENABLED")))
+	return err == nil && enabled
+}
+
+// guestTokenQuota 返回访客账号的初始代币额度。
+func guestTokenQuota() int64 {
+	raw := strings.TrimSpace(os.Getenv("AUTH_GUEST_TOKEN_QUOTA"))
+	if raw == "" {
+		return defaultGuestTokenQuota
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < 0 {
+		return defaultGuestTokenQuota
+	}
+	return value
+}
+
+// newGuestUser 构造一次性的访客账号，密码哈希不可用于登录。
+func newGuestUser() (*User, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("authorization: generate guest id: %w", err)
+	}
+	username := "guest_" + hex.EncodeToString(buf)
+	return &User{
+		Username:     username,
+		PasswordHash: "!",
+		DisplayName:  "Guest",
+		Nickname:     "Guest",
+		Email:        username + "@guest.invalid",
+		Status:       guestStatus,
+		TokenBalance: guestTokenQuota(),
+		Plan:         PlanFree,
+	}, nil
+}
+
+// handleGuestLogin godoc
+// @Summary 访客登录
+// @Description 创建匿名访客账号并返回访问令牌，访客只拥有 AUTH_GUEST_TOKEN_QUOTA 指定的有限代币额度且不能充值
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Param request body guestLoginRequest true "验证码"
+// @Success 201 {object} map[string]interface{} "访客令牌与账号信息"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 403 {object} map[string]string "访客模式未开启"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleGuestLogin 创建访客账号并颁发 JWT。
+func (m *Module) handleGuestLogin(c *gin.Context) {
+	if m == nil || m.jwtMiddleware == nil || m.userStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "authentication service unavailable"})
+		return
+	}
+	if !guestModeEnabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "guest mode disabled"})
+		return
+	}
+
+	var req guestLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if m.captcha != nil && !m.captcha.Verify(req.CaptchaID, req.CaptchaAnswer) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid captcha"})
+		return
+	}
+
+	user, err := newGuestUser()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create guest"})
+		return
+	}
+	ctx := c.Request.Context()
+	if err := m.userStore.Create(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create guest", "details": err.Error()})
+		return
+	}
+
+	roles := []string{RoleGuest}
+	token, expire, err := m.jwtMiddleware.TokenGenerator(&AuthenticatedUser{ID: user.ID, Username: user.Username, Roles: roles})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue token"})
+		return
+	}
+	m.jwtMiddleware.SetCookie(c, token)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":  token,
+		"expire": expire,
+		"user":   buildUserPayload(ctx, m.avatarStorage, user, roles),
+	})
+}
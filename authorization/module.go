@@ -16,6 +16,7 @@ import (
 	"time"
 
 	cache "auralis_back/cache"
+	"auralis_back/ratelimit"
 	filestore "auralis_back/storage"
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
@@ -53,6 +54,14 @@ var (
 	ErrInvalidTokenAmount = errors.New("authorization: token amount must be positive")
 )
 
+// 登录注册相关接口按客户端 IP 限流，防止暴力破解与批量注册。
+var (
+	captchaRateLimit  = ratelimit.Policy{Name: "auth-captcha", Key: ratelimit.KeyIP, Limit: ratelimit.PerWindow(30, time.Minute)}
+	loginRateLimit    = ratelimit.Policy{Name: "auth-login", Key: ratelimit.KeyIP, Limit: ratelimit.PerWindow(10, time.Minute)}
+	registerRateLimit = ratelimit.Policy{Name: "auth-register", Key: ratelimit.KeyIP, Limit: ratelimit.PerWindow(5, 10*time.Minute)}
+	guestRateLimit    = ratelimit.Policy{Name: "auth-guest", Key: ratelimit.KeyIP, Limit: ratelimit.PerWindow(5, time.Hour)}
+)
+
 var (
 	sharedUserCacheMu sync.RWMutex
 	sharedUserCache   *userCache
@@ -70,7 +79,7 @@ type Module struct {
 }
 
 // RegisterRoutes 注册鉴权路由并初始化所有依赖。
-func RegisterRoutes(router *gin.Engine) (*Module, error) {
+func RegisterRoutes(router *gin.Engine, limiter *ratelimit.Limiter) (*Module, error) {
 	dsn := strings.TrimSpace(os.Getenv("DATABASE_DSN"))
 	if dsn == "" {
 		return nil, errors.New("authorization: DATABASE_DSN environment variable is required")
@@ -129,10 +138,12 @@ func RegisterRoutes(router *gin.Engine) (*Module, error) {
 	}
 
 	authGroup := router.Group("/auth")
-	authGroup.GET("/captcha", module.handleCaptcha)
-	authGroup.POST("/register", module.handleRegister)
-	authGroup.POST("/login", module.handleLogin)
+	authGroup.GET("/captcha", limiter.Handler(captchaRateLimit), module.handleCaptcha)
+	authGroup.POST("/register", limiter.Handler(registerRateLimit), module.handleRegister)
+	authGroup.POST("/login", limiter.Handler(loginRateLimit), module.handleLogin)
 	authGroup.POST("/refresh", module.handleRefresh)
+	authGroup.POST("/guest", limiter.Handler(guestRateLimit), module.handleGuestLogin)
+	authGroup.GET("/plans", module.handleListPlans)
 
 	secured := authGroup.Group("")
 	secured.Use(module.jwtMiddleware.MiddlewareFunc())
@@ -141,6 +152,9 @@ func RegisterRoutes(router *gin.Engine) (*Module, error) {
 	secured.POST("/profile/avatar", module.handleUploadAvatar)
 	secured.POST("/tokens/purchase", module.handlePurchaseTokens)
 	secured.POST("/admin-request", module.handleAdminRequest)
+	secured.PUT("/admin/users/:id/plan", NewGuard(module.jwtMiddleware).RequireRole(RoleAdmin), module.handleSetUserPlan)
+
+	userStore.startQuotaRefiller()
 
 	return module, nil
 }
@@ -516,6 +530,7 @@ func (m *Module) handleUploadAvatar(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "最新令牌余额"
 // @Failure 400 {object} map[string]string "请求参数错误"
 // @Failure 401 {object} map[string]string "未授权"
+// @Failure 403 {object} map[string]string "访客不可充值"
 // @Failure 404 {object} map[string]string "未找到"
 // @Failure 503 {object} map[string]string "服务不可用"
 // @Author bizer
@@ -547,6 +562,10 @@ func (m *Module) handlePurchaseTokens(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 		return
 	}
+	if HasRole(extractRoles(claims), RoleGuest) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "guest accounts cannot purchase tokens"})
+		return
+	}
 
 	ctx := c.Request.Context()
 	balance, err := m.userStore.AddTokens(ctx, userID, req.Amount)
@@ -892,15 +911,18 @@ func (s *AuthService) Register(ctx context.Context, username, password, displayN
 		}
 	}
 
+	now := time.Now().UTC()
 	user := &User{
-		Username:     username,
-		PasswordHash: string(hash),
-		DisplayName:  displayName,
-		Nickname:     nickname,
-		Email:        normalizedEmail,
-		AvatarURL:    storedAvatar,
-		Bio:          storedBio,
-		TokenBalance: defaultTokenBalance,
+		Username:        username,
+		PasswordHash:    string(hash),
+		DisplayName:     displayName,
+		Nickname:        nickname,
+		Email:           normalizedEmail,
+		AvatarURL:       storedAvatar,
+		Bio:             storedBio,
+		TokenBalance:    LookupPlan(PlanFree).MonthlyTokens,
+		Plan:            PlanFree,
+		QuotaRefilledAt: &now,
 	}
 	if err := s.users.Create(ctx, user); err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
@@ -1395,19 +1417,21 @@ func (s *UserStore) UpdateProfile(ctx context.Context, userID uint, params Updat
 
 // User 表示系统中的账号实体。
 type User struct {
-	ID           uint    `gorm:"primaryKey"`
-	Username     string  `gorm:"uniqueIndex;size:64;not null"`
-	PasswordHash string  `gorm:"size:255;not null"`
-	DisplayName  string  `gorm:"size:128;not null;default:''"`
-	Nickname     string  `gorm:"size:64;not null"`
-	Email        string  `gorm:"uniqueIndex;size:128;not null"`
-	AvatarURL    *string `gorm:"size:255"`
-	Bio          *string `gorm:"type:text"`
-	Status       string  `gorm:"size:32;default:'active'"`
-	LastLoginAt  *time.Time
-	CreatedAt    time.Time
-	TokenBalance int64 `gorm:"column:token_balance;not null;default:100000"`
-	UpdatedAt    time.Time
+	ID              uint    `gorm:"primaryKey"`
+	Username        string  `gorm:"uniqueIndex;size:64;not null"`
+	PasswordHash    string  `gorm:"size:255;not null"`
+	DisplayName     string  `gorm:"size:128;not null;default:''"`
+	Nickname        string  `gorm:"size:64;not null"`
+	Email           string  `gorm:"uniqueIndex;size:128;not null"`
+	AvatarURL       *string `gorm:"size:255"`
+	Bio             *string `gorm:"type:text"`
+	Status          string  `gorm:"size:32;default:'active'"`
+	LastLoginAt     *time.Time
+	CreatedAt       time.Time
+	TokenBalance    int64  `gorm:"column:token_balance;not null;default:100000"`
+	Plan            string `gorm:"size:32;not null;default:'free'"`
+	QuotaRefilledAt *time.Time
+	UpdatedAt       time.Time
 }
 
 // Role 表示可授予用户的一组权限。
@@ -1522,6 +1546,7 @@ func buildUserPayload(ctx context.Context, store *filestore.AvatarStorage, user
 		"created_at":    user.CreatedAt,
 		"updated_at":    user.UpdatedAt,
 		"token_balance": user.TokenBalance,
+		"plan":          buildPlanPayload(user),
 		"roles":         roles,
 	}
 }
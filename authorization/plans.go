@@ -0,0 +1,379 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// PlanFree 为默认的免费套餐。
+	PlanFree = "free"
+	// PlanPro 为个人专业套餐。
+	PlanPro = "pro"
+	// PlanTeam 为团队套餐。
+	PlanTeam = "team"
+)
+
+const (
+	defaultQuotaRefillInterval = time.Hour
+	quotaRefillBatch           = 500
+)
+
+// ErrUnknownPlan 表示套餐编码不存在。
+var ErrUnknownPlan = errors.New("authorization: unknown plan")
+
+// Plan 描述订阅套餐的月度额度与功能权限，数值为 0 表示不限。
+type Plan struct {
+	Code              string `json:"code"`
+	Name              string `json:"name"`
+	MonthlyTokens     int64  `json:"monthly_tokens"`
+	MaxAgents         int    `json:"max_agents"`
+	KnowledgeMaxBytes int64  `json:"knowledge_max_bytes"`
+	PremiumModels     bool   `json:"premium_models"`
+	StreamingTTS      bool   `json:"streaming_tts"`
+}
+
+// planOrder 为套餐展示顺序。
+var planOrder = []string{PlanFree, PlanPro, PlanTeam}
+
+// defaultPlans 为内置套餐定义，可通过 PLAN_<CODE>_* 环境变量覆盖。
+var defaultPlans = map[string]Plan{
+	PlanFree: {
+		Code:              PlanFree,
+		Name:              "Free",
+		MonthlyTokens:     defaultTokenBalance,
+		MaxAgents:         3,
+		KnowledgeMaxBytes: 2 << 20,
+	},
+	PlanPro: {
+		Code:              PlanPro,
+		Name:              "Pro",
+		MonthlyTokens:     2_000_000,
+		MaxAgents:         20,
+		KnowledgeMaxBytes: 20 << 20,
+		PremiumModels:     true,
+		StreamingTTS:      true,
+	},
+	PlanTeam: {
+		Code:              PlanTeam,
+		Name:              "Team",
+		MonthlyTokens:     10_000_000,
+		MaxAgents:         0,
+		KnowledgeMaxBytes: 100 << 20,
+		PremiumModels:     true,
+		StreamingTTS:      true,
+	},
+}
+
+var (
+	plansOnce sync.Once
+	plans     map[string]Plan
+)
+
+// loadedPlans 返回合并环境变量覆盖后的套餐表。
+func loadedPlans() map[string]Plan {
+	plansOnce.Do(func() {
+		plans = make(map[string]Plan, len(defaultPlans))
+		for code, plan := range defaultPlans {
+			plans[code] = planFromEnv(plan)
+		}
+	})
+	return plans
+}
+
+// planFromEnv 读取 PLAN_<CODE>_MONTHLY_TOKENS、PLAN_<CODE>_MAX_AGENTS 与 PLAN_<CODE>_KNOWLEDGE_MB。
+func planFromEnv(plan Plan) Plan {
+	prefix := "PLAN_" + strings.ToUpper(plan.Code) + "_"
+	if value, ok := planEnvInt(prefix + "MONTHLY_TOKENS"); ok {
+		plan.MonthlyTokens = value
+	}
+	if value, ok := planEnvInt(prefix + "MAX_AGENTS"); ok {
+		plan.MaxAgents = int(value)
+	}
+	if value, ok := planEnvInt(prefix + "KNOWLEDGE_MB"); ok {
+		plan.KnowledgeMaxBytes = value << 20
+	}
+	return plan
+}
+
+// planEnvInt 解析非负整数环境变量。
+func planEnvInt(key string) (int64, bool) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < 0 {
+		log.Printf("authorization: ignore invalid %s=%q", key, raw)
+		return 0, false
+	}
+	return value, true
+}
+
+// Plans 按展示顺序返回全部套餐。
+func Plans() []Plan {
+	table := loadedPlans()
+	result := make([]Plan, 0, len(planOrder))
+	for _, code := range planOrder {
+		result = append(result, table[code])
+	}
+	return result
+}
+
+// FindPlan 按编码查找套餐。
+func FindPlan(code string) (Plan, bool) {
+	plan, ok := loadedPlans()[strings.ToLower(strings.TrimSpace(code))]
+	return plan, ok
+}
+
+// LookupPlan 按编码返回套餐，未知编码视为免费套餐。
+func LookupPlan(code string) Plan {
+	if plan, ok := FindPlan(code); ok {
+		return plan
+	}
+	return loadedPlans()[PlanFree]
+}
+
+// UserPlan 读取用户当前所属套餐，供其他模块在各自的数据库连接上查询。
+func UserPlan(ctx context.Context, db *gorm.DB, userID uint64) (Plan, error) {
+	if db == nil {
+		return Plan{}, errors.New("authorization: database not initialized")
+	}
+	var result struct {
+		Plan string
+	}
+	if err := db.WithContext(ctx).Table("users").Select("plan").Where("id = ?", userID).Take(&result).Error; err != nil {
+		return Plan{}, err
+	}
+	return LookupPlan(result.Plan), nil
+}
+
+// quotaPeriodStart 返回额度周期（自然月，UTC）的起始时间。
+func quotaPeriodStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// nextQuotaRefill 返回下一次额度刷新的时间。
+func nextQuotaRefill(refilledAt *time.Time, now time.Time) time.Time {
+	if refilledAt == nil || refilledAt.Before(quotaPeriodStart(now)) {
+		return now.UTC()
+	}
+	return quotaPeriodStart(*refilledAt).AddDate(0, 1, 0)
+}
+
+// buildPlanPayload 组装资料接口中的套餐信息。
+func buildPlanPayload(user *User) gin.H {
+	plan := LookupPlan(user.Plan)
+	payload := gin.H{
+		"code":                plan.Code,
+		"name":                plan.Name,
+		"monthly_tokens":      plan.MonthlyTokens,
+		"max_agents":          plan.MaxAgents,
+		"knowledge_max_bytes": plan.KnowledgeMaxBytes,
+		"premium_models":      plan.PremiumModels,
+		"streaming_tts":       plan.StreamingTTS,
+		"quota_refilled_at":   user.QuotaRefilledAt,
+	}
+	if user.Status != guestStatus && user.Status != StatusChannel {
+		payload["next_refill_at"] = nextQuotaRefill(user.QuotaRefilledAt, time.Now())
+	}
+	return payload
+}
+
+// topUpExpr 将余额补足到套餐额度，已购买的超额部分保留。
+func topUpExpr(quota int64) clause.Expr {
+	return gorm.Expr("CASE WHEN token_balance < ? THEN ? ELSE token_balance END", quota, quota)
+}
+
+// SetPlan 变更用户套餐并立即按新套餐补足本周期额度。
+func (s *UserStore) SetPlan(ctx context.Context, userID uint, code string) (*User, error) {
+	if s == nil {
+		return nil, errors.New("authorization: user store not initialized")
+	}
+	plan, ok := FindPlan(code)
+	if !ok {
+		return nil, ErrUnknownPlan
+	}
+
+	now := time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND status NOT IN ?", userID, quotaExemptStatuses).
+		Updates(map[string]any{
+			"plan":              plan.Code,
+			"token_balance":     topUpExpr(plan.MonthlyTokens),
+			"quota_refilled_at": now,
+			"updated_at":        now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if s.cache != nil {
+		s.cache.invalidateUser(ctx, userID)
+	}
+	return s.FindByID(ctx, userID)
+}
+
+// RefillQuotas 为进入新周期的用户补足套餐额度，返回处理的用户数。
+func (s *UserStore) RefillQuotas(ctx context.Context, now time.Time) (int, error) {
+	if s == nil {
+		return 0, errors.New("authorization: user store not initialized")
+	}
+	periodStart := quotaPeriodStart(now)
+	refilled := 0
+
+	for _, plan := range Plans() {
+		for {
+			var ids []uint
+			err := s.db.WithContext(ctx).Model(&User{}).
+				Where("plan = ? AND status NOT IN ?", plan.Code, quotaExemptStatuses).
+				Where("quota_refilled_at IS NULL OR quota_refilled_at < ?", periodStart).
+				Limit(quotaRefillBatch).
+				Pluck("id", &ids).Error
+			if err != nil {
+				return refilled, err
+			}
+			if len(ids) == 0 {
+				break
+			}
+
+			err = s.db.WithContext(ctx).Model(&User{}).
+				Where("id IN ?", ids).
+				Updates(map[string]any{
+					"token_balance":     topUpExpr(plan.MonthlyTokens),
+					"quota_refilled_at": now.UTC(),
+					"updated_at":        now.UTC(),
+				}).Error
+			if err != nil {
+				return refilled, err
+			}
+			if s.cache != nil {
+				for _, id := range ids {
+					s.cache.invalidateUser(ctx, id)
+				}
+			}
+			refilled += len(ids)
+			if len(ids) < quotaRefillBatch {
+				break
+			}
+		}
+	}
+	return refilled, nil
+}
+
+// startQuotaRefiller 在后台定期刷新套餐额度，启动时立即执行一次。
+func (s *UserStore) startQuotaRefiller() {
+	interval := defaultQuotaRefillInterval
+	if value, ok := planEnvInt("PLAN_REFILL_INTERVAL_MINUTES"); ok && value > 0 {
+		interval = time.Duration(value) * time.Minute
+	}
+
+	refill := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		count, err := s.RefillQuotas(ctx, time.Now())
+		if err != nil {
+			log.Printf("authorization: refill plan quotas failed: %v", err)
+			return
+		}
+		if count > 0 {
+			log.Printf("authorization: refilled plan quotas for %d users", count)
+		}
+	}
+
+	go func() {
+		refill()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			refill()
+		}
+	}()
+}
+
+// setPlanRequest 描述管理员变更用户套餐的请求。
+type setPlanRequest struct {
+	Plan string `json:"plan" binding:"required"`
+}
+
+// handleListPlans godoc
+// @Summary 查询订阅套餐
+// @Description 返回全部订阅套餐及其月度额度与功能权限
+// @Tags Authorization
+// @Produce json
+// @Success 200 {object} map[string]interface{} "套餐列表"
+// @Author bizer
+// handleListPlans 返回可选的订阅套餐。
+func (m *Module) handleListPlans(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"plans": Plans()})
+}
+
+// handleSetUserPlan godoc
+// @Summary 变更用户套餐
+// @Description 管理员为指定用户切换订阅套餐，并立即按新套餐补足本月额度
+// @Tags Authorization
+// @Accept json
+// @Produce json
+// @Param id path int true "用户 ID"
+// @Param request body setPlanRequest true "目标套餐"
+// @Success 200 {object} map[string]interface{} "更新后的用户资料"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未授权"
+// @Failure 404 {object} map[string]string "未找到"
+// @Author bizer
+// handleSetUserPlan 变更用户的订阅套餐。
+func (m *Module) handleSetUserPlan(c *gin.Context) {
+	if m == nil || m.userStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "user service unavailable"})
+		return
+	}
+
+	userID, err := strconv.ParseUint(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req setPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := m.userStore.SetPlan(ctx, uint(userID), req.Plan)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownPlan):
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrUnknownPlan.Error()})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update plan", "details": err.Error()})
+		}
+		return
+	}
+
+	roles, err := m.userStore.FindRoleNames(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": buildUserPayload(ctx, m.avatarStorage, user, roles)})
+}
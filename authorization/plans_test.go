@@ -0,0 +1,202 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestUserStore(t *testing.T) *UserStore {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&User{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return &UserStore{db: db}
+}
+
+func createTestUser(t *testing.T, store *UserStore, plan, status string, balance int64, refilledAt *time.Time) *User {
+	t.Helper()
+	user := &User{
+		Username:        fmt.Sprintf("%s-%s-%d", plan, status, balance),
+		Email:           fmt.Sprintf("%s-%s-%d@example.com", plan, status, balance),
+		PasswordHash:    "x",
+		Nickname:        "n",
+		Status:          status,
+		Plan:            plan,
+		TokenBalance:    balance,
+		QuotaRefilledAt: refilledAt,
+	}
+	if err := store.db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func reloadUser(t *testing.T, store *UserStore, id uint) User {
+	t.Helper()
+	var user User
+	if err := store.db.Take(&user, id).Error; err != nil {
+		t.Fatalf("reload user: %v", err)
+	}
+	return user
+}
+
+func TestDefaultPlans(t *testing.T) {
+	plans := Plans()
+	if len(plans) != 3 || plans[0].Code != PlanFree || plans[1].Code != PlanPro || plans[2].Code != PlanTeam {
+		t.Fatalf("plans = %+v, want free, pro, team", plans)
+	}
+	free, pro, team := plans[0], plans[1], plans[2]
+	if free.PremiumModels || free.StreamingTTS || free.MonthlyTokens != defaultTokenBalance || free.MaxAgents != 3 {
+		t.Errorf("free = %+v", free)
+	}
+	if !pro.PremiumModels || pro.MonthlyTokens <= free.MonthlyTokens || pro.MaxAgents <= free.MaxAgents {
+		t.Errorf("pro = %+v, want more than free", pro)
+	}
+	if team.MaxAgents != 0 || team.KnowledgeMaxBytes <= pro.KnowledgeMaxBytes {
+		t.Errorf("team = %+v, want unlimited agents", team)
+	}
+
+	if plan, ok := FindPlan(" PRO "); !ok || plan.Code != PlanPro {
+		t.Errorf("FindPlan(PRO) = %+v, %v", plan, ok)
+	}
+	if _, ok := FindPlan("enterprise"); ok {
+		t.Error("FindPlan found an unknown plan")
+	}
+	if plan := LookupPlan("enterprise"); plan.Code != PlanFree {
+		t.Errorf("LookupPlan(unknown) = %s, want free", plan.Code)
+	}
+}
+
+func TestPlanFromEnv(t *testing.T) {
+	t.Setenv("PLAN_PRO_MONTHLY_TOKENS", "5000")
+	t.Setenv("PLAN_PRO_MAX_AGENTS", "0")
+	t.Setenv("PLAN_PRO_KNOWLEDGE_MB", "3")
+	t.Setenv("PLAN_FREE_MAX_AGENTS", "-1")
+	t.Setenv("PLAN_FREE_MONTHLY_TOKENS", "lots")
+
+	pro := planFromEnv(defaultPlans[PlanPro])
+	if pro.MonthlyTokens != 5000 || pro.MaxAgents != 0 || pro.KnowledgeMaxBytes != 3<<20 || !pro.PremiumModels {
+		t.Errorf("pro = %+v, want env overrides", pro)
+	}
+	free := planFromEnv(defaultPlans[PlanFree])
+	if free != defaultPlans[PlanFree] {
+		t.Errorf("free = %+v, want invalid overrides ignored", free)
+	}
+}
+
+func TestNextQuotaRefill(t *testing.T) {
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	at := func(year int, month time.Month, day int) *time.Time {
+		value := time.Date(year, month, day, 8, 0, 0, 0, time.UTC)
+		return &value
+	}
+	tests := []struct {
+		name       string
+		refilledAt *time.Time
+		want       time.Time
+	}{
+		{"never refilled", nil, now},
+		{"previous month", at(2026, 2, 27), now},
+		{"this month", at(2026, 3, 1), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"year end", at(2025, 12, 31), now},
+	}
+	for _, tt := range tests {
+		if got := nextQuotaRefill(tt.refilledAt, now); !got.Equal(tt.want) {
+			t.Errorf("%s: next refill = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	december := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+	if got := nextQuotaRefill(&december, december); !got.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("december refill = %s, want january 1st", got)
+	}
+	// 额度周期按 UTC 自然月计算。
+	local := time.Date(2026, 4, 1, 2, 0, 0, 0, time.FixedZone("UTC+8", 8*3600))
+	if got := quotaPeriodStart(local); !got.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("period start = %s, want march in UTC", got)
+	}
+}
+
+func TestRefillQuotas(t *testing.T) {
+	store := newTestUserStore(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	lastMonth := now.AddDate(0, -1, 0)
+	thisMonth := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	free, pro := LookupPlan(PlanFree), LookupPlan(PlanPro)
+
+	neverRefilled := createTestUser(t, store, PlanFree, "active", 10, nil)
+	overQuota := createTestUser(t, store, PlanPro, "active", pro.MonthlyTokens+500, &lastMonth)
+	current := createTestUser(t, store, PlanPro, "active", 20, &thisMonth)
+	guest := createTestUser(t, store, PlanFree, guestStatus, 5, nil)
+	channel := createTestUser(t, store, PlanFree, StatusChannel, 5, &lastMonth)
+
+	count, err := store.RefillQuotas(ctx, now)
+	if err != nil {
+		t.Fatalf("refill: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("refilled = %d, want 2", count)
+	}
+
+	if user := reloadUser(t, store, neverRefilled.ID); user.TokenBalance != free.MonthlyTokens || user.QuotaRefilledAt == nil {
+		t.Errorf("never refilled = %d at %v, want topped up to %d", user.TokenBalance, user.QuotaRefilledAt, free.MonthlyTokens)
+	}
+	// 已购买的超额部分保留，只更新补充时间。
+	if user := reloadUser(t, store, overQuota.ID); user.TokenBalance != pro.MonthlyTokens+500 || !user.QuotaRefilledAt.Equal(now) {
+		t.Errorf("over quota = %d at %v, want balance kept and refilled now", user.TokenBalance, user.QuotaRefilledAt)
+	}
+	if user := reloadUser(t, store, current.ID); user.TokenBalance != 20 {
+		t.Errorf("refilled this month = %d, want untouched", user.TokenBalance)
+	}
+	for _, exempt := range []*User{guest, channel} {
+		if user := reloadUser(t, store, exempt.ID); user.TokenBalance != 5 {
+			t.Errorf("%s user balance = %d, want exempt", exempt.Status, user.TokenBalance)
+		}
+	}
+
+	if count, err := store.RefillQuotas(ctx, now.Add(time.Hour)); err != nil || count != 0 {
+		t.Errorf("second refill = %d, %v, want nothing to do", count, err)
+	}
+	if count, err := store.RefillQuotas(ctx, now.AddDate(0, 1, 0)); err != nil || count != 3 {
+		t.Errorf("next month refill = %d, %v, want all active users", count, err)
+	}
+}
+
+func TestSetPlan(t *testing.T) {
+	store := newTestUserStore(t)
+	ctx := context.Background()
+	user := createTestUser(t, store, PlanFree, "active", 10, nil)
+	guest := createTestUser(t, store, PlanFree, guestStatus, 10, nil)
+
+	updated, err := store.SetPlan(ctx, user.ID, " Team ")
+	if err != nil {
+		t.Fatalf("set plan: %v", err)
+	}
+	if team := LookupPlan(PlanTeam); updated.Plan != PlanTeam || updated.TokenBalance != team.MonthlyTokens || updated.QuotaRefilledAt == nil {
+		t.Errorf("user = %+v, want team with a full quota", updated)
+	}
+	if _, err := store.SetPlan(ctx, user.ID, "enterprise"); !errors.Is(err, ErrUnknownPlan) {
+		t.Errorf("unknown plan err = %v", err)
+	}
+	if _, err := store.SetPlan(ctx, guest.ID, PlanPro); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("guest err = %v, want not found", err)
+	}
+}
@@ -0,0 +1,194 @@
+package knowledge
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// bpeTokenizer 按 tiktoken 格式的合并词表对文本做字节级 BPE 编码，预分词规则与 cl100k_base 一致。
+type bpeTokenizer struct {
+	ranks map[string]int
+}
+
+// defaultTokenizer 在首次使用时加载 KNOWLEDGE_TOKENIZER_RANKS 指定的词表，未配置或加载失败时为 nil。
+var defaultTokenizer = sync.OnceValue(func() *bpeTokenizer {
+	path := getEnvDefault("KNOWLEDGE_TOKENIZER_RANKS", "")
+	if path == "" {
+		return nil
+	}
+	tokenizer, err := loadBPETokenizer(path)
+	if err != nil {
+		log.Printf("knowledge: load tokenizer ranks failed, falling back to estimation: %v", err)
+		return nil
+	}
+	return tokenizer
+})
+
+// CountTokens 使用配置的 BPE 词表计算文本的 token 数，未配置词表时回退为 EstimateTokens。
+func CountTokens(text string) int {
+	if tokenizer := defaultTokenizer(); tokenizer != nil {
+		return tokenizer.count(text)
+	}
+	return EstimateTokens(text)
+}
+
+// loadBPETokenizer 读取 tiktoken 词表文件，每行为 base64 编码的字节序列与其合并优先级。
+func loadBPETokenizer(path string) (*bpeTokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("knowledge: invalid tokenizer ranks at line %d", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("knowledge: invalid tokenizer token at line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("knowledge: invalid tokenizer rank at line %d: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("knowledge: tokenizer ranks file %s is empty", path)
+	}
+	return &bpeTokenizer{ranks: ranks}, nil
+}
+
+// count 返回文本编码后的 token 数。
+func (t *bpeTokenizer) count(text string) int {
+	total := 0
+	for _, piece := range pretokenize(text) {
+		total += t.pieceTokens([]byte(piece))
+	}
+	return total
+}
+
+// pieceTokens 对单个预分词片段反复合并优先级最高（rank 最小）的相邻字节对，返回剩余的片段数。
+// 词表中缺失的单字节各计 1 个 token。
+func (t *bpeTokenizer) pieceTokens(piece []byte) int {
+	if _, ok := t.ranks[string(piece)]; ok {
+		return 1
+	}
+	// bounds[i] 为第 i 个片段的起始字节，末尾附加 len(piece)。
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			rank, ok := t.ranks[string(piece[bounds[i]:bounds[i+2]])]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// pretokenize 按 cl100k_base 的正则规则拆分文本：英文缩写、可带一个前缀符号的字母串、至多三位的数字组、
+// 可带前导空格的标点串、以换行结尾的空白，以及其余空白（后接非空白时留出最后一个空白给下一片段）。
+func pretokenize(text string) []string {
+	runes := []rune(text)
+	var pieces []string
+	for i := 0; i < len(runes); {
+		n := matchPiece(runes, i)
+		pieces = append(pieces, string(runes[i:i+n]))
+		i += n
+	}
+	return pieces
+}
+
+// matchPiece 返回从 i 开始的预分词片段长度，依次尝试 cl100k_base 正则的各个分支。
+func matchPiece(runes []rune, i int) int {
+	r := runes[i]
+	if r == '\'' {
+		if n := bpeContraction(runes[i+1:]); n > 0 {
+			return 1 + n
+		}
+	}
+	if j := i; unicode.IsLetter(r) || (!isLineBreak(r) && !unicode.IsNumber(r) && i+1 < len(runes) && unicode.IsLetter(runes[i+1])) {
+		j++
+		for j < len(runes) && unicode.IsLetter(runes[j]) {
+			j++
+		}
+		return j - i
+	}
+	if unicode.IsNumber(r) {
+		j := i
+		for j < len(runes) && j-i < 3 && unicode.IsNumber(runes[j]) {
+			j++
+		}
+		return j - i
+	}
+	if j := i; isSymbol(r) || (r == ' ' && i+1 < len(runes) && isSymbol(runes[i+1])) {
+		if r == ' ' {
+			j++
+		}
+		for j < len(runes) && isSymbol(runes[j]) {
+			j++
+		}
+		for j < len(runes) && isLineBreak(runes[j]) {
+			j++
+		}
+		return j - i
+	}
+	end := skipSpaces(runes, i)
+	for k := end - 1; k >= i; k-- {
+		if isLineBreak(runes[k]) {
+			return k + 1 - i
+		}
+	}
+	if end < len(runes) && end-i > 1 {
+		return end - 1 - i
+	}
+	return max(end-i, 1)
+}
+
+// bpeContraction 按 cl100k_base 的分支顺序匹配撇号后的缩写后缀，不要求其后为词尾。
+func bpeContraction(rest []rune) int {
+	for _, suffix := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+		if n := len(suffix); len(rest) >= n && strings.EqualFold(string(rest[:n]), suffix) {
+			return n
+		}
+	}
+	return 0
+}
+
+// isSymbol 判断字符是否既非空白也非字母数字。
+func isSymbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isLineBreak 判断是否为回车或换行。
+func isLineBreak(r rune) bool {
+	return r == '\r' || r == '\n'
+}
@@ -0,0 +1,93 @@
+package knowledge
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRanks 将词表按 tiktoken 格式写入临时文件并返回路径。
+func writeRanks(t *testing.T, ranks map[string]int) string {
+	t.Helper()
+	var b strings.Builder
+	for token, rank := range ranks {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	path := filepath.Join(t.TempDir(), "ranks.tiktoken")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatalf("write ranks: %v", err)
+	}
+	return path
+}
+
+func TestPretokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello world's 12345 \n\n  end", []string{"Hello", " world", "'s", " ", "123", "45", " \n\n", " ", " end"}},
+		{"don'T stop", []string{"don", "'T", " stop"}},
+		{"'store", []string{"'s", "tore"}},
+		{"a  b", []string{"a", " ", " b"}},
+		{"x:\n\ny", []string{"x", ":\n\n", "y"}},
+		{"tail   ", []string{"tail", "   "}},
+		{"你好，世界！", []string{"你好", "，世界", "！"}},
+		{"(see) 3.14", []string{"(see", ")", " ", "3", ".", "14"}},
+	}
+	for _, tt := range tests {
+		if got := pretokenize(tt.text); !equalStrings(got, tt.want) {
+			t.Errorf("pretokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBPETokenizerCount(t *testing.T) {
+	path := writeRanks(t, map[string]int{
+		"h": 1, "e": 2, "l": 3, "o": 4, " ": 5, "w": 6, "r": 7, "d": 8, "s": 9,
+		"ll": 10, "he": 11, "hell": 12, "hello": 13, " w": 14, "or": 15, " wor": 16,
+	})
+	tokenizer, err := loadBPETokenizer(path)
+	if err != nil {
+		t.Fatalf("load ranks: %v", err)
+	}
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},
+		// ll 的优先级高于 he，依次合并为 hell、hello，剩余 s。
+		{"hellos", 2},
+		{" world", 3},
+		{"hellos world", 5},
+		// 词表中没有的字节各计 1 个 token。
+		{"xyz", 3},
+	}
+	for _, tt := range tests {
+		if got := tokenizer.count(tt.text); got != tt.want {
+			t.Errorf("count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLoadBPETokenizerRejectsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"missing rank": "aGVsbG8=\n",
+		"bad base64":   "??? 1\n",
+		"bad rank":     "aGVsbG8= x\n",
+		"empty":        "\n",
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "_"))
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		if _, err := loadBPETokenizer(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
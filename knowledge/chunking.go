@@ -1,21 +1,73 @@
 package knowledge
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
 
-// chunkInput 代表切分后的文本片段及估算的 token 数。
+// 切分策略：fixed 按字符长度切分，sentence 按句子累积，markdown 按标题层级切分并整体保留表格与代码块。
+const (
+	ChunkStrategyFixed    = "fixed"
+	ChunkStrategySentence = "sentence"
+	ChunkStrategyMarkdown = "markdown"
+)
+
+const maxHeadingRunes = 255
+
+var (
+	blankLinePattern = regexp.MustCompile(`\n[ \t]*\n\s*`)
+	// sentenceClosers 为句末标点后仍属于本句的引号与括号。
+	sentenceClosers = "\"'”’」』）)】》"
+	// latinAbbreviations 为后接句点但不结束句子的常见缩写。
+	latinAbbreviations = map[string]struct{}{
+		"mr": {}, "mrs": {}, "ms": {}, "dr": {}, "prof": {}, "st": {}, "vs": {}, "etc": {},
+		"e.g": {}, "i.e": {}, "no": {}, "fig": {}, "jr": {}, "sr": {}, "inc": {}, "ltd": {}, "co": {},
+	}
+)
+
+// ChunkOptions 描述智能体的切分配置，零值字段沿用服务默认配置。
+type ChunkOptions struct {
+	Strategy string
+	MaxChars int
+	Overlap  *int
+}
+
+// ValidChunkStrategy 判断切分策略名称是否受支持。
+func ValidChunkStrategy(strategy string) bool {
+	switch strategy {
+	case ChunkStrategyFixed, ChunkStrategySentence, ChunkStrategyMarkdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// chunkInput 代表切分后的文本片段及 token 数，可附带所属标题路径与页码。
 type chunkInput struct {
 	Text       string
 	TokenCount int
+	Heading    string
+	Page       int
+}
+
+// chunkUnit 为累积切片时的最小单元：句子、表格或代码块。
+type chunkUnit struct {
+	text      string
+	paragraph bool // 单元位于段落开头，与前一单元以空行连接
+	atomic    bool // 表格或代码块，不参与重叠
 }
 
-// chunker 控制文本切分的最大最小长度。
+// chunker 控制文本切分的策略、长度与相邻切片的重叠字符数。
 type chunker struct {
+	strategy string
 	maxChars int
 	minChars int
+	overlap  int
 }
 
 // newChunker 构造 chunker 并校正边界参数。
-func newChunker(maxChars int, minChars int) *chunker {
+func newChunker(strategy string, maxChars int, minChars int, overlap int) *chunker {
 	if maxChars <= 0 {
 		maxChars = 800
 	}
@@ -25,64 +77,530 @@ func newChunker(maxChars int, minChars int) *chunker {
 			minChars = 200
 		}
 	}
-	return &chunker{maxChars: maxChars, minChars: minChars}
+	if !ValidChunkStrategy(strategy) {
+		strategy = ChunkStrategyFixed
+	}
+	overlap = min(max(overlap, 0), maxChars/2)
+	return &chunker{strategy: strategy, maxChars: maxChars, minChars: minChars, overlap: overlap}
 }
 
-// split 将长文本按指定规则切分成多个片段。
-func (c *chunker) split(text string) []chunkInput {
-	cleaned := strings.TrimSpace(normalizeNewlines(text))
-	if cleaned == "" {
-		return nil
+// withOptions 返回应用智能体切分配置后的 chunker，未设置的字段沿用当前值。
+func (c *chunker) withOptions(opts *ChunkOptions) *chunker {
+	if opts == nil {
+		return c
+	}
+	strategy, maxChars, minChars, overlap := c.strategy, c.maxChars, c.minChars, c.overlap
+	if opts.Strategy != "" {
+		strategy = opts.Strategy
+	}
+	if opts.MaxChars > 0 && opts.MaxChars != maxChars {
+		maxChars = opts.MaxChars
+		minChars = maxChars / 2
 	}
+	if opts.Overlap != nil {
+		overlap = *opts.Overlap
+	}
+	return newChunker(strategy, maxChars, minChars, overlap)
+}
 
-	runes := []rune(cleaned)
-	total := len(runes)
-	if total == 0 {
-		return nil
+// segment 按文件段落或正文切分文档。
+func (c *chunker) segment(content string, sections []Section) []chunkInput {
+	if len(sections) > 0 {
+		if segments := c.splitSections(sections); len(segments) > 0 {
+			return segments
+		}
 	}
+	return c.split(content)
+}
 
-	maxChars := c.maxChars
-	minChars := c.minChars
-	if maxChars <= 0 {
-		maxChars = 800
+// split 按配置的策略切分文本。
+func (c *chunker) split(text string) []chunkInput {
+	switch c.strategy {
+	case ChunkStrategySentence:
+		return c.splitSentences(text)
+	case ChunkStrategyMarkdown:
+		return c.splitMarkdown(text)
+	default:
+		return c.splitFixed(text)
 	}
-	if minChars <= 0 || minChars >= maxChars {
-		minChars = maxChars / 2
-		if minChars < 200 {
-			minChars = 200
+}
+
+// splitFixed 按最大长度切分，优先在段落或句末处断开，相邻切片重叠 overlap 个字符。
+func (c *chunker) splitFixed(text string) []chunkInput {
+	var segments []chunkInput
+	for _, window := range c.windows(strings.TrimSpace(normalizeNewlines(text)), c.overlap) {
+		if chunkText := strings.TrimSpace(window); chunkText != "" {
+			segments = append(segments, newChunkInput(chunkText, ""))
 		}
 	}
+	return segments
+}
+
+// windows 将文本切成不超过 maxChars 的原始窗口，overlap 大于 0 时下一窗口从上一窗口末尾附近的句首或词首开始。
+func (c *chunker) windows(text string, overlap int) []string {
+	runes := []rune(text)
+	total := len(runes)
+	if total == 0 {
+		return nil
+	}
 
-	segments := make([]chunkInput, 0, (total/maxChars)+1)
+	windows := make([]string, 0, (total/c.maxChars)+1)
 	start := 0
 	for start < total {
-		end := start + maxChars
+		end := start + c.maxChars
 		if end >= total {
 			end = total
 		} else {
-			preferred := findBoundary(runes, start+minChars, end)
-			if preferred > start+minChars {
+			preferred := findBoundary(runes, start+c.minChars, end)
+			if preferred > start+c.minChars {
 				end = preferred
 			}
 		}
-		chunkText := strings.TrimSpace(string(runes[start:end]))
-		if chunkText != "" {
-			segments = append(segments, chunkInput{
-				Text:       chunkText,
-				TokenCount: estimateTokenCount(chunkText),
-			})
-		}
-		if end == start {
-			end = start + maxChars
-			if end > total {
-				end = total
+		windows = append(windows, string(runes[start:end]))
+		if end >= total {
+			break
+		}
+		next := end
+		if overlap > 0 {
+			if candidate := overlapStart(runes, end-overlap, end); candidate > start {
+				next = candidate
 			}
 		}
-		start = end
+		start = next
+	}
+	return windows
+}
+
+// overlapStart 在 [from, to) 内寻找重叠部分的起点：优先句首，其次词首，汉字文本可直接从 from 开始，找不到时返回 to。
+func overlapStart(runes []rune, from int, to int) int {
+	from = max(from, 1)
+	for i := from; i < to; i++ {
+		if isSentenceTerminator(runes[i-1]) && !isSentenceTerminator(runes[i]) {
+			return skipSpaces(runes, i)
+		}
+	}
+	for i := from; i < to; i++ {
+		if unicode.IsSpace(runes[i-1]) && !unicode.IsSpace(runes[i]) {
+			return i
+		}
+	}
+	if from < to && isCJKRune(runes[from]) {
+		return from
+	}
+	return to
+}
+
+// splitSentences 按段落与句子边界累积切片，过长的句子按长度拆分。
+func (c *chunker) splitSentences(text string) []chunkInput {
+	var units []chunkUnit
+	for _, paragraph := range splitParagraphs(text) {
+		units = append(units, c.sentenceUnits(paragraph)...)
+	}
+	return c.pack(units, "")
+}
+
+// splitMarkdown 按 ATX 与 Setext 标题拆分 Markdown 文本，切片不跨越标题，标题路径写入 Heading；
+// 表格与围栏代码块作为整体保留，超长时表格按行拆分并重复表头，代码块按行拆分并补全围栏。
+func (c *chunker) splitMarkdown(text string) []chunkInput {
+	lines := strings.Split(strings.TrimSpace(normalizeNewlines(text)), "\n")
+	var (
+		segments  []chunkInput
+		trail     headingTrail
+		heading   string
+		units     []chunkUnit
+		paragraph []string
+	)
+	flushParagraph := func() {
+		if body := strings.TrimSpace(strings.Join(paragraph, "\n")); body != "" {
+			units = append(units, c.sentenceUnits(body)...)
+		}
+		paragraph = nil
+	}
+	startSection := func(level int, title string) {
+		flushParagraph()
+		segments = append(segments, c.pack(units, heading)...)
+		units = nil
+		trail.push(level, stripInlineMarkdown(strings.TrimSpace(title)))
+		heading = truncateRunes(trail.String(), maxHeadingRunes)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flushParagraph()
+			fence := trimmed[:3]
+			block := []string{line}
+			for i+1 < len(lines) {
+				i++
+				block = append(block, lines[i])
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+			}
+			units = append(units, c.codeUnits(block, fence)...)
+		case isTableLine(trimmed):
+			flushParagraph()
+			block := []string{line}
+			for i+1 < len(lines) && isTableLine(strings.TrimSpace(lines[i+1])) {
+				i++
+				block = append(block, lines[i])
+			}
+			units = append(units, c.tableUnits(block)...)
+		case trimmed == "":
+			flushParagraph()
+		default:
+			if match := atxHeadingPattern.FindStringSubmatch(trimmed); match != nil && strings.TrimSpace(match[2]) != "" {
+				startSection(len(match[1]), match[2])
+				continue
+			}
+			if len(paragraph) == 0 && i+1 < len(lines) {
+				if match := setextLinePattern.FindStringSubmatch(strings.TrimSpace(lines[i+1])); match != nil {
+					level := 2
+					if strings.HasPrefix(match[1], "=") {
+						level = 1
+					}
+					startSection(level, trimmed)
+					i++
+					continue
+				}
+			}
+			paragraph = append(paragraph, line)
+		}
+	}
+	flushParagraph()
+	return append(segments, c.pack(units, heading)...)
+}
+
+// splitSections 按段落切分文本，合并同页的短小段落并保留标题与页码。
+func (c *chunker) splitSections(sections []Section) []chunkInput {
+	var (
+		segments []chunkInput
+		pending  *Section
+	)
+	emit := func(section Section) {
+		for _, segment := range c.split(section.Text) {
+			segment.Heading = joinHeading(section.Heading, segment.Heading)
+			segment.Page = section.Page
+			segments = append(segments, segment)
+		}
+	}
+
+	for _, section := range sections {
+		section.Text = strings.TrimSpace(section.Text)
+		if section.Text == "" {
+			continue
+		}
+		if pending == nil {
+			current := section
+			pending = &current
+			continue
+		}
+		pendingLen := len([]rune(pending.Text))
+		samePage := pending.Page == section.Page || section.Page == 0
+		if pendingLen < c.minChars && samePage && pendingLen+len([]rune(section.Text)) <= c.maxChars {
+			pending.Text = pending.Text + "\n\n" + section.Text
+			continue
+		}
+		emit(*pending)
+		current := section
+		pending = &current
+	}
+	if pending != nil {
+		emit(*pending)
+	}
+	return segments
+}
+
+// sentenceUnits 将段落拆分为句子单元，超过 maxChars 的句子按长度继续拆分。
+func (c *chunker) sentenceUnits(paragraph string) []chunkUnit {
+	var units []chunkUnit
+	for _, sentence := range splitSentenceText(paragraph) {
+		if len([]rune(sentence)) <= c.maxChars {
+			units = append(units, chunkUnit{text: sentence})
+			continue
+		}
+		for _, piece := range c.windows(sentence, 0) {
+			units = append(units, chunkUnit{text: piece})
+		}
+	}
+	if len(units) > 0 {
+		units[0].paragraph = true
+	}
+	return units
+}
+
+// codeUnits 将围栏代码块作为整体单元，超长时按行拆分并为每段补全围栏。
+func (c *chunker) codeUnits(block []string, fence string) []chunkUnit {
+	text := strings.Join(block, "\n")
+	if len([]rune(text)) <= c.maxChars {
+		return []chunkUnit{{text: text, paragraph: true, atomic: true}}
+	}
+	opening, body := block[0], block[1:]
+	if len(body) > 0 && strings.HasPrefix(strings.TrimSpace(body[len(body)-1]), fence) {
+		body = body[:len(body)-1]
+	}
+	return c.lineUnits(body, []string{opening}, fence)
+}
+
+// tableUnits 将表格作为整体单元，超长时按行拆分并在每段重复表头与分隔行。
+func (c *chunker) tableUnits(block []string) []chunkUnit {
+	text := strings.Join(block, "\n")
+	if len([]rune(text)) <= c.maxChars {
+		return []chunkUnit{{text: text, paragraph: true, atomic: true}}
+	}
+	header, rows := block[:1], block[1:]
+	if len(rows) > 0 && isTableSeparator(strings.TrimSpace(rows[0])) {
+		header, rows = block[:2], block[2:]
+	}
+	return c.lineUnits(rows, header, "")
+}
+
+// lineUnits 按行累积不超过 maxChars 的原子单元，每个单元以 prefix 开头、以 suffix 结尾（非空时）。
+func (c *chunker) lineUnits(lines []string, prefix []string, suffix string) []chunkUnit {
+	var (
+		units   []chunkUnit
+		current []string
+	)
+	overhead := len([]rune(strings.Join(prefix, "\n"))) + len([]rune(suffix)) + 2
+	size := overhead
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		parts := append(append([]string{}, prefix...), current...)
+		if suffix != "" {
+			parts = append(parts, suffix)
+		}
+		units = append(units, chunkUnit{text: strings.Join(parts, "\n"), paragraph: true, atomic: true})
+		current, size = nil, overhead
+	}
+	for _, line := range lines {
+		pieces := []string{line}
+		if overhead+len([]rune(line)) > c.maxChars {
+			pieces = c.windows(line, 0)
+		}
+		for _, piece := range pieces {
+			length := len([]rune(piece)) + 1
+			if len(current) > 0 && size+length > c.maxChars {
+				flush()
+			}
+			current = append(current, piece)
+			size += length
+		}
+	}
+	flush()
+	return units
+}
+
+// pack 将单元累积为不超过 maxChars 的切片，段落开头处已达到 minChars 时提前切分；
+// 新切片以上一切片末尾不超过 overlap 个字符的句子开头，表格与代码块不参与重叠。
+func (c *chunker) pack(units []chunkUnit, heading string) []chunkInput {
+	var (
+		segments []chunkInput
+		current  []chunkUnit
+		size     int
+		carried  int
+	)
+	flush := func() {
+		if text := joinUnits(current); text != "" {
+			segments = append(segments, newChunkInput(text, heading))
+		}
+		current = c.overlapTail(current)
+		carried = len(current)
+		size = unitsSize(current)
+	}
+	for _, unit := range units {
+		length := unitSize(unit)
+		if len(current) > carried && (size+length > c.maxChars || (unit.paragraph && size >= c.minChars)) {
+			flush()
+		}
+		for carried > 0 && size+length > c.maxChars {
+			size -= unitSize(current[0])
+			current = current[1:]
+			carried--
+		}
+		current = append(current, unit)
+		size += length
+	}
+	if len(current) > carried {
+		if text := joinUnits(current); text != "" {
+			segments = append(segments, newChunkInput(text, heading))
+		}
 	}
 	return segments
 }
 
+// overlapTail 返回切片末尾总长不超过 overlap 的连续句子单元，用作下一切片的开头。
+func (c *chunker) overlapTail(units []chunkUnit) []chunkUnit {
+	if c.overlap <= 0 {
+		return nil
+	}
+	start, size := len(units), 0
+	for start > 1 {
+		unit := units[start-1]
+		if unit.atomic || size+unitSize(unit) > c.overlap {
+			break
+		}
+		size += unitSize(unit)
+		start--
+	}
+	if start == len(units) {
+		return nil
+	}
+	return append([]chunkUnit(nil), units[start:]...)
+}
+
+// joinUnits 拼接单元，段落之间以空行分隔。
+func joinUnits(units []chunkUnit) string {
+	var b strings.Builder
+	for i, unit := range units {
+		if i > 0 && unit.paragraph {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(unit.text)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// unitSize 返回单元拼接后占用的字符数。
+func unitSize(unit chunkUnit) int {
+	size := len([]rune(unit.text))
+	if unit.paragraph {
+		size += 2
+	}
+	return size
+}
+
+// unitsSize 返回多个单元拼接后占用的字符数。
+func unitsSize(units []chunkUnit) int {
+	total := 0
+	for _, unit := range units {
+		total += unitSize(unit)
+	}
+	return total
+}
+
+// newChunkInput 构造切片并计算 token 数。
+func newChunkInput(text string, heading string) chunkInput {
+	return chunkInput{Text: text, TokenCount: CountTokens(text), Heading: heading}
+}
+
+// joinHeading 将段落标题与切片内的标题路径拼接为完整路径。
+func joinHeading(parent string, child string) string {
+	switch {
+	case child == "":
+		return parent
+	case parent == "":
+		return child
+	default:
+		return truncateRunes(parent+" > "+child, maxHeadingRunes)
+	}
+}
+
+// splitParagraphs 按空行拆分段落。
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, paragraph := range blankLinePattern.Split(strings.TrimSpace(normalizeNewlines(text)), -1) {
+		if trimmed := strings.TrimSpace(paragraph); trimmed != "" {
+			paragraphs = append(paragraphs, trimmed)
+		}
+	}
+	return paragraphs
+}
+
+// splitSentenceText 按中英文句末标点与换行拆分句子，句子保留其后的空白以便原样拼接。
+// 英文句点仅在其后为空白时视为句末，并跳过小数、常见缩写与姓名首字母。
+func splitSentenceText(text string) []string {
+	runes := []rune(text)
+	var sentences []string
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		end := -1
+		switch {
+		case r == '\n':
+			end = i + 1
+		case isCJKTerminator(r):
+			end = skipClosers(runes, i+1)
+		case r == '.' || r == '!' || r == '?':
+			next := skipClosers(runes, i+1)
+			if next < len(runes) && !unicode.IsSpace(runes[next]) {
+				continue
+			}
+			if r == '.' && isAbbreviation(runes[start:i]) {
+				continue
+			}
+			end = next
+		}
+		if end < 0 {
+			continue
+		}
+		end = skipSpaces(runes, end)
+		sentences = append(sentences, string(runes[start:end]))
+		start = end
+		i = end - 1
+	}
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
+
+// skipClosers 跳过句末标点之后连续的句末标点、引号与括号。
+func skipClosers(runes []rune, i int) int {
+	for i < len(runes) && (isSentenceTerminator(runes[i]) || strings.ContainsRune(sentenceClosers, runes[i])) {
+		i++
+	}
+	return i
+}
+
+// skipSpaces 跳过连续空白。
+func skipSpaces(runes []rune, i int) int {
+	for i < len(runes) && unicode.IsSpace(runes[i]) {
+		i++
+	}
+	return i
+}
+
+// isAbbreviation 判断句点前的单词是否为缩写或首字母。
+func isAbbreviation(before []rune) bool {
+	start := len(before)
+	for start > 0 && !unicode.IsSpace(before[start-1]) {
+		start--
+	}
+	word := strings.ToLower(strings.TrimLeft(string(before[start:]), "([\"'"))
+	if word == "" {
+		return false
+	}
+	if runes := []rune(word); len(runes) == 1 && unicode.IsLetter(runes[0]) {
+		return true
+	}
+	_, ok := latinAbbreviations[word]
+	return ok
+}
+
+// isCJKTerminator 判断是否为中日文句末标点。
+func isCJKTerminator(r rune) bool {
+	return strings.ContainsRune("。！？；…", r)
+}
+
+// isSentenceTerminator 判断是否为中英文句末标点。
+func isSentenceTerminator(r rune) bool {
+	return isCJKTerminator(r) || r == '.' || r == '!' || r == '?'
+}
+
+// isTableLine 判断是否为 Markdown 表格行。
+func isTableLine(line string) bool {
+	return strings.HasPrefix(line, "|") && strings.Count(line, "|") >= 2
+}
+
+// isTableSeparator 判断是否为表头下方的分隔行。
+func isTableSeparator(line string) bool {
+	return isTableLine(line) && strings.Trim(line, "|-: \t") == ""
+}
+
 // normalizeNewlines 统一文本中的换行符。
 func normalizeNewlines(value string) string {
 	if value == "" {
@@ -104,6 +622,12 @@ func findBoundary(runes []rune, min int, max int) int {
 	if max <= min {
 		return min
 	}
+	// 优先在段落之间切分，使切分位置随内容而非偏移量确定，局部修改不会改变其他段落的切片
+	for i := max - 1; i > min; i-- {
+		if runes[i] == '\n' && runes[i-1] == '\n' {
+			return i + 1
+		}
+	}
 	boundaryChars := []rune{'\n', '。', '！', '？', '.', '!', '?'}
 	boundarySet := make(map[rune]struct{}, len(boundaryChars))
 	for _, ch := range boundaryChars {
@@ -116,22 +640,3 @@ func findBoundary(runes []rune, min int, max int) int {
 	}
 	return max
 }
-
-// estimateTokenCount 估算文本对应的大模型 token 数。
-func estimateTokenCount(text string) int {
-	trimmed := strings.TrimSpace(text)
-	if trimmed == "" {
-		return 0
-	}
-	words := strings.Fields(trimmed)
-	wordCount := len(words)
-	runeCount := len([]rune(trimmed))
-	estimate := wordCount + runeCount/3
-	if estimate < wordCount {
-		estimate = wordCount
-	}
-	if estimate <= 0 {
-		estimate = runeCount/2 + 1
-	}
-	return estimate
-}
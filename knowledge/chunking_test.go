@@ -0,0 +1,171 @@
+package knowledge
+
+import (
+	"strings"
+	"testing"
+)
+
+func chunkTexts(chunks []chunkInput) []string {
+	texts := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Text)
+	}
+	return texts
+}
+
+func TestSplitSentenceText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"latin", "Hello world. This is Dr. Smith! Ok?", []string{"Hello world. ", "This is Dr. Smith! ", "Ok?"}},
+		{"initials", "J. R. R. Tolkien wrote it. Yes.", []string{"J. R. R. Tolkien wrote it. ", "Yes."}},
+		{"abbreviation", "e.g. this works. Next", []string{"e.g. this works. ", "Next"}},
+		{"decimal", "Pi is 3.14 roughly. Done.", []string{"Pi is 3.14 roughly. ", "Done."}},
+		{"cjk", "价格是3.5元。真的吗？是的", []string{"价格是3.5元。", "真的吗？", "是的"}},
+		{"cjk closing quote", "他说：“好。”然后走了。", []string{"他说：“好。”", "然后走了。"}},
+		{"mixed", "今天发布 v2.0 版本。See the notes! 谢谢", []string{"今天发布 v2.0 版本。", "See the notes! ", "谢谢"}},
+		{"newline", "line one\nline two", []string{"line one\n", "line two"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSentenceText(tt.text); !equalStrings(got, tt.want) {
+				t.Errorf("splitSentenceText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitMarkdownHeadingPath(t *testing.T) {
+	text := "# Guide\n\nIntro text.\n\n## Install\n\nRun it.\n\n### Linux\n\nUse apt.\n\n## Usage\n\nCall it.\n\nSetext Title\n============\n\nLast part."
+	chunks := newChunker(ChunkStrategyMarkdown, 200, 100, 0).split(text)
+
+	want := []struct{ heading, text string }{
+		{"Guide", "Intro text."},
+		{"Guide > Install", "Run it."},
+		{"Guide > Install > Linux", "Use apt."},
+		{"Guide > Usage", "Call it."},
+		{"Setext Title", "Last part."},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("chunks = %+v, want %d", chunks, len(want))
+	}
+	for i, w := range want {
+		if chunks[i].Heading != w.heading || chunks[i].Text != w.text {
+			t.Errorf("chunk %d = %q under %q, want %q under %q", i, chunks[i].Text, chunks[i].Heading, w.text, w.heading)
+		}
+		if chunks[i].TokenCount <= 0 {
+			t.Errorf("chunk %d token count = %d", i, chunks[i].TokenCount)
+		}
+	}
+}
+
+func TestSplitMarkdownKeepsTablesAndCode(t *testing.T) {
+	table := "| name | value |\n| --- | --- |\n| a | 1 |\n| b | 2 |"
+	code := "```go\nfunc main() {\n\tprintln(\"hi. there\")\n}\n```"
+	text := "# Data\n\nSome intro sentence.\n\n" + table + "\n\n" + code + "\n\nOutro."
+
+	chunks := newChunker(ChunkStrategyMarkdown, 400, 200, 50).split(text)
+	if len(chunks) != 1 {
+		t.Fatalf("chunks = %q, want a single chunk", chunkTexts(chunks))
+	}
+	if !strings.Contains(chunks[0].Text, table) || !strings.Contains(chunks[0].Text, code) {
+		t.Errorf("chunk does not contain the table and code block intact: %q", chunks[0].Text)
+	}
+}
+
+func TestSplitMarkdownSplitsLongTablesAndCode(t *testing.T) {
+	header := "| id | description |\n| --- | --- |"
+	var rows []string
+	for i := 0; i < 12; i++ {
+		rows = append(rows, "| "+strings.Repeat("x", 2)+" | row with some descriptive text |")
+	}
+	table := header + "\n" + strings.Join(rows, "\n")
+
+	chunks := newChunker(ChunkStrategyMarkdown, 160, 80, 40).split(table)
+	if len(chunks) < 2 {
+		t.Fatalf("chunks = %d, want the table split into several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if !strings.HasPrefix(chunk.Text, header+"\n") {
+			t.Errorf("table chunk %d does not repeat the header: %q", i, chunk.Text)
+		}
+		if len([]rune(chunk.Text)) > 160 {
+			t.Errorf("table chunk %d exceeds max chars: %d", i, len([]rune(chunk.Text)))
+		}
+	}
+
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, "    call(step, "+strings.Repeat("arg", 3)+")")
+	}
+	code := "```python\n" + strings.Join(lines, "\n") + "\n```"
+	chunks = newChunker(ChunkStrategyMarkdown, 160, 80, 40).split(code)
+	if len(chunks) < 2 {
+		t.Fatalf("chunks = %d, want the code block split into several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if !strings.HasPrefix(chunk.Text, "```python\n") || !strings.HasSuffix(chunk.Text, "\n```") {
+			t.Errorf("code chunk %d is not fenced: %q", i, chunk.Text)
+		}
+	}
+}
+
+func TestChunkOverlapWindows(t *testing.T) {
+	var sentences []string
+	for _, word := range []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliet"} {
+		sentences = append(sentences, "The word "+word+" is here.")
+	}
+	text := strings.Join(sentences, " ")
+
+	tests := []struct {
+		name     string
+		strategy string
+	}{
+		{"fixed", ChunkStrategyFixed},
+		{"sentence", ChunkStrategySentence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := newChunker(tt.strategy, 80, 40, 30).split(text)
+			if len(chunks) < 3 {
+				t.Fatalf("chunks = %q, want several", chunkTexts(chunks))
+			}
+			for i, chunk := range chunks {
+				if len([]rune(chunk.Text)) > 80 {
+					t.Errorf("chunk %d exceeds max chars: %q", i, chunk.Text)
+				}
+				if i == 0 {
+					continue
+				}
+				// 重叠部分从句首开始，且是上一切片的结尾。
+				first := splitSentenceText(chunk.Text)[0]
+				if !strings.HasPrefix(first, "The word ") || !strings.Contains(chunks[i-1].Text, strings.TrimSpace(first)) {
+					t.Errorf("chunk %d = %q does not start with the tail of %q", i, chunk.Text, chunks[i-1].Text)
+				}
+			}
+			if last := chunks[len(chunks)-1].Text; !strings.HasSuffix(last, "juliet is here.") {
+				t.Errorf("last chunk = %q, want the end of the text", last)
+			}
+		})
+	}
+
+	without := newChunker(ChunkStrategySentence, 80, 40, 0).split(text)
+	if got := strings.Join(chunkTexts(without), " "); got != text {
+		t.Errorf("chunks without overlap = %q, want the original text", got)
+	}
+}
+
+func TestSplitCJKSentences(t *testing.T) {
+	text := strings.Repeat("这是一个用于测试的中文句子。", 6)
+	chunks := newChunker(ChunkStrategySentence, 40, 20, 0).split(text)
+	for i, chunk := range chunks {
+		if !strings.HasSuffix(chunk.Text, "。") {
+			t.Errorf("chunk %d = %q does not end at a sentence boundary", i, chunk.Text)
+		}
+	}
+	if got := strings.Join(chunkTexts(chunks), ""); got != text {
+		t.Errorf("joined chunks = %q, want the original text", got)
+	}
+}
@@ -0,0 +1,420 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// 爬取任务状态。
+const (
+	CrawlStatusIdle    = "idle"
+	CrawlStatusRunning = "running"
+	CrawlStatusFailed  = "failed"
+)
+
+const (
+	defaultCrawlMaxPages        = 50
+	defaultCrawlPageCap         = 200
+	maxCrawlDepth               = 5
+	minCrawlIntervalMinutes     = 60
+	defaultCrawlTimeout         = 30 * time.Minute
+	defaultCrawlSchedulerPeriod = time.Minute
+)
+
+var (
+	// ErrCrawlRunning 表示该抓取任务正在运行。
+	ErrCrawlRunning = errors.New("knowledge: crawl is already running")
+	// errCrawlQuota 在知识库正文超出上限时终止抓取。
+	errCrawlQuota = fmt.Errorf("knowledge: knowledge base size limit reached: %w", ErrCrawlStopped)
+)
+
+// CrawlSourceInput 描述创建抓取任务时的参数。
+type CrawlSourceInput struct {
+	URL             string   `json:"url"`
+	Mode            string   `json:"mode"`
+	MaxDepth        *int     `json:"max_depth"`
+	MaxPages        int      `json:"max_pages"`
+	AllowedDomains  []string `json:"allowed_domains"`
+	IntervalMinutes int      `json:"interval_minutes"`
+	MaxBytes        int64    `json:"-"`
+}
+
+// CreateCrawlSource 校验并保存抓取任务，不会立即运行。
+func (s *Service) CreateCrawlSource(ctx context.Context, agentID uint64, userID uint64, input CrawlSourceInput) (*CrawlSource, error) {
+	if s.db == nil {
+		return nil, errors.New("knowledge: database connection is not configured")
+	}
+	normalized, err := NormalizeCrawlURL(input.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(normalized) > 512 {
+		return nil, errors.New("knowledge: url is too long")
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(input.Mode))
+	switch mode {
+	case "":
+		mode = CrawlModePage
+	case CrawlModePage, CrawlModeSitemap:
+	default:
+		return nil, fmt.Errorf("knowledge: unsupported crawl mode %q", input.Mode)
+	}
+
+	depth := 1
+	if mode == CrawlModeSitemap {
+		depth = 0
+	}
+	if input.MaxDepth != nil {
+		depth = *input.MaxDepth
+	}
+	if depth < 0 || depth > maxCrawlDepth {
+		return nil, fmt.Errorf("knowledge: max_depth must be between 0 and %d", maxCrawlDepth)
+	}
+
+	pageCap := defaultCrawlPageCap
+	if value, ok := envPositiveInt("KNOWLEDGE_CRAWL_MAX_PAGES"); ok {
+		pageCap = value
+	}
+	maxPages := input.MaxPages
+	if maxPages <= 0 {
+		maxPages = min(defaultCrawlMaxPages, pageCap)
+	}
+	if maxPages > pageCap {
+		return nil, fmt.Errorf("knowledge: max_pages cannot exceed %d", pageCap)
+	}
+
+	interval := input.IntervalMinutes
+	if interval < 0 || (interval > 0 && interval < minCrawlIntervalMinutes) {
+		return nil, fmt.Errorf("knowledge: interval_minutes must be 0 or at least %d", minCrawlIntervalMinutes)
+	}
+
+	var domains datatypes.JSON
+	if cleaned := normalizeDomains(input.AllowedDomains); len(cleaned) > 0 {
+		raw, err := json.Marshal(cleaned)
+		if err != nil {
+			return nil, err
+		}
+		domains = datatypes.JSON(raw)
+	}
+
+	source := CrawlSource{
+		AgentID:         agentID,
+		URL:             normalized,
+		Mode:            mode,
+		MaxDepth:        depth,
+		MaxPages:        maxPages,
+		AllowedDomains:  domains,
+		IntervalMinutes: interval,
+		MaxBytes:        input.MaxBytes,
+		Status:          CrawlStatusIdle,
+		CreatedBy:       userID,
+	}
+	if err := s.db.WithContext(ctx).Create(&source).Error; err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// ListCrawlSources 列出智能体的全部抓取任务。
+func (s *Service) ListCrawlSources(ctx context.Context, agentID uint64) ([]CrawlSource, error) {
+	if s.db == nil {
+		return nil, errors.New("knowledge: database connection is not configured")
+	}
+	var sources []CrawlSource
+	if err := s.db.WithContext(ctx).
+		Where("agent_id = ?", agentID).
+		Order("created_at DESC").
+		Find(&sources).Error; err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// GetCrawlSource 获取单个抓取任务。
+func (s *Service) GetCrawlSource(ctx context.Context, agentID uint64, sourceID uint64) (*CrawlSource, error) {
+	if s.db == nil {
+		return nil, errors.New("knowledge: database connection is not configured")
+	}
+	var source CrawlSource
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND agent_id = ?", sourceID, agentID).
+		Take(&source).Error; err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// DeleteCrawlSource 删除抓取任务，已抓取的文档保留并解除关联。
+func (s *Service) DeleteCrawlSource(ctx context.Context, agentID uint64, sourceID uint64) error {
+	if s.db == nil {
+		return errors.New("knowledge: database connection is not configured")
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND agent_id = ?", sourceID, agentID).Delete(&CrawlSource{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&Document{}).
+			Where("agent_id = ? AND crawl_source_id = ?", agentID, sourceID).
+			Update("crawl_source_id", gorm.Expr("NULL")).Error
+	})
+}
+
+// SetCrawlByteLimit 更新抓取任务可写入的知识库正文上限，0 表示不限。
+func (s *Service) SetCrawlByteLimit(ctx context.Context, sourceID uint64, maxBytes int64) error {
+	if s.db == nil {
+		return errors.New("knowledge: database connection is not configured")
+	}
+	return s.db.WithContext(ctx).Model(&CrawlSource{}).
+		Where("id = ?", sourceID).
+		Update("max_bytes", maxBytes).Error
+}
+
+// StartCrawl 标记任务为运行中并在后台执行抓取；任务已在运行时返回 ErrCrawlRunning。
+func (s *Service) StartCrawl(ctx context.Context, agentID uint64, sourceID uint64) (*CrawlSource, error) {
+	source, err := s.claimCrawl(ctx, agentID, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		runCtx, cancel := context.WithTimeout(context.Background(), s.crawlTimeout())
+		defer cancel()
+		if _, err := s.executeCrawl(runCtx, source); err != nil {
+			log.Printf("knowledge: crawl source %d failed: %v", source.ID, err)
+		}
+	}()
+	return source, nil
+}
+
+// RunCrawl 同步执行一次抓取并返回统计结果。
+func (s *Service) RunCrawl(ctx context.Context, agentID uint64, sourceID uint64) (CrawlStats, error) {
+	source, err := s.claimCrawl(ctx, agentID, sourceID)
+	if err != nil {
+		return CrawlStats{}, err
+	}
+	return s.executeCrawl(ctx, source)
+}
+
+// StartCrawlScheduler 定期运行到期的抓取任务，间隔由 KNOWLEDGE_CRAWL_SCHEDULER_SECONDS 控制。
+func (s *Service) StartCrawlScheduler() {
+	if s == nil || s.db == nil || s.crawler == nil {
+		return
+	}
+	period := defaultCrawlSchedulerPeriod
+	if value, ok := envPositiveInt("KNOWLEDGE_CRAWL_SCHEDULER_SECONDS"); ok {
+		period = time.Duration(value) * time.Second
+	}
+
+	// 进程重启后遗留的 running 状态无法继续，超时后重置为 idle。
+	stale := time.Now().UTC().Add(-s.crawlTimeout())
+	if err := s.db.Model(&CrawlSource{}).
+		Where("status = ? AND (last_started_at IS NULL OR last_started_at < ?)", CrawlStatusRunning, stale).
+		Update("status", CrawlStatusIdle).Error; err != nil {
+		log.Printf("knowledge: reset stale crawls failed: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.runDueCrawls()
+		}
+	}()
+}
+
+// runDueCrawls 依次执行已到期的定时抓取任务。
+func (s *Service) runDueCrawls() {
+	var due []CrawlSource
+	if err := s.db.Model(&CrawlSource{}).
+		Where("interval_minutes > 0 AND status <> ? AND next_run_at IS NOT NULL AND next_run_at <= ?", CrawlStatusRunning, time.Now().UTC()).
+		Order("next_run_at ASC").
+		Limit(10).
+		Find(&due).Error; err != nil {
+		log.Printf("knowledge: load due crawls failed: %v", err)
+		return
+	}
+	for _, source := range due {
+		ctx, cancel := context.WithTimeout(context.Background(), s.crawlTimeout())
+		stats, err := s.RunCrawl(ctx, source.AgentID, source.ID)
+		cancel()
+		if err != nil && !errors.Is(err, ErrCrawlRunning) {
+			log.Printf("knowledge: scheduled crawl %d failed: %v", source.ID, err)
+			continue
+		}
+		if err == nil {
+			log.Printf("knowledge: scheduled crawl %d done: %d created, %d updated, %d unchanged", source.ID, stats.Created, stats.Updated, stats.Unchanged)
+		}
+	}
+}
+
+// claimCrawl 通过条件更新抢占任务，避免同一任务并发运行。
+func (s *Service) claimCrawl(ctx context.Context, agentID uint64, sourceID uint64) (*CrawlSource, error) {
+	if s.db == nil {
+		return nil, errors.New("knowledge: database connection is not configured")
+	}
+	if s.crawler == nil {
+		return nil, errors.New("knowledge: crawler is not configured")
+	}
+	now := time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&CrawlSource{}).
+		Where("id = ? AND agent_id = ? AND status <> ?", sourceID, agentID, CrawlStatusRunning).
+		Updates(map[string]interface{}{
+			"status":          CrawlStatusRunning,
+			"last_started_at": now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.GetCrawlSource(ctx, agentID, sourceID); err != nil {
+			return nil, err
+		}
+		return nil, ErrCrawlRunning
+	}
+	return s.GetCrawlSource(ctx, agentID, sourceID)
+}
+
+// executeCrawl 执行抓取并写回任务状态、统计与下次运行时间。
+func (s *Service) executeCrawl(ctx context.Context, source *CrawlSource) (CrawlStats, error) {
+	var domains []string
+	if len(source.AllowedDomains) > 0 {
+		_ = json.Unmarshal(source.AllowedDomains, &domains)
+	}
+	opts := CrawlOptions{
+		Mode:           source.Mode,
+		MaxDepth:       source.MaxDepth,
+		MaxPages:       source.MaxPages,
+		AllowedDomains: domains,
+	}
+
+	var stored CrawlStats
+	stats, err := s.crawler.Crawl(ctx, source.URL, opts, func(ctx context.Context, page CrawledPage) error {
+		return s.storeCrawledPage(ctx, source, page, &stored)
+	})
+	stats.Created = stored.Created
+	stats.Updated = stored.Updated
+	stats.Unchanged = stored.Unchanged
+
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"status":           CrawlStatusIdle,
+		"last_finished_at": now,
+		"last_error":       gorm.Expr("NULL"),
+	}
+	if raw, marshalErr := json.Marshal(stats); marshalErr == nil {
+		updates["last_stats"] = datatypes.JSON(raw)
+	}
+	if err != nil {
+		message := truncateRunes(err.Error(), 1000)
+		updates["last_error"] = message
+		if !errors.Is(err, ErrCrawlStopped) {
+			updates["status"] = CrawlStatusFailed
+		}
+	}
+	if source.IntervalMinutes > 0 {
+		updates["next_run_at"] = now.Add(time.Duration(source.IntervalMinutes) * time.Minute)
+	} else {
+		updates["next_run_at"] = gorm.Expr("NULL")
+	}
+
+	// 使用独立上下文写回状态，避免抓取超时后无法更新。
+	finishCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if updateErr := s.db.WithContext(finishCtx).Model(&CrawlSource{}).
+		Where("id = ?", source.ID).
+		Updates(updates).Error; updateErr != nil {
+		log.Printf("knowledge: update crawl source %d failed: %v", source.ID, updateErr)
+	}
+	return stats, err
+}
+
+// storeCrawledPage 按 canonical URL 新建或更新文档，内容哈希未变化时跳过向量重建。
+func (s *Service) storeCrawledPage(ctx context.Context, source *CrawlSource, page CrawledPage, stats *CrawlStats) error {
+	content := strings.TrimSpace(page.Content)
+	if content == "" {
+		return nil
+	}
+	hash := contentHash(content)
+
+	var existing Document
+	err := s.db.WithContext(ctx).
+		Where("agent_id = ? AND canonical_url = ?", source.AgentID, page.CanonicalURL).
+		Take(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := s.ensureCrawlQuota(ctx, source, 0, len(content)); err != nil {
+			return err
+		}
+		canonical := page.CanonicalURL
+		sourceLabel := truncateRunes(canonical, 255)
+		sourceID := source.ID
+		if _, err := s.CreateDocument(ctx, source.AgentID, source.CreatedBy, DocumentInput{
+			Title:         page.Title,
+			Source:        &sourceLabel,
+			Content:       content,
+			Status:        "active",
+			Sections:      page.Sections,
+			CanonicalURL:  &canonical,
+			CrawlSourceID: &sourceID,
+		}); err != nil {
+			return err
+		}
+		stats.Created++
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if existing.ContentHash == hash || (existing.ContentHash == "" && existing.Content == content) {
+		stats.Unchanged++
+		return nil
+	}
+	if err := s.ensureCrawlQuota(ctx, source, existing.ID, len(content)); err != nil {
+		return err
+	}
+	title := page.Title
+	if _, err := s.UpdateDocument(ctx, source.AgentID, existing.ID, source.CreatedBy, DocumentUpdate{
+		Title:    &title,
+		Content:  &content,
+		Sections: page.Sections,
+	}); err != nil {
+		return err
+	}
+	stats.Updated++
+	return nil
+}
+
+// ensureCrawlQuota 校验写入后知识库正文不超过任务的字节上限。
+func (s *Service) ensureCrawlQuota(ctx context.Context, source *CrawlSource, excludeDocID uint64, contentBytes int) error {
+	if source.MaxBytes <= 0 {
+		return nil
+	}
+	used, err := s.ContentBytes(ctx, source.AgentID, excludeDocID)
+	if err != nil {
+		return err
+	}
+	if used+int64(contentBytes) > source.MaxBytes {
+		return errCrawlQuota
+	}
+	return nil
+}
+
+// crawlTimeout 返回单次抓取的最长运行时间。
+func (s *Service) crawlTimeout() time.Duration {
+	if value, ok := envPositiveInt("KNOWLEDGE_CRAWL_TIMEOUT_MINUTES"); ok {
+		return time.Duration(value) * time.Minute
+	}
+	return defaultCrawlTimeout
+}
@@ -0,0 +1,590 @@
+package knowledge
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"auralis_back/netguard"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 爬取模式：page 从起始页面按链接扩展，sitemap 从站点地图读取页面列表。
+const (
+	CrawlModePage    = "page"
+	CrawlModeSitemap = "sitemap"
+)
+
+const (
+	defaultCrawlUserAgent = "AuralisBot/1.0 (+knowledge crawler)"
+	crawlMaxPageBytes     = 5 << 20
+	crawlMaxSitemapDepth  = 3
+	crawlMaxCrawlDelay    = 10 * time.Second
+)
+
+var (
+	// ErrCrawlStopped 由页面回调返回时终止本次爬取。
+	ErrCrawlStopped = errors.New("knowledge: crawl stopped")
+	// ErrBlockedAddress 表示目标地址位于内网或本机，出于安全考虑拒绝访问。
+	ErrBlockedAddress = errors.New("knowledge: crawl target resolves to a private address")
+)
+
+// CrawlOptions 控制单次爬取的范围与节奏。
+type CrawlOptions struct {
+	Mode           string
+	MaxDepth       int
+	MaxPages       int
+	AllowedDomains []string
+	Delay          time.Duration
+}
+
+// CrawledPage 表示抓取并解析成功的页面。
+type CrawledPage struct {
+	URL          string
+	CanonicalURL string
+	Title        string
+	Format       string
+	Sections     []Section
+	Content      string
+	ContentHash  string
+	Depth        int
+}
+
+// CrawlStats 汇总一次爬取的结果。
+type CrawlStats struct {
+	Fetched   int `json:"fetched"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+}
+
+// Crawler 负责抓取网页与站点地图，遵守 robots.txt 与域名、深度限制。
+type Crawler struct {
+	client    *http.Client
+	userAgent string
+	delay     time.Duration
+
+	mu     sync.Mutex
+	robots map[string]*robotsRules
+}
+
+// NewCrawlerFromEnv 基于 KNOWLEDGE_CRAWLER_* 环境变量构建爬虫。
+func NewCrawlerFromEnv() *Crawler {
+	allowPrivate := strings.EqualFold(getEnvDefault("KNOWLEDGE_CRAWLER_ALLOW_PRIVATE", "false"), "true")
+	timeout := 20 * time.Second
+	if value, ok := envPositiveInt("KNOWLEDGE_CRAWLER_TIMEOUT_SECONDS"); ok {
+		timeout = time.Duration(value) * time.Second
+	}
+	delay := 500 * time.Millisecond
+	if value, ok := envNonNegativeInt("KNOWLEDGE_CRAWLER_DELAY_MS"); ok {
+		delay = time.Duration(value) * time.Millisecond
+	}
+	return NewCrawler(getEnvDefault("KNOWLEDGE_CRAWLER_USER_AGENT", defaultCrawlUserAgent), timeout, delay, allowPrivate)
+}
+
+// NewCrawler 构造爬虫；allowPrivate 为 false 时拒绝连接内网与本机地址。
+func NewCrawler(userAgent string, timeout time.Duration, delay time.Duration, allowPrivate bool) *Crawler {
+	if strings.TrimSpace(userAgent) == "" {
+		userAgent = defaultCrawlUserAgent
+	}
+	transport := netguard.NewTransport(allowPrivate, ErrBlockedAddress)
+
+	return &Crawler{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return errors.New("too many redirects")
+				}
+				return nil
+			},
+		},
+		userAgent: userAgent,
+		delay:     delay,
+		robots:    make(map[string]*robotsRules),
+	}
+}
+
+// crawlTask 表示待抓取的 URL 及其深度。
+type crawlTask struct {
+	url   string
+	depth int
+}
+
+// Crawl 从起始地址开始抓取，每解析出一个页面调用一次 visit。
+// visit 返回 ErrCrawlStopped 时立即结束，其余错误计入失败数并继续。
+func (c *Crawler) Crawl(ctx context.Context, startURL string, opts CrawlOptions, visit func(context.Context, CrawledPage) error) (CrawlStats, error) {
+	var stats CrawlStats
+	start, err := NormalizeCrawlURL(startURL)
+	if err != nil {
+		return stats, err
+	}
+	startParsed, _ := url.Parse(start)
+
+	allowed := normalizeDomains(opts.AllowedDomains)
+	if len(allowed) == 0 {
+		allowed = []string{strings.ToLower(startParsed.Hostname())}
+	}
+	maxPages := opts.MaxPages
+	if maxPages <= 0 {
+		maxPages = 50
+	}
+	delay := opts.Delay
+	if delay <= 0 {
+		delay = c.delay
+	}
+
+	var queue []crawlTask
+	if opts.Mode == CrawlModeSitemap {
+		locs, err := c.fetchSitemap(ctx, start, 0)
+		if err != nil {
+			return stats, err
+		}
+		for _, loc := range locs {
+			queue = append(queue, crawlTask{url: loc})
+		}
+	} else {
+		queue = append(queue, crawlTask{url: start})
+	}
+
+	seen := make(map[string]struct{}, len(queue))
+	indexed := make(map[string]struct{})
+	for _, task := range queue {
+		seen[task.url] = struct{}{}
+	}
+
+	var (
+		lastFetch time.Time
+		firstErr  error
+	)
+	for len(queue) > 0 && stats.Fetched < maxPages {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		task := queue[0]
+		queue = queue[1:]
+
+		target, err := url.Parse(task.url)
+		if err != nil || !domainAllowed(target.Hostname(), allowed) {
+			stats.Skipped++
+			continue
+		}
+		rules := c.robotsFor(ctx, target)
+		if !rules.allowed(target.RequestURI()) {
+			stats.Skipped++
+			continue
+		}
+
+		wait := delay
+		if rules.crawlDelay > wait {
+			wait = min(rules.crawlDelay, crawlMaxCrawlDelay)
+		}
+		if !lastFetch.IsZero() {
+			if remaining := wait - time.Since(lastFetch); remaining > 0 {
+				select {
+				case <-ctx.Done():
+					return stats, ctx.Err()
+				case <-time.After(remaining):
+				}
+			}
+		}
+		lastFetch = time.Now()
+
+		page, links, err := c.fetchPage(ctx, task.url)
+		stats.Fetched++
+		if err != nil {
+			log.Printf("knowledge: crawl %s failed: %v", task.url, err)
+			stats.Failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if task.depth < opts.MaxDepth {
+			for _, link := range links {
+				if _, ok := seen[link]; ok {
+					continue
+				}
+				parsed, err := url.Parse(link)
+				if err != nil || !domainAllowed(parsed.Hostname(), allowed) {
+					continue
+				}
+				seen[link] = struct{}{}
+				queue = append(queue, crawlTask{url: link, depth: task.depth + 1})
+			}
+		}
+
+		if page == nil {
+			stats.Skipped++
+			continue
+		}
+		if canonical, err := url.Parse(page.CanonicalURL); err != nil || !domainAllowed(canonical.Hostname(), allowed) {
+			page.CanonicalURL = page.URL
+		}
+		if _, ok := indexed[page.CanonicalURL]; ok {
+			stats.Skipped++
+			continue
+		}
+		indexed[page.CanonicalURL] = struct{}{}
+		page.Depth = task.depth
+
+		if err := visit(ctx, *page); err != nil {
+			if errors.Is(err, ErrCrawlStopped) {
+				return stats, err
+			}
+			log.Printf("knowledge: store crawled page %s failed: %v", page.CanonicalURL, err)
+			stats.Failed++
+		}
+	}
+	// 所有页面均抓取失败时返回首个错误，便于定位起始地址不可达等问题。
+	if firstErr != nil && stats.Failed == stats.Fetched {
+		return stats, fmt.Errorf("knowledge: crawl failed: %w", firstErr)
+	}
+	return stats, nil
+}
+
+// fetchPage 抓取单个页面，返回解析结果与页面内发现的链接。
+// 页面声明 noindex 或格式不受支持时返回的 page 为 nil。
+func (c *Crawler) fetchPage(ctx context.Context, rawURL string) (*CrawledPage, []string, error) {
+	body, finalURL, contentType, err := c.get(ctx, rawURL, crawlMaxPageBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	pageURL, err := NormalizeCrawlURL(finalURL.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	filename := path.Base(finalURL.Path)
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" || (mediaType == "" && DetectFormat(filename, "", body) == FormatHTML) {
+		meta := scanHTMLMeta(finalURL, body)
+		var links []string
+		if !meta.nofollow {
+			links = meta.links
+		}
+		if meta.noindex {
+			return nil, links, nil
+		}
+		doc, err := extractHTML(body)
+		if err != nil {
+			return nil, links, err
+		}
+		page := newCrawledPage(pageURL, doc)
+		if meta.canonical != "" {
+			page.CanonicalURL = meta.canonical
+		}
+		if page.Content == "" {
+			return nil, links, nil
+		}
+		return page, links, nil
+	}
+
+	if DetectFormat(filename, mediaType, body) == "" {
+		return nil, nil, nil
+	}
+	doc, err := ExtractFile(filename, mediaType, body)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedFormat) || errors.Is(err, ErrEmptyExtraction) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	return newCrawledPage(pageURL, doc), nil, nil
+}
+
+// newCrawledPage 根据解析结果构造页面记录并计算内容哈希。
+func newCrawledPage(pageURL string, doc *ExtractedDocument) *CrawledPage {
+	content := doc.Content()
+	title := strings.TrimSpace(doc.Title)
+	if title == "" {
+		title = pageURL
+	}
+	return &CrawledPage{
+		URL:          pageURL,
+		CanonicalURL: pageURL,
+		Title:        truncateRunes(title, 200),
+		Format:       doc.Format,
+		Sections:     doc.Sections,
+		Content:      content,
+		ContentHash:  contentHash(content),
+	}
+}
+
+// get 发起 GET 请求并读取不超过 limit 字节的响应体。
+func (c *Crawler) get(ctx context.Context, rawURL string, limit int64) ([]byte, *url.URL, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,text/plain;q=0.8,*/*;q=0.5")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if int64(len(body)) > limit {
+		return nil, nil, "", fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return body, resp.Request.URL, resp.Header.Get("Content-Type"), nil
+}
+
+// robotsFor 读取并缓存站点的 robots.txt；无法获取时视为允许抓取。
+func (c *Crawler) robotsFor(ctx context.Context, target *url.URL) *robotsRules {
+	key := target.Scheme + "://" + target.Host
+	c.mu.Lock()
+	rules, ok := c.robots[key]
+	c.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	rules = &robotsRules{}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, key+"/robots.txt", nil)
+	if err == nil {
+		req.Header.Set("User-Agent", c.userAgent)
+		if resp, err := c.client.Do(req); err == nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512<<10))
+			resp.Body.Close()
+			switch {
+			case resp.StatusCode == http.StatusOK:
+				rules = parseRobots(body, c.userAgent)
+			case resp.StatusCode >= 500:
+				// 服务端错误时按全站禁止处理，避免在站点异常时继续抓取。
+				rules = parseRobots([]byte("User-agent: *\nDisallow: /"), c.userAgent)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.robots[key] = rules
+	c.mu.Unlock()
+	return rules
+}
+
+// sitemapDocument 兼容 urlset 与 sitemapindex 两种站点地图。
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// sitemapLoc 对应站点地图中的 loc 节点。
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// fetchSitemap 读取站点地图并递归展开 sitemapindex，支持 gzip 压缩。
+func (c *Crawler) fetchSitemap(ctx context.Context, rawURL string, level int) ([]string, error) {
+	if level > crawlMaxSitemapDepth {
+		return nil, nil
+	}
+	body, _, _, err := c.get(ctx, rawURL, crawlMaxPageBytes*4)
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: fetch sitemap: %w", err)
+	}
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("knowledge: decompress sitemap: %w", err)
+		}
+		body, err = io.ReadAll(io.LimitReader(reader, crawlMaxPageBytes*4))
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("knowledge: decompress sitemap: %w", err)
+		}
+	}
+
+	var doc sitemapDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("knowledge: parse sitemap: %w", err)
+	}
+
+	var result []string
+	for _, entry := range doc.URLs {
+		if normalized, err := NormalizeCrawlURL(strings.TrimSpace(entry.Loc)); err == nil {
+			result = append(result, normalized)
+		}
+	}
+	for _, entry := range doc.Sitemaps {
+		nested, err := c.fetchSitemap(ctx, strings.TrimSpace(entry.Loc), level+1)
+		if err != nil {
+			log.Printf("knowledge: nested sitemap %s failed: %v", entry.Loc, err)
+			continue
+		}
+		result = append(result, nested...)
+	}
+	return result, nil
+}
+
+// htmlMeta 保存从 HTML 中解析的链接、canonical 与 robots 指令。
+type htmlMeta struct {
+	canonical string
+	links     []string
+	noindex   bool
+	nofollow  bool
+}
+
+// scanHTMLMeta 解析页面中的超链接、canonical 地址与 meta robots。
+func scanHTMLMeta(base *url.URL, body []byte) htmlMeta {
+	var meta htmlMeta
+	root, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return meta
+	}
+	seen := make(map[string]struct{})
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.DataAtom {
+			case atom.Base:
+				if href := htmlAttr(node, "href"); href != "" {
+					if resolved, err := base.Parse(href); err == nil {
+						base = resolved
+					}
+				}
+			case atom.Link:
+				if strings.EqualFold(htmlAttr(node, "rel"), "canonical") && meta.canonical == "" {
+					if resolved, err := base.Parse(htmlAttr(node, "href")); err == nil {
+						if normalized, err := NormalizeCrawlURL(resolved.String()); err == nil {
+							meta.canonical = normalized
+						}
+					}
+				}
+			case atom.Meta:
+				if strings.EqualFold(htmlAttr(node, "name"), "robots") {
+					content := strings.ToLower(htmlAttr(node, "content"))
+					meta.noindex = meta.noindex || strings.Contains(content, "noindex") || strings.Contains(content, "none")
+					meta.nofollow = meta.nofollow || strings.Contains(content, "nofollow") || strings.Contains(content, "none")
+				}
+			case atom.A:
+				href := strings.TrimSpace(htmlAttr(node, "href"))
+				rel := strings.ToLower(htmlAttr(node, "rel"))
+				if href != "" && !strings.Contains(rel, "nofollow") {
+					if resolved, err := base.Parse(href); err == nil {
+						if normalized, err := NormalizeCrawlURL(resolved.String()); err == nil {
+							if _, ok := seen[normalized]; !ok {
+								seen[normalized] = struct{}{}
+								meta.links = append(meta.links, normalized)
+							}
+						}
+					}
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	return meta
+}
+
+// htmlAttr 读取 HTML 元素属性。
+func htmlAttr(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// NormalizeCrawlURL 规范化 URL：仅允许 http/https，去除片段与默认端口，主机名小写。
+func NormalizeCrawlURL(raw string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("knowledge: invalid url: %w", err)
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", errors.New("knowledge: url must use http or https")
+	}
+	if parsed.Hostname() == "" {
+		return "", errors.New("knowledge: url host is required")
+	}
+	host := strings.ToLower(parsed.Hostname())
+	port := parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		parsed.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		parsed.Host = "[" + host + "]"
+	} else {
+		parsed.Host = host
+	}
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	parsed.User = nil
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String(), nil
+}
+
+// normalizeDomains 清洗允许抓取的域名列表。
+func normalizeDomains(domains []string) []string {
+	result := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		trimmed := strings.ToLower(strings.TrimSpace(domain))
+		trimmed = strings.TrimPrefix(strings.TrimPrefix(trimmed, "https://"), "http://")
+		trimmed = strings.Trim(strings.SplitN(trimmed, "/", 2)[0], ".")
+		if host, _, err := net.SplitHostPort(trimmed); err == nil {
+			trimmed = host
+		}
+		if trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+// domainAllowed 判断主机是否属于允许的域名或其子域名。
+func domainAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range allowed {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentHash 计算正文的 SHA-256 摘要。
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
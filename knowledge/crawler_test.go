@@ -0,0 +1,242 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSite 是记录访问路径的 httptest 站点。
+type testSite struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	hits   map[string]int
+}
+
+// newTestSite 按路径返回给定 HTML 页面，robots 非空时提供 robots.txt。
+func newTestSite(t *testing.T, robots string, pages map[string]string) *testSite {
+	t.Helper()
+	site := &testSite{hits: make(map[string]int)}
+	site.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		site.hits[r.URL.Path]++
+		site.mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			if robots == "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, robots)
+			return
+		}
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(site.server.Close)
+	return site
+}
+
+func (s *testSite) hit(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+// testPage 生成带正文与链接的 HTML 页面。
+func testPage(title string, links ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<html><head><title>%s</title></head><body><h1>%s</h1>", title, title)
+	fmt.Fprintf(&b, "<p>%s describes the test site in enough words to be indexed as a page.</p>", title)
+	for _, link := range links {
+		fmt.Fprintf(&b, `<a href="%s">%s</a>`, link, link)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+// crawlPaths 执行抓取并返回访问到的页面路径（按字典序）。
+func crawlPaths(t *testing.T, start string, opts CrawlOptions) ([]string, CrawlStats) {
+	t.Helper()
+	crawler := NewCrawler("", 5*time.Second, time.Millisecond, true)
+	var paths []string
+	stats, err := crawler.Crawl(context.Background(), start, opts, func(_ context.Context, page CrawledPage) error {
+		parsed, err := url.Parse(page.URL)
+		if err != nil {
+			t.Fatalf("parse page url %q: %v", page.URL, err)
+		}
+		paths = append(paths, parsed.Host+parsed.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	sort.Strings(paths)
+	return paths, stats
+}
+
+func TestCrawlRespectsRobots(t *testing.T) {
+	site := newTestSite(t, "User-agent: *\nDisallow: /private\n", map[string]string{
+		"/":               testPage("Home", "/public", "/private/secret"),
+		"/public":         testPage("Public"),
+		"/private/secret": testPage("Secret"),
+	})
+	host := site.server.Listener.Addr().String()
+
+	paths, stats := crawlPaths(t, site.server.URL+"/", CrawlOptions{Mode: CrawlModePage, MaxDepth: 1})
+
+	if want := []string{host + "/", host + "/public"}; !equalStrings(paths, want) {
+		t.Errorf("visited = %v, want %v", paths, want)
+	}
+	if stats.Skipped != 1 || stats.Fetched != 2 {
+		t.Errorf("stats = %+v, want 2 fetched and 1 skipped", stats)
+	}
+	if site.hit("/private/secret") != 0 {
+		t.Error("disallowed page was requested")
+	}
+}
+
+func TestCrawlMaxDepth(t *testing.T) {
+	site := newTestSite(t, "", map[string]string{
+		"/":  testPage("Home", "/a"),
+		"/a": testPage("Alpha", "/b"),
+		"/b": testPage("Beta", "/c"),
+		"/c": testPage("Gamma"),
+	})
+	host := site.server.Listener.Addr().String()
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{host + "/"}},
+		{1, []string{host + "/", host + "/a"}},
+		{2, []string{host + "/", host + "/a", host + "/b"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("depth %d", tt.depth), func(t *testing.T) {
+			paths, _ := crawlPaths(t, site.server.URL+"/", CrawlOptions{Mode: CrawlModePage, MaxDepth: tt.depth})
+			if !equalStrings(paths, tt.want) {
+				t.Errorf("visited = %v, want %v", paths, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawlAllowedDomains(t *testing.T) {
+	other := newTestSite(t, "", map[string]string{
+		"/x": testPage("Other"),
+	})
+	// localhost 与 127.0.0.1 指向同一回环地址，但主机名不同，可模拟站外链接。
+	otherURL := strings.Replace(other.server.URL, "127.0.0.1", "localhost", 1)
+	otherHost := strings.TrimPrefix(otherURL, "http://")
+	site := newTestSite(t, "", map[string]string{
+		"/":  testPage("Home", "/a", otherURL+"/x"),
+		"/a": testPage("Alpha"),
+	})
+	host := site.server.Listener.Addr().String()
+
+	tests := []struct {
+		name      string
+		domains   []string
+		want      []string
+		otherHits int
+	}{
+		{"start host only", nil, []string{host + "/", host + "/a"}, 0},
+		{"explicit domains", []string{"127.0.0.1", "localhost"}, []string{host + "/", host + "/a", otherHost + "/x"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := other.hit("/x")
+			paths, _ := crawlPaths(t, site.server.URL+"/", CrawlOptions{Mode: CrawlModePage, MaxDepth: 1, AllowedDomains: tt.domains})
+			if !equalStrings(paths, tt.want) {
+				t.Errorf("visited = %v, want %v", paths, tt.want)
+			}
+			if got := other.hit("/x") - before; got != tt.otherHits {
+				t.Errorf("off-domain requests = %d, want %d", got, tt.otherHits)
+			}
+		})
+	}
+
+	_, stats := crawlPaths(t, site.server.URL+"/", CrawlOptions{Mode: CrawlModePage, AllowedDomains: []string{"example.com"}})
+	if stats.Fetched != 0 || stats.Skipped != 1 {
+		t.Errorf("stats = %+v, want start page skipped", stats)
+	}
+}
+
+func TestCrawlMaxPages(t *testing.T) {
+	site := newTestSite(t, "", map[string]string{
+		"/":  testPage("Home", "/a", "/b"),
+		"/a": testPage("Alpha"),
+		"/b": testPage("Beta"),
+	})
+
+	paths, stats := crawlPaths(t, site.server.URL+"/", CrawlOptions{Mode: CrawlModePage, MaxDepth: 1, MaxPages: 2})
+	if len(paths) != 2 || stats.Fetched != 2 || site.hit("/b") != 0 {
+		t.Errorf("visited = %v, stats = %+v, want 2 pages without /b", paths, stats)
+	}
+}
+
+func TestStoreCrawledPageSkipsUnchanged(t *testing.T) {
+	db := newTestDB(t, &Document{})
+	s := &Service{db: db}
+	source := &CrawlSource{ID: 1, AgentID: 7, CreatedBy: 1}
+	canonical := "https://example.com/doc"
+	content := "Unchanged page content."
+
+	existing := []Document{
+		{AgentID: 7, Title: "Doc", CanonicalURL: &canonical, ContentHash: contentHash(content), Content: content, CreatedBy: 1, UpdatedBy: 1},
+		// 旧版本未记录哈希时按正文比较。
+		{AgentID: 8, Title: "Legacy", CanonicalURL: &canonical, Content: content, CreatedBy: 1, UpdatedBy: 1},
+	}
+	for i := range existing {
+		if err := db.Create(&existing[i]).Error; err != nil {
+			t.Fatalf("create document: %v", err)
+		}
+	}
+
+	var stats CrawlStats
+	page := CrawledPage{URL: canonical, CanonicalURL: canonical, Title: "Doc", Content: "  " + content + "\n"}
+	if err := s.storeCrawledPage(context.Background(), source, page, &stats); err != nil {
+		t.Fatalf("store page: %v", err)
+	}
+	legacySource := &CrawlSource{ID: 2, AgentID: 8, CreatedBy: 1}
+	if err := s.storeCrawledPage(context.Background(), legacySource, page, &stats); err != nil {
+		t.Fatalf("store legacy page: %v", err)
+	}
+
+	if stats.Unchanged != 2 || stats.Created != 0 || stats.Updated != 0 {
+		t.Errorf("stats = %+v, want 2 unchanged", stats)
+	}
+	var count int64
+	if err := db.Model(&Document{}).Count(&count).Error; err != nil {
+		t.Fatalf("count documents: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("documents = %d, want 2", count)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
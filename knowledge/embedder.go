@@ -160,6 +160,14 @@ func NewHTTPEmbedderFromEnv() (Embedder, error) {
 	}, nil
 }
 
+// ModelVersion 返回向量模型标识，用于区分不同模型生成的向量。
+func (e *httpEmbedder) ModelVersion() string {
+	if e == nil {
+		return ""
+	}
+	return e.modelID
+}
+
 // Embed 对输入文本批量生成向量表示。
 func (e *httpEmbedder) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
 	if e == nil {
@@ -0,0 +1,510 @@
+package knowledge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 支持解析的文件格式。
+const (
+	FormatPDF      = "pdf"
+	FormatDOCX     = "docx"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatText     = "text"
+)
+
+// MaxUploadBytes 限制单个上传文件的大小。
+const MaxUploadBytes = 20 << 20
+
+var (
+	// ErrUnsupportedFormat 表示上传的文件格式暂不支持解析。
+	ErrUnsupportedFormat = errors.New("knowledge: unsupported file format")
+	// ErrEmptyExtraction 表示文件中没有可提取的文本。
+	ErrEmptyExtraction = errors.New("knowledge: no text could be extracted from file")
+)
+
+// Section 表示文件中的一个结构化段落，携带所属标题与页码。
+type Section struct {
+	Heading string
+	Page    int
+	Text    string
+}
+
+// ExtractedDocument 保存文件解析后的标题、格式与段落。
+type ExtractedDocument struct {
+	Title    string
+	Format   string
+	Sections []Section
+}
+
+// Content 将所有段落拼接为完整正文。
+func (d *ExtractedDocument) Content() string {
+	if d == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(d.Sections))
+	for _, section := range d.Sections {
+		if text := strings.TrimSpace(section.Text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// DetectFormat 根据文件名、Content-Type 与文件头推断文件格式。
+func DetectFormat(filename string, contentType string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(strings.TrimSpace(filename))) {
+	case ".pdf":
+		return FormatPDF
+	case ".docx":
+		return FormatDOCX
+	case ".md", ".markdown", ".mdown", ".mkd":
+		return FormatMarkdown
+	case ".html", ".htm", ".xhtml":
+		return FormatHTML
+	case ".txt", ".text", ".log", ".csv":
+		return FormatText
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	switch mediaType {
+	case "application/pdf":
+		return FormatPDF
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return FormatDOCX
+	case "text/markdown", "text/x-markdown":
+		return FormatMarkdown
+	case "text/html", "application/xhtml+xml":
+		return FormatHTML
+	case "text/plain":
+		return FormatText
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return FormatPDF
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return FormatDOCX
+	}
+	head := bytes.ToLower(bytes.TrimSpace(data[:min(len(data), 512)]))
+	if bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html")) {
+		return FormatHTML
+	}
+	if utf8.Valid(data[:min(len(data), 4096)]) && !bytes.ContainsRune(data[:min(len(data), 4096)], 0) {
+		return FormatText
+	}
+	return ""
+}
+
+// ExtractFile 解析上传文件并返回带有标题与页码信息的段落。
+func ExtractFile(filename string, contentType string, data []byte) (*ExtractedDocument, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyExtraction
+	}
+	if len(data) > MaxUploadBytes {
+		return nil, fmt.Errorf("knowledge: file exceeds %d bytes", MaxUploadBytes)
+	}
+
+	var (
+		doc *ExtractedDocument
+		err error
+	)
+	switch format := DetectFormat(filename, contentType, data); format {
+	case FormatPDF:
+		doc, err = extractPDF(data)
+	case FormatDOCX:
+		doc, err = extractDOCX(data)
+	case FormatMarkdown:
+		doc = extractMarkdown(data)
+	case FormatHTML:
+		doc, err = extractHTML(data)
+	case FormatText:
+		doc = extractPlainText(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil || len(doc.Sections) == 0 {
+		return nil, ErrEmptyExtraction
+	}
+	doc.Title = strings.TrimSpace(doc.Title)
+	if doc.Title == "" {
+		base := filepath.Base(strings.TrimSpace(filename))
+		doc.Title = strings.TrimSpace(strings.TrimSuffix(base, filepath.Ext(base)))
+	}
+	return doc, nil
+}
+
+// FileDocumentInput 解析上传文件并填充文档输入：正文与段落来自文件，
+// 未指定标题时使用文件标题，Source 记录原始文件名。
+func FileDocumentInput(filename string, contentType string, data []byte, base DocumentInput) (DocumentInput, error) {
+	extracted, err := ExtractFile(filename, contentType, data)
+	if err != nil {
+		return base, err
+	}
+	input := base
+	input.Content = extracted.Content()
+	input.Sections = extracted.Sections
+	if strings.TrimSpace(input.Title) == "" {
+		input.Title = truncateRunes(extracted.Title, 200)
+	}
+	if name := filepath.Base(strings.TrimSpace(filename)); name != "" && name != "." {
+		name = truncateRunes(name, 255)
+		input.Source = &name
+	}
+	return input, nil
+}
+
+// truncateRunes 按字符数截断字符串。
+func truncateRunes(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit])
+}
+
+// extractPlainText 将纯文本文件作为单个段落返回。
+func extractPlainText(data []byte) *ExtractedDocument {
+	text := cleanExtractedText(decodeText(data))
+	doc := &ExtractedDocument{Format: FormatText}
+	if text != "" {
+		doc.Sections = []Section{{Text: text}}
+	}
+	return doc
+}
+
+var (
+	atxHeadingPattern    = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	setextLinePattern    = regexp.MustCompile(`^(=+|-+)\s*$`)
+	markdownImagePattern = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLinkPattern  = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	htmlCommentPattern   = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+// headingTrail 维护多级标题路径，用于生成 "一级 > 二级" 形式的标题。
+type headingTrail struct {
+	levels [6]string
+}
+
+// push 记录指定层级的标题并清空更深层级。
+func (t *headingTrail) push(level int, title string) {
+	if level < 1 {
+		level = 1
+	}
+	if level > len(t.levels) {
+		level = len(t.levels)
+	}
+	t.levels[level-1] = title
+	for i := level; i < len(t.levels); i++ {
+		t.levels[i] = ""
+	}
+}
+
+// String 输出当前标题路径。
+func (t *headingTrail) String() string {
+	parts := make([]string, 0, len(t.levels))
+	for _, title := range t.levels {
+		if title != "" {
+			parts = append(parts, title)
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+// extractMarkdown 按 ATX 与 Setext 标题拆分 Markdown 文本。
+func extractMarkdown(data []byte) *ExtractedDocument {
+	text := htmlCommentPattern.ReplaceAllString(normalizeNewlines(decodeText(data)), "")
+	lines := strings.Split(text, "\n")
+
+	doc := &ExtractedDocument{Format: FormatMarkdown}
+	var (
+		trail   headingTrail
+		heading string
+		buf     []string
+		fence   string
+	)
+	flush := func() {
+		if body := cleanExtractedText(strings.Join(buf, "\n")); body != "" {
+			doc.Sections = append(doc.Sections, Section{Heading: heading, Text: body})
+		}
+		buf = nil
+	}
+	startSection := func(level int, title string) {
+		flush()
+		title = stripInlineMarkdown(title)
+		if level == 1 && doc.Title == "" {
+			doc.Title = title
+		}
+		trail.push(level, title)
+		heading = trail.String()
+		buf = append(buf, title)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			buf = append(buf, line)
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			buf = append(buf, line)
+			continue
+		}
+
+		if match := atxHeadingPattern.FindStringSubmatch(trimmed); match != nil && strings.TrimSpace(match[2]) != "" {
+			startSection(len(match[1]), match[2])
+			continue
+		}
+
+		paragraphStart := len(buf) == 0 || strings.TrimSpace(buf[len(buf)-1]) == ""
+		if trimmed != "" && paragraphStart && i+1 < len(lines) {
+			if match := setextLinePattern.FindStringSubmatch(strings.TrimSpace(lines[i+1])); match != nil {
+				level := 2
+				if strings.HasPrefix(match[1], "=") {
+					level = 1
+				}
+				startSection(level, trimmed)
+				i++
+				continue
+			}
+		}
+
+		buf = append(buf, stripInlineMarkdown(line))
+	}
+	flush()
+	return doc
+}
+
+// stripInlineMarkdown 将链接与图片替换为其文字内容。
+func stripInlineMarkdown(line string) string {
+	line = markdownImagePattern.ReplaceAllString(line, "$1")
+	line = markdownLinkPattern.ReplaceAllString(line, "$1")
+	return strings.TrimRight(line, " \t")
+}
+
+// htmlExtractor 遍历 HTML 节点树并按标题切分段落。
+type htmlExtractor struct {
+	doc     *ExtractedDocument
+	trail   headingTrail
+	heading string
+	buf     strings.Builder
+	pre     int
+}
+
+// extractHTML 解析 HTML 文档，跳过脚本样式并按 h1-h6 切分段落。
+func extractHTML(data []byte) (*ExtractedDocument, error) {
+	root, err := html.Parse(strings.NewReader(decodeText(data)))
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: parse html: %w", err)
+	}
+	extractor := &htmlExtractor{doc: &ExtractedDocument{Format: FormatHTML}}
+	extractor.walk(root)
+	extractor.flush()
+	return extractor.doc, nil
+}
+
+// walk 递归处理 HTML 节点。
+func (e *htmlExtractor) walk(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		e.writeText(node.Data)
+		return
+	case html.ElementNode:
+		switch node.DataAtom {
+		case atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Svg, atom.Iframe, atom.Object, atom.Canvas:
+			return
+		case atom.Title:
+			if e.doc.Title == "" {
+				e.doc.Title = collapseSpaces(nodeText(node))
+			}
+			return
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			title := collapseSpaces(nodeText(node))
+			if title == "" {
+				return
+			}
+			e.flush()
+			level := int(node.Data[1] - '0')
+			if level == 1 && e.doc.Title == "" {
+				e.doc.Title = title
+			}
+			e.trail.push(level, title)
+			e.heading = e.trail.String()
+			e.buf.WriteString(title)
+			e.buf.WriteString("\n")
+			return
+		case atom.Br:
+			e.buf.WriteString("\n")
+			return
+		case atom.Pre:
+			e.pre++
+			defer func() { e.pre-- }()
+		}
+	}
+
+	block := node.Type == html.ElementNode && isHTMLBlock(node.DataAtom)
+	if block {
+		e.buf.WriteString("\n")
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		e.walk(child)
+	}
+	if node.Type == html.ElementNode && (node.DataAtom == atom.Td || node.DataAtom == atom.Th) {
+		e.buf.WriteString("\t")
+	}
+	if block {
+		e.buf.WriteString("\n")
+	}
+}
+
+// writeText 追加文本节点内容，非 pre 区域内折叠空白。
+func (e *htmlExtractor) writeText(text string) {
+	if e.pre > 0 {
+		e.buf.WriteString(text)
+		return
+	}
+	collapsed := strings.Join(strings.Fields(text), " ")
+	if collapsed == "" {
+		if text != "" {
+			e.buf.WriteString(" ")
+		}
+		return
+	}
+	if unicode.IsSpace(rune(text[0])) {
+		e.buf.WriteString(" ")
+	}
+	e.buf.WriteString(collapsed)
+	if unicode.IsSpace(rune(text[len(text)-1])) {
+		e.buf.WriteString(" ")
+	}
+}
+
+// flush 将当前缓冲区写入为一个段落。
+func (e *htmlExtractor) flush() {
+	if body := cleanExtractedText(e.buf.String()); body != "" {
+		e.doc.Sections = append(e.doc.Sections, Section{Heading: e.heading, Text: body})
+	}
+	e.buf.Reset()
+}
+
+// isHTMLBlock 判断元素是否应当作为独立的文本块。
+func isHTMLBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Aside, atom.Nav,
+		atom.Ul, atom.Ol, atom.Li, atom.Dl, atom.Dt, atom.Dd, atom.Table, atom.Tr, atom.Blockquote, atom.Pre,
+		atom.Figure, atom.Figcaption, atom.Hr, atom.Address, atom.Details, atom.Summary, atom.Form, atom.Fieldset:
+		return true
+	}
+	return false
+}
+
+// nodeText 返回节点下所有文本内容。
+func nodeText(node *html.Node) string {
+	var sb strings.Builder
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			return
+		}
+		if n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style) {
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(node)
+	return sb.String()
+}
+
+// collapseSpaces 将连续空白折叠为单个空格。
+func collapseSpaces(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// decodeText 识别 BOM 与常见中文编码并转换为 UTF-8 字符串。
+func decodeText(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:])
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], false)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], true)
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	if decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data); err == nil {
+		return string(decoded)
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+// decodeUTF16 将 UTF-16 字节序列解码为字符串。
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// cleanExtractedText 去除控制字符、行尾空白并合并多余空行。
+func cleanExtractedText(text string) string {
+	text = normalizeNewlines(text)
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r == '\u00a0':
+			return ' '
+		case unicode.IsControl(r), r == '\ufeff':
+			return -1
+		}
+		return r
+	}, text)
+
+	lines := strings.Split(text, "\n")
+	cleaned := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if strings.TrimSpace(line) == "" {
+			if !blank && len(cleaned) > 0 {
+				cleaned = append(cleaned, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		cleaned = append(cleaned, line)
+	}
+	return strings.TrimSpace(strings.Join(cleaned, "\n"))
+}
@@ -0,0 +1,301 @@
+package knowledge
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// docxMaxPartBytes 限制单个 DOCX 内部 XML 解压后的大小，防止压缩炸弹。
+const docxMaxPartBytes = 64 << 20
+
+// docxStyleTitle 表示样式为文档标题而非章节标题。
+const docxStyleTitle = -1
+
+// docxStyleSheet 对应 word/styles.xml 中的样式定义。
+type docxStyleSheet struct {
+	Styles []struct {
+		ID   string `xml:"styleId,attr"`
+		Name struct {
+			Val string `xml:"val,attr"`
+		} `xml:"name"`
+		BasedOn struct {
+			Val string `xml:"val,attr"`
+		} `xml:"basedOn"`
+		PPr struct {
+			OutlineLvl *struct {
+				Val string `xml:"val,attr"`
+			} `xml:"outlineLvl"`
+		} `xml:"pPr"`
+	} `xml:"style"`
+}
+
+// docxCoreProps 对应 docProps/core.xml 中的文档属性。
+type docxCoreProps struct {
+	Title string `xml:"title"`
+}
+
+// docxExtractor 在遍历 document.xml 时维护段落、标题与分页状态。
+type docxExtractor struct {
+	doc           *ExtractedDocument
+	levels        map[string]int
+	trail         headingTrail
+	heading       string
+	page          int
+	sawPageBreak  bool
+	explicitBreak bool
+	buf           []string
+}
+
+// extractDOCX 解析 DOCX 文件，按标题样式切分段落并根据分页符记录页码。
+func extractDOCX(data []byte) (*ExtractedDocument, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: open docx: %w", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	body, ok := files["word/document.xml"]
+	if !ok {
+		return nil, errors.New("knowledge: docx is missing word/document.xml")
+	}
+
+	extractor := &docxExtractor{
+		doc:    &ExtractedDocument{Format: FormatDOCX},
+		levels: map[string]int{},
+		page:   1,
+	}
+	if file, ok := files["word/styles.xml"]; ok {
+		var sheet docxStyleSheet
+		if err := decodeZipXML(file, &sheet); err == nil {
+			extractor.levels = docxHeadingLevels(sheet)
+		}
+	}
+	if file, ok := files["docProps/core.xml"]; ok {
+		var core docxCoreProps
+		if err := decodeZipXML(file, &core); err == nil {
+			extractor.doc.Title = strings.TrimSpace(core.Title)
+		}
+	}
+
+	reader, err := body.Open()
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: open docx body: %w", err)
+	}
+	defer reader.Close()
+	if err := extractor.parse(io.LimitReader(reader, docxMaxPartBytes)); err != nil {
+		return nil, err
+	}
+
+	if !extractor.sawPageBreak {
+		for i := range extractor.doc.Sections {
+			extractor.doc.Sections[i].Page = 0
+		}
+	}
+	return extractor.doc, nil
+}
+
+// parse 以流式方式读取 document.xml。
+func (e *docxExtractor) parse(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	var (
+		para      strings.Builder
+		inPara    bool
+		inPPr     int
+		inText    bool
+		paraStyle string
+		outline   = -1
+	)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("knowledge: parse docx: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				inPara = true
+				para.Reset()
+				paraStyle = ""
+				outline = -1
+			case "pPr":
+				inPPr++
+			case "pStyle":
+				paraStyle = xmlAttr(t, "val")
+			case "outlineLvl":
+				if lvl, err := strconv.Atoi(xmlAttr(t, "val")); err == nil {
+					outline = lvl
+				}
+			case "pageBreakBefore":
+				if val := xmlAttr(t, "val"); val != "0" && val != "false" {
+					e.pageBreak()
+				}
+			case "t":
+				inText = inPara
+			case "tab":
+				if inPara && inPPr == 0 {
+					para.WriteString("\t")
+				}
+			case "br", "cr":
+				if xmlAttr(t, "type") == "page" {
+					e.pageBreak()
+					e.explicitBreak = true
+				} else if inPara {
+					para.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				if e.explicitBreak {
+					e.explicitBreak = false
+				} else {
+					e.pageBreak()
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "pPr":
+				if inPPr > 0 {
+					inPPr--
+				}
+			case "p":
+				inPara = false
+				e.endParagraph(para.String(), paraStyle, outline)
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+				e.explicitBreak = false
+			}
+		}
+	}
+	e.flush()
+	return nil
+}
+
+// endParagraph 根据段落样式判断是否为标题并写入缓冲区。
+func (e *docxExtractor) endParagraph(text string, style string, outline int) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	level, ok := e.levels[style]
+	if !ok && outline >= 0 && outline < 9 {
+		level = outline + 1
+	}
+	switch {
+	case level == docxStyleTitle:
+		if e.doc.Title == "" {
+			e.doc.Title = text
+		}
+		e.buf = append(e.buf, text)
+	case level > 0:
+		e.flush()
+		e.trail.push(min(level, 6), text)
+		e.heading = e.trail.String()
+		e.buf = append(e.buf, text)
+	default:
+		e.buf = append(e.buf, text)
+	}
+}
+
+// pageBreak 在分页时结束当前段落并递增页码。
+func (e *docxExtractor) pageBreak() {
+	e.flush()
+	e.page++
+	e.sawPageBreak = true
+}
+
+// flush 将缓冲区内容写入为一个段落。
+func (e *docxExtractor) flush() {
+	if body := cleanExtractedText(strings.Join(e.buf, "\n")); body != "" {
+		e.doc.Sections = append(e.doc.Sections, Section{Heading: e.heading, Page: e.page, Text: body})
+	}
+	e.buf = nil
+}
+
+// docxHeadingLevels 将样式 ID 映射到标题层级，支持 basedOn 继承。
+func docxHeadingLevels(sheet docxStyleSheet) map[string]int {
+	direct := make(map[string]int, len(sheet.Styles))
+	parents := make(map[string]string, len(sheet.Styles))
+	for _, style := range sheet.Styles {
+		if style.ID == "" {
+			continue
+		}
+		parents[style.ID] = style.BasedOn.Val
+		if level := docxNamedLevel(style.Name.Val); level != 0 {
+			direct[style.ID] = level
+			continue
+		}
+		if style.PPr.OutlineLvl != nil {
+			if lvl, err := strconv.Atoi(style.PPr.OutlineLvl.Val); err == nil && lvl >= 0 && lvl < 9 {
+				direct[style.ID] = lvl + 1
+			}
+		}
+	}
+
+	levels := make(map[string]int, len(direct))
+	for id := range parents {
+		current := id
+		for depth := 0; depth < 8 && current != ""; depth++ {
+			if level, ok := direct[current]; ok {
+				levels[id] = level
+				break
+			}
+			current = parents[current]
+		}
+	}
+	return levels
+}
+
+// docxNamedLevel 根据样式名称识别标题层级。
+func docxNamedLevel(name string) int {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if normalized == "title" || normalized == "标题" {
+		return docxStyleTitle
+	}
+	for _, prefix := range []string{"heading", "标题"} {
+		if !strings.HasPrefix(normalized, prefix) {
+			continue
+		}
+		if level, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(normalized, prefix))); err == nil && level > 0 {
+			return level
+		}
+	}
+	return 0
+}
+
+// decodeZipXML 解码压缩包中的 XML 文件。
+func decodeZipXML(file *zip.File, target interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return xml.NewDecoder(io.LimitReader(reader, docxMaxPartBytes)).Decode(target)
+}
+
+// xmlAttr 按本地名称读取元素属性。
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
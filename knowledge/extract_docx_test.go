@@ -0,0 +1,116 @@
+package knowledge
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// buildTestDOCX 将给定的部件打包为 DOCX 压缩包。
+func buildTestDOCX(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, body := range parts {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+const testDOCXStyles = `<?xml version="1.0" encoding="UTF-8"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:style w:styleId="Title"><w:name w:val="Title"/></w:style>
+  <w:style w:styleId="Heading1"><w:name w:val="heading 1"/></w:style>
+  <w:style w:styleId="MyHeading"><w:name w:val="Custom"/><w:basedOn w:val="Heading1"/></w:style>
+  <w:style w:styleId="Outline2"><w:name w:val="Outline"/><w:pPr><w:outlineLvl w:val="1"/></w:pPr></w:style>
+</w:styles>`
+
+// testDOCXBody 包装 document.xml 的正文。
+func testDOCXBody(paragraphs string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + paragraphs + `</w:body></w:document>`
+}
+
+func TestExtractDOCX(t *testing.T) {
+	body := testDOCXBody(`
+<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>User Guide</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Install</w:t></w:r></w:p>
+<w:p><w:r><w:t>Run the </w:t></w:r><w:r><w:t>installer.</w:t></w:r></w:p>
+<w:p><w:r><w:br w:type="page"/></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Outline2"/></w:pPr><w:r><w:t>Options</w:t></w:r></w:p>
+<w:p><w:r><w:t>Pick a folder.</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="MyHeading"/></w:pPr><w:r><w:t>Usage</w:t></w:r></w:p>
+<w:p><w:r><w:t>Open the app.</w:t></w:r></w:p>`)
+	data := buildTestDOCX(t, map[string]string{
+		"word/document.xml": body,
+		"word/styles.xml":   testDOCXStyles,
+	})
+
+	doc, err := extractDOCX(data)
+	if err != nil {
+		t.Fatalf("extractDOCX: %v", err)
+	}
+	if doc.Title != "User Guide" {
+		t.Errorf("title = %q, want %q", doc.Title, "User Guide")
+	}
+
+	want := []Section{
+		{Heading: "", Page: 1, Text: "User Guide"},
+		{Heading: "Install", Page: 1, Text: "Install\nRun the installer."},
+		{Heading: "Install > Options", Page: 2, Text: "Options\nPick a folder."},
+		{Heading: "Usage", Page: 2, Text: "Usage\nOpen the app."},
+	}
+	if len(doc.Sections) != len(want) {
+		t.Fatalf("sections = %+v, want %+v", doc.Sections, want)
+	}
+	for i := range want {
+		if doc.Sections[i] != want[i] {
+			t.Errorf("section %d = %+v, want %+v", i, doc.Sections[i], want[i])
+		}
+	}
+}
+
+func TestExtractDOCXCoreTitleAndNoPages(t *testing.T) {
+	data := buildTestDOCX(t, map[string]string{
+		"word/document.xml": testDOCXBody(`<w:p><w:r><w:t>Only text.</w:t></w:r></w:p>`),
+		"docProps/core.xml": `<cp:coreProperties xmlns:cp="cp" xmlns:dc="dc"><dc:title> Core Title </dc:title></cp:coreProperties>`,
+	})
+
+	doc, err := extractDOCX(data)
+	if err != nil {
+		t.Fatalf("extractDOCX: %v", err)
+	}
+	if doc.Title != "Core Title" {
+		t.Errorf("title = %q, want %q", doc.Title, "Core Title")
+	}
+	if len(doc.Sections) != 1 || doc.Sections[0].Page != 0 {
+		t.Errorf("sections = %+v, want one section without page numbers", doc.Sections)
+	}
+}
+
+func TestExtractDOCXInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a zip", []byte("plain text")},
+		{"missing body", buildTestDOCX(t, map[string]string{"word/styles.xml": testDOCXStyles})},
+		{"malformed xml", buildTestDOCX(t, map[string]string{"word/document.xml": "<w:document><w:body><w:p>"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := extractDOCX(tt.data); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,1089 @@
+package knowledge
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	pdfMaxResolveDepth = 32
+	pdfMaxFormDepth    = 4
+	pdfMaxStreamBytes  = 64 << 20
+	// pdfMaxDecodedBytes 为单个文档解码与复用流数据的累计上限，防止重复引用同一压缩流放大内存与耗时。
+	pdfMaxDecodedBytes = 256 << 20
+	pdfMaxPages        = 10000
+	// pdfWordGap 为 TJ 数组中被视为词间空格的最小字距（千分之一字号）。
+	pdfWordGap = 180
+)
+
+var (
+	pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfEncryptKey   = regexp.MustCompile(`/Encrypt\s*(\d+\s+\d+\s+R|<<)`)
+)
+
+// pdfName 表示 PDF 名称对象。
+type pdfName string
+
+// pdfRef 表示间接对象引用。
+type pdfRef struct {
+	num int
+	gen int
+}
+
+// pdfDict 表示 PDF 字典对象。
+type pdfDict map[string]any
+
+// pdfKeyword 表示内容流中的操作符或关键字。
+type pdfKeyword string
+
+// pdfObject 表示一个间接对象及其可选的流数据。
+type pdfObject struct {
+	value  any
+	stream []byte
+}
+
+// pdfDocument 保存解析后的对象表、已解码流的缓存与剩余解码额度。
+type pdfDocument struct {
+	objects map[int]*pdfObject
+	trailer pdfDict
+	decoded map[int][]byte
+	budget  int64
+}
+
+// errPDFDecodeBudget 表示文档的累计解码数据超过上限。
+var errPDFDecodeBudget = errors.New("knowledge: PDF decoded stream budget exceeded")
+
+// extractPDF 按页提取 PDF 文本，页码记录在段落元数据中。
+func extractPDF(data []byte) (*ExtractedDocument, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF")) {
+		return nil, errors.New("knowledge: file is not a valid PDF")
+	}
+	if pdfEncryptKey.Match(data) {
+		return nil, errors.New("knowledge: encrypted PDF files are not supported")
+	}
+
+	doc := parsePDF(data)
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, errors.New("knowledge: no pages found in PDF")
+	}
+
+	result := &ExtractedDocument{Format: FormatPDF}
+	if info, ok := doc.resolve(doc.trailer["Info"]).(pdfDict); ok {
+		if title, ok := doc.resolve(info["Title"]).([]byte); ok {
+			result.Title = strings.TrimSpace(decodePDFTextString(title))
+		}
+	}
+
+	for i, page := range pages {
+		extractor := &pdfTextExtractor{doc: doc, lastY: math.NaN()}
+		extractor.run(doc.pageContent(page), doc.resolveDict(page["Resources"]), 0)
+		text := cleanExtractedText(extractor.out.String())
+		if text == "" {
+			continue
+		}
+		result.Sections = append(result.Sections, Section{Page: i + 1, Text: text})
+	}
+	if len(result.Sections) == 0 {
+		return nil, errors.New("knowledge: PDF contains no extractable text (scanned documents are not supported)")
+	}
+	return result, nil
+}
+
+// parsePDF 扫描文件中的全部间接对象（含对象流），不依赖交叉引用表。
+func parsePDF(data []byte) *pdfDocument {
+	doc := &pdfDocument{
+		objects: make(map[int]*pdfObject),
+		trailer: pdfDict{},
+		decoded: make(map[int][]byte),
+		budget:  pdfMaxDecodedBytes,
+	}
+
+	for _, loc := range pdfObjectHeader.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		if err != nil {
+			continue
+		}
+		lex := &pdfLexer{data: data, pos: loc[1]}
+		value, err := lex.value()
+		if err != nil {
+			continue
+		}
+		obj := &pdfObject{value: value}
+		if dict, ok := value.(pdfDict); ok {
+			obj.stream = lex.streamData(dict)
+			if dict["Type"] == pdfName("XRef") {
+				mergePDFTrailer(doc.trailer, dict)
+			}
+		}
+		doc.objects[num] = obj
+	}
+
+	for _, idx := range pdfAllIndexes(data, []byte("trailer")) {
+		lex := &pdfLexer{data: data, pos: idx + len("trailer")}
+		if value, err := lex.value(); err == nil {
+			if dict, ok := value.(pdfDict); ok {
+				mergePDFTrailer(doc.trailer, dict)
+			}
+		}
+	}
+
+	for _, num := range doc.sortedObjectNumbers() {
+		obj := doc.objects[num]
+		dict, ok := obj.value.(pdfDict)
+		if !ok || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		doc.expandObjectStream(dict, obj.stream)
+	}
+	return doc
+}
+
+// mergePDFTrailer 合并尾部字典，后出现的增量更新优先。
+func mergePDFTrailer(trailer pdfDict, dict pdfDict) {
+	for _, key := range []string{"Root", "Info"} {
+		if value, ok := dict[key]; ok {
+			trailer[key] = value
+		}
+	}
+}
+
+// expandObjectStream 展开对象流中压缩存放的对象。
+func (d *pdfDocument) expandObjectStream(dict pdfDict, raw []byte) {
+	data, err := decodePDFStream(dict, raw, d)
+	if err != nil {
+		return
+	}
+	count, _ := d.resolve(dict["N"]).(float64)
+	first, _ := d.resolve(dict["First"]).(float64)
+	if count <= 0 || first <= 0 || int(first) > len(data) {
+		return
+	}
+
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(count); i++ {
+		numVal, err1 := header.value()
+		offVal, err2 := header.value()
+		num, ok1 := numVal.(float64)
+		off, ok2 := offVal.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			return
+		}
+		if _, exists := d.objects[int(num)]; exists {
+			continue
+		}
+		lex := &pdfLexer{data: data, pos: int(first) + int(off)}
+		if value, err := lex.value(); err == nil {
+			d.objects[int(num)] = &pdfObject{value: value}
+		}
+	}
+}
+
+// resolve 解引用间接对象。
+func (d *pdfDocument) resolve(value any) any {
+	for depth := 0; depth < pdfMaxResolveDepth; depth++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		obj := d.objects[ref.num]
+		if obj == nil {
+			return nil
+		}
+		value = obj.value
+	}
+	return nil
+}
+
+// resolveDict 解引用并返回字典，类型不符时返回 nil。
+func (d *pdfDocument) resolveDict(value any) pdfDict {
+	dict, _ := d.resolve(value).(pdfDict)
+	return dict
+}
+
+// streamOf 返回引用所指向对象的解码后流数据。
+func (d *pdfDocument) streamOf(value any) (pdfDict, []byte) {
+	ref, ok := value.(pdfRef)
+	if !ok {
+		return nil, nil
+	}
+	obj := d.objects[ref.num]
+	if obj == nil || obj.stream == nil {
+		return nil, nil
+	}
+	dict, _ := obj.value.(pdfDict)
+	if data, ok := d.decoded[ref.num]; ok {
+		if !d.consume(len(data)) {
+			return dict, nil
+		}
+		return dict, data
+	}
+	data, err := decodePDFStream(dict, obj.stream, d)
+	if err != nil {
+		return dict, nil
+	}
+	d.decoded[ref.num] = data
+	return dict, data
+}
+
+// consume 从解码额度中扣除 n 字节，额度不足时返回 false。
+func (d *pdfDocument) consume(n int) bool {
+	if d.budget < int64(n) {
+		d.budget = 0
+		return false
+	}
+	d.budget -= int64(n)
+	return true
+}
+
+// pages 按页面树顺序返回所有页面字典，继承的资源会写入页面。
+func (d *pdfDocument) pages() []pdfDict {
+	var root any
+	if catalog := d.resolveDict(d.trailer["Root"]); catalog != nil {
+		root = catalog["Pages"]
+	}
+	if d.resolveDict(root) == nil {
+		root = nil
+		for _, num := range d.sortedObjectNumbers() {
+			if dict, ok := d.objects[num].value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				root = dict["Pages"]
+				break
+			}
+		}
+	}
+
+	var pages []pdfDict
+	visited := make(map[int]bool)
+	var walk func(value any, inherited any, depth int)
+	walk = func(value any, inherited any, depth int) {
+		if depth > pdfMaxResolveDepth || len(pages) >= pdfMaxPages {
+			return
+		}
+		if ref, ok := value.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		node := d.resolveDict(value)
+		if node == nil {
+			return
+		}
+		resources := inherited
+		if own, ok := node["Resources"]; ok {
+			resources = own
+		}
+		if kids, ok := d.resolve(node["Kids"]).([]any); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		if node["Type"] == pdfName("Page") || node["Contents"] != nil {
+			page := make(pdfDict, len(node)+1)
+			for k, v := range node {
+				page[k] = v
+			}
+			page["Resources"] = resources
+			pages = append(pages, page)
+		}
+	}
+	if root != nil {
+		walk(root, nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for _, num := range d.sortedObjectNumbers() {
+		if len(pages) >= pdfMaxPages {
+			break
+		}
+		if dict, ok := d.objects[num].value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			pages = append(pages, dict)
+		}
+	}
+	return pages
+}
+
+// sortedObjectNumbers 返回升序排列的对象编号。
+func (d *pdfDocument) sortedObjectNumbers() []int {
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// pageContent 拼接页面的全部内容流，重复引用的流只读取一次。
+func (d *pdfDocument) pageContent(page pdfDict) []byte {
+	var refs []any
+	switch contents := page["Contents"].(type) {
+	case pdfRef:
+		if arr, ok := d.resolve(contents).([]any); ok {
+			refs = arr
+		} else {
+			refs = []any{contents}
+		}
+	case []any:
+		refs = contents
+	}
+
+	var buf bytes.Buffer
+	seen := make(map[pdfRef]bool, len(refs))
+	for _, ref := range refs {
+		if r, ok := ref.(pdfRef); ok {
+			if seen[r] {
+				continue
+			}
+			seen[r] = true
+		}
+		if _, data := d.streamOf(ref); len(data) > 0 {
+			buf.Write(data)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// decodePDFStream 按 Filter 解码流数据，支持 Flate、ASCIIHex 与 ASCII85，解码结果计入文档的解码额度。
+func decodePDFStream(dict pdfDict, raw []byte, doc *pdfDocument) ([]byte, error) {
+	if doc.budget <= 0 {
+		return nil, errPDFDecodeBudget
+	}
+	var filters []any
+	switch filter := doc.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{filter}
+	case []any:
+		filters = filter
+	}
+
+	data := raw
+	for _, item := range filters {
+		name, _ := doc.resolve(item).(pdfName)
+		var err error
+		switch name {
+		case "FlateDecode", "Fl":
+			data, err = inflatePDF(data, min(pdfMaxStreamBytes, doc.budget))
+		case "ASCIIHexDecode", "AHx":
+			data, err = decodePDFHex(data)
+		case "ASCII85Decode", "A85":
+			data, err = decodePDFASCII85(data)
+		default:
+			return nil, fmt.Errorf("knowledge: unsupported PDF filter %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !doc.consume(len(data)) {
+		return nil, errPDFDecodeBudget
+	}
+	return data, nil
+}
+
+// inflatePDF 解压 Flate 数据，输出不超过 limit 字节，容忍缺失校验和的截断流。
+func inflatePDF(data []byte, limit int64) ([]byte, error) {
+	var reader io.ReadCloser
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		reader = zr
+	} else if len(data) > 2 {
+		reader = flate.NewReader(bytes.NewReader(data[2:]))
+	} else {
+		return nil, err
+	}
+	defer reader.Close()
+
+	out, err := io.ReadAll(io.LimitReader(reader, limit))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decodePDFHex 解码 ASCIIHex 流。
+func decodePDFHex(data []byte) ([]byte, error) {
+	if end := bytes.IndexByte(data, '>'); end >= 0 {
+		data = data[:end]
+	}
+	return decodeHexDigits(data), nil
+}
+
+// decodePDFASCII85 解码 ASCII85 流。
+func decodePDFASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
+
+// decodeHexDigits 解码十六进制字符，忽略空白并补齐奇数位。
+func decodeHexDigits(data []byte) []byte {
+	digits := make([]byte, 0, len(data)+1)
+	for _, b := range data {
+		if isPDFHexDigit(b) {
+			digits = append(digits, b)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, _ = hex.Decode(out, digits)
+	return out
+}
+
+// decodePDFTextString 解码文档信息中的文本字符串（UTF-16BE 或 PDFDocEncoding）。
+func decodePDFTextString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		return decodeUTF16BE(raw[2:])
+	}
+	return decodeLatin1(raw)
+}
+
+// decodeUTF16BE 将 UTF-16BE 字节解码为字符串。
+func decodeUTF16BE(raw []byte) string {
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// cp1252High 为 WinAnsiEncoding 在 0x80-0x9F 区间的字符映射。
+var cp1252High = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// decodeLatin1 以 WinAnsi 近似解码单字节文本。
+func decodeLatin1(raw []byte) string {
+	var sb strings.Builder
+	for _, b := range raw {
+		switch {
+		case b >= 0x80 && b < 0xA0:
+			if r := cp1252High[b-0x80]; r != 0 {
+				sb.WriteRune(r)
+			}
+		case b < 0x20 && b != '\t' && b != '\n' && b != '\r':
+			continue
+		default:
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
+
+// pdfAllIndexes 返回子串在数据中的全部起始位置。
+func pdfAllIndexes(data, sep []byte) []int {
+	var result []int
+	offset := 0
+	for {
+		idx := bytes.Index(data[offset:], sep)
+		if idx < 0 {
+			return result
+		}
+		result = append(result, offset+idx)
+		offset += idx + len(sep)
+	}
+}
+
+// pdfFont 将字体编码的字节序列转换为 Unicode 文本。
+type pdfFont struct {
+	codeBytes int
+	toUnicode map[uint32]string
+	composite bool
+}
+
+// decode 按字体编码解码字符串。
+func (f *pdfFont) decode(raw []byte) string {
+	if f == nil {
+		return decodeLatin1(raw)
+	}
+	width := f.codeBytes
+	if width <= 0 {
+		width = 1
+	}
+	var sb strings.Builder
+	for i := 0; i+width <= len(raw); i += width {
+		var code uint32
+		for j := 0; j < width; j++ {
+			code = code<<8 | uint32(raw[i+j])
+		}
+		if text, ok := f.toUnicode[code]; ok {
+			sb.WriteString(text)
+			continue
+		}
+		if f.composite {
+			continue
+		}
+		sb.WriteString(decodeLatin1([]byte{byte(code)}))
+	}
+	return sb.String()
+}
+
+// loadFont 解析字体字典，优先使用 ToUnicode 映射。
+func (d *pdfDocument) loadFont(value any) *pdfFont {
+	dict := d.resolveDict(value)
+	if dict == nil {
+		return nil
+	}
+	font := &pdfFont{codeBytes: 1}
+	if dict["Subtype"] == pdfName("Type0") {
+		font.codeBytes = 2
+		font.composite = true
+	}
+	if _, cmap := d.streamOf(dict["ToUnicode"]); len(cmap) > 0 {
+		width, mapping := parseToUnicodeCMap(cmap)
+		if width > 0 {
+			font.codeBytes = width
+		}
+		font.toUnicode = mapping
+	}
+	return font
+}
+
+// parseToUnicodeCMap 解析 ToUnicode CMap 中的 bfchar 与 bfrange 映射。
+func parseToUnicodeCMap(data []byte) (int, map[uint32]string) {
+	mapping := make(map[uint32]string)
+	lex := &pdfLexer{data: data}
+	width := 0
+	var operands []any
+
+	for {
+		tok, err := lex.token()
+		if err != nil {
+			break
+		}
+		keyword, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+		switch keyword {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].([]byte); ok && len(lo) > 0 {
+					width = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					mapping[bytesToCode(src)] = decodeUTF16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := bytesToCode(lo), bytesToCode(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					base := []rune(decodeUTF16BE(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for code := start; code <= end; code++ {
+						runes := append([]rune(nil), base...)
+						runes[len(runes)-1] += rune(code - start)
+						mapping[code] = string(runes)
+					}
+				case []any:
+					for j, item := range dst {
+						if raw, ok := item.([]byte); ok && start+uint32(j) <= end {
+							mapping[start+uint32(j)] = decodeUTF16BE(raw)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return width, mapping
+}
+
+// bytesToCode 将大端字节序列转为整数编码。
+func bytesToCode(raw []byte) uint32 {
+	var code uint32
+	for _, b := range raw {
+		code = code<<8 | uint32(b)
+	}
+	return code
+}
+
+// pdfTextExtractor 解释内容流中的文本操作符并输出纯文本。
+type pdfTextExtractor struct {
+	doc   *pdfDocument
+	out   strings.Builder
+	font  *pdfFont
+	lastY float64
+	last  byte
+}
+
+// run 执行内容流，遇到表单 XObject 时递归处理。
+func (e *pdfTextExtractor) run(content []byte, resources pdfDict, depth int) {
+	if len(content) == 0 || depth > pdfMaxFormDepth {
+		return
+	}
+	fontDict := e.doc.resolveDict(resources["Font"])
+	xobjects := e.doc.resolveDict(resources["XObject"])
+	fonts := make(map[string]*pdfFont)
+	loadFont := func(name string) *pdfFont {
+		if font, ok := fonts[name]; ok {
+			return font
+		}
+		font := e.doc.loadFont(fontDict[name])
+		fonts[name] = font
+		return font
+	}
+
+	lex := &pdfLexer{data: content}
+	var operands []any
+	for {
+		tok, err := lex.token()
+		if err != nil {
+			return
+		}
+		op, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					e.font = loadFont(string(name))
+				}
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				e.show(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			e.newline()
+			if len(operands) > 0 {
+				e.show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				if items, ok := operands[len(operands)-1].([]any); ok {
+					for _, item := range items {
+						if gap, ok := item.(float64); ok {
+							if gap < -pdfWordGap {
+								e.space()
+							}
+							continue
+						}
+						e.show(item)
+					}
+				}
+			}
+		case "T*":
+			e.newline()
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[len(operands)-2].(float64)
+				ty, _ := operands[len(operands)-1].(float64)
+				if math.Abs(ty) > 0.01 {
+					e.newline()
+				} else if tx > 0 {
+					e.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[len(operands)-1].(float64)
+				if !math.IsNaN(e.lastY) && math.Abs(y-e.lastY) > 0.5 {
+					e.newline()
+				} else {
+					e.space()
+				}
+				e.lastY = y
+			}
+		case "Do":
+			if len(operands) > 0 {
+				if name, ok := operands[len(operands)-1].(pdfName); ok {
+					dict, data := e.doc.streamOf(xobjects[string(name)])
+					if dict != nil && dict["Subtype"] == pdfName("Form") && len(data) > 0 {
+						inner := e.doc.resolveDict(dict["Resources"])
+						if inner == nil {
+							inner = resources
+						}
+						saved := e.font
+						e.run(data, inner, depth+1)
+						e.font = saved
+					}
+				}
+			}
+		case "ID":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// show 输出一段字符串操作数。
+func (e *pdfTextExtractor) show(value any) {
+	raw, ok := value.([]byte)
+	if !ok {
+		return
+	}
+	text := e.font.decode(raw)
+	if text == "" {
+		return
+	}
+	e.out.WriteString(text)
+	e.last = text[len(text)-1]
+}
+
+// newline 在输出末尾追加换行。
+func (e *pdfTextExtractor) newline() {
+	if e.last != 0 && e.last != '\n' {
+		e.out.WriteByte('\n')
+		e.last = '\n'
+	}
+}
+
+// space 在输出末尾追加空格（避免重复空白）。
+func (e *pdfTextExtractor) space() {
+	if e.last != 0 && e.last != ' ' && e.last != '\n' {
+		e.out.WriteByte(' ')
+		e.last = ' '
+	}
+}
+
+// pdfLexer 是 PDF 对象与内容流的词法解析器。
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+var errPDFEOF = errors.New("knowledge: unexpected end of PDF data")
+
+// skipSpace 跳过空白与注释。
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// value 读取一个完整的 PDF 对象值（含间接引用）。
+func (l *pdfLexer) value() (any, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	num, ok := tok.(float64)
+	if !ok || num != math.Trunc(num) || num < 0 {
+		return tok, nil
+	}
+
+	saved := l.pos
+	if next, err := l.token(); err == nil {
+		if gen, ok := next.(float64); ok && gen == math.Trunc(gen) {
+			if kw, err := l.token(); err == nil && kw == pdfKeyword("R") {
+				return pdfRef{num: int(num), gen: int(gen)}, nil
+			}
+		}
+	}
+	l.pos = saved
+	return num, nil
+}
+
+// token 读取下一个词法单元；字典与数组会被完整解析。
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEOF
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return l.dict()
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, errPDFEOF
+		}
+		raw := decodeHexDigits(l.data[l.pos : l.pos+end])
+		l.pos += end + 1
+		return raw, nil
+	case c == '(':
+		l.pos++
+		return l.literalString(), nil
+	case c == '/':
+		l.pos++
+		return l.name(), nil
+	case c == '[':
+		l.pos++
+		var items []any
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return items, nil
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return items, nil
+			}
+			item, err := l.value()
+			if err != nil {
+				return items, nil
+			}
+			items = append(items, item)
+		}
+	case c == ']' || c == '>' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		start := l.pos
+		l.pos++
+		for l.pos < len(l.data) && (l.data[l.pos] == '.' || (l.data[l.pos] >= '0' && l.data[l.pos] <= '9')) {
+			l.pos++
+		}
+		num, err := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+		if err != nil {
+			return 0.0, nil
+		}
+		return num, nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// dict 解析字典直到 >>。
+func (l *pdfLexer) dict() (any, error) {
+	dict := pdfDict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return dict, nil
+		}
+		if l.pos >= len(l.data) {
+			return dict, nil
+		}
+		keyTok, err := l.token()
+		if err != nil {
+			return dict, nil
+		}
+		key, ok := keyTok.(pdfName)
+		if !ok {
+			continue
+		}
+		value, err := l.value()
+		if err != nil {
+			return dict, nil
+		}
+		dict[string(key)] = value
+	}
+}
+
+// name 解析名称对象，处理 #xx 转义。
+func (l *pdfLexer) name() pdfName {
+	var sb strings.Builder
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) || isPDFDelimiter(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) && isPDFHexDigit(l.data[l.pos+1]) && isPDFHexDigit(l.data[l.pos+2]) {
+			value, _ := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8)
+			sb.WriteByte(byte(value))
+			l.pos += 3
+			continue
+		}
+		sb.WriteByte(c)
+		l.pos++
+	}
+	return pdfName(sb.String())
+}
+
+// literalString 解析圆括号字符串，处理嵌套括号与转义。
+func (l *pdfLexer) literalString() []byte {
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+			out = append(out, c)
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					value := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(value))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// streamData 在字典之后读取 stream ... endstream 之间的原始数据。
+func (l *pdfLexer) streamData(dict pdfDict) []byte {
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		return nil
+	}
+	start := l.pos + len("stream")
+	if start < len(l.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+
+	if length, ok := dict["Length"].(float64); ok && length >= 0 {
+		end := start + int(length)
+		if end <= len(l.data) {
+			rest := bytes.TrimLeft(l.data[end:min(end+16, len(l.data))], " \t\r\n")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				l.pos = end
+				return l.data[start:end]
+			}
+		}
+	}
+
+	idx := bytes.Index(l.data[start:], []byte("endstream"))
+	if idx < 0 {
+		return nil
+	}
+	end := start + idx
+	l.pos = end
+	return bytes.TrimRight(l.data[start:end], "\r\n")
+}
+
+// skipInlineImage 跳过内联图像的二进制数据直至 EI。
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos+2 < len(l.data) {
+		if l.data[l.pos] == 'E' && l.data[l.pos+1] == 'I' && isPDFSpace(l.data[l.pos-1]) &&
+			(l.pos+2 == len(l.data) || isPDFSpace(l.data[l.pos+2])) {
+			l.pos += 2
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
+
+// isPDFSpace 判断字节是否为 PDF 空白符。
+func isPDFSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+// isPDFDelimiter 判断字节是否为 PDF 分隔符。
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// isPDFHexDigit 判断字节是否为十六进制数字。
+func isPDFHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,179 @@
+package knowledge
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildTestPDF 按对象编号顺序拼接一个不含交叉引用表的最小 PDF。
+func buildTestPDF(objects []string, trailer string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	for i, body := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	fmt.Fprintf(&buf, "trailer\n%s\n%%%%EOF\n", trailer)
+	return buf.Bytes()
+}
+
+// testPDFStream 返回带 Length 的流对象正文。
+func testPDFStream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// deflateTestData 使用 zlib 压缩测试数据。
+func deflateTestData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// extractPDFWithin 在限定时间内执行 extractPDF，超时视为测试失败。
+func extractPDFWithin(t *testing.T, data []byte, limit time.Duration) (*ExtractedDocument, error) {
+	t.Helper()
+	type result struct {
+		doc *ExtractedDocument
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		doc, err := extractPDF(data)
+		done <- result{doc, err}
+	}()
+	select {
+	case r := <-done:
+		return r.doc, r.err
+	case <-time.After(limit):
+		t.Fatalf("extractPDF did not finish within %s", limit)
+		return nil, nil
+	}
+}
+
+func TestExtractPDFPages(t *testing.T) {
+	first := []byte("BT /F1 12 Tf 72 720 Td (Hello World) Tj ET")
+	second := deflateTestData(t, []byte("BT /F1 12 Tf 72 720 Td [(Second) -300 (page)] TJ ET"))
+	data := buildTestPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 7 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		testPDFStream("", first),
+		testPDFStream("/Filter /FlateDecode", second),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Title (Test Manual) >>",
+	}, "<< /Root 1 0 R /Info 8 0 R >>")
+
+	doc, err := extractPDFWithin(t, data, 5*time.Second)
+	if err != nil {
+		t.Fatalf("extractPDF: %v", err)
+	}
+	if doc.Title != "Test Manual" {
+		t.Errorf("title = %q, want %q", doc.Title, "Test Manual")
+	}
+	if len(doc.Sections) != 2 {
+		t.Fatalf("sections = %d, want 2: %+v", len(doc.Sections), doc.Sections)
+	}
+	for i, want := range []struct {
+		page int
+		text string
+	}{{1, "Hello World"}, {2, "Second page"}} {
+		section := doc.Sections[i]
+		if section.Page != want.page || !strings.Contains(section.Text, want.text) {
+			t.Errorf("section %d = page %d %q, want page %d containing %q", i, section.Page, section.Text, want.page, want.text)
+		}
+	}
+}
+
+func TestExtractPDFRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a pdf", []byte("hello")},
+		{"encrypted", buildTestPDF([]string{"<< /Type /Catalog >>"}, "<< /Root 1 0 R /Encrypt 2 0 R >>")},
+		{"no pages", buildTestPDF([]string{"<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [] >>"}, "<< /Root 1 0 R >>")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := extractPDF(tt.data); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestExtractPDFSelfReferencingPageTree(t *testing.T) {
+	data := buildTestPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [2 0 R 2 0 R] >>",
+	}, "<< /Root 1 0 R >>")
+
+	if _, err := extractPDFWithin(t, data, 5*time.Second); err == nil {
+		t.Fatal("expected error for page tree without pages")
+	}
+}
+
+func TestExtractPDFPageLimit(t *testing.T) {
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	var kids strings.Builder
+	for i := 0; i < pdfMaxPages+5; i++ {
+		fmt.Fprintf(&kids, "%d 0 R ", len(objects)+1)
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R >>")
+	}
+	objects[1] = "<< /Type /Pages /Kids [" + kids.String() + "] >>"
+
+	doc := parsePDF(buildTestPDF(objects, "<< /Root 1 0 R >>"))
+	if pages := doc.pages(); len(pages) != pdfMaxPages {
+		t.Fatalf("pages = %d, want %d", len(pages), pdfMaxPages)
+	}
+}
+
+func TestExtractPDFRepeatedContentStreamBudget(t *testing.T) {
+	payload := bytes.Repeat([]byte(" "), 16<<20)
+	payload = append(payload, []byte("BT (tail) Tj ET")...)
+	compressed := deflateTestData(t, payload)
+
+	refs := strings.Repeat("3 0 R ", 64)
+	var kids strings.Builder
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		testPDFStream("/Filter /FlateDecode", compressed),
+	}
+	for i := 0; i < 64; i++ {
+		fmt.Fprintf(&kids, "%d 0 R ", len(objects)+1)
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /Contents ["+refs+"] >>")
+	}
+	objects[1] = "<< /Type /Pages /Kids [" + kids.String() + "] >>"
+	data := buildTestPDF(objects, "<< /Root 1 0 R >>")
+
+	doc := parsePDF(data)
+	pages := doc.pages()
+	if len(pages) != 64 {
+		t.Fatalf("pages = %d, want 64", len(pages))
+	}
+	total := 0
+	for _, page := range pages {
+		total += len(doc.pageContent(page))
+	}
+	if total > pdfMaxDecodedBytes+len(pages) {
+		t.Fatalf("decoded %d bytes, exceeds budget %d", total, pdfMaxDecodedBytes)
+	}
+	if total == 0 {
+		t.Fatal("expected the first pages to be decoded")
+	}
+	if first := doc.pageContent(pages[0]); len(first) != 0 {
+		t.Fatalf("budget exhausted, but page content still returned %d bytes", len(first))
+	}
+}
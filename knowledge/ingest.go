@@ -0,0 +1,663 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// 入库任务状态。
+const (
+	IngestStatusPending   = "pending"
+	IngestStatusRunning   = "running"
+	IngestStatusSucceeded = "succeeded"
+	IngestStatusFailed    = "failed"
+	IngestStatusCanceled  = "canceled"
+)
+
+// 文档的索引状态。
+const (
+	DocumentIngestProcessing = "processing"
+	DocumentIngestReady      = "ready"
+	DocumentIngestFailed     = "failed"
+)
+
+const (
+	ingestQueueSize        = 256
+	defaultIngestWorkers   = 2
+	defaultIngestBatch     = 16
+	defaultIngestAttempts  = 3
+	defaultIngestTimeout   = 10 * time.Minute
+	defaultIngestPoll      = 15 * time.Second
+	ingestRetryBaseDelay   = 30 * time.Second
+	ingestStaleGrace       = time.Minute
+	embedBatchRetries      = 3
+	embedBatchRetryBackoff = time.Second
+)
+
+var (
+	// ErrIngestNotRetryable 表示文档当前没有可重试的失败任务。
+	ErrIngestNotRetryable = errors.New("knowledge: document has no failed ingest job")
+	// errIngestSuperseded 表示任务在提交前已被更新的任务取代或文档已删除。
+	errIngestSuperseded = errors.New("knowledge: ingest job superseded")
+)
+
+// ingestPermanentError 标记无需重试的失败原因。
+type ingestPermanentError struct{ err error }
+
+func (e ingestPermanentError) Error() string { return e.err.Error() }
+func (e ingestPermanentError) Unwrap() error { return e.err }
+
+// chunkerFor 返回应用智能体切分配置后的 chunker。
+func (s *Service) chunkerFor(ctx context.Context, agentID uint64) (*chunker, error) {
+	if s.chunkOptions == nil {
+		return s.chunker, nil
+	}
+	opts, err := s.chunkOptions(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.chunker.withOptions(opts), nil
+}
+
+// embeddingInput 返回切片用于向量化的文本，带标题路径时置于正文之前作为上下文。
+func embeddingInput(heading string, text string) string {
+	if heading == "" {
+		return text
+	}
+	return heading + "\n\n" + text
+}
+
+// createIngestJob 在事务内登记入库任务并取消该文档尚未完成的旧任务。
+// 被取消的旧任务需要重新切分正文时，新任务同样不会复用现有切片，并继承其文件段落。
+func (s *Service) createIngestJob(tx *gorm.DB, doc Document, userID uint64, sections []Section, reuse bool) (*IngestJob, error) {
+	var previous []IngestJob
+	if err := tx.Where("document_id = ? AND status IN ?", doc.ID,
+		[]string{IngestStatusPending, IngestStatusRunning, IngestStatusFailed}).
+		Order("id DESC").
+		Find(&previous).Error; err != nil {
+		return nil, err
+	}
+	var inherited datatypes.JSON
+	for _, job := range previous {
+		if !job.ReuseChunks {
+			reuse = false
+			if inherited == nil && len(job.Sections) > 0 {
+				inherited = job.Sections
+			}
+		}
+	}
+	if len(previous) > 0 {
+		now := time.Now().UTC()
+		ids := make([]uint64, len(previous))
+		for i, job := range previous {
+			ids[i] = job.ID
+		}
+		if err := tx.Model(&IngestJob{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":      IngestStatusCanceled,
+			"finished_at": now,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	job := IngestJob{
+		AgentID:     doc.AgentID,
+		DocumentID:  doc.ID,
+		Status:      IngestStatusPending,
+		ReuseChunks: reuse,
+		MaxAttempts: s.ingestAttempts,
+		CreatedBy:   userID,
+	}
+	if len(sections) > 0 {
+		raw, err := json.Marshal(sections)
+		if err != nil {
+			return nil, err
+		}
+		job.Sections = datatypes.JSON(raw)
+	} else if !reuse {
+		job.Sections = inherited
+	}
+	if err := tx.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// enqueueIngest 通知工作协程处理任务，队列已满时由定时轮询兜底。
+func (s *Service) enqueueIngest(jobID uint64) {
+	if s.ingestQueue == nil {
+		return
+	}
+	select {
+	case s.ingestQueue <- jobID:
+	default:
+	}
+}
+
+// StartIngestWorkers 启动入库工作协程池，并定期回收超时任务、拾取到期的待处理任务（含重启前遗留与退避重试的任务）。
+func (s *Service) StartIngestWorkers() {
+	if s == nil || s.db == nil || s.ingestQueue == nil {
+		return
+	}
+	workers := defaultIngestWorkers
+	if value, ok := envPositiveInt("KNOWLEDGE_INGEST_WORKERS"); ok {
+		workers = value
+	}
+	period := defaultIngestPoll
+	if value, ok := envPositiveInt("KNOWLEDGE_INGEST_POLL_SECONDS"); ok {
+		period = time.Duration(value) * time.Second
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for jobID := range s.ingestQueue {
+				s.runIngestJob(jobID)
+			}
+		}()
+	}
+	go func() {
+		s.resetStaleJobs()
+		s.pollIngestJobs(workers * 2)
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.resetStaleJobs()
+			s.pollIngestJobs(workers * 2)
+		}
+	}()
+}
+
+// resetStaleJobs 回收超时仍未结束的入库任务与索引重建，覆盖重启遗留与运行中工作协程卡死的情况。
+func (s *Service) resetStaleJobs() {
+	now := time.Now().UTC()
+	// 超过运行时限的 running 任务已不会由原协程完成，重新排队。
+	if err := s.db.Model(&IngestJob{}).
+		Where("status = ? AND (started_at IS NULL OR started_at < ?)", IngestStatusRunning, now.Add(-s.ingestTimeout()-ingestStaleGrace)).
+		Update("status", IngestStatusPending).Error; err != nil {
+		log.Printf("knowledge: reset stale ingest jobs failed: %v", err)
+	}
+	// 中断的索引重建标记为失败，重新触发时只处理尚未迁移的切片。
+	if err := s.db.Model(&KnowledgeIndex{}).
+		Where("status = ? AND (started_at IS NULL OR started_at < ?)", IndexStatusReindexing, now.Add(-s.reindexTimeout()-ingestStaleGrace)).
+		Updates(map[string]interface{}{"status": IndexStatusFailed, "last_error": "reindex interrupted"}).Error; err != nil {
+		log.Printf("knowledge: reset stale reindex failed: %v", err)
+	}
+}
+
+// pollIngestJobs 将到期的待处理任务放入队列。
+func (s *Service) pollIngestJobs(limit int) {
+	var ids []uint64
+	if err := s.db.Model(&IngestJob{}).
+		Where("status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", IngestStatusPending, time.Now().UTC()).
+		Order("id ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error; err != nil {
+		log.Printf("knowledge: load pending ingest jobs failed: %v", err)
+		return
+	}
+	for _, id := range ids {
+		s.enqueueIngest(id)
+	}
+}
+
+// runIngestJob 抢占并执行单个任务，失败时按剩余次数安排重试或标记失败。
+func (s *Service) runIngestJob(jobID uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.ingestTimeout())
+	defer cancel()
+
+	job, err := s.claimIngestJob(ctx, jobID)
+	if err != nil {
+		log.Printf("knowledge: claim ingest job %d failed: %v", jobID, err)
+		return
+	}
+	if job == nil {
+		return
+	}
+
+	err = s.processIngestJob(ctx, job)
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, errIngestSuperseded):
+		log.Printf("knowledge: ingest job %d superseded", job.ID)
+		return
+	}
+	log.Printf("knowledge: ingest job %d for document %d failed (attempt %d/%d): %v", job.ID, job.DocumentID, job.Attempts, job.MaxAttempts, err)
+	s.failIngestJob(job, err)
+}
+
+// claimIngestJob 通过条件更新抢占到期的待处理任务，任务已被其他协程处理时返回 nil。
+func (s *Service) claimIngestJob(ctx context.Context, jobID uint64) (*IngestJob, error) {
+	now := time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&IngestJob{}).
+		Where("id = ? AND status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", jobID, IngestStatusPending, now).
+		Updates(map[string]interface{}{
+			"status":           IngestStatusRunning,
+			"attempts":         gorm.Expr("attempts + 1"),
+			"processed_chunks": 0,
+			"started_at":       now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	var job IngestJob
+	if err := s.db.WithContext(ctx).Take(&job, jobID).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// processIngestJob 切分文档并按内容哈希与现有切片比对：未变化的切片沿用原向量，仅为新增或修改的切片分批向量化，
+// 最后在事务内替换切片记录并删除已移除切片的向量。仅元信息变化的任务只更新向量负载，不调用向量服务。
+func (s *Service) processIngestJob(ctx context.Context, job *IngestJob) error {
+	var doc Document
+	if err := s.db.WithContext(ctx).Where("id = ? AND agent_id = ?", job.DocumentID, job.AgentID).Take(&doc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errIngestSuperseded
+		}
+		return err
+	}
+
+	idx, err := s.indexFor(ctx, doc.AgentID)
+	if err != nil {
+		return err
+	}
+	var existing []Chunk
+	if err := s.db.WithContext(ctx).Where("document_id = ?", doc.ID).Order("seq ASC").Find(&existing).Error; err != nil {
+		return err
+	}
+	if job.ReuseChunks && len(existing) > 0 {
+		return s.patchIngestPayloads(ctx, job, doc, idx, existing)
+	}
+
+	var sections []Section
+	if len(job.Sections) > 0 {
+		if err := json.Unmarshal(job.Sections, &sections); err != nil {
+			return ingestPermanentError{fmt.Errorf("knowledge: decode job sections: %w", err)}
+		}
+	}
+	splitter, err := s.chunkerFor(ctx, doc.AgentID)
+	if err != nil {
+		return err
+	}
+	segments := splitter.segment(doc.Content, sections)
+	if len(segments) == 0 {
+		return ingestPermanentError{errors.New("knowledge: content is too short to chunk")}
+	}
+
+	collection := idx.collectionFor(s.embeddingVersion)
+	if err := s.vectors.EnsureCollection(ctx, collection, s.vectorSize()); err != nil {
+		return err
+	}
+
+	reusable := make(map[string][]Chunk)
+	for _, chunk := range existing {
+		if chunk.EmbeddingVersion != s.embeddingVersion {
+			continue
+		}
+		hash := chunk.ContentHash
+		if hash == "" {
+			hash = contentHash(chunk.Text)
+		}
+		reusable[hash] = append(reusable[hash], chunk)
+	}
+
+	chunks := make([]Chunk, len(segments))
+	previous := make(map[string]Chunk)
+	pending := make([]int, 0, len(segments))
+	for i, segment := range segments {
+		hash := contentHash(embeddingInput(segment.Heading, segment.Text))
+		chunks[i] = Chunk{
+			AgentID:          doc.AgentID,
+			DocumentID:       doc.ID,
+			Seq:              i + 1,
+			Text:             segment.Text,
+			Heading:          segment.Heading,
+			Page:             segment.Page,
+			TokenCount:       segment.TokenCount,
+			ContentHash:      hash,
+			EmbeddingVersion: s.embeddingVersion,
+		}
+		if candidates := reusable[hash]; len(candidates) > 0 {
+			chunks[i].VectorID = candidates[0].VectorID
+			previous[candidates[0].VectorID] = candidates[0]
+			reusable[hash] = candidates[1:]
+			continue
+		}
+		chunks[i].VectorID = uuid.NewString()
+		pending = append(pending, i)
+	}
+
+	processed := len(segments) - len(pending)
+	if err := s.db.WithContext(ctx).Model(&IngestJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"total_chunks":     len(segments),
+		"processed_chunks": processed,
+	}).Error; err != nil {
+		return err
+	}
+
+	tags := parseTags(doc.Tags)
+	newIDs := make([]string, 0, len(pending))
+	cleanup := func() {
+		if cleanupErr := s.vectors.DeletePoints(context.Background(), collection, newIDs); cleanupErr != nil {
+			log.Printf("knowledge: cleanup vector points failed: %v", cleanupErr)
+		}
+	}
+	batch := max(s.ingestBatch, 1)
+	for start := 0; start < len(pending); start += batch {
+		end := min(start+batch, len(pending))
+		texts := make([]string, 0, end-start)
+		for _, i := range pending[start:end] {
+			texts = append(texts, embeddingInput(chunks[i].Heading, chunks[i].Text))
+		}
+		vectors, err := s.embedWithRetry(ctx, texts)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		points := make([]VectorPoint, len(texts))
+		for j, i := range pending[start:end] {
+			points[j] = VectorPoint{ID: chunks[i].VectorID, Vector: vectors[j], Payload: chunkPayload(doc, chunks[i], tags)}
+		}
+		if err := s.vectors.UpsertPoints(ctx, collection, points); err != nil {
+			cleanup()
+			return err
+		}
+		for _, point := range points {
+			newIDs = append(newIDs, point.ID)
+		}
+		processed += len(points)
+		if err := s.db.WithContext(ctx).Model(&IngestJob{}).Where("id = ?", job.ID).
+			Update("processed_chunks", processed).Error; err != nil {
+			cleanup()
+			return err
+		}
+	}
+
+	if len(previous) > 0 {
+		if err := s.patchReusedPayloads(ctx, collection, doc, tags, chunks, previous); err != nil {
+			cleanup()
+			return err
+		}
+	}
+
+	var staleChunks []Chunk
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.completeIngestJob(tx, job, doc); err != nil {
+			return err
+		}
+		var current []Chunk
+		if err := tx.Select("id", "vector_id", "embedding_version").Where("document_id = ?", doc.ID).Find(&current).Error; err != nil {
+			return err
+		}
+		for _, chunk := range current {
+			if _, kept := previous[chunk.VectorID]; !kept {
+				staleChunks = append(staleChunks, chunk)
+			}
+		}
+		if err := tx.Where("document_id = ?", doc.ID).Delete(&Chunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&chunks).Error
+	})
+	if err != nil {
+		cleanup()
+		return err
+	}
+	if len(staleChunks) > 0 {
+		if err := s.deleteChunkVectors(ctx, idx, staleChunks); err != nil {
+			log.Printf("knowledge: delete stale vector points for document %d failed: %v", doc.ID, err)
+		}
+	}
+	return nil
+}
+
+// patchReusedPayloads 为沿用原向量的切片更新文档级负载，位置变化的切片单独更新序号、标题与页码。
+func (s *Service) patchReusedPayloads(ctx context.Context, collection string, doc Document, tags []string, chunks []Chunk, previous map[string]Chunk) error {
+	ids := make([]string, 0, len(previous))
+	for _, chunk := range chunks {
+		old, ok := previous[chunk.VectorID]
+		if !ok {
+			continue
+		}
+		ids = append(ids, chunk.VectorID)
+		if old.Seq == chunk.Seq && old.Heading == chunk.Heading && old.Page == chunk.Page {
+			continue
+		}
+		if err := s.vectors.SetPayload(ctx, collection, []string{chunk.VectorID}, locationPayload(chunk)); err != nil {
+			return err
+		}
+	}
+	return s.vectors.SetPayload(ctx, collection, ids, documentPayload(doc, tags))
+}
+
+// patchIngestPayloads 处理仅元信息变化的任务：按切片所在集合更新文档级负载，切片与向量保持不变。
+func (s *Service) patchIngestPayloads(ctx context.Context, job *IngestJob, doc Document, idx *KnowledgeIndex, chunks []Chunk) error {
+	if err := s.db.WithContext(ctx).Model(&IngestJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"total_chunks":     len(chunks),
+		"processed_chunks": 0,
+	}).Error; err != nil {
+		return err
+	}
+
+	payload := documentPayload(doc, parseTags(doc.Tags))
+	byCollection := make(map[string][]string)
+	for _, chunk := range chunks {
+		collection := idx.collectionFor(chunk.EmbeddingVersion)
+		byCollection[collection] = append(byCollection[collection], chunk.VectorID)
+	}
+	for collection, ids := range byCollection {
+		if err := s.vectors.SetPayload(ctx, collection, ids, payload); err != nil {
+			return err
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.completeIngestJob(tx, job, doc); err != nil {
+			return err
+		}
+		return tx.Model(&IngestJob{}).Where("id = ?", job.ID).Update("processed_chunks", len(chunks)).Error
+	})
+}
+
+// completeIngestJob 在事务内将仍在运行的任务标记为成功并恢复文档的就绪状态，任务已被取代时返回 errIngestSuperseded。
+func (s *Service) completeIngestJob(tx *gorm.DB, job *IngestJob, doc Document) error {
+	result := tx.Model(&IngestJob{}).
+		Where("id = ? AND status = ?", job.ID, IngestStatusRunning).
+		Updates(map[string]interface{}{
+			"status":      IngestStatusSucceeded,
+			"last_error":  gorm.Expr("NULL"),
+			"finished_at": time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errIngestSuperseded
+	}
+	return tx.Model(&Document{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+		"ingest_status": DocumentIngestReady,
+		"ingest_error":  gorm.Expr("NULL"),
+	}).Error
+}
+
+// embedWithRetry 对单个批次调用向量服务，失败时短暂退避后重试。
+func (s *Service) embedWithRetry(ctx context.Context, texts []string) ([][]float32, error) {
+	var lastErr error
+	for attempt := 0; attempt < embedBatchRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(embedBatchRetryBackoff << (attempt - 1)):
+			}
+		}
+		vectors, err := s.embedder.Embed(ctx, texts)
+		if err == nil && len(vectors) != len(texts) {
+			err = fmt.Errorf("knowledge: embedding count mismatch (expected %d, got %d)", len(texts), len(vectors))
+		}
+		if err == nil {
+			return vectors, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// failIngestJob 记录失败原因：仍有重试次数时按指数退避重新排队，否则将任务与文档标记为失败。
+func (s *Service) failIngestJob(job *IngestJob, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	message := truncateRunes(cause.Error(), 1000)
+	now := time.Now().UTC()
+	var permanent ingestPermanentError
+	retry := job.Attempts < job.MaxAttempts && !errors.As(cause, &permanent)
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"last_error": message}
+		if retry {
+			updates["status"] = IngestStatusPending
+			updates["next_attempt_at"] = now.Add(ingestRetryBaseDelay << (job.Attempts - 1))
+		} else {
+			updates["status"] = IngestStatusFailed
+			updates["finished_at"] = now
+		}
+		result := tx.Model(&IngestJob{}).Where("id = ? AND status = ?", job.ID, IngestStatusRunning).Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		docUpdates := map[string]interface{}{"ingest_error": message}
+		if !retry {
+			docUpdates["ingest_status"] = DocumentIngestFailed
+		}
+		return tx.Model(&Document{}).Where("id = ?", job.DocumentID).Updates(docUpdates).Error
+	})
+	if err != nil {
+		log.Printf("knowledge: record ingest failure for job %d failed: %v", job.ID, err)
+	}
+}
+
+// GetIngestJob 返回文档最近一次入库任务及其进度。
+func (s *Service) GetIngestJob(ctx context.Context, agentID uint64, docID uint64) (*IngestJob, error) {
+	if s.db == nil {
+		return nil, errors.New("knowledge: database connection is not configured")
+	}
+	var job IngestJob
+	if err := s.db.WithContext(ctx).
+		Where("agent_id = ? AND document_id = ?", agentID, docID).
+		Order("id DESC").
+		Take(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RetryIngest 重置文档最近一次失败的入库任务并重新排队。
+func (s *Service) RetryIngest(ctx context.Context, agentID uint64, docID uint64) (*IngestJob, error) {
+	job, err := s.GetIngestJob(ctx, agentID, docID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != IngestStatusFailed {
+		return nil, ErrIngestNotRetryable
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&IngestJob{}).
+			Where("id = ? AND status = ?", job.ID, IngestStatusFailed).
+			Updates(map[string]interface{}{
+				"status":           IngestStatusPending,
+				"attempts":         0,
+				"processed_chunks": 0,
+				"next_attempt_at":  gorm.Expr("NULL"),
+				"finished_at":      gorm.Expr("NULL"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrIngestNotRetryable
+		}
+		return tx.Model(&Document{}).Where("id = ?", docID).Updates(map[string]interface{}{
+			"ingest_status": DocumentIngestProcessing,
+			"ingest_error":  gorm.Expr("NULL"),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.enqueueIngest(job.ID)
+	return s.GetIngestJob(ctx, agentID, docID)
+}
+
+// RechunkDocuments 在切分配置变更后为智能体的全部文档登记重新切分任务，文件文档沿用最近一次解析的段落；
+// 内容未变化的切片仍沿用原向量。返回登记的任务数。
+func (s *Service) RechunkDocuments(ctx context.Context, agentID uint64, userID uint64) (int, error) {
+	if s.db == nil {
+		return 0, errors.New("knowledge: database connection is not configured")
+	}
+
+	var jobIDs []uint64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var docs []Document
+		if err := tx.Select("id", "agent_id").Where("agent_id = ?", agentID).Order("id ASC").Find(&docs).Error; err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			var latest []IngestJob
+			if err := tx.Select("id", "sections").
+				Where("document_id = ? AND reuse_chunks = ?", doc.ID, false).
+				Order("id DESC").
+				Limit(1).
+				Find(&latest).Error; err != nil {
+				return err
+			}
+			var sections []Section
+			if len(latest) > 0 && len(latest[0].Sections) > 0 {
+				if err := json.Unmarshal(latest[0].Sections, &sections); err != nil {
+					log.Printf("knowledge: decode sections of ingest job %d failed: %v", latest[0].ID, err)
+				}
+			}
+
+			if err := tx.Model(&Document{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+				"ingest_status": DocumentIngestProcessing,
+				"ingest_error":  gorm.Expr("NULL"),
+			}).Error; err != nil {
+				return err
+			}
+			job, err := s.createIngestJob(tx, doc, userID, sections, false)
+			if err != nil {
+				return err
+			}
+			jobIDs = append(jobIDs, job.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range jobIDs {
+		s.enqueueIngest(id)
+	}
+	return len(jobIDs), nil
+}
+
+// ingestTimeout 返回单个入库任务的最长运行时间。
+func (s *Service) ingestTimeout() time.Duration {
+	if value, ok := envPositiveInt("KNOWLEDGE_INGEST_TIMEOUT_MINUTES"); ok {
+		return time.Duration(value) * time.Minute
+	}
+	return defaultIngestTimeout
+}
@@ -0,0 +1,310 @@
+package knowledge
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestDB 创建单连接的内存 SQLite 数据库并迁移给定模型。
+func newTestDB(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestResetStaleJobs(t *testing.T) {
+	db := newTestDB(t, &IngestJob{}, &KnowledgeIndex{})
+	s := &Service{db: db}
+	now := time.Now().UTC()
+	longAgo := now.Add(-defaultIngestTimeout - defaultReindexTimeout - time.Hour)
+
+	staleJob := IngestJob{AgentID: 1, DocumentID: 1, Status: IngestStatusRunning, StartedAt: &longAgo}
+	activeJob := IngestJob{AgentID: 1, DocumentID: 2, Status: IngestStatusRunning, StartedAt: &now}
+	staleIndex := KnowledgeIndex{AgentID: 1, Collection: "c1", EmbeddingVersion: "v1", Status: IndexStatusReindexing, StartedAt: &longAgo}
+	activeIndex := KnowledgeIndex{AgentID: 2, Collection: "c2", EmbeddingVersion: "v1", Status: IndexStatusReindexing, StartedAt: &now}
+	for _, value := range []any{&staleJob, &activeJob, &staleIndex, &activeIndex} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatalf("create %T: %v", value, err)
+		}
+	}
+
+	s.resetStaleJobs()
+
+	jobs := map[uint64]string{staleJob.ID: IngestStatusPending, activeJob.ID: IngestStatusRunning}
+	for id, want := range jobs {
+		var job IngestJob
+		if err := db.Take(&job, id).Error; err != nil {
+			t.Fatalf("load job %d: %v", id, err)
+		}
+		if job.Status != want {
+			t.Errorf("job %d status = %q, want %q", id, job.Status, want)
+		}
+	}
+	indexes := map[uint64]string{staleIndex.ID: IndexStatusFailed, activeIndex.ID: IndexStatusReindexing}
+	for id, want := range indexes {
+		var idx KnowledgeIndex
+		if err := db.Take(&idx, id).Error; err != nil {
+			t.Fatalf("load index %d: %v", id, err)
+		}
+		if idx.Status != want {
+			t.Errorf("index %d status = %q, want %q", id, idx.Status, want)
+		}
+	}
+}
+
+// countingEmbedder 按文本哈希生成确定的向量（默认 4 维），并记录请求次数与输入。
+type countingEmbedder struct {
+	mu     sync.Mutex
+	dim    int
+	calls  int
+	inputs []string
+}
+
+func (e *countingEmbedder) Embed(_ context.Context, inputs []string) ([][]float32, error) {
+	e.mu.Lock()
+	e.calls++
+	e.inputs = append(e.inputs, inputs...)
+	dim := e.dim
+	e.mu.Unlock()
+	if dim <= 0 {
+		dim = 4
+	}
+	vectors := make([][]float32, len(inputs))
+	for i, input := range inputs {
+		sum := sha256.Sum256([]byte(input))
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(sum[j]) + 1
+		}
+	}
+	return vectors, nil
+}
+
+// take 返回并清空已记录的输入。
+func (e *countingEmbedder) take() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	inputs := e.inputs
+	e.inputs = nil
+	return inputs
+}
+
+// newIngestTestService 创建使用内存 SQLite、本地向量存储与计数向量器的服务，按 Markdown 标题切分。
+func newIngestTestService(t *testing.T) (*Service, *countingEmbedder) {
+	t.Helper()
+	db := newTestDB(t, &Document{}, &Chunk{}, &IngestJob{}, &KnowledgeIndex{})
+	embedder := &countingEmbedder{}
+	return &Service{
+		db:               db,
+		embedder:         embedder,
+		vectors:          newTestLocalStore(t, t.TempDir()),
+		chunker:          newChunker(ChunkStrategyMarkdown, 400, 200, 0),
+		keywords:         newKeywordIndexCache(4),
+		ingestBatch:      2,
+		ingestAttempts:   1,
+		embeddingVersion: "v1",
+		defaultVectorSz:  4,
+	}, embedder
+}
+
+// runTestIngest 登记并执行文档的入库任务。
+func runTestIngest(t *testing.T, s *Service, doc Document, reuse bool) {
+	t.Helper()
+	ctx := context.Background()
+	job, err := s.createIngestJob(s.db, doc, 1, nil, reuse)
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	claimed, err := s.claimIngestJob(ctx, job.ID)
+	if err != nil || claimed == nil {
+		t.Fatalf("claim job: %v", err)
+	}
+	if err := s.processIngestJob(ctx, claimed); err != nil {
+		t.Fatalf("process job: %v", err)
+	}
+}
+
+// documentChunks 按序号返回文档的切片。
+func documentChunks(t *testing.T, s *Service, docID uint64) []Chunk {
+	t.Helper()
+	var chunks []Chunk
+	if err := s.db.Where("document_id = ?", docID).Order("seq ASC").Find(&chunks).Error; err != nil {
+		t.Fatalf("load chunks: %v", err)
+	}
+	return chunks
+}
+
+// storedVectors 返回 4 维集合中的全部向量点，按 ID 排序。
+func storedVectors(t *testing.T, s *Service, collection string) []VectorSearchResult {
+	return storedVectorsOf(t, s, collection, 4)
+}
+
+// storedVectorsOf 返回指定维度集合中的全部向量点，按 ID 排序。
+func storedVectorsOf(t *testing.T, s *Service, collection string, dim int) []VectorSearchResult {
+	t.Helper()
+	query := make([]float32, dim)
+	for i := range query {
+		query[i] = 1
+	}
+	results, err := s.vectors.Search(context.Background(), collection, query, 1000, nil)
+	if err != nil {
+		t.Fatalf("search vectors: %v", err)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	return results
+}
+
+func vectorIDs(results []VectorSearchResult) []string {
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func chunkVectorIDs(chunks []Chunk) []string {
+	ids := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.VectorID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestProcessIngestJobReusesUnchangedChunks(t *testing.T) {
+	s, embedder := newIngestTestService(t)
+	doc := Document{AgentID: 1, Title: "Guide", Status: "active", CreatedBy: 1, UpdatedBy: 1,
+		Content: "# Alpha\n\nAlpha section text.\n\n# Beta\n\nBeta section text.\n\n# Gamma\n\nGamma section text."}
+	if err := s.db.Create(&doc).Error; err != nil {
+		t.Fatalf("create document: %v", err)
+	}
+
+	runTestIngest(t, s, doc, false)
+	first := documentChunks(t, s, doc.ID)
+	if len(first) != 3 || len(embedder.take()) != 3 {
+		t.Fatalf("initial ingest produced %d chunks", len(first))
+	}
+	idx, err := s.indexFor(context.Background(), doc.AgentID)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	collection := idx.collectionFor("v1")
+
+	// 修改 Beta、删除 Gamma、Alpha 不变。
+	doc.Content = "# Alpha\n\nAlpha section text.\n\n# Beta\n\nBeta section rewritten."
+	if err := s.db.Model(&doc).Update("content", doc.Content).Error; err != nil {
+		t.Fatalf("update document: %v", err)
+	}
+	runTestIngest(t, s, doc, false)
+
+	if got := embedder.take(); len(got) != 1 || got[0] != "Beta\n\nBeta section rewritten." {
+		t.Errorf("embedded inputs = %q, want only the changed chunk", got)
+	}
+	second := documentChunks(t, s, doc.ID)
+	if len(second) != 2 {
+		t.Fatalf("chunks = %d, want 2", len(second))
+	}
+	if second[0].VectorID != first[0].VectorID {
+		t.Errorf("unchanged chunk vector = %s, want %s", second[0].VectorID, first[0].VectorID)
+	}
+	if second[1].VectorID == first[1].VectorID {
+		t.Error("changed chunk kept its old vector")
+	}
+	if got, want := vectorIDs(storedVectors(t, s, collection)), chunkVectorIDs(second); !equalStrings(got, want) {
+		t.Errorf("stored vectors = %v, want %v (removed chunks deleted)", got, want)
+	}
+}
+
+func TestProcessIngestJobMetadataOnly(t *testing.T) {
+	s, embedder := newIngestTestService(t)
+	doc := Document{AgentID: 1, Title: "Old title", Status: "active", CreatedBy: 1, UpdatedBy: 1,
+		Content: "# Alpha\n\nAlpha section text.\n\n# Beta\n\nBeta section text."}
+	if err := s.db.Create(&doc).Error; err != nil {
+		t.Fatalf("create document: %v", err)
+	}
+	runTestIngest(t, s, doc, false)
+	before := documentChunks(t, s, doc.ID)
+	embedder.take()
+
+	doc.Title = "New title"
+	doc.Tags = []byte(`["faq"]`)
+	if err := s.db.Model(&doc).Updates(map[string]interface{}{"title": doc.Title, "tags": doc.Tags}).Error; err != nil {
+		t.Fatalf("update document: %v", err)
+	}
+	runTestIngest(t, s, doc, true)
+
+	if got := embedder.take(); len(got) != 0 {
+		t.Errorf("metadata-only edit embedded %q", got)
+	}
+	after := documentChunks(t, s, doc.ID)
+	if !equalStrings(chunkVectorIDs(after), chunkVectorIDs(before)) {
+		t.Errorf("chunks changed: %v -> %v", chunkVectorIDs(before), chunkVectorIDs(after))
+	}
+	idx, err := s.indexFor(context.Background(), doc.AgentID)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	for _, point := range storedVectors(t, s, idx.collectionFor("v1")) {
+		tags, _ := point.Payload["tags"].([]interface{})
+		if point.Payload["title"] != "New title" || len(tags) != 1 || tags[0] != "faq" {
+			t.Errorf("payload of %s = %v, want updated metadata", point.ID, point.Payload)
+		}
+	}
+	var job IngestJob
+	if err := s.db.Order("id DESC").Take(&job).Error; err != nil {
+		t.Fatalf("load job: %v", err)
+	}
+	if job.Status != IngestStatusSucceeded || job.ProcessedChunks != len(before) {
+		t.Errorf("job = %s with %d processed, want succeeded with %d", job.Status, job.ProcessedChunks, len(before))
+	}
+}
+
+func TestKeywordIndexRebuildsOnMetadataEdit(t *testing.T) {
+	s, _ := newIngestTestService(t)
+	doc := Document{AgentID: 1, Title: "Original", Status: "active", CreatedBy: 1, UpdatedBy: 1,
+		Content: "# Alpha\n\nAlpha section text."}
+	if err := s.db.Create(&doc).Error; err != nil {
+		t.Fatalf("create document: %v", err)
+	}
+	runTestIngest(t, s, doc, false)
+	ctx := context.Background()
+
+	first, err := s.keywordIndexFor(ctx, doc.AgentID)
+	if err != nil {
+		t.Fatalf("keyword index: %v", err)
+	}
+	if cached, _ := s.keywordIndexFor(ctx, doc.AgentID); cached != first {
+		t.Error("unchanged documents rebuilt the keyword index")
+	}
+
+	// 只修改标题：切片数量与 ID 不变，但标题参与关键词检索。
+	if err := s.db.Model(&doc).Updates(map[string]interface{}{"title": "Renamed", "updated_at": doc.UpdatedAt.Add(time.Second)}).Error; err != nil {
+		t.Fatalf("update document: %v", err)
+	}
+	rebuilt, err := s.keywordIndexFor(ctx, doc.AgentID)
+	if err != nil {
+		t.Fatalf("keyword index: %v", err)
+	}
+	if rebuilt == first || rebuilt.signature == first.signature {
+		t.Errorf("keyword index signature %q was not refreshed after a title edit", rebuilt.signature)
+	}
+}
@@ -0,0 +1,276 @@
+package knowledge
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	bm25K1                    = 1.2
+	bm25B                     = 0.75
+	defaultKeywordIndexAgents = 128
+)
+
+// keywordPosting 记录词项在某个切片中的出现次数。
+type keywordPosting struct {
+	entry int32
+	freq  int32
+}
+
+// keywordHit 表示关键词检索命中的切片及其 BM25 分数。
+type keywordHit struct {
+	ChunkID uint64
+	Score   float64
+}
+
+// keywordIndex 是单个智能体知识切片的内存倒排索引。
+type keywordIndex struct {
+	signature string
+	chunkIDs  []uint64
+	lengths   []int32
+	avgLength float64
+	postings  map[string][]keywordPosting
+	lastUsed  time.Time
+}
+
+// keywordDocument 为构建索引时读取的切片文本。
+type keywordDocument struct {
+	ID      uint64
+	Title   string
+	Heading string
+	Text    string
+}
+
+// buildKeywordIndex 根据切片文本构建倒排索引，标题与章节名一并参与匹配。
+func buildKeywordIndex(signature string, docs []keywordDocument) *keywordIndex {
+	idx := &keywordIndex{
+		signature: signature,
+		chunkIDs:  make([]uint64, len(docs)),
+		lengths:   make([]int32, len(docs)),
+		postings:  make(map[string][]keywordPosting),
+	}
+	total := 0
+	for i, doc := range docs {
+		idx.chunkIDs[i] = doc.ID
+		terms := tokenizeKeywords(doc.Title + "\n" + doc.Heading + "\n" + doc.Text)
+		idx.lengths[i] = int32(len(terms))
+		total += len(terms)
+
+		counts := make(map[string]int32, len(terms))
+		for _, term := range terms {
+			counts[term]++
+		}
+		for term, freq := range counts {
+			idx.postings[term] = append(idx.postings[term], keywordPosting{entry: int32(i), freq: freq})
+		}
+	}
+	if len(docs) > 0 {
+		idx.avgLength = float64(total) / float64(len(docs))
+	}
+	return idx
+}
+
+// search 使用 BM25 对查询词打分并返回得分最高的切片。
+func (idx *keywordIndex) search(query string, limit int) []keywordHit {
+	if idx == nil || len(idx.chunkIDs) == 0 || limit <= 0 {
+		return nil
+	}
+	terms := tokenizeKeywords(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(terms))
+	scores := make(map[int32]float64)
+	n := float64(len(idx.chunkIDs))
+	for _, term := range terms {
+		if _, ok := seen[term]; ok {
+			continue
+		}
+		seen[term] = struct{}{}
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, posting := range postings {
+			tf := float64(posting.freq)
+			norm := 1 - bm25B + bm25B*float64(idx.lengths[posting.entry])/math.Max(idx.avgLength, 1)
+			scores[posting.entry] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	hits := make([]keywordHit, 0, len(scores))
+	for entry, score := range scores {
+		hits = append(hits, keywordHit{ChunkID: idx.chunkIDs[entry], Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score == hits[j].Score {
+			return hits[i].ChunkID < hits[j].ChunkID
+		}
+		return hits[i].Score > hits[j].Score
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// tokenizeKeywords 切分检索词：字母数字按词切分并保留 "SKU-1234" 这类复合编码，中日韩文字生成单字与双字词。
+func tokenizeKeywords(text string) []string {
+	var (
+		tokens []string
+		word   []rune
+		parts  []string
+		cjk    []rune
+	)
+	flushWord := func() {
+		if len(word) > 0 {
+			parts = append(parts, string(word))
+			word = word[:0]
+		}
+	}
+	flushCompound := func(compound string) {
+		flushWord()
+		if len(parts) > 1 {
+			tokens = append(tokens, parts...)
+		}
+		compound = strings.Trim(compound, "-_./")
+		if compound != "" {
+			tokens = append(tokens, compound)
+		}
+		parts = parts[:0]
+	}
+	flushCJK := func() {
+		for i, r := range cjk {
+			tokens = append(tokens, string(r))
+			if i+1 < len(cjk) {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	var compound strings.Builder
+	runes := []rune(strings.ToLower(text))
+	for i, r := range runes {
+		switch {
+		case isCJKRune(r):
+			flushCompound(compound.String())
+			compound.Reset()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+			compound.WriteRune(r)
+		case strings.ContainsRune("-_./", r) && len(word) > 0 && i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || unicode.IsDigit(runes[i+1])) && !isCJKRune(runes[i+1]):
+			flushWord()
+			compound.WriteRune(r)
+		default:
+			flushCJK()
+			flushCompound(compound.String())
+			compound.Reset()
+		}
+	}
+	flushCJK()
+	flushCompound(compound.String())
+	return tokens
+}
+
+// isCJKRune 判断字符是否属于中日韩文字。
+func isCJKRune(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// keywordIndexCache 按智能体缓存倒排索引，超出容量时淘汰最久未使用的索引。
+type keywordIndexCache struct {
+	mu       sync.Mutex
+	capacity int
+	byAgent  map[uint64]*keywordIndex
+}
+
+// newKeywordIndexCache 创建索引缓存。
+func newKeywordIndexCache(capacity int) *keywordIndexCache {
+	if capacity <= 0 {
+		capacity = defaultKeywordIndexAgents
+	}
+	return &keywordIndexCache{capacity: capacity, byAgent: make(map[uint64]*keywordIndex)}
+}
+
+// get 返回签名一致的缓存索引。
+func (c *keywordIndexCache) get(agentID uint64, signature string) *keywordIndex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx, ok := c.byAgent[agentID]
+	if !ok || idx.signature != signature {
+		return nil
+	}
+	idx.lastUsed = time.Now()
+	return idx
+}
+
+// put 写入索引并在超出容量时淘汰最久未使用的条目。
+func (c *keywordIndexCache) put(agentID uint64, idx *keywordIndex) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx.lastUsed = time.Now()
+	c.byAgent[agentID] = idx
+	for len(c.byAgent) > c.capacity {
+		var (
+			oldestID uint64
+			oldest   time.Time
+		)
+		for id, candidate := range c.byAgent {
+			if oldest.IsZero() || candidate.lastUsed.Before(oldest) {
+				oldestID, oldest = id, candidate.lastUsed
+			}
+		}
+		delete(c.byAgent, oldestID)
+	}
+}
+
+// keywordIndexFor 返回智能体的关键词索引；切片集合变化（数量或最大 ID）或文档更新（如仅修改标题）时自动重建，多实例部署下同样有效。
+func (s *Service) keywordIndexFor(ctx context.Context, agentID uint64) (*keywordIndex, error) {
+	var stat struct {
+		Total     int64
+		MaxID     uint64
+		UpdatedAt sql.NullString
+	}
+	if err := s.db.WithContext(ctx).
+		Table(Chunk{}.TableName()+" AS c").
+		Select("COUNT(*) AS total, COALESCE(MAX(c.id), 0) AS max_id, MAX(d.updated_at) AS updated_at").
+		Joins("JOIN "+Document{}.TableName()+" AS d ON d.id = c.document_id").
+		Where("c.agent_id = ? AND d.status = ?", agentID, "active").
+		Scan(&stat).Error; err != nil {
+		return nil, err
+	}
+	signature := fmt.Sprintf("%d:%d:%s", stat.Total, stat.MaxID, stat.UpdatedAt.String)
+	if idx := s.keywords.get(agentID, signature); idx != nil {
+		return idx, nil
+	}
+
+	var docs []keywordDocument
+	if stat.Total > 0 {
+		if err := s.db.WithContext(ctx).
+			Table(Chunk{}.TableName()+" AS c").
+			Select("c.id AS id, d.title AS title, c.heading AS heading, c.text AS text").
+			Joins("JOIN "+Document{}.TableName()+" AS d ON d.id = c.document_id").
+			Where("c.agent_id = ? AND d.status = ?", agentID, "active").
+			Order("c.id ASC").
+			Scan(&docs).Error; err != nil {
+			return nil, err
+		}
+	}
+	idx := buildKeywordIndex(signature, docs)
+	s.keywords.put(agentID, idx)
+	return idx, nil
+}
@@ -0,0 +1,25 @@
+package knowledge
+
+import "testing"
+
+func TestTokenizeKeywords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"words", "Hello, World!", []string{"hello", "world"}},
+		{"compound code", "SKU-1234", []string{"sku", "1234", "sku-1234"}},
+		{"trailing separator", "v1.2.", []string{"v1", "2", "v1.2"}},
+		{"cjk bigrams", "知识库", []string{"知", "知识", "识", "识库", "库"}},
+		{"mixed scripts", "AI助手", []string{"ai", "助", "助手", "手"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenizeKeywords(tt.text); !equalStrings(got, tt.want) {
+				t.Errorf("tokenizeKeywords(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
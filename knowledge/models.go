@@ -8,18 +8,24 @@ import (
 
 // Document 描述知识库中的原始文档。
 type Document struct {
-	ID        uint64         `gorm:"primaryKey" json:"id"`
-	AgentID   uint64         `gorm:"not null;index:idx_agent_document" json:"agent_id"`
-	Title     string         `gorm:"size:200;not null" json:"title"`
-	Summary   *string        `gorm:"size:500" json:"summary,omitempty"`
-	Source    *string        `gorm:"size:255" json:"source,omitempty"`
-	Content   string         `gorm:"type:mediumtext;not null" json:"content"`
-	Tags      datatypes.JSON `gorm:"type:json" json:"tags,omitempty"`
-	Status    string         `gorm:"size:16;not null;default:'active'" json:"status"`
-	CreatedBy uint64         `gorm:"not null;index" json:"created_by"`
-	UpdatedBy uint64         `gorm:"not null" json:"updated_by"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
+	ID            uint64         `gorm:"primaryKey" json:"id"`
+	AgentID       uint64         `gorm:"not null;index:idx_agent_document" json:"agent_id"`
+	Title         string         `gorm:"size:200;not null" json:"title"`
+	Summary       *string        `gorm:"size:500" json:"summary,omitempty"`
+	Source        *string        `gorm:"size:255" json:"source,omitempty"`
+	FileURL       *string        `gorm:"size:512" json:"file_url,omitempty"`
+	CanonicalURL  *string        `gorm:"size:512;index" json:"canonical_url,omitempty"`
+	CrawlSourceID *uint64        `gorm:"index" json:"crawl_source_id,omitempty"`
+	ContentHash   string         `gorm:"size:64" json:"content_hash,omitempty"`
+	Content       string         `gorm:"type:mediumtext;not null" json:"content"`
+	Tags          datatypes.JSON `gorm:"type:json" json:"tags,omitempty"`
+	Status        string         `gorm:"size:16;not null;default:'active'" json:"status"`
+	IngestStatus  string         `gorm:"size:16;not null;default:'ready';index" json:"ingest_status"`
+	IngestError   *string        `gorm:"size:1000" json:"ingest_error,omitempty"`
+	CreatedBy     uint64         `gorm:"not null;index" json:"created_by"`
+	UpdatedBy     uint64         `gorm:"not null" json:"updated_by"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
 }
 
 // TableName 指定 Document 对应的数据库表名。
@@ -27,17 +33,21 @@ func (Document) TableName() string {
 	return "agent_knowledge_documents"
 }
 
-// Chunk 存储文档分片及其向量信息。
+// Chunk 存储文档分片及其向量信息，EmbeddingVersion 记录生成向量的模型与维度，ContentHash 用于更新时复用未变化切片的向量。
 type Chunk struct {
-	ID         uint64    `gorm:"primaryKey" json:"id"`
-	DocumentID uint64    `gorm:"not null;index:idx_document_seq" json:"document_id"`
-	AgentID    uint64    `gorm:"not null;index" json:"agent_id"`
-	Seq        int       `gorm:"not null;index:idx_document_seq" json:"seq"`
-	Text       string    `gorm:"type:text;not null" json:"text"`
-	VectorID   string    `gorm:"size:128;not null;uniqueIndex" json:"vector_id"`
-	TokenCount int       `gorm:"not null;default:0" json:"token_count"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID               uint64    `gorm:"primaryKey" json:"id"`
+	DocumentID       uint64    `gorm:"not null;index:idx_document_seq" json:"document_id"`
+	AgentID          uint64    `gorm:"not null;index" json:"agent_id"`
+	Seq              int       `gorm:"not null;index:idx_document_seq" json:"seq"`
+	Text             string    `gorm:"type:text;not null" json:"text"`
+	Heading          string    `gorm:"size:255" json:"heading,omitempty"`
+	Page             int       `gorm:"not null;default:0" json:"page,omitempty"`
+	VectorID         string    `gorm:"size:128;not null;uniqueIndex" json:"vector_id"`
+	TokenCount       int       `gorm:"not null;default:0" json:"token_count"`
+	ContentHash      string    `gorm:"size:64;not null;default:'';index" json:"content_hash"`
+	EmbeddingVersion string    `gorm:"size:128;not null;default:'';index" json:"embedding_version"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 // TableName 指定 Chunk 使用的数据库表。
@@ -45,6 +55,82 @@ func (Chunk) TableName() string {
 	return "agent_knowledge_chunks"
 }
 
+// CrawlSource 记录智能体知识库的网页抓取任务及最近一次运行结果。
+type CrawlSource struct {
+	ID              uint64         `gorm:"primaryKey" json:"id"`
+	AgentID         uint64         `gorm:"not null;index" json:"agent_id"`
+	URL             string         `gorm:"size:512;not null" json:"url"`
+	Mode            string         `gorm:"size:16;not null;default:'page'" json:"mode"`
+	MaxDepth        int            `gorm:"not null;default:1" json:"max_depth"`
+	MaxPages        int            `gorm:"not null;default:50" json:"max_pages"`
+	AllowedDomains  datatypes.JSON `gorm:"type:json" json:"allowed_domains,omitempty"`
+	IntervalMinutes int            `gorm:"not null;default:0" json:"interval_minutes"`
+	MaxBytes        int64          `gorm:"not null;default:0" json:"max_bytes"`
+	Status          string         `gorm:"size:16;not null;default:'idle';index" json:"status"`
+	LastError       *string        `gorm:"size:1000" json:"last_error,omitempty"`
+	LastStats       datatypes.JSON `gorm:"type:json" json:"last_stats,omitempty"`
+	LastStartedAt   *time.Time     `json:"last_started_at,omitempty"`
+	LastFinishedAt  *time.Time     `json:"last_finished_at,omitempty"`
+	NextRunAt       *time.Time     `gorm:"index" json:"next_run_at,omitempty"`
+	CreatedBy       uint64         `gorm:"not null;index" json:"created_by"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// TableName 指定 CrawlSource 使用的数据库表。
+func (CrawlSource) TableName() string {
+	return "agent_knowledge_crawl_sources"
+}
+
+// KnowledgeIndex 记录智能体当前用于检索的向量集合及其向量版本，以及进行中的重建任务。
+type KnowledgeIndex struct {
+	ID               uint64     `gorm:"primaryKey" json:"id"`
+	AgentID          uint64     `gorm:"not null;uniqueIndex" json:"agent_id"`
+	Collection       string     `gorm:"size:128;not null" json:"collection"`
+	EmbeddingVersion string     `gorm:"size:128;not null" json:"embedding_version"`
+	Status           string     `gorm:"size:16;not null;default:'ready';index" json:"status"`
+	TargetVersion    *string    `gorm:"size:128" json:"target_version,omitempty"`
+	TargetCollection *string    `gorm:"size:128" json:"target_collection,omitempty"`
+	TotalChunks      int        `gorm:"not null;default:0" json:"total_chunks"`
+	ProcessedChunks  int        `gorm:"not null;default:0" json:"processed_chunks"`
+	LastError        *string    `gorm:"size:1000" json:"last_error,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// TableName 指定 KnowledgeIndex 使用的数据库表。
+func (KnowledgeIndex) TableName() string {
+	return "agent_knowledge_indexes"
+}
+
+// IngestJob 记录文档切片与向量化任务，失败后按退避时间重试，超过次数后需手动重试。
+type IngestJob struct {
+	ID              uint64         `gorm:"primaryKey" json:"id"`
+	AgentID         uint64         `gorm:"not null;index" json:"agent_id"`
+	DocumentID      uint64         `gorm:"not null;index" json:"document_id"`
+	Status          string         `gorm:"size:16;not null;default:'pending';index" json:"status"`
+	ReuseChunks     bool           `gorm:"not null;default:false" json:"-"`
+	Sections        datatypes.JSON `gorm:"type:json" json:"-"`
+	Attempts        int            `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts     int            `gorm:"not null;default:3" json:"max_attempts"`
+	TotalChunks     int            `gorm:"not null;default:0" json:"total_chunks"`
+	ProcessedChunks int            `gorm:"not null;default:0" json:"processed_chunks"`
+	LastError       *string        `gorm:"size:1000" json:"last_error,omitempty"`
+	NextAttemptAt   *time.Time     `gorm:"index" json:"next_attempt_at,omitempty"`
+	StartedAt       *time.Time     `json:"started_at,omitempty"`
+	FinishedAt      *time.Time     `json:"finished_at,omitempty"`
+	CreatedBy       uint64         `gorm:"not null" json:"created_by"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// TableName 指定 IngestJob 使用的数据库表。
+func (IngestJob) TableName() string {
+	return "agent_knowledge_ingest_jobs"
+}
+
 // ChunkWithScore 结合召回分数与文档切片。
 type ChunkWithScore struct {
 	Chunk
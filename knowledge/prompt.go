@@ -0,0 +1,63 @@
+package knowledge
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ContextSnippetLimit 为对话中注入知识片段的默认数量。
+	ContextSnippetLimit = 4
+	// ContextExcerptChars 为单个知识片段写入提示的最大字符数。
+	ContextExcerptChars = 480
+)
+
+// BuildContextPrompt 生成带引用信息的知识提示，对话与检索调试共用。
+func BuildContextPrompt(snippets []ContextSnippet) string {
+	var builder strings.Builder
+	builder.WriteString("Agent knowledge references (cite as [Ref#] when used):\n")
+	for i, snippet := range snippets {
+		label := fmt.Sprintf("[Ref%d]", i+1)
+		builder.WriteString(label)
+		builder.WriteString(" ")
+		title := strings.TrimSpace(snippet.Title)
+		if title == "" {
+			title = fmt.Sprintf("Document %d", snippet.DocumentID)
+		}
+		builder.WriteString(title)
+		builder.WriteString("\n")
+		if snippet.Source != nil {
+			if source := strings.TrimSpace(*snippet.Source); source != "" {
+				builder.WriteString("Source: ")
+				builder.WriteString(source)
+				builder.WriteString("\n")
+			}
+		}
+		if snippet.Heading != "" {
+			builder.WriteString("Section: ")
+			builder.WriteString(snippet.Heading)
+			builder.WriteString("\n")
+		}
+		if snippet.Page > 0 {
+			builder.WriteString(fmt.Sprintf("Page: %d\n", snippet.Page))
+		}
+		excerpt := ContextExcerpt(snippet.Text)
+		if excerpt != "" {
+			builder.WriteString(excerpt)
+			builder.WriteString("\n")
+		}
+		builder.WriteString("---\n")
+	}
+	builder.WriteString("Use the knowledge above when it helps, and mention the reference label in brackets when quoting it.")
+	return builder.String()
+}
+
+// ContextExcerpt 截取片段正文用于提示，超出 ContextExcerptChars 时以省略号结尾。
+func ContextExcerpt(text string) string {
+	trimmed := strings.TrimSpace(text)
+	runes := []rune(trimmed)
+	if len(runes) <= ContextExcerptChars {
+		return trimmed
+	}
+	return string(runes[:ContextExcerptChars]) + "…"
+}
@@ -10,25 +10,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// QdrantPoint 表示写入向量数据库的单个点。
-type QdrantPoint struct {
-	ID      string                 `json:"id"`
-	Vector  []float32              `json:"vector"`
-	Payload map[string]interface{} `json:"payload,omitempty"`
-}
-
-// QdrantSearchResult 封装搜索结果及匹配分数。
-type QdrantSearchResult struct {
-	ID      string                 `json:"id"`
-	Score   float64                `json:"score"`
-	Payload map[string]interface{} `json:"payload"`
-}
-
 // qdrantClient 负责与 Qdrant 服务交互。
 type qdrantClient struct {
 	httpClient *http.Client
@@ -54,18 +41,11 @@ func newQdrantClientFromEnv() (*qdrantClient, error) {
 
 	apiKey := strings.TrimSpace(os.Getenv("QDRANT_API_KEY"))
 
-	vectorSize := 0
-	if raw := strings.TrimSpace(os.Getenv("QDRANT_VECTOR_DIM")); raw != "" {
-		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
-			vectorSize = parsed
-		}
-	}
-
 	client := &qdrantClient{
 		httpClient: &http.Client{Timeout: 10 * time.Second},
 		baseURL:    baseURL,
 		apiKey:     apiKey,
-		vectorSize: vectorSize,
+		vectorSize: vectorDimFromEnv(),
 	}
 	return client, nil
 }
@@ -126,8 +106,35 @@ func (c *qdrantClient) EnsureCollection(ctx context.Context, name string, vector
 	return nil
 }
 
+// DeleteCollection 删除集合，集合不存在时视为成功。
+func (c *qdrantClient) DeleteCollection(ctx context.Context, name string) error {
+	if c == nil {
+		return errors.New("knowledge: qdrant client is not configured")
+	}
+	endpoint := fmt.Sprintf("%s/collections/%s", c.baseURL, url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("knowledge: create delete collection request: %w", err)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("api-key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("knowledge: delete collection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("knowledge: delete collection status %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
 // UpsertPoints 批量写入或更新向量数据点。
-func (c *qdrantClient) UpsertPoints(ctx context.Context, collection string, points []QdrantPoint) error {
+func (c *qdrantClient) UpsertPoints(ctx context.Context, collection string, points []VectorPoint) error {
 	if c == nil {
 		return errors.New("knowledge: qdrant client is not configured")
 	}
@@ -164,6 +171,44 @@ func (c *qdrantClient) UpsertPoints(ctx context.Context, collection string, poin
 	return nil
 }
 
+// SetPayload 合并更新指定向量点的负载，不改动向量本身。
+func (c *qdrantClient) SetPayload(ctx context.Context, collection string, pointIDs []string, payload map[string]interface{}) error {
+	if c == nil {
+		return errors.New("knowledge: qdrant client is not configured")
+	}
+	if len(pointIDs) == 0 || len(payload) == 0 {
+		return nil
+	}
+
+	request := map[string]interface{}{"points": pointIDs, "payload": payload}
+	body := &bytes.Buffer{}
+	if err := json.NewEncoder(body).Encode(request); err != nil {
+		return fmt.Errorf("knowledge: encode set payload request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/collections/%s/points/payload", c.baseURL, url.PathEscape(collection))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("knowledge: create set payload request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("api-key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("knowledge: set payload request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("knowledge: set payload status %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
 // DeletePoints 删除集合中的指定向量点。
 func (c *qdrantClient) DeletePoints(ctx context.Context, collection string, pointIDs []string) error {
 	if c == nil {
@@ -203,7 +248,7 @@ func (c *qdrantClient) DeletePoints(ctx context.Context, collection string, poin
 }
 
 // Search 在集合内执行相似度搜索并返回结果。
-func (c *qdrantClient) Search(ctx context.Context, collection string, vector []float32, limit int, filter map[string]interface{}) ([]QdrantSearchResult, error) {
+func (c *qdrantClient) Search(ctx context.Context, collection string, vector []float32, limit int, filter PayloadFilter) ([]VectorSearchResult, error) {
 	if c == nil {
 		return nil, errors.New("knowledge: qdrant client is not configured")
 	}
@@ -219,8 +264,8 @@ func (c *qdrantClient) Search(ctx context.Context, collection string, vector []f
 		"limit":        limit,
 		"with_payload": true,
 	}
-	if filter != nil {
-		payload["filter"] = filter
+	if len(filter) > 0 {
+		payload["filter"] = qdrantFilter(filter)
 	}
 
 	body := &bytes.Buffer{}
@@ -260,10 +305,10 @@ func (c *qdrantClient) Search(ctx context.Context, collection string, vector []f
 		return nil, fmt.Errorf("knowledge: decode search response: %w", err)
 	}
 
-	results := make([]QdrantSearchResult, 0, len(decoded.Result))
+	results := make([]VectorSearchResult, 0, len(decoded.Result))
 	for _, item := range decoded.Result {
 		identifier := stringifyQdrantID(item.ID)
-		results = append(results, QdrantSearchResult{
+		results = append(results, VectorSearchResult{
 			ID:      identifier,
 			Score:   item.Score,
 			Payload: item.Payload,
@@ -272,6 +317,23 @@ func (c *qdrantClient) Search(ctx context.Context, collection string, vector []f
 	return results, nil
 }
 
+// qdrantFilter 将负载过滤条件转换为 Qdrant 的 must 匹配条件。
+func qdrantFilter(filter PayloadFilter) map[string]interface{} {
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	must := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		must = append(must, map[string]interface{}{
+			"key":   key,
+			"match": map[string]interface{}{"value": filter[key]},
+		})
+	}
+	return map[string]interface{}{"must": must}
+}
+
 // stringifyQdrantID 将返回的点标识统一转换为字符串。
 func stringifyQdrantID(id interface{}) string {
 	switch v := id.(type) {
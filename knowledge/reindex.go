@@ -0,0 +1,416 @@
+package knowledge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 向量索引状态。
+const (
+	IndexStatusReady      = "ready"
+	IndexStatusReindexing = "reindexing"
+	IndexStatusFailed     = "failed"
+)
+
+const (
+	reindexBatchSize      = 64
+	defaultReindexTimeout = 2 * time.Hour
+)
+
+var (
+	// ErrReindexRunning 表示该智能体的向量索引正在重建。
+	ErrReindexRunning = errors.New("knowledge: reindex is already running")
+	// errIndexOutdated 表示当前检索集合的向量版本与配置的向量模型不一致，需要重建。
+	errIndexOutdated = errors.New("knowledge: vector index was built with a different embedding model, reindex required")
+)
+
+// IndexStatus 描述智能体向量索引的当前状态及待重建的切片数量。
+type IndexStatus struct {
+	KnowledgeIndex
+	CurrentVersion string `json:"current_version"`
+	StaleChunks    int64  `json:"stale_chunks"`
+	NeedsReindex   bool   `json:"needs_reindex"`
+}
+
+// versionedEmbedder 由能够报告模型标识的向量器实现。
+type versionedEmbedder interface {
+	ModelVersion() string
+}
+
+// resolveEmbeddingVersion 返回向量版本标识（模型@维度），可通过 KNOWLEDGE_EMBEDDING_VERSION 覆盖。
+func resolveEmbeddingVersion(embedder Embedder, dim int) string {
+	if override := getEnvDefault("KNOWLEDGE_EMBEDDING_VERSION", ""); override != "" {
+		return truncateRunes(override, 128)
+	}
+	model := "default"
+	if versioned, ok := embedder.(versionedEmbedder); ok && versioned.ModelVersion() != "" {
+		model = versioned.ModelVersion()
+	}
+	if dim > 0 {
+		model = fmt.Sprintf("%s@%d", model, dim)
+	}
+	return truncateRunes(model, 128)
+}
+
+// legacyCollectionName 返回未引入版本前按智能体命名的集合。
+func legacyCollectionName(agentID uint64) string {
+	if agentID == 0 {
+		return "agent_knowledge"
+	}
+	return fmt.Sprintf("agent_%d_knowledge", agentID)
+}
+
+// versionedCollectionName 返回智能体在指定向量版本下的集合名称。
+func versionedCollectionName(agentID uint64, version string) string {
+	sum := sha256.Sum256([]byte(version))
+	return fmt.Sprintf("%s_%s", legacyCollectionName(agentID), hex.EncodeToString(sum[:])[:10])
+}
+
+// collectionFor 返回指定向量版本的切片所在集合。
+func (idx *KnowledgeIndex) collectionFor(version string) string {
+	if version == "" || version == idx.EmbeddingVersion {
+		return idx.Collection
+	}
+	return versionedCollectionName(idx.AgentID, version)
+}
+
+// indexFor 返回智能体的向量索引记录，不存在时创建。
+// 已有切片但没有索引记录的智能体沿用旧集合，并视为由当前向量模型生成。
+func (s *Service) indexFor(ctx context.Context, agentID uint64) (*KnowledgeIndex, error) {
+	var idx KnowledgeIndex
+	err := s.db.WithContext(ctx).Where("agent_id = ?", agentID).Take(&idx).Error
+	if err == nil {
+		return &idx, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var legacy int64
+	if err := s.db.WithContext(ctx).Model(&Chunk{}).
+		Where("agent_id = ? AND embedding_version = ?", agentID, "").
+		Count(&legacy).Error; err != nil {
+		return nil, err
+	}
+	idx = KnowledgeIndex{
+		AgentID:          agentID,
+		Collection:       versionedCollectionName(agentID, s.embeddingVersion),
+		EmbeddingVersion: s.embeddingVersion,
+		Status:           IndexStatusReady,
+	}
+	if legacy > 0 {
+		idx.Collection = legacyCollectionName(agentID)
+		if err := s.db.WithContext(ctx).Model(&Chunk{}).
+			Where("agent_id = ? AND embedding_version = ?", agentID, "").
+			Update("embedding_version", s.embeddingVersion).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&idx).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Where("agent_id = ?", agentID).Take(&idx).Error; err != nil {
+		return nil, err
+	}
+	return &idx, nil
+}
+
+// deleteChunkVectors 按切片的向量版本分组删除向量点。
+func (s *Service) deleteChunkVectors(ctx context.Context, idx *KnowledgeIndex, chunks []Chunk) error {
+	byCollection := make(map[string][]string)
+	for _, chunk := range chunks {
+		collection := idx.collectionFor(chunk.EmbeddingVersion)
+		byCollection[collection] = append(byCollection[collection], chunk.VectorID)
+	}
+	for collection, ids := range byCollection {
+		if err := s.vectors.DeletePoints(ctx, collection, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetIndexStatus 返回智能体的向量索引状态。
+func (s *Service) GetIndexStatus(ctx context.Context, agentID uint64) (*IndexStatus, error) {
+	if s.db == nil {
+		return nil, errors.New("knowledge: database connection is not configured")
+	}
+	idx, err := s.indexFor(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	var stale int64
+	if err := s.db.WithContext(ctx).Model(&Chunk{}).
+		Where("agent_id = ? AND embedding_version <> ?", agentID, s.embeddingVersion).
+		Count(&stale).Error; err != nil {
+		return nil, err
+	}
+	return &IndexStatus{
+		KnowledgeIndex: *idx,
+		CurrentVersion: s.embeddingVersion,
+		StaleChunks:    stale,
+		NeedsReindex:   idx.EmbeddingVersion != s.embeddingVersion || stale > 0,
+	}, nil
+}
+
+// StartReindex 在后台用当前向量模型重建智能体的向量集合，完成后切换检索集合并清理旧集合。
+// 索引已是最新时返回 false。
+func (s *Service) StartReindex(ctx context.Context, agentID uint64) (*IndexStatus, bool, error) {
+	status, err := s.GetIndexStatus(ctx, agentID)
+	if err != nil {
+		return nil, false, err
+	}
+	if status.Status == IndexStatusReindexing {
+		return nil, false, ErrReindexRunning
+	}
+	if !status.NeedsReindex {
+		return status, false, nil
+	}
+
+	target := s.embeddingVersion
+	targetCollection := status.collectionFor(target)
+	now := time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&KnowledgeIndex{}).
+		Where("id = ? AND status <> ?", status.ID, IndexStatusReindexing).
+		Updates(map[string]interface{}{
+			"status":            IndexStatusReindexing,
+			"target_version":    target,
+			"target_collection": targetCollection,
+			"total_chunks":      status.StaleChunks,
+			"processed_chunks":  0,
+			"last_error":        gorm.Expr("NULL"),
+			"started_at":        now,
+			"finished_at":       gorm.Expr("NULL"),
+		})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, false, ErrReindexRunning
+	}
+
+	go s.runReindex(agentID)
+
+	status, err = s.GetIndexStatus(ctx, agentID)
+	if err != nil {
+		return nil, false, err
+	}
+	return status, true, nil
+}
+
+// runReindex 分批为旧版本切片重新生成向量写入目标集合，随后原子切换检索集合。
+func (s *Service) runReindex(agentID uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.reindexTimeout())
+	defer cancel()
+
+	idx, err := s.indexFor(ctx, agentID)
+	if err != nil {
+		log.Printf("knowledge: load index for agent %d failed: %v", agentID, err)
+		return
+	}
+	if idx.TargetVersion == nil || idx.TargetCollection == nil {
+		return
+	}
+	if err := s.reindexChunks(ctx, idx); err != nil {
+		log.Printf("knowledge: reindex for agent %d failed: %v", agentID, err)
+		message := truncateRunes(err.Error(), 1000)
+		if updateErr := s.db.Model(&KnowledgeIndex{}).
+			Where("id = ? AND status = ?", idx.ID, IndexStatusReindexing).
+			Updates(map[string]interface{}{
+				"status":      IndexStatusFailed,
+				"last_error":  message,
+				"finished_at": time.Now().UTC(),
+			}).Error; updateErr != nil {
+			log.Printf("knowledge: record reindex failure for agent %d failed: %v", agentID, updateErr)
+		}
+		return
+	}
+	log.Printf("knowledge: reindex for agent %d switched to %s", agentID, *idx.TargetCollection)
+}
+
+// reindexChunks 执行重建并切换集合，旧集合在切换后删除。
+func (s *Service) reindexChunks(ctx context.Context, idx *KnowledgeIndex) error {
+	target := *idx.TargetVersion
+	targetCollection := *idx.TargetCollection
+	if err := s.vectors.EnsureCollection(ctx, targetCollection, s.vectorSize()); err != nil {
+		return err
+	}
+
+	obsolete := map[string]struct{}{idx.Collection: {}}
+	processed := 0
+	for {
+		var chunks []Chunk
+		if err := s.db.WithContext(ctx).
+			Where("agent_id = ? AND embedding_version <> ?", idx.AgentID, target).
+			Order("id ASC").
+			Limit(reindexBatchSize).
+			Find(&chunks).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			break
+		}
+
+		docIDs := make([]uint64, 0, len(chunks))
+		texts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			docIDs = append(docIDs, chunk.DocumentID)
+			texts[i] = embeddingInput(chunk.Heading, chunk.Text)
+			obsolete[idx.collectionFor(chunk.EmbeddingVersion)] = struct{}{}
+		}
+		var docs []Document
+		if err := s.db.WithContext(ctx).
+			Omit("content").
+			Where("id IN ?", docIDs).
+			Find(&docs).Error; err != nil {
+			return err
+		}
+		docByID := make(map[uint64]Document, len(docs))
+		for _, doc := range docs {
+			docByID[doc.ID] = doc
+		}
+
+		embeddings, err := s.embedWithRetry(ctx, texts)
+		if err != nil {
+			return err
+		}
+		points := make([]VectorPoint, 0, len(chunks))
+		ids := make([]uint64, 0, len(chunks))
+		for i, chunk := range chunks {
+			doc, ok := docByID[chunk.DocumentID]
+			if !ok {
+				continue
+			}
+			points = append(points, VectorPoint{
+				ID:      chunk.VectorID,
+				Vector:  embeddings[i],
+				Payload: chunkPayload(doc, chunk, parseTags(doc.Tags)),
+			})
+			ids = append(ids, chunk.ID)
+		}
+		if err := s.vectors.UpsertPoints(ctx, targetCollection, points); err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := s.db.WithContext(ctx).Model(&Chunk{}).
+				Where("id IN ?", ids).
+				Update("embedding_version", target).Error; err != nil {
+				return err
+			}
+		}
+		// 所属文档已删除的孤立切片直接清除，避免重复处理。
+		if len(ids) < len(chunks) {
+			orphans := make([]uint64, 0, len(chunks)-len(ids))
+			for _, chunk := range chunks {
+				if _, ok := docByID[chunk.DocumentID]; !ok {
+					orphans = append(orphans, chunk.ID)
+				}
+			}
+			if err := s.db.WithContext(ctx).Where("id IN ?", orphans).Delete(&Chunk{}).Error; err != nil {
+				return err
+			}
+		}
+
+		processed += len(chunks)
+		if err := s.db.WithContext(ctx).Model(&KnowledgeIndex{}).
+			Where("id = ?", idx.ID).
+			Update("processed_chunks", processed).Error; err != nil {
+			return err
+		}
+	}
+
+	result := s.db.WithContext(ctx).Model(&KnowledgeIndex{}).
+		Where("id = ? AND status = ?", idx.ID, IndexStatusReindexing).
+		Updates(map[string]interface{}{
+			"collection":        targetCollection,
+			"embedding_version": target,
+			"status":            IndexStatusReady,
+			"target_version":    gorm.Expr("NULL"),
+			"target_collection": gorm.Expr("NULL"),
+			"finished_at":       time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("knowledge: reindex state changed during rebuild")
+	}
+
+	delete(obsolete, targetCollection)
+	for collection := range obsolete {
+		if err := s.vectors.DeleteCollection(ctx, collection); err != nil {
+			log.Printf("knowledge: delete obsolete collection %s failed: %v", collection, err)
+		}
+	}
+	return nil
+}
+
+// reindexTimeout 返回单次重建的最长运行时间。
+func (s *Service) reindexTimeout() time.Duration {
+	if value, ok := envPositiveInt("KNOWLEDGE_REINDEX_TIMEOUT_MINUTES"); ok {
+		return time.Duration(value) * time.Minute
+	}
+	return defaultReindexTimeout
+}
+
+// chunkPayload 构建切片写入向量库的负载。
+func chunkPayload(doc Document, chunk Chunk, tags []string) map[string]interface{} {
+	payload := documentPayload(doc, tags)
+	for key, value := range locationPayload(chunk) {
+		payload[key] = value
+	}
+	payload["text"] = chunk.Text
+	for key, value := range payload {
+		if value == nil {
+			delete(payload, key)
+		}
+	}
+	return payload
+}
+
+// documentPayload 返回负载中的文档级字段，未设置的字段为 nil，合并更新时会被清除。
+func documentPayload(doc Document, tags []string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"agent_id":    doc.AgentID,
+		"document_id": doc.ID,
+		"title":       doc.Title,
+		"status":      doc.Status,
+		"source":      nil,
+		"summary":     nil,
+		"tags":        nil,
+	}
+	if doc.Source != nil {
+		payload["source"] = *doc.Source
+	}
+	if doc.Summary != nil {
+		payload["summary"] = *doc.Summary
+	}
+	if len(tags) > 0 {
+		payload["tags"] = tags
+	}
+	return payload
+}
+
+// locationPayload 返回切片的序号、标题与页码字段，未设置的字段为 nil。
+func locationPayload(chunk Chunk) map[string]interface{} {
+	payload := map[string]interface{}{
+		"seq":     chunk.Seq,
+		"heading": nil,
+		"page":    nil,
+	}
+	if chunk.Heading != "" {
+		payload["heading"] = chunk.Heading
+	}
+	if chunk.Page > 0 {
+		payload["page"] = chunk.Page
+	}
+	return payload
+}
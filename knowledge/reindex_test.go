@@ -0,0 +1,212 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedLegacyChunks 写入未记录向量版本的文档切片，并把向量写入旧的按智能体命名的集合。
+func seedLegacyChunks(t *testing.T, s *Service, agentID uint64, count int) Document {
+	t.Helper()
+	ctx := context.Background()
+	doc := Document{AgentID: agentID, Title: "Legacy", Content: "legacy", Status: "active", CreatedBy: 1, UpdatedBy: 1}
+	if err := s.db.Create(&doc).Error; err != nil {
+		t.Fatalf("create document: %v", err)
+	}
+	collection := legacyCollectionName(agentID)
+	if err := s.vectors.EnsureCollection(ctx, collection, 4); err != nil {
+		t.Fatalf("ensure legacy collection: %v", err)
+	}
+	texts := make([]string, count)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("legacy chunk %d", i)
+	}
+	vectors, _ := s.embedder.Embed(ctx, texts)
+	points := make([]VectorPoint, count)
+	for i, text := range texts {
+		chunk := Chunk{DocumentID: doc.ID, AgentID: agentID, Seq: i, Text: text, VectorID: fmt.Sprintf("legacy-%d-%d", agentID, i)}
+		if err := s.db.Create(&chunk).Error; err != nil {
+			t.Fatalf("create chunk: %v", err)
+		}
+		points[i] = VectorPoint{ID: chunk.VectorID, Vector: vectors[i], Payload: chunkPayload(doc, chunk, nil)}
+	}
+	if err := s.vectors.UpsertPoints(ctx, collection, points); err != nil {
+		t.Fatalf("upsert legacy vectors: %v", err)
+	}
+	return doc
+}
+
+// waitForIndex 等待后台重建结束并返回最终状态。
+func waitForIndex(t *testing.T, s *Service, agentID uint64) *IndexStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := s.GetIndexStatus(context.Background(), agentID)
+		if err != nil {
+			t.Fatalf("index status: %v", err)
+		}
+		if status.Status != IndexStatusReindexing {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reindex did not finish: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIndexForAdoptsLegacyCollection(t *testing.T) {
+	s, _ := newIngestTestService(t)
+	ctx := context.Background()
+	seedLegacyChunks(t, s, 1, 2)
+
+	idx, err := s.indexFor(ctx, 1)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if idx.Collection != legacyCollectionName(1) || idx.EmbeddingVersion != "v1" || idx.Status != IndexStatusReady {
+		t.Errorf("legacy index = %+v, want the legacy collection at the current version", idx)
+	}
+	var unversioned int64
+	s.db.Model(&Chunk{}).Where("agent_id = ? AND embedding_version = ?", 1, "").Count(&unversioned)
+	if unversioned != 0 {
+		t.Errorf("%d legacy chunks were not stamped with the current version", unversioned)
+	}
+	if again, err := s.indexFor(ctx, 1); err != nil || again.ID != idx.ID {
+		t.Errorf("second lookup = %+v, %v, want the same record", again, err)
+	}
+
+	fresh, err := s.indexFor(ctx, 2)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if fresh.Collection != versionedCollectionName(2, "v1") || fresh.Collection == legacyCollectionName(2) {
+		t.Errorf("new agent collection = %s, want a versioned name", fresh.Collection)
+	}
+	if idx.collectionFor("v1") != idx.Collection || idx.collectionFor("v2") != versionedCollectionName(1, "v2") {
+		t.Error("collectionFor does not map versions to collections")
+	}
+}
+
+func TestReindexSwitchesEmbeddingVersion(t *testing.T) {
+	s, embedder := newIngestTestService(t)
+	ctx := context.Background()
+	// 旧集合中的切片多于一个批次，覆盖分批迁移。
+	seedLegacyChunks(t, s, 1, reindexBatchSize+6)
+
+	var sections []string
+	for _, name := range []string{"Alpha", "Beta", "Gamma"} {
+		sections = append(sections, "# "+name+"\n\n"+name+" section text.")
+	}
+	doc := Document{AgentID: 1, Title: "Guide", Content: strings.Join(sections, "\n\n"), Status: "active", CreatedBy: 1, UpdatedBy: 1}
+	if err := s.db.Create(&doc).Error; err != nil {
+		t.Fatalf("create document: %v", err)
+	}
+	runTestIngest(t, s, doc, false)
+	// 所属文档已删除的孤立切片。
+	orphan := Chunk{DocumentID: 9999, AgentID: 1, Seq: 0, Text: "orphan", VectorID: "orphan", EmbeddingVersion: "v1"}
+	if err := s.db.Create(&orphan).Error; err != nil {
+		t.Fatalf("create orphan: %v", err)
+	}
+	oldIdx, err := s.indexFor(ctx, 1)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if oldIdx.Collection != legacyCollectionName(1) {
+		t.Fatalf("collection = %s, want the adopted legacy collection", oldIdx.Collection)
+	}
+	total := reindexBatchSize + 6 + 3 + 1
+
+	// 切换到维度不同的新向量模型，重建前检索报告索引过期。
+	embedder.mu.Lock()
+	embedder.dim = 3
+	embedder.calls = 0
+	embedder.inputs = nil
+	embedder.mu.Unlock()
+	s.embeddingVersion = "v2"
+	s.defaultVectorSz = 3
+	if _, err := s.vectorSearch(ctx, 1, "Alpha", 5); !errors.Is(err, errIndexOutdated) {
+		t.Fatalf("search before reindex = %v, want errIndexOutdated", err)
+	}
+	status, started, err := s.StartReindex(ctx, 1)
+	if err != nil || !started {
+		t.Fatalf("start reindex = %v, %v", started, err)
+	}
+	if status.StaleChunks != int64(total) {
+		t.Errorf("stale chunks = %d, want %d", status.StaleChunks, total)
+	}
+
+	final := waitForIndex(t, s, 1)
+	newCollection := versionedCollectionName(1, "v2")
+	if final.Status != IndexStatusReady || final.Collection != newCollection || final.EmbeddingVersion != "v2" ||
+		final.TargetVersion != nil || final.TargetCollection != nil || final.NeedsReindex {
+		t.Fatalf("index after reindex = %+v", final)
+	}
+	if final.ProcessedChunks != total {
+		t.Errorf("processed = %d, want %d", final.ProcessedChunks, total)
+	}
+	embedder.mu.Lock()
+	calls := embedder.calls
+	embedder.mu.Unlock()
+	if calls != 2 {
+		t.Errorf("embed calls = %d, want 2 batches", calls)
+	}
+
+	var chunks []Chunk
+	s.db.Where("agent_id = ?", 1).Find(&chunks)
+	if len(chunks) != total-1 {
+		t.Errorf("chunks = %d, want orphan removed", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if chunk.EmbeddingVersion != "v2" {
+			t.Errorf("chunk %d still at %q", chunk.ID, chunk.EmbeddingVersion)
+		}
+	}
+	if got, want := vectorIDs(storedVectorsOf(t, s, newCollection, 3)), chunkVectorIDs(chunks); !equalStrings(got, want) {
+		t.Errorf("new collection = %d points, want %d", len(got), len(want))
+	}
+	if old := storedVectorsOf(t, s, legacyCollectionName(1), 4); len(old) != 0 {
+		t.Errorf("legacy collection still has %d points", len(old))
+	}
+
+	// 切换后检索使用新集合，再次重建无事可做。
+	hits, err := s.vectorSearch(ctx, 1, "Alpha\n\nAlpha section text.", 1)
+	if err != nil || len(hits) != 1 || hits[0].DocumentID != doc.ID {
+		t.Fatalf("search after reindex = %+v, %v", hits, err)
+	}
+	if _, started, err := s.StartReindex(ctx, 1); err != nil || started {
+		t.Errorf("second reindex = %v, %v, want up to date", started, err)
+	}
+}
+
+func TestReindexAbortsWhenStateChanges(t *testing.T) {
+	s, _ := newIngestTestService(t)
+	ctx := context.Background()
+	seedLegacyChunks(t, s, 1, 2)
+	idx, err := s.indexFor(ctx, 1)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+
+	s.embeddingVersion = "v2"
+	target, collection := "v2", versionedCollectionName(1, "v2")
+	idx.TargetVersion, idx.TargetCollection = &target, &collection
+	// 索引记录未处于重建状态，迁移完成后不得切换集合。
+	if err := s.reindexChunks(ctx, idx); err == nil {
+		t.Fatal("expected reindex to detect the state change")
+	}
+	reloaded, err := s.indexFor(ctx, 1)
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if reloaded.Collection != legacyCollectionName(1) || reloaded.EmbeddingVersion != "v1" {
+		t.Errorf("index switched without owning the rebuild: %+v", reloaded)
+	}
+	if old := storedVectorsOf(t, s, legacyCollectionName(1), 4); len(old) != 2 {
+		t.Errorf("legacy collection = %d points, want it kept", len(old))
+	}
+}
@@ -0,0 +1,354 @@
+package knowledge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	rerankerModeAuto = "auto"
+	rerankerModeHTTP = "http"
+	rerankerModeLLM  = "llm"
+	rerankerModeOff  = "off"
+
+	defaultRerankTimeout  = 10 * time.Second
+	llmRerankPassageChars = 600
+)
+
+// Reranker 对召回的候选片段按与查询的相关性重新打分，返回的分数与 documents 一一对应，取值 0~1。
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// httpReranker 调用兼容 Cohere / Jina / DashScope 格式的交叉编码器重排接口。
+type httpReranker struct {
+	httpClient *http.Client
+	endpoint   string
+	apiKey     string
+	modelID    string
+}
+
+// rerankRequest 描述发往重排服务的请求体，同时携带 DashScope 原生格式所需的 input 字段。
+type rerankRequest struct {
+	Model           string              `json:"model"`
+	Query           string              `json:"query,omitempty"`
+	Documents       []string            `json:"documents,omitempty"`
+	TopN            int                 `json:"top_n,omitempty"`
+	ReturnDocuments *bool               `json:"return_documents,omitempty"`
+	Input           *rerankRequestInput `json:"input,omitempty"`
+	Parameters      *rerankParameters   `json:"parameters,omitempty"`
+}
+
+// rerankParameters 对应 DashScope 原生重排接口的 parameters 结构。
+type rerankParameters struct {
+	TopN            int  `json:"top_n"`
+	ReturnDocuments bool `json:"return_documents"`
+}
+
+// rerankRequestInput 对应 DashScope 原生重排接口的 input 结构。
+type rerankRequestInput struct {
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+}
+
+// rerankResult 为单个候选的重排结果。
+type rerankResult struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float64 `json:"relevance_score"`
+	Score          *float64 `json:"score"`
+}
+
+// rerankResponse 兼容 results 与 output.results 两种返回结构。
+type rerankResponse struct {
+	Results []rerankResult `json:"results"`
+	Data    []rerankResult `json:"data"`
+	Output  struct {
+		Results []rerankResult `json:"results"`
+	} `json:"output"`
+}
+
+// NewRerankerFromEnv 根据 KNOWLEDGE_RERANKER 初始化重排器：auto 在配置了 RERANK_MODEL_ID 时启用交叉编码器，
+// 并在其失败时回退到大模型打分；llm 仅使用大模型打分；off 关闭重排。未启用时返回 nil。
+func NewRerankerFromEnv() (Reranker, error) {
+	mode := strings.ToLower(getEnvDefault("KNOWLEDGE_RERANKER", rerankerModeAuto))
+	timeout := defaultRerankTimeout
+	if ms, ok := envPositiveInt("KNOWLEDGE_RERANK_TIMEOUT_MS"); ok {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	switch mode {
+	case rerankerModeOff:
+		return nil, nil
+	case rerankerModeLLM:
+		return newLLMRerankerFromEnv(timeout)
+	case rerankerModeHTTP:
+		return newHTTPRerankerFromEnv(timeout)
+	case rerankerModeAuto:
+		if getEnvDefault("RERANK_MODEL_ID", "") == "" {
+			return nil, nil
+		}
+		primary, err := newHTTPRerankerFromEnv(timeout)
+		if err != nil {
+			return nil, err
+		}
+		fallback, err := newLLMRerankerFromEnv(timeout)
+		if err != nil {
+			log.Printf("knowledge: llm reranker fallback disabled: %v", err)
+			return primary, nil
+		}
+		return &fallbackReranker{primary: primary, fallback: fallback}, nil
+	default:
+		return nil, fmt.Errorf("knowledge: unknown reranker mode %q", mode)
+	}
+}
+
+// newHTTPRerankerFromEnv 从 RERANK_* 环境变量构建交叉编码器重排器。
+func newHTTPRerankerFromEnv(timeout time.Duration) (*httpReranker, error) {
+	apiKey := getEnvDefault("RERANK_API_KEY", "")
+	if apiKey == "" {
+		apiKey = getEnvDefault("DASHSCOPE_API_KEY", "")
+	}
+	if apiKey == "" {
+		apiKey = getEnvDefault("EMBEDDING_API_KEY", "")
+	}
+	if apiKey == "" {
+		return nil, errors.New("knowledge: rerank API key is required")
+	}
+
+	modelID := getEnvDefault("RERANK_MODEL_ID", "gte-rerank-v2")
+	endpoint := getEnvDefault("RERANK_BASE_URL", "https://dashscope.aliyuncs.com/api/v1/services/rerank/text-rerank/text-rerank")
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("knowledge: invalid rerank base URL %q", endpoint)
+	}
+	if strings.HasSuffix(endpoint, "/v1") || strings.HasSuffix(endpoint, "/compatible-mode/v1") {
+		endpoint += "/rerank"
+	}
+
+	return &httpReranker{
+		httpClient: &http.Client{Timeout: timeout},
+		endpoint:   endpoint,
+		apiKey:     apiKey,
+		modelID:    modelID,
+	}, nil
+}
+
+// Rerank 调用重排接口获取每个候选的相关性分数。
+func (r *httpReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	var payload rerankRequest
+	if strings.Contains(r.endpoint, "/services/rerank/") {
+		payload = rerankRequest{
+			Model:      r.modelID,
+			Input:      &rerankRequestInput{Query: query, Documents: documents},
+			Parameters: &rerankParameters{TopN: len(documents)},
+		}
+	} else {
+		returnDocuments := false
+		payload = rerankRequest{
+			Model:           r.modelID,
+			Query:           query,
+			Documents:       documents,
+			TopN:            len(documents),
+			ReturnDocuments: &returnDocuments,
+		}
+	}
+
+	body := &bytes.Buffer{}
+	if err := json.NewEncoder(body).Encode(payload); err != nil {
+		return nil, fmt.Errorf("knowledge: encode rerank payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: create rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	req.Header.Set("User-Agent", "auralis-knowledge/1.0")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("knowledge: rerank API status %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+
+	var decoded rerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("knowledge: decode rerank response: %w", err)
+	}
+	results := decoded.Results
+	if len(results) == 0 {
+		results = decoded.Output.Results
+	}
+	if len(results) == 0 {
+		results = decoded.Data
+	}
+	if len(results) == 0 {
+		return nil, errors.New("knowledge: rerank response contains no results")
+	}
+
+	scores := make([]float64, len(documents))
+	for _, item := range results {
+		if item.Index < 0 || item.Index >= len(documents) {
+			continue
+		}
+		switch {
+		case item.RelevanceScore != nil:
+			scores[item.Index] = *item.RelevanceScore
+		case item.Score != nil:
+			scores[item.Index] = *item.Score
+		}
+	}
+	return scores, nil
+}
+
+// llmReranker 让通用大模型按 0~10 为候选片段打分，用于未部署交叉编码器的场景。
+type llmReranker struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	modelID    string
+}
+
+// llmRerankPrompt 为大模型打分时的系统提示。
+const llmRerankPrompt = `你是检索结果的相关性评估器。根据用户问题，为每个编号段落评估其对回答问题的帮助程度，分数为 0 到 10 的整数（0 表示无关，10 表示直接回答了问题）。
+只输出 JSON 数组，例如 [{"index":0,"score":7}]，不要输出其他内容。`
+
+// newLLMRerankerFromEnv 基于 LLM_* 环境变量构建大模型重排器，可通过 RERANK_LLM_MODEL 单独指定模型。
+func newLLMRerankerFromEnv(timeout time.Duration) (*llmReranker, error) {
+	apiKey := getEnvDefault("LLM_API_KEY", "")
+	if apiKey == "" {
+		return nil, errors.New("knowledge: LLM_API_KEY is required for llm reranker")
+	}
+	baseURL := strings.TrimRight(getEnvDefault("LLM_BASE_URL", "https://dashscope.aliyuncs.com/compatible-mode/v1"), "/")
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		return nil, fmt.Errorf("knowledge: invalid llm base URL %q", baseURL)
+	}
+	modelID := getEnvDefault("RERANK_LLM_MODEL", strings.TrimSpace(os.Getenv("LLM_MODEL_ID")))
+	if modelID == "" {
+		return nil, errors.New("knowledge: RERANK_LLM_MODEL or LLM_MODEL_ID is required for llm reranker")
+	}
+	return &llmReranker{
+		httpClient: &http.Client{Timeout: timeout},
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		modelID:    modelID,
+	}, nil
+}
+
+// Rerank 请求大模型为候选打分并归一化到 0~1，未给出分数的候选记为 0。
+func (r *llmReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	var builder strings.Builder
+	builder.WriteString("问题：")
+	builder.WriteString(query)
+	builder.WriteString("\n\n")
+	for i, doc := range documents {
+		builder.WriteString(fmt.Sprintf("[%d] %s\n\n", i, truncateRunes(strings.Join(strings.Fields(doc), " "), llmRerankPassageChars)))
+	}
+
+	payload := map[string]any{
+		"model": r.modelID,
+		"messages": []map[string]string{
+			{"role": "system", "content": llmRerankPrompt},
+			{"role": "user", "content": builder.String()},
+		},
+		"temperature": 0,
+	}
+	body := &bytes.Buffer{}
+	if err := json.NewEncoder(body).Encode(payload); err != nil {
+		return nil, fmt.Errorf("knowledge: encode llm rerank payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+"/chat/completions", body)
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: create llm rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.apiKey)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: llm rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("knowledge: llm rerank status %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+
+	var decoded struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("knowledge: decode llm rerank response: %w", err)
+	}
+	if len(decoded.Choices) == 0 {
+		return nil, errors.New("knowledge: llm rerank returned no choices")
+	}
+	return parseLLMRerankScores(decoded.Choices[0].Message.Content, len(documents))
+}
+
+// parseLLMRerankScores 从模型输出中提取 JSON 数组并把 0~10 分映射为 0~1。
+func parseLLMRerankScores(content string, count int) ([]float64, error) {
+	trimmed := strings.TrimSpace(content)
+	start := strings.Index(trimmed, "[")
+	end := strings.LastIndex(trimmed, "]")
+	if start < 0 || end <= start {
+		return nil, errors.New("knowledge: llm rerank returned no json array")
+	}
+	var items []struct {
+		Index int     `json:"index"`
+		Score float64 `json:"score"`
+	}
+	if err := json.Unmarshal([]byte(trimmed[start:end+1]), &items); err != nil {
+		return nil, fmt.Errorf("knowledge: parse llm rerank scores: %w", err)
+	}
+	scores := make([]float64, count)
+	for _, item := range items {
+		if item.Index < 0 || item.Index >= count {
+			continue
+		}
+		scores[item.Index] = math.Max(0, math.Min(item.Score, 10)) / 10
+	}
+	return scores, nil
+}
+
+// fallbackReranker 在主重排器失败时改用备用重排器。
+type fallbackReranker struct {
+	primary  Reranker
+	fallback Reranker
+}
+
+// Rerank 优先调用主重排器。
+func (r *fallbackReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	scores, err := r.primary.Rerank(ctx, query, documents)
+	if err == nil {
+		return scores, nil
+	}
+	log.Printf("knowledge: rerank failed, falling back to llm: %v", err)
+	return r.fallback.Rerank(ctx, query, documents)
+}
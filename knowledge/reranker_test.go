@@ -0,0 +1,168 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// errReranker 始终返回错误，用于验证回退。
+type errReranker struct{}
+
+func (errReranker) Rerank(context.Context, string, []string) ([]float64, error) {
+	return nil, errors.New("rerank unavailable")
+}
+
+// newRerankServer 启动返回固定响应的重排服务，并记录最后一次请求体。
+func newRerankServer(t *testing.T, status int, reply string, captured *map[string]any) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("authorization = %q", r.Header.Get("Authorization"))
+		}
+		if captured != nil {
+			body, _ := io.ReadAll(r.Body)
+			*captured = map[string]any{}
+			if err := json.Unmarshal(body, captured); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPRerankerRequestFormats(t *testing.T) {
+	docs := []string{"first", "second"}
+	reply := `{"results":[{"index":0,"relevance_score":0.2},{"index":1,"relevance_score":0.9}]}`
+
+	var compatible map[string]any
+	server := newRerankServer(t, http.StatusOK, reply, &compatible)
+	reranker := &httpReranker{httpClient: server.Client(), endpoint: server.URL + "/v1/rerank", apiKey: "secret", modelID: "rerank-m"}
+	if _, err := reranker.Rerank(context.Background(), "q", docs); err != nil {
+		t.Fatalf("rerank: %v", err)
+	}
+	if compatible["model"] != "rerank-m" || compatible["query"] != "q" || compatible["top_n"] != float64(2) ||
+		compatible["return_documents"] != false || compatible["input"] != nil {
+		t.Errorf("compatible request = %v", compatible)
+	}
+
+	// DashScope 原生接口使用 input 与 parameters。
+	var native map[string]any
+	server = newRerankServer(t, http.StatusOK, reply, &native)
+	reranker = &httpReranker{httpClient: server.Client(), endpoint: server.URL + "/api/v1/services/rerank/text-rerank/text-rerank", apiKey: "secret", modelID: "gte-rerank-v2"}
+	if _, err := reranker.Rerank(context.Background(), "q", docs); err != nil {
+		t.Fatalf("rerank: %v", err)
+	}
+	input, _ := native["input"].(map[string]any)
+	parameters, _ := native["parameters"].(map[string]any)
+	if native["query"] != nil || input["query"] != "q" || len(input["documents"].([]any)) != 2 || parameters["top_n"] != float64(2) {
+		t.Errorf("native request = %v", native)
+	}
+}
+
+func TestHTTPRerankerResponseShapes(t *testing.T) {
+	docs := []string{"a", "b", "c"}
+	tests := []struct {
+		name    string
+		status  int
+		reply   string
+		want    []float64
+		wantErr string
+	}{
+		{"results", http.StatusOK, `{"results":[{"index":2,"relevance_score":0.7},{"index":0,"relevance_score":0.1}]}`, []float64{0.1, 0, 0.7}, ""},
+		{"output results", http.StatusOK, `{"output":{"results":[{"index":1,"relevance_score":0.5}]}}`, []float64{0, 0.5, 0}, ""},
+		{"data with score", http.StatusOK, `{"data":[{"index":0,"score":0.3},{"index":1,"score":0.6}]}`, []float64{0.3, 0.6, 0}, ""},
+		{"out of range index", http.StatusOK, `{"results":[{"index":5,"relevance_score":1},{"index":-1,"relevance_score":1},{"index":1,"relevance_score":0.4}]}`, []float64{0, 0.4, 0}, ""},
+		{"empty", http.StatusOK, `{"results":[]}`, nil, "no results"},
+		{"invalid json", http.StatusOK, `not json`, nil, "decode rerank response"},
+		{"status", http.StatusTooManyRequests, `quota exceeded`, nil, "quota exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRerankServer(t, tt.status, tt.reply, nil)
+			reranker := &httpReranker{httpClient: server.Client(), endpoint: server.URL + "/v1/rerank", apiKey: "secret", modelID: "m"}
+			got, err := reranker.Rerank(context.Background(), "q", docs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rerank: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("scores = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("scores = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestParseLLMRerankScores(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []float64
+		wantErr bool
+	}{
+		{"plain", `[{"index":0,"score":7},{"index":1,"score":10}]`, []float64{0.7, 1}, false},
+		{"fenced", "```json\n[{\"index\":1,\"score\":3}]\n```", []float64{0, 0.3}, false},
+		{"clamped", `[{"index":0,"score":15},{"index":1,"score":-2}]`, []float64{1, 0}, false},
+		{"ignores bad index", `[{"index":4,"score":5},{"index":0,"score":5}]`, []float64{0.5, 0}, false},
+		{"no array", "I cannot score these.", nil, true},
+		{"invalid json", `[{"index":0,"score":"high"}]`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseLLMRerankScores(tt.content, 2)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil || len(got) != 2 || got[0] != tt.want[0] || got[1] != tt.want[1] {
+			t.Errorf("%s: scores = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestLLMRerankerWithFallback(t *testing.T) {
+	var request map[string]any
+	server := newRerankServer(t, http.StatusOK, `{"choices":[{"message":{"content":"[{\"index\":1,\"score\":8}]"}}]}`, &request)
+	llm := &llmReranker{httpClient: server.Client(), baseURL: server.URL, apiKey: "secret", modelID: "chat-m"}
+	reranker := &fallbackReranker{primary: errReranker{}, fallback: llm}
+
+	scores, err := reranker.Rerank(context.Background(), "q", []string{"a", "b   c"})
+	if err != nil {
+		t.Fatalf("rerank: %v", err)
+	}
+	if len(scores) != 2 || scores[0] != 0 || scores[1] != 0.8 {
+		t.Errorf("scores = %v, want [0 0.8]", scores)
+	}
+	messages, _ := request["messages"].([]any)
+	if request["model"] != "chat-m" || len(messages) != 2 {
+		t.Fatalf("request = %v", request)
+	}
+	if prompt := messages[1].(map[string]any)["content"].(string); !strings.Contains(prompt, "[1] b c") {
+		t.Errorf("prompt = %q, want numbered passages with collapsed whitespace", prompt)
+	}
+
+	primary := &fallbackReranker{primary: llm, fallback: errReranker{}}
+	if _, err := primary.Rerank(context.Background(), "q", []string{"a", "b"}); err != nil {
+		t.Errorf("primary success used fallback: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package knowledge
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRule 表示 robots.txt 中的一条 Allow/Disallow 规则。
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// robotsRules 保存适用于爬虫的规则、抓取间隔与站点地图。
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	sitemaps   []string
+}
+
+// robotsGroup 对应 robots.txt 中的一个 User-agent 分组。
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+// parseRobots 解析 robots.txt，优先选择匹配爬虫标识的分组，否则使用 "*" 分组。
+func parseRobots(body []byte, userAgent string) *robotsRules {
+	token := strings.ToLower(userAgent)
+	if idx := strings.IndexAny(token, "/ "); idx > 0 {
+		token = token[:idx]
+	}
+
+	var (
+		groups   []*robotsGroup
+		current  *robotsGroup
+		sitemaps []string
+		inAgents bool
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents || current == nil {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if value == "" {
+				// 空 Disallow 表示允许全部，不产生规则。
+				continue
+			}
+			if rule, ok := compileRobotsRule(value, key == "allow"); ok {
+				current.rules = append(current.rules, rule)
+			}
+		case "crawl-delay":
+			inAgents = false
+			if current == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.delay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	result := &robotsRules{sitemaps: sitemaps}
+	var wildcard *robotsGroup
+	for _, group := range groups {
+		for _, agent := range group.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = group
+				}
+				continue
+			}
+			if token != "" && strings.Contains(token, agent) {
+				result.rules = group.rules
+				result.crawlDelay = group.delay
+				return result
+			}
+		}
+	}
+	if wildcard != nil {
+		result.rules = wildcard.rules
+		result.crawlDelay = wildcard.delay
+	}
+	return result
+}
+
+// compileRobotsRule 将 robots 路径模式（支持 * 与 $）编译为正则。
+func compileRobotsRule(value string, allow bool) (robotsRule, bool) {
+	anchored := strings.HasSuffix(value, "$")
+	trimmed := strings.TrimSuffix(value, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(trimmed), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return robotsRule{}, false
+	}
+	return robotsRule{allow: allow, length: len(value), pattern: pattern}, true
+}
+
+// allowed 判断路径是否允许抓取：最长匹配规则生效，长度相同时 Allow 优先。
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil || len(r.rules) == 0 {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+	best := -1
+	allow := true
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			best = rule.length
+			allow = rule.allow
+		}
+	}
+	return allow
+}
@@ -0,0 +1,406 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultSearchLimit     = 4
+	defaultRRFK            = 60
+	minCandidateLimit      = 20
+	defaultRerankCandidate = 20
+	nearDuplicateJaccard   = 0.85
+	shingleSize            = 3
+)
+
+// SearchOptions 控制混合检索的返回数量、各路召回权重与 RRF 平滑常数。
+// Rerank 为 true 且服务配置了重排器时先多取候选再重排；MinRerankScore 为重排分数阈值，0 表示使用服务默认值。
+type SearchOptions struct {
+	Limit          int
+	VectorWeight   float64
+	KeywordWeight  float64
+	RRFK           int
+	Rerank         bool
+	MinRerankScore float64
+}
+
+// DefaultSearchOptions 返回向量与关键词等权融合的默认检索参数。
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{
+		Limit:         defaultSearchLimit,
+		VectorWeight:  1,
+		KeywordWeight: 1,
+		RRFK:          defaultRRFK,
+		Rerank:        true,
+	}
+}
+
+// normalize 校正非法参数，两路权重均为 0 时回退为等权。
+func (o SearchOptions) normalize() SearchOptions {
+	if o.Limit <= 0 {
+		o.Limit = defaultSearchLimit
+	}
+	if o.VectorWeight < 0 {
+		o.VectorWeight = 0
+	}
+	if o.KeywordWeight < 0 {
+		o.KeywordWeight = 0
+	}
+	if o.VectorWeight == 0 && o.KeywordWeight == 0 {
+		o.VectorWeight, o.KeywordWeight = 1, 1
+	}
+	if o.RRFK <= 0 {
+		o.RRFK = defaultRRFK
+	}
+	if o.MinRerankScore < 0 {
+		o.MinRerankScore = 0
+	}
+	return o
+}
+
+// QueryTopChunks 使用默认权重执行混合检索，召回最相关的文档片段。
+func (s *Service) QueryTopChunks(ctx context.Context, agentID uint64, query string, limit int) ([]ContextSnippet, error) {
+	opts := DefaultSearchOptions()
+	opts.Limit = limit
+	return s.Search(ctx, agentID, query, opts)
+}
+
+// SearchTrace 记录一次检索实际使用的参数、过滤条件与各阶段的结果数量，供检索调试使用。
+type SearchTrace struct {
+	Limit            int           `json:"limit"`
+	VectorWeight     float64       `json:"vector_weight"`
+	KeywordWeight    float64       `json:"keyword_weight"`
+	RRFK             int           `json:"rrf_k"`
+	Candidates       int           `json:"candidates"`
+	Filter           PayloadFilter `json:"filter"`
+	VectorHits       int           `json:"vector_hits"`
+	VectorError      string        `json:"vector_error,omitempty"`
+	KeywordHits      int           `json:"keyword_hits"`
+	KeywordError     string        `json:"keyword_error,omitempty"`
+	Fused            int           `json:"fused"`
+	Duplicates       int           `json:"duplicates"`
+	Rerank           bool          `json:"rerank"`
+	RerankCandidates int           `json:"rerank_candidates,omitempty"`
+	MinRerankScore   float64       `json:"min_rerank_score,omitempty"`
+	BelowThreshold   int           `json:"below_threshold,omitempty"`
+	RerankError      string        `json:"rerank_error,omitempty"`
+	Returned         int           `json:"returned"`
+}
+
+// Search 同时执行向量检索与关键词检索，并以加权倒数排名融合（RRF）合并结果。
+// 某一路检索失败时退化为另一路的结果，两路均失败才返回错误。
+// 融合结果去除近似重复的切片后交给重排器打分，低于阈值的片段被丢弃；重排失败时保留融合排序。
+func (s *Service) Search(ctx context.Context, agentID uint64, query string, opts SearchOptions) ([]ContextSnippet, error) {
+	snippets, _, err := s.SearchWithTrace(ctx, agentID, query, opts)
+	return snippets, err
+}
+
+// SearchWithTrace 执行与 Search 相同的检索流程，并返回各阶段的参数与结果统计；查询为空时 trace 为 nil。
+func (s *Service) SearchWithTrace(ctx context.Context, agentID uint64, query string, opts SearchOptions) ([]ContextSnippet, *SearchTrace, error) {
+	trimmed := strings.TrimSpace(query)
+	if trimmed == "" {
+		return nil, nil, nil
+	}
+	opts = opts.normalize()
+	rerank := opts.Rerank && s.reranker != nil
+	candidates := max(opts.Limit*4, minCandidateLimit)
+	trace := &SearchTrace{
+		Limit:         opts.Limit,
+		VectorWeight:  opts.VectorWeight,
+		KeywordWeight: opts.KeywordWeight,
+		RRFK:          opts.RRFK,
+		Candidates:    candidates,
+		Filter:        searchFilter(agentID),
+		Rerank:        rerank,
+	}
+
+	var (
+		vectorHits  []ContextSnippet
+		keywordHits []ContextSnippet
+		vectorErr   error
+		keywordErr  error
+	)
+	if opts.VectorWeight > 0 {
+		vectorHits, vectorErr = s.vectorSearch(ctx, agentID, trimmed, candidates)
+		if vectorErr != nil {
+			log.Printf("knowledge: vector search for agent %d failed: %v", agentID, vectorErr)
+			trace.VectorError = vectorErr.Error()
+		}
+	}
+	if opts.KeywordWeight > 0 {
+		keywordHits, keywordErr = s.keywordSearch(ctx, agentID, trimmed, candidates)
+		if keywordErr != nil {
+			log.Printf("knowledge: keyword search for agent %d failed: %v", agentID, keywordErr)
+			trace.KeywordError = keywordErr.Error()
+		}
+	}
+	trace.VectorHits, trace.KeywordHits = len(vectorHits), len(keywordHits)
+	if vectorErr != nil && (keywordErr != nil || opts.KeywordWeight == 0) {
+		return nil, trace, vectorErr
+	}
+	if keywordErr != nil && opts.VectorWeight == 0 {
+		return nil, trace, keywordErr
+	}
+
+	ranked := fuseRankings(opts, vectorHits, keywordHits)
+	fused := dedupeSnippets(ranked)
+	trace.Fused, trace.Duplicates = len(ranked), len(ranked)-len(fused)
+	if !rerank {
+		results := limitSnippets(fused, opts.Limit)
+		trace.Returned = len(results)
+		return results, trace, nil
+	}
+
+	fused = limitSnippets(fused, max(opts.Limit, s.rerankCandidates))
+	minScore := opts.MinRerankScore
+	if minScore == 0 {
+		minScore = s.rerankMinScore
+	}
+	trace.RerankCandidates, trace.MinRerankScore = len(fused), minScore
+	reranked, err := s.rerankSnippets(ctx, trimmed, fused, minScore)
+	if err != nil {
+		log.Printf("knowledge: rerank for agent %d failed: %v", agentID, err)
+		trace.RerankError = err.Error()
+		results := limitSnippets(fused, opts.Limit)
+		trace.Returned = len(results)
+		return results, trace, nil
+	}
+	trace.BelowThreshold = len(fused) - len(reranked)
+	results := limitSnippets(reranked, opts.Limit)
+	trace.Returned = len(results)
+	return results, trace, nil
+}
+
+// searchFilter 返回两路召回共用的过滤条件：仅检索该智能体启用状态的文档。
+func searchFilter(agentID uint64) PayloadFilter {
+	return PayloadFilter{"agent_id": agentID, "status": "active"}
+}
+
+// rerankSnippets 使用重排器为候选打分，按重排分数降序返回不低于阈值的片段。
+func (s *Service) rerankSnippets(ctx context.Context, query string, snippets []ContextSnippet, minScore float64) ([]ContextSnippet, error) {
+	if len(snippets) == 0 {
+		return nil, nil
+	}
+	documents := make([]string, len(snippets))
+	for i, snippet := range snippets {
+		documents[i] = snippet.Text
+		if snippet.Heading != "" {
+			documents[i] = snippet.Heading + "\n" + snippet.Text
+		}
+	}
+	scores, err := s.reranker.Rerank(ctx, query, documents)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) != len(snippets) {
+		return nil, fmt.Errorf("knowledge: rerank returned %d scores for %d documents", len(scores), len(snippets))
+	}
+
+	results := make([]ContextSnippet, 0, len(snippets))
+	for i, snippet := range snippets {
+		if scores[i] < minScore {
+			continue
+		}
+		snippet.RerankScore = scores[i]
+		results = append(results, snippet)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RerankScore > results[j].RerankScore
+	})
+	return results, nil
+}
+
+// limitSnippets 截取前 limit 个片段。
+func limitSnippets(snippets []ContextSnippet, limit int) []ContextSnippet {
+	if limit > 0 && len(snippets) > limit {
+		return snippets[:limit]
+	}
+	return snippets
+}
+
+// dedupeSnippets 按排名顺序保留片段，丢弃与更靠前片段文本近似重复（shingle Jaccard 相似度过高）的切片。
+func dedupeSnippets(snippets []ContextSnippet) []ContextSnippet {
+	if len(snippets) < 2 {
+		return snippets
+	}
+	kept := make([]ContextSnippet, 0, len(snippets))
+	keptShingles := make([]map[string]struct{}, 0, len(snippets))
+	for _, snippet := range snippets {
+		shingles := textShingles(snippet.Text)
+		duplicate := false
+		for _, other := range keptShingles {
+			if jaccard(shingles, other) >= nearDuplicateJaccard {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		kept = append(kept, snippet)
+		keptShingles = append(keptShingles, shingles)
+	}
+	return kept
+}
+
+// textShingles 忽略大小写、空白与标点后生成字符级 shingle 集合，对中英文文本均适用。
+func textShingles(text string) map[string]struct{} {
+	runes := make([]rune, 0, len(text))
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+	shingles := make(map[string]struct{})
+	if len(runes) < shingleSize {
+		if len(runes) > 0 {
+			shingles[string(runes)] = struct{}{}
+		}
+		return shingles
+	}
+	for i := 0; i+shingleSize <= len(runes); i++ {
+		shingles[string(runes[i:i+shingleSize])] = struct{}{}
+	}
+	return shingles
+}
+
+// jaccard 计算两个 shingle 集合的 Jaccard 相似度。
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	shared := 0
+	for key := range a {
+		if _, ok := b[key]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// fuseRankings 按 weight/(k+rank) 累加两路排名得分，同一切片以 VectorID 去重，返回全部候选。
+func fuseRankings(opts SearchOptions, vectorHits []ContextSnippet, keywordHits []ContextSnippet) []ContextSnippet {
+	fused := make(map[string]*ContextSnippet, len(vectorHits)+len(keywordHits))
+	order := make([]string, 0, len(vectorHits)+len(keywordHits))
+	k := float64(opts.RRFK)
+
+	for rank, hit := range vectorHits {
+		key := snippetKey(hit)
+		entry, ok := fused[key]
+		if !ok {
+			copied := hit
+			copied.Score = 0
+			entry = &copied
+			fused[key] = entry
+			order = append(order, key)
+		}
+		entry.VectorScore = hit.VectorScore
+		entry.Score += opts.VectorWeight / (k + float64(rank+1))
+	}
+	for rank, hit := range keywordHits {
+		key := snippetKey(hit)
+		entry, ok := fused[key]
+		if !ok {
+			copied := hit
+			copied.Score = 0
+			entry = &copied
+			fused[key] = entry
+			order = append(order, key)
+		}
+		entry.KeywordScore = hit.KeywordScore
+		entry.Score += opts.KeywordWeight / (k + float64(rank+1))
+	}
+
+	results := make([]ContextSnippet, 0, len(order))
+	for _, key := range order {
+		results = append(results, *fused[key])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// snippetKey 返回用于去重的切片标识。
+func snippetKey(snippet ContextSnippet) string {
+	if snippet.VectorID != "" {
+		return snippet.VectorID
+	}
+	return fmt.Sprintf("%d:%d", snippet.DocumentID, snippet.Seq)
+}
+
+// keywordSearch 在倒排索引上执行 BM25 检索并补全切片信息。
+func (s *Service) keywordSearch(ctx context.Context, agentID uint64, query string, limit int) ([]ContextSnippet, error) {
+	if s.db == nil || s.keywords == nil {
+		return nil, errors.New("knowledge: keyword index is not configured")
+	}
+	idx, err := s.keywordIndexFor(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	hits := idx.search(query, limit)
+	if len(hits) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint64, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ChunkID
+	}
+	var chunks []Chunk
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	chunkByID := make(map[uint64]Chunk, len(chunks))
+	docIDs := make([]uint64, 0, len(chunks))
+	for _, chunk := range chunks {
+		chunkByID[chunk.ID] = chunk
+		docIDs = append(docIDs, chunk.DocumentID)
+	}
+	var docs []Document
+	if err := s.db.WithContext(ctx).
+		Select("id", "title", "source", "tags", "status").
+		Where("id IN ? AND agent_id = ?", docIDs, agentID).
+		Find(&docs).Error; err != nil {
+		return nil, err
+	}
+	docByID := make(map[uint64]Document, len(docs))
+	for _, doc := range docs {
+		docByID[doc.ID] = doc
+	}
+
+	snippets := make([]ContextSnippet, 0, len(hits))
+	for _, hit := range hits {
+		chunk, ok := chunkByID[hit.ChunkID]
+		if !ok {
+			continue
+		}
+		doc, ok := docByID[chunk.DocumentID]
+		if !ok || doc.Status != "active" {
+			continue
+		}
+		snippets = append(snippets, ContextSnippet{
+			DocumentID:   doc.ID,
+			Title:        doc.Title,
+			Source:       doc.Source,
+			Heading:      chunk.Heading,
+			Page:         chunk.Page,
+			Text:         chunk.Text,
+			Seq:          chunk.Seq,
+			Score:        hit.Score,
+			KeywordScore: hit.Score,
+			VectorID:     chunk.VectorID,
+			Tags:         parseTags(doc.Tags),
+		})
+	}
+	return snippets, nil
+}
@@ -0,0 +1,59 @@
+package knowledge
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFuseRankings(t *testing.T) {
+	a := ContextSnippet{VectorID: "a", VectorScore: 0.9}
+	b := ContextSnippet{VectorID: "b", VectorScore: 0.8}
+	bKeyword := ContextSnippet{VectorID: "b", KeywordScore: 4.2}
+	c := ContextSnippet{DocumentID: 3, Seq: 1, KeywordScore: 3.1}
+
+	opts := SearchOptions{VectorWeight: 1, KeywordWeight: 1, RRFK: 60}
+	results := fuseRankings(opts, []ContextSnippet{a, b}, []ContextSnippet{bKeyword, c})
+	if len(results) != 3 {
+		t.Fatalf("results = %+v, want 3 snippets", results)
+	}
+	wantOrder := []string{"b", "a", "3:1"}
+	for i, want := range wantOrder {
+		if got := snippetKey(results[i]); got != want {
+			t.Errorf("result %d = %q, want %q", i, got, want)
+		}
+	}
+	if results[0].VectorScore != 0.8 || results[0].KeywordScore != 4.2 {
+		t.Errorf("merged snippet = %+v, want both channel scores", results[0])
+	}
+	if want := 1.0/62 + 1.0/61; math.Abs(results[0].Score-want) > 1e-12 {
+		t.Errorf("fused score = %v, want %v", results[0].Score, want)
+	}
+
+	keywordOff := fuseRankings(SearchOptions{VectorWeight: 1, RRFK: 60}, []ContextSnippet{a}, []ContextSnippet{c})
+	if len(keywordOff) != 2 || snippetKey(keywordOff[0]) != "a" || keywordOff[1].Score != 0 {
+		t.Errorf("results = %+v, want keyword-only hit ranked last with zero score", keywordOff)
+	}
+}
+
+func TestDedupeSnippets(t *testing.T) {
+	snippets := []ContextSnippet{
+		{VectorID: "a", Text: "Reset your password from the account settings page."},
+		{VectorID: "b", Text: "reset your password, from the Account Settings page!"},
+		{VectorID: "c", Text: "Billing runs on the first day of each month."},
+		{VectorID: "d", Text: "重置密码请前往账户设置页面。"},
+		{VectorID: "e", Text: "重置密码请前往账户设置页面"},
+		{VectorID: "f", Text: "Reset your password from the account settings page, then sign in again on every device."},
+	}
+	got := dedupeSnippets(snippets)
+	ids := make([]string, 0, len(got))
+	for _, snippet := range got {
+		ids = append(ids, snippet.VectorID)
+	}
+	// 保留先出现（排名更高）的片段，部分重叠的片段不视为重复。
+	if want := []string{"a", "c", "d", "f"}; !equalStrings(ids, want) {
+		t.Errorf("kept = %v, want %v", ids, want)
+	}
+	if single := dedupeSnippets(snippets[:1]); len(single) != 1 {
+		t.Errorf("single snippet = %v", single)
+	}
+}
@@ -4,38 +4,54 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"log"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 // Service 管理知识库文档、切片与向量索引。
 type Service struct {
-	db              *gorm.DB
-	embedder        Embedder
-	vectors         *qdrantClient
-	chunker         *chunker
-	collectionPref  string
-	defaultStatus   string
-	defaultVectorSz int
+	db               *gorm.DB
+	embedder         Embedder
+	vectors          VectorStore
+	chunker          *chunker
+	chunkOptions     ChunkOptionsResolver
+	crawler          *Crawler
+	keywords         *keywordIndexCache
+	reranker         Reranker
+	rerankCandidates int
+	rerankMinScore   float64
+	ingestQueue      chan uint64
+	ingestBatch      int
+	ingestAttempts   int
+	embeddingVersion string
+	collectionPref   string
+	defaultStatus    string
+	defaultVectorSz  int
 }
 
+// ChunkOptionsResolver 返回智能体的切分配置，返回 nil 时使用服务默认配置。
+type ChunkOptionsResolver func(ctx context.Context, agentID uint64) (*ChunkOptions, error)
+
 // DocumentInput 表示创建知识文档时的输入参数。
+// Sections 由文件解析得到，存在时按段落切分并保留标题与页码。
 type DocumentInput struct {
-	Title   string   `json:"title"`
-	Summary *string  `json:"summary,omitempty"`
-	Source  *string  `json:"source,omitempty"`
-	Content string   `json:"content"`
-	Tags    []string `json:"tags"`
-	Status  string   `json:"status"`
+	Title    string    `json:"title"`
+	Summary  *string   `json:"summary,omitempty"`
+	Source   *string   `json:"source,omitempty"`
+	FileURL  *string   `json:"file_url,omitempty"`
+	Content  string    `json:"content"`
+	Tags     []string  `json:"tags"`
+	Status   string    `json:"status"`
+	Sections []Section `json:"-"`
+
+	CanonicalURL  *string `json:"-"`
+	CrawlSourceID *uint64 `json:"-"`
 }
 
 // DocumentUpdate 描述更新文档时可修改的字段。
@@ -46,35 +62,46 @@ type DocumentUpdate struct {
 	Content *string   `json:"content"`
 	Tags    *[]string `json:"tags"`
 	Status  *string   `json:"status"`
+
+	Sections []Section `json:"-"`
 }
 
 // DocumentRecord 组合文档数据及元信息用于对外返回。
 type DocumentRecord struct {
-	ID         uint64    `json:"id"`
-	AgentID    uint64    `json:"agent_id"`
-	Title      string    `json:"title"`
-	Summary    *string   `json:"summary,omitempty"`
-	Source     *string   `json:"source,omitempty"`
-	Content    string    `json:"content"`
-	Tags       []string  `json:"tags"`
-	Status     string    `json:"status"`
-	ChunkCount int       `json:"chunk_count"`
-	CreatedBy  uint64    `json:"created_by"`
-	UpdatedBy  uint64    `json:"updated_by"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID           uint64    `json:"id"`
+	AgentID      uint64    `json:"agent_id"`
+	Title        string    `json:"title"`
+	Summary      *string   `json:"summary,omitempty"`
+	Source       *string   `json:"source,omitempty"`
+	FileURL      *string   `json:"file_url,omitempty"`
+	CanonicalURL *string   `json:"canonical_url,omitempty"`
+	Content      string    `json:"content"`
+	Tags         []string  `json:"tags"`
+	Status       string    `json:"status"`
+	IngestStatus string    `json:"ingest_status"`
+	IngestError  *string   `json:"ingest_error,omitempty"`
+	ChunkCount   int       `json:"chunk_count"`
+	CreatedBy    uint64    `json:"created_by"`
+	UpdatedBy    uint64    `json:"updated_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // ContextSnippet 代表召回结果中的上下文片段。
 type ContextSnippet struct {
-	DocumentID uint64   `json:"document_id"`
-	Title      string   `json:"title"`
-	Source     *string  `json:"source,omitempty"`
-	Text       string   `json:"text"`
-	Seq        int      `json:"seq"`
-	Score      float64  `json:"score"`
-	VectorID   string   `json:"vector_id"`
-	Tags       []string `json:"tags"`
+	DocumentID   uint64   `json:"document_id"`
+	Title        string   `json:"title"`
+	Source       *string  `json:"source,omitempty"`
+	Heading      string   `json:"heading,omitempty"`
+	Page         int      `json:"page,omitempty"`
+	Text         string   `json:"text"`
+	Seq          int      `json:"seq"`
+	Score        float64  `json:"score"`
+	VectorScore  float64  `json:"vector_score,omitempty"`
+	KeywordScore float64  `json:"keyword_score,omitempty"`
+	RerankScore  float64  `json:"rerank_score,omitempty"`
+	VectorID     string   `json:"vector_id"`
+	Tags         []string `json:"tags"`
 }
 
 // NewServiceFromEnv 基于环境配置构建知识库服务。
@@ -88,7 +115,7 @@ func NewServiceFromEnv(db *gorm.DB) (*Service, error) {
 		return nil, err
 	}
 
-	vectors, err := newQdrantClientFromEnv()
+	vectors, err := NewVectorStoreFromEnv()
 	if err != nil {
 		return nil, err
 	}
@@ -105,20 +132,61 @@ func NewServiceFromEnv(db *gorm.DB) (*Service, error) {
 			chunkMin = parsed
 		}
 	}
-	chunker := newChunker(chunkMax, chunkMin)
+	chunkOverlap, _ := envNonNegativeInt("KNOWLEDGE_CHUNK_OVERLAP_CHARS")
+	chunker := newChunker(strings.ToLower(getEnvDefault("KNOWLEDGE_CHUNK_STRATEGY", ChunkStrategyFixed)), chunkMax, chunkMin, chunkOverlap)
+
+	keywordCacheSize, _ := envPositiveInt("KNOWLEDGE_KEYWORD_INDEX_AGENTS")
+
+	ingestBatch, ok := envPositiveInt("KNOWLEDGE_INGEST_BATCH_SIZE")
+	if !ok {
+		ingestBatch = defaultIngestBatch
+	}
+	ingestAttempts, ok := envPositiveInt("KNOWLEDGE_INGEST_MAX_ATTEMPTS")
+	if !ok {
+		ingestAttempts = defaultIngestAttempts
+	}
+
+	reranker, err := NewRerankerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	rerankCandidates, ok := envPositiveInt("KNOWLEDGE_RERANK_CANDIDATES")
+	if !ok {
+		rerankCandidates = defaultRerankCandidate
+	}
+	rerankMinScore := 0.0
+	if raw := getEnvDefault("KNOWLEDGE_RERANK_MIN_SCORE", ""); raw != "" {
+		if parsed, convErr := strconv.ParseFloat(raw, 64); convErr == nil && parsed >= 0 && parsed <= 1 {
+			rerankMinScore = parsed
+		}
+	}
 
 	service := &Service{
-		db:              db,
-		embedder:        embedder,
-		vectors:         vectors,
-		chunker:         chunker,
-		collectionPref:  "agent",
-		defaultStatus:   "active",
-		defaultVectorSz: vectors.vectorSize,
+		db:               db,
+		embedder:         embedder,
+		vectors:          vectors,
+		chunker:          chunker,
+		crawler:          NewCrawlerFromEnv(),
+		keywords:         newKeywordIndexCache(keywordCacheSize),
+		reranker:         reranker,
+		rerankCandidates: rerankCandidates,
+		rerankMinScore:   rerankMinScore,
+		ingestQueue:      make(chan uint64, ingestQueueSize),
+		ingestBatch:      ingestBatch,
+		ingestAttempts:   ingestAttempts,
+		embeddingVersion: resolveEmbeddingVersion(embedder, vectorDimFromEnv()),
+		collectionPref:   "agent",
+		defaultStatus:    "active",
+		defaultVectorSz:  vectorDimFromEnv(),
 	}
 	return service, nil
 }
 
+// SetChunkOptionsResolver 设置按智能体读取切分配置的方法，需在启动入库工作协程前调用。
+func (s *Service) SetChunkOptionsResolver(resolver ChunkOptionsResolver) {
+	s.chunkOptions = resolver
+}
+
 // getEnvDefault 读取环境变量并提供默认值。
 func getEnvDefault(key string, fallback string) string {
 	value := strings.TrimSpace(os.Getenv(key))
@@ -128,12 +196,30 @@ func getEnvDefault(key string, fallback string) string {
 	return fallback
 }
 
+// envPositiveInt 读取正整数环境变量。
+func envPositiveInt(key string) (int, bool) {
+	value, err := strconv.Atoi(getEnvDefault(key, ""))
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+	return value, true
+}
+
+// envNonNegativeInt 读取非负整数环境变量。
+func envNonNegativeInt(key string) (int, bool) {
+	value, err := strconv.Atoi(getEnvDefault(key, ""))
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	return value, true
+}
+
 // AutoMigrate 执行知识库相关的数据表迁移。
 func (s *Service) AutoMigrate() error {
 	if s.db == nil {
 		return errors.New("knowledge: database connection is not configured")
 	}
-	return s.db.AutoMigrate(&Document{}, &Chunk{})
+	return s.db.AutoMigrate(&Document{}, &Chunk{}, &CrawlSource{}, &IngestJob{}, &KnowledgeIndex{})
 }
 
 // ListDocuments 按条件列出指定智能体的文档。
@@ -194,7 +280,7 @@ func (s *Service) GetDocument(ctx context.Context, agentID uint64, docID uint64)
 	return &record, nil
 }
 
-// CreateDocument 创建新的知识文档并触发切片与向量写入。
+// CreateDocument 创建新的知识文档并登记切片与向量化任务，返回时文档处于 processing 状态。
 func (s *Service) CreateDocument(ctx context.Context, agentID uint64, userID uint64, input DocumentInput) (*DocumentRecord, error) {
 	if s.db == nil {
 		return nil, errors.New("knowledge: database connection is not configured")
@@ -206,113 +292,57 @@ func (s *Service) CreateDocument(ctx context.Context, agentID uint64, userID uin
 	if sanitized.Content == "" {
 		return nil, errors.New("knowledge: content is required")
 	}
-
-	segments := s.chunker.split(sanitized.Content)
-	if len(segments) == 0 {
-		return nil, errors.New("knowledge: content is too short to chunk")
-	}
-
-	texts := make([]string, 0, len(segments))
-	for _, segment := range segments {
-		texts = append(texts, segment.Text)
-	}
-
-	embeddings, err := s.embedder.Embed(ctx, texts)
+	splitter, err := s.chunkerFor(ctx, agentID)
 	if err != nil {
 		return nil, err
 	}
-	if len(embeddings) != len(segments) {
-		return nil, fmt.Errorf("knowledge: embedding count mismatch (expected %d, got %d)", len(segments), len(embeddings))
-	}
-
-	vectorIDs := make([]string, len(segments))
-	chunks := make([]Chunk, len(segments))
-	for i, segment := range segments {
-		vectorIDs[i] = uuid.NewString()
-		chunks[i] = Chunk{
-			AgentID:    agentID,
-			Seq:        i + 1,
-			Text:       segment.Text,
-			VectorID:   vectorIDs[i],
-			TokenCount: segment.TokenCount,
-		}
-	}
-
-	collection := s.collectionName(agentID)
-	if err := s.vectors.EnsureCollection(ctx, collection, s.vectorSize()); err != nil {
-		return nil, err
+	if len(splitter.segment(sanitized.Content, sanitized.Sections)) == 0 {
+		return nil, errors.New("knowledge: content is too short to chunk")
 	}
 
-	var created Document
+	var (
+		created Document
+		job     *IngestJob
+	)
 	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		doc := Document{
-			AgentID:   agentID,
-			Title:     sanitized.Title,
-			Summary:   sanitized.Summary,
-			Source:    sanitized.Source,
-			Content:   sanitized.Content,
-			Tags:      tagsToJSON(sanitized.Tags),
-			Status:    sanitized.Status,
-			CreatedBy: userID,
-			UpdatedBy: userID,
+			AgentID:       agentID,
+			Title:         sanitized.Title,
+			Summary:       sanitized.Summary,
+			Source:        sanitized.Source,
+			FileURL:       sanitized.FileURL,
+			CanonicalURL:  sanitized.CanonicalURL,
+			CrawlSourceID: sanitized.CrawlSourceID,
+			Content:       sanitized.Content,
+			ContentHash:   contentHash(sanitized.Content),
+			Tags:          tagsToJSON(sanitized.Tags),
+			Status:        sanitized.Status,
+			IngestStatus:  DocumentIngestProcessing,
+			CreatedBy:     userID,
+			UpdatedBy:     userID,
 		}
 		if err := tx.Create(&doc).Error; err != nil {
 			return err
 		}
-
-		points := make([]QdrantPoint, len(chunks))
-		tagList := sanitized.Tags
-		for i := range chunks {
-			chunks[i].DocumentID = doc.ID
-			payload := map[string]interface{}{
-				"agent_id":    agentID,
-				"document_id": doc.ID,
-				"title":       doc.Title,
-				"status":      doc.Status,
-				"seq":         chunks[i].Seq,
-				"text":        chunks[i].Text,
-			}
-			if doc.Source != nil {
-				payload["source"] = *doc.Source
-			}
-			if doc.Summary != nil {
-				payload["summary"] = *doc.Summary
-			}
-			if len(tagList) > 0 {
-				payload["tags"] = tagList
-			}
-			points[i] = QdrantPoint{
-				ID:      chunks[i].VectorID,
-				Vector:  embeddings[i],
-				Payload: payload,
-			}
-		}
-
-		if err := s.vectors.UpsertPoints(ctx, collection, points); err != nil {
-			return err
-		}
-
-		if err := tx.Create(&chunks).Error; err != nil {
-			cleanupErr := s.vectors.DeletePoints(ctx, collection, vectorIDs)
-			if cleanupErr != nil {
-				log.Printf("knowledge: cleanup qdrant points failed: %v", cleanupErr)
-			}
+		var err error
+		job, err = s.createIngestJob(tx, doc, userID, sanitized.Sections, false)
+		if err != nil {
 			return err
 		}
-
 		created = doc
 		return nil
 	}); err != nil {
 		return nil, err
 	}
+	s.enqueueIngest(job.ID)
 
-	record := buildDocumentRecord(created, len(chunks), true)
+	record := buildDocumentRecord(created, 0, true)
 	record.Content = sanitized.Content
 	record.Tags = sanitized.Tags
 	return &record, nil
 }
 
-// UpdateDocument 更新知识文档并同步向量索引。
+// UpdateDocument 更新知识文档；正文或元信息变化时登记重新索引任务，旧切片在新切片就绪前继续提供检索。
 func (s *Service) UpdateDocument(ctx context.Context, agentID uint64, docID uint64, userID uint64, changes DocumentUpdate) (*DocumentRecord, error) {
 	if s.db == nil {
 		return nil, errors.New("knowledge: database connection is not configured")
@@ -350,13 +380,9 @@ func (s *Service) UpdateDocument(ctx context.Context, agentID uint64, docID uint
 	}
 
 	tagsChanged := false
-	var normalizedTags []string
 	if changes.Tags != nil {
-		normalizedTags = normalizeTags(*changes.Tags)
-		updatedDoc.Tags = tagsToJSON(normalizedTags)
+		updatedDoc.Tags = tagsToJSON(normalizeTags(*changes.Tags))
 		tagsChanged = true
-	} else {
-		normalizedTags = parseTags(updatedDoc.Tags)
 	}
 
 	contentChanged := false
@@ -367,55 +393,20 @@ func (s *Service) UpdateDocument(ctx context.Context, agentID uint64, docID uint
 		}
 		contentChanged = trimmed != existing.Content
 		updatedDoc.Content = trimmed
-	} else {
-		updatedDoc.Content = existing.Content
 	}
-
-	needsReindex := contentChanged || tagsChanged || changes.Status != nil || changes.Title != nil || changes.Summary != nil || changes.Source != nil
-
-	var chunks []Chunk
-	var embeddings [][]float32
-	var vectorIDs []string
-	if needsReindex {
-		segments := s.chunker.split(updatedDoc.Content)
-		if len(segments) == 0 {
-			return nil, errors.New("knowledge: content is too short to chunk")
-		}
-		texts := make([]string, len(segments))
-		for i, segment := range segments {
-			texts[i] = segment.Text
-		}
-		var err error
-		embeddings, err = s.embedder.Embed(ctx, texts)
+	if contentChanged {
+		splitter, err := s.chunkerFor(ctx, agentID)
 		if err != nil {
 			return nil, err
 		}
-		if len(embeddings) != len(segments) {
-			return nil, fmt.Errorf("knowledge: embedding count mismatch (expected %d, got %d)", len(segments), len(embeddings))
-		}
-		chunks = make([]Chunk, len(segments))
-		vectorIDs = make([]string, len(segments))
-		for i, segment := range segments {
-			id := uuid.NewString()
-			vectorIDs[i] = id
-			chunks[i] = Chunk{
-				AgentID:    agentID,
-				DocumentID: docID,
-				Seq:        i + 1,
-				Text:       segment.Text,
-				VectorID:   id,
-				TokenCount: segment.TokenCount,
-			}
+		if len(splitter.segment(updatedDoc.Content, changes.Sections)) == 0 {
+			return nil, errors.New("knowledge: content is too short to chunk")
 		}
 	}
 
-	collection := s.collectionName(agentID)
-	if needsReindex {
-		if err := s.vectors.EnsureCollection(ctx, collection, s.vectorSize()); err != nil {
-			return nil, err
-		}
-	}
+	needsReindex := contentChanged || tagsChanged || changes.Status != nil || changes.Title != nil || changes.Summary != nil || changes.Source != nil
 
+	var job *IngestJob
 	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		updates := map[string]interface{}{
 			"title":      updatedDoc.Title,
@@ -436,8 +427,13 @@ func (s *Service) UpdateDocument(ctx context.Context, agentID uint64, docID uint
 		if tagsChanged {
 			updates["tags"] = updatedDoc.Tags
 		}
-		if needsReindex {
+		if contentChanged {
 			updates["content"] = updatedDoc.Content
+			updates["content_hash"] = contentHash(updatedDoc.Content)
+		}
+		if needsReindex {
+			updates["ingest_status"] = DocumentIngestProcessing
+			updates["ingest_error"] = gorm.Expr("NULL")
 		}
 
 		if err := tx.Model(&Document{}).
@@ -447,60 +443,15 @@ func (s *Service) UpdateDocument(ctx context.Context, agentID uint64, docID uint
 		}
 
 		if needsReindex {
-			var existingVectors []string
-			if err := tx.Model(&Chunk{}).
-				Where("document_id = ?", docID).
-				Pluck("vector_id", &existingVectors).Error; err != nil {
-				return err
-			}
-			if len(existingVectors) > 0 {
-				if err := s.vectors.DeletePoints(ctx, collection, existingVectors); err != nil {
-					return err
-				}
+			updatedDoc.IngestStatus = DocumentIngestProcessing
+			updatedDoc.IngestError = nil
+			var sections []Section
+			if contentChanged {
+				sections = changes.Sections
 			}
-			if err := tx.Where("document_id = ?", docID).Delete(&Chunk{}).Error; err != nil {
-				return err
-			}
-
-			tagList := normalizedTags
-			if len(tagList) == 0 {
-				tagList = parseTags(updatedDoc.Tags)
-			}
-
-			points := make([]QdrantPoint, len(chunks))
-			for i := range chunks {
-				payload := map[string]interface{}{
-					"agent_id":    agentID,
-					"document_id": docID,
-					"title":       updatedDoc.Title,
-					"status":      updatedDoc.Status,
-					"seq":         chunks[i].Seq,
-					"text":        chunks[i].Text,
-				}
-				if updatedDoc.Source != nil {
-					payload["source"] = *updatedDoc.Source
-				}
-				if updatedDoc.Summary != nil {
-					payload["summary"] = *updatedDoc.Summary
-				}
-				if len(tagList) > 0 {
-					payload["tags"] = tagList
-				}
-				points[i] = QdrantPoint{
-					ID:      chunks[i].VectorID,
-					Vector:  embeddings[i],
-					Payload: payload,
-				}
-			}
-
-			if err := s.vectors.UpsertPoints(ctx, collection, points); err != nil {
-				return err
-			}
-			if err := tx.Create(&chunks).Error; err != nil {
-				cleanupErr := s.vectors.DeletePoints(ctx, collection, vectorIDs)
-				if cleanupErr != nil {
-					log.Printf("knowledge: cleanup qdrant points failed: %v", cleanupErr)
-				}
+			var err error
+			job, err = s.createIngestJob(tx, updatedDoc, userID, sections, !contentChanged)
+			if err != nil {
 				return err
 			}
 		}
@@ -511,22 +462,17 @@ func (s *Service) UpdateDocument(ctx context.Context, agentID uint64, docID uint
 	if err != nil {
 		return nil, err
 	}
-
-	chunkCount := 0
-	if needsReindex {
-		chunkCount = len(chunks)
-	} else {
-		var count int64
-		_ = s.db.WithContext(ctx).
-			Model(&Chunk{}).
-			Where("document_id = ?", existing.ID).
-			Count(&count)
-		chunkCount = int(count)
+	if job != nil {
+		s.enqueueIngest(job.ID)
 	}
 
-	record := buildDocumentRecord(existing, chunkCount, true)
-	record.Content = updatedDoc.Content
-	record.Tags = parseTags(existing.Tags)
+	var count int64
+	_ = s.db.WithContext(ctx).
+		Model(&Chunk{}).
+		Where("document_id = ?", existing.ID).
+		Count(&count)
+
+	record := buildDocumentRecord(existing, int(count), true)
 	return &record, nil
 }
 
@@ -536,7 +482,10 @@ func (s *Service) DeleteDocument(ctx context.Context, agentID uint64, docID uint
 		return errors.New("knowledge: database connection is not configured")
 	}
 
-	collection := s.collectionName(agentID)
+	idx, err := s.indexFor(ctx, agentID)
+	if err != nil {
+		return err
+	}
 
 	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		var doc Document
@@ -544,14 +493,14 @@ func (s *Service) DeleteDocument(ctx context.Context, agentID uint64, docID uint
 			return err
 		}
 
-		var vectorIDs []string
-		if err := tx.Model(&Chunk{}).
+		var chunks []Chunk
+		if err := tx.Select("id", "vector_id", "embedding_version").
 			Where("document_id = ?", docID).
-			Pluck("vector_id", &vectorIDs).Error; err != nil {
+			Find(&chunks).Error; err != nil {
 			return err
 		}
-		if len(vectorIDs) > 0 {
-			if err := s.vectors.DeletePoints(ctx, collection, vectorIDs); err != nil {
+		if len(chunks) > 0 {
+			if err := s.deleteChunkVectors(ctx, idx, chunks); err != nil {
 				return err
 			}
 		}
@@ -559,13 +508,16 @@ func (s *Service) DeleteDocument(ctx context.Context, agentID uint64, docID uint
 		if err := tx.Where("document_id = ?", docID).Delete(&Chunk{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("document_id = ?", docID).Delete(&IngestJob{}).Error; err != nil {
+			return err
+		}
 
 		return tx.Delete(&Document{}, docID).Error
 	})
 }
 
-// QueryTopChunks 基于查询向量召回最相关的文档片段。
-func (s *Service) QueryTopChunks(ctx context.Context, agentID uint64, query string, limit int) ([]ContextSnippet, error) {
+// vectorSearch 基于查询向量召回最相关的文档片段。
+func (s *Service) vectorSearch(ctx context.Context, agentID uint64, query string, limit int) ([]ContextSnippet, error) {
 	if s.embedder == nil || s.vectors == nil {
 		return nil, nil
 	}
@@ -574,6 +526,14 @@ func (s *Service) QueryTopChunks(ctx context.Context, agentID uint64, query stri
 		return nil, nil
 	}
 
+	idx, err := s.indexFor(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if idx.EmbeddingVersion != s.embeddingVersion {
+		return nil, errIndexOutdated
+	}
+
 	embeddings, err := s.embedder.Embed(ctx, []string{trimmed})
 	if err != nil {
 		return nil, err
@@ -582,21 +542,7 @@ func (s *Service) QueryTopChunks(ctx context.Context, agentID uint64, query stri
 		return nil, nil
 	}
 
-	filter := map[string]interface{}{
-		"must": []map[string]interface{}{
-			{
-				"key":   "agent_id",
-				"match": map[string]interface{}{"value": agentID},
-			},
-			{
-				"key":   "status",
-				"match": map[string]interface{}{"value": "active"},
-			},
-		},
-	}
-
-	collection := s.collectionName(agentID)
-	results, err := s.vectors.Search(ctx, collection, embeddings[0], limit, filter)
+	results, err := s.vectors.Search(ctx, idx.Collection, embeddings[0], limit, searchFilter(agentID))
 	if err != nil {
 		return nil, err
 	}
@@ -605,8 +551,9 @@ func (s *Service) QueryTopChunks(ctx context.Context, agentID uint64, query stri
 	for _, item := range results {
 		payload := item.Payload
 		snippet := ContextSnippet{
-			VectorID: item.ID,
-			Score:    item.Score,
+			VectorID:    item.ID,
+			Score:       item.Score,
+			VectorScore: item.Score,
 		}
 		if payload != nil {
 			if v, ok := payload["document_id"].(float64); ok && v > 0 {
@@ -618,6 +565,12 @@ func (s *Service) QueryTopChunks(ctx context.Context, agentID uint64, query stri
 			if v, ok := payload["source"].(string); ok && v != "" {
 				snippet.Source = &v
 			}
+			if v, ok := payload["heading"].(string); ok {
+				snippet.Heading = v
+			}
+			if page, ok := payload["page"].(float64); ok {
+				snippet.Page = int(page)
+			}
 			if v, ok := payload["text"].(string); ok {
 				snippet.Text = v
 			}
@@ -649,14 +602,6 @@ func (s *Service) vectorSize() int {
 	return 0
 }
 
-// collectionName 根据智能体生成向量集合名称。
-func (s *Service) collectionName(agentID uint64) string {
-	if agentID == 0 {
-		return "agent_knowledge"
-	}
-	return fmt.Sprintf("agent_%d_knowledge", agentID)
-}
-
 // sanitizeDocumentInput 清洗文档输入内容并填充默认值。
 func sanitizeDocumentInput(input DocumentInput) DocumentInput {
 	sanitized := DocumentInput{
@@ -676,7 +621,16 @@ func sanitizeDocumentInput(input DocumentInput) DocumentInput {
 			sanitized.Source = &trimmed
 		}
 	}
+	if input.FileURL != nil {
+		trimmed := strings.TrimSpace(*input.FileURL)
+		if trimmed != "" {
+			sanitized.FileURL = &trimmed
+		}
+	}
 	sanitized.Tags = normalizeTags(input.Tags)
+	sanitized.Sections = input.Sections
+	sanitized.CanonicalURL = input.CanonicalURL
+	sanitized.CrawlSourceID = input.CrawlSourceID
 	return sanitized
 }
 
@@ -744,18 +698,22 @@ func parseTags(raw datatypes.JSON) []string {
 // buildDocumentRecord 构造用于响应的文档记录。
 func buildDocumentRecord(doc Document, chunkCount int, includeContent bool) DocumentRecord {
 	record := DocumentRecord{
-		ID:         doc.ID,
-		AgentID:    doc.AgentID,
-		Title:      doc.Title,
-		Summary:    doc.Summary,
-		Source:     doc.Source,
-		Status:     doc.Status,
-		ChunkCount: chunkCount,
-		CreatedBy:  doc.CreatedBy,
-		UpdatedBy:  doc.UpdatedBy,
-		CreatedAt:  doc.CreatedAt,
-		UpdatedAt:  doc.UpdatedAt,
-		Tags:       parseTags(doc.Tags),
+		ID:           doc.ID,
+		AgentID:      doc.AgentID,
+		Title:        doc.Title,
+		Summary:      doc.Summary,
+		Source:       doc.Source,
+		FileURL:      doc.FileURL,
+		CanonicalURL: doc.CanonicalURL,
+		Status:       doc.Status,
+		IngestStatus: doc.IngestStatus,
+		IngestError:  doc.IngestError,
+		ChunkCount:   chunkCount,
+		CreatedBy:    doc.CreatedBy,
+		UpdatedBy:    doc.UpdatedBy,
+		CreatedAt:    doc.CreatedAt,
+		UpdatedAt:    doc.UpdatedAt,
+		Tags:         parseTags(doc.Tags),
 	}
 	if includeContent {
 		record.Content = doc.Content
@@ -776,3 +734,19 @@ func toStringSlice(values []interface{}) []string {
 	}
 	return result
 }
+
+// ContentBytes 统计智能体知识库正文的总字节数，可排除指定文档（用于更新前的配额校验）。
+func (s *Service) ContentBytes(ctx context.Context, agentID uint64, excludeDocID uint64) (int64, error) {
+	if s.db == nil {
+		return 0, errors.New("knowledge: database connection is not configured")
+	}
+	query := s.db.WithContext(ctx).Model(&Document{}).Where("agent_id = ?", agentID)
+	if excludeDocID != 0 {
+		query = query.Where("id <> ?", excludeDocID)
+	}
+	var total int64
+	if err := query.Select("COALESCE(SUM(LENGTH(content)), 0)").Scan(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
@@ -0,0 +1,92 @@
+package knowledge
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EstimateTokens 按 cl100k 一类 BPE 分词器的预分词规则估算文本的 token 数，并非真实的 BPE 编码结果。
+// 文本先拆为英文缩写、字母串、至多三位的数字组、标点串与空白，再按各类片段的典型合并结果计数：
+// 常见长度的英文单词计 1 个，较长单词约每 4 个字母 1 个，汉字、假名与谚文每字 1 个，
+// 其他文字按 UTF-8 字节约每 3 字节 1 个，标点约每 2 个字符 1 个，单个空格并入其后的片段。
+func EstimateTokens(text string) int {
+	runes := []rune(text)
+	count := 0
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\'' && i > 0 && unicode.IsLetter(runes[i-1]) && contractionLength(runes[i+1:]) > 0:
+			count++
+			i += 1 + contractionLength(runes[i+1:])
+		case isCJKRune(r):
+			count++
+			i++
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(runes) && unicode.IsLetter(runes[j]) && !isCJKRune(runes[j]) {
+				j++
+			}
+			count += wordTokens(runes[i:j])
+			i = j
+		case unicode.IsNumber(r):
+			j := i
+			for j < len(runes) && unicode.IsNumber(runes[j]) {
+				j++
+			}
+			count += (j - i + 2) / 3
+			i = j
+		case unicode.IsSpace(r):
+			j := skipSpaces(runes, i)
+			run := j - i
+			if j < len(runes) && runes[j-1] == ' ' {
+				run--
+			}
+			if run > 0 {
+				count++
+			}
+			i = j
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !unicode.IsLetter(runes[j]) && !unicode.IsNumber(runes[j]) {
+				j++
+			}
+			count += (j - i + 1) / 2
+			i = j
+		}
+	}
+	return count
+}
+
+// contractionLength 返回撇号后英文缩写后缀（s、t、m、d、re、ve、ll）的长度，不是缩写时返回 0。
+func contractionLength(rest []rune) int {
+	for _, suffix := range []string{"re", "ve", "ll", "s", "t", "m", "d"} {
+		n := len(suffix)
+		if len(rest) < n || !strings.EqualFold(string(rest[:n]), suffix) {
+			continue
+		}
+		if len(rest) > n && unicode.IsLetter(rest[n]) {
+			continue
+		}
+		return n
+	}
+	return 0
+}
+
+// wordTokens 估算单个非 CJK 字母串的 token 数。
+func wordTokens(word []rune) int {
+	ascii := true
+	for _, r := range word {
+		if r >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if !ascii {
+		return (len(string(word)) + 2) / 3
+	}
+	if len(word) <= 8 {
+		return 1
+	}
+	return 1 + (len(word)-5)/4
+}
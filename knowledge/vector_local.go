@@ -0,0 +1,683 @@
+package knowledge
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+const (
+	defaultLocalVectorDir = "data/vectors"
+	localVectorFileExt    = ".vec"
+	localVectorLogExt     = ".log"
+	// defaultLocalCompactBytes 为触发压缩的日志大小下限，日志同时超过快照大小时才重写快照。
+	defaultLocalCompactBytes = 4 << 20
+)
+
+// 日志记录的操作类型。
+const (
+	localOpUpsert uint8 = iota + 1
+	localOpPayload
+	localOpDelete
+	localOpDim
+)
+
+// collectionNamePattern 限制集合名称可用字符，集合名直接作为文件名。
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// localVectorStore 是内嵌的向量存储：每个集合一个快照文件加一个追加写的操作日志，内存中暴力计算余弦相似度，适合单机部署。
+type localVectorStore struct {
+	dir          string
+	compactBytes int64
+	mu           sync.Mutex
+	collections  map[string]*localCollection
+}
+
+// localCollection 为单个集合的内存数据，向量写入时已归一化。
+// 每次写操作只向日志追加一条记录，日志超过 compactBytes 且大于快照时才重写快照并清空日志。
+type localCollection struct {
+	mu           sync.RWMutex
+	name         string
+	path         string
+	logPath      string
+	compactBytes int64
+	snapshotSize int64
+	logSize      int64
+	dim          int
+	ids          []string
+	vecs         [][]float32
+	pays         []map[string]interface{}
+	byID         map[string]int
+}
+
+// localCollectionFile 为集合的磁盘格式，负载以 JSON 保存以保持与 Qdrant 一致的数值类型。
+type localCollectionFile struct {
+	Dim      int
+	IDs      []string
+	Vectors  [][]float32
+	Payloads [][]byte
+}
+
+// localLogRecord 为日志中的一条操作，负载为操作后的完整负载，重放多次结果不变。
+type localLogRecord struct {
+	Op       uint8
+	Dim      int
+	IDs      []string
+	Vectors  [][]float32
+	Payloads [][]byte
+}
+
+// newLocalVectorStoreFromEnv 从 KNOWLEDGE_VECTOR_DIR 初始化内嵌向量存储。
+func newLocalVectorStoreFromEnv() (*localVectorStore, error) {
+	return newLocalVectorStore(getEnvDefault("KNOWLEDGE_VECTOR_DIR", defaultLocalVectorDir))
+}
+
+// newLocalVectorStore 创建以 dir 为数据目录的内嵌向量存储。
+func newLocalVectorStore(dir string) (*localVectorStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("knowledge: create vector directory: %w", err)
+	}
+	return &localVectorStore{dir: dir, compactBytes: defaultLocalCompactBytes, collections: make(map[string]*localCollection)}, nil
+}
+
+// collection 返回已加载的集合，create 为 false 且文件不存在时返回 nil。
+func (s *localVectorStore) collection(name string, create bool) (*localCollection, error) {
+	if !collectionNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("knowledge: invalid collection name %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if coll, ok := s.collections[name]; ok {
+		return coll, nil
+	}
+
+	path := filepath.Join(s.dir, name+localVectorFileExt)
+	coll := &localCollection{
+		name:         name,
+		path:         path,
+		logPath:      path + localVectorLogExt,
+		compactBytes: s.compactBytes,
+		byID:         make(map[string]int),
+	}
+	if err := coll.load(); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if !create {
+			return nil, nil
+		}
+	}
+	s.collections[name] = coll
+	return coll, nil
+}
+
+// EnsureCollection 确保集合存在，已存在时校验向量维度。
+func (s *localVectorStore) EnsureCollection(ctx context.Context, name string, vectorSize int) error {
+	coll, err := s.collection(name, true)
+	if err != nil {
+		return err
+	}
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+	if vectorSize > 0 && coll.dim > 0 && coll.dim != vectorSize {
+		return fmt.Errorf("knowledge: collection %s has vector size %d, expected %d", name, coll.dim, vectorSize)
+	}
+	if coll.dim == 0 && vectorSize > 0 {
+		coll.dim = vectorSize
+		return coll.appendLog(localLogRecord{Op: localOpDim, Dim: vectorSize})
+	}
+	if !coll.exists() {
+		return coll.persist()
+	}
+	return nil
+}
+
+// UpsertPoints 写入或覆盖向量点并持久化到磁盘。
+func (s *localVectorStore) UpsertPoints(ctx context.Context, collection string, points []VectorPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	coll, err := s.collection(collection, true)
+	if err != nil {
+		return err
+	}
+
+	normalized := make([][]float32, len(points))
+	payloads := make([]map[string]interface{}, len(points))
+	for i, point := range points {
+		if point.ID == "" {
+			return errors.New("knowledge: vector point id is required")
+		}
+		normalized[i] = normalizeVector(point.Vector)
+		if normalized[i] == nil {
+			return fmt.Errorf("knowledge: vector point %s has zero norm", point.ID)
+		}
+		payloads[i], err = roundTripPayload(point.Payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+	dim := coll.dim
+	if dim == 0 {
+		dim = len(normalized[0])
+	}
+	for _, vec := range normalized {
+		if len(vec) != dim {
+			return fmt.Errorf("knowledge: vector length %d does not match collection size %d", len(vec), dim)
+		}
+	}
+	encoded, err := encodePayloads(payloads)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(points))
+	for i, point := range points {
+		ids[i] = point.ID
+	}
+	coll.dim = dim
+	coll.applyUpsert(ids, normalized, payloads)
+	return coll.appendLog(localLogRecord{Op: localOpUpsert, Dim: dim, IDs: ids, Vectors: normalized, Payloads: encoded})
+}
+
+// SetPayload 合并更新指定点的负载，nil 值删除对应字段，不存在的点忽略。
+func (s *localVectorStore) SetPayload(ctx context.Context, collection string, pointIDs []string, payload map[string]interface{}) error {
+	if len(pointIDs) == 0 || len(payload) == 0 {
+		return nil
+	}
+	coll, err := s.collection(collection, false)
+	if err != nil || coll == nil {
+		return err
+	}
+	patch, err := roundTripPayload(payload)
+	if err != nil {
+		return err
+	}
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+	var (
+		ids    []string
+		merges []map[string]interface{}
+	)
+	for _, id := range pointIDs {
+		idx, ok := coll.byID[id]
+		if !ok {
+			continue
+		}
+		merged := make(map[string]interface{}, len(coll.pays[idx])+len(patch))
+		for key, value := range coll.pays[idx] {
+			merged[key] = value
+		}
+		for key, value := range patch {
+			if value == nil {
+				delete(merged, key)
+				continue
+			}
+			merged[key] = value
+		}
+		ids = append(ids, id)
+		merges = append(merges, merged)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	encoded, err := encodePayloads(merges)
+	if err != nil {
+		return err
+	}
+	coll.applyPayloads(ids, merges)
+	return coll.appendLog(localLogRecord{Op: localOpPayload, IDs: ids, Payloads: encoded})
+}
+
+// DeletePoints 删除指定向量点，末尾元素填补空位以避免整体移动。
+func (s *localVectorStore) DeletePoints(ctx context.Context, collection string, pointIDs []string) error {
+	if len(pointIDs) == 0 {
+		return nil
+	}
+	coll, err := s.collection(collection, false)
+	if err != nil || coll == nil {
+		return err
+	}
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+	var removed []string
+	for _, id := range pointIDs {
+		if _, ok := coll.byID[id]; ok {
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	coll.applyDelete(removed)
+	return coll.appendLog(localLogRecord{Op: localOpDelete, IDs: removed})
+}
+
+// DeleteCollection 删除集合的快照与日志文件。
+func (s *localVectorStore) DeleteCollection(ctx context.Context, name string) error {
+	if !collectionNamePattern.MatchString(name) {
+		return fmt.Errorf("knowledge: invalid collection name %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.collections, name)
+	path := filepath.Join(s.dir, name+localVectorFileExt)
+	for _, file := range []string{path, path + localVectorLogExt} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("knowledge: delete vector collection %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Search 对满足过滤条件的点逐一计算余弦相似度，返回得分最高的 limit 个结果。
+func (s *localVectorStore) Search(ctx context.Context, collection string, vector []float32, limit int, filter PayloadFilter) ([]VectorSearchResult, error) {
+	if len(vector) == 0 {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = 5
+	}
+	coll, err := s.collection(collection, false)
+	if err != nil || coll == nil {
+		return nil, err
+	}
+	query := normalizeVector(vector)
+	if query == nil {
+		return nil, nil
+	}
+	expected, err := roundTripPayload(map[string]interface{}(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	coll.mu.RLock()
+	defer coll.mu.RUnlock()
+	if coll.dim > 0 && len(query) != coll.dim {
+		return nil, fmt.Errorf("knowledge: query vector length %d does not match collection size %d", len(query), coll.dim)
+	}
+
+	top := &scoredHeap{}
+	for i, vec := range coll.vecs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !payloadMatches(coll.pays[i], expected) {
+			continue
+		}
+		score := dotProduct(query, vec)
+		if top.Len() < limit {
+			heap.Push(top, scoredEntry{index: i, score: score})
+		} else if score > (*top)[0].score {
+			(*top)[0] = scoredEntry{index: i, score: score}
+			heap.Fix(top, 0)
+		}
+	}
+
+	results := make([]VectorSearchResult, top.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		entry := heap.Pop(top).(scoredEntry)
+		results[i] = VectorSearchResult{
+			ID:      coll.ids[entry.index],
+			Score:   entry.score,
+			Payload: coll.pays[entry.index],
+		}
+	}
+	return results, nil
+}
+
+// applyUpsert 写入或覆盖内存中的向量点。
+func (c *localCollection) applyUpsert(ids []string, vecs [][]float32, pays []map[string]interface{}) {
+	for i, id := range ids {
+		if idx, ok := c.byID[id]; ok {
+			c.vecs[idx] = vecs[i]
+			c.pays[idx] = pays[i]
+			continue
+		}
+		c.byID[id] = len(c.ids)
+		c.ids = append(c.ids, id)
+		c.vecs = append(c.vecs, vecs[i])
+		c.pays = append(c.pays, pays[i])
+	}
+}
+
+// applyPayloads 替换已存在点的负载。
+func (c *localCollection) applyPayloads(ids []string, pays []map[string]interface{}) {
+	for i, id := range ids {
+		if idx, ok := c.byID[id]; ok {
+			c.pays[idx] = pays[i]
+		}
+	}
+}
+
+// applyDelete 删除内存中的向量点，末尾元素填补空位以避免整体移动。
+func (c *localCollection) applyDelete(ids []string) {
+	for _, id := range ids {
+		idx, ok := c.byID[id]
+		if !ok {
+			continue
+		}
+		last := len(c.ids) - 1
+		if idx != last {
+			c.ids[idx], c.vecs[idx], c.pays[idx] = c.ids[last], c.vecs[last], c.pays[last]
+			c.byID[c.ids[idx]] = idx
+		}
+		c.ids, c.vecs, c.pays = c.ids[:last], c.vecs[:last], c.pays[:last]
+		delete(c.byID, id)
+	}
+}
+
+// exists 判断集合在磁盘上是否已有快照或日志。
+func (c *localCollection) exists() bool {
+	for _, file := range []string{c.path, c.logPath} {
+		if _, err := os.Stat(file); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// load 读取快照并重放日志，两者都不存在时返回 os.ErrNotExist。
+func (c *localCollection) load() error {
+	snapshotErr := c.loadSnapshot()
+	if snapshotErr != nil && !errors.Is(snapshotErr, os.ErrNotExist) {
+		return snapshotErr
+	}
+	logErr := c.replayLog()
+	if logErr != nil && !errors.Is(logErr, os.ErrNotExist) {
+		return logErr
+	}
+	if snapshotErr != nil && logErr != nil {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// loadSnapshot 从快照文件读取集合数据。
+func (c *localCollection) loadSnapshot() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	var file localCollectionFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&file); err != nil {
+		return fmt.Errorf("knowledge: decode vector collection %s: %w", c.name, err)
+	}
+	if len(file.IDs) != len(file.Vectors) || len(file.IDs) != len(file.Payloads) {
+		return fmt.Errorf("knowledge: vector collection %s is corrupted", c.name)
+	}
+	pays, err := c.decodePayloads(file.Payloads)
+	if err != nil {
+		return err
+	}
+	c.dim = file.Dim
+	c.ids = file.IDs
+	c.vecs = file.Vectors
+	c.pays = pays
+	for i, id := range c.ids {
+		c.byID[id] = i
+	}
+	c.snapshotSize = int64(len(data))
+	return nil
+}
+
+// replayLog 依次应用日志中的记录；末尾不完整的记录（写入中途崩溃）会被截断丢弃。
+func (c *localCollection) replayLog() error {
+	data, err := os.ReadFile(c.logPath)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for offset < len(data) {
+		if len(data)-offset < 4 {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		if len(data)-offset-4 < size {
+			break
+		}
+		var record localLogRecord
+		if err := gob.NewDecoder(bytes.NewReader(data[offset+4 : offset+4+size])).Decode(&record); err != nil {
+			break
+		}
+		if err := c.applyRecord(record); err != nil {
+			return err
+		}
+		offset += 4 + size
+	}
+	if offset < len(data) {
+		log.Printf("knowledge: vector log %s has %d trailing bytes, truncating", c.logPath, len(data)-offset)
+		if err := os.Truncate(c.logPath, int64(offset)); err != nil {
+			return fmt.Errorf("knowledge: truncate vector log %s: %w", c.name, err)
+		}
+	}
+	c.logSize = int64(offset)
+	return nil
+}
+
+// applyRecord 将一条日志记录应用到内存数据。
+func (c *localCollection) applyRecord(record localLogRecord) error {
+	switch record.Op {
+	case localOpDim:
+		c.dim = record.Dim
+	case localOpUpsert:
+		if len(record.IDs) != len(record.Vectors) || len(record.IDs) != len(record.Payloads) {
+			return fmt.Errorf("knowledge: vector log %s is corrupted", c.name)
+		}
+		pays, err := c.decodePayloads(record.Payloads)
+		if err != nil {
+			return err
+		}
+		c.dim = record.Dim
+		c.applyUpsert(record.IDs, record.Vectors, pays)
+	case localOpPayload:
+		if len(record.IDs) != len(record.Payloads) {
+			return fmt.Errorf("knowledge: vector log %s is corrupted", c.name)
+		}
+		pays, err := c.decodePayloads(record.Payloads)
+		if err != nil {
+			return err
+		}
+		c.applyPayloads(record.IDs, pays)
+	case localOpDelete:
+		c.applyDelete(record.IDs)
+	default:
+		return fmt.Errorf("knowledge: vector log %s has unknown operation %d", c.name, record.Op)
+	}
+	return nil
+}
+
+// appendLog 向日志追加一条记录，日志足够大时压缩为新快照。调用方需持有写锁。
+func (c *localCollection) appendLog(record localLogRecord) error {
+	buf := &bytes.Buffer{}
+	buf.Write(make([]byte, 4))
+	if err := gob.NewEncoder(buf).Encode(record); err != nil {
+		return fmt.Errorf("knowledge: encode vector log record: %w", err)
+	}
+	frame := buf.Bytes()
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+
+	file, err := os.OpenFile(c.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("knowledge: open vector log %s: %w", c.name, err)
+	}
+	_, err = file.Write(frame)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("knowledge: append vector log %s: %w", c.name, err)
+	}
+	c.logSize += int64(len(frame))
+	if c.logSize >= c.compactBytes && c.logSize >= c.snapshotSize {
+		return c.persist()
+	}
+	return nil
+}
+
+// persist 将完整集合写入临时文件后原子替换快照，再清空日志。调用方需持有写锁。
+// 替换快照后、删除日志前崩溃时，重放旧日志的结果与快照一致。
+func (c *localCollection) persist() error {
+	payloads, err := encodePayloads(c.pays)
+	if err != nil {
+		return err
+	}
+	file := localCollectionFile{
+		Dim:      c.dim,
+		IDs:      c.ids,
+		Vectors:  c.vecs,
+		Payloads: payloads,
+	}
+
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(file); err != nil {
+		return fmt.Errorf("knowledge: encode vector collection %s: %w", c.name, err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("knowledge: write vector collection %s: %w", c.name, err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("knowledge: replace vector collection %s: %w", c.name, err)
+	}
+	if err := os.Remove(c.logPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("knowledge: reset vector log %s: %w", c.name, err)
+	}
+	c.snapshotSize = int64(buf.Len())
+	c.logSize = 0
+	return nil
+}
+
+// encodePayloads 将负载编码为 JSON，以保持与 Qdrant 一致的数值类型。
+func encodePayloads(pays []map[string]interface{}) ([][]byte, error) {
+	encoded := make([][]byte, len(pays))
+	for i, payload := range pays {
+		if payload == nil {
+			continue
+		}
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("knowledge: encode vector payload: %w", err)
+		}
+		encoded[i] = raw
+	}
+	return encoded, nil
+}
+
+// decodePayloads 解码 encodePayloads 的结果。
+func (c *localCollection) decodePayloads(raw [][]byte) ([]map[string]interface{}, error) {
+	pays := make([]map[string]interface{}, len(raw))
+	for i, item := range raw {
+		if len(item) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(item, &pays[i]); err != nil {
+			return nil, fmt.Errorf("knowledge: decode vector payload in %s: %w", c.name, err)
+		}
+	}
+	return pays, nil
+}
+
+// roundTripPayload 经 JSON 编解码统一负载中的数值与切片类型。
+func roundTripPayload(payload map[string]interface{}) (map[string]interface{}, error) {
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("knowledge: encode vector payload: %w", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, fmt.Errorf("knowledge: decode vector payload: %w", err)
+	}
+	return decoded, nil
+}
+
+// payloadMatches 判断负载是否满足所有过滤字段。
+func payloadMatches(payload map[string]interface{}, expected map[string]interface{}) bool {
+	for key, want := range expected {
+		got, ok := payload[key]
+		if !ok {
+			return false
+		}
+		if values, isList := got.([]interface{}); isList {
+			found := false
+			for _, value := range values {
+				if value == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+			continue
+		}
+		if got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeVector 返回单位化后的向量副本，零向量返回 nil。
+func normalizeVector(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return nil
+	}
+	norm := math.Sqrt(sum)
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
+}
+
+// dotProduct 计算两个等长向量的点积。
+func dotProduct(a, b []float32) float64 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return float64(sum)
+}
+
+// scoredEntry 为检索过程中的候选点。
+type scoredEntry struct {
+	index int
+	score float64
+}
+
+// scoredHeap 是按分数排列的小顶堆，用于保留得分最高的候选。
+type scoredHeap []scoredEntry
+
+func (h scoredHeap) Len() int            { return len(h) }
+func (h scoredHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h scoredHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scoredHeap) Push(x interface{}) { *h = append(*h, x.(scoredEntry)) }
+func (h *scoredHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,214 @@
+package knowledge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestLocalStore(t *testing.T, dir string) *localVectorStore {
+	t.Helper()
+	store, err := newLocalVectorStore(dir)
+	if err != nil {
+		t.Fatalf("new local store: %v", err)
+	}
+	return store
+}
+
+func searchIDs(t *testing.T, store *localVectorStore, vector []float32, limit int, filter PayloadFilter) []string {
+	t.Helper()
+	results, err := store.Search(context.Background(), "docs", vector, limit, filter)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+// seedLocalStore 写入三个二维向量点。
+func seedLocalStore(t *testing.T, store *localVectorStore) {
+	t.Helper()
+	ctx := context.Background()
+	if err := store.EnsureCollection(ctx, "docs", 2); err != nil {
+		t.Fatalf("ensure collection: %v", err)
+	}
+	points := []VectorPoint{
+		{ID: "a", Vector: []float32{1, 0}, Payload: map[string]interface{}{"agent_id": 1, "tags": []string{"faq"}}},
+		{ID: "b", Vector: []float32{1, 1}, Payload: map[string]interface{}{"agent_id": 1, "tags": []string{"guide", "faq"}}},
+		{ID: "c", Vector: []float32{0, 3}, Payload: map[string]interface{}{"agent_id": 2}},
+	}
+	if err := store.UpsertPoints(ctx, "docs", points); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+}
+
+func TestLocalVectorStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestLocalStore(t, dir)
+	seedLocalStore(t, store)
+
+	if got := searchIDs(t, store, []float32{1, 0}, 3, nil); !equalStrings(got, []string{"a", "b", "c"}) {
+		t.Errorf("search = %v, want by similarity", got)
+	}
+
+	reloaded := newTestLocalStore(t, dir)
+	results, err := reloaded.Search(context.Background(), "docs", []float32{0, 1}, 1, nil)
+	if err != nil {
+		t.Fatalf("search after reload: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "c" || results[0].Score < 0.999 {
+		t.Fatalf("results = %+v, want c with score 1", results)
+	}
+	// 负载经 JSON 往返，数值统一为 float64。
+	if results[0].Payload["agent_id"] != float64(2) {
+		t.Errorf("payload = %v", results[0].Payload)
+	}
+	if err := reloaded.EnsureCollection(context.Background(), "docs", 3); err == nil {
+		t.Error("expected dimension mismatch after reload")
+	}
+}
+
+func TestLocalVectorStoreFilter(t *testing.T) {
+	store := newTestLocalStore(t, t.TempDir())
+	seedLocalStore(t, store)
+
+	tests := []struct {
+		name   string
+		filter PayloadFilter
+		want   []string
+	}{
+		{"scalar", PayloadFilter{"agent_id": 1}, []string{"a", "b"}},
+		{"list contains", PayloadFilter{"tags": "guide"}, []string{"b"}},
+		{"all fields", PayloadFilter{"agent_id": 1, "tags": "faq"}, []string{"a", "b"}},
+		{"missing field", PayloadFilter{"tags": "faq", "agent_id": 2}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchIDs(t, store, []float32{1, 0}, 10, tt.filter); !equalStrings(got, tt.want) {
+				t.Errorf("search = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalVectorStoreDeleteAndPayloadReload(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store := newTestLocalStore(t, dir)
+	seedLocalStore(t, store)
+
+	if err := store.DeletePoints(ctx, "docs", []string{"a", "missing"}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := store.SetPayload(ctx, "docs", []string{"b"}, map[string]interface{}{"agent_id": 3, "tags": nil}); err != nil {
+		t.Fatalf("set payload: %v", err)
+	}
+	if err := store.UpsertPoints(ctx, "docs", []VectorPoint{{ID: "c", Vector: []float32{1, 0}, Payload: map[string]interface{}{"agent_id": 2}}}); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+
+	for name, s := range map[string]*localVectorStore{"live": store, "reloaded": newTestLocalStore(t, dir)} {
+		t.Run(name, func(t *testing.T) {
+			if got := searchIDs(t, s, []float32{1, 0}, 10, nil); !equalStrings(got, []string{"c", "b"}) {
+				t.Errorf("search = %v, want [c b]", got)
+			}
+			if got := searchIDs(t, s, []float32{1, 0}, 10, PayloadFilter{"agent_id": 3}); !equalStrings(got, []string{"b"}) {
+				t.Errorf("patched payload search = %v", got)
+			}
+			if got := searchIDs(t, s, []float32{1, 0}, 10, PayloadFilter{"tags": "faq"}); len(got) != 0 {
+				t.Errorf("cleared field still matches: %v", got)
+			}
+		})
+	}
+
+	if err := store.DeleteCollection(ctx, "docs"); err != nil {
+		t.Fatalf("delete collection: %v", err)
+	}
+	if got := searchIDs(t, newTestLocalStore(t, dir), []float32{1, 0}, 10, nil); len(got) != 0 {
+		t.Errorf("search after collection delete = %v", got)
+	}
+}
+
+func TestLocalVectorStoreAppendsAndCompacts(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store := newTestLocalStore(t, dir)
+	seedLocalStore(t, store)
+
+	snapshot := filepath.Join(dir, "docs"+localVectorFileExt)
+	logPath := snapshot + localVectorLogExt
+	if _, err := os.Stat(snapshot); !os.IsNotExist(err) {
+		t.Fatalf("small writes created a snapshot: %v", err)
+	}
+	if info, err := os.Stat(logPath); err != nil || info.Size() == 0 {
+		t.Fatalf("log missing after writes: %v", err)
+	}
+
+	// 压缩阈值降到最低后，下一次写入会重写快照并清空日志。
+	coll := store.collections["docs"]
+	coll.compactBytes = 1
+	if err := store.DeletePoints(ctx, "docs", []string{"c"}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("log not removed after compaction: %v", err)
+	}
+	before, err := os.Stat(snapshot)
+	if err != nil {
+		t.Fatalf("stat snapshot: %v", err)
+	}
+
+	// 日志小于快照时只追加日志，不重写快照。
+	coll.compactBytes = defaultLocalCompactBytes
+	if err := store.SetPayload(ctx, "docs", []string{"a"}, map[string]interface{}{"title": "x"}); err != nil {
+		t.Fatalf("set payload: %v", err)
+	}
+	after, err := os.Stat(snapshot)
+	if err != nil {
+		t.Fatalf("stat snapshot: %v", err)
+	}
+	if !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() {
+		t.Error("snapshot was rewritten for a small update")
+	}
+
+	reloaded := newTestLocalStore(t, dir)
+	if got := searchIDs(t, reloaded, []float32{1, 0}, 10, nil); !equalStrings(got, []string{"a", "b"}) {
+		t.Errorf("search after reload = %v, want [a b]", got)
+	}
+	if got := searchIDs(t, reloaded, []float32{1, 0}, 10, PayloadFilter{"title": "x"}); !equalStrings(got, []string{"a"}) {
+		t.Errorf("payload from log after reload = %v", got)
+	}
+}
+
+func TestLocalVectorStoreTruncatesPartialLogRecord(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestLocalStore(t, dir)
+	seedLocalStore(t, store)
+
+	logPath := filepath.Join(dir, "docs"+localVectorFileExt+localVectorLogExt)
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatalf("stat log: %v", err)
+	}
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	// 模拟写入记录时崩溃：长度头声明 100 字节但只写入 2 字节。
+	if _, err := file.Write([]byte{0, 0, 0, 100, 1, 2}); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+	file.Close()
+
+	reloaded := newTestLocalStore(t, dir)
+	if got := searchIDs(t, reloaded, []float32{1, 0}, 10, nil); !equalStrings(got, []string{"a", "b", "c"}) {
+		t.Errorf("search = %v, want the complete records", got)
+	}
+	if truncated, err := os.Stat(logPath); err != nil || truncated.Size() != info.Size() {
+		t.Errorf("log size = %v, want %d", truncated, info.Size())
+	}
+}
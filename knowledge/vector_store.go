@@ -0,0 +1,72 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	vectorStoreQdrant = "qdrant"
+	vectorStoreLocal  = "local"
+)
+
+// VectorPoint 表示写入向量库的单个点。
+type VectorPoint struct {
+	ID      string                 `json:"id"`
+	Vector  []float32              `json:"vector"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// VectorSearchResult 封装相似度搜索结果及匹配分数（余弦相似度）。
+// Payload 中的数值统一为 float64，与 JSON 解码结果一致。
+type VectorSearchResult struct {
+	ID      string                 `json:"id"`
+	Score   float64                `json:"score"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// PayloadFilter 描述按负载字段精确匹配的过滤条件，所有字段均需匹配；负载值为数组时包含即视为匹配。
+type PayloadFilter map[string]interface{}
+
+// VectorStore 定义知识库使用的向量存储能力。
+// SetPayload 将 payload 中的字段合并到指定点的负载，值为 nil 的字段视为清除。
+type VectorStore interface {
+	EnsureCollection(ctx context.Context, name string, vectorSize int) error
+	UpsertPoints(ctx context.Context, collection string, points []VectorPoint) error
+	SetPayload(ctx context.Context, collection string, pointIDs []string, payload map[string]interface{}) error
+	DeletePoints(ctx context.Context, collection string, pointIDs []string) error
+	Search(ctx context.Context, collection string, vector []float32, limit int, filter PayloadFilter) ([]VectorSearchResult, error)
+	DeleteCollection(ctx context.Context, name string) error
+}
+
+// NewVectorStoreFromEnv 根据 KNOWLEDGE_VECTOR_STORE 选择向量存储：qdrant（默认）或 local 内嵌存储。
+func NewVectorStoreFromEnv() (VectorStore, error) {
+	switch backend := strings.ToLower(getEnvDefault("KNOWLEDGE_VECTOR_STORE", vectorStoreQdrant)); backend {
+	case vectorStoreQdrant:
+		client, err := newQdrantClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case vectorStoreLocal:
+		store, err := newLocalVectorStoreFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("knowledge: unknown vector store %q", backend)
+	}
+}
+
+// vectorDimFromEnv 读取配置的向量维度，未配置时返回 0，由首次写入的数据决定。
+func vectorDimFromEnv() int {
+	for _, key := range []string{"QDRANT_VECTOR_DIM", "EMBEDDING_VECTOR_DIM"} {
+		if parsed, err := strconv.Atoi(getEnvDefault(key, "")); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return 0
+}
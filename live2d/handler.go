@@ -3,6 +3,7 @@ package live2d
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -36,15 +37,16 @@ type createModelForm struct {
 
 // modelDTO 为接口响应准备的模型数据结构。
 type modelDTO struct {
-	ID          uint64  `json:"id"`
-	Key         string  `json:"key"`
-	Name        string  `json:"name"`
-	Description *string `json:"description,omitempty"`
-	EntryURL    string  `json:"entry_url"`
-	PreviewURL  *string `json:"preview_url,omitempty"`
-	StorageType string  `json:"storage_type"`
-	CreatedAt   int64   `json:"created_at"`
-	UpdatedAt   int64   `json:"updated_at"`
+	ID          uint64   `json:"id"`
+	Key         string   `json:"key"`
+	Name        string   `json:"name"`
+	Description *string  `json:"description,omitempty"`
+	EntryURL    string   `json:"entry_url"`
+	PreviewURL  *string  `json:"preview_url,omitempty"`
+	StorageType string   `json:"storage_type"`
+	Motions     []string `json:"motions,omitempty"`
+	CreatedAt   int64    `json:"created_at"`
+	UpdatedAt   int64    `json:"updated_at"`
 }
 
 // RegisterRoutes 注册 Live2D 模型相关路由。
@@ -64,6 +66,7 @@ func RegisterRoutes(router *gin.Engine, guard *authorization.Guard) (*Module, er
 	}
 
 	module := &Module{db: db, storage: storage}
+	module.backfillMotions()
 
 	group := router.Group("/live2d/models")
 	group.GET("", module.handleListModels)
@@ -188,6 +191,7 @@ func (m *Module) handleCreateModel(c *gin.Context) {
 	var storagePath string
 	var entryFile string
 	var previewFile *string
+	var motions []string
 
 	if archive != nil {
 		if m.storage == nil {
@@ -203,6 +207,11 @@ func (m *Module) handleCreateModel(c *gin.Context) {
 		storagePath = folder
 		entryFile = entry
 		previewFile = preview
+		if groups, err := m.storage.readMotionGroups(folder, entry); err != nil {
+			log.Printf("live2d: read motions for %s failed: %v", folder, err)
+		} else {
+			motions = groups
+		}
 	} else {
 		if !isValidURL(externalModelURL) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "external_model_url must be a valid absolute URL or an absolute path"})
@@ -234,6 +243,9 @@ func (m *Module) handleCreateModel(c *gin.Context) {
 		StoragePath: storagePath,
 		EntryFile:   entryFile,
 	}
+	if motions != nil {
+		model.Motions = encodeMotionGroups(motions)
+	}
 	if description != "" {
 		model.Description = &description
 	}
@@ -383,6 +395,7 @@ func (m *Module) toDTO(model *Live2DModel) modelDTO {
 		Name:        model.Name,
 		EntryURL:    m.entryURL(model),
 		StorageType: model.StorageType,
+		Motions:     decodeMotionGroups(model.Motions),
 		CreatedAt:   model.CreatedAt.Unix(),
 		UpdatedAt:   model.UpdatedAt.Unix(),
 	}
@@ -1,19 +1,24 @@
 package live2d
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
 
 // Live2DModel 表示可供前端渲染的 Live2D 资源。
 type Live2DModel struct {
-	ID          uint64    `gorm:"primaryKey" json:"id"`
-	Key         string    `gorm:"size:64;uniqueIndex" json:"key"`
-	Name        string    `gorm:"size:100;not null" json:"name"`
-	Description *string   `gorm:"type:text" json:"description,omitempty"`
-	StorageType string    `gorm:"size:16;not null;default:'local'" json:"storage_type"`
-	StoragePath string    `gorm:"size:255" json:"storage_path"`
-	EntryFile   string    `gorm:"size:255;not null" json:"entry_file"`
-	PreviewFile *string   `gorm:"size:255" json:"preview_file,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint64         `gorm:"primaryKey" json:"id"`
+	Key         string         `gorm:"size:64;uniqueIndex" json:"key"`
+	Name        string         `gorm:"size:100;not null" json:"name"`
+	Description *string        `gorm:"type:text" json:"description,omitempty"`
+	StorageType string         `gorm:"size:16;not null;default:'local'" json:"storage_type"`
+	StoragePath string         `gorm:"size:255" json:"storage_path"`
+	EntryFile   string         `gorm:"size:255;not null" json:"entry_file"`
+	PreviewFile *string        `gorm:"size:255" json:"preview_file,omitempty"`
+	Motions     datatypes.JSON `gorm:"type:json" json:"motions,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
 }
 
 // TableName 指定 Live2DModel 的数据库表名。
@@ -0,0 +1,155 @@
+package live2d
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// maxManifestBytes 限制读取的模型清单大小。
+const maxManifestBytes = 4 << 20
+
+// modelManifest 描述 model3.json（Cubism 3+）与 model.json（Cubism 2）中的动作声明。
+type modelManifest struct {
+	FileReferences struct {
+		Motions map[string]json.RawMessage `json:"Motions"`
+	} `json:"FileReferences"`
+	Motions map[string]json.RawMessage `json:"motions"`
+}
+
+// parseMotionGroups 从模型清单中提取动作组名称，按字典序返回。
+func parseMotionGroups(data []byte) ([]string, error) {
+	var manifest modelManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("live2d: parse model manifest: %w", err)
+	}
+	source := manifest.FileReferences.Motions
+	if len(source) == 0 {
+		source = manifest.Motions
+	}
+	groups := make([]string, 0, len(source))
+	for name := range source {
+		if trimmed := strings.TrimSpace(name); trimmed != "" {
+			groups = append(groups, trimmed)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// readMotionGroups 读取本地模型入口文件并解析动作组。
+func (s *assetStorage) readMotionGroups(folder, entry string) ([]string, error) {
+	if s == nil {
+		return nil, errors.New("live2d: asset storage not configured")
+	}
+	rel := normalizeArchivePath(entry)
+	if rel == "" {
+		return nil, errors.New("live2d: entry file missing")
+	}
+	base := filepath.Join(s.baseDir, folder)
+	target := filepath.Join(base, filepath.FromSlash(rel))
+	if !strings.HasPrefix(target, base+string(os.PathSeparator)) {
+		return nil, errors.New("live2d: entry file outside model folder")
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxManifestBytes {
+		return nil, fmt.Errorf("live2d: model manifest exceeds %d bytes", maxManifestBytes)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+	return parseMotionGroups(data)
+}
+
+// encodeMotionGroups 将动作组编码为 JSON 列值。
+func encodeMotionGroups(groups []string) datatypes.JSON {
+	if groups == nil {
+		groups = []string{}
+	}
+	raw, err := json.Marshal(groups)
+	if err != nil {
+		return nil
+	}
+	return datatypes.JSON(raw)
+}
+
+// decodeMotionGroups 解析 JSON 列中的动作组。
+func decodeMotionGroups(raw datatypes.JSON) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var groups []string
+	if err := json.Unmarshal(raw, &groups); err != nil {
+		return nil
+	}
+	return groups
+}
+
+// backfillMotions 为升级前上传、尚未记录动作组的本地模型补齐元数据。
+func (m *Module) backfillMotions() {
+	if m.storage == nil {
+		return
+	}
+	var models []Live2DModel
+	if err := m.db.Where("storage_type = ? AND motions IS NULL", "local").Find(&models).Error; err != nil {
+		log.Printf("live2d: load models for motion backfill failed: %v", err)
+		return
+	}
+	for _, model := range models {
+		groups, err := m.storage.readMotionGroups(model.StoragePath, model.EntryFile)
+		if err != nil {
+			log.Printf("live2d: read motions for model %d failed: %v", model.ID, err)
+			continue
+		}
+		if err := m.db.Model(&Live2DModel{}).Where("id = ?", model.ID).Update("motions", encodeMotionGroups(groups)).Error; err != nil {
+			log.Printf("live2d: store motions for model %d failed: %v", model.ID, err)
+		}
+	}
+}
+
+// LoadModelMotions 按智能体保存的模型引用（入口 URL、ID 或 key）返回模型声明的动作组，未知模型或无元数据时返回 nil。
+func LoadModelMotions(ctx context.Context, db *gorm.DB, ref string) []string {
+	trimmed := strings.TrimSpace(ref)
+	if db == nil || trimmed == "" {
+		return nil
+	}
+
+	query := db.WithContext(ctx).Model(&Live2DModel{}).Select("motions")
+	if rest, ok := strings.CutPrefix(trimmed, "/live2d/models/"); ok {
+		idPart, _, _ := strings.Cut(rest, "/")
+		id, err := strconv.ParseUint(idPart, 10, 64)
+		if err != nil {
+			return nil
+		}
+		query = query.Where("id = ?", id)
+	} else if id, err := strconv.ParseUint(trimmed, 10, 64); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("`key` = ? OR entry_file = ?", trimmed, trimmed)
+	}
+
+	var row struct {
+		Motions datatypes.JSON
+	}
+	if err := query.Take(&row).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("live2d: load motions for %q failed: %v", trimmed, err)
+		}
+		return nil
+	}
+	return decodeMotionGroups(row.Motions)
+}
@@ -0,0 +1,71 @@
+package live2d
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParseMotionGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []string
+		wantErr  bool
+	}{
+		{"cubism3", `{"Version":3,"FileReferences":{"Moc":"a.moc3","Motions":{"TapBody":[{"File":"t.motion3.json"}],"Idle":[{"File":"i.motion3.json"}]}}}`, []string{"Idle", "TapBody"}, false},
+		{"cubism2", `{"model":"a.moc","motions":{"idle":[{"file":"i.mtn"}],"happy":[{"file":"h.mtn"}]}}`, []string{"happy", "idle"}, false},
+		{"no motions", `{"FileReferences":{"Moc":"a.moc3"}}`, []string{}, false},
+		{"invalid", `{`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMotionGroups([]byte(tt.manifest))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("groups = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadModelMotions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&Live2DModel{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	local := Live2DModel{Key: "hiyori", Name: "Hiyori", StorageType: "local", StoragePath: "f", EntryFile: "hiyori.model3.json", Motions: encodeMotionGroups([]string{"Idle", "TapBody"})}
+	external := Live2DModel{Key: "remote", Name: "Remote", StorageType: "external", EntryFile: "https://cdn.example.com/remote.model3.json"}
+	for _, model := range []*Live2DModel{&local, &external} {
+		if err := db.Create(model).Error; err != nil {
+			t.Fatalf("create model: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	want := []string{"Idle", "TapBody"}
+	for _, ref := range []string{buildFileURL(local.ID, local.EntryFile), "hiyori", "1"} {
+		if got := LoadModelMotions(ctx, db, ref); !slices.Equal(got, want) {
+			t.Errorf("LoadModelMotions(%q) = %v, want %v", ref, got, want)
+		}
+	}
+	for _, ref := range []string{external.EntryFile, "missing", "", "/live2d/models/x/files/a"} {
+		if got := LoadModelMotions(ctx, db, ref); got != nil {
+			t.Errorf("LoadModelMotions(%q) = %v, want nil", ref, got)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyPrefix        = "sk-aur-"
+	apiKeyContextUserID = "llm.api_key_user_id"
+	maxAPIKeysPerUser   = 20
+)
+
+var errAPIKeyInvalid = errors.New("llm: invalid api key")
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type apiKeyRecord struct {
+	ID         uint64     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// registerAPIKeyRoutes 注册 API 密钥管理路由。
+func (m *Module) registerAPIKeyRoutes(group *gin.RouterGroup) {
+	group.POST("/api-keys", m.handleCreateAPIKey)
+	group.GET("/api-keys", m.handleListAPIKeys)
+	group.DELETE("/api-keys/:id", m.handleRevokeAPIKey)
+}
+
+// apiKeyOwner 返回 JWT 中的当前用户；密钥只能由本人签发与管理，不接受请求中的 user_id，管理员也不能代签。
+func apiKeyOwner(c *gin.Context) (uint64, bool) {
+	return requestUserID(c, "")
+}
+
+// hashAPIKey 计算 API 密钥的 SHA-256 摘要。
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey 生成新的随机 API 密钥。
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// authenticateAPIKey 校验 API 密钥并返回所属用户。
+func (m *Module) authenticateAPIKey(ctx context.Context, key string) (uint64, error) {
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return 0, errAPIKeyInvalid
+	}
+
+	var record apiKey
+	if err := m.db.WithContext(ctx).
+		Where("key_hash = ? AND revoked_at IS NULL", hashAPIKey(key)).
+		Take(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errAPIKeyInvalid
+		}
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > time.Minute {
+		_ = m.db.WithContext(ctx).Model(&apiKey{}).Where("id = ?", record.ID).Update("last_used_at", now).Error
+	}
+	return record.UserID, nil
+}
+
+// handleCreateAPIKey godoc
+// @Summary 创建 API 密钥
+// @Description 为当前登录用户生成访问 OpenAI 兼容接口的密钥，明文只在创建时返回一次
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param request body createAPIKeyRequest true "密钥信息"
+// @Success 201 {object} map[string]interface{} "新密钥"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未登录"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleCreateAPIKey 创建新的 API 密钥。
+func (m *Module) handleCreateAPIKey(c *gin.Context) {
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	userID, ok := apiKeyOwner(c)
+	if !ok {
+		return
+	}
+	name := truncateString(strings.TrimSpace(req.Name), 100)
+	if name == "" {
+		name = "default"
+	}
+
+	ctx := c.Request.Context()
+	var count int64
+	if err := m.db.WithContext(ctx).Model(&apiKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count api keys", "details": err.Error()})
+		return
+	}
+	if count >= maxAPIKeysPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "api key limit reached"})
+		return
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate api key", "details": err.Error()})
+		return
+	}
+	record := apiKey{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  key[:len(apiKeyPrefix)+6],
+		KeyHash: hashAPIKey(key),
+	}
+	if err := m.db.WithContext(ctx).Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create api key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"api_key": apiKeyRecord{
+		ID:        record.ID,
+		Name:      record.Name,
+		Prefix:    record.Prefix,
+		Key:       key,
+		CreatedAt: record.CreatedAt,
+	}})
+}
+
+// handleListAPIKeys godoc
+// @Summary 查询 API 密钥
+// @Description 返回当前登录用户未吊销的 API 密钥，仅包含前缀
+// @Tags LLM
+// @Produce json
+// @Success 200 {object} map[string]interface{} "密钥列表"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "未登录"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleListAPIKeys 返回用户的 API 密钥列表。
+func (m *Module) handleListAPIKeys(c *gin.Context) {
+	userID, ok := apiKeyOwner(c)
+	if !ok {
+		return
+	}
+
+	var keys []apiKey
+	if err := m.db.WithContext(c.Request.Context()).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("id DESC").
+		Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load api keys", "details": err.Error()})
+		return
+	}
+
+	records := make([]apiKeyRecord, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, apiKeyRecord{
+			ID:         key.ID,
+			Name:       key.Name,
+			Prefix:     key.Prefix,
+			LastUsedAt: key.LastUsedAt,
+			CreatedAt:  key.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": records})
+}
+
+// handleRevokeAPIKey godoc
+// @Summary 吊销 API 密钥
+// @Description 吊销指定的 API 密钥，吊销后立即失效
+// @Tags LLM
+// @Produce json
+// @Param id path int true "密钥ID"
+// @Success 200 {object} map[string]interface{} "操作结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleRevokeAPIKey 吊销 API 密钥。
+func (m *Module) handleRevokeAPIKey(c *gin.Context) {
+	id, err := parsePositiveUint(c.Param("id"), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := apiKeyOwner(c)
+	if !ok {
+		return
+	}
+
+	res := m.db.WithContext(c.Request.Context()).
+		Model(&apiKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now().UTC())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke api key", "details": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "revoked": true})
+}
@@ -0,0 +1,34 @@
+package llm
+
+import (
+	"net/http"
+	"strings"
+
+	"auralis_back/authorization"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestUserID 返回请求所作用的用户：默认取 JWT 中的当前用户；请求显式携带 user_id 时必须与当前用户一致，管理员可代其他用户操作。
+func requestUserID(c *gin.Context, claimed string) (uint64, bool) {
+	userID, roles := authorization.CurrentUser(c)
+	if userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return 0, false
+	}
+
+	claimed = strings.TrimSpace(claimed)
+	if claimed == "" {
+		return userID, true
+	}
+	target, err := parsePositiveUint(claimed, "user_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if target != userID && !authorization.HasRole(roles, authorization.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "cannot access another user's conversations"})
+		return 0, false
+	}
+	return target, true
+}
@@ -17,6 +17,7 @@ type ChatModelOption struct {
 	Capabilities []string `json:"capabilities,omitempty"`
 	Tags         []string `json:"tags,omitempty"`
 	Recommended  bool     `json:"recommended,omitempty"`
+	Premium      bool     `json:"premium,omitempty"`
 }
 
 var defaultChatModelCatalog = []ChatModelOption{
@@ -34,6 +35,7 @@ var defaultChatModelCatalog = []ChatModelOption{
 		DisplayName:  "DeepSeek Terminus v3.1",
 		Description:  "注重复杂推理的旗舰模型，适合深入分析任务。",
 		Capabilities: []string{"chat", "reasoning"},
+		Premium:      true,
 	},
 	{
 		Provider:     "openai",
@@ -41,6 +43,7 @@ var defaultChatModelCatalog = []ChatModelOption{
 		DisplayName:  "Grok-4 Fast",
 		Description:  "实时搜索增强，响应速度快，适合需要快速反馈的场景。",
 		Capabilities: []string{"chat", "search"},
+		Premium:      true,
 	},
 	{
 		Provider:     "openai",
@@ -48,6 +51,7 @@ var defaultChatModelCatalog = []ChatModelOption{
 		DisplayName:  "Qwen 3 Max",
 		Description:  "多语言表现优秀的大模型，擅长长文本理解与创作。",
 		Capabilities: []string{"chat", "multilingual"},
+		Premium:      true,
 	},
 	{
 		Provider:     "openai",
@@ -148,6 +152,7 @@ func normalizeModelCatalog(list []ChatModelOption) []ChatModelOption {
 			Capabilities: normalizeStringSlice(item.Capabilities),
 			Tags:         normalizeStringSlice(item.Tags),
 			Recommended:  item.Recommended,
+			Premium:      item.Premium,
 		}
 		if option.DisplayName == "" {
 			option.DisplayName = name
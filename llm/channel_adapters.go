@@ -0,0 +1,354 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"auralis_back/netguard"
+)
+
+const (
+	channelWeb      = "web"
+	channelWebhook  = "webhook"
+	channelTelegram = "telegram"
+
+	webhookSignatureHeader  = "X-Auralis-Signature"
+	webhookTimestampHeader  = "X-Auralis-Timestamp"
+	webhookMaxClockSkew     = 5 * time.Minute
+	telegramSecretHeader    = "X-Telegram-Bot-Api-Secret-Token"
+	defaultTelegramEndpoint = "https://api.telegram.org"
+)
+
+// errChannelSignature 表示入站请求的签名校验失败。
+var errChannelSignature = errors.New("llm: channel signature mismatch")
+
+// errChannelEndpoint 表示回调地址不是公网 http(s) 地址。
+var errChannelEndpoint = errors.New("llm: channel endpoint must be a public http(s) URL")
+
+// ChannelConfig 描述适配器收发消息所需的绑定配置。
+type ChannelConfig struct {
+	BindingID     uint64
+	AgentID       uint64
+	SigningSecret string
+	BotToken      string
+	Endpoint      string
+}
+
+// InboundMessage 表示从外部平台收到的一条用户消息，EventID 为平台侧的消息标识，用于识别重放与重复投递。
+type InboundMessage struct {
+	EventID        string
+	ExternalUserID string
+	ExternalChatID string
+	DisplayName    string
+	Text           string
+}
+
+// OutboundMessage 表示需要投递到外部平台的一条助手消息。
+type OutboundMessage struct {
+	ExternalUserID string
+	ExternalChatID string
+	MessageID      uint64
+	Text           string
+}
+
+// ChannelAdapter 定义外部消息平台的入站解析与出站投递能力。
+type ChannelAdapter interface {
+	Name() string
+	ParseInbound(r *http.Request, body []byte, cfg ChannelConfig) ([]InboundMessage, error)
+	Send(ctx context.Context, cfg ChannelConfig, msg OutboundMessage) error
+}
+
+// defaultChannelAdapters 返回内置的渠道适配器。
+func defaultChannelAdapters() map[string]ChannelAdapter {
+	client := newChannelHTTPClient(channelAllowPrivate())
+	adapters := map[string]ChannelAdapter{}
+	for _, adapter := range []ChannelAdapter{
+		&webhookAdapter{httpClient: client},
+		&telegramAdapter{httpClient: client},
+	} {
+		adapters[adapter.Name()] = adapter
+	}
+	return adapters
+}
+
+// channelAllowPrivate 判断是否允许渠道回调访问内网与本机地址，仅用于本地联调。
+func channelAllowPrivate() bool {
+	allow, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("LLM_CHANNEL_ALLOW_PRIVATE")))
+	return err == nil && allow
+}
+
+// newChannelHTTPClient 构造出站投递使用的 HTTP 客户端；allowPrivate 为 false 时在连接阶段拒绝内网与本机地址。
+func newChannelHTTPClient(allowPrivate bool) *http.Client {
+	return &http.Client{Timeout: 15 * time.Second, Transport: netguard.NewTransport(allowPrivate, errChannelEndpoint)}
+}
+
+// validateChannelEndpoint 校验回调地址为 http(s) 且主机不解析到本机、内网或链路本地地址。
+func validateChannelEndpoint(ctx context.Context, raw string, allowPrivate bool) error {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return errChannelEndpoint
+	}
+	if allowPrivate {
+		return nil
+	}
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if netguard.IsPrivateIP(ip) {
+			return errChannelEndpoint
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: cannot resolve %s", errChannelEndpoint, host)
+	}
+	for _, addr := range addrs {
+		if netguard.IsPrivateIP(addr.IP) {
+			return errChannelEndpoint
+		}
+	}
+	return nil
+}
+
+// RegisterChannelAdapter 注册或替换指定名称的渠道适配器。
+func (m *Module) RegisterChannelAdapter(adapter ChannelAdapter) {
+	if m == nil || adapter == nil {
+		return
+	}
+	if m.channels == nil {
+		m.channels = map[string]ChannelAdapter{}
+	}
+	m.channels[strings.ToLower(adapter.Name())] = adapter
+}
+
+// signChannelPayload 使用 HMAC-SHA256 对「时间戳.消息体」计算签名。
+func signChannelPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookAdapter 通过带签名的通用 Webhook 收发消息。
+type webhookAdapter struct {
+	httpClient *http.Client
+}
+
+type webhookInboundPayload struct {
+	MessageID   string `json:"message_id"`
+	UserID      string `json:"user_id"`
+	ChatID      string `json:"chat_id"`
+	DisplayName string `json:"display_name"`
+	Text        string `json:"text"`
+}
+
+type webhookOutboundPayload struct {
+	BindingID      uint64 `json:"binding_id"`
+	AgentID        uint64 `json:"agent_id"`
+	ExternalUserID string `json:"user_id"`
+	ChatID         string `json:"chat_id,omitempty"`
+	MessageID      uint64 `json:"message_id"`
+	Text           string `json:"text"`
+}
+
+// Name 返回适配器名称。
+func (a *webhookAdapter) Name() string {
+	return channelWebhook
+}
+
+// ParseInbound 校验时间戳与签名并解析通用 Webhook 请求；时间戳偏差超过 webhookMaxClockSkew 的请求视为重放。
+func (a *webhookAdapter) ParseInbound(r *http.Request, body []byte, cfg ChannelConfig) ([]InboundMessage, error) {
+	timestamp := strings.TrimSpace(r.Header.Get(webhookTimestampHeader))
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing or invalid timestamp", errChannelSignature)
+	}
+	if skew := time.Since(time.Unix(sent, 0)); skew > webhookMaxClockSkew || skew < -webhookMaxClockSkew {
+		return nil, fmt.Errorf("%w: timestamp outside allowed window", errChannelSignature)
+	}
+	expected := signChannelPayload(cfg.SigningSecret, timestamp, body)
+	provided := strings.TrimSpace(r.Header.Get(webhookSignatureHeader))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(provided)) != 1 {
+		return nil, errChannelSignature
+	}
+
+	var payload webhookInboundPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("llm: decode webhook payload: %w", err)
+	}
+	userID := strings.TrimSpace(payload.UserID)
+	text := strings.TrimSpace(payload.Text)
+	if userID == "" || text == "" {
+		return nil, nil
+	}
+	chatID := strings.TrimSpace(payload.ChatID)
+	if chatID == "" {
+		chatID = userID
+	}
+	// 未携带 message_id 时以签名去重：同一时间戳与消息体的重放签名相同。
+	eventID := strings.TrimSpace(payload.MessageID)
+	if eventID == "" {
+		eventID = provided
+	}
+
+	return []InboundMessage{{
+		EventID:        truncateString(eventID, 128),
+		ExternalUserID: userID,
+		ExternalChatID: chatID,
+		DisplayName:    strings.TrimSpace(payload.DisplayName),
+		Text:           text,
+	}}, nil
+}
+
+// Send 将助手消息签名后推送到绑定的回调地址。
+func (a *webhookAdapter) Send(ctx context.Context, cfg ChannelConfig, msg OutboundMessage) error {
+	if cfg.Endpoint == "" {
+		return errors.New("llm: webhook endpoint not configured")
+	}
+	raw, err := json.Marshal(webhookOutboundPayload{
+		BindingID:      cfg.BindingID,
+		AgentID:        cfg.AgentID,
+		ExternalUserID: msg.ExternalUserID,
+		ChatID:         msg.ExternalChatID,
+		MessageID:      msg.MessageID,
+		Text:           msg.Text,
+	})
+	if err != nil {
+		return fmt.Errorf("llm: encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("llm: create webhook request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signChannelPayload(cfg.SigningSecret, timestamp, raw))
+
+	return doChannelRequest(a.httpClient, req)
+}
+
+// telegramAdapter 对接 Telegram 风格的 Bot API。
+type telegramAdapter struct {
+	httpClient *http.Client
+}
+
+type telegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	From      *struct {
+		ID        int64  `json:"id"`
+		Username  string `json:"username"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+	} `json:"from"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+// Name 返回适配器名称。
+func (a *telegramAdapter) Name() string {
+	return channelTelegram
+}
+
+// ParseInbound 校验 Secret Token 并解析 Bot 更新。
+func (a *telegramAdapter) ParseInbound(r *http.Request, body []byte, cfg ChannelConfig) ([]InboundMessage, error) {
+	provided := strings.TrimSpace(r.Header.Get(telegramSecretHeader))
+	if subtle.ConstantTimeCompare([]byte(cfg.SigningSecret), []byte(provided)) != 1 {
+		return nil, errChannelSignature
+	}
+
+	var update telegramUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		return nil, fmt.Errorf("llm: decode telegram update: %w", err)
+	}
+	if update.Message == nil || update.Message.From == nil {
+		return nil, nil
+	}
+	text := strings.TrimSpace(update.Message.Text)
+	if text == "" || strings.HasPrefix(text, "/start") {
+		return nil, nil
+	}
+
+	from := update.Message.From
+	name := strings.TrimSpace(strings.TrimSpace(from.FirstName + " " + from.LastName))
+	if name == "" {
+		name = from.Username
+	}
+
+	return []InboundMessage{{
+		EventID:        strconv.FormatInt(update.UpdateID, 10),
+		ExternalUserID: strconv.FormatInt(from.ID, 10),
+		ExternalChatID: strconv.FormatInt(update.Message.Chat.ID, 10),
+		DisplayName:    name,
+		Text:           text,
+	}}, nil
+}
+
+// Send 调用 sendMessage 接口回复用户。
+func (a *telegramAdapter) Send(ctx context.Context, cfg ChannelConfig, msg OutboundMessage) error {
+	if cfg.BotToken == "" {
+		return errors.New("llm: telegram bot token not configured")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = defaultTelegramEndpoint
+	}
+	endpoint = strings.TrimRight(endpoint, "/") + "/bot" + cfg.BotToken + "/sendMessage"
+
+	chatID := msg.ExternalChatID
+	if chatID == "" {
+		chatID = msg.ExternalUserID
+	}
+	raw, err := json.Marshal(map[string]any{"chat_id": chatID, "text": msg.Text})
+	if err != nil {
+		return fmt.Errorf("llm: encode telegram payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("llm: create telegram request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doChannelRequest(a.httpClient, req)
+}
+
+// doChannelRequest 执行出站请求并检查响应状态。
+func doChannelRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("llm: deliver channel message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("llm: channel responded %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
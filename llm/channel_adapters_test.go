@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookAdapterParseInbound(t *testing.T) {
+	adapter := &webhookAdapter{}
+	cfg := ChannelConfig{SigningSecret: "secret"}
+	body := []byte(`{"message_id":"m-1","user_id":" u1 ","display_name":"Ann","text":" hi "}`)
+	empty := []byte(`{"user_id":"u1","text":" "}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-2*webhookMaxClockSkew).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   error
+		wantCount int
+	}{
+		{"valid", now, signChannelPayload("secret", now, body), body, nil, 1},
+		{"wrong secret", now, signChannelPayload("other", now, body), body, errChannelSignature, 0},
+		{"missing signature", now, "", body, errChannelSignature, 0},
+		{"missing timestamp", "", signChannelPayload("secret", "", body), body, errChannelSignature, 0},
+		{"stale timestamp", stale, signChannelPayload("secret", stale, body), body, errChannelSignature, 0},
+		{"signature bound to timestamp", now, signChannelPayload("secret", stale, body), body, errChannelSignature, 0},
+		{"empty text", now, signChannelPayload("secret", now, empty), empty, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/inbound", nil)
+			req.Header.Set(webhookTimestampHeader, tt.timestamp)
+			req.Header.Set(webhookSignatureHeader, tt.signature)
+			msgs, err := adapter.ParseInbound(req, tt.body, cfg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if len(msgs) != tt.wantCount {
+				t.Fatalf("messages = %d, want %d", len(msgs), tt.wantCount)
+			}
+			if tt.wantCount == 1 {
+				want := InboundMessage{EventID: "m-1", ExternalUserID: "u1", ExternalChatID: "u1", DisplayName: "Ann", Text: "hi"}
+				if msgs[0] != want {
+					t.Errorf("message = %+v, want %+v", msgs[0], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookAdapterSend(t *testing.T) {
+	var got webhookOutboundPayload
+	var signature, timestamp string
+	var raw []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(webhookSignatureHeader)
+		timestamp = r.Header.Get(webhookTimestampHeader)
+		_ = json.Unmarshal(raw, &got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	adapter := &webhookAdapter{httpClient: server.Client()}
+	cfg := ChannelConfig{BindingID: 3, AgentID: 7, SigningSecret: "secret", Endpoint: server.URL}
+	err := adapter.Send(context.Background(), cfg, OutboundMessage{ExternalUserID: "u1", ExternalChatID: "c1", MessageID: 9, Text: "hello"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if timestamp == "" || signature != signChannelPayload("secret", timestamp, raw) {
+		t.Errorf("signature = %q does not match body", signature)
+	}
+	want := webhookOutboundPayload{BindingID: 3, AgentID: 7, ExternalUserID: "u1", ChatID: "c1", MessageID: 9, Text: "hello"}
+	if got != want {
+		t.Errorf("payload = %+v, want %+v", got, want)
+	}
+}
+
+func TestWebhookAdapterSendRejectsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	adapter := &webhookAdapter{httpClient: server.Client()}
+	err := adapter.Send(context.Background(), ChannelConfig{Endpoint: server.URL}, OutboundMessage{Text: "x"})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v, want upstream error with body", err)
+	}
+}
+
+func TestTelegramAdapterRoundTrip(t *testing.T) {
+	adapter := &telegramAdapter{}
+	cfg := ChannelConfig{SigningSecret: "tg-secret", BotToken: "123:abc"}
+
+	update := []byte(`{"update_id":1,"message":{"message_id":5,"from":{"id":42,"first_name":"Li","last_name":"Lei"},"chat":{"id":-100},"text":"hello"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/inbound", nil)
+	req.Header.Set(telegramSecretHeader, "tg-secret")
+	msgs, err := adapter.ParseInbound(req, update, cfg)
+	if err != nil {
+		t.Fatalf("ParseInbound: %v", err)
+	}
+	want := InboundMessage{EventID: "1", ExternalUserID: "42", ExternalChatID: "-100", DisplayName: "Li Lei", Text: "hello"}
+	if len(msgs) != 1 || msgs[0] != want {
+		t.Fatalf("messages = %+v, want %+v", msgs, want)
+	}
+
+	req.Header.Set(telegramSecretHeader, "wrong")
+	if _, err := adapter.ParseInbound(req, update, cfg); !errors.Is(err, errChannelSignature) {
+		t.Fatalf("err = %v, want signature error", err)
+	}
+
+	var path string
+	var payload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	adapter.httpClient = server.Client()
+	cfg.Endpoint = server.URL + "/"
+	if err := adapter.Send(context.Background(), cfg, OutboundMessage{ExternalUserID: "42", ExternalChatID: "-100", Text: "reply"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %q", path)
+	}
+	if payload["chat_id"] != "-100" || payload["text"] != "reply" {
+		t.Errorf("payload = %v", payload)
+	}
+}
+
+func TestValidateChannelEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint     string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{"https://93.184.216.34/hook", false, false},
+		{"ftp://93.184.216.34/hook", false, true},
+		{"not a url", false, true},
+		{"http://127.0.0.1:8080/hook", false, true},
+		{"http://10.0.0.5/hook", false, true},
+		{"http://[::1]/hook", false, true},
+		{"http://169.254.169.254/latest/meta-data", false, true},
+		{"http://localhost/hook", false, true},
+		{"http://127.0.0.1:8080/hook", true, false},
+	}
+	for _, tt := range tests {
+		err := validateChannelEndpoint(context.Background(), tt.endpoint, tt.allowPrivate)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateChannelEndpoint(%q, %v) = %v, wantErr %v", tt.endpoint, tt.allowPrivate, err, tt.wantErr)
+		}
+	}
+}
+
+func TestChannelHTTPClientBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	adapter := &webhookAdapter{httpClient: newChannelHTTPClient(false)}
+	err := adapter.Send(context.Background(), ChannelConfig{Endpoint: server.URL}, OutboundMessage{Text: "x"})
+	if !errors.Is(err, errChannelEndpoint) {
+		t.Fatalf("err = %v, want blocked endpoint", err)
+	}
+
+	adapter.httpClient = newChannelHTTPClient(true)
+	if err := adapter.Send(context.Background(), ChannelConfig{Endpoint: server.URL}, OutboundMessage{Text: "x"}); err != nil {
+		t.Fatalf("allowPrivate Send: %v", err)
+	}
+}
@@ -0,0 +1,642 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auralis_back/authorization"
+	"auralis_back/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxChannelInboundBytes  = 1 << 20
+	channelReplyTimeout     = 2 * time.Minute
+	defaultChannelWorkers   = 4
+	defaultChannelQueueSize = 100
+)
+
+// channelInboundRateLimit 按渠道绑定限制入站回调频率；Identify 返回路径中的绑定 ID 作为计数主体，不依赖 JWT。
+var channelInboundRateLimit = ratelimit.Policy{
+	Name:  "llm-channel-inbound",
+	Key:   ratelimit.KeyUser,
+	Limit: ratelimit.PerWindow(120, time.Minute),
+	Identify: func(c *gin.Context) (uint64, []string) {
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+		return id, nil
+	},
+}
+
+// channelJob 是等待生成回复的一条入站消息。
+type channelJob struct {
+	binding channelBinding
+	adapter ChannelAdapter
+	msg     InboundMessage
+}
+
+// channelWorkerPool 以固定数量的 worker 处理入站消息，队列满时拒绝新消息而不是无限制地创建 goroutine。
+type channelWorkerPool struct {
+	jobs chan channelJob
+}
+
+// newChannelWorkerPoolFromEnv 根据 LLM_CHANNEL_WORKERS 与 LLM_CHANNEL_QUEUE_SIZE 创建并启动 worker。
+func newChannelWorkerPoolFromEnv(m *Module) *channelWorkerPool {
+	workers := readIntEnv("LLM_CHANNEL_WORKERS", defaultChannelWorkers)
+	if workers <= 0 {
+		workers = defaultChannelWorkers
+	}
+	queueSize := readIntEnv("LLM_CHANNEL_QUEUE_SIZE", defaultChannelQueueSize)
+	if queueSize <= 0 {
+		queueSize = defaultChannelQueueSize
+	}
+	pool := &channelWorkerPool{jobs: make(chan channelJob, queueSize)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range pool.jobs {
+				m.processChannelMessage(job.binding, job.adapter, job.msg)
+			}
+		}()
+	}
+	return pool
+}
+
+// submit 将消息放入队列，队列已满或未初始化时返回 false。
+func (p *channelWorkerPool) submit(job channelJob) bool {
+	if p == nil {
+		return false
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+type createChannelBindingRequest struct {
+	AgentID       string `json:"agent_id" binding:"required"`
+	UserID        string `json:"user_id"`
+	Channel       string `json:"channel" binding:"required"`
+	SigningSecret string `json:"signing_secret"`
+	BotToken      string `json:"bot_token"`
+	Endpoint      string `json:"endpoint"`
+}
+
+type channelBindingRecord struct {
+	ID            uint64    `json:"id"`
+	AgentID       uint64    `json:"agent_id"`
+	Channel       string    `json:"channel"`
+	Status        string    `json:"status"`
+	Endpoint      *string   `json:"endpoint,omitempty"`
+	InboundPath   string    `json:"inbound_path"`
+	SigningSecret string    `json:"signing_secret,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// registerChannelRoutes 注册外部渠道绑定与入站回调路由。
+func (m *Module) registerChannelRoutes(public, secured *gin.RouterGroup) {
+	secured.POST("/channels", m.handleCreateChannelBinding)
+	secured.GET("/channels", m.handleListChannelBindings)
+	secured.DELETE("/channels/:id", m.handleDeleteChannelBinding)
+	// 入站回调由外部平台调用，依靠签名而非 JWT 鉴权。
+	public.POST("/channels/:id/inbound", m.limiter.Handler(channelInboundRateLimit), m.handleChannelInbound)
+}
+
+// bindingToRecord 将渠道绑定转换为响应结构，可选择是否返回签名密钥。
+func bindingToRecord(binding channelBinding, includeSecret bool) channelBindingRecord {
+	record := channelBindingRecord{
+		ID:          binding.ID,
+		AgentID:     binding.AgentID,
+		Channel:     binding.Channel,
+		Status:      binding.Status,
+		Endpoint:    binding.Endpoint,
+		InboundPath: fmt.Sprintf("/llm/channels/%d/inbound", binding.ID),
+		CreatedAt:   binding.CreatedAt,
+	}
+	if includeSecret {
+		record.SigningSecret = binding.SigningSecret
+	}
+	return record
+}
+
+// channelConfigFromBinding 构造适配器使用的渠道配置。
+func channelConfigFromBinding(binding channelBinding) ChannelConfig {
+	return ChannelConfig{
+		BindingID:     binding.ID,
+		AgentID:       binding.AgentID,
+		SigningSecret: binding.SigningSecret,
+		BotToken:      stringValue(binding.BotToken),
+		Endpoint:      stringValue(binding.Endpoint),
+	}
+}
+
+// generateChannelSecret 生成随机的渠道签名密钥。
+func generateChannelSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ensureAgentOwner 校验用户是否为智能体的创建者。
+func (m *Module) ensureAgentOwner(ctx context.Context, agentID, userID uint64) (bool, error) {
+	var owner struct {
+		CreatedBy uint64
+	}
+	if err := m.db.WithContext(ctx).Table("agents").Select("created_by").Where("id = ?", agentID).Take(&owner).Error; err != nil {
+		return false, err
+	}
+	return owner.CreatedBy == userID, nil
+}
+
+// handleCreateChannelBinding godoc
+// @Summary 绑定外部消息渠道
+// @Description 为智能体绑定通用 Webhook 或 Telegram 机器人，仅智能体创建者可操作，签名密钥只在创建时返回
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param request body createChannelBindingRequest true "渠道配置"
+// @Success 201 {object} map[string]interface{} "渠道绑定"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleCreateChannelBinding 创建智能体的外部渠道绑定。
+func (m *Module) handleCreateChannelBinding(c *gin.Context) {
+	var req createChannelBindingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	agentID, err := parsePositiveUint(req.AgentID, "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	channel := strings.ToLower(strings.TrimSpace(req.Channel))
+	if _, ok := m.channels[channel]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported channel"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	owner, err := m.ensureAgentOwner(ctx, agentID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load agent", "details": err.Error()})
+		return
+	}
+	if !owner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the agent creator can bind channels"})
+		return
+	}
+
+	binding := channelBinding{
+		AgentID:       agentID,
+		Channel:       channel,
+		OwnerID:       userID,
+		SigningSecret: strings.TrimSpace(req.SigningSecret),
+		BotToken:      normalizeOptionalString(req.BotToken),
+		Endpoint:      normalizeOptionalString(req.Endpoint),
+		Status:        "active",
+	}
+	switch channel {
+	case channelWebhook:
+		if binding.Endpoint == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "endpoint is required for webhook channel"})
+			return
+		}
+	case channelTelegram:
+		if binding.BotToken == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bot_token is required for telegram channel"})
+			return
+		}
+	}
+	if binding.Endpoint != nil {
+		if err := validateChannelEndpoint(ctx, *binding.Endpoint, channelAllowPrivate()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "endpoint must be a public http(s) URL", "details": err.Error()})
+			return
+		}
+	}
+	if binding.SigningSecret == "" {
+		secret, err := generateChannelSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate signing secret", "details": err.Error()})
+			return
+		}
+		binding.SigningSecret = secret
+	}
+
+	if err := m.db.WithContext(ctx).Create(&binding).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create channel binding", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"binding": bindingToRecord(binding, true)})
+}
+
+// handleListChannelBindings godoc
+// @Summary 查询渠道绑定
+// @Description 返回智能体的外部渠道绑定列表，仅智能体创建者可查看
+// @Tags LLM
+// @Produce json
+// @Param agent_id query int true "智能体ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "渠道绑定列表"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleListChannelBindings 返回智能体的渠道绑定。
+func (m *Module) handleListChannelBindings(c *gin.Context) {
+	agentID, err := parsePositiveUint(c.Query("agent_id"), "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if owner, err := m.ensureAgentOwner(ctx, agentID, userID); err != nil || !owner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the agent creator can view channels"})
+		return
+	}
+
+	var bindings []channelBinding
+	if err := m.db.WithContext(ctx).Where("agent_id = ? AND status = ?", agentID, "active").Order("id ASC").Find(&bindings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channel bindings", "details": err.Error()})
+		return
+	}
+
+	records := make([]channelBindingRecord, 0, len(bindings))
+	for _, binding := range bindings {
+		records = append(records, bindingToRecord(binding, false))
+	}
+	c.JSON(http.StatusOK, gin.H{"bindings": records})
+}
+
+// handleDeleteChannelBinding godoc
+// @Summary 解除渠道绑定
+// @Description 停用智能体的外部渠道绑定，停用后入站消息将被拒绝
+// @Tags LLM
+// @Produce json
+// @Param id path int true "绑定ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "操作结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleDeleteChannelBinding 停用渠道绑定。
+func (m *Module) handleDeleteChannelBinding(c *gin.Context) {
+	id, err := parsePositiveUint(c.Param("id"), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	res := m.db.WithContext(c.Request.Context()).
+		Model(&channelBinding{}).
+		Where("id = ? AND owner_id = ? AND status = ?", id, userID, "active").
+		Update("status", "disabled")
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable channel binding", "details": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "channel binding not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "status": "disabled"})
+}
+
+// handleChannelInbound godoc
+// @Summary 接收外部渠道消息
+// @Description 外部平台的回调入口，校验签名与时间戳、按消息标识去重后排队生成回复并经同一渠道回发
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param id path int true "绑定ID"
+// @Success 200 {object} map[string]interface{} "接收结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 401 {object} map[string]string "签名无效"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 429 {object} map[string]string "请求过于频繁"
+// @Failure 503 {object} map[string]string "处理队列已满"
+// @Author bizer
+// handleChannelInbound 处理外部平台推送的消息。
+func (m *Module) handleChannelInbound(c *gin.Context) {
+	id, err := parsePositiveUint(c.Param("id"), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var binding channelBinding
+	if err := m.db.WithContext(c.Request.Context()).Where("id = ? AND status = ?", id, "active").Take(&binding).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "channel binding not found"})
+		return
+	}
+	adapter, ok := m.channels[binding.Channel]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "channel adapter not available"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxChannelInboundBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+
+	inbound, err := adapter.ParseInbound(c.Request, body, channelConfigFromBinding(binding))
+	if err != nil {
+		if errors.Is(err, errChannelSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel payload", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	accepted, duplicates := 0, 0
+	for _, msg := range inbound {
+		fresh, err := m.claimChannelEvent(ctx, binding.ID, msg.EventID)
+		if err != nil {
+			log.Printf("llm: record channel event failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record channel event"})
+			return
+		}
+		if !fresh {
+			duplicates++
+			continue
+		}
+		if !m.channelPool.submit(channelJob{binding: binding, adapter: adapter, msg: msg}) {
+			// 释放事件标识，平台重试时可以再次受理。
+			m.releaseChannelEvent(ctx, binding.ID, msg.EventID)
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "channel queue is full"})
+			return
+		}
+		accepted++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "accepted": accepted, "duplicates": duplicates})
+}
+
+// claimChannelEvent 登记入站事件，事件已受理过时返回 false；未提供事件标识时不去重。
+func (m *Module) claimChannelEvent(ctx context.Context, bindingID uint64, eventID string) (bool, error) {
+	if eventID == "" {
+		return true, nil
+	}
+	res := m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "binding_id"}, {Name: "event_id"}},
+		DoNothing: true,
+	}).Create(&channelInboundEvent{BindingID: bindingID, EventID: eventID})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// releaseChannelEvent 撤销未能入队的事件登记。
+func (m *Module) releaseChannelEvent(ctx context.Context, bindingID uint64, eventID string) {
+	if eventID == "" {
+		return
+	}
+	if err := m.db.WithContext(ctx).Where("binding_id = ? AND event_id = ?", bindingID, eventID).Delete(&channelInboundEvent{}).Error; err != nil {
+		log.Printf("llm: release channel event failed: %v", err)
+	}
+}
+
+// processChannelMessage 将外部消息写入会话，调用回复流程并回发到原渠道，消耗计入渠道绑定者。
+func (m *Module) processChannelMessage(binding channelBinding, adapter ChannelAdapter, in InboundMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), channelReplyTimeout)
+	defer cancel()
+
+	identity, err := m.resolveChannelIdentity(ctx, binding, in)
+	if err != nil {
+		log.Printf("llm: resolve channel identity failed: %v", err)
+		return
+	}
+
+	balance, err := m.getUserTokenBalance(ctx, binding.OwnerID)
+	if err != nil {
+		log.Printf("llm: load channel owner balance failed: %v", err)
+		return
+	}
+	if balance <= 0 {
+		log.Printf("llm: channel binding %d owner %d has insufficient token balance", binding.ID, binding.OwnerID)
+		return
+	}
+
+	conv, userMsg, err := m.appendChannelUserMessage(ctx, binding, identity.UserID, in.Text)
+	if err != nil {
+		log.Printf("llm: store channel message failed: %v", err)
+		return
+	}
+	m.captureReminderRequest(ctx, conv.AgentID, conv.UserID, in.Text)
+
+	record, usage, err := m.generateAssistantReply(ctx, conv, userMsg, speechPreferences{Speed: 1.0, Pitch: 1.0})
+	if usage != nil {
+		if _, applyErr := m.applyUsageToUserTokens(ctx, binding.OwnerID, usage, balance); applyErr != nil {
+			log.Printf("llm: apply channel token usage failed: %v", applyErr)
+		}
+	}
+	m.invalidateRecentMessagesCache(ctx, conv.AgentID, conv.UserID)
+	if err != nil {
+		log.Printf("llm: generate channel reply failed: %v", err)
+		return
+	}
+	if record == nil {
+		return
+	}
+
+	if err := adapter.Send(ctx, channelConfigFromBinding(binding), OutboundMessage{
+		ExternalUserID: identity.ExternalUserID,
+		ExternalChatID: identity.ExternalChatID,
+		MessageID:      record.ID,
+		Text:           record.Content,
+	}); err != nil {
+		log.Printf("llm: send channel reply failed: %v", err)
+	}
+}
+
+// resolveChannelIdentity 查找外部用户对应的 Auralis 用户，不存在时自动创建渠道用户。
+func (m *Module) resolveChannelIdentity(ctx context.Context, binding channelBinding, in InboundMessage) (channelIdentity, error) {
+	var identity channelIdentity
+	err := m.db.WithContext(ctx).
+		Where("binding_id = ? AND external_user_id = ?", binding.ID, in.ExternalUserID).
+		Take(&identity).Error
+	if err == nil {
+		if in.ExternalChatID != "" && in.ExternalChatID != identity.ExternalChatID {
+			identity.ExternalChatID = in.ExternalChatID
+			if err := m.db.WithContext(ctx).Model(&identity).Update("external_chat_id", in.ExternalChatID).Error; err != nil {
+				log.Printf("llm: update channel chat id failed: %v", err)
+			}
+		}
+		return identity, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return identity, err
+	}
+
+	userID, err := m.createChannelUser(ctx, binding, in)
+	if err != nil {
+		return identity, err
+	}
+
+	identity = channelIdentity{
+		BindingID:      binding.ID,
+		ExternalUserID: in.ExternalUserID,
+		ExternalChatID: in.ExternalChatID,
+		DisplayName:    normalizeOptionalString(in.DisplayName),
+		UserID:         userID,
+	}
+	if err := m.db.WithContext(ctx).Create(&identity).Error; err != nil {
+		return identity, err
+	}
+	return identity, nil
+}
+
+// createChannelUser 为外部用户创建不可密码登录、无代币额度的渠道账号。
+func (m *Module) createChannelUser(ctx context.Context, binding channelBinding, in InboundMessage) (uint64, error) {
+	username := truncateString(fmt.Sprintf("%s_%d_%s", binding.Channel, binding.ID, in.ExternalUserID), 64)
+	nickname := strings.TrimSpace(in.DisplayName)
+	if nickname == "" {
+		nickname = username
+	}
+	nickname = truncateString(nickname, 64)
+
+	now := time.Now().UTC()
+	if err := m.db.WithContext(ctx).Table("users").Create(map[string]any{
+		"username":      username,
+		"password_hash": "!",
+		"display_name":  nickname,
+		"nickname":      nickname,
+		"email":         username + "@channel.auralis.local",
+		"status":        authorization.StatusChannel,
+		"token_balance": 0,
+		"created_at":    now,
+		"updated_at":    now,
+	}).Error; err != nil {
+		return 0, err
+	}
+
+	var created struct {
+		ID uint64
+	}
+	if err := m.db.WithContext(ctx).Table("users").Select("id").Where("username = ?", username).Take(&created).Error; err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// appendChannelUserMessage 将渠道用户消息追加到对应会话。
+func (m *Module) appendChannelUserMessage(ctx context.Context, binding channelBinding, userID uint64, content string) (conversation, message, error) {
+	conv, err := m.findOrCreateConversation(ctx, binding.AgentID, userID, binding.Channel)
+	if err != nil {
+		return conv, message{}, err
+	}
+
+	var msg message
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last message
+		seq := 1
+		var parentID *uint64
+		if err := tx.Where("conversation_id = ?", conv.ID).Order("seq DESC").Take(&last).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		} else {
+			seq = last.Seq + 1
+			parent := last.ID
+			parentID = &parent
+		}
+
+		msg = message{
+			ConversationID:  conv.ID,
+			Seq:             seq,
+			Role:            "user",
+			Format:          "text",
+			Content:         content,
+			ParentMessageID: parentID,
+		}
+		if err := tx.Create(&msg).Error; err != nil {
+			return err
+		}
+		return tx.Model(&conversation{}).Where("id = ?", conv.ID).Update("last_msg_at", time.Now().UTC()).Error
+	})
+	return conv, msg, err
+}
+
+// forwardToChannels 将智能体主动发出的消息同步推送到用户绑定的外部渠道。
+func (m *Module) forwardToChannels(ctx context.Context, conv conversation, messageID uint64, text string) {
+	var bindings []channelBinding
+	if err := m.db.WithContext(ctx).Where("agent_id = ? AND status = ?", conv.AgentID, "active").Find(&bindings).Error; err != nil {
+		log.Printf("llm: load channel bindings failed: %v", err)
+		return
+	}
+
+	for _, binding := range bindings {
+		adapter, ok := m.channels[binding.Channel]
+		if !ok {
+			continue
+		}
+		var identities []channelIdentity
+		if err := m.db.WithContext(ctx).Where("binding_id = ? AND user_id = ?", binding.ID, conv.UserID).Find(&identities).Error; err != nil {
+			log.Printf("llm: load channel identities failed: %v", err)
+			continue
+		}
+		for _, identity := range identities {
+			if err := adapter.Send(ctx, channelConfigFromBinding(binding), OutboundMessage{
+				ExternalUserID: identity.ExternalUserID,
+				ExternalChatID: identity.ExternalChatID,
+				MessageID:      messageID,
+				Text:           text,
+			}); err != nil {
+				log.Printf("llm: forward message to %s failed: %v", binding.Channel, err)
+			}
+		}
+	}
+}
+
+// normalizeOptionalString 去除空白并将空字符串转换为 nil。
+func normalizeOptionalString(value string) *string {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newChannelTestModule 创建带一个 webhook 绑定的模块，worker 队列容量为 queueSize 且不启动 worker。
+func newChannelTestModule(t *testing.T, queueSize int) (*Module, *gin.Engine, channelBinding) {
+	t.Helper()
+	db, err := openDatabase("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&channelBinding{}, &channelInboundEvent{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	binding := channelBinding{AgentID: 7, Channel: channelWebhook, OwnerID: 1, SigningSecret: "secret", Status: "active"}
+	mustCreate(t, db, &binding)
+
+	m := &Module{
+		db:          db,
+		channels:    map[string]ChannelAdapter{channelWebhook: &webhookAdapter{}},
+		channelPool: &channelWorkerPool{jobs: make(chan channelJob, queueSize)},
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/channels/:id/inbound", m.handleChannelInbound)
+	return m, router, binding
+}
+
+// postWebhook 以当前时间签名并投递 webhook 消息。
+func postWebhook(router *gin.Engine, binding channelBinding, body string) *httptest.ResponseRecorder {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/channels/"+strconv.FormatUint(binding.ID, 10)+"/inbound", bytes.NewBufferString(body))
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signChannelPayload(binding.SigningSecret, timestamp, []byte(body)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleChannelInboundDedupesEvents(t *testing.T) {
+	m, router, binding := newChannelTestModule(t, 4)
+	body := `{"message_id":"m-1","user_id":"u1","text":"hi"}`
+
+	if rec := postWebhook(router, binding, body); rec.Code != http.StatusOK {
+		t.Fatalf("first delivery status = %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := postWebhook(router, binding, body)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"duplicates":1`)) {
+		t.Fatalf("redelivery = %d %s, want duplicate", rec.Code, rec.Body.String())
+	}
+	if got := len(m.channelPool.jobs); got != 1 {
+		t.Errorf("queued jobs = %d, want 1", got)
+	}
+}
+
+func TestHandleChannelInboundRejectsWhenQueueFull(t *testing.T) {
+	m, router, binding := newChannelTestModule(t, 1)
+
+	if rec := postWebhook(router, binding, `{"message_id":"m-1","user_id":"u1","text":"one"}`); rec.Code != http.StatusOK {
+		t.Fatalf("first delivery status = %d", rec.Code)
+	}
+	body := `{"message_id":"m-2","user_id":"u1","text":"two"}`
+	if rec := postWebhook(router, binding, body); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("full queue status = %d, want 503", rec.Code)
+	}
+
+	// 队列腾出空间后，平台重试同一事件应被受理而不是当作重复。
+	<-m.channelPool.jobs
+	rec := postWebhook(router, binding, body)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"accepted":1`)) {
+		t.Fatalf("retry = %d %s, want accepted", rec.Code, rec.Body.String())
+	}
+}
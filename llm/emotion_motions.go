@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"auralis_back/agents"
+	"auralis_back/live2d"
+	"context"
+	"strings"
+)
+
+// motionCatalog 是智能体 Live2D 模型声明的动作组；nil 表示模型没有元数据，沿用通用动作名。
+type motionCatalog []string
+
+// emotionMotionKeywords 按情绪列出匹配动作组名称的关键词，靠前的优先。
+var emotionMotionKeywords = map[string][]string{
+	"happy":     {"happy", "joy", "smile", "laugh", "glad"},
+	"sad":       {"sad", "cry", "sorrow", "upset"},
+	"angry":     {"angry", "anger", "mad", "annoy"},
+	"surprised": {"surprise", "shock", "amaze"},
+	"confident": {"confident", "proud", "pose"},
+	"gentle":    {"gentle", "wave", "shy", "soft"},
+}
+
+// loadAgentMotions 读取智能体所用 Live2D 模型的动作组。
+func (m *Module) loadAgentMotions(ctx context.Context, agent *agents.Agent) motionCatalog {
+	if agent == nil || agent.Live2DModelID == nil {
+		return nil
+	}
+	return live2d.LoadModelMotions(ctx, m.db, *agent.Live2DModelID)
+}
+
+// resolve 将情绪映射为模型实际存在的动作组：优先同名通用动作，其次按关键词匹配，最后回退到 idle 类动作组。
+func (c motionCatalog) resolve(label string, intensity float64) string {
+	generic := motionForEmotion(label, intensity)
+	if c == nil {
+		return generic
+	}
+	for _, group := range c {
+		if strings.EqualFold(group, generic) {
+			return group
+		}
+	}
+	for _, keyword := range emotionMotionKeywords[label] {
+		for _, group := range c {
+			if strings.Contains(strings.ToLower(group), keyword) {
+				return group
+			}
+		}
+	}
+	for _, group := range c {
+		if strings.Contains(strings.ToLower(group), "idle") {
+			return group
+		}
+	}
+	return ""
+}
+
+// annotate 按模型动作组改写整体情绪的建议动作。
+func (c motionCatalog) annotate(meta *emotionMetadata) *emotionMetadata {
+	if meta != nil {
+		meta.SuggestedMotion = c.resolve(meta.Label, meta.Intensity)
+	}
+	return meta
+}
@@ -0,0 +1,55 @@
+package llm
+
+import "testing"
+
+func TestMotionCatalogResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		catalog   motionCatalog
+		label     string
+		intensity float64
+		want      string
+	}{
+		{"no metadata uses generic name", nil, "happy", 0.8, "happy_jump"},
+		{"generic name present", motionCatalog{"Idle", "happy_smile"}, "happy", 0.3, "happy_smile"},
+		{"keyword match", motionCatalog{"Idle", "Smile", "TapBody"}, "happy", 0.8, "Smile"},
+		{"falls back to idle", motionCatalog{"Idle", "TapBody"}, "angry", 0.9, "Idle"},
+		{"model without motions", motionCatalog{}, "sad", 0.5, ""},
+		{"no match and no idle", motionCatalog{"TapBody"}, "neutral", 0.1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.catalog.resolve(tt.label, tt.intensity); got != tt.want {
+				t.Errorf("resolve(%q, %v) = %q, want %q", tt.label, tt.intensity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEmotionLabels(t *testing.T) {
+	timeline := buildEmotionTimeline("Hello there. See you soon.", "", 1.0, motionCatalog{"Idle", "Sad"})
+	if timeline == nil || len(timeline.Cues) != 2 {
+		t.Fatalf("timeline = %+v, want two cues", timeline)
+	}
+	startMs := timeline.Cues[1].StartMs
+
+	intensity := 0.7
+	labels := []emotionLLMLabel{
+		{Index: 1, Label: "sad", Intensity: &intensity},
+		{Index: 5, Label: "happy"},
+		{Index: 0, Label: "bored"},
+	}
+	if !applyEmotionLabels(timeline, labels, motionCatalog{"Idle", "Sad"}) {
+		t.Fatal("applyEmotionLabels reported no change")
+	}
+	cue := timeline.Cues[1]
+	if cue.Label != "sad" || cue.Motion != "Sad" || cue.Source != emotionAnalyzerLLM || cue.Intensity != 0.7 {
+		t.Errorf("cue = %+v, want sad/Sad from llm", cue)
+	}
+	if cue.StartMs != startMs {
+		t.Errorf("start_ms = %d, want timing preserved at %d", cue.StartMs, startMs)
+	}
+	if timeline.Cues[0].Source != emotionAnalyzerKeyword || timeline.Analyzer != emotionAnalyzerLLM {
+		t.Errorf("timeline = %+v, want first cue untouched and analyzer llm", timeline)
+	}
+}
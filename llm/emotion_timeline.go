@@ -0,0 +1,513 @@
+package llm
+
+import (
+	"auralis_back/tts"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	emotionAnalyzerKeyword = "keyword"
+	emotionAnalyzerLLM     = "llm"
+
+	emotionTimingEstimated = "estimated"
+	emotionTimingAudio     = "audio"
+
+	defaultEmotionAnalyzerTimeout = 8 * time.Second
+)
+
+// emotionCue 描述单句的情绪与动作提示。
+type emotionCue struct {
+	Index      int     `json:"index"`
+	Text       string  `json:"text"`
+	Start      int     `json:"start"`
+	End        int     `json:"end"`
+	Label      string  `json:"label"`
+	Intensity  float64 `json:"intensity"`
+	Confidence float64 `json:"confidence"`
+	Motion     string  `json:"motion"`
+	Source     string  `json:"source"`
+	StartMs    int     `json:"start_ms"`
+	EndMs      int     `json:"end_ms"`
+}
+
+// emotionTimeline 聚合一条回复的逐句情绪时间轴。
+type emotionTimeline struct {
+	Analyzer   string       `json:"analyzer"`
+	Timing     string       `json:"timing"`
+	DurationMs int          `json:"duration_ms,omitempty"`
+	Cues       []emotionCue `json:"cues"`
+}
+
+// sentenceSpan 表示文本中的一个句子及其字符区间。
+type sentenceSpan struct {
+	Text     string
+	Start    int
+	End      int
+	Complete bool
+}
+
+// emotionAnalyzerMode 返回情绪分析方式，支持 keyword 与 llm。
+func emotionAnalyzerMode() string {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("LLM_EMOTION_ANALYZER")))
+	if mode == emotionAnalyzerLLM {
+		return emotionAnalyzerLLM
+	}
+	return emotionAnalyzerKeyword
+}
+
+// isSentenceTerminator 判断字符是否为句末标点。
+func isSentenceTerminator(r rune) bool {
+	switch r {
+	case '。', '！', '？', '!', '?', '；', ';', '…', '\n':
+		return true
+	}
+	return false
+}
+
+// isSentenceCloser 判断字符是否为句末可附带的引号或括号。
+func isSentenceCloser(r rune) bool {
+	switch r {
+	case '"', '\'', '”', '’', ')', '）', '】', '」', '』', '~', '～':
+		return true
+	}
+	return false
+}
+
+// splitSentences 按标点将文本切分为句子，偏移量以 rune 计。
+func splitSentences(text string) []sentenceSpan {
+	runes := []rune(text)
+	spans := make([]sentenceSpan, 0, 8)
+	start := 0
+
+	emit := func(from, to int, complete bool) {
+		for from < to && unicode.IsSpace(runes[from]) {
+			from++
+		}
+		end := to
+		for end > from && unicode.IsSpace(runes[end-1]) {
+			end--
+		}
+		if end <= from {
+			return
+		}
+		spans = append(spans, sentenceSpan{
+			Text:     string(runes[from:end]),
+			Start:    from,
+			End:      end,
+			Complete: complete,
+		})
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		terminal := isSentenceTerminator(r)
+		if r == '.' {
+			// 英文句号仅在其后为空白时视为句末，避免切断小数与缩写。
+			terminal = i+1 < len(runes) && unicode.IsSpace(runes[i+1])
+		}
+		if !terminal {
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && ((isSentenceTerminator(runes[j]) && runes[j] != '\n') || runes[j] == '.' || isSentenceCloser(runes[j])) {
+			j++
+		}
+		emit(start, j, true)
+		start = j
+		i = j - 1
+	}
+	if start < len(runes) {
+		emit(start, len(runes), false)
+	}
+	return spans
+}
+
+// estimateSpeechMs 粗略估算一句话在给定语速下的朗读时长。
+func estimateSpeechMs(text string, speed float64) int {
+	if speed <= 0 {
+		speed = 1.0
+	}
+	var units float64
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			units += 230
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			units += 65
+		case unicode.IsPunct(r):
+			units += 120
+		case unicode.IsSpace(r):
+			units += 40
+		}
+	}
+	return int(math.Round(units / speed))
+}
+
+// newEmotionCue 基于关键词分析生成单句情绪提示，动作按模型动作组解析。
+func newEmotionCue(index int, span sentenceSpan, hint string, motions motionCatalog) emotionCue {
+	cue := emotionCue{
+		Index:  index,
+		Text:   span.Text,
+		Start:  span.Start,
+		End:    span.End,
+		Label:  "neutral",
+		Source: emotionAnalyzerKeyword,
+	}
+	if meta := inferEmotion(span.Text, hint); meta != nil {
+		cue.Label = meta.Label
+		cue.Intensity = meta.Intensity
+		cue.Confidence = meta.Confidence
+	}
+	cue.Motion = motions.resolve(cue.Label, cue.Intensity)
+	return cue
+}
+
+// emotionTimelineBuilder 在流式生成过程中增量产出情绪提示。
+type emotionTimelineBuilder struct {
+	hint     string
+	speed    float64
+	motions  motionCatalog
+	consumed int
+	cursorMs int
+	cues     []emotionCue
+}
+
+// newEmotionTimelineBuilder 创建增量情绪时间轴构建器。
+func newEmotionTimelineBuilder(hint string, speed float64, motions motionCatalog) *emotionTimelineBuilder {
+	return &emotionTimelineBuilder{hint: strings.TrimSpace(hint), speed: speed, motions: motions}
+}
+
+// advance 消费最新的完整文本并返回新完成句子的情绪提示。
+func (b *emotionTimelineBuilder) advance(full string, final bool) []emotionCue {
+	if b == nil {
+		return nil
+	}
+	runes := []rune(full)
+	if b.consumed >= len(runes) {
+		return nil
+	}
+	spans := splitSentences(string(runes[b.consumed:]))
+	produced := make([]emotionCue, 0, len(spans))
+	for _, span := range spans {
+		if !span.Complete && !final {
+			break
+		}
+		span.Start += b.consumed
+		span.End += b.consumed
+		cue := newEmotionCue(len(b.cues), span, b.hint, b.motions)
+		duration := estimateSpeechMs(cue.Text, b.speed)
+		cue.StartMs = b.cursorMs
+		cue.EndMs = b.cursorMs + duration
+		b.cursorMs = cue.EndMs
+		b.cues = append(b.cues, cue)
+		produced = append(produced, cue)
+	}
+	if len(produced) > 0 {
+		last := produced[len(produced)-1]
+		b.consumed = last.End
+		if final {
+			b.consumed = len(runes)
+		}
+	}
+	return produced
+}
+
+// timeline 返回当前已生成的情绪时间轴。
+func (b *emotionTimelineBuilder) timeline() *emotionTimeline {
+	if b == nil || len(b.cues) == 0 {
+		return nil
+	}
+	cues := make([]emotionCue, len(b.cues))
+	copy(cues, b.cues)
+	return &emotionTimeline{
+		Analyzer:   emotionAnalyzerKeyword,
+		Timing:     emotionTimingEstimated,
+		DurationMs: b.cursorMs,
+		Cues:       cues,
+	}
+}
+
+// buildEmotionTimeline 对完整回复逐句分析生成情绪时间轴。
+func buildEmotionTimeline(text, hint string, speed float64, motions motionCatalog) *emotionTimeline {
+	builder := newEmotionTimelineBuilder(hint, speed, motions)
+	builder.advance(text, true)
+	return builder.timeline()
+}
+
+// alignEmotionTimeline 将时间轴按音频总时长等比对齐。
+func alignEmotionTimeline(timeline *emotionTimeline, durationMs int, speed float64) {
+	if timeline == nil || len(timeline.Cues) == 0 {
+		return
+	}
+	weights := make([]int, len(timeline.Cues))
+	total := 0
+	for i, cue := range timeline.Cues {
+		weights[i] = estimateSpeechMs(cue.Text, speed)
+		if weights[i] <= 0 {
+			weights[i] = 1
+		}
+		total += weights[i]
+	}
+	if durationMs <= 0 {
+		durationMs = total
+		timeline.Timing = emotionTimingEstimated
+	} else {
+		timeline.Timing = emotionTimingAudio
+	}
+	cursor := 0
+	accumulated := 0
+	for i := range timeline.Cues {
+		accumulated += weights[i]
+		end := int(int64(durationMs) * int64(accumulated) / int64(total))
+		timeline.Cues[i].StartMs = cursor
+		timeline.Cues[i].EndMs = end
+		cursor = end
+	}
+	timeline.DurationMs = durationMs
+}
+
+// timelineFromExtras 从消息扩展字段中解析情绪时间轴。
+func timelineFromExtras(extras map[string]any) *emotionTimeline {
+	raw, ok := extras["emotion_timeline"]
+	if !ok || raw == nil {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var timeline emotionTimeline
+	if err := json.Unmarshal(data, &timeline); err != nil || len(timeline.Cues) == 0 {
+		return nil
+	}
+	return &timeline
+}
+
+// isKnownEmotionLabel 判断标签是否属于 Live2D 动作映射支持的情绪。
+func isKnownEmotionLabel(label string) bool {
+	switch label {
+	case "neutral", "happy", "sad", "angry", "surprised", "gentle", "confident":
+		return true
+	}
+	return false
+}
+
+// emotionLLMLabel 是大模型情绪旁路返回的单句结果。
+type emotionLLMLabel struct {
+	Index      int      `json:"index"`
+	Label      string   `json:"label"`
+	Intensity  *float64 `json:"intensity"`
+	Confidence *float64 `json:"confidence"`
+}
+
+const emotionAnalyzerPrompt = `You annotate the emotional delivery of a virtual companion's reply for Live2D animation.
+For every numbered sentence, choose one label from: neutral, happy, sad, angry, surprised, gentle, confident.
+Respond with JSON only: an array of objects {"index": number, "label": string, "intensity": number between 0 and 1, "confidence": number between 0 and 1}.`
+
+// emotionLLMEnabled 判断是否需要调用大模型对时间轴进行标注。
+func (m *Module) emotionLLMEnabled(timeline *emotionTimeline) bool {
+	return timeline != nil && len(timeline.Cues) > 0 && m.client != nil && emotionAnalyzerMode() == emotionAnalyzerLLM
+}
+
+// emotionAnalyzerInput 将时间轴的句子编号拼接为分析请求。
+func emotionAnalyzerInput(timeline *emotionTimeline) string {
+	var builder strings.Builder
+	for _, cue := range timeline.Cues {
+		builder.WriteString(fmt.Sprintf("%d. %s\n", cue.Index, cue.Text))
+	}
+	return builder.String()
+}
+
+// analyzeEmotionLabels 调用大模型对编号句子进行情绪标注，失败时返回 nil。
+func (m *Module) analyzeEmotionLabels(ctx context.Context, input, model string) []emotionLLMLabel {
+	timeout := time.Duration(readIntEnv("LLM_EMOTION_ANALYZER_TIMEOUT_MS", int(defaultEmotionAnalyzerTimeout/time.Millisecond))) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultEmotionAnalyzerTimeout
+	}
+	analyzeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	analyzerModel := strings.TrimSpace(os.Getenv("LLM_EMOTION_ANALYZER_MODEL"))
+	if analyzerModel == "" {
+		analyzerModel = model
+	}
+
+	result, err := m.client.Chat(analyzeCtx, []ChatMessage{
+		{Role: "system", Content: emotionAnalyzerPrompt},
+		{Role: "user", Content: input},
+	}, analyzerModel)
+	if err != nil {
+		log.Printf("llm: emotion analyzer request failed: %v", err)
+		return nil
+	}
+
+	labels, err := parseEmotionLLMLabels(result.Content)
+	if err != nil {
+		log.Printf("llm: emotion analyzer parse failed: %v", err)
+		return nil
+	}
+	return labels
+}
+
+// applyEmotionLabels 将大模型标注写入时间轴，保留已有的时间对齐。
+func applyEmotionLabels(timeline *emotionTimeline, labels []emotionLLMLabel, motions motionCatalog) bool {
+	if timeline == nil {
+		return false
+	}
+	applied := false
+	for _, item := range labels {
+		if item.Index < 0 || item.Index >= len(timeline.Cues) {
+			continue
+		}
+		label := normalizeEmotionLabel(item.Label)
+		if !isKnownEmotionLabel(label) {
+			continue
+		}
+		cue := &timeline.Cues[item.Index]
+		cue.Label = label
+		if item.Intensity != nil {
+			cue.Intensity = clampFloat(*item.Intensity, 0.1, 1.0)
+		}
+		if item.Confidence != nil {
+			cue.Confidence = clampFloat(*item.Confidence, 0.1, 1.0)
+		}
+		cue.Motion = motions.resolve(cue.Label, cue.Intensity)
+		cue.Source = emotionAnalyzerLLM
+		applied = true
+	}
+	if applied {
+		timeline.Analyzer = emotionAnalyzerLLM
+	}
+	return applied
+}
+
+// refineEmotionTimeline 在启用时同步调用大模型对逐句情绪进行结构化标注，供无需即时响应的后台任务使用。
+func (m *Module) refineEmotionTimeline(ctx context.Context, timeline *emotionTimeline, model string, motions motionCatalog) bool {
+	if !m.emotionLLMEnabled(timeline) {
+		return false
+	}
+	return applyEmotionLabels(timeline, m.analyzeEmotionLabels(ctx, emotionAnalyzerInput(timeline), model), motions)
+}
+
+// emotionRefinement 表示后台进行中的大模型情绪标注。
+type emotionRefinement struct {
+	done   chan struct{}
+	labels []emotionLLMLabel
+}
+
+// startEmotionRefinement 在启用大模型分析时于后台标注时间轴，不阻塞回复的发送；未启用时返回 nil。
+func (m *Module) startEmotionRefinement(timeline *emotionTimeline, model string) *emotionRefinement {
+	if !m.emotionLLMEnabled(timeline) {
+		return nil
+	}
+	input := emotionAnalyzerInput(timeline)
+	refinement := &emotionRefinement{done: make(chan struct{})}
+	go func() {
+		defer close(refinement.done)
+		refinement.labels = m.analyzeEmotionLabels(context.Background(), input, model)
+	}()
+	return refinement
+}
+
+// wait 等待标注完成，ctx 提前结束时返回 nil。
+func (r *emotionRefinement) wait(ctx context.Context) []emotionLLMLabel {
+	if r == nil {
+		return nil
+	}
+	select {
+	case <-r.done:
+		return r.labels
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// storeEmotionLabels 将标注合并到消息扩展字段中已保存的时间轴并返回更新后的时间轴，未生效时返回 nil。
+func (m *Module) storeEmotionLabels(target any, msgID uint64, labels []emotionLLMLabel, motions motionCatalog) *emotionTimeline {
+	if len(labels) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 与语音合成回写串行，避免并发读改写互相覆盖扩展字段。
+	m.extrasMu.Lock()
+	defer m.extrasMu.Unlock()
+
+	var row struct {
+		Extras datatypes.JSON
+	}
+	if err := m.db.WithContext(ctx).Model(target).Select("extras").Where("id = ?", msgID).Take(&row).Error; err != nil {
+		log.Printf("llm: load message %d for emotion labels failed: %v", msgID, err)
+		return nil
+	}
+	extras := map[string]any{}
+	if len(row.Extras) > 0 {
+		if err := json.Unmarshal(row.Extras, &extras); err != nil {
+			log.Printf("llm: parse message %d extras failed: %v", msgID, err)
+			return nil
+		}
+	}
+	timeline := timelineFromExtras(extras)
+	if !applyEmotionLabels(timeline, labels, motions) {
+		return nil
+	}
+	merged, err := mergeExtras(row.Extras, map[string]any{"emotion_timeline": timeline})
+	if err != nil {
+		log.Printf("llm: merge emotion labels for message %d failed: %v", msgID, err)
+		return nil
+	}
+	if err := m.db.WithContext(ctx).Model(target).Where("id = ?", msgID).Update("extras", merged).Error; err != nil {
+		log.Printf("llm: store emotion labels for message %d failed: %v", msgID, err)
+		return nil
+	}
+	return timeline
+}
+
+// storeEmotionRefinementAsync 在后台等待标注完成并写回消息，供无法推送事件的接口使用。
+func (m *Module) storeEmotionRefinementAsync(target any, msgID uint64, refinement *emotionRefinement, motions motionCatalog) {
+	if refinement == nil {
+		return
+	}
+	go func() {
+		m.storeEmotionLabels(target, msgID, refinement.wait(context.Background()), motions)
+	}()
+}
+
+// parseEmotionLLMLabels 从模型输出中提取 JSON 数组。
+func parseEmotionLLMLabels(content string) ([]emotionLLMLabel, error) {
+	trimmed := strings.TrimSpace(content)
+	start := strings.Index(trimmed, "[")
+	end := strings.LastIndex(trimmed, "]")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("llm: emotion analyzer returned no json array")
+	}
+	var labels []emotionLLMLabel
+	if err := json.Unmarshal([]byte(trimmed[start:end+1]), &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// speechResultDurationMs 根据合成结果的音频数据估算时长。
+func speechResultDurationMs(result *tts.SpeechResult) int {
+	if result == nil || result.AudioBase64 == "" {
+		return 0
+	}
+	audio, err := base64.StdEncoding.DecodeString(result.AudioBase64)
+	if err != nil {
+		return 0
+	}
+	return tts.EstimateDurationMs(audio, result.MimeType, 0)
+}
@@ -0,0 +1,603 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxFeedbackTags          = 8
+	maxFeedbackCommentLength = 1000
+	maxPreferenceExportRows  = 5000
+)
+
+var (
+	// feedbackEmailPattern 与 feedbackNumberPattern 用于在导出偏好数据前替换邮箱与电话、证件等长号码。
+	feedbackEmailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	feedbackNumberPattern = regexp.MustCompile(`\+?\d[\d \-]{6,}\d`)
+)
+
+// feedbackTags 列出允许使用的评价原因标签。
+var feedbackTags = map[string]struct{}{
+	"helpful":       {},
+	"in_character":  {},
+	"inaccurate":    {},
+	"unhelpful":     {},
+	"off_character": {},
+	"too_long":      {},
+	"too_short":     {},
+	"unsafe":        {},
+	"bad_voice":     {},
+	"other":         {},
+}
+
+type messageFeedbackRequest struct {
+	UserID        string   `json:"user_id"`
+	Rating        string   `json:"rating" binding:"required"`
+	Tags          []string `json:"tags"`
+	Comment       *string  `json:"comment"`
+	ShareTraining bool     `json:"share_training"`
+}
+
+type messageFeedbackRecord struct {
+	MessageID     uint64    `json:"message_id"`
+	UserID        uint64    `json:"user_id"`
+	AgentID       uint64    `json:"agent_id"`
+	Rating        string    `json:"rating"`
+	Tags          []string  `json:"tags"`
+	Comment       *string   `json:"comment,omitempty"`
+	ModelName     string    `json:"model_name"`
+	PromptVersion int       `json:"prompt_version"`
+	ShareTraining bool      `json:"share_training"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type feedbackSummaryRow struct {
+	ModelName     string         `json:"model_name"`
+	PromptVersion int            `json:"prompt_version"`
+	Up            int64          `json:"up"`
+	Down          int64          `json:"down"`
+	Total         int64          `json:"total"`
+	Approval      float64        `json:"approval"`
+	Tags          map[string]int `json:"tags"`
+}
+
+type preferencePair struct {
+	AgentID           uint64   `json:"agent_id"`
+	Prompt            string   `json:"prompt"`
+	Chosen            string   `json:"chosen"`
+	Rejected          string   `json:"rejected"`
+	ChosenMessageID   uint64   `json:"chosen_message_id"`
+	RejectedMessageID uint64   `json:"rejected_message_id"`
+	ChosenModel       string   `json:"chosen_model"`
+	RejectedModel     string   `json:"rejected_model"`
+	PromptVersion     int      `json:"prompt_version"`
+	RejectedTags      []string `json:"rejected_tags,omitempty"`
+}
+
+// registerFeedbackRoutes 注册消息评价相关路由。
+func (m *Module) registerFeedbackRoutes(group *gin.RouterGroup) {
+	group.PUT("/messages/:id/feedback", m.handleUpsertMessageFeedback)
+	group.DELETE("/messages/:id/feedback", m.handleDeleteMessageFeedback)
+	group.GET("/feedback/summary", m.handleFeedbackSummary)
+	group.GET("/feedback/export", m.handleFeedbackExport)
+}
+
+// generationExtras 记录生成回复时使用的模型与提示词版本，用于后续评价聚合。
+func (m *Module) generationExtras(ctxData *conversationContext) map[string]any {
+	model := ctxData.modelName()
+	if model == "" && m.client != nil {
+		model = m.client.defaultModel
+	}
+	version := 0
+	if ctxData != nil {
+		version = ctxData.agent.Version
+	}
+	return map[string]any{"model": model, "prompt_version": version}
+}
+
+// generationFromExtras 从消息扩展字段中读取模型与提示词版本。
+func generationFromExtras(raw datatypes.JSON) (string, int, bool) {
+	if len(raw) == 0 {
+		return "", 0, false
+	}
+	var extras struct {
+		Generation *struct {
+			Model         string `json:"model"`
+			PromptVersion int    `json:"prompt_version"`
+		} `json:"generation"`
+	}
+	if err := json.Unmarshal(raw, &extras); err != nil || extras.Generation == nil {
+		return "", 0, false
+	}
+	return extras.Generation.Model, extras.Generation.PromptVersion, true
+}
+
+// parseFeedbackRating 将 up/down 等取值转换为 1 或 -1。
+func parseFeedbackRating(value string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "up", "like", "1", "+1", "positive":
+		return 1, true
+	case "down", "dislike", "-1", "negative":
+		return -1, true
+	}
+	return 0, false
+}
+
+// ratingLabel 将评分转换为 up/down 标签。
+func ratingLabel(rating int) string {
+	if rating > 0 {
+		return "up"
+	}
+	return "down"
+}
+
+// normalizeFeedbackTags 校验并去重评价标签。
+func normalizeFeedbackTags(tags []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		value := strings.ToLower(strings.TrimSpace(tag))
+		if value == "" {
+			continue
+		}
+		if _, ok := feedbackTags[value]; !ok {
+			return nil, fmt.Errorf("unsupported feedback tag %q", value)
+		}
+		if _, dup := seen[value]; dup {
+			continue
+		}
+		seen[value] = struct{}{}
+		result = append(result, value)
+	}
+	if len(result) > maxFeedbackTags {
+		return nil, errors.New("too many feedback tags")
+	}
+	return result, nil
+}
+
+// decodeFeedbackTags 解析存储的标签数组。
+func decodeFeedbackTags(raw datatypes.JSON) []string {
+	tags := []string{}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &tags)
+	}
+	return tags
+}
+
+// feedbackToRecord 将评价模型转换为响应结构。
+func feedbackToRecord(item messageFeedback) messageFeedbackRecord {
+	return messageFeedbackRecord{
+		MessageID:     item.MessageID,
+		UserID:        item.UserID,
+		AgentID:       item.AgentID,
+		Rating:        ratingLabel(item.Rating),
+		Tags:          decodeFeedbackTags(item.Tags),
+		Comment:       item.Comment,
+		ModelName:     item.ModelName,
+		PromptVersion: item.PromptVersion,
+		ShareTraining: item.ShareTraining,
+		UpdatedAt:     item.UpdatedAt,
+	}
+}
+
+// loadFeedbackTarget 加载被评价的助手消息及其会话，并校验归属。
+func (m *Module) loadFeedbackTarget(ctx context.Context, messageID, userID uint64) (message, conversation, error) {
+	var msg message
+	var conv conversation
+	if err := m.db.WithContext(ctx).First(&msg, "id = ?", messageID).Error; err != nil {
+		return msg, conv, err
+	}
+	if err := m.db.WithContext(ctx).First(&conv, "id = ?", msg.ConversationID).Error; err != nil {
+		return msg, conv, err
+	}
+	if conv.UserID != userID || msg.Role != "assistant" {
+		return msg, conv, gorm.ErrRecordNotFound
+	}
+	return msg, conv, nil
+}
+
+// handleUpsertMessageFeedback godoc
+// @Summary 评价助手消息
+// @Description 对单条助手消息点赞或点踩，可附带原因标签与文字说明，重复提交会覆盖之前的评价；share_training 为 true 时表示同意智能体创建者将该轮问答用于偏好数据导出
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param id path int true "消息ID"
+// @Param request body messageFeedbackRequest true "评价内容"
+// @Success 200 {object} map[string]interface{} "评价结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleUpsertMessageFeedback 创建或更新消息评价。
+func (m *Module) handleUpsertMessageFeedback(c *gin.Context) {
+	messageID, err := parsePositiveUint(c.Param("id"), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req messageFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+	rating, ok := parseFeedbackRating(req.Rating)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rating must be up or down"})
+		return
+	}
+	tags, err := normalizeFeedbackTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	comment := req.Comment
+	if comment != nil {
+		trimmed := strings.TrimSpace(*comment)
+		if len([]rune(trimmed)) > maxFeedbackCommentLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "comment is too long"})
+			return
+		}
+		if trimmed == "" {
+			comment = nil
+		} else {
+			comment = &trimmed
+		}
+	}
+
+	ctx := c.Request.Context()
+	msg, conv, err := m.loadFeedbackTarget(ctx, messageID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "assistant message not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load message", "details": err.Error()})
+		return
+	}
+
+	modelName, promptVersion, found := generationFromExtras(msg.Extras)
+	if !found {
+		var agent struct {
+			Version int
+		}
+		if err := m.db.WithContext(ctx).Table("agents").Select("version").Where("id = ?", conv.AgentID).Take(&agent).Error; err == nil {
+			promptVersion = agent.Version
+		}
+	}
+
+	rawTags, _ := json.Marshal(tags)
+	item := messageFeedback{
+		MessageID:      msg.ID,
+		UserID:         userID,
+		ConversationID: conv.ID,
+		AgentID:        conv.AgentID,
+		ModelName:      modelName,
+		PromptVersion:  promptVersion,
+		Rating:         rating,
+		Tags:           datatypes.JSON(rawTags),
+		Comment:        comment,
+		ShareTraining:  req.ShareTraining,
+	}
+	if err := m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rating", "tags", "comment", "share_training", "updated_at"}),
+	}).Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save feedback", "details": err.Error()})
+		return
+	}
+	if err := m.db.WithContext(ctx).Where("message_id = ? AND user_id = ?", msg.ID, userID).Take(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load feedback", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feedback": feedbackToRecord(item)})
+}
+
+// handleDeleteMessageFeedback godoc
+// @Summary 撤销消息评价
+// @Description 删除用户对指定助手消息的评价
+// @Tags LLM
+// @Produce json
+// @Param id path int true "消息ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "操作结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleDeleteMessageFeedback 删除消息评价。
+func (m *Module) handleDeleteMessageFeedback(c *gin.Context) {
+	messageID, err := parsePositiveUint(c.Param("id"), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	res := m.db.WithContext(c.Request.Context()).
+		Where("message_id = ? AND user_id = ?", messageID, userID).
+		Delete(&messageFeedback{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete feedback", "details": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "feedback not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message_id": messageID, "deleted": true})
+}
+
+// authorizeFeedbackOwner 解析查询参数并校验请求者为智能体创建者。
+func (m *Module) authorizeFeedbackOwner(c *gin.Context) (uint64, bool) {
+	agentID, err := parsePositiveUint(c.Query("agent_id"), "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return 0, false
+	}
+
+	owner, err := m.ensureAgentOwner(c.Request.Context(), agentID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+			return 0, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load agent", "details": err.Error()})
+		return 0, false
+	}
+	if !owner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the agent creator can view feedback"})
+		return 0, false
+	}
+	return agentID, true
+}
+
+// handleFeedbackSummary godoc
+// @Summary 消息评价统计
+// @Description 按模型与提示词版本聚合智能体收到的点赞、点踩与原因标签，仅智能体创建者可查看
+// @Tags LLM
+// @Produce json
+// @Param agent_id query int true "智能体ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "评价统计"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleFeedbackSummary 返回智能体的消息评价统计。
+func (m *Module) handleFeedbackSummary(c *gin.Context) {
+	agentID, ok := m.authorizeFeedbackOwner(c)
+	if !ok {
+		return
+	}
+
+	rows, overall, err := m.summarizeFeedback(c.Request.Context(), agentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load feedback", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id": agentID,
+		"overall":  overall,
+		"groups":   rows,
+	})
+}
+
+// summarizeFeedback 在数据库中按模型、提示词版本、评分与标签组合分组计数，再展开为各分组与整体的统计。
+func (m *Module) summarizeFeedback(ctx context.Context, agentID uint64) ([]feedbackSummaryRow, feedbackSummaryRow, error) {
+	var counts []struct {
+		ModelName     string
+		PromptVersion int
+		Rating        int
+		Tags          datatypes.JSON
+		Count         int64
+	}
+	overall := feedbackSummaryRow{Tags: map[string]int{}}
+	if err := m.db.WithContext(ctx).
+		Model(&messageFeedback{}).
+		Select("model_name, prompt_version, rating, tags, COUNT(*) AS count").
+		Where("agent_id = ?", agentID).
+		Group("model_name, prompt_version, rating, tags").
+		Scan(&counts).Error; err != nil {
+		return nil, overall, err
+	}
+
+	type groupKey struct {
+		model   string
+		version int
+	}
+	groups := make(map[groupKey]*feedbackSummaryRow)
+	for _, item := range counts {
+		key := groupKey{model: item.ModelName, version: item.PromptVersion}
+		row, ok := groups[key]
+		if !ok {
+			row = &feedbackSummaryRow{ModelName: item.ModelName, PromptVersion: item.PromptVersion, Tags: map[string]int{}}
+			groups[key] = row
+		}
+		for _, target := range []*feedbackSummaryRow{row, &overall} {
+			target.Total += item.Count
+			if item.Rating > 0 {
+				target.Up += item.Count
+			} else {
+				target.Down += item.Count
+			}
+			for _, tag := range decodeFeedbackTags(item.Tags) {
+				target.Tags[tag] += int(item.Count)
+			}
+		}
+	}
+
+	rows := make([]feedbackSummaryRow, 0, len(groups))
+	for _, row := range groups {
+		if row.Total > 0 {
+			row.Approval = float64(row.Up) / float64(row.Total)
+		}
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].PromptVersion != rows[j].PromptVersion {
+			return rows[i].PromptVersion > rows[j].PromptVersion
+		}
+		return rows[i].ModelName < rows[j].ModelName
+	})
+	if overall.Total > 0 {
+		overall.Approval = float64(overall.Up) / float64(overall.Total)
+	}
+	return rows, overall, nil
+}
+
+// handleFeedbackExport godoc
+// @Summary 导出偏好数据集
+// @Description 将同一条用户提问的多次生成中获得点赞与点踩的回复配对，导出 (prompt, chosen, rejected) 偏好数据，format=jsonl 时以 JSON Lines 下载，仅智能体创建者可用。
+// @Description 只导出评价者提交时勾选 share_training 的回复，不同用户或会话的相同提问不会互相配对，文本中的邮箱与电话等长号码替换为占位符
+// @Tags LLM
+// @Produce json
+// @Param agent_id query int true "智能体ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Param format query string false "输出格式 json/jsonl"
+// @Success 200 {object} map[string]interface{} "偏好数据"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 403 {object} map[string]string "权限不足"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleFeedbackExport 导出智能体的偏好数据集。
+func (m *Module) handleFeedbackExport(c *gin.Context) {
+	agentID, ok := m.authorizeFeedbackOwner(c)
+	if !ok {
+		return
+	}
+
+	pairs, err := m.buildPreferencePairs(c.Request.Context(), agentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build preference dataset", "details": err.Error()})
+		return
+	}
+
+	if strings.EqualFold(strings.TrimSpace(c.Query("format")), "jsonl") {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=agent-%d-preferences.jsonl", agentID))
+		c.Status(http.StatusOK)
+		encoder := json.NewEncoder(c.Writer)
+		for _, pair := range pairs {
+			if err := encoder.Encode(pair); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"agent_id": agentID, "count": len(pairs), "pairs": pairs})
+}
+
+// buildPreferencePairs 将同一条用户消息的多次生成中点赞与点踩的回复两两配对。
+// 只使用评价者同意共享（share_training）的评价，按提问消息而非提问文本分组，因此不会跨用户或会话配对；
+// 导出的文本经 redactPersonalInfo 处理。
+func (m *Module) buildPreferencePairs(ctx context.Context, agentID uint64) ([]preferencePair, error) {
+	var rows []struct {
+		MessageID     uint64
+		PromptID      uint64
+		Rating        int
+		Tags          datatypes.JSON
+		ModelName     string
+		PromptVersion int
+		Content       string
+		Prompt        string
+	}
+	if err := m.db.WithContext(ctx).
+		Table("message_feedback AS f").
+		Select("f.message_id, p.id AS prompt_id, f.rating, f.tags, f.model_name, f.prompt_version, a.content, p.content AS prompt").
+		Joins("JOIN messages AS a ON a.id = f.message_id").
+		Joins("JOIN messages AS p ON p.id = a.parent_msg_id").
+		Where("f.agent_id = ? AND f.share_training = ? AND p.role = ?", agentID, true, "user").
+		Order("f.id ASC").
+		Limit(maxPreferenceExportRows).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	type bucket struct {
+		prompt string
+		up     []int
+		down   []int
+	}
+	buckets := make(map[uint64]*bucket)
+	order := make([]uint64, 0)
+	for i, row := range rows {
+		prompt := strings.TrimSpace(row.Prompt)
+		if prompt == "" || strings.TrimSpace(row.Content) == "" {
+			continue
+		}
+		key := row.PromptID
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{prompt: prompt}
+			buckets[key] = b
+			order = append(order, key)
+		}
+		if row.Rating > 0 {
+			b.up = append(b.up, i)
+		} else {
+			b.down = append(b.down, i)
+		}
+	}
+
+	pairs := make([]preferencePair, 0)
+	for _, key := range order {
+		b := buckets[key]
+		for _, ui := range b.up {
+			for _, di := range b.down {
+				chosen, rejected := rows[ui], rows[di]
+				if strings.TrimSpace(chosen.Content) == strings.TrimSpace(rejected.Content) {
+					continue
+				}
+				pairs = append(pairs, preferencePair{
+					AgentID:           agentID,
+					Prompt:            redactPersonalInfo(b.prompt),
+					Chosen:            redactPersonalInfo(chosen.Content),
+					Rejected:          redactPersonalInfo(rejected.Content),
+					ChosenMessageID:   chosen.MessageID,
+					RejectedMessageID: rejected.MessageID,
+					ChosenModel:       chosen.ModelName,
+					RejectedModel:     rejected.ModelName,
+					PromptVersion:     chosen.PromptVersion,
+					RejectedTags:      decodeFeedbackTags(rejected.Tags),
+				})
+			}
+		}
+	}
+	return pairs, nil
+}
+
+// redactPersonalInfo 将文本中的邮箱与电话、证件等长号码替换为占位符。
+func redactPersonalInfo(text string) string {
+	text = feedbackEmailPattern.ReplaceAllString(text, "[email]")
+	return feedbackNumberPattern.ReplaceAllString(text, "[number]")
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+// newFeedbackTestModule 基于内存 SQLite 创建仅包含消息与评价表的模块。
+func newFeedbackTestModule(t *testing.T) *Module {
+	t.Helper()
+	db, err := openDatabase("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&message{}, &messageFeedback{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return &Module{db: db}
+}
+
+// feedbackTurn 写入一条用户提问及其若干次生成的回复，返回回复消息。
+func feedbackTurn(t *testing.T, m *Module, convID uint64, prompt string, replies ...string) []message {
+	t.Helper()
+	question := message{ConversationID: convID, Role: "user", Content: prompt}
+	mustCreate(t, m.db, &question)
+	out := make([]message, 0, len(replies))
+	for _, reply := range replies {
+		answer := message{ConversationID: convID, Role: "assistant", Content: reply, ParentMessageID: &question.ID}
+		mustCreate(t, m.db, &answer)
+		out = append(out, answer)
+	}
+	return out
+}
+
+func rateMessage(t *testing.T, m *Module, msg message, userID uint64, rating int, share bool, tags string) {
+	t.Helper()
+	mustCreate(t, m.db, &messageFeedback{
+		MessageID: msg.ID, UserID: userID, ConversationID: msg.ConversationID, AgentID: 1,
+		ModelName: "model-a", PromptVersion: 1, Rating: rating, Tags: datatypes.JSON(tags), ShareTraining: share,
+	})
+}
+
+func TestBuildPreferencePairsRespectsConsent(t *testing.T) {
+	m := newFeedbackTestModule(t)
+
+	// 同一提问的两次生成，均同意共享：应配对，并替换邮箱与电话。
+	shared := feedbackTurn(t, m, 1, "Email me at ann@example.com", "Sure, call 138 0013 8000.", "No.")
+	rateMessage(t, m, shared[0], 10, 1, true, `[]`)
+	rateMessage(t, m, shared[1], 10, -1, true, `["unhelpful"]`)
+
+	// 未同意共享的评价不导出。
+	private := feedbackTurn(t, m, 2, "hello", "Hi there!", "Go away.")
+	rateMessage(t, m, private[0], 20, 1, false, `[]`)
+	rateMessage(t, m, private[1], 20, -1, true, `[]`)
+
+	// 不同用户、不同会话中文本相同的提问不得互相配对。
+	first := feedbackTurn(t, m, 3, "tell me a joke", "A good joke.")
+	second := feedbackTurn(t, m, 4, "Tell me a  joke", "A bad joke.")
+	rateMessage(t, m, first[0], 30, 1, true, `[]`)
+	rateMessage(t, m, second[0], 40, -1, true, `[]`)
+
+	pairs, err := m.buildPreferencePairs(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("buildPreferencePairs: %v", err)
+	}
+	if len(pairs) != 1 {
+		t.Fatalf("pairs = %+v, want exactly one", pairs)
+	}
+	pair := pairs[0]
+	if pair.Prompt != "Email me at [email]" || pair.Chosen != "Sure, call [number]." || pair.Rejected != "No." {
+		t.Errorf("pair text = %q / %q / %q, want redacted content", pair.Prompt, pair.Chosen, pair.Rejected)
+	}
+	if pair.ChosenMessageID != shared[0].ID || pair.RejectedMessageID != shared[1].ID {
+		t.Errorf("pair messages = %d/%d, want %d/%d", pair.ChosenMessageID, pair.RejectedMessageID, shared[0].ID, shared[1].ID)
+	}
+	if len(pair.RejectedTags) != 1 || pair.RejectedTags[0] != "unhelpful" {
+		t.Errorf("rejected tags = %v", pair.RejectedTags)
+	}
+}
+
+func TestSummarizeFeedback(t *testing.T) {
+	m := newFeedbackTestModule(t)
+	replies := feedbackTurn(t, m, 1, "q", "a", "b", "c", "d")
+	rateMessage(t, m, replies[0], 1, 1, false, `["helpful"]`)
+	rateMessage(t, m, replies[1], 1, 1, false, `["helpful"]`)
+	rateMessage(t, m, replies[2], 1, -1, false, `["too_long","unhelpful"]`)
+	mustCreate(t, m.db, &messageFeedback{MessageID: replies[3].ID, UserID: 1, ConversationID: 1, AgentID: 1, ModelName: "model-b", PromptVersion: 2, Rating: -1, Tags: datatypes.JSON(`["too_long"]`)})
+	mustCreate(t, m.db, &messageFeedback{MessageID: replies[3].ID, UserID: 2, ConversationID: 1, AgentID: 9, ModelName: "model-a", PromptVersion: 1, Rating: 1})
+
+	rows, overall, err := m.summarizeFeedback(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("summarizeFeedback: %v", err)
+	}
+	if overall.Total != 4 || overall.Up != 2 || overall.Down != 2 || overall.Approval != 0.5 {
+		t.Errorf("overall = %+v", overall)
+	}
+	if overall.Tags["helpful"] != 2 || overall.Tags["too_long"] != 2 || overall.Tags["unhelpful"] != 1 {
+		t.Errorf("overall tags = %v", overall.Tags)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("groups = %+v, want 2", rows)
+	}
+	// 提示词版本较新的分组排在前面。
+	if rows[0].ModelName != "model-b" || rows[0].Total != 1 || rows[0].Down != 1 {
+		t.Errorf("first group = %+v", rows[0])
+	}
+	if rows[1].ModelName != "model-a" || rows[1].Total != 3 || rows[1].Up != 2 || rows[1].Tags["helpful"] != 2 {
+		t.Errorf("second group = %+v", rows[1])
+	}
+}
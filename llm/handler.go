@@ -2,8 +2,11 @@ package llm
 
 import (
 	"auralis_back/agents"
+	"auralis_back/asr"
+	"auralis_back/authorization"
 	cache "auralis_back/cache"
 	knowledge "auralis_back/knowledge"
+	"auralis_back/ratelimit"
 	"auralis_back/tts"
 	"context"
 	"encoding/json"
@@ -13,6 +16,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -29,19 +33,36 @@ var allowedMessageRoles = map[string]struct{}{
 	"tool":      {},
 }
 
+// messageRateLimit 限制发送消息类接口的频率：以令牌桶允许短时连发，访客更严格，管理员不限。
+var messageRateLimit = ratelimit.Policy{
+	Name:  "llm-message",
+	Key:   ratelimit.KeyUser,
+	Limit: ratelimit.Bucket(1, 3*time.Second, 10),
+	Roles: map[string]ratelimit.Limit{
+		authorization.RoleGuest: ratelimit.Bucket(1, 10*time.Second, 3),
+		authorization.RoleAdmin: ratelimit.Unlimited,
+	},
+}
+
 // Module 聚合聊天、存储、语音与记忆等依赖。
 type Module struct {
 	client       *ChatClient
 	db           *gorm.DB
 	tts          tts.Synthesizer
+	asr          asr.Provider
 	memory       *conversationMemory
 	modelCatalog []ChatModelOption
 	messageCache *messageCache
 	knowledge    *knowledge.Service
+	proactive    *proactiveScheduler
+	channels     map[string]ChannelAdapter
+	channelPool  *channelWorkerPool
+	limiter      *ratelimit.Limiter
+	extrasMu     sync.Mutex
 }
 
 // RegisterRoutes 注册 LLM 相关的路由与依赖。
-func RegisterRoutes(router *gin.Engine, synthesizer tts.Synthesizer, knowledgeSvc *knowledge.Service) (*Module, error) {
+func RegisterRoutes(router *gin.Engine, guard *authorization.Guard, synthesizer tts.Synthesizer, knowledgeSvc *knowledge.Service, recognizer asr.Provider, limiter *ratelimit.Limiter) (*Module, error) {
 	client, err := NewChatClientFromEnv()
 	if err != nil {
 		return nil, err
@@ -52,7 +73,7 @@ func RegisterRoutes(router *gin.Engine, synthesizer tts.Synthesizer, knowledgeSv
 		return nil, err
 	}
 
-	if err := db.AutoMigrate(&conversation{}, &message{}, &userAgentMemory{}); err != nil {
+	if err := db.AutoMigrate(&conversation{}, &message{}, &userAgentMemory{}, &chatRoom{}, &chatRoomParticipant{}, &chatRoomMessage{}, &scheduledMessage{}, &channelBinding{}, &channelIdentity{}, &channelInboundEvent{}, &apiKey{}, &messageFeedback{}); err != nil {
 		return nil, err
 	}
 
@@ -67,19 +88,49 @@ func RegisterRoutes(router *gin.Engine, synthesizer tts.Synthesizer, knowledgeSv
 		client:       client,
 		db:           db,
 		tts:          synthesizer,
+		asr:          recognizer,
 		memory:       newConversationMemory(db, client),
 		modelCatalog: loadChatModelCatalog(),
 		messageCache: msgCache,
 		knowledge:    knowledgeSvc,
+		channels:     defaultChannelAdapters(),
+		limiter:      limiter,
 	}
+	module.proactive = newProactiveSchedulerFromEnv(module)
+	module.channelPool = newChannelWorkerPoolFromEnv(module)
 
 	group := router.Group("/llm")
 	group.GET("/models", module.handleListModels)
-	group.POST("/complete", module.handleComplete)
-	group.GET("/messages", module.handleRecentMessages)
-	group.GET("/messages/:id/speech", module.handleMessageSpeech)
-	group.GET("/messages/:id/speech/audio", module.handleMessageSpeechAudio)
-	group.POST("/messages", module.handleCreateMessage)
+
+	secured := group.Group("")
+	if guard != nil {
+		secured.Use(guard.RequireAuthenticated())
+	} else {
+		secured.Use(func(c *gin.Context) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization middleware missing"})
+		})
+	}
+	// members 必须在 secured 挂载鉴权中间件之后创建，gin 在 Group 时复制父分组的处理链。
+	members := secured.Group("")
+	if guard != nil {
+		members.Use(guard.RequireMember())
+	}
+	secured.POST("/complete", limiter.Handler(messageRateLimit), module.handleComplete)
+	secured.GET("/messages", module.handleRecentMessages)
+	secured.GET("/messages/:id/speech", module.handleMessageSpeech)
+	secured.GET("/messages/:id/speech/audio", module.handleMessageSpeechAudio)
+	secured.POST("/messages", limiter.Handler(messageRateLimit), module.handleCreateMessage)
+	module.registerRoomRoutes(secured)
+	module.registerProactiveRoutes(secured)
+	module.registerChannelRoutes(group, secured)
+	module.registerAPIKeyRoutes(members)
+	module.registerFeedbackRoutes(secured)
+	module.registerTranslationRoutes(secured)
+	module.registerVoiceInputRoutes(secured)
+	module.registerRealtimeVoiceRoutes(secured)
+	module.registerOpenAIRoutes(router)
+
+	module.proactive.start()
 
 	return module, nil
 }
@@ -181,7 +232,7 @@ type messageRecord struct {
 // @Tags LLM
 // @Produce json
 // @Param agent_id query int true "智能体ID"
-// @Param user_id query int true "用户ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
 // @Success 200 {object} map[string]interface{} "消息列表"
 // @Failure 400 {object} map[string]string "请求参数错误"
 // @Failure 500 {object} map[string]string "服务器错误"
@@ -194,9 +245,8 @@ func (m *Module) handleRecentMessages(c *gin.Context) {
 	}
 
 	agentIDStr := strings.TrimSpace(c.Query("agent_id"))
-	userIDStr := strings.TrimSpace(c.Query("user_id"))
-	if agentIDStr == "" || userIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id and user_id are required"})
+	if agentIDStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id is required"})
 		return
 	}
 
@@ -206,9 +256,8 @@ func (m *Module) handleRecentMessages(c *gin.Context) {
 		return
 	}
 
-	userID, err := strconv.ParseUint(userIDStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
 		return
 	}
 
@@ -348,7 +397,7 @@ func (m *Module) ensureSpeechAudioURL(speech map[string]any) map[string]any {
 // @Produce json
 // @Param id path int true "消息ID"
 // @Param agent_id query int true "智能体ID"
-// @Param user_id query int true "用户ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
 // @Success 200 {object} map[string]interface{} "语音信息"
 // @Failure 400 {object} map[string]string "请求参数错误"
 // @Failure 404 {object} map[string]string "未找到"
@@ -374,9 +423,8 @@ func (m *Module) handleMessageSpeech(c *gin.Context) {
 	}
 
 	agentIDStr := strings.TrimSpace(c.Query("agent_id"))
-	userIDStr := strings.TrimSpace(c.Query("user_id"))
-	if agentIDStr == "" || userIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id and user_id are required"})
+	if agentIDStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id is required"})
 		return
 	}
 
@@ -386,9 +434,8 @@ func (m *Module) handleMessageSpeech(c *gin.Context) {
 		return
 	}
 
-	userID, err := strconv.ParseUint(userIDStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
 		return
 	}
 
@@ -450,7 +497,7 @@ func (m *Module) handleMessageSpeechAudio(c *gin.Context) {
 
 type createMessageRequest struct {
 	AgentID       string   `json:"agent_id" binding:"required"`
-	UserID        string   `json:"user_id" binding:"required"`
+	UserID        string   `json:"user_id"`
 	Role          string   `json:"role" binding:"required"`
 	Content       string   `json:"content" binding:"required"`
 	VoiceID       string   `json:"voice_id"`
@@ -482,14 +529,15 @@ type emotionMetadata struct {
 }
 
 type createMessageResponse struct {
-	ConversationID   uint64         `json:"conversation_id"`
-	AgentID          uint64         `json:"agent_id"`
-	UserID           uint64         `json:"user_id"`
-	UserMessage      messageRecord  `json:"user_message"`
-	AssistantMessage *messageRecord `json:"assistant_message,omitempty"`
-	AssistantError   string         `json:"assistant_error,omitempty"`
-	TokensUsed       *int           `json:"tokens_used,omitempty"`
-	TokenBalance     *int64         `json:"token_balance,omitempty"`
+	ConversationID   uint64                  `json:"conversation_id"`
+	AgentID          uint64                  `json:"agent_id"`
+	UserID           uint64                  `json:"user_id"`
+	UserMessage      messageRecord           `json:"user_message"`
+	AssistantMessage *messageRecord          `json:"assistant_message,omitempty"`
+	AssistantError   string                  `json:"assistant_error,omitempty"`
+	TokensUsed       *int                    `json:"tokens_used,omitempty"`
+	TokenBalance     *int64                  `json:"token_balance,omitempty"`
+	Reminder         *scheduledMessageRecord `json:"reminder,omitempty"`
 }
 
 // handleCreateMessage godoc
@@ -518,15 +566,19 @@ func (m *Module) handleCreateMessage(c *gin.Context) {
 		return
 	}
 
+	m.processCreateMessage(c, req, nil)
+}
+
+// processCreateMessage 写入消息并按需生成回复，userExtras 会写入用户消息的扩展字段。
+func (m *Module) processCreateMessage(c *gin.Context, req createMessageRequest, userExtras map[string]any) {
 	agentID, parseErr := parsePositiveUint(req.AgentID, "agent_id")
 	if parseErr != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
 		return
 	}
 
-	userID, parseErr := parsePositiveUint(req.UserID, "user_id")
-	if parseErr != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
 		return
 	}
 
@@ -577,6 +629,81 @@ func (m *Module) handleCreateMessage(c *gin.Context) {
 		startingBalance = balance
 	}
 
+	conv, userMsg, userRecord, err := m.appendConversationMessage(ctx, agentID, userID, role, content, userExtras)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create message", "details": err.Error()})
+		return
+	}
+
+	if m.memory != nil {
+		if prefErr := m.memory.upsertSpeechPreferences(ctx, agentID, userID, prefs); prefErr != nil {
+			log.Printf("llm: persist speech preferences: %v", prefErr)
+		}
+	}
+
+	m.invalidateRecentMessagesCache(ctx, conv.AgentID, conv.UserID)
+
+	response := createMessageResponse{
+		ConversationID: conv.ID,
+		AgentID:        conv.AgentID,
+		UserID:         conv.UserID,
+		UserMessage:    userRecord,
+	}
+
+	if role == "user" {
+		if err := m.markConversationRead(ctx, conv.AgentID, conv.UserID); err != nil {
+			log.Printf("llm: reset unread count failed: %v", err)
+		}
+		if reminder := m.captureReminderRequest(ctx, conv.AgentID, conv.UserID, content); reminder != nil {
+			record := scheduledToRecord(*reminder)
+			response.Reminder = &record
+		}
+	}
+
+	remainingBalance := startingBalance
+	var tokensUsedTotal int64
+
+	if role == "user" && wantsEventStream(c) {
+		m.handleCreateMessageStream(c, conv, userMsg, userRecord, prefs, startingBalance)
+		return
+	}
+
+	if role == "user" {
+		assistantRecord, usage, genErr := m.generateAssistantReply(ctx, conv, userMsg, prefs)
+		if genErr != nil {
+			response.AssistantError = genErr.Error()
+		} else if assistantRecord != nil {
+			response.AssistantMessage = assistantRecord
+		}
+		if usage != nil {
+			tokensUsedTotal = totalTokensUsed(usage)
+			updatedBalance, err := m.applyUsageToUserTokens(ctx, conv.UserID, usage, startingBalance)
+			if err != nil {
+				log.Printf("llm: failed to apply token usage: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to finalize token usage"})
+				return
+			}
+			remainingBalance = updatedBalance
+		}
+	}
+
+	if startingBalance >= 0 {
+		if remainingBalance < 0 {
+			remainingBalance = 0
+		}
+		response.TokenBalance = int64Pointer(remainingBalance)
+	}
+	if tokensUsedTotal > 0 {
+		if ptr := intPointerIfPositive(int(tokensUsedTotal)); ptr != nil {
+			response.TokensUsed = ptr
+		}
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// appendConversationMessage 在用户与智能体的会话中追加一条消息，会话不存在时自动创建。
+func (m *Module) appendConversationMessage(ctx context.Context, agentID, userID uint64, role, content string, extras map[string]any) (conversation, message, messageRecord, error) {
 	var convID uint64
 	var userMsg message
 	var userRecord messageRecord
@@ -630,6 +757,13 @@ func (m *Module) handleCreateMessage(c *gin.Context) {
 			Content:         content,
 			ParentMessageID: parentID,
 		}
+		if len(extras) > 0 {
+			raw, err := json.Marshal(extras)
+			if err != nil {
+				return err
+			}
+			msg.Extras = datatypes.JSON(raw)
+		}
 
 		if err := tx.Create(&msg).Error; err != nil {
 			return err
@@ -665,71 +799,14 @@ func (m *Module) handleCreateMessage(c *gin.Context) {
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create message", "details": err.Error()})
-		return
-	}
-
-	if m.memory != nil {
-		if prefErr := m.memory.upsertSpeechPreferences(ctx, agentID, userID, prefs); prefErr != nil {
-			log.Printf("llm: persist speech preferences: %v", prefErr)
-		}
+		return conversation{}, message{}, messageRecord{}, err
 	}
 
 	var conv conversation
 	if err := m.db.WithContext(ctx).First(&conv, "id = ?", convID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load conversation", "details": err.Error()})
-		return
+		return conversation{}, message{}, messageRecord{}, err
 	}
-
-	m.invalidateRecentMessagesCache(ctx, conv.AgentID, conv.UserID)
-
-	response := createMessageResponse{
-		ConversationID: conv.ID,
-		AgentID:        conv.AgentID,
-		UserID:         conv.UserID,
-		UserMessage:    userRecord,
-	}
-
-	remainingBalance := startingBalance
-	var tokensUsedTotal int64
-
-	if role == "user" && wantsEventStream(c) {
-		m.handleCreateMessageStream(c, conv, userMsg, userRecord, prefs, startingBalance)
-		return
-	}
-
-	if role == "user" {
-		assistantRecord, usage, genErr := m.generateAssistantReply(ctx, conv, userMsg, prefs)
-		if genErr != nil {
-			response.AssistantError = genErr.Error()
-		} else if assistantRecord != nil {
-			response.AssistantMessage = assistantRecord
-		}
-		if usage != nil {
-			tokensUsedTotal = totalTokensUsed(usage)
-			updatedBalance, err := m.applyUsageToUserTokens(ctx, conv.UserID, usage, startingBalance)
-			if err != nil {
-				log.Printf("llm: failed to apply token usage: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to finalize token usage"})
-				return
-			}
-			remainingBalance = updatedBalance
-		}
-	}
-
-	if startingBalance >= 0 {
-		if remainingBalance < 0 {
-			remainingBalance = 0
-		}
-		response.TokenBalance = int64Pointer(remainingBalance)
-	}
-	if tokensUsedTotal > 0 {
-		if ptr := intPointerIfPositive(int(tokensUsedTotal)); ptr != nil {
-			response.TokensUsed = ptr
-		}
-	}
-
-	c.JSON(http.StatusCreated, response)
+	return conv, userMsg, userRecord, nil
 }
 
 // parsePositiveUint 将字符串解析为正整数。
@@ -768,6 +845,11 @@ func (m *Module) generateAssistantReply(ctx context.Context, conv conversation,
 
 	applyPreferenceDefaults(&prefs, contextData)
 
+	plan := m.planTranslation(conv, contextData, userMsg.Content)
+	if plan != nil {
+		contextData.messages = append(contextData.messages, ChatMessage{Role: "system", Content: plan.instruction()})
+	}
+
 	start := time.Now()
 	result, err := m.client.Chat(ctx, contextData.messages, modelName)
 	if err != nil {
@@ -778,26 +860,40 @@ func (m *Module) generateAssistantReply(ctx context.Context, conv conversation,
 		})
 		return nil, nil, err
 	}
-	reply := result.Content
-	usage := result.Usage
+	reply, styleApplied := applyStyleGuide(contextData.config, result.Content)
+	reply, usage, translationMeta := m.applyTranslation(ctx, plan, reply, modelName, result.Usage)
 
 	latency := int(time.Since(start).Milliseconds())
 	parentID := userMsg.ID
 
 	selection := resolveVoiceSelection(prefs.VoiceID, prefs.Provider, m.tts)
+	if plan != nil {
+		selection = voiceForLanguage(m.tts, selection, plan.Target)
+	}
 	prefs.Provider = selection.Provider
 	voiceID := selection.ID
 	speed := sanitizeSpeed(prefs.Speed)
 	pitch := sanitizePitch(prefs.Pitch)
-	emotionMeta := inferEmotion(reply, prefs.EmotionHint)
+	emotionMeta := contextData.motions.annotate(inferEmotion(reply, prefs.EmotionHint))
+	timeline := buildEmotionTimeline(reply, prefs.EmotionHint, speed, contextData.motions)
+	refinement := m.startEmotionRefinement(timeline, modelName)
 
-	extrasPayload := make(map[string]any)
+	extrasPayload := map[string]any{"generation": m.generationExtras(contextData)}
 	if len(knowledgeSnippets) > 0 {
 		extrasPayload["knowledge_refs"] = snippetsToExtras(knowledgeSnippets)
 	}
+	if len(styleApplied) > 0 {
+		extrasPayload["style_enforced"] = styleApplied
+	}
+	if translationMeta != nil {
+		extrasPayload["translation"] = translationMeta
+	}
 	if emotionMeta != nil {
 		extrasPayload["emotion"] = emotionMeta
 	}
+	if timeline != nil {
+		extrasPayload["emotion_timeline"] = timeline
+	}
 	if voiceID != "" || speed != 1.0 || pitch != 1.0 {
 		prefsMap := map[string]any{
 			"voice_id": voiceID,
@@ -867,6 +963,7 @@ func (m *Module) generateAssistantReply(ctx context.Context, conv conversation,
 	}
 
 	record := messageToRecord(assistant, conv)
+	m.storeEmotionRefinementAsync(&message{}, assistant.ID, refinement, contextData.motions)
 
 	if speechEnabled {
 		m.enqueueSpeechSynthesis(assistant.ID, conv, reply, selection, speed, pitch, emotionMeta)
@@ -883,8 +980,18 @@ func (m *Module) generateAssistantReply(ctx context.Context, conv conversation,
 	return &record, usage, nil
 }
 
-// buildSystemPrompt 构建系统提示词。
-func buildSystemPrompt(agent *agents.Agent, cfg *agents.AgentChatConfig) string {
+// promptVars 构建渲染提示词模板所需的运行时变量。
+func (m *Module) promptVars(ctx context.Context, agent *agents.Agent, userID uint64) agents.PromptVars {
+	var agentID uint64
+	if agent != nil {
+		agentID = agent.ID
+	}
+	return agents.BuildPromptVars(agent, agents.LoadPromptUser(ctx, m.db, agentID, userID), time.Now())
+}
+
+// buildSystemPrompt 构建系统提示词，人设、自定义提示与引导语中的模板变量按 vars 渲染；
+// lang 为会话语言，为空时要求以智能体的默认语言回复。
+func buildSystemPrompt(agent *agents.Agent, cfg *agents.AgentChatConfig, vars agents.PromptVars, lang string) string {
 	if agent == nil {
 		return "You are a helpful assistant."
 	}
@@ -892,24 +999,32 @@ func buildSystemPrompt(agent *agents.Agent, cfg *agents.AgentChatConfig) string
 	parts := []string{fmt.Sprintf("You are %s, a virtual smart companion. Stay engaging, empathetic, and professional.", agent.Name)}
 
 	if agent.PersonaDesc != nil {
-		if desc := strings.TrimSpace(*agent.PersonaDesc); desc != "" {
+		if desc := strings.TrimSpace(agents.RenderPromptTemplate(*agent.PersonaDesc, vars)); desc != "" {
 			parts = append(parts, desc)
 		}
 	}
 
 	if cfg != nil && cfg.SystemPrompt != nil {
-		if custom := strings.TrimSpace(*cfg.SystemPrompt); custom != "" {
+		if custom := strings.TrimSpace(agents.RenderPromptTemplate(*cfg.SystemPrompt, vars)); custom != "" {
 			parts = append(parts, custom)
 		}
 	}
 
+	if guide := parseStyleGuide(cfg); guide != nil {
+		parts = append(parts, guide.PromptSection())
+	}
+
 	if agent.FirstTurnHint != nil {
-		if hint := strings.TrimSpace(*agent.FirstTurnHint); hint != "" {
+		if hint := strings.TrimSpace(agents.RenderPromptTemplate(*agent.FirstTurnHint, vars)); hint != "" {
 			parts = append(parts, "Conversation guidance: "+hint)
 		}
 	}
 
-	if lang := strings.TrimSpace(agent.LangDefault); lang != "" {
+	lang = strings.TrimSpace(lang)
+	if lang == "" {
+		lang = strings.TrimSpace(agent.LangDefault)
+	}
+	if lang != "" {
 		parts = append(parts, fmt.Sprintf("Reply in %s unless the user explicitly requests another language.", lang))
 	}
 
@@ -1185,7 +1300,7 @@ func normalizeEmotionLabel(value string) string {
 	}
 }
 
-// motionForEmotion 根据情绪映射 Live2D 动作。
+// motionForEmotion 根据情绪映射通用 Live2D 动作名，模型未提供动作元数据时直接使用。
 func motionForEmotion(label string, intensity float64) string {
 	switch label {
 	case "happy":
@@ -1294,11 +1409,6 @@ func inferEmotion(text, hint string) *emotionMetadata {
 	}
 }
 
-const (
-	knowledgeSnippetLimit    = 4
-	knowledgePromptCharLimit = 480
-)
-
 // attachKnowledgeContext 将知识片段注入对话上下文。
 func (m *Module) attachKnowledgeContext(ctx context.Context, ctxData *conversationContext, agentID uint64, query string) ([]knowledge.ContextSnippet, error) {
 	if m == nil || m.knowledge == nil || ctxData == nil {
@@ -1309,7 +1419,7 @@ func (m *Module) attachKnowledgeContext(ctx context.Context, ctxData *conversati
 		return nil, nil
 	}
 
-	snippets, err := m.knowledge.QueryTopChunks(ctx, agentID, trimmed, knowledgeSnippetLimit)
+	snippets, err := m.knowledge.Search(ctx, agentID, trimmed, agents.KnowledgeSearchOptions(ctxData.config, nil))
 	if err != nil {
 		return nil, err
 	}
@@ -1317,44 +1427,12 @@ func (m *Module) attachKnowledgeContext(ctx context.Context, ctxData *conversati
 		return nil, nil
 	}
 
-	prompt := buildKnowledgePrompt(snippets)
+	prompt := knowledge.BuildContextPrompt(snippets)
 	ctxData.messages = append([]ChatMessage{{Role: "system", Content: prompt}}, ctxData.messages...)
 	ctxData.knowledge = snippets
 	return snippets, nil
 }
 
-// buildKnowledgePrompt 生成带引用信息的知识提示。
-func buildKnowledgePrompt(snippets []knowledge.ContextSnippet) string {
-	var builder strings.Builder
-	builder.WriteString("Agent knowledge references (cite as [Ref#] when used):\n")
-	for i, snippet := range snippets {
-		label := fmt.Sprintf("[Ref%d]", i+1)
-		builder.WriteString(label)
-		builder.WriteString(" ")
-		title := strings.TrimSpace(snippet.Title)
-		if title == "" {
-			title = fmt.Sprintf("Document %d", snippet.DocumentID)
-		}
-		builder.WriteString(title)
-		builder.WriteString("\n")
-		if snippet.Source != nil {
-			if source := strings.TrimSpace(*snippet.Source); source != "" {
-				builder.WriteString("Source: ")
-				builder.WriteString(source)
-				builder.WriteString("\n")
-			}
-		}
-		excerpt := truncateForPrompt(snippet.Text, knowledgePromptCharLimit)
-		if excerpt != "" {
-			builder.WriteString(excerpt)
-			builder.WriteString("\n")
-		}
-		builder.WriteString("---\n")
-	}
-	builder.WriteString("Use the knowledge above when it helps, and mention the reference label in brackets when quoting it.")
-	return builder.String()
-}
-
 // snippetsToExtras 将知识片段转换为消息扩展字段。
 func snippetsToExtras(snippets []knowledge.ContextSnippet) []map[string]any {
 	if len(snippets) == 0 {
@@ -1369,13 +1447,22 @@ func snippetsToExtras(snippets []knowledge.ContextSnippet) []map[string]any {
 			"seq":         snippet.Seq,
 			"score":       snippet.Score,
 			"vector_id":   snippet.VectorID,
-			"excerpt":     truncateForPrompt(snippet.Text, knowledgePromptCharLimit),
+			"excerpt":     knowledge.ContextExcerpt(snippet.Text),
 		}
 		if snippet.Source != nil {
 			if source := strings.TrimSpace(*snippet.Source); source != "" {
 				item["source"] = source
 			}
 		}
+		if snippet.Heading != "" {
+			item["heading"] = snippet.Heading
+		}
+		if snippet.Page > 0 {
+			item["page"] = snippet.Page
+		}
+		if snippet.RerankScore > 0 {
+			item["rerank_score"] = snippet.RerankScore
+		}
 		if len(snippet.Tags) > 0 {
 			item["tags"] = snippet.Tags
 		}
@@ -1383,16 +1470,3 @@ func snippetsToExtras(snippets []knowledge.ContextSnippet) []map[string]any {
 	}
 	return result
 }
-
-// truncateForPrompt 为提示裁剪文本长度。
-func truncateForPrompt(text string, max int) string {
-	trimmed := strings.TrimSpace(text)
-	if max <= 0 || trimmed == "" {
-		return trimmed
-	}
-	runes := []rune(trimmed)
-	if len(runes) <= max {
-		return trimmed
-	}
-	return string(runes[:max]) + "…"
-}
@@ -157,7 +157,12 @@ func (m *conversationMemory) upsertSpeechPreferences(ctx context.Context, agentI
 	if hint := strings.TrimSpace(prefs.EmotionHint); hint != "" {
 		payload["emotion_hint"] = hint
 	}
-	if len(payload) == 0 {
+	return m.upsertPreferences(ctx, agentID, userID, payload)
+}
+
+// upsertPreferences 将偏好键值合并写入用户记忆。
+func (m *conversationMemory) upsertPreferences(ctx context.Context, agentID, userID uint64, payload map[string]any) error {
+	if m == nil || agentID == 0 || userID == 0 || len(payload) == 0 {
 		return nil
 	}
 
@@ -20,6 +20,10 @@ type conversation struct {
 	TokenInputSum    int        `gorm:"column:token_input_sum;default:0"`
 	TokenOutputSum   int        `gorm:"column:token_output_sum;default:0"`
 	SummaryUpdatedAt *time.Time `gorm:"column:summary_updated_at"`
+	UnreadCount      int        `gorm:"column:unread_count;not null;default:0"`
+	LastProactiveAt  *time.Time `gorm:"column:last_proactive_at"`
+	TranslationMode  bool       `gorm:"column:translation_mode;not null;default:false"`
+	TranslationLang  *string    `gorm:"column:translation_lang;size:10"`
 	StartedAt        time.Time  `gorm:"column:started_at"`
 	LastMsgAt        time.Time  `gorm:"column:last_msg_at"`
 	CreatedAt        time.Time  `gorm:"column:created_at"`
@@ -70,3 +74,170 @@ type userAgentMemory struct {
 func (userAgentMemory) TableName() string {
 	return "user_agent_memory"
 }
+
+// chatRoom 表示用户与多个智能体同时对话的群聊房间。
+type chatRoom struct {
+	ID               uint64     `gorm:"primaryKey"`
+	UserID           uint64     `gorm:"column:user_id;not null;index"`
+	Title            *string    `gorm:"column:title;size:200"`
+	TurnPolicy       string     `gorm:"column:turn_policy;size:16;not null;default:'round_robin'"`
+	ModeratorAgentID *uint64    `gorm:"column:moderator_agent_id"`
+	NextTurn         int        `gorm:"column:next_turn;not null;default:0"`
+	Status           string     `gorm:"column:status;size:16;not null;default:'active'"`
+	TokenInputSum    int        `gorm:"column:token_input_sum;default:0"`
+	TokenOutputSum   int        `gorm:"column:token_output_sum;default:0"`
+	LastMsgAt        *time.Time `gorm:"column:last_msg_at"`
+	CreatedAt        time.Time  `gorm:"column:created_at"`
+	UpdatedAt        time.Time  `gorm:"column:updated_at"`
+}
+
+// TableName 指定群聊房间表名。
+func (chatRoom) TableName() string {
+	return "chat_rooms"
+}
+
+// chatRoomParticipant 记录房间内参与对话的智能体及其发言顺序。
+type chatRoomParticipant struct {
+	ID        uint64    `gorm:"primaryKey"`
+	RoomID    uint64    `gorm:"column:room_id;not null;uniqueIndex:idx_chat_room_agent,priority:1"`
+	AgentID   uint64    `gorm:"column:agent_id;not null;uniqueIndex:idx_chat_room_agent,priority:2"`
+	Position  int       `gorm:"column:position;not null;default:0"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+// TableName 指定群聊参与者表名。
+func (chatRoomParticipant) TableName() string {
+	return "chat_room_participants"
+}
+
+// chatRoomMessage 保存群聊中的单条消息，助手消息归属到具体智能体。
+type chatRoomMessage struct {
+	ID          uint64         `gorm:"primaryKey"`
+	RoomID      uint64         `gorm:"column:room_id;not null;index:idx_chat_room_messages_seq,priority:1"`
+	Seq         int            `gorm:"column:seq;index:idx_chat_room_messages_seq,priority:2"`
+	Role        string         `gorm:"column:role;size:16"`
+	AgentID     *uint64        `gorm:"column:agent_id"`
+	Content     string         `gorm:"column:content;type:text"`
+	LatencyMs   *int           `gorm:"column:latency_ms"`
+	TokenInput  *int           `gorm:"column:token_input"`
+	TokenOutput *int           `gorm:"column:token_output"`
+	ErrCode     *string        `gorm:"column:err_code"`
+	ErrMsg      *string        `gorm:"column:err_msg"`
+	Extras      datatypes.JSON `gorm:"column:extras"`
+	CreatedAt   time.Time      `gorm:"column:created_at"`
+}
+
+// TableName 指定群聊消息表名。
+func (chatRoomMessage) TableName() string {
+	return "chat_room_messages"
+}
+
+// scheduledMessage 记录待由智能体主动发送的消息任务（提醒、每日问候、召回）。
+type scheduledMessage struct {
+	ID            uint64     `gorm:"primaryKey"`
+	AgentID       uint64     `gorm:"column:agent_id;not null;index:idx_scheduled_messages_owner,priority:1"`
+	UserID        uint64     `gorm:"column:user_id;not null;index:idx_scheduled_messages_owner,priority:2"`
+	Kind          string     `gorm:"column:kind;size:16;not null"`
+	Note          *string    `gorm:"column:note;type:text"`
+	DueAt         time.Time  `gorm:"column:due_at;not null;index:idx_scheduled_messages_due,priority:2"`
+	Status        string     `gorm:"column:status;size:16;not null;default:'pending';index:idx_scheduled_messages_due,priority:1"`
+	Attempts      int        `gorm:"column:attempts;not null;default:0"`
+	LastError     *string    `gorm:"column:last_error;size:512"`
+	SentMessageID *uint64    `gorm:"column:sent_message_id"`
+	SentAt        *time.Time `gorm:"column:sent_at"`
+	CreatedAt     time.Time  `gorm:"column:created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at"`
+}
+
+// TableName 指定主动消息任务表名。
+func (scheduledMessage) TableName() string {
+	return "scheduled_messages"
+}
+
+// channelBinding 记录智能体与外部消息平台之间的绑定配置。
+type channelBinding struct {
+	ID            uint64    `gorm:"primaryKey"`
+	AgentID       uint64    `gorm:"column:agent_id;not null;index"`
+	Channel       string    `gorm:"column:channel;size:16;not null"`
+	OwnerID       uint64    `gorm:"column:owner_id;not null;index"`
+	SigningSecret string    `gorm:"column:signing_secret;size:128;not null"`
+	BotToken      *string   `gorm:"column:bot_token;size:255"`
+	Endpoint      *string   `gorm:"column:endpoint;size:255"`
+	Status        string    `gorm:"column:status;size:16;not null;default:'active'"`
+	CreatedAt     time.Time `gorm:"column:created_at"`
+	UpdatedAt     time.Time `gorm:"column:updated_at"`
+}
+
+// TableName 指定渠道绑定表名。
+func (channelBinding) TableName() string {
+	return "channel_bindings"
+}
+
+// channelIdentity 将外部平台的用户映射为 Auralis 用户。
+type channelIdentity struct {
+	ID             uint64    `gorm:"primaryKey"`
+	BindingID      uint64    `gorm:"column:binding_id;not null;uniqueIndex:idx_channel_identity,priority:1"`
+	ExternalUserID string    `gorm:"column:external_user_id;size:128;not null;uniqueIndex:idx_channel_identity,priority:2"`
+	ExternalChatID string    `gorm:"column:external_chat_id;size:128"`
+	DisplayName    *string   `gorm:"column:display_name;size:128"`
+	UserID         uint64    `gorm:"column:user_id;not null;index"`
+	CreatedAt      time.Time `gorm:"column:created_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at"`
+}
+
+// TableName 指定渠道身份映射表名。
+func (channelIdentity) TableName() string {
+	return "channel_identities"
+}
+
+// channelInboundEvent 记录已受理的入站事件，(binding_id, event_id) 唯一，用于拒绝重放与平台的重复投递。
+type channelInboundEvent struct {
+	ID        uint64    `gorm:"primaryKey"`
+	BindingID uint64    `gorm:"column:binding_id;not null;uniqueIndex:idx_channel_inbound_event,priority:1"`
+	EventID   string    `gorm:"column:event_id;size:128;not null;uniqueIndex:idx_channel_inbound_event,priority:2"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+// TableName 指定渠道入站事件表名。
+func (channelInboundEvent) TableName() string {
+	return "channel_inbound_events"
+}
+
+// apiKey 保存用户用于 OpenAI 兼容接口的访问密钥，仅存储哈希值。
+type apiKey struct {
+	ID         uint64     `gorm:"primaryKey"`
+	UserID     uint64     `gorm:"column:user_id;not null;index"`
+	Name       string     `gorm:"column:name;size:100;not null"`
+	Prefix     string     `gorm:"column:prefix;size:16;not null"`
+	KeyHash    string     `gorm:"column:key_hash;size:64;not null;uniqueIndex"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+	CreatedAt  time.Time  `gorm:"column:created_at"`
+}
+
+// TableName 指定 API 密钥表名。
+func (apiKey) TableName() string {
+	return "api_keys"
+}
+
+// messageFeedback 记录用户对单条助手消息的评价。
+type messageFeedback struct {
+	ID             uint64         `gorm:"primaryKey"`
+	MessageID      uint64         `gorm:"column:message_id;not null;uniqueIndex:idx_message_feedback_user,priority:1"`
+	UserID         uint64         `gorm:"column:user_id;not null;uniqueIndex:idx_message_feedback_user,priority:2"`
+	ConversationID uint64         `gorm:"column:conversation_id;not null"`
+	AgentID        uint64         `gorm:"column:agent_id;not null;index:idx_message_feedback_agent,priority:1"`
+	ModelName      string         `gorm:"column:model_name;size:100;index:idx_message_feedback_agent,priority:2"`
+	PromptVersion  int            `gorm:"column:prompt_version;not null;default:0;index:idx_message_feedback_agent,priority:3"`
+	Rating         int            `gorm:"column:rating;not null"`
+	Tags           datatypes.JSON `gorm:"column:tags"`
+	Comment        *string        `gorm:"column:comment;type:text"`
+	ShareTraining  bool           `gorm:"column:share_training;not null;default:false"`
+	CreatedAt      time.Time      `gorm:"column:created_at"`
+	UpdatedAt      time.Time      `gorm:"column:updated_at"`
+}
+
+// TableName 指定消息评价表名。
+func (messageFeedback) TableName() string {
+	return "message_feedback"
+}
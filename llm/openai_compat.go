@@ -0,0 +1,486 @@
+package llm
+
+import (
+	"auralis_back/agents"
+	"auralis_back/ratelimit"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const openAIModelPrefix = "agent-"
+
+// errAgentModelNotFound 表示请求的模型无法映射到可访问的智能体。
+var errAgentModelNotFound = errors.New("llm: agent model not found")
+
+type openAIChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+	Name    string          `json:"name,omitempty"`
+}
+
+type openAIChatRequest struct {
+	Model         string              `json:"model"`
+	Messages      []openAIChatMessage `json:"messages"`
+	Stream        bool                `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+	User string `json:"user,omitempty"`
+}
+
+type openAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+	Name    string `json:"name,omitempty"`
+}
+
+type openAIChoiceMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+type openAIChoice struct {
+	Index        int                  `json:"index"`
+	Message      *openAIChoiceMessage `json:"message,omitempty"`
+	Delta        *openAIChoiceMessage `json:"delta,omitempty"`
+	FinishReason *string              `json:"finish_reason"`
+}
+
+type openAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *ChatUsage     `json:"usage,omitempty"`
+}
+
+// registerOpenAIRoutes 注册 OpenAI 兼容的 /v1 接口。
+func (m *Module) registerOpenAIRoutes(router *gin.Engine) {
+	group := router.Group("/v1", m.requireAPIKey())
+	group.GET("/models", m.handleOpenAIModels)
+	group.POST("/chat/completions", m.limiter.Handler(apiMessageRateLimit), m.handleOpenAIChatCompletions)
+}
+
+// apiMessageRateLimit 与站内发送消息共用规则与计数，按 API 密钥所属用户计数。
+var apiMessageRateLimit = func() ratelimit.Policy {
+	policy := messageRateLimit
+	policy.Identify = func(c *gin.Context) (uint64, []string) {
+		return apiKeyUserID(c), nil
+	}
+	return policy
+}()
+
+// openAIUpstreamErrorMessage 是上游模型失败时返回给调用方的通用提示，具体错误只写日志，避免泄露上游地址与服务商信息。
+const openAIUpstreamErrorMessage = "upstream model request failed"
+
+// openAIError 以 OpenAI 错误格式返回响应。
+func openAIError(c *gin.Context, status int, message, errType, code string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": gin.H{
+		"message": message,
+		"type":    errType,
+		"code":    code,
+	}})
+}
+
+// requireAPIKey 校验 Authorization 头中的 API 密钥。
+func (m *Module) requireAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := strings.TrimSpace(c.GetHeader("Authorization"))
+		if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+			openAIError(c, http.StatusUnauthorized, "missing api key", "invalid_request_error", "invalid_api_key")
+			return
+		}
+		userID, err := m.authenticateAPIKey(c.Request.Context(), header[7:])
+		if err != nil {
+			if errors.Is(err, errAPIKeyInvalid) {
+				openAIError(c, http.StatusUnauthorized, "invalid api key", "invalid_request_error", "invalid_api_key")
+				return
+			}
+			openAIError(c, http.StatusInternalServerError, "failed to verify api key", "server_error", "internal_error")
+			return
+		}
+		c.Set(apiKeyContextUserID, userID)
+		c.Next()
+	}
+}
+
+// apiKeyUserID 读取中间件写入的用户ID。
+func apiKeyUserID(c *gin.Context) uint64 {
+	if value, ok := c.Get(apiKeyContextUserID); ok {
+		if id, ok := value.(uint64); ok {
+			return id
+		}
+	}
+	return 0
+}
+
+// accessibleAgentsQuery 返回用户可通过接口访问的智能体查询。
+func (m *Module) accessibleAgentsQuery(ctx context.Context, userID uint64) *gorm.DB {
+	return m.db.WithContext(ctx).Model(&agents.Agent{}).Where("status = ? OR created_by = ?", "active", userID)
+}
+
+// resolveAgentModel 将 model 字段解析为智能体，支持 agent-<id>、纯数字ID与智能体名称。
+func (m *Module) resolveAgentModel(ctx context.Context, model string, userID uint64) (agents.Agent, error) {
+	var agent agents.Agent
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return agent, errAgentModelNotFound
+	}
+
+	query := m.accessibleAgentsQuery(ctx, userID)
+	idText := strings.TrimPrefix(strings.ToLower(model), openAIModelPrefix)
+	if id, err := strconv.ParseUint(idText, 10, 64); err == nil && id > 0 {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("LOWER(name) = ?", strings.ToLower(model)).Order("id ASC")
+	}
+
+	if err := query.Take(&agent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return agent, errAgentModelNotFound
+		}
+		return agent, err
+	}
+	return agent, nil
+}
+
+// openAIMessageText 提取字符串或多段文本形式的消息内容。
+func openAIMessageText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+	segments := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "text" && part.Text != "" {
+			segments = append(segments, part.Text)
+		}
+	}
+	return strings.Join(segments, "\n")
+}
+
+// buildAgentAPIContext 组合智能体人设、用户画像与客户端消息，不读取站内会话历史。
+func (m *Module) buildAgentAPIContext(ctx context.Context, agent agents.Agent, userID uint64, input []openAIChatMessage) (*conversationContext, string, error) {
+	var cfg agents.AgentChatConfig
+	var cfgPtr *agents.AgentChatConfig
+	if err := m.db.WithContext(ctx).First(&cfg, "agent_id = ?", agent.ID).Error; err == nil {
+		cfgPtr = &cfg
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", fmt.Errorf("load agent config: %w", err)
+	}
+
+	plan := m.userPlan(ctx, userID)
+	if cfgPtr != nil {
+		cfgPtr.ModelName = m.modelForPlan(plan, cfgPtr.ModelName)
+	}
+
+	var profile *userProfile
+	if m.memory != nil {
+		prof, err := m.memory.loadUserProfile(ctx, agent.ID, userID)
+		if err != nil {
+			return nil, "", fmt.Errorf("load user profile: %w", err)
+		}
+		profile = prof
+	}
+
+	messages := make([]ChatMessage, 0, len(input)+2)
+	if prompt := buildSystemPrompt(&agent, cfgPtr, m.promptVars(ctx, &agent, userID), ""); prompt != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: prompt})
+	}
+	if prompt := profilePrompt(profile); prompt != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: prompt})
+	}
+
+	lastUser := ""
+	for _, item := range input {
+		role := strings.ToLower(strings.TrimSpace(item.Role))
+		if role == "developer" {
+			role = "system"
+		}
+		if role != "user" && role != "assistant" && role != "system" {
+			continue
+		}
+		text := strings.TrimSpace(openAIMessageText(item.Content))
+		if text == "" {
+			continue
+		}
+		messages = append(messages, ChatMessage{Role: role, Content: text})
+		if role == "user" {
+			lastUser = text
+		}
+	}
+
+	return &conversationContext{
+		agent:    agent,
+		config:   cfgPtr,
+		profile:  profile,
+		messages: messages,
+		plan:     plan,
+	}, lastUser, nil
+}
+
+// newCompletionID 生成 OpenAI 风格的补全ID。
+func newCompletionID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	}
+	return "chatcmpl-" + hex.EncodeToString(buf)
+}
+
+// handleOpenAIModels godoc
+// @Summary 列出可用模型（OpenAI 兼容）
+// @Description 以 OpenAI 模型列表格式返回当前密钥可访问的智能体，模型ID形如 agent-<id>
+// @Tags OpenAI
+// @Produce json
+// @Param Authorization header string true "Bearer API 密钥"
+// @Success 200 {object} map[string]interface{} "模型列表"
+// @Failure 401 {object} map[string]interface{} "密钥无效"
+// @Failure 500 {object} map[string]interface{} "服务器错误"
+// @Author bizer
+// handleOpenAIModels 返回可用的智能体模型列表。
+func (m *Module) handleOpenAIModels(c *gin.Context) {
+	userID := apiKeyUserID(c)
+
+	var list []agents.Agent
+	if err := m.accessibleAgentsQuery(c.Request.Context(), userID).Order("id ASC").Find(&list).Error; err != nil {
+		openAIError(c, http.StatusInternalServerError, "failed to load models", "server_error", "internal_error")
+		return
+	}
+
+	data := make([]openAIModel, 0, len(list))
+	for _, agent := range list {
+		data = append(data, openAIModel{
+			ID:      fmt.Sprintf("%s%d", openAIModelPrefix, agent.ID),
+			Object:  "model",
+			Created: agent.CreatedAt.Unix(),
+			OwnedBy: "auralis",
+			Name:    agent.Name,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// handleOpenAIChatCompletions godoc
+// @Summary 对话补全（OpenAI 兼容）
+// @Description 以 OpenAI Chat Completions 协议与智能体对话，model 为 agent-<id> 或智能体名称，支持 stream 流式返回，按用户余额计费；智能体配置了风格硬性规则（禁用语、表情、长度上限）时，流式响应在生成完成并执行规则后一次性返回内容
+// @Tags OpenAI
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer API 密钥"
+// @Param request body openAIChatRequest true "补全请求"
+// @Success 200 {object} openAIChatResponse "补全结果"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "密钥无效"
+// @Failure 402 {object} map[string]interface{} "余额不足"
+// @Failure 404 {object} map[string]interface{} "模型不存在"
+// @Failure 502 {object} map[string]interface{} "上游模型错误"
+// @Author bizer
+// handleOpenAIChatCompletions 处理 OpenAI 兼容的对话补全请求。
+func (m *Module) handleOpenAIChatCompletions(c *gin.Context) {
+	var req openAIChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid request payload", "invalid_request_error", "invalid_request")
+		return
+	}
+	if len(req.Messages) == 0 {
+		openAIError(c, http.StatusBadRequest, "messages cannot be empty", "invalid_request_error", "invalid_request")
+		return
+	}
+	if m.client == nil {
+		openAIError(c, http.StatusServiceUnavailable, "llm client not configured", "server_error", "unavailable")
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := apiKeyUserID(c)
+
+	agent, err := m.resolveAgentModel(ctx, req.Model, userID)
+	if err != nil {
+		if errors.Is(err, errAgentModelNotFound) {
+			openAIError(c, http.StatusNotFound, fmt.Sprintf("model %q does not exist", req.Model), "invalid_request_error", "model_not_found")
+			return
+		}
+		openAIError(c, http.StatusInternalServerError, "failed to load model", "server_error", "internal_error")
+		return
+	}
+
+	balance, err := m.getUserTokenBalance(ctx, userID)
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "failed to load token balance", "server_error", "internal_error")
+		return
+	}
+	if balance <= 0 {
+		openAIError(c, http.StatusPaymentRequired, "insufficient token balance", "insufficient_quota", "insufficient_quota")
+		return
+	}
+
+	contextData, lastUser, err := m.buildAgentAPIContext(ctx, agent, userID, req.Messages)
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "failed to build context", "server_error", "internal_error")
+		return
+	}
+	if lastUser == "" {
+		openAIError(c, http.StatusBadRequest, "at least one user message is required", "invalid_request_error", "invalid_request")
+		return
+	}
+	if _, kErr := m.attachKnowledgeContext(ctx, contextData, agent.ID, lastUser); kErr != nil {
+		log.Printf("llm: knowledge retrieval failed: %v", kErr)
+	}
+
+	modelID := fmt.Sprintf("%s%d", openAIModelPrefix, agent.ID)
+	completionID := newCompletionID()
+	created := time.Now().Unix()
+
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		m.streamOpenAICompletion(c, contextData, userID, balance, completionID, modelID, created, includeUsage)
+		return
+	}
+
+	result, err := m.client.Chat(ctx, contextData.messages, contextData.modelName())
+	if err != nil {
+		log.Printf("llm: api completion for user %d failed: %v", userID, err)
+		openAIError(c, http.StatusBadGateway, openAIUpstreamErrorMessage, "api_error", "upstream_error")
+		return
+	}
+	if result.Usage == nil {
+		result.Usage = estimateChatUsage(contextData.messages, result.Content)
+	}
+	m.chargeAPIUsage(context.WithoutCancel(ctx), userID, result.Usage, balance)
+	reply, _ := applyStyleGuide(contextData.config, result.Content)
+
+	stop := "stop"
+	c.JSON(http.StatusOK, openAIChatResponse{
+		ID:      completionID,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   modelID,
+		Choices: []openAIChoice{{
+			Index:        0,
+			Message:      &openAIChoiceMessage{Role: "assistant", Content: reply},
+			FinishReason: &stop,
+		}},
+		Usage: result.Usage,
+	})
+}
+
+// streamOpenAICompletion 以 OpenAI SSE 格式流式返回补全结果，存在风格硬性规则时缓冲全文、执行规则后再发送。
+func (m *Module) streamOpenAICompletion(c *gin.Context, contextData *conversationContext, userID uint64, balance int64, completionID, modelID string, created int64, includeUsage bool) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		openAIError(c, http.StatusInternalServerError, "streaming not supported", "server_error", "internal_error")
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	send := func(payload any) error {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	chunk := func(delta *openAIChoiceMessage, finish *string) openAIChatResponse {
+		return openAIChatResponse{
+			ID:      completionID,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   modelID,
+			Choices: []openAIChoice{{Index: 0, Delta: delta, FinishReason: finish}},
+		}
+	}
+
+	ctx := c.Request.Context()
+	buffered := parseStyleGuide(contextData.config).HasHardRules()
+	_ = send(chunk(&openAIChoiceMessage{Role: "assistant"}, nil))
+
+	var generated strings.Builder
+	result, err := m.client.ChatStream(ctx, contextData.messages, contextData.modelName(), func(delta ChatStreamDelta) error {
+		if delta.Content == "" {
+			return nil
+		}
+		generated.WriteString(delta.Content)
+		if buffered {
+			return nil
+		}
+		return send(chunk(&openAIChoiceMessage{Content: delta.Content}, nil))
+	})
+	// 客户端断开、上游出错或未返回用量时，按已生成的部分估算扣费。
+	usage := result.Usage
+	if err != nil || usage == nil {
+		usage = estimateChatUsage(contextData.messages, generated.String())
+	}
+	m.chargeAPIUsage(context.WithoutCancel(ctx), userID, usage, balance)
+	if err != nil {
+		log.Printf("llm: api stream for user %d failed: %v", userID, err)
+		_ = send(gin.H{"error": gin.H{"message": openAIUpstreamErrorMessage, "type": "api_error", "code": "upstream_error"}})
+		_, _ = fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+		flusher.Flush()
+		return
+	}
+	if buffered {
+		if reply, _ := applyStyleGuide(contextData.config, result.Content); reply != "" {
+			_ = send(chunk(&openAIChoiceMessage{Content: reply}, nil))
+		}
+	}
+
+	stop := "stop"
+	_ = send(chunk(&openAIChoiceMessage{}, &stop))
+	if includeUsage && usage != nil {
+		_ = send(openAIChatResponse{
+			ID:      completionID,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   modelID,
+			Choices: []openAIChoice{},
+			Usage:   usage,
+		})
+	}
+	_, _ = fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// chargeAPIUsage 将接口调用的 token 消耗计入用户余额。
+func (m *Module) chargeAPIUsage(ctx context.Context, userID uint64, usage *ChatUsage, balance int64) {
+	if usage == nil {
+		return
+	}
+	if _, err := m.applyUsageToUserTokens(ctx, userID, usage, balance); err != nil {
+		log.Printf("llm: apply api token usage failed: %v", err)
+	}
+}
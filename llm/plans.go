@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"auralis_back/authorization"
+)
+
+// userPlan 查询用户所属套餐，查询失败时按免费套餐处理。
+func (m *Module) userPlan(ctx context.Context, userID uint64) authorization.Plan {
+	if m == nil || m.db == nil || userID == 0 {
+		return authorization.LookupPlan(authorization.PlanFree)
+	}
+	plan, err := authorization.UserPlan(ctx, m.db, userID)
+	if err != nil {
+		log.Printf("llm: load plan for user %d failed: %v", userID, err)
+		return authorization.LookupPlan(authorization.PlanFree)
+	}
+	return plan
+}
+
+// isPremiumModel 判断模型在目录中是否标记为高级模型。
+func (m *Module) isPremiumModel(name string) bool {
+	name = strings.TrimSpace(name)
+	if m == nil || name == "" {
+		return false
+	}
+	for _, option := range m.modelCatalog {
+		if strings.EqualFold(option.Name, name) {
+			return option.Premium
+		}
+	}
+	return false
+}
+
+// modelForPlan 返回套餐允许使用的模型，无高级模型权限时回退到默认模型。
+func (m *Module) modelForPlan(plan authorization.Plan, name string) string {
+	name = strings.TrimSpace(name)
+	if plan.PremiumModels || !m.isPremiumModel(name) {
+		return name
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"auralis_back/authorization"
+)
+
+func TestModelForPlan(t *testing.T) {
+	m := &Module{modelCatalog: []ChatModelOption{
+		{Name: "basic-model"},
+		{Name: "Premium-Model", Premium: true},
+	}}
+	free := authorization.LookupPlan(authorization.PlanFree)
+	pro := authorization.LookupPlan(authorization.PlanPro)
+
+	tests := []struct {
+		name  string
+		plan  authorization.Plan
+		model string
+		want  string
+	}{
+		{"free basic", free, "basic-model", "basic-model"},
+		// 无高级模型权限时回退为空，由调用方使用默认模型。
+		{"free premium falls back", free, " premium-model ", ""},
+		{"pro premium", pro, "premium-model", "premium-model"},
+		{"unknown model", free, "custom-model", "custom-model"},
+		{"empty", free, "", ""},
+	}
+	for _, tt := range tests {
+		if got := m.modelForPlan(tt.plan, tt.model); got != tt.want {
+			t.Errorf("%s: modelForPlan = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUserPlan(t *testing.T) {
+	db, err := openDatabase("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, plan TEXT NOT NULL)").Error; err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+	if err := db.Exec("INSERT INTO users (id, plan) VALUES (1, ?), (2, ?)", authorization.PlanPro, "legacy").Error; err != nil {
+		t.Fatalf("seed users: %v", err)
+	}
+	m := &Module{db: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		module *Module
+		userID uint64
+		want   string
+	}{
+		{"stored plan", m, 1, authorization.PlanPro},
+		{"unknown plan code", m, 2, authorization.PlanFree},
+		{"missing user", m, 3, authorization.PlanFree},
+		{"anonymous", m, 0, authorization.PlanFree},
+		{"no database", &Module{}, 1, authorization.PlanFree},
+	}
+	for _, tt := range tests {
+		if got := tt.module.userPlan(ctx, tt.userID); got.Code != tt.want {
+			t.Errorf("%s: plan = %s, want %s", tt.name, got.Code, tt.want)
+		}
+	}
+}
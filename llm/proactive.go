@@ -0,0 +1,981 @@
+package llm
+
+import (
+	"auralis_back/agents"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	scheduledKindReminder = "reminder"
+	scheduledKindCheckin  = "checkin"
+	scheduledKindReengage = "reengage"
+
+	scheduledStatusPending    = "pending"
+	scheduledStatusProcessing = "processing"
+	scheduledStatusSent       = "sent"
+	scheduledStatusSkipped    = "skipped"
+	scheduledStatusFailed     = "failed"
+	scheduledStatusCancelled  = "cancelled"
+
+	defaultProactiveInterval   = 60
+	defaultProactiveBatch      = 20
+	defaultProactiveQuietHours = "22:00-08:00"
+	defaultProactiveTimezone   = "Asia/Shanghai"
+	maxScheduledAttempts       = 3
+	proactiveActiveWindow      = 14 * 24 * time.Hour
+	proactiveCheckinGrace      = 2 * time.Hour
+)
+
+// proactiveScheduler 周期性地生成并投递智能体主动消息。
+type proactiveScheduler struct {
+	module     *Module
+	interval   time.Duration
+	batch      int
+	quietStart int
+	quietEnd   int
+	location   *time.Location
+}
+
+// newProactiveSchedulerFromEnv 基于环境变量创建主动消息调度器，未启用时返回 nil。
+func newProactiveSchedulerFromEnv(module *Module) *proactiveScheduler {
+	if raw := strings.TrimSpace(os.Getenv("LLM_PROACTIVE_ENABLED")); raw != "" {
+		if enabled, err := strconv.ParseBool(raw); err == nil && !enabled {
+			return nil
+		}
+	}
+
+	interval := readIntEnv("LLM_PROACTIVE_INTERVAL_SECONDS", defaultProactiveInterval)
+	if interval < 10 {
+		interval = defaultProactiveInterval
+	}
+	batch := readIntEnv("LLM_PROACTIVE_BATCH_SIZE", defaultProactiveBatch)
+	if batch <= 0 {
+		batch = defaultProactiveBatch
+	}
+
+	quiet := strings.TrimSpace(os.Getenv("LLM_PROACTIVE_QUIET_HOURS"))
+	if quiet == "" {
+		quiet = defaultProactiveQuietHours
+	}
+	quietStart, quietEnd, ok := parseQuietHours(quiet)
+	if !ok {
+		log.Printf("llm: invalid LLM_PROACTIVE_QUIET_HOURS %q, using %s", quiet, defaultProactiveQuietHours)
+		quietStart, quietEnd, _ = parseQuietHours(defaultProactiveQuietHours)
+	}
+
+	return &proactiveScheduler{
+		module:     module,
+		interval:   time.Duration(interval) * time.Second,
+		batch:      batch,
+		quietStart: quietStart,
+		quietEnd:   quietEnd,
+		location:   loadLocationOrDefault(os.Getenv("LLM_PROACTIVE_TIMEZONE")),
+	}
+}
+
+// start 在后台循环执行调度。
+func (s *proactiveScheduler) start() {
+	if s == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.tick()
+		}
+	}()
+}
+
+// tick 执行一轮主动消息规划与投递。
+func (s *proactiveScheduler) tick() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval*5)
+	defer cancel()
+
+	now := time.Now().UTC()
+	if err := s.reclaimStale(ctx, now); err != nil {
+		log.Printf("llm: reclaim stale scheduled messages failed: %v", err)
+	}
+	if err := s.planCheckins(ctx, now); err != nil {
+		log.Printf("llm: plan daily check-ins failed: %v", err)
+	}
+	if err := s.planReengagement(ctx, now); err != nil {
+		log.Printf("llm: plan re-engagement failed: %v", err)
+	}
+
+	var due []scheduledMessage
+	if err := s.module.db.WithContext(ctx).
+		Where("status = ? AND due_at <= ?", scheduledStatusPending, now).
+		Order("due_at ASC").
+		Limit(s.batch).
+		Find(&due).Error; err != nil {
+		log.Printf("llm: load due scheduled messages failed: %v", err)
+		return
+	}
+	for _, item := range due {
+		s.dispatch(ctx, item)
+	}
+}
+
+// reclaimStale 回收进程崩溃或超时后遗留在 processing 状态的任务。
+func (s *proactiveScheduler) reclaimStale(ctx context.Context, now time.Time) error {
+	// 单轮 tick 的上下文最长为 interval*5，超过两倍仍未结束的任务视为已被遗弃。
+	cutoff := now.Add(-s.interval * 10)
+	reason := "processing timed out"
+	if err := s.module.db.WithContext(ctx).Model(&scheduledMessage{}).
+		Where("status = ? AND updated_at < ? AND attempts >= ?", scheduledStatusProcessing, cutoff, maxScheduledAttempts).
+		Updates(map[string]any{"status": scheduledStatusFailed, "last_error": reason}).Error; err != nil {
+		return err
+	}
+	res := s.module.db.WithContext(ctx).Model(&scheduledMessage{}).
+		Where("status = ? AND updated_at < ?", scheduledStatusProcessing, cutoff).
+		Updates(map[string]any{"status": scheduledStatusPending, "due_at": now, "last_error": reason})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("llm: reclaimed %d stale scheduled messages", res.RowsAffected)
+	}
+	return nil
+}
+
+// planCheckins 为活跃会话生成当日的问候任务。
+func (s *proactiveScheduler) planCheckins(ctx context.Context, now time.Time) error {
+	var configs []agents.AgentProactiveConfig
+	if err := s.module.db.WithContext(ctx).Where("checkin_enabled = ?", true).Find(&configs).Error; err != nil {
+		return err
+	}
+	for _, cfg := range configs {
+		loc := loadLocationOrDefault(cfg.Timezone)
+		clock, err := time.Parse("15:04", strings.TrimSpace(cfg.CheckinTime))
+		if err != nil {
+			continue
+		}
+		local := now.In(loc)
+		dueLocal := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		if now.Before(dueLocal) || now.Sub(dueLocal) > proactiveCheckinGrace {
+			continue
+		}
+		due := dueLocal.UTC()
+
+		// 活跃窗口以用户最后一次发言为准，主动消息本身会刷新 last_msg_at，不能作为活跃依据。
+		var convs []conversation
+		if err := s.module.db.WithContext(ctx).
+			Where("agent_id = ? AND status = ?", cfg.AgentID, "active").
+			Where("EXISTS (SELECT 1 FROM messages WHERE messages.conversation_id = conversations.id AND messages.role = ? AND messages.created_at >= ?)", "user", now.Add(-proactiveActiveWindow)).
+			Find(&convs).Error; err != nil {
+			return err
+		}
+		for _, conv := range convs {
+			if err := s.module.scheduleOnce(ctx, conv.AgentID, conv.UserID, scheduledKindCheckin, due, nil, due); err != nil {
+				log.Printf("llm: schedule check-in failed: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// planReengagement 为长时间未互动的会话生成召回任务。
+func (s *proactiveScheduler) planReengagement(ctx context.Context, now time.Time) error {
+	var configs []agents.AgentProactiveConfig
+	if err := s.module.db.WithContext(ctx).Where("reengage_enabled = ?", true).Find(&configs).Error; err != nil {
+		return err
+	}
+	for _, cfg := range configs {
+		hours := cfg.ReengageAfterHours
+		if hours <= 0 {
+			continue
+		}
+		cutoff := now.Add(-time.Duration(hours) * time.Hour)
+
+		var convs []conversation
+		if err := s.module.db.WithContext(ctx).
+			Where("agent_id = ? AND status = ? AND last_msg_at < ? AND last_msg_at >= ?", cfg.AgentID, "active", cutoff, now.Add(-2*proactiveActiveWindow)).
+			Where("last_proactive_at IS NULL OR last_proactive_at < last_msg_at").
+			Find(&convs).Error; err != nil {
+			return err
+		}
+		for _, conv := range convs {
+			if err := s.module.scheduleOnce(ctx, conv.AgentID, conv.UserID, scheduledKindReengage, now, nil, conv.LastMsgAt); err != nil {
+				log.Printf("llm: schedule re-engagement failed: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// scheduleOnce 在指定时间点之后不存在同类任务时创建新的主动消息任务。
+func (m *Module) scheduleOnce(ctx context.Context, agentID, userID uint64, kind string, due time.Time, note *string, since time.Time) error {
+	var count int64
+	if err := m.db.WithContext(ctx).
+		Model(&scheduledMessage{}).
+		Where("agent_id = ? AND user_id = ? AND kind = ? AND (status = ? OR due_at >= ?)", agentID, userID, kind, scheduledStatusPending, since).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	item := scheduledMessage{
+		AgentID: agentID,
+		UserID:  userID,
+		Kind:    kind,
+		Note:    note,
+		DueAt:   due,
+		Status:  scheduledStatusPending,
+	}
+	return m.db.WithContext(ctx).Create(&item).Error
+}
+
+// dispatch 认领并投递单个主动消息任务。
+func (s *proactiveScheduler) dispatch(ctx context.Context, item scheduledMessage) {
+	m := s.module
+	res := m.db.WithContext(ctx).
+		Model(&scheduledMessage{}).
+		Where("id = ? AND status = ?", item.ID, scheduledStatusPending).
+		Updates(map[string]any{"status": scheduledStatusProcessing, "attempts": gorm.Expr("attempts + 1")})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+	item.Attempts++
+
+	profile := &userProfile{Preferences: map[string]any{}}
+	if m.memory != nil {
+		if loaded, err := m.memory.loadUserProfile(ctx, item.AgentID, item.UserID); err == nil {
+			profile = loaded
+		}
+	}
+
+	if item.Kind != scheduledKindReminder {
+		if enabled, ok := profile.Preferences["proactive_enabled"].(bool); ok && !enabled {
+			s.finish(ctx, item.ID, scheduledStatusSkipped, "user disabled proactive messages", nil)
+			return
+		}
+		if next, quiet := s.quietUntil(profile, time.Now().UTC()); quiet {
+			if err := m.db.WithContext(ctx).Model(&scheduledMessage{}).Where("id = ?", item.ID).Updates(map[string]any{
+				"status":   scheduledStatusPending,
+				"due_at":   next,
+				"attempts": gorm.Expr("attempts - 1"),
+			}).Error; err != nil {
+				log.Printf("llm: defer scheduled message for quiet hours failed: %v", err)
+			}
+			return
+		}
+	}
+
+	balance, err := m.getUserTokenBalance(ctx, item.UserID)
+	if err != nil {
+		s.retryOrFail(ctx, item, err)
+		return
+	}
+	if balance <= 0 {
+		s.finish(ctx, item.ID, scheduledStatusSkipped, "insufficient token balance", nil)
+		return
+	}
+
+	msgID, err := m.deliverProactiveMessage(ctx, item, balance)
+	if err != nil {
+		s.retryOrFail(ctx, item, err)
+		return
+	}
+	s.finish(ctx, item.ID, scheduledStatusSent, "", &msgID)
+}
+
+// retryOrFail 在失败时按次数重试或标记失败。
+func (s *proactiveScheduler) retryOrFail(ctx context.Context, item scheduledMessage, cause error) {
+	log.Printf("llm: deliver scheduled message %d failed: %v", item.ID, cause)
+	if item.Attempts >= maxScheduledAttempts {
+		s.finish(ctx, item.ID, scheduledStatusFailed, cause.Error(), nil)
+		return
+	}
+	short := truncateString(cause.Error(), 500)
+	if err := s.module.db.WithContext(ctx).Model(&scheduledMessage{}).Where("id = ?", item.ID).Updates(map[string]any{
+		"status":     scheduledStatusPending,
+		"due_at":     time.Now().UTC().Add(5 * time.Minute),
+		"last_error": short,
+	}).Error; err != nil {
+		log.Printf("llm: reschedule message failed: %v", err)
+	}
+}
+
+// finish 更新任务的最终状态。
+func (s *proactiveScheduler) finish(ctx context.Context, id uint64, status, reason string, msgID *uint64) {
+	updates := map[string]any{"status": status}
+	if reason != "" {
+		updates["last_error"] = truncateString(reason, 500)
+	}
+	if msgID != nil {
+		updates["sent_message_id"] = *msgID
+		updates["sent_at"] = time.Now().UTC()
+	}
+	if err := s.module.db.WithContext(ctx).Model(&scheduledMessage{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		log.Printf("llm: update scheduled message status failed: %v", err)
+	}
+}
+
+// quietUntil 判断当前是否处于用户免打扰时段，并返回结束时间。
+func (s *proactiveScheduler) quietUntil(profile *userProfile, now time.Time) (time.Time, bool) {
+	start, end := s.quietStart, s.quietEnd
+	loc := s.location
+	if profile != nil {
+		if raw := getPreferenceString(profile.Preferences, "timezone"); raw != "" {
+			loc = loadLocationOrDefault(raw)
+		}
+		startRaw := getPreferenceString(profile.Preferences, "quiet_hours_start")
+		endRaw := getPreferenceString(profile.Preferences, "quiet_hours_end")
+		if startRaw != "" && endRaw != "" {
+			if qs, qe, ok := parseQuietHours(startRaw + "-" + endRaw); ok {
+				start, end = qs, qe
+			}
+		}
+	}
+	if start == end {
+		return time.Time{}, false
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	inQuiet := false
+	if start < end {
+		inQuiet = minute >= start && minute < end
+	} else {
+		inQuiet = minute >= start || minute < end
+	}
+	if !inQuiet {
+		return time.Time{}, false
+	}
+
+	next := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next.UTC(), true
+}
+
+// deliverProactiveMessage 以智能体身份生成主动消息并写入会话。
+func (m *Module) deliverProactiveMessage(ctx context.Context, item scheduledMessage, balance int64) (uint64, error) {
+	if m.client == nil {
+		return 0, errors.New("llm client not configured")
+	}
+
+	conv, err := m.findOrCreateConversation(ctx, item.AgentID, item.UserID, channelWeb)
+	if err != nil {
+		return 0, err
+	}
+
+	contextData, err := m.buildConversationContext(ctx, conv)
+	if err != nil {
+		return 0, err
+	}
+	modelName := contextData.modelName()
+
+	var cfg agents.AgentProactiveConfig
+	if err := m.db.WithContext(ctx).Where("agent_id = ?", item.AgentID).Take(&cfg).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+	contextData.messages = append(contextData.messages, ChatMessage{Role: "system", Content: proactiveInstruction(item, &cfg)})
+
+	prefs := speechPreferences{Speed: 1.0, Pitch: 1.0}
+	applyPreferenceDefaults(&prefs, contextData)
+
+	plan := m.planTranslation(conv, contextData, "")
+
+	start := time.Now()
+	result, err := m.client.Chat(ctx, contextData.messages, modelName)
+	if err != nil {
+		return 0, err
+	}
+	reply := strings.TrimSpace(result.Content)
+	if reply == "" {
+		return 0, errors.New("assistant reply empty")
+	}
+	reply, styleApplied := applyStyleGuide(contextData.config, reply)
+	reply, usage, translationMeta := m.applyTranslation(ctx, plan, reply, modelName, result.Usage)
+	latency := int(time.Since(start).Milliseconds())
+
+	selection := resolveVoiceSelection(prefs.VoiceID, prefs.Provider, m.tts)
+	if plan != nil {
+		selection = voiceForLanguage(m.tts, selection, plan.Target)
+	}
+	speed := sanitizeSpeed(prefs.Speed)
+	pitch := sanitizePitch(prefs.Pitch)
+	emotionMeta := contextData.motions.annotate(inferEmotion(reply, prefs.EmotionHint))
+	timeline := buildEmotionTimeline(reply, prefs.EmotionHint, speed, contextData.motions)
+	m.refineEmotionTimeline(ctx, timeline, modelName, contextData.motions)
+
+	extras := map[string]any{
+		"proactive": map[string]any{
+			"kind":        item.Kind,
+			"schedule_id": item.ID,
+		},
+	}
+	extras["generation"] = m.generationExtras(contextData)
+	if len(styleApplied) > 0 {
+		extras["style_enforced"] = styleApplied
+	}
+	if translationMeta != nil {
+		extras["translation"] = translationMeta
+	}
+	if emotionMeta != nil {
+		extras["emotion"] = emotionMeta
+	}
+	if timeline != nil {
+		extras["emotion_timeline"] = timeline
+	}
+	if selection.ID != "" || speed != 1.0 || pitch != 1.0 {
+		prefsMap := map[string]any{"voice_id": selection.ID, "speed": speed, "pitch": pitch}
+		if selection.Provider != "" {
+			prefsMap["provider"] = selection.Provider
+		}
+		extras["speech_preferences"] = prefsMap
+	}
+	speechEnabled := m.tts != nil && m.tts.Enabled()
+	if speechEnabled {
+		extras["speech_status"] = "pending"
+	}
+
+	assistant := message{
+		ConversationID: conv.ID,
+		Role:           "assistant",
+		Format:         "text",
+		Content:        reply,
+	}
+	if latency > 0 {
+		assistant.LatencyMs = &latency
+	}
+	if usage != nil {
+		assistant.TokenInput = intPointerIfPositive(usage.PromptTokens)
+		assistant.TokenOutput = intPointerIfPositive(usage.CompletionTokens)
+	}
+	if raw, marshalErr := json.Marshal(extras); marshalErr != nil {
+		log.Printf("llm: marshal proactive extras: %v", marshalErr)
+	} else {
+		assistant.Extras = datatypes.JSON(raw)
+	}
+
+	if err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var lastSeq int
+		if err := tx.Model(&message{}).Where("conversation_id = ?", conv.ID).Select("COALESCE(MAX(seq), 0)").Scan(&lastSeq).Error; err != nil {
+			return err
+		}
+		assistant.Seq = lastSeq + 1
+		if err := tx.Create(&assistant).Error; err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		return tx.Model(&conversation{}).Where("id = ?", conv.ID).Updates(map[string]any{
+			"last_msg_at":       now,
+			"last_proactive_at": now,
+			"unread_count":      gorm.Expr("unread_count + 1"),
+		}).Error
+	}); err != nil {
+		return 0, err
+	}
+
+	if usage != nil {
+		m.incrementConversationTokens(ctx, conv.ID, usage)
+		if _, err := m.applyUsageToUserTokens(ctx, conv.UserID, usage, balance); err != nil {
+			log.Printf("llm: apply proactive token usage failed: %v", err)
+		}
+	}
+
+	if speechEnabled {
+		m.enqueueSpeechSynthesis(assistant.ID, conv, reply, selection, speed, pitch, emotionMeta)
+	}
+	m.invalidateRecentMessagesCache(ctx, conv.AgentID, conv.UserID)
+	m.forwardToChannels(ctx, conv, assistant.ID, reply)
+
+	return assistant.ID, nil
+}
+
+// proactiveInstruction 根据任务类型构造主动发言的系统指令。
+func proactiveInstruction(item scheduledMessage, cfg *agents.AgentProactiveConfig) string {
+	switch item.Kind {
+	case scheduledKindReminder:
+		note := ""
+		if item.Note != nil {
+			note = strings.TrimSpace(*item.Note)
+		}
+		return fmt.Sprintf("The user earlier asked you to remind them about: %q. It is now time. Start the conversation yourself and deliver this reminder in character, briefly and warmly.", note)
+	case scheduledKindCheckin:
+		if cfg != nil && cfg.CheckinPrompt != nil && strings.TrimSpace(*cfg.CheckinPrompt) != "" {
+			return "Start the conversation yourself with a daily check-in. " + strings.TrimSpace(*cfg.CheckinPrompt)
+		}
+		return "Start the conversation yourself with a short, friendly daily check-in that fits your persona and what you know about the user."
+	default:
+		if cfg != nil && cfg.ReengagePrompt != nil && strings.TrimSpace(*cfg.ReengagePrompt) != "" {
+			return "The user has not talked with you for a while. Start the conversation yourself. " + strings.TrimSpace(*cfg.ReengagePrompt)
+		}
+		return "The user has not talked with you for a while. Start the conversation yourself with a short, natural message that invites them back, referring to something from your past conversations if possible."
+	}
+}
+
+// findOrCreateConversation 查找或创建用户与智能体之间的会话。
+func (m *Module) findOrCreateConversation(ctx context.Context, agentID, userID uint64, channel string) (conversation, error) {
+	var conv conversation
+	err := m.db.WithContext(ctx).Where("agent_id = ? AND user_id = ?", agentID, userID).Take(&conv).Error
+	if err == nil {
+		return conv, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return conv, err
+	}
+	now := time.Now().UTC()
+	conv = conversation{
+		AgentID:   agentID,
+		UserID:    userID,
+		Channel:   channel,
+		Status:    "active",
+		StartedAt: now,
+		LastMsgAt: now,
+	}
+	if err := m.db.WithContext(ctx).Create(&conv).Error; err != nil {
+		return conv, err
+	}
+	return conv, nil
+}
+
+// captureReminderRequest 从用户消息中识别提醒请求并创建定时任务。
+func (m *Module) captureReminderRequest(ctx context.Context, agentID, userID uint64, content string) *scheduledMessage {
+	loc := defaultProactiveLocation()
+	if m.memory != nil {
+		if profile, err := m.memory.loadUserProfile(ctx, agentID, userID); err == nil {
+			if raw := getPreferenceString(profile.Preferences, "timezone"); raw != "" {
+				loc = loadLocationOrDefault(raw)
+			}
+		}
+	}
+
+	intent, ok := parseReminderRequest(content, time.Now().In(loc))
+	if !ok {
+		return nil
+	}
+
+	note := intent.Note
+	item := scheduledMessage{
+		AgentID: agentID,
+		UserID:  userID,
+		Kind:    scheduledKindReminder,
+		Note:    &note,
+		DueAt:   intent.DueAt.UTC(),
+		Status:  scheduledStatusPending,
+	}
+	if err := m.db.WithContext(ctx).Create(&item).Error; err != nil {
+		log.Printf("llm: create reminder failed: %v", err)
+		return nil
+	}
+	return &item
+}
+
+// markConversationRead 清零会话的未读计数。
+func (m *Module) markConversationRead(ctx context.Context, agentID, userID uint64) error {
+	return m.db.WithContext(ctx).
+		Model(&conversation{}).
+		Where("agent_id = ? AND user_id = ? AND unread_count > 0", agentID, userID).
+		Update("unread_count", 0).Error
+}
+
+// parseQuietHours 解析 "22:00-08:00" 形式的免打扰时段，返回起止分钟数。
+func parseQuietHours(value string) (int, int, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, false
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), true
+}
+
+// loadLocationOrDefault 加载时区，失败时回退到默认时区。
+func loadLocationOrDefault(name string) *time.Location {
+	name = strings.TrimSpace(name)
+	if name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return defaultProactiveLocation()
+}
+
+// defaultProactiveLocation 返回主动消息使用的默认时区。
+func defaultProactiveLocation() *time.Location {
+	name := strings.TrimSpace(os.Getenv("LLM_PROACTIVE_TIMEZONE"))
+	if name == "" {
+		name = defaultProactiveTimezone
+	}
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+type scheduledMessageRecord struct {
+	ID            uint64     `json:"id"`
+	AgentID       uint64     `json:"agent_id"`
+	UserID        uint64     `json:"user_id"`
+	Kind          string     `json:"kind"`
+	Note          *string    `json:"note,omitempty"`
+	DueAt         time.Time  `json:"due_at"`
+	Status        string     `json:"status"`
+	SentMessageID *uint64    `json:"sent_message_id,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// scheduledToRecord 将任务模型转换为响应结构。
+func scheduledToRecord(item scheduledMessage) scheduledMessageRecord {
+	return scheduledMessageRecord{
+		ID:            item.ID,
+		AgentID:       item.AgentID,
+		UserID:        item.UserID,
+		Kind:          item.Kind,
+		Note:          item.Note,
+		DueAt:         item.DueAt,
+		Status:        item.Status,
+		SentMessageID: item.SentMessageID,
+		SentAt:        item.SentAt,
+		CreatedAt:     item.CreatedAt,
+	}
+}
+
+// registerProactiveRoutes 注册主动消息、提醒与未读计数相关路由。
+func (m *Module) registerProactiveRoutes(group *gin.RouterGroup) {
+	group.GET("/unread", m.handleUnreadCounts)
+	group.POST("/messages/read", m.handleMarkRead)
+	group.GET("/reminders", m.handleListReminders)
+	group.POST("/reminders", m.handleCreateReminder)
+	group.DELETE("/reminders/:id", m.handleCancelReminder)
+	group.PUT("/proactive/preferences", m.handleUpdateProactivePreferences)
+}
+
+// handleUnreadCounts godoc
+// @Summary 查询未读消息数
+// @Description 返回用户在各智能体会话中的未读主动消息数量
+// @Tags LLM
+// @Produce json
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "未读统计"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleUnreadCounts 返回用户的未读消息统计。
+func (m *Module) handleUnreadCounts(c *gin.Context) {
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	var rows []struct {
+		ID          uint64
+		AgentID     uint64
+		UnreadCount int
+		LastMsgAt   time.Time
+	}
+	if err := m.db.WithContext(c.Request.Context()).
+		Model(&conversation{}).
+		Select("id, agent_id, unread_count, last_msg_at").
+		Where("user_id = ? AND unread_count > 0", userID).
+		Order("last_msg_at DESC").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load unread counts", "details": err.Error()})
+		return
+	}
+
+	total := 0
+	items := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		total += row.UnreadCount
+		items = append(items, gin.H{
+			"conversation_id": row.ID,
+			"agent_id":        row.AgentID,
+			"unread":          row.UnreadCount,
+			"last_msg_at":     row.LastMsgAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "total": total, "conversations": items})
+}
+
+type markReadRequest struct {
+	AgentID string `json:"agent_id" binding:"required"`
+	UserID  string `json:"user_id"`
+}
+
+// handleMarkRead godoc
+// @Summary 标记会话已读
+// @Description 清零指定用户与智能体会话的未读计数
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param request body markReadRequest true "会话信息"
+// @Success 200 {object} map[string]interface{} "操作结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleMarkRead 将会话标记为已读。
+func (m *Module) handleMarkRead(c *gin.Context) {
+	var req markReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	agentID, err := parsePositiveUint(req.AgentID, "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	if err := m.markConversationRead(c.Request.Context(), agentID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark conversation read", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"agent_id": agentID, "user_id": userID, "unread": 0})
+}
+
+// handleListReminders godoc
+// @Summary 查询提醒与主动消息任务
+// @Description 返回用户在指定智能体下的待发送与历史主动消息任务
+// @Tags LLM
+// @Produce json
+// @Param agent_id query int true "智能体ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "任务列表"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleListReminders 返回用户的主动消息任务列表。
+func (m *Module) handleListReminders(c *gin.Context) {
+	agentID, err := parsePositiveUint(c.Query("agent_id"), "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	var items []scheduledMessage
+	if err := m.db.WithContext(c.Request.Context()).
+		Where("agent_id = ? AND user_id = ?", agentID, userID).
+		Order("due_at DESC").
+		Limit(50).
+		Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load reminders", "details": err.Error()})
+		return
+	}
+
+	records := make([]scheduledMessageRecord, 0, len(items))
+	for _, item := range items {
+		records = append(records, scheduledToRecord(item))
+	}
+	c.JSON(http.StatusOK, gin.H{"reminders": records})
+}
+
+type createReminderRequest struct {
+	AgentID string `json:"agent_id" binding:"required"`
+	UserID  string `json:"user_id"`
+	DueAt   string `json:"due_at" binding:"required"`
+	Note    string `json:"note" binding:"required"`
+}
+
+// handleCreateReminder godoc
+// @Summary 创建提醒
+// @Description 在指定时间由智能体主动发送提醒消息，due_at 使用 RFC3339 格式
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param request body createReminderRequest true "提醒内容"
+// @Success 201 {object} map[string]interface{} "提醒任务"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleCreateReminder 创建一个定时提醒。
+func (m *Module) handleCreateReminder(c *gin.Context) {
+	var req createReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	agentID, err := parsePositiveUint(req.AgentID, "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+	dueAt, err := time.Parse(time.RFC3339, strings.TrimSpace(req.DueAt))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "due_at must be RFC3339"})
+		return
+	}
+	if !dueAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "due_at must be in the future"})
+		return
+	}
+	note := truncateString(strings.TrimSpace(req.Note), 500)
+	if note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "note cannot be empty"})
+		return
+	}
+
+	item := scheduledMessage{
+		AgentID: agentID,
+		UserID:  userID,
+		Kind:    scheduledKindReminder,
+		Note:    &note,
+		DueAt:   dueAt.UTC(),
+		Status:  scheduledStatusPending,
+	}
+	if err := m.db.WithContext(c.Request.Context()).Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reminder", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"reminder": scheduledToRecord(item)})
+}
+
+// handleCancelReminder godoc
+// @Summary 取消提醒
+// @Description 取消尚未发送的主动消息任务
+// @Tags LLM
+// @Produce json
+// @Param id path int true "任务ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "操作结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 404 {object} map[string]string "未找到"
+// @Author bizer
+// handleCancelReminder 取消待发送的主动消息任务。
+func (m *Module) handleCancelReminder(c *gin.Context) {
+	id, err := parsePositiveUint(c.Param("id"), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	res := m.db.WithContext(c.Request.Context()).
+		Model(&scheduledMessage{}).
+		Where("id = ? AND user_id = ? AND status = ?", id, userID, scheduledStatusPending).
+		Update("status", scheduledStatusCancelled)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel reminder", "details": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pending reminder not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "status": scheduledStatusCancelled})
+}
+
+type proactivePreferencesRequest struct {
+	AgentID          string  `json:"agent_id" binding:"required"`
+	UserID           string  `json:"user_id"`
+	ProactiveEnabled *bool   `json:"proactive_enabled"`
+	QuietHoursStart  *string `json:"quiet_hours_start"`
+	QuietHoursEnd    *string `json:"quiet_hours_end"`
+	Timezone         *string `json:"timezone"`
+}
+
+// handleUpdateProactivePreferences godoc
+// @Summary 更新主动消息偏好
+// @Description 设置用户对某个智能体的主动消息开关、免打扰时段与时区
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param request body proactivePreferencesRequest true "偏好设置"
+// @Success 200 {object} map[string]interface{} "更新结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleUpdateProactivePreferences 更新用户的主动消息偏好。
+func (m *Module) handleUpdateProactivePreferences(c *gin.Context) {
+	var req proactivePreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	agentID, err := parsePositiveUint(req.AgentID, "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	payload := make(map[string]any)
+	if req.ProactiveEnabled != nil {
+		payload["proactive_enabled"] = *req.ProactiveEnabled
+	}
+	if req.QuietHoursStart != nil || req.QuietHoursEnd != nil {
+		if req.QuietHoursStart == nil || req.QuietHoursEnd == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quiet_hours_start and quiet_hours_end must be set together"})
+			return
+		}
+		start := strings.TrimSpace(*req.QuietHoursStart)
+		end := strings.TrimSpace(*req.QuietHoursEnd)
+		if _, _, ok := parseQuietHours(start + "-" + end); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quiet hours must be in HH:MM format"})
+			return
+		}
+		payload["quiet_hours_start"] = start
+		payload["quiet_hours_end"] = end
+	}
+	if req.Timezone != nil {
+		tz := strings.TrimSpace(*req.Timezone)
+		if _, err := time.LoadLocation(tz); err != nil || tz == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timezone"})
+			return
+		}
+		payload["timezone"] = tz
+	}
+	if len(payload) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no preferences provided"})
+		return
+	}
+	if m.memory == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "memory store not initialized"})
+		return
+	}
+
+	if err := m.memory.upsertPreferences(c.Request.Context(), agentID, userID, payload); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save preferences", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"agent_id": agentID, "user_id": userID, "preferences": payload})
+}
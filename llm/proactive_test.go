@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"auralis_back/agents"
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newProactiveTestScheduler 基于内存 SQLite 创建调度器。
+func newProactiveTestScheduler(t *testing.T) *proactiveScheduler {
+	t.Helper()
+	db, err := openDatabase("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	// 内存库按连接隔离，限制为单连接保证各查询看到同一份数据。
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&message{}, &scheduledMessage{}, &agents.AgentProactiveConfig{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// conversations 的 ENUM 列 SQLite 无法解析，这里手工建表。
+	if err := db.Exec(`CREATE TABLE conversations (
+		id integer PRIMARY KEY AUTOINCREMENT, agent_id integer, user_id integer, title text, summary text, lang text,
+		channel text NOT NULL DEFAULT 'web', status text NOT NULL DEFAULT 'active', retention_days integer,
+		token_input_sum integer DEFAULT 0, token_output_sum integer DEFAULT 0, summary_updated_at datetime,
+		unread_count integer NOT NULL DEFAULT 0, last_proactive_at datetime, translation_mode numeric NOT NULL DEFAULT false,
+		translation_lang text, started_at datetime, last_msg_at datetime, created_at datetime, updated_at datetime)`).Error; err != nil {
+		t.Fatalf("create conversations: %v", err)
+	}
+	return &proactiveScheduler{module: &Module{db: db}, interval: time.Minute, batch: 10}
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value any) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
+
+func TestPlanCheckinsUsesLastUserMessage(t *testing.T) {
+	s := newProactiveTestScheduler(t)
+	db := s.module.db
+	now := time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC)
+
+	mustCreate(t, db, &agents.AgentProactiveConfig{AgentID: 1, CheckinEnabled: true, CheckinTime: "09:00", Timezone: "UTC"})
+
+	recent := conversation{AgentID: 1, UserID: 10, Status: "active", StartedAt: now.AddDate(0, 0, -30), LastMsgAt: now.AddDate(0, 0, -3)}
+	mustCreate(t, db, &recent)
+	mustCreate(t, db, &message{ConversationID: recent.ID, Seq: 1, Role: "user", Content: "hi", CreatedAt: now.AddDate(0, 0, -3)})
+
+	// 用户一个月未发言，仅靠主动消息刷新了 last_msg_at。
+	idle := conversation{AgentID: 1, UserID: 20, Status: "active", StartedAt: now.AddDate(0, 0, -40), LastMsgAt: now.AddDate(0, 0, -1)}
+	mustCreate(t, db, &idle)
+	mustCreate(t, db, &message{ConversationID: idle.ID, Seq: 1, Role: "user", Content: "hi", CreatedAt: now.AddDate(0, 0, -30)})
+	mustCreate(t, db, &message{ConversationID: idle.ID, Seq: 2, Role: "assistant", Content: "good morning", CreatedAt: now.AddDate(0, 0, -1)})
+
+	if err := s.planCheckins(context.Background(), now); err != nil {
+		t.Fatalf("planCheckins: %v", err)
+	}
+
+	var items []scheduledMessage
+	if err := db.Find(&items).Error; err != nil {
+		t.Fatalf("load scheduled: %v", err)
+	}
+	if len(items) != 1 || items[0].UserID != 10 || items[0].Kind != scheduledKindCheckin {
+		t.Fatalf("scheduled = %+v, want one check-in for user 10", items)
+	}
+}
+
+func TestReclaimStaleProcessing(t *testing.T) {
+	s := newProactiveTestScheduler(t)
+	db := s.module.db
+	now := time.Now().UTC()
+	stale := now.Add(-time.Hour)
+
+	retry := scheduledMessage{AgentID: 1, UserID: 1, Kind: scheduledKindReminder, DueAt: stale, Status: scheduledStatusProcessing, Attempts: 1, UpdatedAt: stale}
+	exhausted := scheduledMessage{AgentID: 1, UserID: 2, Kind: scheduledKindReminder, DueAt: stale, Status: scheduledStatusProcessing, Attempts: maxScheduledAttempts, UpdatedAt: stale}
+	active := scheduledMessage{AgentID: 1, UserID: 3, Kind: scheduledKindReminder, DueAt: now, Status: scheduledStatusProcessing, Attempts: 1, UpdatedAt: now}
+	for _, item := range []*scheduledMessage{&retry, &exhausted, &active} {
+		mustCreate(t, db, item)
+	}
+
+	if err := s.reclaimStale(context.Background(), now); err != nil {
+		t.Fatalf("reclaimStale: %v", err)
+	}
+
+	want := map[uint64]string{
+		retry.ID:     scheduledStatusPending,
+		exhausted.ID: scheduledStatusFailed,
+		active.ID:    scheduledStatusProcessing,
+	}
+	for id, status := range want {
+		var item scheduledMessage
+		if err := db.First(&item, id).Error; err != nil {
+			t.Fatalf("load %d: %v", id, err)
+		}
+		if item.Status != status {
+			t.Errorf("item %d status = %q, want %q", id, item.Status, status)
+		}
+	}
+}
@@ -0,0 +1,971 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"auralis_back/agents"
+	"auralis_back/asr"
+	"auralis_back/tts"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	realtimeUtteranceQueue   = 4
+	realtimeSpeechQueue      = 64
+	realtimePlaybackPoll     = 100 * time.Millisecond
+	realtimeVoiceInstruction = "You are talking with the user in a real-time voice call. Your reply is spoken aloud: keep it short and conversational, " +
+		"use plain sentences, and avoid markdown, lists, code blocks, links and emoji."
+)
+
+// registerRealtimeVoiceRoutes 注册实时语音对话路由。
+func (m *Module) registerRealtimeVoiceRoutes(group *gin.RouterGroup) {
+	group.GET("/voice/realtime", m.limiter.Handler(messageRateLimit), m.handleRealtimeVoice)
+}
+
+// realtimeConn 串行化 WebSocket 写操作，供读循环、对话与语音协程共享。
+type realtimeConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+// sendJSON 发送 JSON 事件。
+func (r *realtimeConn) sendJSON(payload gin.H) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := r.conn.WriteJSON(payload); err != nil {
+		log.Printf("llm: realtime voice write failed: %v", err)
+		return false
+	}
+	return true
+}
+
+// sendAudio 以二进制帧发送音频数据。
+func (r *realtimeConn) sendAudio(audio []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := r.conn.WriteMessage(websocket.BinaryMessage, audio); err != nil {
+		log.Printf("llm: realtime voice audio write failed: %v", err)
+		return false
+	}
+	return true
+}
+
+// realtimeControl 表示实时语音会话中的客户端控制消息。
+type realtimeControl struct {
+	Type     string `json:"type"`
+	PlayedMs *int   `json:"played_ms"`
+}
+
+// realtimeSession 保存一次实时语音连接的状态。
+type realtimeSession struct {
+	m          *Module
+	conn       *realtimeConn
+	agentID    uint64
+	userID     uint64
+	sampleRate int
+	language   string
+	prefs      speechPreferences
+
+	mu         sync.Mutex
+	turnCancel context.CancelFunc
+	turnMsgID  uint64
+	playedMs   int
+	reported   bool
+}
+
+// beginTurn 开始一轮回复，返回可被打断的上下文。
+func (s *realtimeSession) beginTurn(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	s.mu.Lock()
+	s.turnCancel = cancel
+	s.turnMsgID = 0
+	s.playedMs = 0
+	s.reported = false
+	s.mu.Unlock()
+	return ctx
+}
+
+// endTurn 结束当前回复轮次。
+func (s *realtimeSession) endTurn() {
+	s.mu.Lock()
+	cancel := s.turnCancel
+	s.turnCancel = nil
+	s.turnMsgID = 0
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// attach 记录当前轮次的助手消息。
+func (s *realtimeSession) attach(msgID uint64) {
+	s.mu.Lock()
+	s.turnMsgID = msgID
+	s.mu.Unlock()
+}
+
+// cancelTurn 取消正在进行的回复轮次，返回被打断的助手消息ID。
+func (s *realtimeSession) cancelTurn() (uint64, bool) {
+	s.mu.Lock()
+	cancel := s.turnCancel
+	msgID := s.turnMsgID
+	s.turnCancel = nil
+	s.mu.Unlock()
+	if cancel == nil {
+		return 0, false
+	}
+	cancel()
+	return msgID, true
+}
+
+// bargeIn 在用户插话时取消正在进行的生成与播报，并通知客户端停止播放。
+func (s *realtimeSession) bargeIn(reason string) bool {
+	msgID, ok := s.cancelTurn()
+	if !ok {
+		return false
+	}
+	payload := gin.H{"type": "barge_in", "reason": reason}
+	if msgID != 0 {
+		payload["id"] = msgID
+	}
+	s.conn.sendJSON(payload)
+	return true
+}
+
+// reportPlayback 记录客户端上报的已播放时长。
+func (s *realtimeSession) reportPlayback(ms int) {
+	if ms < 0 {
+		return
+	}
+	s.mu.Lock()
+	if ms > s.playedMs {
+		s.playedMs = ms
+	}
+	s.reported = true
+	s.mu.Unlock()
+}
+
+// played 返回已播放时长：优先使用客户端上报值，否则按首段音频发出后的时间推算，且不超过已发送音频总长。
+func (s *realtimeSession) played(speaker *realtimeSpeaker) int {
+	if speaker == nil {
+		return 0
+	}
+	audioMs, firstAudio := speaker.audioProgress()
+	s.mu.Lock()
+	played, reported := s.playedMs, s.reported
+	s.mu.Unlock()
+	if !reported {
+		if firstAudio.IsZero() {
+			return 0
+		}
+		played = int(time.Since(firstAudio).Milliseconds())
+	}
+	if played > audioMs {
+		played = audioMs
+	}
+	return played
+}
+
+// handleRealtimeVoice godoc
+// @Summary 实时语音对话
+// @Description 通过 WebSocket 进行全双工语音对话：客户端持续发送 16bit 单声道 PCM 麦克风音频，服务端做语音活动检测与识别，流式生成回复并以二进制帧返回合成语音；用户在播报中开口时服务端会打断生成与播报，并将助手消息截断为已播放的部分。文本控制消息支持 {"type":"playback","played_ms":N}、{"type":"interrupt"} 与 {"type":"stop"}
+// @Tags LLM
+// @Param agent_id query string true "智能体ID"
+// @Param user_id query string false "用户ID，默认为当前登录用户"
+// @Param sample_rate query int false "PCM 采样率，默认 16000"
+// @Param language query string false "语言代码"
+// @Param voice_id query string false "回复使用的音色"
+// @Success 101 {string} string "切换为 WebSocket"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 402 {object} map[string]string "余额不足"
+// @Failure 503 {object} map[string]string "服务未启用"
+// @Author bizer
+// handleRealtimeVoice 建立实时语音对话会话。
+func (m *Module) handleRealtimeVoice(c *gin.Context) {
+	if !m.asrEnabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "asr service disabled"})
+		return
+	}
+	if m.client == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "llm service disabled"})
+		return
+	}
+	agentID, err := parsePositiveUint(c.Query("agent_id"), "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+	sampleRate := 16000
+	if raw := strings.TrimSpace(c.Query("sample_rate")); raw != "" {
+		value, convErr := strconv.Atoi(raw)
+		if convErr != nil || value < 8000 || value > 48000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sample_rate must be between 8000 and 48000"})
+			return
+		}
+		sampleRate = value
+	}
+
+	balance, err := m.getUserTokenBalance(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load token balance"})
+		}
+		return
+	}
+	if balance <= 0 {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient token balance"})
+		return
+	}
+
+	ws, err := voiceStreamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("llm: realtime voice upgrade failed: %v", err)
+		return
+	}
+	defer ws.Close()
+	ws.SetReadLimit(voiceStreamMaxFrameBytes)
+
+	session := &realtimeSession{
+		m:          m,
+		conn:       &realtimeConn{conn: ws},
+		agentID:    agentID,
+		userID:     userID,
+		sampleRate: sampleRate,
+		language:   strings.TrimSpace(c.Query("language")),
+		prefs:      speechPreferences{VoiceID: strings.TrimSpace(c.Query("voice_id")), Speed: 1.0, Pitch: 1.0},
+	}
+
+	// 连接关闭时取消识别与生成；落库使用独立上下文，保证被打断的消息也能写回。
+	stopCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	utterances := make(chan []byte, realtimeUtteranceQueue)
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		for audio := range utterances {
+			session.runTurn(stopCtx, audio)
+		}
+	}()
+	defer func() {
+		session.cancelTurn()
+		stop()
+		close(utterances)
+		<-workerDone
+	}()
+
+	vad := asr.NewVAD(asr.VADConfig{
+		SampleRate:  sampleRate,
+		Threshold:   float64(readIntEnv("REALTIME_VAD_THRESHOLD", 0)),
+		MinSpeechMs: readIntEnv("REALTIME_VAD_MIN_SPEECH_MS", 0),
+		SilenceMs:   readIntEnv("REALTIME_VAD_SILENCE_MS", 0),
+	})
+
+	if !session.conn.sendJSON(gin.H{"type": "ready", "provider": m.asr.ID(), "sample_rate": sampleRate}) {
+		return
+	}
+
+	for {
+		_ = ws.SetReadDeadline(time.Now().Add(voiceStreamIdleTimeout))
+		kind, data, readErr := ws.ReadMessage()
+		if readErr != nil {
+			if !websocket.IsCloseError(readErr, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("llm: realtime voice read failed: %v", readErr)
+			}
+			return
+		}
+
+		if kind == websocket.BinaryMessage {
+			started, utterance := vad.Process(data)
+			if started {
+				session.bargeIn("speech")
+				session.conn.sendJSON(gin.H{"type": "speech_started"})
+			}
+			if utterance != nil {
+				session.conn.sendJSON(gin.H{"type": "speech_ended", "duration_ms": len(utterance) * 1000 / (sampleRate * 2)})
+				select {
+				case utterances <- utterance:
+				default:
+					session.conn.sendJSON(gin.H{"type": "error", "error": "too many pending utterances"})
+				}
+			}
+			continue
+		}
+
+		var control realtimeControl
+		if err := json.Unmarshal(data, &control); err != nil {
+			session.conn.sendJSON(gin.H{"type": "error", "error": "invalid control message"})
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(control.Type)) {
+		case "playback":
+			if control.PlayedMs != nil {
+				session.reportPlayback(*control.PlayedMs)
+			}
+		case "interrupt":
+			session.bargeIn("client")
+		case "stop":
+			session.bargeIn("stop")
+			_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return
+		default:
+			session.conn.sendJSON(gin.H{"type": "error", "error": "unknown control type"})
+		}
+	}
+}
+
+// runTurn 识别一段语句、写入用户消息并生成语音回复。
+func (s *realtimeSession) runTurn(ctx context.Context, pcm []byte) {
+	m := s.m
+	balance, err := m.getUserTokenBalance(ctx, s.userID)
+	if err != nil {
+		s.conn.sendJSON(gin.H{"type": "error", "error": "failed to load token balance"})
+		return
+	}
+	if balance <= 0 {
+		s.conn.sendJSON(gin.H{"type": "error", "error": "insufficient token balance"})
+		return
+	}
+
+	transcript, err := m.asr.Transcribe(ctx, asr.TranscribeRequest{
+		Audio:    asr.EncodeWAV(pcm, s.sampleRate),
+		Filename: "utterance.wav",
+		MimeType: "audio/wav",
+		Language: s.language,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			s.conn.sendJSON(gin.H{"type": "error", "error": "transcription failed", "details": err.Error()})
+		}
+		return
+	}
+	remaining, tokens, err := m.chargeTranscription(ctx, s.userID, transcript, balance)
+	if err != nil {
+		log.Printf("llm: charge transcription failed: %v", err)
+		s.conn.sendJSON(gin.H{"type": "error", "error": "failed to finalize token usage"})
+		return
+	}
+	text := strings.TrimSpace(transcript.Text)
+	s.conn.sendJSON(gin.H{
+		"type":             "transcript",
+		"text":             text,
+		"language":         transcript.Language,
+		"duration_seconds": transcript.DurationSeconds,
+		"tokens_used":      tokens,
+	})
+	if text == "" {
+		return
+	}
+	if remaining <= 0 {
+		s.conn.sendJSON(gin.H{"type": "error", "error": "insufficient token balance"})
+		return
+	}
+
+	conv, userMsg, userRecord, err := m.appendConversationMessage(ctx, s.agentID, s.userID, "user", text, transcriptExtras(transcript, tokens))
+	if err != nil {
+		s.conn.sendJSON(gin.H{"type": "error", "error": "failed to create message"})
+		return
+	}
+	m.invalidateRecentMessagesCache(ctx, conv.AgentID, conv.UserID)
+	if err := m.markConversationRead(ctx, conv.AgentID, conv.UserID); err != nil {
+		log.Printf("llm: reset unread count failed: %v", err)
+	}
+	if !s.conn.sendJSON(gin.H{"type": "user_message", "message": userRecord}) {
+		return
+	}
+
+	turnCtx := s.beginTurn(ctx)
+	defer s.endTurn()
+	s.streamReply(turnCtx, conv, userMsg, remaining)
+}
+
+// streamReply 流式生成回复并同步播报；被打断时按已播放部分截断消息。
+func (s *realtimeSession) streamReply(ctx context.Context, conv conversation, userMsg message, balance int64) {
+	m := s.m
+	persistCtx := context.WithoutCancel(ctx)
+
+	contextData, err := m.buildConversationContext(ctx, conv)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.conn.sendJSON(gin.H{"type": "error", "error": err.Error()})
+		}
+		return
+	}
+	modelName := contextData.modelName()
+
+	snippets, kErr := m.attachKnowledgeContext(ctx, contextData, conv.AgentID, userMsg.Content)
+	if kErr != nil {
+		log.Printf("llm: knowledge retrieval failed: %v", kErr)
+	}
+	contextData.messages = append(contextData.messages, ChatMessage{Role: "system", Content: realtimeVoiceInstruction})
+
+	prefs := s.prefs
+	applyPreferenceDefaults(&prefs, contextData)
+	prefs.Speed = sanitizeSpeed(prefs.Speed)
+	prefs.Pitch = sanitizePitch(prefs.Pitch)
+	selection := resolveVoiceSelection(prefs.VoiceID, prefs.Provider, m.tts)
+
+	placeholder, err := m.createAssistantPlaceholder(ctx, conv, userMsg)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.conn.sendJSON(gin.H{"type": "error", "error": "failed to prepare assistant message"})
+		}
+		return
+	}
+
+	speaker := newRealtimeSpeaker(ctx, m.tts, s.conn, placeholder.ID, selection, prefs, contextData.plan.StreamingTTS, parseStyleGuide(contextData.config))
+	s.attach(placeholder.ID)
+	defer speaker.stop()
+	if !s.conn.sendJSON(gin.H{"type": "assistant_start", "message": messageToRecord(placeholder, conv)}) {
+		return
+	}
+
+	start := time.Now()
+	var generated string
+	result, streamErr := m.client.ChatStream(ctx, contextData.messages, modelName, func(delta ChatStreamDelta) error {
+		generated = delta.FullContent
+		speaker.feed(delta.FullContent, delta.Done)
+		if delta.Content == "" {
+			return nil
+		}
+		if !s.conn.sendJSON(gin.H{"type": "assistant_delta", "id": placeholder.ID, "delta": delta.Content, "full": delta.FullContent}) {
+			return errors.New("llm: realtime voice client gone")
+		}
+		return nil
+	})
+
+	extras := map[string]any{"generation": m.generationExtras(contextData)}
+	if refs := snippetsToExtras(snippets); len(refs) > 0 {
+		extras["knowledge_refs"] = refs
+	}
+	if selection.ID != "" {
+		extras["speech_preferences"] = map[string]any{"voice_id": selection.ID, "provider": selection.Provider, "speed": prefs.Speed, "pitch": prefs.Pitch}
+	}
+
+	if streamErr != nil && ctx.Err() == nil {
+		log.Printf("llm: realtime voice generation failed: %v", streamErr)
+		s.conn.sendJSON(gin.H{"type": "error", "id": placeholder.ID, "error": "generation failed"})
+		usage := s.chargeEstimatedUsage(persistCtx, conv, contextData.messages, generated, balance, extras)
+		s.finalizeReply(persistCtx, conv, placeholder, styleStoredReply(contextData.config, generated, extras), usage, extras, start)
+		return
+	}
+
+	billed := false
+	if ctx.Err() == nil {
+		generated = result.Content
+		billed = true
+		speaker.finish()
+		record := s.finalizeReply(persistCtx, conv, placeholder, styleStoredReply(contextData.config, generated, extras), result.Usage, extras, start)
+		payload := gin.H{"type": "assistant_message", "message": record}
+		if result.Usage != nil {
+			updated, err := m.applyUsageToUserTokens(persistCtx, conv.UserID, result.Usage, balance)
+			if err != nil {
+				log.Printf("llm: failed to apply token usage: %v", err)
+			} else {
+				balance = updated
+			}
+			if used := totalTokensUsed(result.Usage); used > 0 {
+				payload["tokens_used"] = used
+			}
+		}
+		if balance < 0 {
+			balance = 0
+		}
+		payload["token_balance"] = balance
+		s.conn.sendJSON(payload)
+
+		if speaker.waitPlayback(ctx, s) {
+			s.conn.sendJSON(gin.H{"type": "assistant_done", "id": placeholder.ID})
+			return
+		}
+	} else {
+		speaker.stop()
+	}
+
+	// 被打断：只保留用户实际听到的部分。
+	playedMs := s.played(speaker)
+	spoken := generated
+	if speaker.enabled() {
+		spoken = speaker.spokenText(generated, playedMs)
+	}
+	spoken = styleStoredReply(contextData.config, spoken, extras)
+	styledGenerated, _ := applyStyleGuide(contextData.config, generated)
+	extras["realtime"] = map[string]any{
+		"interrupted": true,
+		"generated":   styledGenerated,
+		"spoken_ms":   playedMs,
+	}
+	// 生成已完成时用量已在上方扣除，此处只为中途打断的生成按已生成部分估算扣费。
+	var usage *ChatUsage
+	if !billed {
+		usage = s.chargeEstimatedUsage(persistCtx, conv, contextData.messages, generated, balance, extras)
+	}
+	s.finalizeReply(persistCtx, conv, placeholder, spoken, usage, extras, start)
+	s.conn.sendJSON(gin.H{"type": "assistant_interrupted", "id": placeholder.ID, "content": spoken, "spoken_ms": playedMs})
+}
+
+// chargeEstimatedUsage 为被打断或失败的生成按已生成文本估算用量并扣费，估算标记写入扩展字段。
+func (s *realtimeSession) chargeEstimatedUsage(ctx context.Context, conv conversation, messages []ChatMessage, generated string, balance int64, extras map[string]any) *ChatUsage {
+	usage := estimateChatUsage(messages, generated)
+	if usage == nil {
+		return nil
+	}
+	if _, err := s.m.applyUsageToUserTokens(ctx, conv.UserID, usage, balance); err != nil {
+		log.Printf("llm: failed to apply estimated token usage: %v", err)
+	}
+	extras["usage_estimated"] = true
+	return usage
+}
+
+// styleStoredReply 对入库的回复执行风格硬性规则，触发的规则写入扩展字段。
+func styleStoredReply(cfg *agents.AgentChatConfig, text string, extras map[string]any) string {
+	styled, applied := applyStyleGuide(cfg, text)
+	if len(applied) > 0 {
+		extras["style_enforced"] = applied
+	}
+	return styled
+}
+
+// finalizeReply 写回助手消息内容、用量与扩展字段，并返回最新记录。
+func (s *realtimeSession) finalizeReply(ctx context.Context, conv conversation, placeholder message, content string, usage *ChatUsage, extras map[string]any, start time.Time) messageRecord {
+	m := s.m
+	updates := map[string]any{
+		"content":    content,
+		"latency_ms": int(time.Since(start).Milliseconds()),
+	}
+	if usage != nil {
+		if usage.PromptTokens > 0 {
+			updates["token_input"] = usage.PromptTokens
+		}
+		if usage.CompletionTokens > 0 {
+			updates["token_output"] = usage.CompletionTokens
+		}
+	}
+	if merged, err := mergeExtras(placeholder.Extras, extras); err != nil {
+		log.Printf("llm: merge extras failed: %v", err)
+	} else {
+		updates["extras"] = merged
+	}
+	if err := m.db.WithContext(ctx).Model(&message{}).Where("id = ?", placeholder.ID).Updates(updates).Error; err != nil {
+		log.Printf("llm: update realtime reply failed: %v", err)
+	} else if usage != nil {
+		m.incrementConversationTokens(ctx, conv.ID, usage)
+	}
+	m.invalidateRecentMessagesCache(ctx, conv.AgentID, conv.UserID)
+	if err := m.db.WithContext(ctx).First(&placeholder, "id = ?", placeholder.ID).Error; err != nil {
+		log.Printf("llm: reload realtime reply failed: %v", err)
+	}
+	return messageToRecord(placeholder, conv)
+}
+
+// spokenSegment 记录已送去合成的一句文本及其音频时长。
+type spokenSegment struct {
+	Start      int
+	End        int
+	Text       string
+	EstimateMs int
+	AudioMs    int
+}
+
+// realtimeSpeaker 将流式生成的文本逐句送入语音合成，并把音频回传给客户端。
+type realtimeSpeaker struct {
+	ctx       context.Context
+	synth     tts.Synthesizer
+	conn      *realtimeConn
+	msgID     uint64
+	selection voiceSelection
+	prefs     speechPreferences
+	style     *speechStyle
+
+	session    tts.SpeechStreamSession
+	meta       tts.SpeechStreamMetadata
+	queue      chan int
+	closeQueue sync.Once
+	wg         sync.WaitGroup
+	consumed   int
+
+	mu         sync.Mutex
+	segments   []spokenSegment
+	streamed   []byte
+	audioMs    int
+	firstAudio time.Time
+	complete   bool
+}
+
+// newRealtimeSpeaker 创建实时播报器；套餐允许时 cosyvoice 使用流式合成，其余情况按句合成。
+func newRealtimeSpeaker(ctx context.Context, synth tts.Synthesizer, conn *realtimeConn, msgID uint64, selection voiceSelection, prefs speechPreferences, allowStream bool, guide *agents.StyleGuide) *realtimeSpeaker {
+	sp := &realtimeSpeaker{ctx: ctx, synth: synth, conn: conn, msgID: msgID, selection: selection, prefs: prefs, style: newSpeechStyle(guide)}
+	if synth == nil || !synth.Enabled() {
+		return sp
+	}
+
+	if streaming, ok := synth.(tts.StreamingSynthesizer); ok && allowStream && selection.Provider == "aliyun-cosyvoice" && selection.ID != "" {
+		session, err := streaming.Stream(ctx, tts.SpeechStreamRequest{
+			VoiceID:  selection.ID,
+			Provider: selection.Provider,
+			Speed:    prefs.Speed,
+			Pitch:    prefs.Pitch,
+		})
+		if err != nil {
+			log.Printf("llm: start realtime speech stream failed: %v", err)
+		} else {
+			sp.session = session
+			sp.meta = session.Metadata()
+			if strings.TrimSpace(sp.meta.MimeType) == "" {
+				sp.meta.MimeType = mimeForAudioFormat(sp.meta.Format)
+			}
+			conn.sendJSON(gin.H{
+				"type":        "audio_start",
+				"id":          msgID,
+				"format":      sp.meta.Format,
+				"mime_type":   sp.meta.MimeType,
+				"sample_rate": sp.meta.SampleRate,
+			})
+			sp.wg.Add(1)
+			go sp.pumpStream()
+			return sp
+		}
+	}
+
+	sp.queue = make(chan int, realtimeSpeechQueue)
+	sp.wg.Add(1)
+	go sp.pumpSentences()
+	return sp
+}
+
+// enabled 判断是否有语音输出。
+func (sp *realtimeSpeaker) enabled() bool {
+	return sp.session != nil || sp.queue != nil
+}
+
+// feed 消费最新的完整文本，把已完成的句子送去合成；final 时送出剩余内容。
+func (sp *realtimeSpeaker) feed(full string, final bool) {
+	if !sp.enabled() || sp.ctx.Err() != nil {
+		return
+	}
+	runes := []rune(full)
+	if sp.consumed >= len(runes) {
+		return
+	}
+	for _, span := range splitSentences(string(runes[sp.consumed:])) {
+		if !span.Complete && !final {
+			break
+		}
+		start, end := sp.consumed+span.Start, sp.consumed+span.End
+		sp.consumed = end
+		text, ok := sp.style.apply(strings.TrimSpace(span.Text))
+		if !ok {
+			continue
+		}
+		sp.dispatch(spokenSegment{Start: start, End: end, Text: text, EstimateMs: estimateSpeechMs(text, sp.prefs.Speed)})
+	}
+}
+
+// speechStyle 在送去合成前逐句执行风格硬性规则；回复长度上限按已播报字数累计，超出后不再播报。
+type speechStyle struct {
+	guide      *agents.StyleGuide
+	replyLimit int
+	spoken     int
+	exhausted  bool
+}
+
+// newSpeechStyle 根据风格配置创建逐句规则，没有硬性规则时返回 nil。
+func newSpeechStyle(guide *agents.StyleGuide) *speechStyle {
+	if !guide.HasHardRules() {
+		return nil
+	}
+	sentence := *guide
+	sentence.MaxReplyLength = 0
+	return &speechStyle{guide: &sentence, replyLimit: guide.MaxReplyLength}
+}
+
+// apply 返回执行规则后的句子；句子被规则清空或已达回复长度上限时返回 false。
+func (st *speechStyle) apply(text string) (string, bool) {
+	if st == nil {
+		return text, text != ""
+	}
+	if st.exhausted || text == "" {
+		return "", false
+	}
+	enforced, _ := st.guide.Enforce(text)
+	text = strings.TrimSpace(enforced)
+	if text == "" {
+		return "", false
+	}
+	if st.replyLimit > 0 {
+		runes := []rune(text)
+		if st.spoken+len(runes) > st.replyLimit {
+			st.exhausted = true
+			// 与 truncateAtSentence 一致：首句即超长时硬切，否则在上一句结束处停止。
+			if st.spoken > 0 {
+				return "", false
+			}
+			text = strings.TrimSpace(string(runes[:st.replyLimit]))
+		}
+		st.spoken += len(runes)
+	}
+	return text, true
+}
+
+// dispatch 将一句文本送入合成。
+func (sp *realtimeSpeaker) dispatch(segment spokenSegment) {
+	sp.mu.Lock()
+	index := len(sp.segments)
+	sp.segments = append(sp.segments, segment)
+	sp.mu.Unlock()
+
+	if sp.session != nil {
+		if err := sp.session.AppendText(sp.ctx, segment.Text); err != nil && sp.ctx.Err() == nil {
+			log.Printf("llm: realtime speech append failed: %v", err)
+		}
+		return
+	}
+	select {
+	case sp.queue <- index:
+	case <-sp.ctx.Done():
+	}
+}
+
+// pumpStream 转发流式合成的音频分片。
+func (sp *realtimeSpeaker) pumpStream() {
+	defer sp.wg.Done()
+	defer sp.session.Close()
+	for chunk := range sp.session.Audio() {
+		if len(chunk.Audio) == 0 || sp.ctx.Err() != nil {
+			continue
+		}
+		if !sp.conn.sendAudio(chunk.Audio) {
+			continue
+		}
+		sp.mu.Lock()
+		if sp.firstAudio.IsZero() {
+			sp.firstAudio = time.Now()
+		}
+		sp.streamed = append(sp.streamed, chunk.Audio...)
+		sp.audioMs = tts.EstimateDurationMs(sp.streamed, sp.meta.Format, sp.meta.SampleRate)
+		sp.mu.Unlock()
+	}
+	if err := sp.session.Err(); err != nil && sp.ctx.Err() == nil {
+		log.Printf("llm: realtime speech stream failed: %v", err)
+	}
+}
+
+// pumpSentences 按句合成并发送音频，每段音频前先发送描述事件。
+func (sp *realtimeSpeaker) pumpSentences() {
+	defer sp.wg.Done()
+	for index := range sp.queue {
+		if sp.ctx.Err() != nil {
+			continue
+		}
+		sp.mu.Lock()
+		text := sp.segments[index].Text
+		sp.mu.Unlock()
+
+		result, err := sp.synth.Synthesize(sp.ctx, tts.SpeechRequest{
+			Text:     text,
+			VoiceID:  sp.selection.ID,
+			Provider: sp.selection.Provider,
+			Speed:    sp.prefs.Speed,
+			Pitch:    sp.prefs.Pitch,
+		})
+		if err != nil || result == nil {
+			if sp.ctx.Err() == nil {
+				log.Printf("llm: realtime speech synthesis failed: %v", err)
+			}
+			continue
+		}
+		audio, err := base64.StdEncoding.DecodeString(result.AudioBase64)
+		if err != nil || len(audio) == 0 || sp.ctx.Err() != nil {
+			continue
+		}
+		durationMs := result.DurationMs
+		if durationMs <= 0 {
+			durationMs = speechResultDurationMs(result)
+		}
+		if durationMs <= 0 {
+			durationMs = sp.segments[index].EstimateMs
+		}
+		if !sp.conn.sendJSON(gin.H{
+			"type":        "audio",
+			"id":          sp.msgID,
+			"segment":     index,
+			"text":        text,
+			"mime_type":   result.MimeType,
+			"duration_ms": durationMs,
+		}) || !sp.conn.sendAudio(audio) {
+			continue
+		}
+		sp.mu.Lock()
+		if sp.firstAudio.IsZero() {
+			sp.firstAudio = time.Now()
+		}
+		sp.segments[index].AudioMs = durationMs
+		sp.audioMs += durationMs
+		sp.mu.Unlock()
+	}
+}
+
+// finish 等待所有文本合成完毕。
+func (sp *realtimeSpeaker) finish() {
+	if sp.session != nil {
+		if err := sp.session.Finalize(sp.ctx); err != nil && sp.ctx.Err() == nil {
+			log.Printf("llm: finalize realtime speech failed: %v", err)
+		}
+	}
+	if sp.queue != nil {
+		sp.closeQueue.Do(func() { close(sp.queue) })
+	}
+	sp.wg.Wait()
+	if sp.ctx.Err() == nil {
+		sp.mu.Lock()
+		sp.complete = true
+		sp.mu.Unlock()
+	}
+}
+
+// stop 停止合成并等待后台协程退出，可重复调用。
+func (sp *realtimeSpeaker) stop() {
+	if sp.session != nil {
+		_ = sp.session.Close()
+	}
+	if sp.queue != nil {
+		sp.closeQueue.Do(func() { close(sp.queue) })
+	}
+	sp.wg.Wait()
+}
+
+// audioProgress 返回已发送音频总时长与首段音频发送时间。
+func (sp *realtimeSpeaker) audioProgress() (int, time.Time) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.audioMs, sp.firstAudio
+}
+
+// waitPlayback 等待客户端播放完全部音频，期间被打断时返回 false。
+func (sp *realtimeSpeaker) waitPlayback(ctx context.Context, s *realtimeSession) bool {
+	if !sp.enabled() {
+		return ctx.Err() == nil
+	}
+	ticker := time.NewTicker(realtimePlaybackPoll)
+	defer ticker.Stop()
+	for {
+		audioMs, _ := sp.audioProgress()
+		if s.played(sp) >= audioMs {
+			return ctx.Err() == nil
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// spokenText 根据已播放时长估算用户实际听到的文本前缀。
+func (sp *realtimeSpeaker) spokenText(full string, playedMs int) string {
+	sp.mu.Lock()
+	segments := append([]spokenSegment(nil), sp.segments...)
+	audioMs, complete := sp.audioMs, sp.complete
+	sp.mu.Unlock()
+	return spokenPrefix(full, segments, playedMs, audioMs, complete)
+}
+
+// spokenPrefix 按句子时长累加定位播放位置，句内按字符时长比例截断并对齐到词边界。
+func spokenPrefix(full string, segments []spokenSegment, playedMs, audioMs int, complete bool) string {
+	if playedMs <= 0 || len(segments) == 0 {
+		return ""
+	}
+	runes := []rune(full)
+
+	measured := true
+	estimateTotal := 0
+	for _, seg := range segments {
+		estimateTotal += seg.EstimateMs
+		if seg.AudioMs <= 0 {
+			measured = false
+		}
+	}
+	// 流式合成无法对应到句子，合成完成时用真实音频总长校正估算值。
+	scale := 1.0
+	if !measured && complete && audioMs > 0 && estimateTotal > 0 {
+		scale = float64(audioMs) / float64(estimateTotal)
+	}
+
+	cursor := 0
+	end := 0
+	for _, seg := range segments {
+		if seg.End > len(runes) {
+			break
+		}
+		duration := seg.AudioMs
+		if !measured {
+			duration = int(math.Round(float64(seg.EstimateMs) * scale))
+		}
+		if cursor+duration <= playedMs {
+			cursor += duration
+			end = seg.End
+			continue
+		}
+		end = seg.Start + partialSpoken(runes[seg.Start:seg.End], playedMs-cursor, duration)
+		break
+	}
+	return strings.TrimSpace(string(runes[:end]))
+}
+
+// partialSpoken 返回一句话在播放 elapsed 毫秒后已读出的字符数。
+func partialSpoken(text []rune, elapsed, duration int) int {
+	if elapsed <= 0 || duration <= 0 {
+		return 0
+	}
+	total := estimateSpeechMs(string(text), 1.0)
+	if total <= 0 {
+		return 0
+	}
+	ratio := float64(duration) / float64(total)
+	var acc float64
+	cut := len(text)
+	for i, r := range text {
+		acc += float64(estimateSpeechMs(string(r), 1.0)) * ratio
+		if acc > float64(elapsed) {
+			cut = i
+			break
+		}
+	}
+	// 拉丁字母等以空格分词的文字不在词中间截断。
+	if cut > 0 && cut < len(text) && isSpacedWordRune(text[cut-1]) && isSpacedWordRune(text[cut]) {
+		for cut > 0 && !unicode.IsSpace(text[cut-1]) {
+			cut--
+		}
+	}
+	return cut
+}
+
+// isSpacedWordRune 判断字符是否属于以空格分词的文字。
+func isSpacedWordRune(r rune) bool {
+	if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '-'
+}
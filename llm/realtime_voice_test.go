@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"testing"
+
+	"auralis_back/agents"
+)
+
+func TestSpokenPrefix(t *testing.T) {
+	full := "Hello there. 你好世界。"
+	measured := []spokenSegment{{Start: 0, End: 12, AudioMs: 1000}, {Start: 13, End: 18, AudioMs: 1000}}
+	estimated := []spokenSegment{{Start: 0, End: 12, EstimateMs: 500}, {Start: 13, End: 18, EstimateMs: 500}}
+
+	tests := []struct {
+		name     string
+		full     string
+		segments []spokenSegment
+		playedMs int
+		audioMs  int
+		complete bool
+		want     string
+	}{
+		{"nothing played", full, measured, 0, 2000, true, ""},
+		{"no segments", full, nil, 1000, 0, false, ""},
+		{"before first word ends", full, measured, 300, 2000, true, ""},
+		{"latin cut on word boundary", full, measured, 700, 2000, true, "Hello"},
+		{"first sentence", full, measured, 1000, 2000, true, "Hello there."},
+		{"cjk cut per character", full, measured, 1500, 2000, true, "Hello there. 你好"},
+		{"everything played", full, measured, 5000, 2000, true, full},
+		{"estimates scaled to real audio", full, estimated, 1000, 2000, true, "Hello there."},
+		{"estimates unscaled while streaming", full, estimated, 1000, 0, false, full},
+		{"segment beyond generated text", "Hello there.", measured, 5000, 2000, true, "Hello there."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spokenPrefix(tt.full, tt.segments, tt.playedMs, tt.audioMs, tt.complete); got != tt.want {
+				t.Errorf("spokenPrefix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateChatUsage(t *testing.T) {
+	messages := []ChatMessage{{Role: "system", Content: "You are helpful."}, {Role: "user", Content: "你好"}}
+	if usage := estimateChatUsage(messages, ""); usage != nil {
+		t.Fatalf("usage without completion = %+v, want nil", usage)
+	}
+	usage := estimateChatUsage(messages, "Hello there")
+	if usage == nil || usage.PromptTokens <= 0 || usage.CompletionTokens <= 0 {
+		t.Fatalf("usage = %+v, want positive prompt and completion tokens", usage)
+	}
+	if usage.TotalTokens != usage.PromptTokens+usage.CompletionTokens {
+		t.Errorf("total = %d, want %d", usage.TotalTokens, usage.PromptTokens+usage.CompletionTokens)
+	}
+}
+
+func TestSpeechStyleApply(t *testing.T) {
+	guide := &agents.StyleGuide{BannedPhrases: []string{"as an AI"}, EmojiPolicy: "none", MaxReplyLength: 30}
+	style := newSpeechStyle(guide)
+
+	steps := []struct {
+		text   string
+		want   string
+		wantOK bool
+	}{
+		{"As an AI, I think so.", "I think so.", true},
+		{"😀", "", false},
+		{"Sure thing!", "Sure thing!", true},
+		{"This sentence no longer fits the limit.", "", false},
+		{"Ok.", "", false},
+	}
+	for i, step := range steps {
+		got, ok := style.apply(step.text)
+		if got != step.want || ok != step.wantOK {
+			t.Errorf("step %d apply(%q) = %q, %v; want %q, %v", i, step.text, got, ok, step.want, step.wantOK)
+		}
+	}
+	if guide.MaxReplyLength != 30 {
+		t.Errorf("guide was modified: %+v", guide)
+	}
+
+	if newSpeechStyle(&agents.StyleGuide{Tone: "warm"}) != nil {
+		t.Error("style without hard rules should be nil")
+	}
+	var none *speechStyle
+	if got, ok := none.apply("As an AI, hi."); got != "As an AI, hi." || !ok {
+		t.Errorf("nil style apply = %q, %v; want passthrough", got, ok)
+	}
+
+	first := newSpeechStyle(&agents.StyleGuide{MaxReplyLength: 20})
+	if got, ok := first.apply("This first sentence is far too long to speak."); !ok || len([]rune(got)) > 20 {
+		t.Errorf("first sentence = %q, %v; want hard cut to 20 runes", got, ok)
+	}
+}
+
+func TestStyleStoredReply(t *testing.T) {
+	cfg := &agents.AgentChatConfig{StyleGuide: []byte(`{"banned_phrases":["as an AI"]}`)}
+	extras := map[string]any{}
+	if got := styleStoredReply(cfg, "As an AI, I think so.", extras); got != "I think so." {
+		t.Errorf("styled = %q, want %q", got, "I think so.")
+	}
+	if _, ok := extras["style_enforced"]; !ok {
+		t.Errorf("extras = %v, want style_enforced", extras)
+	}
+}
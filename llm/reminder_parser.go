@@ -0,0 +1,284 @@
+package llm
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	reminderTriggerPattern = regexp.MustCompile(`(?i)(remind me|提醒我|提醒一下我|记得叫我)`)
+
+	reminderRelativeEnPattern  = regexp.MustCompile(`(?i)\bin\s+(\d+|an?)\s*(minutes?|mins?|hours?|hrs?|days?)\b`)
+	reminderRelativeZhPattern  = regexp.MustCompile(`(\d+|[零一二两三四五六七八九十半]+)\s*(分钟|个小时|小时|天)(?:之后|以后|后)`)
+	reminderDayEnPattern       = regexp.MustCompile(`(?i)\b(the day after tomorrow|tomorrow|tonight|today)\b`)
+	reminderDayZhPattern       = regexp.MustCompile(`(今天|今晚|明天|明早|明晚|后天)`)
+	reminderClockEnPattern     = regexp.MustCompile(`(?i)\bat\s+(\d{1,2})(?::(\d{2}))?\s*(am|pm)?\b`)
+	reminderClockColonPattern  = regexp.MustCompile(`\b(\d{1,2}):(\d{2})\b`)
+	reminderClockMeridiemRegex = regexp.MustCompile(`(?i)\b(\d{1,2})\s*(am|pm)\b`)
+	reminderClockZhPattern     = regexp.MustCompile(`(凌晨|早上|早晨|上午|中午|下午|傍晚|晚上)?\s*(\d{1,2}|[零一二两三四五六七八九十]+)\s*(?:点|时)(?:\s*(半|一刻|(\d{1,2}|[零一二两三四五六七八九十]+)\s*分?))?`)
+)
+
+// reminderIntent 描述从用户消息中解析出的提醒请求。
+type reminderIntent struct {
+	DueAt time.Time
+	Note  string
+}
+
+// parseReminderRequest 识别“明天9点提醒我…”“remind me in 30 minutes…”等提醒请求。
+func parseReminderRequest(text string, now time.Time) (*reminderIntent, bool) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || !reminderTriggerPattern.MatchString(trimmed) {
+		return nil, false
+	}
+
+	remaining := reminderTriggerPattern.ReplaceAllString(trimmed, " ")
+
+	if due, rest, ok := parseRelativeReminder(remaining, now); ok {
+		return &reminderIntent{DueAt: due, Note: cleanReminderNote(rest, trimmed)}, true
+	}
+
+	dayOffset := -1
+	meridiem := ""
+	if match := reminderDayEnPattern.FindStringSubmatch(remaining); match != nil {
+		switch strings.ToLower(match[1]) {
+		case "today":
+			dayOffset = 0
+		case "tonight":
+			dayOffset = 0
+			meridiem = "pm"
+		case "tomorrow":
+			dayOffset = 1
+		case "the day after tomorrow":
+			dayOffset = 2
+		}
+		remaining = strings.Replace(remaining, match[0], " ", 1)
+	} else if match := reminderDayZhPattern.FindStringSubmatch(remaining); match != nil {
+		switch match[1] {
+		case "今天":
+			dayOffset = 0
+		case "今晚":
+			dayOffset = 0
+			meridiem = "pm"
+		case "明天", "明早":
+			dayOffset = 1
+		case "明晚":
+			dayOffset = 1
+			meridiem = "pm"
+		case "后天":
+			dayOffset = 2
+		}
+		remaining = strings.Replace(remaining, match[0], " ", 1)
+	}
+
+	hour, minute, rest, found := parseReminderClock(remaining, meridiem)
+	if !found {
+		if dayOffset <= 0 {
+			return nil, false
+		}
+		hour, minute = 9, 0
+		rest = remaining
+	}
+
+	base := now
+	if dayOffset > 0 {
+		base = now.AddDate(0, 0, dayOffset)
+	}
+	due := time.Date(base.Year(), base.Month(), base.Day(), hour, minute, 0, 0, now.Location())
+	if dayOffset < 0 && !due.After(now) {
+		due = due.AddDate(0, 0, 1)
+	}
+	if !due.After(now) {
+		return nil, false
+	}
+
+	return &reminderIntent{DueAt: due, Note: cleanReminderNote(rest, trimmed)}, true
+}
+
+// parseRelativeReminder 解析“30分钟后”“in 2 hours”等相对时间。
+func parseRelativeReminder(text string, now time.Time) (time.Time, string, bool) {
+	if match := reminderRelativeEnPattern.FindStringSubmatch(text); match != nil {
+		amount := 1
+		if n, err := strconv.Atoi(match[1]); err == nil {
+			amount = n
+		}
+		unit := strings.ToLower(match[2])
+		var duration time.Duration
+		switch {
+		case strings.HasPrefix(unit, "min"):
+			duration = time.Duration(amount) * time.Minute
+		case strings.HasPrefix(unit, "h"):
+			duration = time.Duration(amount) * time.Hour
+		default:
+			duration = time.Duration(amount) * 24 * time.Hour
+		}
+		if duration <= 0 {
+			return time.Time{}, "", false
+		}
+		return now.Add(duration), strings.Replace(text, match[0], " ", 1), true
+	}
+	if match := reminderRelativeZhPattern.FindStringSubmatch(text); match != nil {
+		var duration time.Duration
+		if match[1] == "半" {
+			switch match[2] {
+			case "个小时", "小时":
+				duration = 30 * time.Minute
+			case "天":
+				duration = 12 * time.Hour
+			}
+		} else {
+			amount, ok := parseSmallNumber(match[1])
+			if !ok {
+				return time.Time{}, "", false
+			}
+			switch match[2] {
+			case "分钟":
+				duration = time.Duration(amount) * time.Minute
+			case "个小时", "小时":
+				duration = time.Duration(amount) * time.Hour
+			case "天":
+				duration = time.Duration(amount) * 24 * time.Hour
+			}
+		}
+		if duration <= 0 {
+			return time.Time{}, "", false
+		}
+		return now.Add(duration), strings.Replace(text, match[0], " ", 1), true
+	}
+	return time.Time{}, "", false
+}
+
+// parseReminderClock 解析具体的钟点时间，返回 24 小时制的时分。
+func parseReminderClock(text, meridiem string) (int, int, string, bool) {
+	if match := reminderClockEnPattern.FindStringSubmatch(text); match != nil {
+		hour, _ := strconv.Atoi(match[1])
+		minute := 0
+		if match[2] != "" {
+			minute, _ = strconv.Atoi(match[2])
+		}
+		if match[3] != "" {
+			meridiem = strings.ToLower(match[3])
+		}
+		if h, ok := applyMeridiem(hour, meridiem); ok && minute < 60 {
+			return h, minute, strings.Replace(text, match[0], " ", 1), true
+		}
+	}
+	if match := reminderClockColonPattern.FindStringSubmatch(text); match != nil {
+		hour, _ := strconv.Atoi(match[1])
+		minute, _ := strconv.Atoi(match[2])
+		if h, ok := applyMeridiem(hour, meridiem); ok && minute < 60 {
+			return h, minute, strings.Replace(text, match[0], " ", 1), true
+		}
+	}
+	if match := reminderClockMeridiemRegex.FindStringSubmatch(text); match != nil {
+		hour, _ := strconv.Atoi(match[1])
+		if h, ok := applyMeridiem(hour, strings.ToLower(match[2])); ok {
+			return h, 0, strings.Replace(text, match[0], " ", 1), true
+		}
+	}
+	if match := reminderClockZhPattern.FindStringSubmatch(text); match != nil {
+		hour, ok := parseSmallNumber(match[2])
+		if !ok {
+			return 0, 0, text, false
+		}
+		minute := 0
+		switch match[3] {
+		case "":
+		case "半":
+			minute = 30
+		case "一刻":
+			minute = 15
+		default:
+			if v, ok := parseSmallNumber(match[4]); ok {
+				minute = v
+			}
+		}
+		switch match[1] {
+		case "下午", "傍晚", "晚上":
+			meridiem = "pm"
+		case "中午":
+			if hour < 6 {
+				meridiem = "pm"
+			}
+		case "凌晨", "早上", "早晨", "上午":
+			meridiem = "am"
+		}
+		if h, ok := applyMeridiem(hour, meridiem); ok && minute < 60 {
+			return h, minute, strings.Replace(text, match[0], " ", 1), true
+		}
+	}
+	return 0, 0, text, false
+}
+
+// applyMeridiem 根据上午/下午标记换算为 24 小时制。
+func applyMeridiem(hour int, meridiem string) (int, bool) {
+	switch meridiem {
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	}
+	if hour < 0 || hour > 23 {
+		return 0, false
+	}
+	return hour, true
+}
+
+// parseSmallNumber 解析阿拉伯数字或 0-99 的中文数字。
+func parseSmallNumber(value string) (int, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return n, true
+	}
+	digits := map[rune]int{'零': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+	runes := []rune(value)
+	total := 0
+	current := 0
+	for _, r := range runes {
+		if r == '十' {
+			if current == 0 {
+				current = 1
+			}
+			total += current * 10
+			current = 0
+			continue
+		}
+		d, ok := digits[r]
+		if !ok {
+			return 0, false
+		}
+		current = d
+	}
+	total += current
+	if total > 99 {
+		return 0, false
+	}
+	return total, true
+}
+
+// cleanReminderNote 清理去除时间表达后的提醒内容。
+func cleanReminderNote(rest, original string) string {
+	note := strings.TrimSpace(rest)
+	note = strings.Trim(note, " ,，.。!！?？:：")
+	lower := strings.ToLower(note)
+	for _, prefix := range []string{"to ", "that ", "about "} {
+		if strings.HasPrefix(lower, prefix) {
+			note = strings.TrimSpace(note[len(prefix):])
+			break
+		}
+	}
+	note = strings.TrimLeft(note, "去要该")
+	note = strings.Join(strings.Fields(note), " ")
+	if note == "" {
+		return original
+	}
+	return truncateString(note, 500)
+}
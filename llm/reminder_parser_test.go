@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReminderRequest(t *testing.T) {
+	now := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		text     string
+		wantOK   bool
+		wantDue  time.Time
+		wantNote string
+	}{
+		{"remind me in 30 minutes to stretch", true, now.Add(30 * time.Minute), "stretch"},
+		{"Remind me in an hour to call mom", true, now.Add(time.Hour), "call mom"},
+		{"remind me in 2 days about the rent", true, now.Add(48 * time.Hour), "the rent"},
+		{"remind me tomorrow at 9am to submit the report", true, at(11, 9, 0), "submit the report"},
+		{"remind me at 8 pm to take medicine", true, at(10, 20, 0), "take medicine"},
+		{"remind me tonight at 7:30 to water the plants", true, at(10, 19, 30), "water the plants"},
+		{"remind me at 9:00", true, at(11, 9, 0), "remind me at 9:00"},
+		{"remind me tomorrow", true, at(11, 9, 0), "remind me tomorrow"},
+		{"remind me today", false, time.Time{}, ""},
+		{"remind me at 25:00", false, time.Time{}, ""},
+		{"see you tomorrow at 9", false, time.Time{}, ""},
+		{"10分钟后提醒我喝水", true, now.Add(10 * time.Minute), "喝水"},
+		{"半小时后提醒我去取快递", true, now.Add(30 * time.Minute), "取快递"},
+		{"两个小时后提醒我", true, now.Add(2 * time.Hour), "两个小时后提醒我"},
+		{"明天早上8点半提醒我开会", true, at(11, 8, 30), "开会"},
+		{"提醒我今晚八点吃药", true, at(10, 20, 0), "吃药"},
+		{"下午3点一刻提醒我交报告", true, at(10, 15, 15), "交报告"},
+		{"后天提醒我还书", true, at(12, 9, 0), "还书"},
+		{"明天见", false, time.Time{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			intent, ok := parseReminderRequest(tt.text, now)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v (intent %+v)", ok, tt.wantOK, intent)
+			}
+			if !ok {
+				return
+			}
+			if !intent.DueAt.Equal(tt.wantDue) {
+				t.Errorf("due = %v, want %v", intent.DueAt, tt.wantDue)
+			}
+			if intent.Note != tt.wantNote {
+				t.Errorf("note = %q, want %q", intent.Note, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestParseSmallNumber(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   int
+		wantOK bool
+	}{
+		{"7", 7, true},
+		{"两", 2, true},
+		{"十", 10, true},
+		{"十五", 15, true},
+		{"二十三", 23, true},
+		{"九十九", 99, true},
+		{"一百", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSmallNumber(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseSmallNumber(%q) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
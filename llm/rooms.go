@@ -0,0 +1,1097 @@
+package llm
+
+import (
+	"auralis_back/agents"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	roomPolicyRoundRobin = "round_robin"
+	roomPolicyAddressed  = "addressed"
+	roomPolicyModerator  = "moderator"
+
+	maxRoomParticipants = 6
+	roomHistoryLimit    = 30
+)
+
+// roomParticipant 聚合参与者的智能体资料与对话配置。
+type roomParticipant struct {
+	agent    agents.Agent
+	config   *agents.AgentChatConfig
+	position int
+}
+
+type createRoomRequest struct {
+	UserID           string   `json:"user_id"`
+	Title            string   `json:"title"`
+	AgentIDs         []uint64 `json:"agent_ids" binding:"required"`
+	TurnPolicy       string   `json:"turn_policy"`
+	ModeratorAgentID *uint64  `json:"moderator_agent_id,omitempty"`
+}
+
+type createRoomMessageRequest struct {
+	UserID  string `json:"user_id"`
+	Content string `json:"content" binding:"required"`
+}
+
+type roomParticipantRecord struct {
+	AgentID       uint64  `json:"agent_id"`
+	Name          string  `json:"name"`
+	AvatarURL     *string `json:"avatar_url,omitempty"`
+	VoiceID       *string `json:"voice_id,omitempty"`
+	VoiceProvider *string `json:"voice_provider,omitempty"`
+	Live2DModelID *string `json:"live2d_model_id,omitempty"`
+	Position      int     `json:"position"`
+}
+
+type roomRecord struct {
+	ID               uint64                  `json:"id"`
+	UserID           uint64                  `json:"user_id"`
+	Title            *string                 `json:"title,omitempty"`
+	TurnPolicy       string                  `json:"turn_policy"`
+	ModeratorAgentID *uint64                 `json:"moderator_agent_id,omitempty"`
+	Status           string                  `json:"status"`
+	Participants     []roomParticipantRecord `json:"participants"`
+	LastMsgAt        *time.Time              `json:"last_msg_at,omitempty"`
+	CreatedAt        time.Time               `json:"created_at"`
+}
+
+type roomMessageRecord struct {
+	ID          uint64          `json:"id"`
+	RoomID      uint64          `json:"room_id"`
+	Seq         int             `json:"seq"`
+	Role        string          `json:"role"`
+	AgentID     *uint64         `json:"agent_id,omitempty"`
+	AgentName   string          `json:"agent_name,omitempty"`
+	Content     string          `json:"content"`
+	LatencyMs   *int            `json:"latency_ms,omitempty"`
+	TokenInput  *int            `json:"token_input,omitempty"`
+	TokenOutput *int            `json:"token_output,omitempty"`
+	ErrCode     *string         `json:"err_code,omitempty"`
+	ErrMsg      *string         `json:"err_msg,omitempty"`
+	Extras      json.RawMessage `json:"extras,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type createRoomMessageResponse struct {
+	RoomID       uint64              `json:"room_id"`
+	UserMessage  roomMessageRecord   `json:"user_message"`
+	Replies      []roomMessageRecord `json:"replies"`
+	Errors       []string            `json:"errors,omitempty"`
+	TokensUsed   *int                `json:"tokens_used,omitempty"`
+	TokenBalance *int64              `json:"token_balance,omitempty"`
+}
+
+// normalizeRoomPolicy 规范化轮流发言策略。
+func normalizeRoomPolicy(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", roomPolicyRoundRobin, "round-robin", "roundrobin":
+		return roomPolicyRoundRobin, true
+	case roomPolicyAddressed, "mention", "addressed_by_name":
+		return roomPolicyAddressed, true
+	case roomPolicyModerator, "moderated":
+		return roomPolicyModerator, true
+	default:
+		return "", false
+	}
+}
+
+// registerRoomRoutes 注册群聊房间相关路由。
+func (m *Module) registerRoomRoutes(group *gin.RouterGroup) {
+	rooms := group.Group("/rooms")
+	rooms.POST("", m.handleCreateRoom)
+	rooms.GET("", m.handleListRooms)
+	rooms.GET("/:id", m.handleGetRoom)
+	rooms.GET("/:id/messages", m.handleListRoomMessages)
+	rooms.POST("/:id/messages", m.limiter.Handler(messageRateLimit), m.handleCreateRoomMessage)
+}
+
+// handleCreateRoom godoc
+// @Summary 创建群聊房间
+// @Description 创建包含多个智能体的群聊房间并指定轮流发言策略（round_robin/addressed/moderator）
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param request body createRoomRequest true "房间配置"
+// @Success 201 {object} map[string]interface{} "房间信息"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleCreateRoom 创建多智能体群聊房间。
+func (m *Module) handleCreateRoom(c *gin.Context) {
+	if m.db == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not initialized"})
+		return
+	}
+
+	var req createRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	policy, ok := normalizeRoomPolicy(req.TurnPolicy)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid turn_policy"})
+		return
+	}
+
+	agentIDs := make([]uint64, 0, len(req.AgentIDs))
+	seen := make(map[uint64]struct{}, len(req.AgentIDs))
+	for _, id := range req.AgentIDs {
+		if id == 0 {
+			continue
+		}
+		if _, exists := seen[id]; exists {
+			continue
+		}
+		seen[id] = struct{}{}
+		agentIDs = append(agentIDs, id)
+	}
+	if len(agentIDs) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a room requires at least two agents"})
+		return
+	}
+	if len(agentIDs) > maxRoomParticipants {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a room supports at most %d agents", maxRoomParticipants)})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var found []agents.Agent
+	if err := m.db.WithContext(ctx).Where("id IN ? AND status = ?", agentIDs, "active").Find(&found).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load agents", "details": err.Error()})
+		return
+	}
+	if len(found) != len(agentIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "some agents do not exist or are not active"})
+		return
+	}
+
+	var moderatorID *uint64
+	if policy == roomPolicyModerator && req.ModeratorAgentID != nil && *req.ModeratorAgentID != 0 {
+		if _, exists := seen[*req.ModeratorAgentID]; !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "moderator_agent_id must be one of agent_ids"})
+			return
+		}
+		id := *req.ModeratorAgentID
+		moderatorID = &id
+	}
+
+	room := chatRoom{
+		UserID:           userID,
+		TurnPolicy:       policy,
+		ModeratorAgentID: moderatorID,
+		Status:           "active",
+	}
+	if title := strings.TrimSpace(req.Title); title != "" {
+		title = truncateString(title, 200)
+		room.Title = &title
+	}
+
+	if err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&room).Error; err != nil {
+			return err
+		}
+		for idx, agentID := range agentIDs {
+			participant := chatRoomParticipant{RoomID: room.ID, AgentID: agentID, Position: idx}
+			if err := tx.Create(&participant).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create room", "details": err.Error()})
+		return
+	}
+
+	participants, err := m.loadRoomParticipants(ctx, room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load participants", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"room": buildRoomRecord(room, participants)})
+}
+
+// handleListRooms godoc
+// @Summary 查询群聊房间
+// @Description 返回用户创建的群聊房间列表
+// @Tags LLM
+// @Produce json
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "房间列表"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleListRooms 返回用户的群聊房间列表。
+func (m *Module) handleListRooms(c *gin.Context) {
+	if m.db == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not initialized"})
+		return
+	}
+
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var rooms []chatRoom
+	if err := m.db.WithContext(ctx).
+		Where("user_id = ? AND status = ?", userID, "active").
+		Order("updated_at DESC").
+		Limit(100).
+		Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load rooms", "details": err.Error()})
+		return
+	}
+
+	records := make([]roomRecord, 0, len(rooms))
+	for _, room := range rooms {
+		participants, err := m.loadRoomParticipants(ctx, room.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load participants", "details": err.Error()})
+			return
+		}
+		records = append(records, buildRoomRecord(room, participants))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rooms": records})
+}
+
+// handleGetRoom godoc
+// @Summary 获取群聊房间
+// @Description 返回群聊房间详情及参与的智能体
+// @Tags LLM
+// @Produce json
+// @Param id path int true "房间ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "房间信息"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 404 {object} map[string]string "未找到"
+// @Author bizer
+// handleGetRoom 返回群聊房间详情。
+func (m *Module) handleGetRoom(c *gin.Context) {
+	room, participants, ok := m.resolveRoomFromRequest(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"room": buildRoomRecord(*room, participants)})
+}
+
+// handleListRoomMessages godoc
+// @Summary 查询群聊消息
+// @Description 返回群聊房间的近期消息，助手消息附带发言智能体信息
+// @Tags LLM
+// @Produce json
+// @Param id path int true "房间ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "消息列表"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 404 {object} map[string]string "未找到"
+// @Author bizer
+// handleListRoomMessages 返回群聊房间的近期消息。
+func (m *Module) handleListRoomMessages(c *gin.Context) {
+	room, participants, ok := m.resolveRoomFromRequest(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	history, err := m.loadRoomHistory(c.Request.Context(), room.ID, 50)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages", "details": err.Error()})
+		return
+	}
+
+	names := participantNames(participants)
+	records := make([]roomMessageRecord, 0, len(history))
+	for _, msg := range history {
+		records = append(records, roomMessageToRecord(msg, names))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": room.ID, "messages": records})
+}
+
+// handleCreateRoomMessage godoc
+// @Summary 发送群聊消息
+// @Description 用户在群聊中发言，并按房间策略选择一个或多个智能体依次回复；支持 SSE 流式返回，事件均带有 agent_id
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param id path int true "房间ID"
+// @Param request body createRoomMessageRequest true "消息内容"
+// @Success 201 {object} createRoomMessageResponse "回复结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 402 {object} map[string]string "余额不足"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleCreateRoomMessage 处理群聊发言并触发智能体轮流回复。
+func (m *Module) handleCreateRoomMessage(c *gin.Context) {
+	var req createRoomMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content cannot be empty"})
+		return
+	}
+
+	room, participants, ok := m.resolveRoomFromRequest(c, req.UserID)
+	if !ok {
+		return
+	}
+	if m.client == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "llm client not configured"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	balance, err := m.getUserTokenBalance(ctx, room.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load token balance"})
+		}
+		return
+	}
+	if balance <= 0 {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient token balance"})
+		return
+	}
+
+	userMsg, err := m.appendRoomMessage(ctx, room.ID, chatRoomMessage{Role: "user", Content: content})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create message", "details": err.Error()})
+		return
+	}
+
+	names := participantNames(participants)
+	userRecord := roomMessageToRecord(userMsg, names)
+
+	history, err := m.loadRoomHistory(ctx, room.ID, roomHistoryLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages", "details": err.Error()})
+		return
+	}
+
+	speakers := m.selectRoomSpeakers(ctx, room, participants, history, content)
+
+	if wantsEventStream(c) {
+		if flusher, ok := c.Writer.(http.Flusher); ok {
+			m.streamRoomReplies(c, flusher, room, participants, speakers, userRecord, history, balance)
+			return
+		}
+	}
+
+	response := createRoomMessageResponse{RoomID: room.ID, UserMessage: userRecord}
+	remaining := balance
+	var tokensUsed int64
+	for _, speaker := range speakers {
+		if remaining <= 0 {
+			response.Errors = append(response.Errors, "insufficient token balance")
+			break
+		}
+		reply, usage, genErr := m.generateRoomReply(ctx, room, speaker, participants, history, nil)
+		if usage != nil {
+			tokensUsed += totalTokensUsed(usage)
+			updated, err := m.applyUsageToUserTokens(context.WithoutCancel(ctx), room.UserID, usage, remaining)
+			if err != nil {
+				log.Printf("llm: failed to apply room token usage: %v", err)
+			} else {
+				remaining = updated
+			}
+		}
+		if genErr != nil {
+			response.Errors = append(response.Errors, fmt.Sprintf("%s: %s", speaker.agent.Name, genErr.Error()))
+			continue
+		}
+		history = append(history, reply)
+		response.Replies = append(response.Replies, roomMessageToRecord(reply, names))
+	}
+
+	if remaining < 0 {
+		remaining = 0
+	}
+	response.TokenBalance = int64Pointer(remaining)
+	if ptr := intPointerIfPositive(int(tokensUsed)); ptr != nil {
+		response.TokensUsed = ptr
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// streamRoomReplies 以 SSE 形式依次输出各智能体的回复。
+func (m *Module) streamRoomReplies(
+	c *gin.Context,
+	flusher http.Flusher,
+	room *chatRoom,
+	participants []roomParticipant,
+	speakers []roomParticipant,
+	userRecord roomMessageRecord,
+	history []chatRoomMessage,
+	balance int64,
+) {
+	ctx := c.Request.Context()
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache, no-transform")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Status(http.StatusCreated)
+
+	writer := newSafeSSEWriter(c.Writer, flusher)
+	flusher.Flush()
+
+	if err := writer.Send("user_message", userRecord); err != nil {
+		return
+	}
+
+	names := participantNames(participants)
+	remaining := balance
+
+	for turn, speaker := range speakers {
+		if remaining <= 0 {
+			_ = writer.Send("error", gin.H{"error": "insufficient token balance"})
+			break
+		}
+
+		agentID := speaker.agent.ID
+		turnPayload := gin.H{
+			"room_id":    room.ID,
+			"turn":       turn,
+			"agent_id":   agentID,
+			"agent_name": speaker.agent.Name,
+		}
+		if speaker.agent.Live2DModelID != nil {
+			turnPayload["live2d_model_id"] = *speaker.agent.Live2DModelID
+		}
+		selection := resolveVoiceSelection(stringValue(speaker.agent.VoiceID), stringValue(speaker.agent.VoiceProvider), m.tts)
+		if selection.ID != "" {
+			turnPayload["voice_id"] = selection.ID
+			turnPayload["voice_provider"] = selection.Provider
+		}
+		if err := writer.Send("agent_turn_started", turnPayload); err != nil {
+			return
+		}
+
+		motions := m.loadAgentMotions(ctx, &speaker.agent)
+		builder := newEmotionTimelineBuilder("", 1.0, motions)
+		// 存在风格硬性规则时缓冲增量，执行规则后再整体下发，避免违禁内容先到达客户端。
+		buffered := parseStyleGuide(speaker.config).HasHardRules()
+		onDelta := func(delta ChatStreamDelta) error {
+			if buffered || (delta.Content == "" && !delta.Done) {
+				return nil
+			}
+			payload := gin.H{
+				"room_id":  room.ID,
+				"agent_id": agentID,
+				"full":     delta.FullContent,
+			}
+			if delta.Content != "" {
+				payload["delta"] = delta.Content
+			}
+			if delta.Done {
+				payload["done"] = true
+			}
+			if err := writer.Send("assistant_delta", payload); err != nil {
+				return err
+			}
+			for _, cue := range builder.advance(delta.FullContent, delta.Done) {
+				if err := writer.Send("emotion_cue", gin.H{"room_id": room.ID, "agent_id": agentID, "cue": cue}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		reply, usage, genErr := m.generateRoomReply(ctx, room, speaker, participants, history, onDelta)
+		if usage != nil {
+			updated, err := m.applyUsageToUserTokens(context.WithoutCancel(ctx), room.UserID, usage, remaining)
+			if err != nil {
+				log.Printf("llm: failed to apply room token usage: %v", err)
+			} else {
+				remaining = updated
+			}
+			payload := gin.H{"token_balance": max(remaining, 0)}
+			if used := totalTokensUsed(usage); used > 0 {
+				payload["tokens_used"] = used
+			}
+			if err := writer.Send("token_update", payload); err != nil {
+				return
+			}
+		}
+		if genErr != nil {
+			if err := writer.Send("error", gin.H{"room_id": room.ID, "agent_id": agentID, "error": genErr.Error()}); err != nil {
+				return
+			}
+			continue
+		}
+
+		if buffered {
+			if err := writer.Send("assistant_delta", gin.H{
+				"room_id":  room.ID,
+				"agent_id": agentID,
+				"delta":    reply.Content,
+				"full":     reply.Content,
+				"done":     true,
+			}); err != nil {
+				return
+			}
+			for _, cue := range builder.advance(reply.Content, true) {
+				if err := writer.Send("emotion_cue", gin.H{"room_id": room.ID, "agent_id": agentID, "cue": cue}); err != nil {
+					return
+				}
+			}
+		}
+
+		history = append(history, reply)
+		if err := writer.Send("assistant_message", roomMessageToRecord(reply, names)); err != nil {
+			return
+		}
+	}
+
+	_ = writer.Send("done", gin.H{"room_id": room.ID})
+}
+
+// generateRoomReply 以指定智能体身份生成一条群聊回复并落库。
+func (m *Module) generateRoomReply(
+	ctx context.Context,
+	room *chatRoom,
+	speaker roomParticipant,
+	participants []roomParticipant,
+	history []chatRoomMessage,
+	onDelta func(ChatStreamDelta) error,
+) (chatRoomMessage, *ChatUsage, error) {
+	messages := buildRoomChatMessages(speaker, participants, history, m.promptVars(ctx, &speaker.agent, room.UserID))
+	modelName := ""
+	if speaker.config != nil {
+		modelName = m.modelForPlan(m.userPlan(ctx, room.UserID), speaker.config.ModelName)
+	}
+
+	start := time.Now()
+	var (
+		result    ChatResult
+		err       error
+		generated strings.Builder
+	)
+	if onDelta != nil {
+		result, err = m.client.ChatStream(ctx, messages, modelName, func(delta ChatStreamDelta) error {
+			generated.WriteString(delta.Content)
+			return onDelta(delta)
+		})
+		// 已有增量送达或请求已取消时不再回退，避免重复输出。
+		if err != nil && generated.Len() == 0 && ctx.Err() == nil {
+			log.Printf("llm: room streaming fallback to non-streaming: %v", err)
+			result, err = m.client.Chat(ctx, messages, modelName)
+			if err == nil {
+				_ = onDelta(ChatStreamDelta{Content: result.Content, FullContent: result.Content, Done: true})
+			}
+		}
+	} else {
+		result, err = m.client.Chat(ctx, messages, modelName)
+	}
+	if err != nil {
+		// 中途取消或失败时已生成的增量已经送达，按已生成部分估算用量。
+		return chatRoomMessage{}, estimateChatUsage(messages, generated.String()), err
+	}
+	if result.Usage == nil {
+		result.Usage = estimateChatUsage(messages, result.Content)
+	}
+
+	reply := strings.TrimSpace(result.Content)
+	if reply == "" {
+		return chatRoomMessage{}, result.Usage, errors.New("assistant reply empty")
+	}
+	reply, styleApplied := applyStyleGuide(speaker.config, reply)
+
+	selection := resolveVoiceSelection(stringValue(speaker.agent.VoiceID), stringValue(speaker.agent.VoiceProvider), m.tts)
+	motions := m.loadAgentMotions(ctx, &speaker.agent)
+	emotionMeta := motions.annotate(inferEmotion(reply, ""))
+	timeline := buildEmotionTimeline(reply, "", 1.0, motions)
+	refinement := m.startEmotionRefinement(timeline, modelName)
+
+	extras := map[string]any{
+		"agent_name": speaker.agent.Name,
+	}
+	if speaker.agent.Live2DModelID != nil {
+		extras["live2d_model_id"] = *speaker.agent.Live2DModelID
+	}
+	if len(styleApplied) > 0 {
+		extras["style_enforced"] = styleApplied
+	}
+	if emotionMeta != nil {
+		extras["emotion"] = emotionMeta
+	}
+	if timeline != nil {
+		extras["emotion_timeline"] = timeline
+	}
+	if selection.ID != "" {
+		prefsMap := map[string]any{"voice_id": selection.ID}
+		if selection.Provider != "" {
+			prefsMap["provider"] = selection.Provider
+		}
+		extras["speech_preferences"] = prefsMap
+	}
+	speechEnabled := m.tts != nil && m.tts.Enabled()
+	if speechEnabled {
+		extras["speech_status"] = "pending"
+	}
+
+	agentID := speaker.agent.ID
+	latency := int(time.Since(start).Milliseconds())
+	msg := chatRoomMessage{
+		Role:    "assistant",
+		AgentID: &agentID,
+		Content: reply,
+	}
+	if latency > 0 {
+		msg.LatencyMs = &latency
+	}
+	if result.Usage != nil {
+		msg.TokenInput = intPointerIfPositive(result.Usage.PromptTokens)
+		msg.TokenOutput = intPointerIfPositive(result.Usage.CompletionTokens)
+	}
+	if raw, marshalErr := json.Marshal(extras); marshalErr != nil {
+		log.Printf("llm: marshal room message extras: %v", marshalErr)
+	} else {
+		msg.Extras = datatypes.JSON(raw)
+	}
+
+	saved, err := m.appendRoomMessage(ctx, room.ID, msg)
+	if err != nil {
+		return chatRoomMessage{}, result.Usage, err
+	}
+
+	if result.Usage != nil {
+		m.incrementRoomTokens(ctx, room.ID, result.Usage)
+	}
+	m.storeEmotionRefinementAsync(&chatRoomMessage{}, saved.ID, refinement, motions)
+
+	if speechEnabled {
+		m.enqueueSpeechSynthesisFor(&chatRoomMessage{}, saved.ID, reply, selection, 1.0, 1.0, emotionMeta)
+	}
+
+	return saved, result.Usage, nil
+}
+
+// buildRoomChatMessages 为当前发言的智能体构建群聊上下文。
+func buildRoomChatMessages(speaker roomParticipant, participants []roomParticipant, history []chatRoomMessage, vars agents.PromptVars) []ChatMessage {
+	names := participantNames(participants)
+	others := make([]string, 0, len(participants))
+	for _, p := range participants {
+		if p.agent.ID == speaker.agent.ID {
+			continue
+		}
+		others = append(others, p.agent.Name)
+	}
+
+	systemPrompt := buildSystemPrompt(&speaker.agent, speaker.config, vars, "")
+	groupNote := fmt.Sprintf(
+		"You are in a group chat with the user and these other characters: %s. Messages from other characters are prefixed with their names in brackets. Speak only as %s, keep the reply concise, and do not prefix it with your own name.",
+		strings.Join(others, ", "),
+		speaker.agent.Name,
+	)
+
+	messages := make([]ChatMessage, 0, len(history)+2)
+	messages = append(messages, ChatMessage{Role: "system", Content: systemPrompt})
+	messages = append(messages, ChatMessage{Role: "system", Content: groupNote})
+
+	for _, item := range history {
+		switch item.Role {
+		case "user":
+			messages = append(messages, ChatMessage{Role: "user", Content: item.Content})
+		case "assistant":
+			if item.AgentID != nil && *item.AgentID == speaker.agent.ID {
+				messages = append(messages, ChatMessage{Role: "assistant", Content: item.Content})
+				continue
+			}
+			name := "Another character"
+			if item.AgentID != nil {
+				if n, ok := names[*item.AgentID]; ok {
+					name = n
+				}
+			}
+			messages = append(messages, ChatMessage{Role: "user", Content: fmt.Sprintf("[%s]: %s", name, item.Content)})
+		}
+	}
+
+	return messages
+}
+
+// selectRoomSpeakers 按房间策略挑选本轮需要回复的智能体。
+func (m *Module) selectRoomSpeakers(ctx context.Context, room *chatRoom, participants []roomParticipant, history []chatRoomMessage, content string) []roomParticipant {
+	if len(participants) == 0 {
+		return nil
+	}
+
+	var speakers []roomParticipant
+	switch room.TurnPolicy {
+	case roomPolicyAddressed:
+		speakers = addressedParticipants(content, participants)
+	case roomPolicyModerator:
+		if chosen, ok := m.moderatorPick(ctx, room, participants, history); ok {
+			speakers = []roomParticipant{chosen}
+		}
+	}
+
+	if len(speakers) == 0 {
+		next := room.NextTurn
+		if next < 0 {
+			next = 0
+		}
+		speakers = []roomParticipant{participants[next%len(participants)]}
+	}
+
+	last := speakers[len(speakers)-1]
+	nextTurn := (last.position + 1) % len(participants)
+	if err := m.db.WithContext(ctx).Model(&chatRoom{}).Where("id = ?", room.ID).Update("next_turn", nextTurn).Error; err != nil {
+		log.Printf("llm: update room turn failed: %v", err)
+	} else {
+		room.NextTurn = nextTurn
+	}
+
+	return speakers
+}
+
+// addressedParticipants 根据消息中提及的名称找到被点名的智能体。
+func addressedParticipants(content string, participants []roomParticipant) []roomParticipant {
+	lower := strings.ToLower(content)
+	type hit struct {
+		participant roomParticipant
+		index       int
+	}
+	hits := make([]hit, 0, len(participants))
+	for _, p := range participants {
+		candidates := []string{p.agent.Name}
+		if p.agent.TitleAddress != nil {
+			candidates = append(candidates, *p.agent.TitleAddress)
+		}
+		best := -1
+		for _, name := range candidates {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if idx := strings.Index(lower, name); idx >= 0 && (best < 0 || idx < best) {
+				best = idx
+			}
+		}
+		if best >= 0 {
+			hits = append(hits, hit{participant: p, index: best})
+		}
+	}
+	for i := 1; i < len(hits); i++ {
+		for j := i; j > 0 && hits[j].index < hits[j-1].index; j-- {
+			hits[j], hits[j-1] = hits[j-1], hits[j]
+		}
+	}
+	out := make([]roomParticipant, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, h.participant)
+	}
+	return out
+}
+
+// moderatorPick 由主持模型根据上下文选择下一位发言的智能体。
+func (m *Module) moderatorPick(ctx context.Context, room *chatRoom, participants []roomParticipant, history []chatRoomMessage) (roomParticipant, bool) {
+	if m.client == nil {
+		return roomParticipant{}, false
+	}
+
+	names := participantNames(participants)
+	var roster strings.Builder
+	for _, p := range participants {
+		roster.WriteString(fmt.Sprintf("- id=%d name=%s", p.agent.ID, p.agent.Name))
+		if p.agent.OneSentenceIntro != nil {
+			if intro := strings.TrimSpace(*p.agent.OneSentenceIntro); intro != "" {
+				roster.WriteString(": " + truncateString(intro, 120))
+			}
+		}
+		roster.WriteByte('\n')
+	}
+
+	var transcript strings.Builder
+	start := 0
+	if len(history) > 10 {
+		start = len(history) - 10
+	}
+	for _, item := range history[start:] {
+		speaker := "User"
+		if item.Role == "assistant" && item.AgentID != nil {
+			speaker = names[*item.AgentID]
+		}
+		transcript.WriteString(speaker + ": " + truncateString(item.Content, 300) + "\n")
+	}
+
+	modelName := ""
+	if room.ModeratorAgentID != nil {
+		for _, p := range participants {
+			if p.agent.ID == *room.ModeratorAgentID && p.config != nil {
+				modelName = m.modelForPlan(m.userPlan(ctx, room.UserID), p.config.ModelName)
+			}
+		}
+	}
+
+	pickCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := m.client.Chat(pickCtx, []ChatMessage{
+		{Role: "system", Content: "You moderate a group chat between a user and several characters. Choose the single character who should reply next. Answer with the character id only.\nCharacters:\n" + roster.String()},
+		{Role: "user", Content: transcript.String()},
+	}, modelName)
+	if err != nil {
+		log.Printf("llm: room moderator request failed: %v", err)
+		return roomParticipant{}, false
+	}
+
+	answer := strings.TrimSpace(result.Content)
+	digits := strings.TrimFunc(answer, func(r rune) bool { return r < '0' || r > '9' })
+	if id, err := strconv.ParseUint(digits, 10, 64); err == nil {
+		for _, p := range participants {
+			if p.agent.ID == id {
+				return p, true
+			}
+		}
+	}
+	if hits := addressedParticipants(answer, participants); len(hits) > 0 {
+		return hits[0], true
+	}
+	return roomParticipant{}, false
+}
+
+// resolveRoomFromRequest 解析路径中的房间并校验归属用户。
+func (m *Module) resolveRoomFromRequest(c *gin.Context, rawUserID string) (*chatRoom, []roomParticipant, bool) {
+	if m.db == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database not initialized"})
+		return nil, nil, false
+	}
+
+	roomID, err := parsePositiveUint(c.Param("id"), "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	userID, ok := requestUserID(c, rawUserID)
+	if !ok {
+		return nil, nil, false
+	}
+
+	ctx := c.Request.Context()
+
+	var room chatRoom
+	if err := m.db.WithContext(ctx).Where("id = ? AND user_id = ?", roomID, userID).Take(&room).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load room", "details": err.Error()})
+		}
+		return nil, nil, false
+	}
+
+	participants, err := m.loadRoomParticipants(ctx, room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load participants", "details": err.Error()})
+		return nil, nil, false
+	}
+	if len(participants) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "room has no available agents"})
+		return nil, nil, false
+	}
+
+	return &room, participants, true
+}
+
+// loadRoomParticipants 按发言顺序加载房间内的智能体及其配置。
+func (m *Module) loadRoomParticipants(ctx context.Context, roomID uint64) ([]roomParticipant, error) {
+	var rows []chatRoomParticipant
+	if err := m.db.WithContext(ctx).Where("room_id = ?", roomID).Order("position ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint64, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.AgentID)
+	}
+
+	var agentList []agents.Agent
+	if err := m.db.WithContext(ctx).Where("id IN ?", ids).Find(&agentList).Error; err != nil {
+		return nil, err
+	}
+	agentByID := make(map[uint64]agents.Agent, len(agentList))
+	for _, agent := range agentList {
+		agentByID[agent.ID] = agent
+	}
+
+	var configs []agents.AgentChatConfig
+	if err := m.db.WithContext(ctx).Where("agent_id IN ?", ids).Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	configByID := make(map[uint64]*agents.AgentChatConfig, len(configs))
+	for i := range configs {
+		configByID[configs[i].AgentID] = &configs[i]
+	}
+
+	participants := make([]roomParticipant, 0, len(rows))
+	for idx, row := range rows {
+		agent, ok := agentByID[row.AgentID]
+		if !ok {
+			continue
+		}
+		participants = append(participants, roomParticipant{
+			agent:    agent,
+			config:   configByID[row.AgentID],
+			position: idx,
+		})
+	}
+	for idx := range participants {
+		participants[idx].position = idx
+	}
+	return participants, nil
+}
+
+// loadRoomHistory 按时间顺序加载房间最近的消息。
+func (m *Module) loadRoomHistory(ctx context.Context, roomID uint64, limit int) ([]chatRoomMessage, error) {
+	var history []chatRoomMessage
+	if err := m.db.WithContext(ctx).
+		Where("room_id = ?", roomID).
+		Order("seq DESC").
+		Limit(limit).
+		Find(&history).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
+
+// appendRoomMessage 以递增序号写入一条群聊消息。
+func (m *Module) appendRoomMessage(ctx context.Context, roomID uint64, msg chatRoomMessage) (chatRoomMessage, error) {
+	msg.RoomID = roomID
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var lastSeq int
+		if err := tx.Model(&chatRoomMessage{}).Where("room_id = ?", roomID).Select("COALESCE(MAX(seq), 0)").Scan(&lastSeq).Error; err != nil {
+			return err
+		}
+		msg.Seq = lastSeq + 1
+		if err := tx.Create(&msg).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&msg, "id = ?", msg.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&chatRoom{}).Where("id = ?", roomID).Update("last_msg_at", time.Now().UTC()).Error
+	})
+	return msg, err
+}
+
+// incrementRoomTokens 累积房间的输入输出 token 统计。
+func (m *Module) incrementRoomTokens(ctx context.Context, roomID uint64, usage *ChatUsage) {
+	updates := make(map[string]any, 2)
+	if usage.PromptTokens > 0 {
+		updates["token_input_sum"] = gorm.Expr("COALESCE(token_input_sum, 0) + ?", usage.PromptTokens)
+	}
+	if usage.CompletionTokens > 0 {
+		updates["token_output_sum"] = gorm.Expr("COALESCE(token_output_sum, 0) + ?", usage.CompletionTokens)
+	}
+	if len(updates) == 0 {
+		return
+	}
+	if err := m.db.WithContext(ctx).Model(&chatRoom{}).Where("id = ?", roomID).Updates(updates).Error; err != nil {
+		log.Printf("llm: failed to update room token sums: %v", err)
+	}
+}
+
+// participantNames 构建智能体 ID 到名称的映射。
+func participantNames(participants []roomParticipant) map[uint64]string {
+	names := make(map[uint64]string, len(participants))
+	for _, p := range participants {
+		names[p.agent.ID] = p.agent.Name
+	}
+	return names
+}
+
+// buildRoomRecord 将房间模型转换为响应结构。
+func buildRoomRecord(room chatRoom, participants []roomParticipant) roomRecord {
+	records := make([]roomParticipantRecord, 0, len(participants))
+	for _, p := range participants {
+		records = append(records, roomParticipantRecord{
+			AgentID:       p.agent.ID,
+			Name:          p.agent.Name,
+			AvatarURL:     p.agent.AvatarURL,
+			VoiceID:       p.agent.VoiceID,
+			VoiceProvider: p.agent.VoiceProvider,
+			Live2DModelID: p.agent.Live2DModelID,
+			Position:      p.position,
+		})
+	}
+	return roomRecord{
+		ID:               room.ID,
+		UserID:           room.UserID,
+		Title:            room.Title,
+		TurnPolicy:       room.TurnPolicy,
+		ModeratorAgentID: room.ModeratorAgentID,
+		Status:           room.Status,
+		Participants:     records,
+		LastMsgAt:        room.LastMsgAt,
+		CreatedAt:        room.CreatedAt,
+	}
+}
+
+// roomMessageToRecord 将群聊消息转换为响应结构并附带发言者名称。
+func roomMessageToRecord(msg chatRoomMessage, names map[uint64]string) roomMessageRecord {
+	record := roomMessageRecord{
+		ID:          msg.ID,
+		RoomID:      msg.RoomID,
+		Seq:         msg.Seq,
+		Role:        msg.Role,
+		AgentID:     msg.AgentID,
+		Content:     msg.Content,
+		LatencyMs:   msg.LatencyMs,
+		TokenInput:  msg.TokenInput,
+		TokenOutput: msg.TokenOutput,
+		ErrCode:     msg.ErrCode,
+		ErrMsg:      msg.ErrMsg,
+		Extras:      toRawMessage(msg.Extras),
+		CreatedAt:   msg.CreatedAt,
+	}
+	if msg.AgentID != nil {
+		record.AgentName = names[*msg.AgentID]
+	}
+	return record
+}
+
+// stringValue 返回字符串指针的去空白值。
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(*value)
+}
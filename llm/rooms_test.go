@@ -0,0 +1,194 @@
+package llm
+
+import (
+	"auralis_back/agents"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestChatClient 创建指向 httptest 服务的客户端，服务对每次请求返回 reply 作为完整回复。
+func newTestChatClient(t *testing.T, reply string) *ChatClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": reply}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return &ChatClient{httpClient: server.Client(), baseURL: server.URL, defaultModel: "test-model"}
+}
+
+// testRoomParticipants 创建按顺序编号的参与者，titles 可为空。
+func testRoomParticipants(names []string, titles map[string]string) []roomParticipant {
+	participants := make([]roomParticipant, 0, len(names))
+	for i, name := range names {
+		agent := agents.Agent{ID: uint64(i + 1), Name: name}
+		if title, ok := titles[name]; ok {
+			agent.TitleAddress = &title
+		}
+		participants = append(participants, roomParticipant{agent: agent, position: i})
+	}
+	return participants
+}
+
+func participantIDs(participants []roomParticipant) []uint64 {
+	ids := make([]uint64, 0, len(participants))
+	for _, p := range participants {
+		ids = append(ids, p.agent.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAddressedParticipants(t *testing.T) {
+	participants := testRoomParticipants([]string{"Alice", "Bob", "Carol"}, map[string]string{"Carol": "Captain"})
+
+	tests := []struct {
+		name    string
+		content string
+		want    []uint64
+	}{
+		{"no mention", "hello everyone", []uint64{}},
+		{"single mention", "what do you think, bob?", []uint64{2}},
+		{"mention order", "Bob first, then ALICE", []uint64{2, 1}},
+		{"title address", "captain, report", []uint64{3}},
+		{"name and title count once", "Carol, I mean Captain", []uint64{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := participantIDs(addressedParticipants(tt.content, participants)); !equalIDs(got, tt.want) {
+				t.Errorf("addressedParticipants(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRoomPolicy(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   string
+		wantOK bool
+	}{
+		{"", roomPolicyRoundRobin, true},
+		{"Round-Robin", roomPolicyRoundRobin, true},
+		{"mention", roomPolicyAddressed, true},
+		{" moderated ", roomPolicyModerator, true},
+		{"random", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeRoomPolicy(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("normalizeRoomPolicy(%q) = %q, %v; want %q, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// newRoomTestModule 基于内存 SQLite 创建房间并返回模块。
+func newRoomTestModule(t *testing.T, policy string, client *ChatClient) (*Module, *chatRoom) {
+	t.Helper()
+	db, err := openDatabase("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&chatRoom{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	room := &chatRoom{UserID: 1, TurnPolicy: policy, Status: "active"}
+	mustCreate(t, db, room)
+	return &Module{db: db, client: client}, room
+}
+
+func TestSelectRoomSpeakers(t *testing.T) {
+	participants := testRoomParticipants([]string{"Alice", "Bob", "Carol"}, nil)
+
+	tests := []struct {
+		name      string
+		policy    string
+		moderator string
+		turns     []string
+		want      [][]uint64
+		wantNext  int
+	}{
+		{
+			name:     "round robin rotates and wraps",
+			policy:   roomPolicyRoundRobin,
+			turns:    []string{"hi", "hi", "hi", "hi"},
+			want:     [][]uint64{{1}, {2}, {3}, {1}},
+			wantNext: 1,
+		},
+		{
+			name:     "addressed replies in mention order",
+			policy:   roomPolicyAddressed,
+			turns:    []string{"carol and alice?", "anyone?"},
+			want:     [][]uint64{{3, 1}, {2}},
+			wantNext: 2,
+		},
+		{
+			name:      "moderator picks by id",
+			policy:    roomPolicyModerator,
+			moderator: "3",
+			turns:     []string{"hi", "hi"},
+			want:      [][]uint64{{3}, {3}},
+			wantNext:  0,
+		},
+		{
+			name:      "moderator picks by name",
+			policy:    roomPolicyModerator,
+			moderator: "Bob should answer.",
+			turns:     []string{"hi"},
+			want:      [][]uint64{{2}},
+			wantNext:  2,
+		},
+		{
+			name:      "unusable moderator answer falls back to rotation",
+			policy:    roomPolicyModerator,
+			moderator: "nobody",
+			turns:     []string{"hi", "hi"},
+			want:      [][]uint64{{1}, {2}},
+			wantNext:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client *ChatClient
+			if tt.moderator != "" {
+				client = newTestChatClient(t, tt.moderator)
+			}
+			m, room := newRoomTestModule(t, tt.policy, client)
+			for i, content := range tt.turns {
+				got := participantIDs(m.selectRoomSpeakers(context.Background(), room, participants, nil, content))
+				if !equalIDs(got, tt.want[i]) {
+					t.Errorf("turn %d speakers = %v, want %v", i, got, tt.want[i])
+				}
+			}
+
+			var stored chatRoom
+			if err := m.db.First(&stored, room.ID).Error; err != nil {
+				t.Fatalf("load room: %v", err)
+			}
+			if stored.NextTurn != tt.wantNext || room.NextTurn != tt.wantNext {
+				t.Errorf("next turn = %d (stored %d), want %d", room.NextTurn, stored.NextTurn, tt.wantNext)
+			}
+		})
+	}
+}
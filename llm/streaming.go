@@ -2,6 +2,7 @@ package llm
 
 import (
 	"auralis_back/agents"
+	"auralis_back/authorization"
 	knowledge "auralis_back/knowledge"
 	"auralis_back/tts"
 	"bytes"
@@ -86,6 +87,9 @@ type conversationContext struct {
 	history   []message
 	messages  []ChatMessage
 	knowledge []knowledge.ContextSnippet
+	plan      authorization.Plan
+	motions   motionCatalog
+	lang      string // 会话语言，为空时沿用智能体的默认语言
 }
 
 func (c *conversationContext) modelName() string {
@@ -101,6 +105,14 @@ func (m *Module) buildConversationContext(ctx context.Context, conv conversation
 	if err := m.db.WithContext(ctx).First(&agentModel, "id = ?", conv.AgentID).Error; err != nil {
 		return nil, fmt.Errorf("load agent: %w", err)
 	}
+	// 会话语言单独保存，agentModel.LangDefault 保持智能体的创作语言，供翻译判断源语言。
+	var lang string
+	if conv.Lang != nil && strings.TrimSpace(*conv.Lang) != "" {
+		lang = strings.TrimSpace(*conv.Lang)
+		if _, err := agents.LocalizeAgent(ctx, m.db, &agentModel, []string{lang}); err != nil {
+			log.Printf("llm: localize agent %d for %s failed: %v", conv.AgentID, lang, err)
+		}
+	}
 
 	var cfg agents.AgentChatConfig
 	cfgErr := m.db.WithContext(ctx).First(&cfg, "agent_id = ?", conv.AgentID).Error
@@ -111,6 +123,11 @@ func (m *Module) buildConversationContext(ctx context.Context, conv conversation
 		return nil, fmt.Errorf("load agent config: %w", cfgErr)
 	}
 
+	plan := m.userPlan(ctx, conv.UserID)
+	if cfgPtr != nil {
+		cfgPtr.ModelName = m.modelForPlan(plan, cfgPtr.ModelName)
+	}
+
 	limit := 20
 	if m.memory != nil {
 		limit = m.memory.recentMessageLimit()
@@ -147,7 +164,7 @@ func (m *Module) buildConversationContext(ctx context.Context, conv conversation
 		profile = prof
 	}
 
-	systemPrompt := buildSystemPrompt(&agentModel, cfgPtr)
+	systemPrompt := buildSystemPrompt(&agentModel, cfgPtr, m.promptVars(ctx, &agentModel, conv.UserID), lang)
 
 	messages := make([]ChatMessage, 0, len(history)+3)
 	if systemPrompt != "" {
@@ -175,6 +192,9 @@ func (m *Module) buildConversationContext(ctx context.Context, conv conversation
 		summary:  summaryText,
 		history:  history,
 		messages: messages,
+		plan:     plan,
+		motions:  m.loadAgentMotions(ctx, &agentModel),
+		lang:     lang,
 	}, nil
 }
 
@@ -336,6 +356,11 @@ func (m *Module) createAssistantPlaceholder(ctx context.Context, conv conversati
 
 // enqueueSpeechSynthesis 将语音合成任务加入队列。
 func (m *Module) enqueueSpeechSynthesis(msgID uint64, conv conversation, content string, selection voiceSelection, speed, pitch float64, emotion *emotionMetadata) {
+	m.enqueueSpeechSynthesisFor(&message{}, msgID, content, selection, speed, pitch, emotion)
+}
+
+// enqueueSpeechSynthesisFor 异步合成语音并写回指定消息表的扩展字段。
+func (m *Module) enqueueSpeechSynthesisFor(target any, msgID uint64, content string, selection voiceSelection, speed, pitch float64, emotion *emotionMetadata) {
 	if m.tts == nil || !m.tts.Enabled() {
 		return
 	}
@@ -373,6 +398,9 @@ func (m *Module) enqueueSpeechSynthesis(msgID uint64, conv conversation, content
 			log.Printf("llm: synthesize speech async failed: %v", err)
 		} else if result != nil {
 			result.AudioURL = ""
+			if result.DurationMs <= 0 {
+				result.DurationMs = speechResultDurationMs(result)
+			}
 			updates["speech"] = result.AsMap()
 			if strings.TrimSpace(result.Provider) != "" {
 				providerLocal = normalizeVoiceProvider(result.Provider)
@@ -386,8 +414,14 @@ func (m *Module) enqueueSpeechSynthesis(msgID uint64, conv conversation, content
 		dbCtx, cancelDB := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancelDB()
 
-		var msg message
-		if err := m.db.WithContext(dbCtx).First(&msg, "id = ?", msgID).Error; err != nil {
+		// 与情绪标注回写串行，避免并发读改写互相覆盖扩展字段。
+		m.extrasMu.Lock()
+		defer m.extrasMu.Unlock()
+
+		var msg struct {
+			Extras datatypes.JSON
+		}
+		if err := m.db.WithContext(dbCtx).Model(target).Select("extras").Where("id = ?", msgID).Take(&msg).Error; err != nil {
 			log.Printf("llm: load message for speech update failed: %v", err)
 			return
 		}
@@ -403,6 +437,12 @@ func (m *Module) enqueueSpeechSynthesis(msgID uint64, conv conversation, content
 		for k, v := range updates {
 			extrasMap[k] = v
 		}
+		if result != nil && err == nil {
+			if timeline := timelineFromExtras(extrasMap); timeline != nil {
+				alignEmotionTimeline(timeline, result.DurationMs, speed)
+				extrasMap["emotion_timeline"] = timeline
+			}
+		}
 		prefsMap, ok := extrasMap["speech_preferences"].(map[string]any)
 		if !ok || prefsMap == nil {
 			prefsMap = make(map[string]any)
@@ -425,7 +465,7 @@ func (m *Module) enqueueSpeechSynthesis(msgID uint64, conv conversation, content
 			return
 		}
 
-		if err := m.db.WithContext(dbCtx).Model(&message{}).Where("id = ?", msgID).Update("extras", datatypes.JSON(raw)).Error; err != nil {
+		if err := m.db.WithContext(dbCtx).Model(target).Where("id = ?", msgID).Update("extras", datatypes.JSON(raw)).Error; err != nil {
 			log.Printf("llm: update message extras with speech failed: %v", err)
 			return
 		}
@@ -506,17 +546,26 @@ func (m *Module) handleCreateMessageStream(
 
 	applyPreferenceDefaults(&prefs, contextData)
 
+	plan := m.planTranslation(conv, contextData, userMsg.Content)
+	if plan != nil {
+		contextData.messages = append(contextData.messages, ChatMessage{Role: "system", Content: plan.instruction()})
+	}
+
 	prefs.Speed = sanitizeSpeed(prefs.Speed)
 	prefs.Pitch = sanitizePitch(prefs.Pitch)
 	prefs.EmotionHint = strings.TrimSpace(prefs.EmotionHint)
 
 	selection := resolveVoiceSelection(prefs.VoiceID, prefs.Provider, m.tts)
+	if plan != nil {
+		selection = voiceForLanguage(m.tts, selection, plan.Target)
+	}
 	prefs.Provider = selection.Provider
 	if strings.TrimSpace(prefs.VoiceID) == "" {
 		prefs.VoiceID = selection.ID
 	}
 
 	speechEnabled := m.tts != nil && m.tts.Enabled()
+	emotionBuilder := newEmotionTimelineBuilder(prefs.EmotionHint, prefs.Speed, contextData.motions)
 
 	placeholder, err := m.createAssistantPlaceholder(ctx, conv, userMsg)
 	if err != nil {
@@ -617,7 +666,7 @@ func (m *Module) handleCreateMessageStream(
 		}
 	}
 
-	if speechEnabled && streamingSynth != nil && selection.Provider == "aliyun-cosyvoice" && selection.ID != "" {
+	if speechEnabled && streamingSynth != nil && plan == nil && contextData.plan.StreamingTTS && selection.Provider == "aliyun-cosyvoice" && selection.ID != "" {
 		req := tts.SpeechStreamRequest{
 			VoiceID:       selection.ID,
 			Provider:      selection.Provider,
@@ -709,6 +758,15 @@ func (m *Module) handleCreateMessageStream(
 
 	needAsyncSpeech := speechEnabled && !streamStarted
 
+	sendEmotionCues := func(cues []emotionCue) error {
+		for _, cue := range cues {
+			if err := writer.Send("emotion_cue", gin.H{"id": placeholder.ID, "cue": cue}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	streamHandler := func(delta ChatStreamDelta) error {
 		if delta.Content != "" {
 			if err := updateContent(delta.FullContent); err != nil {
@@ -746,7 +804,10 @@ func (m *Module) handleCreateMessageStream(
 		if delta.Done {
 			payload["done"] = true
 		}
-		return writer.Send("assistant_delta", payload)
+		if err := writer.Send("assistant_delta", payload); err != nil {
+			return err
+		}
+		return sendEmotionCues(emotionBuilder.advance(delta.FullContent, delta.Done))
 	}
 
 	streamResult, streamErr := m.client.ChatStream(ctx, contextData.messages, modelName, streamHandler)
@@ -761,6 +822,7 @@ func (m *Module) handleCreateMessageStream(
 		}
 		reply = fallback.Content
 		usage = fallback.Usage
+		emotionBuilder = newEmotionTimelineBuilder(prefs.EmotionHint, prefs.Speed, contextData.motions)
 		if err := updateContent(reply); err != nil {
 			_ = writer.Send("error", gin.H{"error": "failed to update assistant message"})
 			return
@@ -783,6 +845,30 @@ func (m *Module) handleCreateMessageStream(
 		return
 	}
 
+	styledReply, styleApplied := applyStyleGuide(contextData.config, reply)
+	translatedReply, usage, translationMeta := m.applyTranslation(ctx, plan, styledReply, modelName, usage)
+	if len(styleApplied) > 0 || translationMeta != nil {
+		reply = translatedReply
+		if err := updateContent(reply); err != nil {
+			log.Printf("llm: failed to store post-processed reply: %v", err)
+		}
+		payload := gin.H{
+			"id":      placeholder.ID,
+			"full":    reply,
+			"replace": true,
+		}
+		if len(styleApplied) > 0 {
+			payload["style_enforced"] = styleApplied
+		}
+		if translationMeta != nil {
+			payload["translation"] = translationMeta
+		}
+		if err := writer.Send("assistant_delta", payload); err != nil {
+			return
+		}
+		emotionBuilder = newEmotionTimelineBuilder(prefs.EmotionHint, prefs.Speed, contextData.motions)
+	}
+
 	if usage != nil {
 		tokensUsedTotal := totalTokensUsed(usage)
 		updates := make(map[string]any, 2)
@@ -838,15 +924,31 @@ func (m *Module) handleCreateMessageStream(
 		log.Printf("llm: failed to update latency: %v", err)
 	}
 
-	emotionMeta := inferEmotion(reply, prefs.EmotionHint)
+	emotionMeta := contextData.motions.annotate(inferEmotion(reply, prefs.EmotionHint))
+
+	if err := sendEmotionCues(emotionBuilder.advance(reply, true)); err != nil {
+		return
+	}
+	timeline := emotionBuilder.timeline()
+	// 大模型情绪标注在后台进行，关键词时间轴先随消息下发，标注完成后在结束前推送 emotion_timeline。
+	refinement := m.startEmotionRefinement(timeline, modelName)
 
-	extrasPayload := make(map[string]any)
+	extrasPayload := map[string]any{"generation": m.generationExtras(contextData)}
 	if len(knowledgeExtras) > 0 {
 		extrasPayload["knowledge_refs"] = knowledgeExtras
 	}
+	if len(styleApplied) > 0 {
+		extrasPayload["style_enforced"] = styleApplied
+	}
+	if translationMeta != nil {
+		extrasPayload["translation"] = translationMeta
+	}
 	if emotionMeta != nil {
 		extrasPayload["emotion"] = emotionMeta
 	}
+	if timeline != nil {
+		extrasPayload["emotion_timeline"] = timeline
+	}
 	if selection.ID != "" || prefs.Speed != 1.0 || prefs.Pitch != 1.0 {
 		prefsMap := map[string]any{}
 		if selection.ID != "" {
@@ -899,6 +1001,7 @@ func (m *Module) handleCreateMessageStream(
 	var finalSpeechStatus string
 	var finalSpeechPayload map[string]any
 	var finalSpeechError string
+	var timelineAligned bool
 
 	if streamStarted {
 		if streamFinalize && streamSession != nil {
@@ -935,6 +1038,13 @@ func (m *Module) handleCreateMessageStream(
 				"mime_type":    streamMeta.MimeType,
 				"audio_base64": encodedFull,
 			}
+			if durationMs := tts.EstimateDurationMs(streamBuf.Bytes(), streamMeta.Format, streamMeta.SampleRate); durationMs > 0 {
+				payload["duration_ms"] = durationMs
+				if timeline != nil {
+					alignEmotionTimeline(timeline, durationMs, prefs.Speed)
+					timelineAligned = true
+				}
+			}
 			if streamMeta.SampleRate > 0 {
 				payload["sample_rate"] = streamMeta.SampleRate
 			}
@@ -967,6 +1077,9 @@ func (m *Module) handleCreateMessageStream(
 		if finalSpeechError != "" {
 			update["speech_error"] = finalSpeechError
 		}
+		if timelineAligned {
+			update["emotion_timeline"] = timeline
+		}
 		if merged, err := mergeExtras(placeholder.Extras, update); err != nil {
 			log.Printf("llm: merge final speech extras failed: %v", err)
 		} else {
@@ -996,6 +1109,11 @@ func (m *Module) handleCreateMessageStream(
 			if err := writer.Send("speech_stream_completed", payload); err != nil {
 				log.Printf("llm: send speech_stream_completed failed: %v", err)
 			}
+			if timelineAligned {
+				if err := writer.Send("emotion_timeline", gin.H{"id": placeholder.ID, "timeline": timeline}); err != nil {
+					log.Printf("llm: send emotion_timeline failed: %v", err)
+				}
+			}
 		} else if finalSpeechStatus == "error" {
 			payload := gin.H{"id": placeholder.ID}
 			if finalSpeechError != "" {
@@ -1019,6 +1137,16 @@ func (m *Module) handleCreateMessageStream(
 		}
 	}
 
+	if labels := refinement.wait(ctx); labels != nil {
+		if refined := m.storeEmotionLabels(&message{}, placeholder.ID, labels, contextData.motions); refined != nil {
+			if err := writer.Send("emotion_timeline", gin.H{"id": placeholder.ID, "timeline": refined}); err != nil {
+				log.Printf("llm: send emotion_timeline failed: %v", err)
+			}
+		}
+	} else if ctx.Err() != nil {
+		m.storeEmotionRefinementAsync(&message{}, placeholder.ID, refinement, contextData.motions)
+	}
+
 	_ = writer.Send("done", gin.H{"id": placeholder.ID})
 }
 
@@ -0,0 +1,33 @@
+package llm
+
+import (
+	"log"
+
+	"auralis_back/agents"
+)
+
+// parseStyleGuide 读取智能体配置中的风格规则，解析失败时忽略。
+func parseStyleGuide(cfg *agents.AgentChatConfig) *agents.StyleGuide {
+	if cfg == nil {
+		return nil
+	}
+	guide, err := agents.ParseStyleGuide(cfg.StyleGuide)
+	if err != nil {
+		log.Printf("llm: parse style guide for agent %d failed: %v", cfg.AgentID, err)
+		return nil
+	}
+	return guide
+}
+
+// applyStyleGuide 对生成的回复执行风格硬性规则，返回处理后的文本与触发的规则。
+func applyStyleGuide(cfg *agents.AgentChatConfig, reply string) (string, []string) {
+	guide := parseStyleGuide(cfg)
+	if guide == nil {
+		return reply, nil
+	}
+	enforced, applied := guide.Enforce(reply)
+	if enforced == "" {
+		return reply, nil
+	}
+	return enforced, applied
+}
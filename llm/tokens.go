@@ -2,6 +2,7 @@ package llm
 
 import (
 	authorization "auralis_back/authorization"
+	knowledge "auralis_back/knowledge"
 	"context"
 	"errors"
 	"log"
@@ -94,6 +95,19 @@ func (m *Module) applyUsageToUserTokens(ctx context.Context, userID uint64, usag
 	return m.getUserTokenBalance(ctx, userID)
 }
 
+// estimateChatUsage 在生成被打断或失败、上游未返回用量时，按提示消息与已生成的文本估算 token 消耗；未生成任何内容时返回 nil。
+func estimateChatUsage(messages []ChatMessage, completion string) *ChatUsage {
+	if completion == "" {
+		return nil
+	}
+	prompt := 0
+	for _, msg := range messages {
+		prompt += knowledge.CountTokens(msg.Content)
+	}
+	output := knowledge.CountTokens(completion)
+	return &ChatUsage{PromptTokens: prompt, CompletionTokens: output, TotalTokens: prompt + output}
+}
+
 // incrementConversationTokens 累积会话的输入输出 token 统计。
 func (m *Module) incrementConversationTokens(ctx context.Context, convID uint64, usage *ChatUsage) {
 	if m == nil || m.db == nil || usage == nil || convID == 0 {
@@ -0,0 +1,392 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"auralis_back/agents"
+	"auralis_back/tts"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultAuthoredLanguage = "zh-CN"
+
+var languageNames = map[string]string{
+	"zh": "Chinese",
+	"en": "English",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"ru": "Russian",
+	"ar": "Arabic",
+	"th": "Thai",
+	"hi": "Hindi",
+	"es": "Spanish",
+	"fr": "French",
+	"de": "German",
+	"pt": "Portuguese",
+	"it": "Italian",
+}
+
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "what", "how", "i", "to", "it", "of", "do", "can", "my", "this"},
+	"es": {"el", "la", "los", "las", "es", "que", "de", "y", "por", "qué", "cómo", "yo", "tú", "una", "está"},
+	"fr": {"le", "la", "les", "est", "et", "je", "tu", "vous", "que", "une", "pas", "c'est", "comment", "des", "du"},
+	"de": {"der", "die", "das", "ist", "und", "ich", "du", "nicht", "wie", "was", "ein", "eine", "sie", "mit", "zu"},
+	"pt": {"o", "a", "os", "as", "é", "que", "de", "e", "não", "você", "eu", "um", "uma", "como", "está"},
+	"it": {"il", "lo", "la", "è", "che", "di", "e", "non", "io", "tu", "sono", "come", "un", "una", "perché"},
+}
+
+// translationPlan 描述一次回复的翻译方向。
+type translationPlan struct {
+	Source   string
+	Target   string
+	Detected bool
+}
+
+// instruction 生成要求智能体以创作语言思考与回复的系统提示。
+func (p *translationPlan) instruction() string {
+	return fmt.Sprintf(
+		"Translation mode: the user writes in %s. Understand their message, but reason and compose your reply in %s as usual; it will be translated for the user automatically.",
+		languageDisplayName(p.Target), languageDisplayName(p.Source),
+	)
+}
+
+// extras 返回写入消息扩展字段的翻译信息。
+func (p *translationPlan) extras(original string) map[string]any {
+	return map[string]any{
+		"source_lang": p.Source,
+		"target_lang": p.Target,
+		"detected":    p.Detected,
+		"original":    original,
+	}
+}
+
+// planTranslation 根据会话设置与用户消息判断是否需要翻译回复。
+func (m *Module) planTranslation(conv conversation, contextData *conversationContext, userText string) *translationPlan {
+	if !conv.TranslationMode || contextData == nil {
+		return nil
+	}
+	// 源语言取智能体创作时的默认语言，会话语言只影响回复提示，见 conversationContext.lang。
+	source, ok := agents.NormalizeLangCode(contextData.agent.LangDefault)
+	if !ok {
+		source = defaultAuthoredLanguage
+	}
+	plan := &translationPlan{Source: source}
+	if conv.TranslationLang != nil && strings.TrimSpace(*conv.TranslationLang) != "" {
+		plan.Target = strings.TrimSpace(*conv.TranslationLang)
+	} else {
+		plan.Target = detectLanguage(userText)
+		plan.Detected = true
+	}
+	if plan.Target == "" || langPrimary(plan.Target) == langPrimary(plan.Source) {
+		return nil
+	}
+	return plan
+}
+
+// translateReply 调用大模型将回复翻译为目标语言。
+func (m *Module) translateReply(ctx context.Context, plan *translationPlan, text, modelName string) (string, *ChatUsage, error) {
+	if m.client == nil {
+		return "", nil, errors.New("llm client not configured")
+	}
+	messages := []ChatMessage{
+		{
+			Role: "system",
+			Content: fmt.Sprintf(
+				"You are a professional translator. Translate the assistant reply from %s into %s. Preserve the persona's tone, emoji, formatting and line breaks. Output only the translation.",
+				languageDisplayName(plan.Source), languageDisplayName(plan.Target),
+			),
+		},
+		{Role: "user", Content: text},
+	}
+	result, err := m.client.Chat(ctx, messages, modelName)
+	if err != nil {
+		return "", nil, err
+	}
+	translated := strings.TrimSpace(result.Content)
+	if translated == "" {
+		return "", result.Usage, errors.New("empty translation")
+	}
+	return translated, result.Usage, nil
+}
+
+// applyTranslation 翻译回复并返回译文、合并后的用量与扩展信息，失败时保留原文。
+func (m *Module) applyTranslation(ctx context.Context, plan *translationPlan, reply, modelName string, usage *ChatUsage) (string, *ChatUsage, map[string]any) {
+	if plan == nil || strings.TrimSpace(reply) == "" {
+		return reply, usage, nil
+	}
+	translated, extraUsage, err := m.translateReply(ctx, plan, reply, modelName)
+	usage = mergeUsage(usage, extraUsage)
+	if err != nil {
+		log.Printf("llm: translate reply to %s failed: %v", plan.Target, err)
+		return reply, usage, nil
+	}
+	return translated, usage, plan.extras(reply)
+}
+
+// mergeUsage 累加两次模型调用的用量。
+func mergeUsage(a, b *ChatUsage) *ChatUsage {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &ChatUsage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// voiceForLanguage 当前音色不支持目标语言时，从音色目录挑选匹配语言的音色。
+func voiceForLanguage(synth tts.Synthesizer, current voiceSelection, lang string) voiceSelection {
+	if synth == nil || lang == "" {
+		return current
+	}
+	voices := synth.Voices()
+	var fallback *tts.VoiceOption
+	for i := range voices {
+		if !voiceSupportsLanguage(voices[i], lang) {
+			continue
+		}
+		if strings.EqualFold(voices[i].ID, current.ID) {
+			return current
+		}
+		if fallback == nil || (normalizeVoiceProvider(voices[i].Provider) == current.Provider &&
+			normalizeVoiceProvider(fallback.Provider) != current.Provider) {
+			fallback = &voices[i]
+		}
+	}
+	if fallback == nil {
+		return current
+	}
+	return voiceSelection{ID: strings.TrimSpace(fallback.ID), Provider: normalizeVoiceProvider(fallback.Provider)}
+}
+
+// voiceSupportsLanguage 判断音色声明的语言是否覆盖目标语言。
+func voiceSupportsLanguage(voice tts.VoiceOption, lang string) bool {
+	target := langPrimary(lang)
+	for _, item := range strings.Split(voice.Language, ",") {
+		if langPrimary(item) == target {
+			return true
+		}
+	}
+	return false
+}
+
+// langPrimary 提取语言代码的主语言部分。
+func langPrimary(code string) string {
+	code = strings.TrimSpace(strings.ReplaceAll(code, "_", "-"))
+	if idx := strings.Index(code, "-"); idx >= 0 {
+		code = code[:idx]
+	}
+	return strings.ToLower(code)
+}
+
+// languageDisplayName 返回语言代码对应的英文名称，用于提示词。
+func languageDisplayName(code string) string {
+	if name, ok := languageNames[langPrimary(code)]; ok {
+		return fmt.Sprintf("%s (%s)", name, code)
+	}
+	return code
+}
+
+// detectLanguage 按文字系统与常见词粗略识别文本语言，无法识别时返回空字符串。
+func detectLanguage(text string) string {
+	var han, kana, hangul, cyrillic, arabic, thai, devanagari, latin int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Thai, r):
+			thai++
+		case unicode.Is(unicode.Devanagari, r):
+			devanagari++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	switch {
+	case kana > 0 && kana*5 >= han:
+		return "ja"
+	case hangul > 0 && hangul >= han && hangul >= latin:
+		return "ko"
+	case han > 0 && han*2 >= latin:
+		return "zh-CN"
+	case cyrillic > latin:
+		return "ru"
+	case arabic > latin:
+		return "ar"
+	case thai > latin:
+		return "th"
+	case devanagari > latin:
+		return "hi"
+	case latin == 0:
+		return ""
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	best, bestScore := "en", 0
+	for _, lang := range []string{"en", "es", "fr", "de", "pt", "it"} {
+		score := 0
+		for _, word := range words {
+			for _, stop := range latinStopwords[lang] {
+				if word == stop {
+					score++
+					break
+				}
+			}
+		}
+		if score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+	return best
+}
+
+// registerTranslationRoutes 注册会话翻译模式相关路由。
+func (m *Module) registerTranslationRoutes(group *gin.RouterGroup) {
+	group.GET("/conversations/translation", m.handleGetTranslationMode)
+	group.PUT("/conversations/translation", m.handleUpdateTranslationMode)
+}
+
+type translationModeRequest struct {
+	AgentID    string  `json:"agent_id" binding:"required"`
+	UserID     string  `json:"user_id"`
+	Enabled    *bool   `json:"enabled"`
+	TargetLang *string `json:"target_lang"`
+}
+
+// translationModeResponse 组装会话翻译模式的返回结构。
+func translationModeResponse(conv conversation) gin.H {
+	return gin.H{
+		"conversation_id": conv.ID,
+		"agent_id":        conv.AgentID,
+		"user_id":         conv.UserID,
+		"enabled":         conv.TranslationMode,
+		"target_lang":     conv.TranslationLang,
+	}
+}
+
+// handleGetTranslationMode godoc
+// @Summary 查询会话翻译模式
+// @Description 返回用户与智能体会话的自动翻译开关与目标语言
+// @Tags LLM
+// @Produce json
+// @Param agent_id query int true "智能体ID"
+// @Param user_id query int false "用户ID，默认为当前登录用户"
+// @Success 200 {object} map[string]interface{} "翻译模式"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 404 {object} map[string]string "未找到"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleGetTranslationMode 返回会话的翻译模式设置。
+func (m *Module) handleGetTranslationMode(c *gin.Context) {
+	agentID, err := parsePositiveUint(c.Query("agent_id"), "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	var conv conversation
+	if err := m.db.WithContext(c.Request.Context()).Where("agent_id = ? AND user_id = ?", agentID, userID).Take(&conv).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load conversation", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, translationModeResponse(conv))
+}
+
+// handleUpdateTranslationMode godoc
+// @Summary 更新会话翻译模式
+// @Description 开启或关闭自动翻译；target_lang 为空时按用户消息自动识别语言
+// @Tags LLM
+// @Accept json
+// @Produce json
+// @Param request body translationModeRequest true "翻译模式"
+// @Success 200 {object} map[string]interface{} "更新后的翻译模式"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 500 {object} map[string]string "服务器错误"
+// @Author bizer
+// handleUpdateTranslationMode 更新会话的翻译模式设置。
+func (m *Module) handleUpdateTranslationMode(c *gin.Context) {
+	var req translationModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	agentID, err := parsePositiveUint(req.AgentID, "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	updates := map[string]any{}
+	if req.Enabled != nil {
+		updates["translation_mode"] = *req.Enabled
+	}
+	if req.TargetLang != nil {
+		if strings.TrimSpace(*req.TargetLang) == "" {
+			updates["translation_lang"] = nil
+		} else {
+			code, ok := agents.NormalizeLangCode(*req.TargetLang)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid target_lang"})
+				return
+			}
+			updates["translation_lang"] = code
+		}
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no changes provided"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	conv, err := m.findOrCreateConversation(ctx, agentID, userID, channelWeb)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load conversation", "details": err.Error()})
+		return
+	}
+	if err := m.db.WithContext(ctx).Model(&conversation{}).Where("id = ?", conv.ID).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update translation mode", "details": err.Error()})
+		return
+	}
+	if err := m.db.WithContext(ctx).First(&conv, "id = ?", conv.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load conversation", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, translationModeResponse(conv))
+}
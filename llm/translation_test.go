@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"auralis_back/agents"
+	"auralis_back/tts"
+)
+
+func TestBuildSystemPromptLanguage(t *testing.T) {
+	agent := &agents.Agent{Name: "Aki", LangDefault: "zh-CN"}
+
+	tests := []struct {
+		name string
+		lang string
+		want string
+	}{
+		{"agent default", "", "Reply in zh-CN unless"},
+		{"conversation language", "ja-JP", "Reply in ja-JP unless"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt := buildSystemPrompt(agent, nil, agents.PromptVars{}, tt.lang)
+			if !strings.Contains(prompt, tt.want) {
+				t.Errorf("prompt = %q, want it to contain %q", prompt, tt.want)
+			}
+		})
+	}
+	if agent.LangDefault != "zh-CN" {
+		t.Errorf("agent LangDefault changed to %q", agent.LangDefault)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"12345 !!!", ""},
+		{"你好，今天天气怎么样？", "zh-CN"},
+		{"こんにちは、元気ですか？", "ja"},
+		{"日本語を勉強しています", "ja"},
+		{"안녕하세요 반갑습니다", "ko"},
+		{"Привет, как дела?", "ru"},
+		{"مرحبا كيف حالك", "ar"},
+		{"สวัสดีครับ", "th"},
+		{"नमस्ते आप कैसे हैं", "hi"},
+		{"How are you doing today?", "en"},
+		{"¿Cómo está el tiempo hoy?", "es"},
+		{"Je ne sais pas comment faire", "fr"},
+		{"Ich weiß nicht, wie das ist", "de"},
+		{"Eu não sei como você está", "pt"},
+		{"Non so perché sono qui", "it"},
+		{"OK", "en"},
+		{"我在用 Go 写代码", "zh-CN"},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPlanTranslation(t *testing.T) {
+	m := &Module{}
+	lang := func(v string) *string { return &v }
+	ctxData := func(agentLang, convLang string) *conversationContext {
+		return &conversationContext{agent: agents.Agent{LangDefault: agentLang}, lang: convLang}
+	}
+
+	tests := []struct {
+		name    string
+		conv    conversation
+		ctxData *conversationContext
+		text    string
+		want    *translationPlan
+	}{
+		{"disabled", conversation{}, ctxData("zh-CN", ""), "hello there", nil},
+		{"missing context", conversation{TranslationMode: true}, nil, "hello there", nil},
+		{"detected target", conversation{TranslationMode: true}, ctxData("zh-CN", ""), "How are you?", &translationPlan{Source: "zh-CN", Target: "en", Detected: true}},
+		{"fixed target", conversation{TranslationMode: true, TranslationLang: lang("ja")}, ctxData("zh-CN", ""), "你好", &translationPlan{Source: "zh-CN", Target: "ja"}},
+		{"same primary language", conversation{TranslationMode: true}, ctxData("zh-TW", ""), "你好呀", nil},
+		{"same as fixed target", conversation{TranslationMode: true, TranslationLang: lang("en-GB")}, ctxData("en-US", ""), "hi", nil},
+		{"undetectable text", conversation{TranslationMode: true}, ctxData("zh-CN", ""), "123 ???", nil},
+		{"missing agent language", conversation{TranslationMode: true}, ctxData("", ""), "How are you?", &translationPlan{Source: defaultAuthoredLanguage, Target: "en", Detected: true}},
+		// 会话语言不改变源语言：智能体以中文创作，会话切到英文时仍需翻译英文消息。
+		{"conversation language ignored for source", conversation{TranslationMode: true}, ctxData("zh-CN", "en-US"), "How are you?", &translationPlan{Source: "zh-CN", Target: "en", Detected: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.planTranslation(tt.conv, tt.ctxData, tt.text)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("planTranslation = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSynthesizer 仅提供音色目录。
+type fakeSynthesizer struct {
+	voices []tts.VoiceOption
+}
+
+func (f *fakeSynthesizer) Enabled() bool             { return true }
+func (f *fakeSynthesizer) DefaultVoiceID() string    { return "" }
+func (f *fakeSynthesizer) Voices() []tts.VoiceOption { return f.voices }
+func (f *fakeSynthesizer) Synthesize(context.Context, tts.SpeechRequest) (*tts.SpeechResult, error) {
+	return nil, nil
+}
+
+func TestVoiceForLanguage(t *testing.T) {
+	synth := &fakeSynthesizer{voices: []tts.VoiceOption{
+		{ID: "zh-female", Provider: "qiniu", Language: "zh-CN"},
+		{ID: "multi", Provider: "qiniu", Language: "zh-CN, en-US"},
+		{ID: "en-cosy", Provider: "aliyun", Language: "en-US"},
+		{ID: "ja-cosy", Provider: "cosyvoice", Language: "ja-JP"},
+	}}
+	current := voiceSelection{ID: "zh-female", Provider: "qiniu-openai"}
+
+	tests := []struct {
+		name    string
+		synth   tts.Synthesizer
+		current voiceSelection
+		lang    string
+		want    voiceSelection
+	}{
+		{"no synthesizer", nil, current, "en", current},
+		{"no language", synth, current, "", current},
+		{"current voice supports language", synth, current, "zh-TW", current},
+		{"prefers same provider", synth, current, "en", voiceSelection{ID: "multi", Provider: "qiniu-openai"}},
+		{"falls back to other provider", synth, current, "ja", voiceSelection{ID: "ja-cosy", Provider: "aliyun-cosyvoice"}},
+		{"no voice for language", synth, current, "ko", current},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := voiceForLanguage(tt.synth, tt.current, tt.lang); got != tt.want {
+				t.Errorf("voiceForLanguage = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auralis_back/asr"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultASRTokensPerSecond = 2
+	voiceStreamIdleTimeout    = 60 * time.Second
+	voiceStreamMaxFrameBytes  = 1 << 20
+	voiceStreamChargeTimeout  = 10 * time.Second
+)
+
+var voiceStreamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  32 << 10,
+	WriteBufferSize: 32 << 10,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// registerVoiceInputRoutes 注册语音输入相关路由。
+func (m *Module) registerVoiceInputRoutes(group *gin.RouterGroup) {
+	group.POST("/messages/voice", m.limiter.Handler(messageRateLimit), m.handleCreateVoiceMessage)
+	group.GET("/messages/voice/stream", m.limiter.Handler(messageRateLimit), m.handleVoiceMessageStream)
+}
+
+// asrEnabled 判断语音识别是否可用。
+func (m *Module) asrEnabled() bool {
+	return m != nil && m.asr != nil && m.asr.Enabled()
+}
+
+// transcriptionTokenCost 按音频时长计算识别消耗的代币，不足一秒按一秒计。
+func transcriptionTokenCost(durationSeconds float64) int {
+	rate := readIntEnv("ASR_TOKENS_PER_SECOND", defaultASRTokensPerSecond)
+	if rate <= 0 {
+		return 0
+	}
+	seconds := int(math.Ceil(durationSeconds))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds * rate
+}
+
+// chargeTranscription 将识别音频时长折算为代币并从用户余额扣除。
+func (m *Module) chargeTranscription(ctx context.Context, userID uint64, transcript *asr.Transcript, startingBalance int64) (int64, int, error) {
+	if transcript == nil {
+		return startingBalance, 0, nil
+	}
+	cost := transcriptionTokenCost(transcript.DurationSeconds)
+	usage := &ChatUsage{PromptTokens: cost, TotalTokens: cost}
+	balance, err := m.applyUsageToUserTokens(ctx, userID, usage, startingBalance)
+	if err != nil {
+		return 0, 0, err
+	}
+	return balance, cost, nil
+}
+
+// chargeAbandonedStream 在流式会话未完成最终识别就结束时，按中间识别已处理的音频时长扣费。
+func (m *Module) chargeAbandonedStream(userID uint64, session *asr.StreamSession, startingBalance int64) {
+	seconds := session.TranscribedSeconds()
+	if seconds <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), voiceStreamChargeTimeout)
+	defer cancel()
+	if _, _, err := m.chargeTranscription(ctx, userID, &asr.Transcript{DurationSeconds: seconds}, startingBalance); err != nil {
+		log.Printf("llm: charge abandoned voice stream failed: %v", err)
+	}
+}
+
+// transcriptExtras 返回写入用户消息扩展字段的识别信息。
+func transcriptExtras(transcript *asr.Transcript, tokens int) map[string]any {
+	payload := map[string]any{
+		"provider":         transcript.Provider,
+		"duration_seconds": math.Round(transcript.DurationSeconds*100) / 100,
+		"tokens_charged":   tokens,
+	}
+	if transcript.Language != "" {
+		payload["language"] = transcript.Language
+	}
+	return map[string]any{"asr": payload}
+}
+
+// handleCreateVoiceMessage godoc
+// @Summary 发送语音消息
+// @Description 上传音频片段，识别为文字后作为用户消息发送并触发回复；音频时长按 ASR_TOKENS_PER_SECOND 计费
+// @Tags LLM
+// @Accept multipart/form-data
+// @Produce json
+// @Param agent_id formData string true "智能体ID"
+// @Param user_id formData string false "用户ID，默认为当前登录用户"
+// @Param audio formData file true "音频文件"
+// @Param language formData string false "语言代码"
+// @Param voice_id formData string false "回复使用的音色"
+// @Success 201 {object} createMessageResponse "消息创建结果"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 402 {object} map[string]string "余额不足"
+// @Failure 413 {object} map[string]string "音频过大"
+// @Failure 422 {object} map[string]string "未识别到语音"
+// @Failure 502 {object} map[string]string "识别失败"
+// @Failure 503 {object} map[string]string "服务未启用"
+// @Author bizer
+// handleCreateVoiceMessage 识别上传的语音并作为用户消息发送。
+func (m *Module) handleCreateVoiceMessage(c *gin.Context) {
+	if !m.asrEnabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "asr service disabled"})
+		return
+	}
+
+	agentIDRaw := c.PostForm("agent_id")
+	userIDRaw := c.PostForm("user_id")
+	if _, err := parsePositiveUint(agentIDRaw, "agent_id"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, userIDRaw)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	balance, err := m.getUserTokenBalance(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load token balance"})
+		}
+		return
+	}
+	if balance <= 0 {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient token balance"})
+		return
+	}
+
+	audio, filename, mimeType, err := asr.ReadUpload(c, "audio")
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, asr.ErrAudioTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": "invalid audio upload", "details": err.Error()})
+		return
+	}
+
+	transcript, err := m.asr.Transcribe(ctx, asr.TranscribeRequest{
+		Audio:    audio,
+		Filename: filename,
+		MimeType: mimeType,
+		Language: c.PostForm("language"),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "transcription failed", "details": err.Error()})
+		return
+	}
+
+	_, tokens, err := m.chargeTranscription(ctx, userID, transcript, balance)
+	if err != nil {
+		log.Printf("llm: charge transcription failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to finalize token usage"})
+		return
+	}
+
+	if strings.TrimSpace(transcript.Text) == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "no speech recognized", "tokens_used": tokens})
+		return
+	}
+
+	req := createMessageRequest{
+		AgentID:       agentIDRaw,
+		UserID:        userIDRaw,
+		Role:          "user",
+		Content:       transcript.Text,
+		VoiceID:       c.PostForm("voice_id"),
+		VoiceProvider: c.PostForm("voice_provider"),
+		EmotionHint:   c.PostForm("emotion_hint"),
+	}
+	m.processCreateMessage(c, req, transcriptExtras(transcript, tokens))
+}
+
+// voiceStreamControl 表示客户端在 WebSocket 上发送的控制消息。
+type voiceStreamControl struct {
+	Type string `json:"type"`
+}
+
+// handleVoiceMessageStream godoc
+// @Summary 流式语音输入
+// @Description 通过 WebSocket 发送二进制音频分片，服务端返回 partial 中间结果（较长音频只覆盖最近一段）；客户端发送 {"type":"end"} 后返回最终识别结果并生成回复；取消或断开时按已识别的音频时长计费
+// @Tags LLM
+// @Param agent_id query string true "智能体ID"
+// @Param user_id query string false "用户ID，默认为当前登录用户"
+// @Param format query string false "音频格式，pcm16（默认）或容器 MIME 类型如 audio/webm"
+// @Param sample_rate query int false "PCM 采样率，默认 16000"
+// @Param language query string false "语言代码"
+// @Param reply query bool false "识别完成后是否发送为用户消息并生成回复，默认 true"
+// @Success 101 {string} string "切换为 WebSocket"
+// @Failure 400 {object} map[string]string "请求参数错误"
+// @Failure 402 {object} map[string]string "余额不足"
+// @Failure 503 {object} map[string]string "服务未启用"
+// @Author bizer
+// handleVoiceMessageStream 建立流式语音识别会话。
+func (m *Module) handleVoiceMessageStream(c *gin.Context) {
+	if !m.asrEnabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "asr service disabled"})
+		return
+	}
+	agentID, err := parsePositiveUint(c.Query("agent_id"), "agent_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, ok := requestUserID(c, c.Query("user_id"))
+	if !ok {
+		return
+	}
+	sampleRate := 16000
+	if raw := strings.TrimSpace(c.Query("sample_rate")); raw != "" {
+		value, convErr := strconv.Atoi(raw)
+		if convErr != nil || value < 8000 || value > 48000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sample_rate must be between 8000 and 48000"})
+			return
+		}
+		sampleRate = value
+	}
+	wantReply := true
+	if raw := strings.TrimSpace(c.Query("reply")); raw != "" {
+		if parsed, parseErr := strconv.ParseBool(raw); parseErr == nil {
+			wantReply = parsed
+		}
+	}
+
+	ctx := c.Request.Context()
+	balance, err := m.getUserTokenBalance(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load token balance"})
+		}
+		return
+	}
+	if balance <= 0 {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient token balance"})
+		return
+	}
+
+	conn, err := voiceStreamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("llm: voice stream upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(voiceStreamMaxFrameBytes)
+
+	send := func(payload gin.H) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.WriteJSON(payload); err != nil {
+			log.Printf("llm: voice stream write failed: %v", err)
+			return false
+		}
+		return true
+	}
+
+	session := asr.NewStreamSession(m.asr, asr.StreamOptions{
+		Format:     c.Query("format"),
+		SampleRate: sampleRate,
+		Language:   c.Query("language"),
+	})
+	billed := false
+	defer func() {
+		if !billed {
+			m.chargeAbandonedStream(userID, session, balance)
+		}
+	}()
+	if !send(gin.H{"type": "ready", "provider": m.asr.ID()}) {
+		return
+	}
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(voiceStreamIdleTimeout))
+		kind, data, readErr := conn.ReadMessage()
+		if readErr != nil {
+			if !websocket.IsCloseError(readErr, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("llm: voice stream read failed: %v", readErr)
+			}
+			return
+		}
+
+		if kind == websocket.BinaryMessage {
+			partial, err := session.Append(ctx, data)
+			if err != nil {
+				send(gin.H{"type": "error", "error": err.Error()})
+				if errors.Is(err, asr.ErrAudioTooLarge) {
+					return
+				}
+				continue
+			}
+			if partial != nil && !send(gin.H{"type": "partial", "text": partial.Text, "duration_seconds": session.Duration()}) {
+				return
+			}
+			continue
+		}
+
+		var control voiceStreamControl
+		if err := json.Unmarshal(data, &control); err != nil {
+			send(gin.H{"type": "error", "error": "invalid control message"})
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(control.Type)) {
+		case "cancel":
+			send(gin.H{"type": "cancelled"})
+			return
+		case "end":
+			billed = m.finishVoiceStream(ctx, session, agentID, userID, balance, wantReply, c.Query("voice_id"), send)
+			_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return
+		default:
+			send(gin.H{"type": "error", "error": "unknown control type"})
+		}
+	}
+}
+
+// finishVoiceStream 完成流式识别、扣费，并按需写入用户消息与生成回复；返回是否已按最终识别结果扣费。
+func (m *Module) finishVoiceStream(ctx context.Context, session *asr.StreamSession, agentID, userID uint64, balance int64, wantReply bool, voiceID string, send func(gin.H) bool) bool {
+	transcript, err := session.Finish(ctx)
+	if err != nil {
+		send(gin.H{"type": "error", "error": err.Error()})
+		return false
+	}
+
+	remaining, tokens, err := m.chargeTranscription(ctx, userID, transcript, balance)
+	if err != nil {
+		log.Printf("llm: charge transcription failed: %v", err)
+		send(gin.H{"type": "error", "error": "failed to finalize token usage"})
+		return true
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	if !send(gin.H{
+		"type":             "final",
+		"text":             transcript.Text,
+		"language":         transcript.Language,
+		"duration_seconds": transcript.DurationSeconds,
+		"tokens_used":      tokens,
+		"token_balance":    remaining,
+	}) {
+		return true
+	}
+
+	if !wantReply || strings.TrimSpace(transcript.Text) == "" {
+		return true
+	}
+	if remaining <= 0 {
+		send(gin.H{"type": "error", "error": "insufficient token balance"})
+		return true
+	}
+
+	conv, userMsg, userRecord, err := m.appendConversationMessage(ctx, agentID, userID, "user", transcript.Text, transcriptExtras(transcript, tokens))
+	if err != nil {
+		send(gin.H{"type": "error", "error": "failed to create message"})
+		return true
+	}
+	m.invalidateRecentMessagesCache(ctx, conv.AgentID, conv.UserID)
+	if err := m.markConversationRead(ctx, conv.AgentID, conv.UserID); err != nil {
+		log.Printf("llm: reset unread count failed: %v", err)
+	}
+
+	response := createMessageResponse{
+		ConversationID: conv.ID,
+		AgentID:        conv.AgentID,
+		UserID:         conv.UserID,
+		UserMessage:    userRecord,
+	}
+	if reminder := m.captureReminderRequest(ctx, conv.AgentID, conv.UserID, transcript.Text); reminder != nil {
+		record := scheduledToRecord(*reminder)
+		response.Reminder = &record
+	}
+
+	prefs := speechPreferences{VoiceID: strings.TrimSpace(voiceID), Speed: 1.0, Pitch: 1.0}
+	assistantRecord, usage, genErr := m.generateAssistantReply(ctx, conv, userMsg, prefs)
+	if genErr != nil {
+		response.AssistantError = genErr.Error()
+	} else {
+		response.AssistantMessage = assistantRecord
+	}
+	if usage != nil {
+		updated, err := m.applyUsageToUserTokens(ctx, conv.UserID, usage, remaining)
+		if err != nil {
+			log.Printf("llm: failed to apply token usage: %v", err)
+		} else {
+			remaining = updated
+		}
+		response.TokensUsed = intPointerIfPositive(int(totalTokensUsed(usage)))
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	response.TokenBalance = int64Pointer(remaining)
+
+	send(gin.H{"type": "message", "message": response})
+	return true
+}
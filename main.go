@@ -7,10 +7,12 @@ import (
 	"time"
 
 	"auralis_back/agents"
+	"auralis_back/asr"
 	"auralis_back/authorization"
 	knowledge "auralis_back/knowledge"
 	"auralis_back/live2d"
 	"auralis_back/llm"
+	"auralis_back/ratelimit"
 	"auralis_back/tts"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -44,7 +46,7 @@ func configureCORS(r *gin.Engine) {
 		AllowOrigins:     allowOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
@@ -52,14 +54,30 @@ func configureCORS(r *gin.Engine) {
 	r.Use(cors.New(corsConfig))
 }
 
+// configureTrustedProxies 按 TRUSTED_PROXIES 设置可信代理，默认不信任任何代理，ClientIP 直接取连接地址。
+func configureTrustedProxies(r *gin.Engine) {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if trimmed := strings.TrimSpace(proxy); trimmed != "" {
+			proxies = append(proxies, trimmed)
+		}
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("configure trusted proxies: %v", err)
+	}
+}
+
 // main 初始化所有模块并启动 HTTP 服务入口。
 func main() {
 	mustLoadEnv()
 
 	r := gin.Default()
+	configureTrustedProxies(r)
 	configureCORS(r)
 
-	authModule, err := authorization.RegisterRoutes(r)
+	limiter := ratelimit.NewFromEnv(authorization.CurrentUser)
+
+	authModule, err := authorization.RegisterRoutes(r, limiter)
 	if err != nil {
 		log.Fatalf("register auth routes: %v", err)
 	}
@@ -69,22 +87,26 @@ func main() {
 		authGuard = authModule.Guard()
 	}
 
-	agentModule, err := agents.RegisterRoutes(r, authGuard)
+	agentModule, err := agents.RegisterRoutes(r, authGuard, limiter)
 	if err != nil {
 		log.Fatalf("register agent routes: %v", err)
 	}
 	if _, err := live2d.RegisterRoutes(r, authGuard); err != nil {
 		log.Fatalf("register live2d routes: %v", err)
 	}
-	ttsModule, err := tts.RegisterRoutes(r)
+	ttsModule, err := tts.RegisterRoutes(r, limiter)
 	if err != nil {
 		log.Fatalf("register tts routes: %v", err)
 	}
+	asrModule, err := asr.RegisterRoutes(r)
+	if err != nil {
+		log.Fatalf("register asr routes: %v", err)
+	}
 	var knowledgeSvc *knowledge.Service
 	if agentModule != nil {
 		knowledgeSvc = agentModule.KnowledgeService()
 	}
-	if _, err := llm.RegisterRoutes(r, ttsModule, knowledgeSvc); err != nil {
+	if _, err := llm.RegisterRoutes(r, authGuard, ttsModule, knowledgeSvc, asrModule, limiter); err != nil {
 		log.Fatalf("register llm routes: %v", err)
 	}
 
@@ -0,0 +1,40 @@
+// Package netguard 为访问用户提供地址的出站请求（网页抓取、渠道回调等）提供内网访问防护。
+package netguard
+
+import (
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// dialTimeout 为建立连接的超时时间。
+const dialTimeout = 10 * time.Second
+
+// IsPrivateIP 判断地址是否为本机、内网、链路本地或组播地址。
+func IsPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// NewTransport 克隆默认 Transport 并禁用代理；allowPrivate 为 false 时在连接阶段拒绝内网与本机地址并返回 blocked，
+// 校验发生在 DNS 解析之后，可防止 DNS 重绑定绕过。
+func NewTransport(allowPrivate bool, blocked error) *http.Transport {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil && IsPrivateIP(ip) {
+				return blocked
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return transport
+}
@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm 表示限流算法。
+type Algorithm string
+
+const (
+	// SlidingWindow 在滚动时间窗口内限制请求次数。
+	SlidingWindow Algorithm = "sliding_window"
+	// TokenBucket 以固定速率补充令牌并允许一定突发。
+	TokenBucket Algorithm = "token_bucket"
+)
+
+// Limit 描述一条限流规则；Requests 为 0 表示不限流。
+type Limit struct {
+	Algorithm Algorithm
+	Requests  int
+	Window    time.Duration
+	Burst     int
+}
+
+// Unlimited 表示不做限制的规则。
+var Unlimited = Limit{}
+
+// PerWindow 创建滑动窗口规则。
+func PerWindow(requests int, window time.Duration) Limit {
+	return Limit{Algorithm: SlidingWindow, Requests: requests, Window: window}
+}
+
+// Bucket 创建令牌桶规则：每个 window 补充 requests 个令牌，桶容量为 burst。
+func Bucket(requests int, window time.Duration, burst int) Limit {
+	return Limit{Algorithm: TokenBucket, Requests: requests, Window: window, Burst: burst}
+}
+
+// IsUnlimited 判断规则是否不做限制。
+func (l Limit) IsUnlimited() bool {
+	return l.Requests <= 0 || l.Window <= 0
+}
+
+// capacity 返回规则允许的最大请求数，令牌桶为桶容量。
+func (l Limit) capacity() int {
+	if l.Algorithm == TokenBucket && l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// rate 返回每秒允许的平均请求数，用于比较规则宽松程度。
+func (l Limit) rate() float64 {
+	if l.IsUnlimited() {
+		return 0
+	}
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// looserThan 判断当前规则是否比另一条更宽松。
+func (l Limit) looserThan(other Limit) bool {
+	if l.IsUnlimited() {
+		return !other.IsUnlimited()
+	}
+	if other.IsUnlimited() {
+		return false
+	}
+	if l.rate() != other.rate() {
+		return l.rate() > other.rate()
+	}
+	return l.capacity() > other.capacity()
+}
+
+// policyHeader 生成 RateLimit-Policy 响应头的值。
+func (l Limit) policyHeader() string {
+	if l.Algorithm == TokenBucket {
+		return fmt.Sprintf("%d;w=%d;burst=%d", l.Requests, int(l.Window.Seconds()), l.capacity())
+	}
+	return fmt.Sprintf("%d;w=%d", l.Requests, int(l.Window.Seconds()))
+}
+
+// String 返回与 ParseLimit 兼容的规则描述。
+func (l Limit) String() string {
+	if l.IsUnlimited() {
+		return "off"
+	}
+	spec := strconv.Itoa(l.Requests) + "/" + formatWindow(l.Window)
+	if l.Algorithm == TokenBucket {
+		return "bucket:" + spec + "+" + strconv.Itoa(l.capacity())
+	}
+	return spec
+}
+
+// ParseLimit 解析规则描述：「20/1m」为滑动窗口，「bucket:1/3s+10」为令牌桶（每 3 秒补充 1 个、容量 10），「off」表示不限流。
+func ParseLimit(raw string) (Limit, error) {
+	spec := strings.ToLower(strings.TrimSpace(raw))
+	switch spec {
+	case "":
+		return Limit{}, fmt.Errorf("ratelimit: empty limit")
+	case "off", "none", "unlimited", "0":
+		return Unlimited, nil
+	}
+
+	algorithm := SlidingWindow
+	if rest, ok := strings.CutPrefix(spec, "bucket:"); ok {
+		algorithm = TokenBucket
+		spec = rest
+	}
+
+	burst := 0
+	if algorithm == TokenBucket {
+		if base, rawBurst, ok := strings.Cut(spec, "+"); ok {
+			value, err := strconv.Atoi(strings.TrimSpace(rawBurst))
+			if err != nil || value <= 0 {
+				return Limit{}, fmt.Errorf("ratelimit: invalid burst in %q", raw)
+			}
+			burst = value
+			spec = base
+		}
+	}
+
+	rawCount, rawWindow, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("ratelimit: limit %q must look like 20/1m", raw)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(rawCount))
+	if err != nil || count <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid request count in %q", raw)
+	}
+	window, err := parseWindow(strings.TrimSpace(rawWindow))
+	if err != nil {
+		return Limit{}, fmt.Errorf("ratelimit: invalid window in %q: %w", raw, err)
+	}
+	return Limit{Algorithm: algorithm, Requests: count, Window: window, Burst: burst}, nil
+}
+
+// parseWindow 解析时间窗口，支持 s/m/h 简写以及 Go 时长格式。
+func parseWindow(raw string) (time.Duration, error) {
+	switch raw {
+	case "s", "sec", "second":
+		return time.Second, nil
+	case "m", "min", "minute":
+		return time.Minute, nil
+	case "h", "hour":
+		return time.Hour, nil
+	case "d", "day":
+		return 24 * time.Hour, nil
+	}
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(raw, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid day count")
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	window, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+	return window, nil
+}
+
+// formatWindow 将时间窗口格式化为简写形式。
+func formatWindow(window time.Duration) string {
+	switch {
+	case window%(24*time.Hour) == 0:
+		return strconv.Itoa(int(window/(24*time.Hour))) + "d"
+	case window%time.Hour == 0:
+		return strconv.Itoa(int(window/time.Hour)) + "h"
+	case window%time.Minute == 0:
+		return strconv.Itoa(int(window/time.Minute)) + "m"
+	default:
+		return window.String()
+	}
+}
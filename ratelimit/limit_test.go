@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Limit
+	}{
+		{"20/1m", PerWindow(20, time.Minute)},
+		{" 5/S ", PerWindow(5, time.Second)},
+		{"100/h", PerWindow(100, time.Hour)},
+		{"1000/2d", PerWindow(1000, 48*time.Hour)},
+		{"3/90s", PerWindow(3, 90*time.Second)},
+		{"bucket:1/3s+10", Bucket(1, 3*time.Second, 10)},
+		{"bucket:60/1m", Bucket(60, time.Minute, 0)},
+		{"off", Unlimited},
+		{"0", Unlimited},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.raw)
+		if err != nil {
+			t.Errorf("ParseLimit(%q): %v", tt.raw, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+
+	for _, raw := range []string{"", "20", "x/1m", "0/1m", "-1/1m", "5/abc", "5/-1s", "5/0d", "bucket:1/3s+0", "bucket:1/3s+x"} {
+		if _, err := ParseLimit(raw); err == nil {
+			t.Errorf("ParseLimit(%q): expected error", raw)
+		}
+	}
+}
+
+func TestLimitStringRoundTrip(t *testing.T) {
+	for _, limit := range []Limit{
+		PerWindow(20, time.Minute),
+		PerWindow(3, 90*time.Second),
+		PerWindow(7, 24*time.Hour),
+		Bucket(1, 3*time.Second, 10),
+		Unlimited,
+	} {
+		parsed, err := ParseLimit(limit.String())
+		if err != nil {
+			t.Errorf("ParseLimit(%q): %v", limit.String(), err)
+			continue
+		}
+		if parsed.String() != limit.String() || parsed.rate() != limit.rate() || parsed.capacity() != limit.capacity() {
+			t.Errorf("round trip of %q = %+v", limit.String(), parsed)
+		}
+	}
+}
+
+func TestLimitLooserThan(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Limit
+		want bool
+	}{
+		{"higher rate", PerWindow(20, time.Minute), PerWindow(10, time.Minute), true},
+		{"lower rate", PerWindow(10, time.Minute), PerWindow(1, time.Second), false},
+		{"same rate larger burst", Bucket(10, time.Minute, 30), PerWindow(10, time.Minute), true},
+		{"unlimited", Unlimited, PerWindow(1000, time.Second), true},
+		{"against unlimited", PerWindow(1000, time.Second), Unlimited, false},
+		{"both unlimited", Unlimited, Unlimited, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.looserThan(tt.b); got != tt.want {
+			t.Errorf("%s: looserThan = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
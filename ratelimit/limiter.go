@@ -0,0 +1,245 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"auralis_back/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	keyPrefix          = "ratelimit:"
+	storeTimeout       = 200 * time.Millisecond
+	fallbackLogEvery   = 30 * time.Second
+	defaultEnvPrefix   = "RATE_LIMIT_"
+	anonymousRoleLabel = "anonymous"
+)
+
+// envRoles 为支持通过环境变量单独配置的角色。
+var envRoles = []string{"admin", "guest", anonymousRoleLabel}
+
+// KeyStrategy 决定限流计数按什么维度区分调用方。
+type KeyStrategy int
+
+const (
+	// KeyUserOrIP 已登录时按用户，否则按客户端 IP。
+	KeyUserOrIP KeyStrategy = iota
+	// KeyIP 始终按客户端 IP。
+	KeyIP
+	// KeyUser 始终按用户，未登录请求按 IP 处理。
+	KeyUser
+)
+
+// Policy 描述一组路由的限流策略。
+type Policy struct {
+	// Name 为路由分组名，同时用于计数键与 RATE_LIMIT_<NAME> 环境变量覆盖。
+	Name string
+	// Key 决定计数维度。
+	Key KeyStrategy
+	// Limit 为默认规则。
+	Limit Limit
+	// Roles 为按角色覆盖的规则，未登录请求使用 "anonymous"；多个角色命中时取最宽松的一条。
+	Roles map[string]Limit
+	// Identify 覆盖限流器默认的身份解析，用于 API 密钥等不经过 JWT 鉴权的路由。
+	Identify IdentityFunc
+}
+
+// IdentityFunc 从请求中解析当前用户 ID 与角色，未登录时返回 0。
+type IdentityFunc func(c *gin.Context) (uint64, []string)
+
+// Limiter 以 Redis 为主、内存为备执行限流。
+type Limiter struct {
+	store    Store
+	fallback Store
+	identify IdentityFunc
+	enabled  bool
+	lastLog  atomic.Int64
+}
+
+// New 使用给定存储创建限流器，store 为空时仅使用内存。
+func New(store Store, identify IdentityFunc) *Limiter {
+	fallback := NewMemoryStore()
+	if store == nil {
+		store = fallback
+	}
+	return &Limiter{store: store, fallback: fallback, identify: identify, enabled: true}
+}
+
+// NewFromEnv 根据环境变量创建限流器；Redis 不可用时退化为进程内限流。
+func NewFromEnv(identify IdentityFunc) *Limiter {
+	var limiter *Limiter
+	if client, err := cache.GetRedisClient(); err != nil {
+		log.Printf("ratelimit: redis disabled, using in-memory limiter: %v", err)
+		limiter = New(nil, identify)
+	} else {
+		limiter = New(NewRedisStore(client), identify)
+	}
+	if raw := strings.TrimSpace(os.Getenv("RATE_LIMIT_ENABLED")); raw != "" {
+		if enabled, err := strconv.ParseBool(raw); err == nil {
+			limiter.enabled = enabled
+		}
+	}
+	return limiter
+}
+
+// Handler 返回按策略限流的中间件，超限时返回 429 并附带 Retry-After 与 RateLimit-* 响应头。
+func (l *Limiter) Handler(policy Policy) gin.HandlerFunc {
+	if l == nil || !l.enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+	policy = policyFromEnv(policy)
+	identify := l.identify
+	if policy.Identify != nil {
+		identify = policy.Identify
+	}
+
+	return func(c *gin.Context) {
+		var (
+			userID uint64
+			roles  []string
+		)
+		if identify != nil {
+			userID, roles = identify(c)
+		}
+		limit := policy.limitFor(userID, roles)
+		if limit.IsUnlimited() {
+			c.Next()
+			return
+		}
+
+		key := keyPrefix + policy.Name + ":" + identity(c, policy.Key, userID)
+		result, err := l.allow(c.Request.Context(), key, limit)
+		if err != nil {
+			log.Printf("ratelimit: check %s failed: %v", policy.Name, err)
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Policy", limit.policyHeader())
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			header.Set("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "rate limit exceeded",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// allow 优先使用主存储判定，失败时降级到内存存储。
+func (l *Limiter) allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	storeCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	result, err := l.store.Allow(storeCtx, key, limit, now)
+	if err == nil || l.store == l.fallback {
+		return result, err
+	}
+	if last := l.lastLog.Load(); now.Unix()-last >= int64(fallbackLogEvery.Seconds()) && l.lastLog.CompareAndSwap(last, now.Unix()) {
+		log.Printf("ratelimit: redis check failed, falling back to memory: %v", err)
+	}
+	return l.fallback.Allow(ctx, key, limit, now)
+}
+
+// limitFor 选择当前调用方适用的规则。
+func (p Policy) limitFor(userID uint64, roles []string) Limit {
+	if len(p.Roles) == 0 {
+		return p.Limit
+	}
+	if userID == 0 {
+		if limit, ok := p.Roles[anonymousRoleLabel]; ok {
+			return limit
+		}
+		return p.Limit
+	}
+
+	var (
+		chosen Limit
+		found  bool
+	)
+	for _, role := range roles {
+		limit, ok := p.Roles[strings.ToLower(strings.TrimSpace(role))]
+		if !ok {
+			continue
+		}
+		if !found || limit.looserThan(chosen) {
+			chosen = limit
+			found = true
+		}
+	}
+	if !found {
+		return p.Limit
+	}
+	return chosen
+}
+
+// identity 生成调用方的计数标识。
+func identity(c *gin.Context, strategy KeyStrategy, userID uint64) string {
+	if strategy != KeyIP && userID != 0 {
+		return "u:" + strconv.FormatUint(userID, 10)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// policyFromEnv 读取 RATE_LIMIT_<NAME> 与 RATE_LIMIT_<NAME>_<ROLE> 覆盖默认规则。
+func policyFromEnv(policy Policy) Policy {
+	name := envName(policy.Name)
+	if limit, ok := limitFromEnv(defaultEnvPrefix + name); ok {
+		policy.Limit = limit
+	}
+
+	roles := make(map[string]Limit, len(policy.Roles))
+	for role, limit := range policy.Roles {
+		roles[strings.ToLower(role)] = limit
+	}
+	for _, role := range envRoles {
+		if limit, ok := limitFromEnv(defaultEnvPrefix + name + "_" + envName(role)); ok {
+			roles[role] = limit
+		}
+	}
+	policy.Roles = roles
+	return policy
+}
+
+// limitFromEnv 解析单个环境变量中的规则。
+func limitFromEnv(key string) (Limit, bool) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return Limit{}, false
+	}
+	limit, err := ParseLimit(raw)
+	if err != nil {
+		log.Printf("ratelimit: ignore %s: %v", key, err)
+		return Limit{}, false
+	}
+	return limit, true
+}
+
+// envName 将策略或角色名转换为环境变量片段。
+func envName(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_", "/", "_", " ", "_").Replace(strings.TrimSpace(name)))
+}
+
+// ceilSeconds 将时长向上取整为秒。
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingStore 模拟不可用的 Redis。
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, Limit, time.Time) (Result, error) {
+	return Result{}, errors.New("redis down")
+}
+
+// newTestRouter 创建挂载限流中间件的路由，请求头 X-User 与 X-Role 模拟登录身份。
+func newTestRouter(limiter *Limiter, policy Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", limiter.Handler(policy), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return router
+}
+
+func testIdentity(c *gin.Context) (uint64, []string) {
+	if c.GetHeader("X-User") == "" {
+		return 0, nil
+	}
+	return 7, []string{c.GetHeader("X-Role")}
+}
+
+func serve(router *gin.Engine, role string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if role != "" {
+		req.Header.Set("X-User", "7")
+		req.Header.Set("X-Role", role)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPolicyLimitForRoles(t *testing.T) {
+	base := PerWindow(10, time.Minute)
+	policy := Policy{
+		Limit: base,
+		Roles: map[string]Limit{
+			"admin":            Unlimited,
+			"vip":              PerWindow(100, time.Minute),
+			"trial":            PerWindow(5, time.Minute),
+			anonymousRoleLabel: PerWindow(2, time.Minute),
+		},
+	}
+	tests := []struct {
+		name   string
+		userID uint64
+		roles  []string
+		want   Limit
+	}{
+		{"anonymous", 0, nil, PerWindow(2, time.Minute)},
+		{"no override", 1, []string{"user"}, base},
+		{"override", 1, []string{"trial"}, PerWindow(5, time.Minute)},
+		{"role case", 1, []string{" VIP "}, PerWindow(100, time.Minute)},
+		{"loosest wins", 1, []string{"trial", "vip"}, PerWindow(100, time.Minute)},
+		{"unlimited wins", 1, []string{"vip", "admin"}, Unlimited},
+	}
+	for _, tt := range tests {
+		if got := policy.limitFor(tt.userID, tt.roles); got != tt.want {
+			t.Errorf("%s: limitFor = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := (Policy{Limit: base}).limitFor(0, nil); got != base {
+		t.Errorf("anonymous without roles = %+v, want default", got)
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMIT_LLM_CHAT", "bucket:1/3s+10")
+	t.Setenv("RATE_LIMIT_LLM_CHAT_GUEST", "2/1m")
+	t.Setenv("RATE_LIMIT_LLM_CHAT_ADMIN", "not a limit")
+
+	policy := policyFromEnv(Policy{
+		Name:  "llm-chat",
+		Limit: PerWindow(20, time.Minute),
+		Roles: map[string]Limit{"Admin": Unlimited},
+	})
+	if policy.Limit != Bucket(1, 3*time.Second, 10) {
+		t.Errorf("limit = %+v, want env override", policy.Limit)
+	}
+	if policy.Roles["guest"] != PerWindow(2, time.Minute) {
+		t.Errorf("guest = %+v, want env override", policy.Roles["guest"])
+	}
+	// 无法解析的覆盖被忽略，保留代码中的默认值。
+	if limit, ok := policy.Roles["admin"]; !ok || limit != Unlimited {
+		t.Errorf("admin = %+v, want the default unlimited rule", limit)
+	}
+}
+
+func TestHandlerHeaders(t *testing.T) {
+	limiter := New(nil, testIdentity)
+	router := newTestRouter(limiter, Policy{Name: "test", Key: KeyUserOrIP, Limit: PerWindow(2, time.Minute)})
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := serve(router, "")
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d status = %d", i, rec.Code)
+		}
+		header := rec.Header()
+		if header.Get("RateLimit-Limit") != "2" || header.Get("RateLimit-Remaining") != remaining ||
+			header.Get("RateLimit-Policy") != "2;w=60" || header.Get("RateLimit-Reset") != "60" {
+			t.Errorf("request %d headers = %v", i, header)
+		}
+		if header.Get("Retry-After") != "" {
+			t.Errorf("request %d has Retry-After on success", i)
+		}
+	}
+
+	rec := serve(router, "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "60" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("429 headers = %v", rec.Header())
+	}
+
+	// 已登录用户按用户计数，不受同一 IP 的匿名请求影响。
+	if rec := serve(router, "user"); rec.Code != http.StatusNoContent {
+		t.Errorf("logged in status = %d, want a separate counter", rec.Code)
+	}
+}
+
+func TestHandlerRoleOverrides(t *testing.T) {
+	limiter := New(nil, testIdentity)
+	router := newTestRouter(limiter, Policy{
+		Name:  "roles",
+		Limit: PerWindow(1, time.Minute),
+		Roles: map[string]Limit{"admin": Unlimited, "vip": Bucket(1, time.Minute, 3)},
+	})
+
+	for i := 0; i < 5; i++ {
+		if rec := serve(router, "admin"); rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("admin request %d = %d %v, want unlimited without headers", i, rec.Code, rec.Header())
+		}
+	}
+
+	// 令牌桶按容量限流，并在 RateLimit-Policy 中声明突发容量。
+	limiter = New(nil, testIdentity)
+	router = newTestRouter(limiter, Policy{Name: "roles", Limit: PerWindow(1, time.Minute), Roles: map[string]Limit{"vip": Bucket(1, time.Minute, 3)}})
+	for i := 0; i < 3; i++ {
+		rec := serve(router, "vip")
+		if rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Policy") != "1;w=60;burst=3" {
+			t.Fatalf("vip request %d = %d %v", i, rec.Code, rec.Header())
+		}
+	}
+	if rec := serve(router, "vip"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("vip over burst = %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestHandlerFallsBackToMemory(t *testing.T) {
+	limiter := New(failingStore{}, nil)
+	router := newTestRouter(limiter, Policy{Name: "fallback", Key: KeyIP, Limit: PerWindow(1, time.Minute)})
+
+	if rec := serve(router, ""); rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Limit") != "1" {
+		t.Fatalf("first request = %d %v, want counted by the memory fallback", rec.Code, rec.Header())
+	}
+	if rec := serve(router, ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second request = %d, want 429 from the fallback", rec.Code)
+	}
+}
+
+func TestHandlerDisabled(t *testing.T) {
+	limiter := New(nil, nil)
+	limiter.enabled = false
+	router := newTestRouter(limiter, Policy{Name: "off", Limit: PerWindow(1, time.Minute)})
+	for i := 0; i < 3; i++ {
+		if rec := serve(router, ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d status = %d", i, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Result 表示一次限流判定的结果。
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// Store 定义限流计数的存储后端。
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// slidingWindowScript 以有序集合记录窗口内的请求时间戳。
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local member = ARGV[4]
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+  redis.call('ZADD', key, now, member)
+  count = count + 1
+  allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+  reset = tonumber(oldest[2]) + window - now
+end
+local retry = 0
+if allowed == 0 then
+  retry = reset
+end
+return {allowed, limit - count, retry, reset}
+`)
+
+// tokenBucketScript 在哈希中保存剩余令牌与上次补充时间。
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+local data = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate)
+end
+redis.call('HMSET', key, 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', key, math.ceil(capacity / rate))
+return {allowed, math.floor(tokens), retry, math.ceil((capacity - tokens) / rate)}
+`)
+
+// redisStore 基于 Redis 与 Lua 脚本实现原子限流。
+type redisStore struct {
+	client *redis.Client
+	seq    atomic.Uint64
+}
+
+// NewRedisStore 创建基于 Redis 的限流存储。
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+// Allow 在 Redis 中执行限流判定。
+func (s *redisStore) Allow(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	nowMs := now.UnixMilli()
+	var (
+		values []int64
+		err    error
+	)
+	switch limit.Algorithm {
+	case TokenBucket:
+		rate := float64(limit.Requests) / float64(limit.Window.Milliseconds())
+		values, err = tokenBucketScript.Run(ctx, s.client, []string{key}, nowMs, strconv.FormatFloat(rate, 'g', -1, 64), limit.capacity()).Int64Slice()
+	default:
+		member := strconv.FormatInt(nowMs, 10) + "-" + strconv.FormatUint(s.seq.Add(1), 10)
+		values, err = slidingWindowScript.Run(ctx, s.client, []string{key}, nowMs, limit.Window.Milliseconds(), limit.Requests, member).Int64Slice()
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected script reply %v", values)
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.capacity(),
+		Remaining:  int(max(values[1], 0)),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// memoryEntry 保存单个键在内存中的限流状态。
+type memoryEntry struct {
+	hits    []time.Time
+	tokens  float64
+	updated time.Time
+	expires time.Time
+}
+
+// memoryStore 在进程内存中限流，用于 Redis 不可用时的降级。
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	calls   int
+}
+
+// NewMemoryStore 创建进程内限流存储。
+func NewMemoryStore() Store {
+	return &memoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+// Allow 在内存中执行限流判定。
+func (s *memoryStore) Allow(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls%1024 == 0 {
+		s.sweep(now)
+	}
+
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expires) {
+		entry = &memoryEntry{tokens: float64(limit.capacity()), updated: now}
+		s.entries[key] = entry
+	}
+
+	if limit.Algorithm == TokenBucket {
+		return entry.takeToken(limit, now), nil
+	}
+	return entry.recordHit(limit, now), nil
+}
+
+// recordHit 按滑动窗口记录一次请求。
+func (e *memoryEntry) recordHit(limit Limit, now time.Time) Result {
+	cutoff := now.Add(-limit.Window)
+	kept := e.hits[:0]
+	for _, hit := range e.hits {
+		if hit.After(cutoff) {
+			kept = append(kept, hit)
+		}
+	}
+	e.hits = kept
+
+	allowed := len(e.hits) < limit.Requests
+	if allowed {
+		e.hits = append(e.hits, now)
+	}
+	e.expires = now.Add(limit.Window)
+
+	reset := limit.Window
+	if len(e.hits) > 0 {
+		reset = e.hits[0].Add(limit.Window).Sub(now)
+	}
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit.Requests,
+		Remaining:  max(limit.Requests-len(e.hits), 0),
+		ResetAfter: reset,
+	}
+	if !allowed {
+		result.RetryAfter = reset
+	}
+	return result
+}
+
+// takeToken 按令牌桶消耗一个令牌。
+func (e *memoryEntry) takeToken(limit Limit, now time.Time) Result {
+	capacity := float64(limit.capacity())
+	perMs := float64(limit.Requests) / float64(limit.Window.Milliseconds())
+	elapsed := float64(now.Sub(e.updated).Milliseconds())
+	if elapsed > 0 {
+		e.tokens = math.Min(capacity, e.tokens+elapsed*perMs)
+	}
+	e.updated = now
+
+	result := Result{Limit: limit.capacity()}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1-e.tokens)/perMs)) * time.Millisecond
+	}
+	result.Remaining = int(math.Floor(e.tokens))
+	refill := time.Duration(math.Ceil((capacity-e.tokens)/perMs)) * time.Millisecond
+	result.ResetAfter = refill
+	e.expires = now.Add(time.Duration(math.Ceil(capacity/perMs)) * time.Millisecond)
+	return result
+}
+
+// sweep 清理已过期的内存条目。
+func (s *memoryStore) sweep(now time.Time) {
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreSlidingWindow(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	limit := PerWindow(3, 10*time.Second)
+	start := time.Unix(1700000000, 0)
+
+	for i, offset := range []time.Duration{0, 2 * time.Second, 4 * time.Second} {
+		result, _ := store.Allow(ctx, "k", limit, start.Add(offset))
+		if !result.Allowed || result.Remaining != 2-i || result.Limit != 3 {
+			t.Fatalf("hit %d = %+v, want allowed with %d remaining", i, result, 2-i)
+		}
+	}
+
+	// 窗口内第 4 次被拒绝，需等到最早一次请求滑出窗口。
+	result, _ := store.Allow(ctx, "k", limit, start.Add(5*time.Second))
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 5*time.Second || result.ResetAfter != 5*time.Second {
+		t.Fatalf("over limit = %+v, want rejected with retry after 5s", result)
+	}
+
+	// 其他键互不影响。
+	if result, _ := store.Allow(ctx, "other", limit, start.Add(5*time.Second)); !result.Allowed {
+		t.Error("separate key was limited")
+	}
+
+	// 最早一次滑出窗口后释放一个名额。
+	result, _ = store.Allow(ctx, "k", limit, start.Add(10*time.Second+time.Millisecond))
+	if !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after slide = %+v, want allowed with 0 remaining", result)
+	}
+	if result, _ := store.Allow(ctx, "k", limit, start.Add(11*time.Second)); result.Allowed {
+		t.Error("window admitted more than the limit")
+	}
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	// 每 2 秒补充 1 个令牌，容量 3。
+	limit := Bucket(1, 2*time.Second, 3)
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		result, _ := store.Allow(ctx, "k", limit, start)
+		if !result.Allowed || result.Remaining != 2-i || result.Limit != 3 {
+			t.Fatalf("burst %d = %+v, want allowed with %d remaining", i, result, 2-i)
+		}
+	}
+	result, _ := store.Allow(ctx, "k", limit, start)
+	if result.Allowed || result.RetryAfter != 2*time.Second || result.ResetAfter != 6*time.Second {
+		t.Fatalf("empty bucket = %+v, want retry after 2s and reset after 6s", result)
+	}
+
+	// 1 秒只补充半个令牌，仍被拒绝。
+	result, _ = store.Allow(ctx, "k", limit, start.Add(time.Second))
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("half token = %+v, want retry after 1s", result)
+	}
+	result, _ = store.Allow(ctx, "k", limit, start.Add(2*time.Second))
+	if !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("refilled = %+v, want allowed", result)
+	}
+
+	// 长时间空闲后令牌不超过容量。
+	result, _ = store.Allow(ctx, "k", limit, start.Add(time.Hour))
+	if !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("after idle = %+v, want capacity minus one remaining", result)
+	}
+}
+
+func TestMemoryStoreSweepsExpiredEntries(t *testing.T) {
+	store := NewMemoryStore().(*memoryStore)
+	ctx := context.Background()
+	limit := PerWindow(1, time.Second)
+	start := time.Unix(1700000000, 0)
+
+	store.Allow(ctx, "stale", limit, start)
+	for i := 1; i < 1024; i++ {
+		store.Allow(ctx, "fresh", limit, start.Add(time.Minute))
+	}
+	if _, ok := store.entries["stale"]; ok {
+		t.Error("expired entry was not swept")
+	}
+	if _, ok := store.entries["fresh"]; !ok {
+		t.Error("live entry was swept")
+	}
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// maxDocumentBytes 限制知识库原始文件的最大体积。
+const maxDocumentBytes int64 = 20 * 1024 * 1024
+
+// UploadDocument 保存知识库上传的原始文件。
+// 最终的对象键格式为 knowledge/<路径片段>/<uuid>.<扩展名>。
+func (s *AvatarStorage) UploadDocument(ctx context.Context, data []byte, filename string, contentType string, pathSegments ...string) (string, error) {
+	if s == nil || s.client == nil {
+		return "", errors.New("object storage not configured")
+	}
+	if len(data) == 0 {
+		return "", errors.New("document file is empty")
+	}
+	if int64(len(data)) > maxDocumentBytes {
+		return "", fmt.Errorf("document size exceeds %d bytes", maxDocumentBytes)
+	}
+
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" || strings.EqualFold(contentType, "application/octet-stream") {
+		contentType = http.DetectContentType(data)
+	}
+
+	objectPathSegments := []string{"knowledge"}
+	for _, segment := range pathSegments {
+		trimmed := strings.Trim(segment, "/")
+		if trimmed != "" {
+			objectPathSegments = append(objectPathSegments, trimmed)
+		}
+	}
+	ext := strings.ToLower(strings.TrimSpace(filepath.Ext(filename)))
+	if ext == "" {
+		ext = ".bin"
+	}
+	objectName := path.Join(path.Join(objectPathSegments...), uuid.NewString()+ext)
+
+	uploadCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	_, err := s.client.PutObject(uploadCtx, s.bucket, objectName, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:        contentType,
+		ContentDisposition: fmt.Sprintf("attachment; filename*=UTF-8''%s", pathEscapeFilename(filepath.Base(filename))),
+	})
+	if err != nil {
+		return "", fmt.Errorf("upload document: %w", err)
+	}
+
+	return s.buildPublicURL(objectName), nil
+}
+
+// pathEscapeFilename 按 RFC 5987 编码文件名。
+func pathEscapeFilename(name string) string {
+	var sb strings.Builder
+	for _, b := range []byte(name) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9',
+			b == '.', b == '-', b == '_', b == '~':
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,82 @@
+package tts
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// mpegBitrates 保存 MPEG-1 Layer III 的码率表（kbps）。
+var mpegBitrates = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+
+// mpeg2Bitrates 保存 MPEG-2/2.5 Layer III 的码率表（kbps）。
+var mpeg2Bitrates = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+
+// EstimateDurationMs 根据音频字节与格式估算播放时长，无法识别时返回 0。
+func EstimateDurationMs(audio []byte, format string, sampleRate int) int {
+	if len(audio) == 0 {
+		return 0
+	}
+	normalized := strings.ToLower(strings.TrimSpace(format))
+	switch {
+	case strings.Contains(normalized, "wav") || strings.Contains(normalized, "wave"):
+		if ms := wavDurationMs(audio); ms > 0 {
+			return ms
+		}
+		return pcmDurationMs(len(audio), sampleRate)
+	case normalized == "pcm" || strings.Contains(normalized, "l16"):
+		return pcmDurationMs(len(audio), sampleRate)
+	case normalized == "" || strings.Contains(normalized, "mp3") || strings.Contains(normalized, "mpeg"):
+		return mp3DurationMs(audio)
+	default:
+		return 0
+	}
+}
+
+// pcmDurationMs 按 16bit 单声道估算 PCM 时长。
+func pcmDurationMs(size int, sampleRate int) int {
+	if sampleRate <= 0 {
+		sampleRate = 22050
+	}
+	return int(int64(size) * 1000 / int64(sampleRate*2))
+}
+
+// wavDurationMs 解析 WAV 头部中的字节率计算时长。
+func wavDurationMs(audio []byte) int {
+	if len(audio) < 44 || string(audio[0:4]) != "RIFF" || string(audio[8:12]) != "WAVE" {
+		return 0
+	}
+	byteRate := int64(binary.LittleEndian.Uint32(audio[28:32]))
+	if byteRate <= 0 {
+		return 0
+	}
+	return int(int64(len(audio)-44) * 1000 / byteRate)
+}
+
+// mp3DurationMs 读取首个帧头按恒定码率估算 MP3 时长。
+func mp3DurationMs(audio []byte) int {
+	offset := 0
+	if len(audio) > 10 && string(audio[0:3]) == "ID3" {
+		size := int(audio[6]&0x7f)<<21 | int(audio[7]&0x7f)<<14 | int(audio[8]&0x7f)<<7 | int(audio[9]&0x7f)
+		offset = 10 + size
+	}
+	for i := offset; i+4 <= len(audio); i++ {
+		if audio[i] != 0xff || audio[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		version := (audio[i+1] >> 3) & 0x03
+		layer := (audio[i+1] >> 1) & 0x03
+		if version == 0x01 || layer != 0x01 {
+			continue
+		}
+		index := int(audio[i+2] >> 4)
+		kbps := mpegBitrates[index]
+		if version != 0x03 {
+			kbps = mpeg2Bitrates[index]
+		}
+		if kbps <= 0 {
+			continue
+		}
+		return int(int64(len(audio)-i) * 8 / int64(kbps))
+	}
+	return 0
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
+
+	"auralis_back/ratelimit"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,8 +18,11 @@ type Module struct {
 	client *Client
 }
 
+// previewRateLimit 限制试听接口的调用频率，试听会直接消耗合成服务额度。
+var previewRateLimit = ratelimit.Policy{Name: "tts-preview", Key: ratelimit.KeyUserOrIP, Limit: ratelimit.PerWindow(20, time.Minute)}
+
 // RegisterRoutes 注册语音合成路由并初始化模块。
-func RegisterRoutes(router *gin.Engine) (*Module, error) {
+func RegisterRoutes(router *gin.Engine, limiter *ratelimit.Limiter) (*Module, error) {
 	client, err := NewClientFromEnv()
 	if err != nil {
 		return nil, err
@@ -26,7 +32,7 @@ func RegisterRoutes(router *gin.Engine) (*Module, error) {
 
 	group := router.Group("/tts")
 	group.GET("/voices", module.handleVoices)
-	group.POST("/preview", module.handlePreview)
+	group.POST("/preview", limiter.Handler(previewRateLimit), module.handlePreview)
 
 	return module, nil
 }